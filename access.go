@@ -0,0 +1,225 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// ErrNoAccessSets is returned by RefreshAccessSets when the pipeline was
+// built without WithAccessSets.
+var ErrNoAccessSets = errors.New("rag: pipeline has no access sets")
+
+// AccessSets tunes WithAccessSets. Zero fields take the defaults given.
+type AccessSets struct {
+	// Refresh is how often RefreshAccessSets looks the sets up again. A
+	// set that has not been refreshed for twice as long, e.g. because
+	// RefreshAccessSets is not running or SpiceDB is down, is looked up
+	// again by the next query needing it. The default is one minute.
+	Refresh time.Duration
+
+	// Idle is how long a subject's set is kept, and refreshed, without
+	// being used. The default is ten minutes.
+	Idle time.Duration
+
+	// MaxSubjects caps the number of sets kept; when it is reached, the
+	// least recently used is dropped. The default is 10000.
+	MaxSubjects int
+}
+
+// WithAccessSets materializes the accessible set of every active subject:
+// the first query of a subject looks up the objects it can access, as
+// FilterPrefilter does, and later ones filter against that set in memory
+// instead of calling SpiceDB. RefreshAccessSets keeps the sets current in
+// the background. A set is kept per subject, tenant and permission set.
+//
+// The pipeline uses FilterPrefilter unless FilterAdaptive is selected,
+// whose lookups, like Suggest's, then also come from the sets. Queries
+// that ask for a specific consistency or carry caveat context bypass the
+// sets, as they bypass WithCheckCache.
+//
+// A set is up to Refresh old, so a revoked permission may still be
+// honoured that long. GrantAccess, RevokeAccess and SetAccess drop every
+// set, so the pipeline's own changes apply to the next query, and
+// GrantAccessUntil drops them again when its share expires.
+func WithAccessSets(a AccessSets) Option {
+	return func(r *RAGPipeline) {
+		r.access = newAccessStore(a)
+	}
+}
+
+// accessStore holds the materialized sets of WithAccessSets.
+type accessStore struct {
+	AccessSets
+	now func() time.Time
+
+	mu   sync.Mutex
+	sets map[string]*materializedSet
+}
+
+// materializedSet is the accessible set of one subject, tenant and
+// permission set.
+type materializedSet struct {
+	subject *apiv1.SubjectReference
+	tenant  string
+	perms   *permissionSet // nil for the pipeline's permissions
+
+	objects   map[string]bool
+	sorted    []string
+	refreshed time.Time
+	used      time.Time
+}
+
+func newAccessStore(a AccessSets) *accessStore {
+	if a.Refresh == 0 {
+		a.Refresh = time.Minute
+	}
+	if a.Idle == 0 {
+		a.Idle = 10 * time.Minute
+	}
+	if a.MaxSubjects == 0 {
+		a.MaxSubjects = 10000
+	}
+	return &accessStore{AccessSets: a, now: time.Now, sets: make(map[string]*materializedSet)}
+}
+
+// RefreshAccessSets looks up the sets of WithAccessSets again every
+// Refresh, and drops those idle for longer than Idle, until ctx is done.
+// A set that fails to refresh is kept until it is too old to use. It
+// returns ErrNoAccessSets unless WithAccessSets was used.
+func (r *RAGPipeline) RefreshAccessSets(ctx context.Context) error {
+	if r.access == nil {
+		return ErrNoAccessSets
+	}
+	ticker := time.NewTicker(r.access.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		r.access.refresh(ctx, r)
+	}
+}
+
+// materialized returns the accessible set of subject in tenant for the
+// permissions of ctx, looking it up unless a fresh one is kept. The set
+// is shared and must not be modified.
+func (s *accessStore) materialized(ctx context.Context, r *RAGPipeline, subject *apiv1.SubjectReference, tenant string) (map[string]bool, []string, error) {
+	perms, _ := ctx.Value(permissionsKey{}).(*permissionSet)
+	key := accessKey(subject, tenant, perms)
+	now := s.now()
+
+	s.mu.Lock()
+	if set, ok := s.sets[key]; ok && now.Sub(set.refreshed) < 2*s.Refresh {
+		set.used = now
+		s.mu.Unlock()
+		return set.objects, set.sorted, nil
+	}
+	s.mu.Unlock()
+
+	objects, sorted, err := r.lookupObjects(ctx, subject, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sets[key]; !ok && len(s.sets) >= s.MaxSubjects {
+		s.evictLocked()
+	}
+	s.sets[key] = &materializedSet{
+		subject: subject, tenant: tenant, perms: perms,
+		objects: objects, sorted: sorted, refreshed: now, used: now,
+	}
+	return objects, sorted, nil
+}
+
+// evictLocked drops the least recently used set. s.mu must be held.
+func (s *accessStore) evictLocked() {
+	var oldest string
+	for k, set := range s.sets {
+		if oldest == "" || set.used.Before(s.sets[oldest].used) {
+			oldest = k
+		}
+	}
+	delete(s.sets, oldest)
+}
+
+// refresh looks up every set used within Idle again and drops the others.
+func (s *accessStore) refresh(ctx context.Context, r *RAGPipeline) {
+	now := s.now()
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.sets))
+	sets := make([]*materializedSet, 0, len(s.sets))
+	for k, set := range s.sets {
+		if now.Sub(set.used) > s.Idle {
+			delete(s.sets, k)
+			continue
+		}
+		keys = append(keys, k)
+		sets = append(sets, set)
+	}
+	s.mu.Unlock()
+
+	for i, set := range sets {
+		lookupCtx := contextWithPermissions(contextWithConsistency(ctx, r.consistency), set.perms)
+		objects, sorted, err := r.lookupObjects(lookupCtx, set.subject, set.tenant)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		s.mu.Lock()
+		// The set may have been dropped or replaced meanwhile.
+		if s.sets[keys[i]] == set {
+			s.sets[keys[i]] = &materializedSet{
+				subject: set.subject, tenant: set.tenant, perms: set.perms,
+				objects: objects, sorted: sorted, refreshed: now, used: set.used,
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// purge drops every set.
+func (s *accessStore) purge() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sets)
+}
+
+// accessKey is the key of the set of subject in tenant for perms.
+func accessKey(subject *apiv1.SubjectReference, tenant string, perms *permissionSet) string {
+	key := subjectKey(subject) + "@" + tenant
+	if perms != nil {
+		key += "@" + perms.mode.String() + ":" + perms.String()
+	}
+	return key
+}
+
+// accessTypes returns the object types accessibleObjects looks up, in
+// tenant's definitions: the pipeline's resource type, then those of
+// WithTypePermissions, sorted.
+func (r *RAGPipeline) accessTypes(tenant string) []string {
+	types := []string{r.resourceType}
+	for objType := range r.typePerms {
+		if objType != r.resourceType {
+			types = append(types, objType)
+		}
+	}
+	slices.Sort(types[1:])
+	for i, objType := range types {
+		types[i] = r.tenantType(tenant, objType)
+	}
+	return types
+}
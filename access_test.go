@@ -0,0 +1,78 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestAccessSetsFilterInMemory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithAccessSets(rag.AccessSets{}))
+
+	for range 3 {
+		results, err := pipeline.Query(ctx, "emilia", "o")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc1"}, results)
+	}
+	_, err := pipeline.Suggest(ctx, "emilia", "", 5)
+	require.NoError(t, err)
+	require.Len(t, fake.consistencies(), 1, "one lookup serves every query")
+	require.Zero(t, fake.checkCount())
+
+	// Other subjects and permissions have sets of their own.
+	_, err = pipeline.Query(ctx, "beatrice", "o")
+	require.NoError(t, err)
+	_, err = pipeline.Query(ctx, "emilia", "o", rag.WithPermissions(rag.AllPermissions, "read", "export"))
+	require.NoError(t, err)
+	require.Len(t, fake.consistencies(), 4)
+
+	// The pipeline's own grants apply straight away.
+	_, err = pipeline.GrantAccess(ctx, "doc2", "viewer", "user:emilia")
+	require.NoError(t, err)
+	results, err := pipeline.Query(ctx, "emilia", "o")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc2"}, results)
+
+	// A fully consistent query always looks up.
+	_, err = pipeline.Query(ctx, "emilia", "o", rag.WithConsistency(rag.FullyConsistent()))
+	require.NoError(t, err)
+	require.Len(t, fake.consistencies(), 6)
+}
+
+func TestRefreshAccessSets(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithAccessSets(rag.AccessSets{Refresh: 10 * time.Millisecond}))
+	require.ErrorIs(t, rag.NewRAGPipeline(client, "document", "read", nil).RefreshAccessSets(ctx), rag.ErrNoAccessSets)
+
+	results, err := pipeline.Query(ctx, "emilia", "o")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	done := make(chan error, 1)
+	go func() { done <- pipeline.RefreshAccessSets(ctx) }()
+
+	// A grant written by another pipeline shows up once refreshed.
+	_, err = rag.NewRAGPipeline(client, "document", "read", nil).GrantAccess(ctx, "doc3", "viewer", "user:emilia")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		results, err := pipeline.Query(ctx, "emilia", "o")
+		return err == nil && len(results) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.GreaterOrEqual(t, len(fake.consistencies()), 2)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
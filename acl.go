@@ -0,0 +1,446 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ACLEntry is one relationship on a document's SpiceDB object.
+type ACLEntry struct {
+	// Relation is the relation the subject holds, e.g. "viewer".
+	Relation string
+
+	// Subject is written as "type:id" or "type:id#relation"; "user:*"
+	// grants every user.
+	Subject string
+
+	// Caveat names the caveat the relationship is conditional on, if any.
+	Caveat string
+
+	// ExpiresAt is when SpiceDB drops the relationship, zero if never;
+	// see GrantAccessUntil.
+	ExpiresAt time.Time
+}
+
+// GrantAccess gives subject ("user:emilia", "group:eng#member", "user:*")
+// relation on the document docID, so applications need not build
+// RelationshipUpdates by hand. Granting an existing relationship is not an
+// error. It returns the revision of the write, to query at with
+// AtLeastAsFresh.
+//
+// The document's object is the one it maps to if it is in the corpus, and
+// "<resource type>:<docID>" otherwise, e.g. for documents kept in a
+// DocumentStore.
+func (r *RAGPipeline) GrantAccess(ctx context.Context, docID, relation, subject string) (*apiv1.ZedToken, error) {
+	return r.writeAccess(ctx, apiv1.RelationshipUpdate_OPERATION_TOUCH, docID, relation, subject, time.Time{})
+}
+
+// GrantAccessUntil is GrantAccess for a temporary share: SpiceDB drops
+// the relationship by itself at until, so no cleanup job is needed.
+// Granting an existing relationship moves its expiry to until. The
+// relation must allow expiration in the schema, e.g.
+//
+//	use expiration
+//
+//	definition document {
+//	  relation viewer: user with expiration
+//	}
+//
+// SpiceDB reports no change when the relationship expires, so neither
+// CachingChecker.Watch nor RefreshAccessSets notices it; instead the
+// pipeline purges its check cache and access sets at until. Shares
+// expiring that were written otherwise may be honoured for up to the
+// cache TTL or the access sets' Refresh longer.
+func (r *RAGPipeline) GrantAccessUntil(ctx context.Context, docID, relation, subject string, until time.Time) (*apiv1.ZedToken, error) {
+	if until.IsZero() {
+		return nil, fmt.Errorf("rag: no expiry for %s on document %q", subject, docID)
+	}
+	token, err := r.writeAccess(ctx, apiv1.RelationshipUpdate_OPERATION_TOUCH, docID, relation, subject, until)
+	if err != nil {
+		return nil, err
+	}
+	time.AfterFunc(time.Until(until), r.purgeDecisions)
+	return token, nil
+}
+
+// purgeDecisions drops the decisions of the check cache, if any, and the
+// access sets.
+func (r *RAGPipeline) purgeDecisions() {
+	if cache, ok := r.checker.(*CachingChecker); ok {
+		cache.Purge()
+	}
+	r.access.purge()
+}
+
+// RevokeAccess removes a relationship written by GrantAccess. Revoking a
+// relationship that does not exist is not an error.
+func (r *RAGPipeline) RevokeAccess(ctx context.Context, docID, relation, subject string) (*apiv1.ZedToken, error) {
+	return r.writeAccess(ctx, apiv1.RelationshipUpdate_OPERATION_DELETE, docID, relation, subject, time.Time{})
+}
+
+// writeAccess applies op to the relationship of subject on docID, which
+// expires at expires unless it is zero.
+func (r *RAGPipeline) writeAccess(ctx context.Context, op apiv1.RelationshipUpdate_Operation, docID, relation, subject string, expires time.Time) (*apiv1.ZedToken, error) {
+	if relation == "" {
+		return nil, fmt.Errorf("rag: no relation to %s on document %q", subject, docID)
+	}
+	subj, err := ParseSubjectReference(subject)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.objectForID(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.spiceClient.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{
+		Updates: []*apiv1.RelationshipUpdate{{
+			Operation:    op,
+			Relationship: &apiv1.Relationship{Resource: res, Relation: relation, Subject: subj, OptionalExpiresAt: expiry(expires)},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rag: writing %s#%s@%s: %w", objectKey(res), relation, subject, err)
+	}
+	r.access.purge()
+	return resp.GetWrittenAt(), nil
+}
+
+// ListAccess returns the relationships on the document docID's object,
+// sorted by relation and subject. These are the direct grants; use
+// ExportACLAnnotations for who effectively holds the permission.
+func (r *RAGPipeline) ListAccess(ctx context.Context, docID string) ([]ACLEntry, error) {
+	res, err := r.objectForID(docID)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := r.spiceClient.ReadRelationships(ctx, &apiv1.ReadRelationshipsRequest{
+		Consistency: consistencyFromContext(ctx),
+		RelationshipFilter: &apiv1.RelationshipFilter{
+			ResourceType:       res.GetObjectType(),
+			OptionalResourceId: res.GetObjectId(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rag: reading relationships of %s: %w", objectKey(res), err)
+	}
+
+	var entries []ACLEntry
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rag: reading relationships of %s: %w", objectKey(res), err)
+		}
+		rel := resp.GetRelationship()
+		entries = append(entries, ACLEntry{
+			Relation:  rel.GetRelation(),
+			Subject:   subjectKey(rel.GetSubject()),
+			Caveat:    rel.GetOptionalCaveat().GetCaveatName(),
+			ExpiresAt: expiresAt(rel),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Relation != entries[j].Relation {
+			return entries[i].Relation < entries[j].Relation
+		}
+		return entries[i].Subject < entries[j].Subject
+	})
+	return entries, nil
+}
+
+// SetAccess makes entries the only relationships of the given relations
+// on object ("document:handbook"), as when mirroring another system's
+// sharing settings: missing relationships are written and the others of
+// those relations deleted, in one WriteRelationships call. Relationships
+// of other relations, such as a document's parent folder, are kept.
+//
+// Every entry's relation must be one of relations, and entries cannot be
+// caveated. Entries with an ExpiresAt are written to expire then, as by
+// GrantAccessUntil. SetAccess returns the revision of the write, or nil if the
+// object's access was already as given.
+func (r *RAGPipeline) SetAccess(ctx context.Context, object string, relations []string, entries []ACLEntry) (*apiv1.ZedToken, error) {
+	res, err := ParseObjectReference(object)
+	if err != nil {
+		return nil, err
+	}
+	managed := make(map[string]bool, len(relations))
+	for _, rel := range relations {
+		managed[rel] = true
+	}
+	desired := make(map[string]*apiv1.Relationship, len(entries))
+	for _, e := range entries {
+		if !managed[e.Relation] {
+			return nil, fmt.Errorf("rag: setting access on %s: relation %q is not one of %v", object, e.Relation, relations)
+		}
+		if e.Caveat != "" {
+			return nil, fmt.Errorf("rag: setting access on %s: caveated entries are not supported", object)
+		}
+		subj, err := ParseSubjectReference(e.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("rag: setting access on %s: %w", object, err)
+		}
+		desired[e.Relation+"@"+e.Subject] = &apiv1.Relationship{Resource: res, Relation: e.Relation, Subject: subj, OptionalExpiresAt: expiry(e.ExpiresAt)}
+	}
+
+	stream, err := r.spiceClient.ReadRelationships(ctx, &apiv1.ReadRelationshipsRequest{
+		Consistency: consistencyFromContext(ctx),
+		RelationshipFilter: &apiv1.RelationshipFilter{
+			ResourceType:       res.GetObjectType(),
+			OptionalResourceId: res.GetObjectId(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rag: reading relationships of %s: %w", object, err)
+	}
+	var updates []*apiv1.RelationshipUpdate
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rag: reading relationships of %s: %w", object, err)
+		}
+		rel := resp.GetRelationship()
+		if !managed[rel.GetRelation()] {
+			continue
+		}
+		key := rel.GetRelation() + "@" + subjectKey(rel.GetSubject())
+		if want, ok := desired[key]; ok && rel.GetOptionalCaveat() == nil && expiresAt(rel).Equal(expiresAt(want)) {
+			delete(desired, key)
+			continue
+		}
+		if _, ok := desired[key]; !ok {
+			updates = append(updates, &apiv1.RelationshipUpdate{Operation: apiv1.RelationshipUpdate_OPERATION_DELETE, Relationship: rel})
+		}
+	}
+	// A caveated relationship, or one expiring at another time, left in
+	// desired is replaced by the TOUCH.
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		updates = append(updates, &apiv1.RelationshipUpdate{Operation: apiv1.RelationshipUpdate_OPERATION_TOUCH, Relationship: desired[key]})
+	}
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	resp, err := r.spiceClient.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{Updates: updates})
+	if err != nil {
+		return nil, fmt.Errorf("rag: setting access on %s: %w", object, err)
+	}
+	r.access.purge()
+	return resp.GetWrittenAt(), nil
+}
+
+// expiry returns t as a relationship expiry, nil for never.
+func expiry(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// expiresAt returns when rel expires, zero if never.
+func expiresAt(rel *apiv1.Relationship) time.Time {
+	if ts := rel.GetOptionalExpiresAt(); ts != nil {
+		return ts.AsTime()
+	}
+	return time.Time{}
+}
+
+// ListObjects returns the IDs of the objects of resourceType that have
+// relationships of relation, sorted, e.g. the groups with members. With
+// SetAccess it lets a mirror of another system remove the objects that
+// system no longer has.
+func (r *RAGPipeline) ListObjects(ctx context.Context, resourceType, relation string) ([]string, error) {
+	stream, err := r.spiceClient.ReadRelationships(ctx, &apiv1.ReadRelationshipsRequest{
+		Consistency: consistencyFromContext(ctx),
+		RelationshipFilter: &apiv1.RelationshipFilter{
+			ResourceType:     resourceType,
+			OptionalRelation: relation,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rag: reading %s relationships of %s objects: %w", relation, resourceType, err)
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rag: reading %s relationships of %s objects: %w", relation, resourceType, err)
+		}
+		id := resp.GetRelationship().GetResource().GetObjectId()
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// objectForID returns the SpiceDB object of the document docID: the one
+// it maps to if it is in the corpus (chunks map to their parent's), and
+// "<resource type>:<docID>" otherwise.
+func (r *RAGPipeline) objectForID(docID string) (*apiv1.ObjectReference, error) {
+	for _, d := range r.snapshot() {
+		if d.ID == docID || r.sourceID(d) == docID {
+			return r.resourceFor(d)
+		}
+	}
+	return ParseObjectReference(r.resourceType + ":" + docID)
+}
+
+// Subject is a SpiceDB subject: one holding the pipeline's permission on
+// a document, as returned by WhoCanRead, or the caller of a query, see
+// WithSubject.
+type Subject struct {
+	// Type and ID identify the subject; ID is "*" for a wildcard grant to
+	// every subject of Type.
+	Type, ID string
+
+	// Relation is the subject relation, e.g. "member", if any.
+	Relation string
+
+	// Tenant is the tenant the subject belongs to under WithTenancy, see
+	// QueryRequest.Tenant. Type stays unprefixed under
+	// WithTenantPrefixes.
+	Tenant string
+
+	// Conditional reports that the permission depends on a caveat whose
+	// context was not supplied, so the subject may or may not hold it.
+	// It is only set by WhoCanRead.
+	Conditional bool
+}
+
+// String returns s as "type:id" or "type:id#relation".
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Type + ":" + s.ID
+	}
+	return s.Type + ":" + s.ID + "#" + s.Relation
+}
+
+// ParseSubject reads a Subject written as by String, or a bare ID, which
+// leaves Type empty for the caller to default. It does not validate v;
+// use ParseSubjectReference for that.
+func ParseSubject(v string) Subject {
+	typ, rest, ok := strings.Cut(v, ":")
+	if !ok {
+		return Subject{ID: v}
+	}
+	id, relation, _ := strings.Cut(rest, "#")
+	return Subject{Type: typ, ID: id, Relation: relation}
+}
+
+// WhoCanRead returns the subjects of the pipeline's subject type that
+// hold its permission on the document docID, sorted by ID. Unlike
+// ListAccess it resolves groups, nested relations and wildcards, so it
+// is the document's effective audience, the same one queries enforce.
+// The document's object is found as for GrantAccess.
+func (r *RAGPipeline) WhoCanRead(ctx context.Context, docID string) ([]Subject, error) {
+	res, err := r.objectForID(docID)
+	if err != nil {
+		return nil, err
+	}
+	tenant := r.tenantOf(res)
+	found, err := r.lookupSubjects(ctx, consistencyFromContext(ctx), res, r.tenantType(tenant, r.subjectType), r.subjectRelation)
+	if err != nil {
+		return nil, fmt.Errorf("rag: looking up subjects of %s: %w", objectKey(res), err)
+	}
+
+	subjects := make([]Subject, len(found))
+	for i, s := range found {
+		subjects[i] = Subject{
+			Type:        r.subjectType,
+			ID:          s.id,
+			Relation:    r.subjectRelation,
+			Tenant:      tenant,
+			Conditional: s.conditional,
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].ID < subjects[j].ID })
+	return subjects, nil
+}
+
+// foundSubject is a subject found by lookupSubjects.
+type foundSubject struct {
+	id          string
+	conditional bool
+}
+
+// lookupSubjects returns the subjects of subjectType (and relation) that
+// hold the pipeline's permissions on res, in the order SpiceDB returns
+// them. With WithDefaultPermissions the lookups of each permission are
+// combined like query checks: a subject is conditional if it holds the
+// set only depending on a caveat.
+func (r *RAGPipeline) lookupSubjects(ctx context.Context, consistency *apiv1.Consistency, res *apiv1.ObjectReference, subjectType, relation string) ([]foundSubject, error) {
+	ps := r.permissionsOf(contextWithPermissions(ctx, r.permissions), res.GetObjectType())
+	var order []string
+	results := make(map[string]CheckResult)
+	counts := make(map[string]int)
+	for n, perm := range ps.perms {
+		stream, err := r.spiceClient.LookupSubjects(ctx, &apiv1.LookupSubjectsRequest{
+			Consistency:             consistency,
+			Resource:                res,
+			Permission:              perm,
+			SubjectObjectType:       subjectType,
+			OptionalSubjectRelation: relation,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			subj := resp.GetSubject()
+			id := subj.GetSubjectObjectId()
+			next := CheckResult{Decision: DecisionAllowed}
+			if subj.GetPermissionship() == apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_CONDITIONAL_PERMISSION {
+				next.Decision = DecisionConditional
+			}
+			if _, ok := results[id]; !ok {
+				if n > 0 && ps.mode == AllPermissions {
+					// Missing from an earlier lookup: denied.
+					continue
+				}
+				order = append(order, id)
+			}
+			results[id] = ps.combine(results[id], next, counts[id] == 0)
+			counts[id]++
+		}
+	}
+
+	found := make([]foundSubject, 0, len(order))
+	for _, id := range order {
+		if ps.mode == AllPermissions && counts[id] < len(ps.perms) {
+			continue
+		}
+		found = append(found, foundSubject{id: id, conditional: results[id].Decision == DecisionConditional})
+	}
+	return found, nil
+}
@@ -0,0 +1,141 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// ACLExport is a snapshot of who may read each document, meant to be
+// written into a vector database's payload so it can pre-filter coarsely
+// before the pipeline runs its precise SpiceDB check.
+type ACLExport struct {
+	// Principals maps document IDs to the subjects holding the pipeline's
+	// permission on them, formatted as "type:id" (or "type:id#relation"),
+	// sorted. Wildcards appear as "user:*". Conditionally permitted
+	// subjects are included; the query-time check settles them.
+	Principals map[string][]string
+
+	// ZedToken is the SpiceDB revision the export was computed at. Store it
+	// next to the annotations: they are stale as soon as relationships
+	// change after this revision.
+	ZedToken *apiv1.ZedToken
+
+	// ComputedAt is the wall-clock time the export started.
+	ComputedAt time.Time
+}
+
+// IsStale reports whether the export is older than maxAge.
+func (e *ACLExport) IsStale(maxAge time.Duration) bool {
+	return time.Since(e.ComputedAt) > maxAge
+}
+
+// ExportOption configures ExportACLAnnotations and StreamACLAnnotations.
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	subjectType     string
+	subjectRelation string
+}
+
+// ExportSubjects selects which subjects are exported, e.g. ("group",
+// "member") to export coarse group principals instead of individual users.
+// The default is the pipeline's subject type and relation, see
+// WithDefaultSubjectType.
+func ExportSubjects(objectType, relation string) ExportOption {
+	return func(c *exportConfig) {
+		c.subjectType = objectType
+		c.subjectRelation = relation
+	}
+}
+
+// ExportACLAnnotations computes the principal list of every mapped document
+// in the corpus. See StreamACLAnnotations for corpora too large to hold the
+// result in memory.
+func (r *RAGPipeline) ExportACLAnnotations(ctx context.Context, opts ...ExportOption) (*ACLExport, error) {
+	export := &ACLExport{
+		Principals: make(map[string][]string),
+		ComputedAt: time.Now(),
+	}
+
+	token, err := r.StreamACLAnnotations(ctx, func(docID string, principals []string) error {
+		export.Principals[docID] = principals
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	export.ZedToken = token
+	return export, nil
+}
+
+// StreamACLAnnotations calls fn with the principal list of each mapped
+// document, one document at a time. All lookups are pinned to a single
+// SpiceDB snapshot, which is returned so callers can record it alongside
+// the annotations. Unmapped documents are skipped.
+func (r *RAGPipeline) StreamACLAnnotations(ctx context.Context, fn func(docID string, principals []string) error, opts ...ExportOption) (*apiv1.ZedToken, error) {
+	cfg := exportConfig{subjectType: r.subjectType, subjectRelation: r.subjectRelation}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	schema, err := r.spiceClient.ReadSchema(ctx, &apiv1.ReadSchemaRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("rag: reading snapshot revision: %w", err)
+	}
+	token := schema.GetReadAt()
+	consistency := &apiv1.Consistency{
+		Requirement: &apiv1.Consistency_AtExactSnapshot{AtExactSnapshot: token},
+	}
+
+	// Chunks of one document typically share an object; look each up once.
+	seen := make(map[string][]string)
+
+	for _, d := range r.snapshot() {
+		res, err := r.resourceFor(d)
+		if err != nil {
+			continue
+		}
+
+		key := objectKey(res)
+		principals, ok := seen[key]
+		if !ok {
+			principals, err = r.lookupPrincipals(ctx, res, cfg, consistency)
+			if err != nil {
+				return nil, fmt.Errorf("rag: exporting ACL for %q: %w", d.ID, err)
+			}
+			seen[key] = principals
+		}
+
+		if err := fn(d.ID, principals); err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+func (r *RAGPipeline) lookupPrincipals(ctx context.Context, res *apiv1.ObjectReference, cfg exportConfig, consistency *apiv1.Consistency) ([]string, error) {
+	subjectType := r.tenantType(r.tenantOf(res), cfg.subjectType)
+	found, err := r.lookupSubjects(ctx, consistency, res, subjectType, cfg.subjectRelation)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := ""
+	if cfg.subjectRelation != "" {
+		suffix = "#" + cfg.subjectRelation
+	}
+
+	principals := []string{}
+	for _, s := range found {
+		principals = append(principals, subjectType+":"+s.id+suffix)
+	}
+
+	sort.Strings(principals)
+	return principals, nil
+}
@@ -0,0 +1,67 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestExportACLAnnotations(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient(
+		"document:doc1#read@user:emilia",
+		"document:doc2#read@user:beatrice",
+		"document:doc3#read@user:*",
+		"document:doc3#read@group:eng",
+	)
+	docs := append(scenarioDocs(),
+		// A second chunk of doc1 shares its object.
+		rag.Document{ID: "doc1-part2", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}},
+		rag.Document{ID: "unmapped"},
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	export, err := pipeline.ExportACLAnnotations(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "fake-revision", export.ZedToken.GetToken())
+	require.False(t, export.IsStale(time.Minute))
+	require.Equal(t, map[string][]string{
+		"doc1":       {"user:emilia"},
+		"doc1-part2": {"user:emilia"},
+		"doc2":       {"user:beatrice"},
+		"doc3":       {"user:*"},
+	}, export.Principals)
+
+	groups, err := pipeline.ExportACLAnnotations(context.Background(), rag.ExportSubjects("group", "member"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"group:eng#member"}, groups.Principals["doc3"])
+	require.Empty(t, groups.Principals["doc1"])
+
+	// The pipeline's subject type is the default.
+	pipeline = rag.NewRAGPipeline(client, "document", "read", docs, rag.WithDefaultSubjectType("group", "member"))
+	export, err = pipeline.ExportACLAnnotations(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, groups.Principals, export.Principals)
+}
+
+func TestStreamACLAnnotationsStopsOnCallbackError(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	stop := errors.New("stop")
+	calls := 0
+	_, err := pipeline.StreamACLAnnotations(context.Background(), func(string, []string) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,267 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestGrantRevokeListAccess(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	docs := scenarioDocs()
+	docs[1].Metadata[rag.SpiceDBObjectKey] = "wiki_page:playbook"
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	token, err := pipeline.GrantAccess(ctx, "doc1", "owner", "user:emilia")
+	require.NoError(t, err)
+	require.NotEmpty(t, token.GetToken())
+	_, err = pipeline.GrantAccess(ctx, "doc1", "viewer", "group:eng#member")
+	require.NoError(t, err)
+	// The document's own mapping is used when it is in the corpus.
+	_, err = pipeline.GrantAccess(ctx, "doc2", "viewer", "user:beatrice")
+	require.NoError(t, err)
+	// Documents outside the corpus use the pipeline's resource type.
+	_, err = pipeline.GrantAccess(ctx, "external", "viewer", "user:*")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"document:doc1#read@group:eng#member",
+		"document:doc1#read@user:emilia",
+		"document:external#read@user:*",
+		"wiki_page:playbook#read@user:beatrice",
+	}, fake.tuples())
+
+	acl, err := pipeline.ListAccess(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{
+		{Relation: "owner", Subject: "user:emilia"},
+		{Relation: "viewer", Subject: "group:eng#member"},
+	}, acl)
+
+	_, err = pipeline.RevokeAccess(ctx, "doc1", "owner", "user:emilia")
+	require.NoError(t, err)
+	_, err = pipeline.RevokeAccess(ctx, "doc1", "owner", "user:emilia")
+	require.NoError(t, err, "revoking twice is not an error")
+	acl, err = pipeline.ListAccess(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{{Relation: "viewer", Subject: "group:eng#member"}}, acl)
+
+	acl, err = pipeline.ListAccess(ctx, "doc3")
+	require.NoError(t, err)
+	require.Empty(t, acl)
+}
+
+func TestGrantAccessInvalidArguments(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	_, err := pipeline.GrantAccess(context.Background(), "doc1", "viewer", "emilia")
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+	_, err = pipeline.GrantAccess(context.Background(), "doc1", "viewer", "group:eng#")
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+	_, err = pipeline.GrantAccess(context.Background(), "doc1", "", "user:emilia")
+	require.Error(t, err)
+	require.Empty(t, fake.tuples())
+}
+
+func TestWhoCanRead(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	for _, g := range []struct{ doc, subject string }{
+		{"doc1", "user:emilia"},
+		{"doc1", "user:beatrice"},
+		{"doc1", "group:eng#member"},
+		{"external", "user:*"},
+	} {
+		_, err := pipeline.GrantAccess(ctx, g.doc, "viewer", g.subject)
+		require.NoError(t, err)
+	}
+
+	subjects, err := pipeline.WhoCanRead(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []rag.Subject{
+		{Type: "user", ID: "beatrice"},
+		{Type: "user", ID: "emilia"},
+	}, subjects, "only subjects of the pipeline's subject type")
+	require.Equal(t, "user:beatrice", subjects[0].String())
+
+	subjects, err = pipeline.WhoCanRead(ctx, "external")
+	require.NoError(t, err)
+	require.Equal(t, []rag.Subject{{Type: "user", ID: "*"}}, subjects)
+
+	subjects, err = pipeline.WhoCanRead(ctx, "doc2")
+	require.NoError(t, err)
+	require.Empty(t, subjects)
+}
+
+func TestSetAccess(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	fake.grants["parent"] = "parent"
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+	_, err := pipeline.GrantAccess(ctx, "shared", "owner", "user:emilia")
+	require.NoError(t, err)
+	_, err = pipeline.GrantAccess(ctx, "shared", "viewer", "user:beatrice")
+	require.NoError(t, err)
+	_, err = pipeline.GrantAccess(ctx, "shared", "parent", "folder:eng")
+	require.NoError(t, err)
+
+	relations := []string{"owner", "viewer"}
+	token, err := pipeline.SetAccess(ctx, "document:shared", relations, []rag.ACLEntry{
+		{Relation: "owner", Subject: "user:emilia"},
+		{Relation: "viewer", Subject: "group:eng#member"},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, token)
+
+	acl, err := pipeline.ListAccess(ctx, "shared")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{
+		{Relation: "owner", Subject: "user:emilia"},
+		{Relation: "parent", Subject: "folder:eng"},
+		{Relation: "viewer", Subject: "group:eng#member"},
+	}, acl, "beatrice's share is revoked; other relations are kept")
+
+	token, err = pipeline.SetAccess(ctx, "document:shared", relations, []rag.ACLEntry{
+		{Relation: "viewer", Subject: "group:eng#member"},
+		{Relation: "owner", Subject: "user:emilia"},
+	})
+	require.NoError(t, err)
+	require.Nil(t, token, "nothing to write")
+
+	_, err = pipeline.SetAccess(ctx, "document:shared", relations, nil)
+	require.NoError(t, err)
+	acl, err = pipeline.ListAccess(ctx, "shared")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{{Relation: "parent", Subject: "folder:eng"}}, acl)
+}
+
+func TestGrantAccessUntil(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+	until := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	token, err := pipeline.GrantAccessUntil(ctx, "doc2", "viewer", "user:dana", until)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+
+	acl, err := pipeline.ListAccess(ctx, "doc2")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{{Relation: "viewer", Subject: "user:dana", ExpiresAt: until}}, acl)
+
+	// SetAccess keeps the share only if it expires at the same time.
+	token, err = pipeline.SetAccess(ctx, "document:doc2", []string{"viewer"}, acl)
+	require.NoError(t, err)
+	require.Nil(t, token)
+	_, err = pipeline.SetAccess(ctx, "document:doc2", []string{"viewer"}, []rag.ACLEntry{{Relation: "viewer", Subject: "user:dana"}})
+	require.NoError(t, err)
+	acl, err = pipeline.ListAccess(ctx, "doc2")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{{Relation: "viewer", Subject: "user:dana"}}, acl, "the share no longer expires")
+
+	_, err = pipeline.GrantAccessUntil(ctx, "doc2", "viewer", "user:dana", time.Time{})
+	require.ErrorContains(t, err, "no expiry")
+}
+
+func TestGrantAccessUntilExpiresCachedDecisions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	for name, opt := range map[string]rag.Option{
+		"check cache": rag.WithCheckCache(time.Hour, 100),
+		"access sets": rag.WithAccessSets(rag.AccessSets{Refresh: time.Hour}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, fake := newFakeClient()
+			pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), opt)
+			until := time.Now().Add(100 * time.Millisecond)
+			_, err := pipeline.GrantAccessUntil(ctx, "doc2", "viewer", "user:dana", until)
+			require.NoError(t, err)
+
+			// Warm the cache.
+			for range 2 {
+				results, err := pipeline.Query(ctx, "dana", "playbook")
+				require.NoError(t, err)
+				requireEqualDocIDs(t, []string{"doc2"}, results)
+			}
+			checks := fake.checkCount()
+
+			time.Sleep(time.Until(until) + 50*time.Millisecond)
+			results, err := pipeline.Query(ctx, "dana", "playbook")
+			require.NoError(t, err)
+			require.Empty(t, results)
+			if name == "check cache" {
+				require.Greater(t, fake.checkCount(), checks, "the expired decision was not cached")
+			}
+		})
+	}
+}
+
+func TestParseSubject(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []string{"user:emilia", "group:eng#member", "user:*"} {
+		require.Equal(t, v, rag.ParseSubject(v).String())
+	}
+	require.Equal(t, rag.Subject{Type: "group", ID: "eng", Relation: "member"}, rag.ParseSubject("group:eng#member"))
+	require.Equal(t, rag.Subject{ID: "emilia"}, rag.ParseSubject("emilia"))
+}
+
+func TestListObjects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+	for _, group := range []string{"sales", "eng"} {
+		_, err := pipeline.SetAccess(ctx, "group:"+group, []string{"member"}, []rag.ACLEntry{
+			{Relation: "member", Subject: "user:emilia"},
+			{Relation: "member", Subject: "user:beatrice"},
+		})
+		require.NoError(t, err)
+	}
+	_, err := pipeline.SetAccess(ctx, "group:admins", []string{"manager"}, []rag.ACLEntry{{Relation: "manager", Subject: "user:emilia"}})
+	require.NoError(t, err)
+
+	ids, err := pipeline.ListObjects(ctx, "group", "member")
+	require.NoError(t, err)
+	require.Equal(t, []string{"eng", "sales"}, ids, "once each, sorted, and only with the relation")
+}
+
+func TestSetAccessInvalidArguments(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+	ctx := context.Background()
+	relations := []string{"owner", "viewer"}
+
+	_, err := pipeline.SetAccess(ctx, "shared", relations, nil)
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+	_, err = pipeline.SetAccess(ctx, "document:shared", relations, []rag.ACLEntry{{Relation: "parent", Subject: "folder:eng"}})
+	require.ErrorContains(t, err, `relation "parent" is not one of`)
+	_, err = pipeline.SetAccess(ctx, "document:shared", relations, []rag.ACLEntry{{Relation: "viewer", Subject: "user:emilia", Caveat: "on_vpn"}})
+	require.ErrorContains(t, err, "caveated")
+	_, err = pipeline.SetAccess(ctx, "document:shared", relations, []rag.ACLEntry{{Relation: "viewer", Subject: "emilia"}})
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+	require.Empty(t, fake.tuples())
+}
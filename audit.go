@@ -0,0 +1,129 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// AuditEvent records a document that was retrieved for a query but
+// withheld because the subject does not hold the permission on it, or an
+// impersonation check made by QueryAs, in which case DocumentID is empty.
+type AuditEvent struct {
+	Time time.Time
+
+	// Subject is the subject the query was authorized for, written as
+	// "type:id" or "type:id#relation".
+	Subject string
+
+	// Resource is the document's SpiceDB object, "type:id".
+	Resource   string
+	Permission string
+
+	// Decision is DecisionDenied, or DecisionConditional when the
+	// permission depended on caveat context the query did not supply.
+	Decision Decision
+
+	// DocumentID is the ID of the withheld document. Its content is not
+	// part of the event.
+	DocumentID string
+
+	// Actor is the subject that ran the query on Subject's behalf with
+	// QueryAs, or empty.
+	Actor string
+
+	// Shadow is set when the document was returned anyway, under
+	// WithShadowMode.
+	Shadow bool
+}
+
+// Auditor receives an AuditEvent for every document a query withholds.
+// Audit is called synchronously while the query runs; if it fails, the
+// query fails too, so no denial goes unrecorded.
+type Auditor interface {
+	Audit(ctx context.Context, e AuditEvent) error
+}
+
+// AuditorFunc adapts a plain function to an Auditor.
+type AuditorFunc func(ctx context.Context, e AuditEvent) error
+
+// Audit calls f(ctx, e).
+func (f AuditorFunc) Audit(ctx context.Context, e AuditEvent) error {
+	return f(ctx, e)
+}
+
+// WithAuditor reports every retrieved document the user was denied to a.
+// Under the prefilter strategy these are the candidates outside the
+// user's accessible set; documents a FilteringRetriever never returned
+// were not retrieved and are not reported.
+func WithAuditor(a Auditor) Option {
+	return func(r *RAGPipeline) {
+		r.auditor = a
+	}
+}
+
+// audit reports d as withheld, if an Auditor is configured and the query
+// is neither a QueryExplain dry run nor simulated.
+func (r *RAGPipeline) audit(ctx context.Context, subject *apiv1.SubjectReference, d Document, resource *apiv1.ObjectReference, decision Decision) error {
+	if r.auditor == nil || explainerFromContext(ctx) != nil || simulating(ctx) {
+		return nil
+	}
+	err := r.auditor.Audit(ctx, AuditEvent{
+		Time:       time.Now(),
+		Subject:    subjectKey(subject),
+		Resource:   objectKey(resource),
+		Permission: r.permissionsOf(ctx, resource.GetObjectType()).String(),
+		Decision:   decision,
+		DocumentID: d.ID,
+		Actor:      actorFromContext(ctx),
+		Shadow:     r.shadows(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("rag: audit: %w", err)
+	}
+	return nil
+}
+
+func subjectKey(s *apiv1.SubjectReference) string {
+	key := objectKey(s.GetObject())
+	if rel := s.GetOptionalRelation(); rel != "" {
+		key += "#" + rel
+	}
+	return key
+}
+
+// JSONAuditLog is an Auditor writing one JSON object per event, e.g. to a
+// file shipped to a SIEM:
+//
+//	{"time":"2025-01-02T15:04:05Z","subject":"user:beatrice","resource":"document:doc1","permission":"read","decision":"denied","document_id":"doc1"}
+type JSONAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditLog returns a JSONAuditLog writing to w. Writes are
+// serialized, so w need not be safe for concurrent use.
+func NewJSONAuditLog(w io.Writer) *JSONAuditLog {
+	return &JSONAuditLog{enc: json.NewEncoder(w)}
+}
+
+// Audit implements Auditor.
+func (l *JSONAuditLog) Audit(_ context.Context, e AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(struct {
+		Time       time.Time `json:"time"`
+		Subject    string    `json:"subject"`
+		Resource   string    `json:"resource"`
+		Permission string    `json:"permission"`
+		Decision   string    `json:"decision"`
+		DocumentID string    `json:"document_id,omitempty"`
+		Actor      string    `json:"actor,omitempty"`
+		Shadow     bool      `json:"shadow,omitempty"`
+	}{e.Time.UTC(), e.Subject, e.Resource, e.Permission, e.Decision.String(), e.DocumentID, e.Actor, e.Shadow})
+}
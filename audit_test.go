@@ -0,0 +1,94 @@
+package rag_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// auditRecorder collects audit events.
+type auditRecorder struct {
+	mu     sync.Mutex
+	events []rag.AuditEvent
+}
+
+func (a *auditRecorder) Audit(_ context.Context, e rag.AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, e)
+	return nil
+}
+
+func TestAuditDeniedDocuments(t *testing.T) {
+	t.Parallel()
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		audit := &auditRecorder{}
+		client, _ := newFakeClient("document:doc2#read@user:beatrice", "document:doc3#read@user:beatrice")
+		opts := []rag.Option{rag.WithAuditor(audit), rag.WithFilterStrategy(strategy)}
+		if strategy == rag.FilterPrefilter {
+			// The built-in scan never retrieves inaccessible documents, so
+			// use a retriever that cannot be restricted up front.
+			opts = append(opts, rag.WithRetriever(rag.NewSubstringRetriever(scenarioDocs())))
+		}
+		pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), opts...)
+
+		results, err := pipeline.Query(context.Background(), "beatrice", "o")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc2", "doc3"}, results)
+
+		require.Len(t, audit.events, 1)
+		e := audit.events[0]
+		require.False(t, e.Time.IsZero())
+		require.Equal(t, rag.AuditEvent{
+			Time:       e.Time,
+			Subject:    "user:beatrice",
+			Resource:   "document:doc1",
+			Permission: "read",
+			Decision:   rag.DecisionDenied,
+			DocumentID: "doc1",
+		}, e)
+	}
+}
+
+func TestAuditFailureFailsQuery(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	failing := rag.AuditorFunc(func(context.Context, rag.AuditEvent) error { return errors.New("disk full") })
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithAuditor(failing))
+
+	_, err := pipeline.Query(context.Background(), "charlie", "roadmap")
+	require.ErrorContains(t, err, "rag: audit: disk full")
+}
+
+func TestJSONAuditLog(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithAuditor(rag.NewJSONAuditLog(&buf)), rag.WithDefaultSubjectType("group", "member"))
+
+	_, err := pipeline.Query(context.Background(), "eng", "roadmap")
+	require.NoError(t, err)
+
+	var record map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.NotEmpty(t, record["time"])
+	delete(record, "time")
+	require.Equal(t, map[string]string{
+		"subject":     "group:eng#member",
+		"resource":    "document:doc1",
+		"permission":  "read",
+		"decision":    "denied",
+		"document_id": "doc1",
+	}, record)
+}
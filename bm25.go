@@ -0,0 +1,238 @@
+package rag
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Default BM25 parameters.
+const (
+	DefaultBM25K1 = 1.2
+	DefaultBM25B  = 0.75
+)
+
+// DefaultStopwords are the English words BM25Retriever leaves out of its
+// index and of queries unless WithStopwords says otherwise.
+var DefaultStopwords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in",
+	"into", "is", "it", "no", "not", "of", "on", "or", "such", "that", "the",
+	"their", "then", "there", "these", "they", "this", "to", "was", "will",
+	"with",
+}
+
+// BM25Option configures a BM25Retriever.
+type BM25Option func(*BM25Retriever)
+
+// WithBM25Params overrides DefaultBM25K1 and DefaultBM25B: k1 controls term
+// frequency saturation, b how strongly scores are normalized by document
+// length.
+func WithBM25Params(k1, b float64) BM25Option {
+	return func(x *BM25Retriever) {
+		x.k1, x.b = k1, b
+	}
+}
+
+// WithStopwords replaces DefaultStopwords. Calling it with no words
+// disables stopword removal.
+func WithStopwords(words ...string) BM25Option {
+	return func(x *BM25Retriever) {
+		x.stopwords = make(map[string]bool, len(words))
+		for _, w := range words {
+			for _, t := range terms(w) {
+				x.stopwords[t] = true
+			}
+		}
+	}
+}
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// BM25Retriever is a Retriever ranking documents by Okapi BM25 over an
+// inverted index built as documents are added. Text is tokenized into
+// lower-cased runs of letters and digits.
+//
+// Used as the pipeline's Retriever it honours the maxDocsScanned part of
+// WithScanBudget: the postings of the rarest query terms are scored first,
+// and terms whose postings would exceed the budget are skipped.
+type BM25Retriever struct {
+	k1, b     float64
+	stopwords map[string]bool
+
+	mu       sync.RWMutex
+	docs     []Document
+	lengths  []int
+	totalLen int
+	postings map[string][]posting
+}
+
+// NewBM25Retriever indexes docs and returns a retriever over them.
+func NewBM25Retriever(docs []Document, opts ...BM25Option) *BM25Retriever {
+	x := &BM25Retriever{
+		k1:       DefaultBM25K1,
+		b:        DefaultBM25B,
+		postings: make(map[string][]posting),
+	}
+	WithStopwords(DefaultStopwords...)(x)
+	for _, opt := range opts {
+		opt(x)
+	}
+	x.Add(docs...)
+	return x
+}
+
+// Add indexes docs and makes them retrievable.
+func (x *BM25Retriever) Add(docs ...Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, d := range docs {
+		i := len(x.docs)
+		tf := make(map[string]int)
+		n := 0
+		for _, t := range x.tokens(d.Text) {
+			tf[t]++
+			n++
+		}
+		// Append postings in term order so the index does not depend on
+		// map iteration.
+		ts := make([]string, 0, len(tf))
+		for t := range tf {
+			ts = append(ts, t)
+		}
+		sort.Strings(ts)
+		for _, t := range ts {
+			x.postings[t] = append(x.postings[t], posting{doc: i, tf: tf[t]})
+		}
+		x.docs = append(x.docs, d)
+		x.lengths = append(x.lengths, n)
+		x.totalLen += n
+	}
+}
+
+// Retrieve implements Retriever.
+func (x *BM25Retriever) Retrieve(ctx context.Context, query string, limit int) ([]Document, error) {
+	scored, err := x.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return documentsOf(scored), nil
+}
+
+// RetrieveScored implements ScoredRetriever. Documents sharing no term
+// with query are not returned; ties keep the order documents were added
+// in.
+func (x *BM25Retriever) RetrieveScored(ctx context.Context, query string, limit int) ([]ScoredDocument, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.docs) == 0 {
+		return nil, nil
+	}
+
+	// Score each distinct query term once, rarest first.
+	seen := make(map[string]bool)
+	var qterms []string
+	for _, t := range x.tokens(query) {
+		if !seen[t] && len(x.postings[t]) > 0 {
+			seen[t] = true
+			qterms = append(qterms, t)
+		}
+	}
+	sort.SliceStable(qterms, func(a, b int) bool {
+		return len(x.postings[qterms[a]]) < len(x.postings[qterms[b]])
+	})
+
+	budget := scanBudgetFromContext(ctx)
+	n := float64(len(x.docs))
+	avgLen := float64(x.totalLen) / n
+	scores := make(map[int]float64)
+	for _, t := range qterms {
+		ps := x.postings[t]
+		if !budget.take(len(ps)) {
+			break
+		}
+		df := float64(len(ps))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range ps {
+			tf := float64(p.tf)
+			norm := x.k1 * (1 - x.b + x.b*float64(x.lengths[p.doc])/avgLen)
+			scores[p.doc] += idf * tf * (x.k1 + 1) / (tf + norm)
+		}
+	}
+
+	hits := make([]int, 0, len(scores))
+	for i := range scores {
+		hits = append(hits, i)
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if scores[hits[a]] != scores[hits[b]] {
+			return scores[hits[a]] > scores[hits[b]]
+		}
+		return hits[a] < hits[b]
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	docs := make([]ScoredDocument, len(hits))
+	for i, h := range hits {
+		docs[i] = ScoredDocument{Document: x.docs[h], Score: scores[h]}
+	}
+	return docs, nil
+}
+
+func (x *BM25Retriever) tokens(text string) []string {
+	ts := terms(text)
+	out := ts[:0]
+	for _, t := range ts {
+		if !x.stopwords[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// scanBudget carries the pipeline's maxDocsScanned to retrievers in this
+// package that can honour it, and their usage back. It may be shared by
+// retrievers running concurrently, see HybridRetriever.
+type scanBudget struct {
+	mu       sync.Mutex
+	max      int
+	scanned  int
+	exceeded bool
+}
+
+// take reports whether n more documents may be scanned, recording them if
+// so. A nil budget is unlimited.
+func (b *scanBudget) take(n int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.max > 0 && b.scanned+n > b.max {
+		b.exceeded = true
+		return false
+	}
+	b.scanned += n
+	return true
+}
+
+type scanBudgetKey struct{}
+
+func contextWithScanBudget(ctx context.Context, b *scanBudget) context.Context {
+	return context.WithValue(ctx, scanBudgetKey{}, b)
+}
+
+func scanBudgetFromContext(ctx context.Context) *scanBudget {
+	b, _ := ctx.Value(scanBudgetKey{}).(*scanBudget)
+	return b
+}
@@ -0,0 +1,79 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func bm25Docs() []rag.Document {
+	texts := map[string]string{
+		"doc0": "The quarterly report covers revenue and revenue growth.",
+		"doc1": "Revenue was flat; see the appendix of the report.",
+		"doc2": "Office plants need watering on Fridays.",
+		"doc3": "The report on the report: a meta report about reports.",
+	}
+	docs := make([]rag.Document, 0, len(texts))
+	for _, id := range []string{"doc0", "doc1", "doc2", "doc3"} {
+		docs = append(docs, rag.Document{ID: id, Text: texts[id], Metadata: map[string]string{rag.SpiceDBObjectKey: "document:" + id}})
+	}
+	return docs
+}
+
+func TestBM25Ranking(t *testing.T) {
+	t.Parallel()
+
+	x := rag.NewBM25Retriever(bm25Docs())
+
+	scored, err := x.RetrieveScored(context.Background(), "revenue report", 0)
+	require.NoError(t, err)
+	require.Len(t, scored, 3)
+	require.Equal(t, "doc0", scored[0].Document.ID)
+	for i := 1; i < len(scored); i++ {
+		require.Greater(t, scored[i-1].Score, scored[i].Score)
+	}
+
+	docs, err := x.Retrieve(context.Background(), "WATERING", 0)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, docs)
+
+	docs, err = x.Retrieve(context.Background(), "report", 1)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc3"}, docs)
+}
+
+func TestBM25Stopwords(t *testing.T) {
+	t.Parallel()
+
+	docs, err := rag.NewBM25Retriever(bm25Docs()).Retrieve(context.Background(), "the of", 0)
+	require.NoError(t, err)
+	require.Empty(t, docs)
+
+	docs, err = rag.NewBM25Retriever(bm25Docs(), rag.WithStopwords()).Retrieve(context.Background(), "of", 0)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, docs)
+
+	docs, err = rag.NewBM25Retriever(bm25Docs(), rag.WithStopwords("Revenue")).Retrieve(context.Background(), "revenue", 0)
+	require.NoError(t, err)
+	require.Empty(t, docs)
+}
+
+func TestBM25HonoursScanBudget(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc0#read@user:emilia", "document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+		rag.WithRetriever(rag.NewBM25Retriever(bm25Docs())),
+		rag.WithScanBudget(2, 0))
+
+	// "growth" (1 posting) fits the budget; "report" (3 postings) does not.
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "report growth", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0"}, results)
+	require.True(t, stats.BudgetExceeded)
+	require.Equal(t, 1, stats.DocsScanned)
+}
@@ -0,0 +1,51 @@
+package rag
+
+import "errors"
+
+// ErrQueryTooBroad is returned by Query when the scan budget was exhausted
+// and the pipeline is configured with BudgetReject.
+var ErrQueryTooBroad = errors.New("rag: query too broad")
+
+// BudgetPolicy decides what Query does once the scan budget is exhausted.
+type BudgetPolicy int
+
+const (
+	// BudgetPartial authorizes and returns whatever was retrieved before the
+	// budget ran out. Stats.BudgetExceeded is set so callers can tell.
+	BudgetPartial BudgetPolicy = iota
+
+	// BudgetReject fails the query with ErrQueryTooBroad instead of
+	// returning partial results.
+	BudgetReject
+)
+
+// WithScanBudget bounds the work a single query can do during retrieval.
+// The scan stops once maxDocsScanned documents have been examined or
+// maxMatches candidates have been collected, whichever comes first.
+// A value of zero leaves that dimension unlimited.
+//
+// A one-character query otherwise matches (and then authorizes) nearly the
+// whole corpus.
+func WithScanBudget(maxDocsScanned, maxMatches int) Option {
+	return func(r *RAGPipeline) {
+		r.maxDocsScanned = maxDocsScanned
+		r.maxMatches = maxMatches
+	}
+}
+
+// WithBudgetPolicy selects what happens when the scan budget is exhausted.
+// The default is BudgetPartial.
+func WithBudgetPolicy(p BudgetPolicy) Option {
+	return func(r *RAGPipeline) {
+		r.budgetPolicy = p
+	}
+}
+
+// budgetExhausted reports whether the scan must stop before examining
+// another document.
+func (r *RAGPipeline) budgetExhausted(scanned, matches int) bool {
+	if r.maxDocsScanned > 0 && scanned >= r.maxDocsScanned {
+		return true
+	}
+	return r.maxMatches > 0 && matches >= r.maxMatches
+}
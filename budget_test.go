@@ -0,0 +1,117 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// syntheticCorpus builds n documents that all contain the letter "e", so a
+// one-character query matches every one of them.
+func syntheticCorpus(n int) []rag.Document {
+	docs := make([]rag.Document, n)
+	for i := range docs {
+		id := fmt.Sprintf("doc%d", i)
+		docs[i] = rag.Document{
+			ID:       id,
+			Text:     "synthetic entry " + id,
+			Metadata: map[string]string{"spicedb_object": "document:" + id},
+		}
+	}
+	return docs
+}
+
+func TestScanBudgetBoundsWork(t *testing.T) {
+	t.Parallel()
+
+	const corpusSize = 100_000
+	docs := syntheticCorpus(corpusSize)
+
+	tests := []struct {
+		name           string
+		maxScanned     int
+		maxMatches     int
+		wantScanned    int
+		wantCandidates int
+		wantExceeded   bool
+	}{
+		{"unlimited", 0, 0, corpusSize, corpusSize, false},
+		{"docs scanned", 500, 0, 500, 500, true},
+		{"matches", 0, 50, 50, 50, true},
+		{"tighter of both", 1000, 10, 10, 10, true},
+		{"budget larger than corpus", corpusSize * 2, corpusSize, corpusSize, corpusSize, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, fake := newFakeClient()
+			pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+				rag.WithScanBudget(tc.maxScanned, tc.maxMatches))
+
+			var stats rag.Stats
+			results, err := pipeline.Query(context.Background(), "emilia", "e", rag.WithStats(&stats))
+			require.NoError(t, err)
+			require.Empty(t, results)
+
+			require.Equal(t, tc.wantScanned, stats.DocsScanned)
+			require.Equal(t, tc.wantCandidates, stats.Candidates)
+			require.Equal(t, tc.wantExceeded, stats.BudgetExceeded)
+			require.Equal(t, tc.wantCandidates, fake.checkCount(), "every candidate is checked, nothing more")
+		})
+	}
+}
+
+func TestScanBudgetPolicy(t *testing.T) {
+	t.Parallel()
+
+	docs := syntheticCorpus(100_000)
+
+	t.Run("partial results", func(t *testing.T) {
+		t.Parallel()
+
+		client, _ := newFakeClient("document:doc3#read@user:emilia")
+		pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+			rag.WithScanBudget(0, 10), rag.WithBudgetPolicy(rag.BudgetPartial))
+
+		var stats rag.Stats
+		results, err := pipeline.Query(context.Background(), "emilia", "e", rag.WithStats(&stats))
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc3"}, results)
+		require.True(t, stats.BudgetExceeded)
+		require.Equal(t, 1, stats.Allowed)
+		require.Equal(t, 9, stats.Denied)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		t.Parallel()
+
+		client, fake := newFakeClient("document:doc3#read@user:emilia")
+		pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+			rag.WithScanBudget(0, 10), rag.WithBudgetPolicy(rag.BudgetReject))
+
+		var stats rag.Stats
+		results, err := pipeline.Query(context.Background(), "emilia", "e", rag.WithStats(&stats))
+		require.ErrorIs(t, err, rag.ErrQueryTooBroad)
+		require.Nil(t, results)
+		require.True(t, stats.BudgetExceeded)
+		require.Zero(t, fake.checkCount(), "no document may be authorized once the query is rejected")
+	})
+
+	t.Run("reject leaves narrow queries alone", func(t *testing.T) {
+		t.Parallel()
+
+		client, _ := newFakeClient("document:doc42#read@user:emilia")
+		pipeline := rag.NewRAGPipeline(client, "document", "read", docs[:100],
+			rag.WithScanBudget(0, 10), rag.WithBudgetPolicy(rag.BudgetReject))
+
+		results, err := pipeline.Query(context.Background(), "emilia", "doc42")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc42"}, results)
+	})
+}
@@ -0,0 +1,133 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBulkCheckChunkSize is the number of items sent per
+// CheckBulkPermissions request. It stays well under SpiceDB's default
+// per-request limit.
+const DefaultBulkCheckChunkSize = 100
+
+// DefaultCheckConcurrency is the number of Check calls run at once for
+// checkers that cannot check in bulk.
+const DefaultCheckConcurrency = 10
+
+// CheckResult is the outcome of one item of a bulk check. Err is set when
+// that item, rather than the whole request, failed.
+type CheckResult struct {
+	Decision Decision
+	Err      error
+
+	// MissingContext names the caveat context fields a conditional
+	// decision lacks, if the checker knows them.
+	MissingContext []string
+}
+
+// BulkPermissionChecker is implemented by checkers that can decide many
+// resources in one round trip. The pipeline uses it instead of one Check
+// per candidate when available. Results are in the order of resources.
+type BulkPermissionChecker interface {
+	PermissionChecker
+	CheckBulk(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string) ([]CheckResult, error)
+}
+
+// WithBulkCheckChunkSize sets how many resources the SpiceDB checker sends
+// per CheckBulkPermissions request. n <= 0 keeps
+// DefaultBulkCheckChunkSize.
+func WithBulkCheckChunkSize(n int) Option {
+	return func(r *RAGPipeline) {
+		r.bulkChunkSize = n
+	}
+}
+
+// WithCheckConcurrency bounds how many Check calls run at once when the
+// PermissionChecker is not a BulkPermissionChecker. n <= 0 keeps
+// DefaultCheckConcurrency.
+func WithCheckConcurrency(n int) Option {
+	return func(r *RAGPipeline) {
+		r.checkConcurrency = n
+	}
+}
+
+// CheckBulk implements BulkPermissionChecker using CheckBulkPermissions,
+// splitting resources into chunks of the configured size. Each request is
+// traced as a "rag.check_bulk" span, recorded by the tracer provider of
+// the span in ctx, if any.
+func (c *SpiceDBChecker) CheckBulk(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string) ([]CheckResult, error) {
+	chunk := c.chunkSize
+	if chunk <= 0 {
+		chunk = DefaultBulkCheckChunkSize
+	}
+
+	results := make([]CheckResult, 0, len(resources))
+	for start := 0; start < len(resources); start += chunk {
+		batch := resources[start:min(start+chunk, len(resources))]
+		decided, err := c.checkBatch(ctx, subject, batch, permission)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, decided...)
+	}
+	return results, nil
+}
+
+// checkBatch sends one CheckBulkPermissions request for batch.
+func (c *SpiceDBChecker) checkBatch(ctx context.Context, subject *apiv1.SubjectReference, batch []*apiv1.ObjectReference, permission string) (results []CheckResult, err error) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "rag.check_bulk", trace.WithAttributes(attribute.Int("rag.batch_size", len(batch))))
+	defer func() {
+		allowed := 0
+		for _, res := range results {
+			if res.Decision == DecisionAllowed {
+				allowed++
+			}
+		}
+		span.SetAttributes(attribute.Int("rag.allowed", allowed))
+		endSpan(span, err)
+	}()
+
+	items := make([]*apiv1.CheckBulkPermissionsRequestItem, len(batch))
+	for i, res := range batch {
+		items[i] = &apiv1.CheckBulkPermissionsRequestItem{
+			Resource:   res,
+			Permission: permission,
+			Subject:    subject,
+			Context:    caveatFromContext(ctx),
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.client.CheckBulkPermissions(ctx, &apiv1.CheckBulkPermissionsRequest{
+		Consistency: consistencyFromContext(ctx),
+		Items:       items,
+	})
+	span.SetAttributes(attribute.Float64("rag.spicedb.latency_ms", float64(time.Since(start).Microseconds())/1000))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.GetPairs()) != len(batch) {
+		return nil, fmt.Errorf("rag: bulk check returned %d results for %d items", len(resp.GetPairs()), len(batch))
+	}
+
+	results = make([]CheckResult, 0, len(batch))
+	for _, pair := range resp.GetPairs() {
+		if st := pair.GetError(); st != nil {
+			results = append(results, CheckResult{Err: status.ErrorProto(st)})
+			continue
+		}
+		item := pair.GetItem()
+		results = append(results, CheckResult{
+			Decision:       decisionOf(item.GetPermissionship()),
+			MissingContext: item.GetPartialCaveatInfo().GetMissingRequiredContext(),
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,131 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestBulkCheckChunking(t *testing.T) {
+	t.Parallel()
+
+	docs := syntheticCorpus(250)
+	client, fake := newFakeClient("document:doc7#read@user:emilia", "document:doc201#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithBulkCheckChunkSize(100))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc7", "doc201"}, results)
+	require.Equal(t, []int{100, 100, 50}, fake.bulkRequestSizes())
+	require.Equal(t, 250, stats.Checked)
+	require.Equal(t, 248, stats.Denied)
+}
+
+func TestBulkCheckDefaultChunkSize(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(rag.DefaultBulkCheckChunkSize+1))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.Equal(t, []int{rag.DefaultBulkCheckChunkSize, 1}, fake.bulkRequestSizes())
+}
+
+func TestBulkCheckSkipsEmptyCandidateSet(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	results, err := pipeline.Query(context.Background(), "emilia", "no such text")
+	require.NoError(t, err)
+	require.Nil(t, results)
+	require.Empty(t, fake.bulkRequestSizes())
+}
+
+// slowChecker allows every resource after a short delay and records the
+// highest number of Check calls in flight at once.
+type slowChecker struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	calls       int
+	failOn      string
+}
+
+func (c *slowChecker) Check(ctx context.Context, _ *apiv1.SubjectReference, resource *apiv1.ObjectReference, _ string) (rag.Decision, error) {
+	c.mu.Lock()
+	c.calls++
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	if resource.GetObjectId() == c.failOn {
+		return rag.DecisionDenied, errors.New("check failed")
+	}
+	select {
+	case <-time.After(5 * time.Millisecond):
+		return rag.DecisionAllowed, nil
+	case <-ctx.Done():
+		return rag.DecisionDenied, ctx.Err()
+	}
+}
+
+func TestConcurrentChecksAreBounded(t *testing.T) {
+	t.Parallel()
+
+	checker := &slowChecker{}
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(60),
+		rag.WithPermissionChecker(checker), rag.WithCheckConcurrency(4))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.Len(t, results, 60)
+	require.Equal(t, "doc0", results[0].ID)
+	require.Equal(t, "doc59", results[59].ID)
+	require.Equal(t, 60, stats.Checked)
+	require.Equal(t, 4, checker.maxInFlight)
+}
+
+func TestConcurrentCheckDefaultLimit(t *testing.T) {
+	t.Parallel()
+
+	checker := &slowChecker{}
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(50),
+		rag.WithPermissionChecker(checker))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.LessOrEqual(t, checker.maxInFlight, rag.DefaultCheckConcurrency)
+	require.Greater(t, checker.maxInFlight, 1)
+}
+
+func TestConcurrentCheckFailureStopsQuery(t *testing.T) {
+	t.Parallel()
+
+	checker := &slowChecker{failOn: "doc0"}
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(200),
+		rag.WithPermissionChecker(checker), rag.WithCheckConcurrency(2))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorContains(t, err, "check failed")
+	require.Less(t, checker.calls, 200)
+}
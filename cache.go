@@ -0,0 +1,353 @@
+package rag
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// CachingChecker is a PermissionChecker that remembers the decisions of
+// another checker for a limited time. Only definite decisions are cached;
+// errors and conditional results always go to the inner checker. With
+// CacheDenials, denials are kept apart from grants, under their own TTL
+// and size bound.
+//
+// Checks that ask for a specific consistency (see WithConsistency) or
+// carry caveat context bypass the cache, since a cached answer could be
+// older than requested or computed for different context.
+type CachingChecker struct {
+	inner PermissionChecker
+	now   func() time.Time
+
+	mu         sync.Mutex
+	generation uint64 // bumped by every invalidation
+	decisions  decisionCache
+	denials    *decisionCache // nil unless CacheDenials is used
+	hits       int
+	misses     int
+	deniedHits int
+}
+
+// decisionCache is an LRU cache of decisions expiring after ttl.
+type decisionCache struct {
+	ttl        time.Duration
+	maxEntries int
+	lru        *list.List // of *cacheEntry, most recently used first
+	items      map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key      string
+	decision Decision
+	expires  time.Time
+}
+
+// CacheStats reports a CachingChecker's effectiveness.
+type CacheStats struct {
+	Hits, Misses, Entries int
+
+	// DeniedHits and DeniedEntries are the part of Hits and Entries due
+	// to the cache of denials set up by CacheDenials.
+	DeniedHits, DeniedEntries int
+}
+
+// CacheOption configures a CachingChecker.
+type CacheOption func(*CachingChecker)
+
+// CacheDenials keeps denied decisions in a cache of their own, for ttl
+// and at most maxEntries of them, rather than alongside grants. Denials
+// tend to be repeated, by users retrying a query they cannot access, and
+// going stale the other way round: a denial outlives the grant that ends
+// it, so it usually wants a shorter TTL. With a zero ttl denials are not
+// cached at all.
+func CacheDenials(ttl time.Duration, maxEntries int) CacheOption {
+	return func(c *CachingChecker) {
+		c.denials = newDecisionCache(ttl, maxEntries)
+	}
+}
+
+// NewCachingChecker caches inner's decisions for ttl, keeping at most
+// maxEntries of them and evicting the least recently used first.
+func NewCachingChecker(inner PermissionChecker, ttl time.Duration, maxEntries int, opts ...CacheOption) *CachingChecker {
+	c := &CachingChecker{
+		inner:     inner,
+		now:       time.Now,
+		decisions: *newDecisionCache(ttl, maxEntries),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func newDecisionCache(ttl time.Duration, maxEntries int) *decisionCache {
+	return &decisionCache{ttl: ttl, maxEntries: maxEntries, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+// WithCheckCache wraps the pipeline's PermissionChecker in a
+// CachingChecker. It applies to whichever checker the pipeline ends up
+// with, regardless of option order. Expiring relationships are dropped
+// without notice, so a decision cached before one expires is used until
+// ttl runs out, unless GrantAccessUntil wrote the relationship.
+func WithCheckCache(ttl time.Duration, maxEntries int) Option {
+	return func(r *RAGPipeline) {
+		r.cacheTTL = ttl
+		r.cacheEntries = maxEntries
+	}
+}
+
+// WithDeniedCheckCache caches denied decisions apart from the others, as
+// CacheDenials does. Without WithCheckCache only denials are cached.
+func WithDeniedCheckCache(ttl time.Duration, maxEntries int) Option {
+	return func(r *RAGPipeline) {
+		r.deniedCacheTTL = ttl
+		r.deniedCacheEntries = maxEntries
+	}
+}
+
+// Stats returns the cache's hit and miss counts and current size.
+func (c *CachingChecker) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.decisions.lru.Len(), DeniedHits: c.deniedHits}
+	if c.denials != nil {
+		s.DeniedEntries = c.denials.lru.Len()
+		s.Entries += s.DeniedEntries
+	}
+	return s
+}
+
+// Purge drops every cached decision.
+func (c *CachingChecker) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, dc := range c.caches() {
+		dc.lru.Init()
+		clear(dc.items)
+	}
+}
+
+// caches returns the caches in use. c.mu must be held.
+func (c *CachingChecker) caches() []*decisionCache {
+	if c.denials == nil {
+		return []*decisionCache{&c.decisions}
+	}
+	return []*decisionCache{&c.decisions, c.denials}
+}
+
+// Check implements PermissionChecker.
+func (c *CachingChecker) Check(ctx context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (Decision, error) {
+	if !cacheable(ctx) {
+		return c.inner.Check(ctx, subject, resource, permission)
+	}
+
+	key := checkKey(subject, resource, permission)
+	if d, ok := c.get(key); ok {
+		return d, nil
+	}
+	gen := c.currentGeneration()
+	d, err := c.inner.Check(ctx, subject, resource, permission)
+	if err == nil {
+		c.put(key, d, gen)
+	}
+	return d, err
+}
+
+// CheckBulk implements BulkPermissionChecker. Only the cache misses are
+// sent to the inner checker, in bulk if it supports it and otherwise with
+// DefaultCheckConcurrency concurrent Check calls. A failed Check is
+// reported as the Err of its result, as a bulk checker would, and is not
+// cached.
+func (c *CachingChecker) CheckBulk(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string) ([]CheckResult, error) {
+	results := make([]CheckResult, len(resources))
+	var missing []int
+	useCache := cacheable(ctx)
+	for i, res := range resources {
+		if useCache {
+			if d, ok := c.get(checkKey(subject, res, permission)); ok {
+				results[i] = CheckResult{Decision: d}
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	gen := c.currentGeneration()
+	misses := make([]*apiv1.ObjectReference, len(missing))
+	for j, i := range missing {
+		misses[j] = resources[i]
+	}
+
+	var fresh []CheckResult
+	if bulk, ok := c.inner.(BulkPermissionChecker); ok {
+		var err error
+		if fresh, err = bulk.CheckBulk(ctx, subject, misses, permission); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if fresh, _, err = checkEach(ctx, c.inner, subject, misses, permission, 0, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for j, i := range missing {
+		results[i] = fresh[j]
+		if useCache && fresh[j].Err == nil {
+			c.put(checkKey(subject, resources[i], permission), fresh[j].Decision, gen)
+		}
+	}
+	return results, nil
+}
+
+// LookupResources implements ResourceLister by delegating to the inner
+// checker. Lookups are not cached.
+func (c *CachingChecker) LookupResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) ([]string, error) {
+	lister, ok := c.inner.(ResourceLister)
+	if !ok {
+		return nil, ErrPrefilterUnsupported
+	}
+	return lister.LookupResources(ctx, subject, resourceType, permission)
+}
+
+// LookupConditionalResources implements ConditionalLister by delegating
+// to the inner checker. Lookups are not cached.
+func (c *CachingChecker) LookupConditionalResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) (allowed, conditional []string, err error) {
+	lister, ok := c.inner.(ResourceLister)
+	if !ok {
+		return nil, nil, ErrPrefilterUnsupported
+	}
+	return lookupResources(ctx, lister, subject, resourceType, permission)
+}
+
+// Simulate implements Simulator by delegating to the inner checker. The
+// simulated checker is not cached.
+func (c *CachingChecker) Simulate(ctx context.Context, relationships []*apiv1.Relationship) (PermissionChecker, error) {
+	sim, ok := c.inner.(Simulator)
+	if !ok {
+		return nil, ErrSimulationUnsupported
+	}
+	return sim.Simulate(ctx, relationships)
+}
+
+func (c *CachingChecker) get(key string) (Decision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if d, ok := c.decisions.get(key, now); ok {
+		c.hits++
+		return d, true
+	}
+	if c.denials != nil {
+		if d, ok := c.denials.get(key, now); ok {
+			c.hits++
+			c.deniedHits++
+			return d, true
+		}
+	}
+	c.misses++
+	return DecisionDenied, false
+}
+
+// currentGeneration returns the generation to pass to put for a
+// decision about to be asked of the inner checker.
+func (c *CachingChecker) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches d under key, unless the cache was invalidated since gen was
+// read: d may then predate the change that invalidated it.
+func (c *CachingChecker) put(key string, d Decision, gen uint64) {
+	if d == DecisionConditional {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.generation {
+		return
+	}
+
+	now := c.now()
+	if c.denials == nil {
+		c.decisions.put(key, d, now)
+		return
+	}
+	// A key lives in one cache at a time, so a denial cannot outlast
+	// the grant replacing it or the other way round.
+	if d == DecisionDenied {
+		c.decisions.remove(key)
+		c.denials.put(key, d, now)
+		return
+	}
+	c.denials.remove(key)
+	c.decisions.put(key, d, now)
+}
+
+func (dc *decisionCache) get(key string, now time.Time) (Decision, bool) {
+	el, ok := dc.items[key]
+	if !ok {
+		return DecisionDenied, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !now.Before(e.expires) {
+		dc.lru.Remove(el)
+		delete(dc.items, key)
+		return DecisionDenied, false
+	}
+	dc.lru.MoveToFront(el)
+	return e.decision, true
+}
+
+func (dc *decisionCache) put(key string, d Decision, now time.Time) {
+	if dc.ttl <= 0 || dc.maxEntries <= 0 {
+		return
+	}
+	expires := now.Add(dc.ttl)
+	if el, ok := dc.items[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.decision, e.expires = d, expires
+		dc.lru.MoveToFront(el)
+		return
+	}
+	dc.items[key] = dc.lru.PushFront(&cacheEntry{key: key, decision: d, expires: expires})
+	for dc.lru.Len() > dc.maxEntries {
+		oldest := dc.lru.Back()
+		dc.lru.Remove(oldest)
+		delete(dc.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (dc *decisionCache) remove(key string) {
+	if el, ok := dc.items[key]; ok {
+		dc.lru.Remove(el)
+		delete(dc.items, key)
+	}
+}
+
+// cacheable reports whether a check in ctx may be answered from cache.
+func cacheable(ctx context.Context) bool {
+	if caveatFromContext(ctx) != nil || simulating(ctx) {
+		return false
+	}
+	c := consistencyFromContext(ctx)
+	return c == nil || c.GetMinimizeLatency()
+}
+
+func checkKey(subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) string {
+	subj := objectKey(subject.GetObject())
+	if rel := subject.GetOptionalRelation(); rel != "" {
+		subj += "#" + rel
+	}
+	return objectKey(resource) + "#" + permission + "@" + subj
+}
@@ -0,0 +1,80 @@
+package rag
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type countingChecker struct{ calls int }
+
+func (c *countingChecker) Check(context.Context, *apiv1.SubjectReference, *apiv1.ObjectReference, string) (Decision, error) {
+	c.calls++
+	return DecisionAllowed, nil
+}
+
+func TestCachingCheckerTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	inner := &countingChecker{}
+	c := NewCachingChecker(inner, time.Minute, 10)
+	c.now = func() time.Time { return now }
+
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	resource := &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"}
+	check := func() {
+		d, err := c.Check(context.Background(), subject, resource, "read")
+		require.NoError(t, err)
+		require.Equal(t, DecisionAllowed, d)
+	}
+
+	check()
+	now = now.Add(59 * time.Second)
+	check()
+	require.Equal(t, 1, inner.calls)
+
+	now = now.Add(time.Second)
+	check()
+	require.Equal(t, 2, inner.calls)
+	require.Equal(t, CacheStats{Hits: 1, Misses: 2, Entries: 1}, c.Stats())
+}
+
+// denyingChecker allows doc1 only, counting its calls.
+type denyingChecker struct{ calls int }
+
+func (c *denyingChecker) Check(_ context.Context, _ *apiv1.SubjectReference, res *apiv1.ObjectReference, _ string) (Decision, error) {
+	c.calls++
+	if res.GetObjectId() == "doc1" {
+		return DecisionAllowed, nil
+	}
+	return DecisionDenied, nil
+}
+
+func TestCachingCheckerDenialTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	inner := &denyingChecker{}
+	c := NewCachingChecker(inner, time.Minute, 10, CacheDenials(10*time.Second, 10))
+	c.now = func() time.Time { return now }
+
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	check := func(id string) {
+		_, err := c.Check(context.Background(), subject, &apiv1.ObjectReference{ObjectType: "document", ObjectId: id}, "read")
+		require.NoError(t, err)
+	}
+
+	check("doc1")
+	check("doc2")
+	now = now.Add(9 * time.Second)
+	check("doc1")
+	check("doc2")
+	require.Equal(t, 2, inner.calls)
+	require.Equal(t, CacheStats{Hits: 2, Misses: 2, Entries: 2, DeniedHits: 1, DeniedEntries: 1}, c.Stats())
+
+	// The denial expires first.
+	now = now.Add(time.Second)
+	check("doc1")
+	check("doc2")
+	require.Equal(t, 3, inner.calls)
+}
@@ -0,0 +1,190 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestCheckCacheAvoidsRepeatChecks(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10),
+		rag.WithCheckCache(time.Minute, 100))
+
+	for range 3 {
+		results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc1"}, results)
+	}
+	require.Equal(t, 10, fake.checkCount())
+	require.Equal(t, []int{10}, fake.bulkRequestSizes())
+
+	// Another subject is a different cache key.
+	_, err := pipeline.Query(context.Background(), "beatrice", "synthetic")
+	require.NoError(t, err)
+	require.Equal(t, 20, fake.checkCount())
+}
+
+func TestDeniedCheckCache(t *testing.T) {
+	t.Parallel()
+
+	metrics := rag.NewCollector("")
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10),
+		rag.WithDeniedCheckCache(time.Minute, 100), rag.WithMetrics(metrics))
+
+	for range 3 {
+		results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc1"}, results)
+	}
+	// Only the grant is checked again.
+	require.Equal(t, []int{10, 1, 1}, fake.bulkRequestSizes())
+	require.Contains(t, scrape(t, metrics), "rag_check_cache_denied_hits_total 18\n")
+}
+
+func TestCheckCacheOnlySendsMisses(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(20),
+		rag.WithCheckCache(time.Minute, 100))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "doc1")
+	require.NoError(t, err) // doc1, doc10..doc19
+	_, err = pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.Equal(t, []int{11, 9}, fake.bulkRequestSizes())
+}
+
+func TestCheckCacheSizeBound(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	checker := rag.NewCachingChecker(rag.NewSpiceDBChecker(client), time.Minute, 5)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(20),
+		rag.WithPermissionChecker(checker))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.Equal(t, rag.CacheStats{Misses: 20, Entries: 5}, checker.Stats())
+
+	// doc15..doc19 are the most recently cached.
+	_, err = pipeline.Query(context.Background(), "emilia", "doc19")
+	require.NoError(t, err)
+	_, err = pipeline.Query(context.Background(), "emilia", "doc0")
+	require.NoError(t, err)
+	require.Equal(t, rag.CacheStats{Hits: 1, Misses: 21, Entries: 5}, checker.Stats())
+
+	checker.Purge()
+	require.Zero(t, checker.Stats().Entries)
+}
+
+func TestCheckCacheBypass(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(5),
+		rag.WithCheckCache(time.Minute, 100))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+
+	_, err = pipeline.Query(context.Background(), "emilia", "synthetic",
+		rag.WithConsistency(rag.AtLeastAsFresh(&apiv1.ZedToken{Token: "t"})))
+	require.NoError(t, err)
+	_, err = pipeline.Query(context.Background(), "emilia", "synthetic",
+		rag.WithCaveatContext(map[string]any{"on_vpn": true}))
+	require.NoError(t, err)
+	require.Equal(t, 15, fake.checkCount())
+
+	_, err = pipeline.Query(context.Background(), "emilia", "synthetic",
+		rag.WithConsistency(rag.MinimizeLatency()))
+	require.NoError(t, err)
+	require.Equal(t, 15, fake.checkCount())
+}
+
+func TestCheckCacheDoesNotStoreConditional(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	fake.conditional = map[string]string{"document:doc0#read@user:emilia": "on_vpn"}
+	checker := rag.NewCachingChecker(rag.NewSpiceDBChecker(client), time.Minute, 100)
+
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	resource := &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc0"}
+	for range 2 {
+		d, err := checker.Check(context.Background(), subject, resource, "read")
+		require.NoError(t, err)
+		require.Equal(t, rag.DecisionConditional, d)
+	}
+	require.Equal(t, 2, fake.checkCount())
+}
+
+func TestCheckCacheWithPrefilter(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithCheckCache(time.Minute, 100), rag.WithFilterStrategy(rag.FilterPrefilter))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+}
+
+// invalidatingChecker allows everything, but runs invalidate while each
+// check is in flight, like a Watch event arriving before the decision is
+// cached.
+type invalidatingChecker struct {
+	invalidate func()
+	calls      int
+}
+
+func (c *invalidatingChecker) Check(context.Context, *apiv1.SubjectReference, *apiv1.ObjectReference, string) (rag.Decision, error) {
+	c.calls++
+	c.invalidate()
+	return rag.DecisionAllowed, nil
+}
+
+func TestCheckCacheDropsDecisionsInvalidatedInFlight(t *testing.T) {
+	t.Parallel()
+
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	doc1 := &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"}
+	doc2 := &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc2"}
+
+	for name, invalidate := range map[string]func(*rag.CachingChecker){
+		"purge":      (*rag.CachingChecker).Purge,
+		"invalidate": func(c *rag.CachingChecker) { c.InvalidateResource(doc1) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			inner := &invalidatingChecker{}
+			cache := rag.NewCachingChecker(inner, time.Minute, 10)
+			inner.invalidate = func() { invalidate(cache) }
+
+			_, err := cache.Check(context.Background(), subject, doc1, "read")
+			require.NoError(t, err)
+			results, err := cache.CheckBulk(context.Background(), subject, []*apiv1.ObjectReference{doc1, doc2}, "read")
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			require.Zero(t, cache.Stats().Entries, "decisions older than the invalidation are not cached")
+			require.Equal(t, 3, inner.calls)
+
+			// Without invalidations in flight, decisions are cached again.
+			inner.invalidate = func() {}
+			_, err = cache.Check(context.Background(), subject, doc1, "read")
+			require.NoError(t, err)
+			require.Equal(t, 1, cache.Stats().Entries)
+		})
+	}
+}
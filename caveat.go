@@ -0,0 +1,163 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrConditionalPermission is returned under ConditionalReject when a
+// permission depends on caveat context the query did not supply.
+var ErrConditionalPermission = errors.New("rag: permission is conditional on missing caveat context")
+
+// ErrConditionalPermissionMissingContext is ErrConditionalPermission,
+// under the name that says what the caller has to supply.
+var ErrConditionalPermissionMissingContext = ErrConditionalPermission
+
+// ConditionalPolicy decides what a query does with documents whose
+// permission SpiceDB reports as conditional.
+type ConditionalPolicy int
+
+const (
+	// ConditionalDeny leaves conditional documents out of the results and
+	// counts them in Stats.Conditional.
+	ConditionalDeny ConditionalPolicy = iota
+
+	// ConditionalReject fails the query with ErrConditionalPermission, so
+	// a caller that forgot caveat context finds out instead of silently
+	// receiving fewer documents.
+	ConditionalReject
+)
+
+// WithConditionalPolicy selects what happens to conditional permissions.
+// The default is ConditionalDeny.
+func WithConditionalPolicy(p ConditionalPolicy) Option {
+	return func(r *RAGPipeline) {
+		r.conditionalPolicy = p
+	}
+}
+
+// ConditionalError reports a document whose permission is conditional.
+// Queries fail with it under ConditionalReject, and WithConditionalResolver
+// is given one per conditional document.
+type ConditionalError struct {
+	DocumentID string
+
+	// Resource is the document's SpiceDB object, "type:id".
+	Resource string
+
+	// Missing names the caveat context fields SpiceDB reported missing,
+	// when the checker passes them on; SpiceDBChecker's bulk checks do.
+	Missing []string
+}
+
+func (e ConditionalError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrConditionalPermission, e.Resource)
+	if len(e.Missing) > 0 {
+		msg += " (missing " + strings.Join(e.Missing, ", ") + ")"
+	}
+	return msg
+}
+
+// Unwrap returns ErrConditionalPermission.
+func (e ConditionalError) Unwrap() error {
+	return ErrConditionalPermission
+}
+
+// ConditionalResolver supplies caveat context a query did not, e.g. by
+// asking the user's device for its location. It is given the query's
+// conditional documents and returns context to check them again with,
+// merged over the query's own. Documents still conditional, or all of
+// them if it returns no context, are left to the ConditionalPolicy. An
+// error fails the query.
+type ConditionalResolver func(ctx context.Context, conditional []ConditionalError) (map[string]any, error)
+
+// WithConditionalResolver makes queries ask resolve for the caveat
+// context their conditional documents need and check them once more with
+// it, rather than dropping them straight away.
+func WithConditionalResolver(resolve ConditionalResolver) Option {
+	return func(r *RAGPipeline) {
+		r.resolver = resolve
+	}
+}
+
+// resolveConditional asks the pipeline's ConditionalResolver for the
+// caveat context the conditional results of docs lack and checks them
+// again with it, updating results in place. The checks count in
+// Stats.Rechecked.
+func (q *pendingQuery) resolveConditional(docs []ScoredDocument, resources []*apiv1.ObjectReference, results []CheckResult) error {
+	r := q.r
+	if r.resolver == nil {
+		return nil
+	}
+	var (
+		indices     []int
+		conditional []ConditionalError
+		recheck     []*apiv1.ObjectReference
+	)
+	for i, res := range results {
+		if res.Err != nil || res.Decision != DecisionConditional {
+			continue
+		}
+		indices = append(indices, i)
+		conditional = append(conditional, ConditionalError{
+			DocumentID: docs[i].Document.ID,
+			Resource:   objectKey(resources[i]),
+			Missing:    res.MissingContext,
+		})
+		recheck = append(recheck, resources[i])
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+
+	extra, err := r.resolver(q.ctx, conditional)
+	if err != nil {
+		return fmt.Errorf("rag: resolving caveat context: %w", err)
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+	caveat := caveatFromContext(q.ctx).AsMap()
+	maps.Copy(caveat, extra)
+	ctx, err := contextWithCaveat(q.ctx, caveat)
+	if err != nil {
+		return err
+	}
+
+	var stats Stats
+	rechecked, err := r.authorize(ctx, q.subject, recheck, q.plan, &stats)
+	q.resp.Stats.Rechecked += stats.Checked
+	if err != nil {
+		return err
+	}
+	for j, i := range indices {
+		results[i] = rechecked[j]
+	}
+	return nil
+}
+
+type caveatKey struct{}
+
+// contextWithCaveat attaches the caveat context a query's checks are
+// evaluated with, in the same way as contextWithConsistency.
+func contextWithCaveat(ctx context.Context, caveat map[string]any) (context.Context, error) {
+	if len(caveat) == 0 {
+		return ctx, nil
+	}
+	s, err := structpb.NewStruct(caveat)
+	if err != nil {
+		return ctx, fmt.Errorf("rag: invalid caveat context: %w", err)
+	}
+	return context.WithValue(ctx, caveatKey{}, s), nil
+}
+
+func caveatFromContext(ctx context.Context) *structpb.Struct {
+	s, _ := ctx.Value(caveatKey{}).(*structpb.Struct)
+	return s
+}
@@ -0,0 +1,146 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// singleChecker hides CheckBulk so the pipeline falls back to one Check
+// per candidate.
+type singleChecker struct {
+	rag.PermissionChecker
+}
+
+func caveatedPipeline(t *testing.T, opts ...rag.Option) map[string]*rag.RAGPipeline {
+	t.Helper()
+
+	client, fake := newFakeClient("document:doc0#read@user:emilia")
+	fake.conditional = map[string]string{"document:doc1#read@user:emilia": "on_vpn"}
+	docs := syntheticCorpus(3)
+	with := func(opt rag.Option) []rag.Option {
+		return append(slices.Clip(opts), opt)
+	}
+	return map[string]*rag.RAGPipeline{
+		"bulk":        rag.NewRAGPipeline(client, "document", "read", docs, opts...),
+		"single":      rag.NewRAGPipeline(client, "document", "read", docs, with(rag.WithPermissionChecker(singleChecker{rag.NewSpiceDBChecker(client)}))...),
+		"prefilter":   rag.NewRAGPipeline(client, "document", "read", docs, with(rag.WithFilterStrategy(rag.FilterPrefilter))...),
+		"access sets": rag.NewRAGPipeline(client, "document", "read", docs, with(rag.WithAccessSets(rag.AccessSets{}))...),
+	}
+}
+
+// prefiltered reports whether the caveatedPipeline named name retrieves
+// only the documents a lookup found, so never sees the denied ones.
+func prefiltered(name string) bool {
+	return name == "prefilter" || name == "access sets"
+}
+
+func TestConditionalPermissionWithoutCaveatContext(t *testing.T) {
+	t.Parallel()
+
+	pipelines := caveatedPipeline(t)
+	for name, pipeline := range pipelines {
+		var stats rag.Stats
+		results, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithStats(&stats))
+		require.NoError(t, err, name)
+		requireEqualDocIDs(t, []string{"doc0"}, results)
+		require.Equal(t, 1, stats.Conditional, name)
+		if !prefiltered(name) {
+			require.Equal(t, 1, stats.Denied, name)
+		}
+	}
+}
+
+func TestCaveatContextIsForwarded(t *testing.T) {
+	t.Parallel()
+
+	pipelines := caveatedPipeline(t)
+	for name, pipeline := range pipelines {
+		var stats rag.Stats
+		results, err := pipeline.Query(context.Background(), "emilia", "synthetic",
+			rag.WithCaveatContext(map[string]any{"on_vpn": true}), rag.WithStats(&stats))
+		require.NoError(t, err, name)
+		requireEqualDocIDs(t, []string{"doc0", "doc1"}, results)
+		require.Zero(t, stats.Conditional, name)
+
+		resp, err := pipeline.Do(context.Background(), rag.QueryRequest{
+			UserID:        "emilia",
+			Query:         "synthetic",
+			CaveatContext: map[string]any{"on_vpn": false},
+		})
+		require.NoError(t, err, name)
+		requireEqualDocIDs(t, []string{"doc0"}, resp.Documents)
+		if !prefiltered(name) {
+			require.Equal(t, 2, resp.Stats.Denied, name)
+		}
+	}
+}
+
+func TestConditionalReject(t *testing.T) {
+	t.Parallel()
+
+	pipelines := caveatedPipeline(t, rag.WithConditionalPolicy(rag.ConditionalReject))
+	for name, pipeline := range pipelines {
+		_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+		require.ErrorIs(t, err, rag.ErrConditionalPermission, name)
+		require.ErrorIs(t, err, rag.ErrConditionalPermissionMissingContext, name)
+		require.ErrorContains(t, err, "document:doc1", name)
+	}
+}
+
+func TestConditionalErrorNamesMissingContext(t *testing.T) {
+	t.Parallel()
+
+	pipeline := caveatedPipeline(t, rag.WithConditionalPolicy(rag.ConditionalReject))["bulk"]
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	var cerr rag.ConditionalError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, rag.ConditionalError{DocumentID: "doc1", Resource: "document:doc1", Missing: []string{"on_vpn"}}, cerr)
+	require.ErrorContains(t, err, "(missing on_vpn)")
+}
+
+func TestConditionalResolver(t *testing.T) {
+	t.Parallel()
+
+	var asked [][]rag.ConditionalError
+	resolve := func(_ context.Context, conditional []rag.ConditionalError) (map[string]any, error) {
+		asked = append(asked, conditional)
+		return map[string]any{"on_vpn": true}, nil
+	}
+	pipelines := caveatedPipeline(t, rag.WithConditionalResolver(resolve))
+	names := []string{"bulk", "single", "prefilter", "access sets"}
+	for _, name := range names {
+		var stats rag.Stats
+		results, err := pipelines[name].Query(context.Background(), "emilia", "synthetic",
+			rag.WithCaveatContext(map[string]any{"region": "eu"}), rag.WithStats(&stats))
+		require.NoError(t, err, name)
+		requireEqualDocIDs(t, []string{"doc0", "doc1"}, results)
+		require.Equal(t, 1, stats.Rechecked, name)
+		require.Zero(t, stats.Conditional, name)
+	}
+	require.Len(t, asked, len(names))
+	require.Equal(t, []rag.ConditionalError{{DocumentID: "doc1", Resource: "document:doc1", Missing: []string{"on_vpn"}}}, asked[0])
+	require.Equal(t, "doc1", asked[1][0].DocumentID, "single checks do not report missing context")
+	require.Equal(t, asked[0], asked[2], "lookups check conditional documents")
+	require.Equal(t, asked[0], asked[3], "access sets check conditional documents")
+
+	failing := caveatedPipeline(t, rag.WithConditionalResolver(func(context.Context, []rag.ConditionalError) (map[string]any, error) {
+		return nil, errors.New("device unreachable")
+	}))["bulk"]
+	_, err := failing.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorContains(t, err, "device unreachable")
+}
+
+func TestInvalidCaveatContext(t *testing.T) {
+	t.Parallel()
+
+	pipelines := caveatedPipeline(t)
+	_, err := pipelines["bulk"].Query(context.Background(), "emilia", "synthetic",
+		rag.WithCaveatContext(map[string]any{"bad": make(chan int)}))
+	require.ErrorContains(t, err, "invalid caveat context")
+}
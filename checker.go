@@ -0,0 +1,124 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+)
+
+// ErrPermissionBackendUnavailable wraps check and lookup failures meaning
+// the permission backend could not be reached or did not answer in time
+// (codes.Unavailable or codes.DeadlineExceeded), after any retries. The
+// gRPC status remains available to status.Code.
+var ErrPermissionBackendUnavailable = errors.New("rag: permission backend unavailable")
+
+// backendError marks err with ErrPermissionBackendUnavailable if it is a
+// transient backend failure.
+func backendError(ctx context.Context, err error) error {
+	if !transient(ctx, err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrPermissionBackendUnavailable, err)
+}
+
+// Decision is the outcome of a permission check.
+type Decision int
+
+const (
+	// DecisionDenied means the subject does not hold the permission.
+	DecisionDenied Decision = iota
+	// DecisionAllowed means the subject holds the permission.
+	DecisionAllowed
+	// DecisionConditional means the permission depends on caveat context
+	// that was not supplied. The pipeline never returns such documents;
+	// see ConditionalPolicy.
+	DecisionConditional
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DecisionDenied:
+		return "denied"
+	case DecisionAllowed:
+		return "allowed"
+	case DecisionConditional:
+		return "conditional"
+	default:
+		return fmt.Sprintf("Decision(%d)", int(d))
+	}
+}
+
+// PermissionChecker decides whether a subject holds a permission on a
+// resource. The pipeline uses a SpiceDB-backed checker by default; other
+// authorizers (OPA, Cedar, ...) or test doubles such as
+// ragtest.MemoryChecker can be plugged in with WithPermissionChecker.
+type PermissionChecker interface {
+	Check(ctx context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (Decision, error)
+}
+
+// WithPermissionChecker replaces the SpiceDB client as the source of
+// permission decisions for queries.
+func WithPermissionChecker(c PermissionChecker) Option {
+	return func(r *RAGPipeline) {
+		r.checker = c
+	}
+}
+
+// SpiceDBChecker is the PermissionChecker backed by SpiceDB's
+// CheckPermission and CheckBulkPermissions APIs.
+type SpiceDBChecker struct {
+	client    *authzed.Client
+	chunkSize int
+}
+
+// NewSpiceDBChecker returns a checker issuing CheckPermission calls on
+// client.
+func NewSpiceDBChecker(client *authzed.Client) *SpiceDBChecker {
+	return &SpiceDBChecker{client: client}
+}
+
+// Check implements PermissionChecker.
+func (c *SpiceDBChecker) Check(ctx context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (Decision, error) {
+	resp, err := c.client.CheckPermission(ctx, &apiv1.CheckPermissionRequest{
+		Consistency: consistencyFromContext(ctx),
+		Resource:    resource,
+		Permission:  permission,
+		Subject:     subject,
+		Context:     caveatFromContext(ctx),
+	})
+	if err != nil {
+		return DecisionDenied, err
+	}
+	return decisionOf(resp.GetPermissionship()), nil
+}
+
+func decisionOf(p apiv1.CheckPermissionResponse_Permissionship) Decision {
+	switch p {
+	case apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION:
+		return DecisionAllowed
+	case apiv1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION:
+		return DecisionConditional
+	default:
+		return DecisionDenied
+	}
+}
+
+type consistencyKey struct{}
+
+// contextWithConsistency attaches the consistency a query's checks must
+// be evaluated at, so it reaches the checker without widening its
+// interface.
+func contextWithConsistency(ctx context.Context, c *apiv1.Consistency) context.Context {
+	if c == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+func consistencyFromContext(ctx context.Context) *apiv1.Consistency {
+	c, _ := ctx.Value(consistencyKey{}).(*apiv1.Consistency)
+	return c
+}
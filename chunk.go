@@ -0,0 +1,297 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Metadata keys set on every chunk.
+const (
+	// ParentIDKey holds the ID of the document a chunk was cut from.
+	ParentIDKey = "parent_id"
+	// ChunkIndexKey holds the chunk's position within its parent,
+	// starting at 0.
+	ChunkIndexKey = "chunk_index"
+	// ParentObjectKey holds the parent's SpiceDB object. A chunk without
+	// a SpiceDBObjectKey of its own is authorized against it.
+	ParentObjectKey = "parent_spicedb_object"
+)
+
+// ErrInvalidChunker is returned for a chunker whose sizes make no sense,
+// such as an overlap at least as large as the chunk size.
+var ErrInvalidChunker = errors.New("rag: invalid chunker configuration")
+
+// Chunker splits a document into retrieval-sized chunks. Each chunk is a
+// Document with ID "<parent>#<index>" that inherits a copy of the
+// parent's metadata; ParentIDKey, ChunkIndexKey and ParentObjectKey are
+// added.
+//
+// The built-in chunkers move the parent's SpiceDBObjectKey to
+// ParentObjectKey, so chunks are authorized exactly like their parent.
+// A chunker may set SpiceDBObjectKey on individual chunks, e.g. for a
+// section more restricted than the rest of the document; the pipeline
+// always checks the chunk's own object when it has one.
+type Chunker interface {
+	Chunk(doc Document) ([]Document, error)
+}
+
+// WithChunker splits documents into chunks as they are ingested by
+// NewRAGPipeline, AddDocuments, UpdateDocument and SyncCorpus. Queries
+// then return chunks, and RemoveDocuments, UpdateDocument and SyncCorpus
+// accept parent IDs.
+func WithChunker(c Chunker) Option {
+	return func(r *RAGPipeline) {
+		r.chunker = c
+	}
+}
+
+// FixedSizeChunker cuts text every Size runes, repeating the last Overlap
+// runes of each chunk at the start of the next.
+type FixedSizeChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Chunk implements Chunker.
+func (c FixedSizeChunker) Chunk(doc Document) ([]Document, error) {
+	if err := validSizes(c.Size, c.Overlap); err != nil {
+		return nil, err
+	}
+	return chunks(doc, fixedSplit(doc.Text, c.Size, c.Overlap)), nil
+}
+
+// SentenceChunker packs whole sentences into chunks of at most MaxSize
+// runes, repeating the last Overlap sentences of each chunk at the start
+// of the next. A sentence longer than MaxSize is cut like
+// FixedSizeChunker would.
+type SentenceChunker struct {
+	MaxSize int
+	Overlap int // in sentences
+}
+
+// Chunk implements Chunker.
+func (c SentenceChunker) Chunk(doc Document) ([]Document, error) {
+	if c.MaxSize <= 0 || c.Overlap < 0 {
+		return nil, fmt.Errorf("%w: max size %d, overlap %d", ErrInvalidChunker, c.MaxSize, c.Overlap)
+	}
+
+	var pieces []string
+	for _, s := range sentences(doc.Text) {
+		if utf8.RuneCountInString(s) > c.MaxSize {
+			pieces = append(pieces, fixedSplit(s, c.MaxSize, 0)...)
+			continue
+		}
+		pieces = append(pieces, s)
+	}
+	return chunks(doc, pack(pieces, c.MaxSize, func(carry []string) []string {
+		return carry[max(0, len(carry)-c.Overlap):]
+	})), nil
+}
+
+// DefaultSeparators are the separators RecursiveChunker tries, from the
+// coarsest to the finest.
+var DefaultSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// RecursiveChunker splits text on the coarsest separator that yields
+// pieces of at most Size runes, recursing into oversized pieces with finer
+// separators (DefaultSeparators if Separators is empty), then merges
+// adjacent pieces back up to Size. About Overlap runes of trailing pieces
+// are repeated at the start of the next chunk.
+type RecursiveChunker struct {
+	Size       int
+	Overlap    int
+	Separators []string
+}
+
+// Chunk implements Chunker.
+func (c RecursiveChunker) Chunk(doc Document) ([]Document, error) {
+	if err := validSizes(c.Size, c.Overlap); err != nil {
+		return nil, err
+	}
+	seps := c.Separators
+	if len(seps) == 0 {
+		seps = DefaultSeparators
+	}
+	pieces := recursiveSplit(doc.Text, c.Size, seps)
+	return chunks(doc, pack(pieces, c.Size, func(carry []string) []string {
+		n, i := 0, len(carry)
+		for i > 0 && n+utf8.RuneCountInString(carry[i-1]) <= c.Overlap {
+			i--
+			n += utf8.RuneCountInString(carry[i])
+		}
+		return carry[i:]
+	})), nil
+}
+
+func validSizes(size, overlap int) error {
+	if size <= 0 || overlap < 0 || overlap >= size {
+		return fmt.Errorf("%w: size %d, overlap %d", ErrInvalidChunker, size, overlap)
+	}
+	return nil
+}
+
+// chunks turns texts into the chunk documents of parent.
+func chunks(parent Document, texts []string) []Document {
+	out := make([]Document, 0, len(texts))
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		md := make(map[string]string, len(parent.Metadata)+3)
+		maps.Copy(md, parent.Metadata)
+		if obj := md[SpiceDBObjectKey]; obj != "" {
+			delete(md, SpiceDBObjectKey)
+			md[ParentObjectKey] = obj
+		}
+		md[ParentIDKey] = parent.ID
+		md[ChunkIndexKey] = strconv.Itoa(len(out))
+		out = append(out, Document{ID: parent.ID + "#" + strconv.Itoa(len(out)), Text: text, Metadata: md})
+	}
+	return out
+}
+
+// fixedSplit cuts text into pieces of size runes, each starting size-overlap
+// runes after the previous one.
+func fixedSplit(text string, size, overlap int) []string {
+	runes := []rune(text)
+	var out []string
+	for start := 0; start < len(runes); start += size - overlap {
+		end := min(start+size, len(runes))
+		out = append(out, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return out
+}
+
+// sentences splits text after sentence-ending punctuation followed by
+// whitespace, and after newlines. The pieces concatenate back to text.
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	runes := []rune(text)
+	pos := 0 // byte offset of runes[i]
+	for i, r := range runes {
+		size := utf8.RuneLen(r)
+		end := pos + size
+		boundary := r == '\n' ||
+			(strings.ContainsRune(".!?", r) && i+1 < len(runes) && unicode.IsSpace(runes[i+1]))
+		if boundary {
+			// Keep the following space with this sentence.
+			if r != '\n' && runes[i+1] != '\n' {
+				end += utf8.RuneLen(runes[i+1])
+			}
+			if end > start {
+				out = append(out, text[start:end])
+				start = end
+			}
+		}
+		pos += size
+	}
+	if start < len(text) {
+		out = append(out, text[start:])
+	}
+	return out
+}
+
+// recursiveSplit splits text into pieces of at most size runes using the
+// first separator in seps that occurs, recursing with the remaining
+// separators. Separators stay attached to the preceding piece.
+func recursiveSplit(text string, size int, seps []string) []string {
+	if utf8.RuneCountInString(text) <= size {
+		return []string{text}
+	}
+	for i, sep := range seps {
+		if !strings.Contains(text, sep) {
+			continue
+		}
+		var out []string
+		for _, part := range strings.SplitAfter(text, sep) {
+			if part == "" {
+				continue
+			}
+			out = append(out, recursiveSplit(part, size, seps[i+1:])...)
+		}
+		return out
+	}
+	return fixedSplit(text, size, 0)
+}
+
+// pack merges consecutive pieces into chunks of at most size runes,
+// trimming surrounding whitespace. When a chunk is full, overlap picks
+// which of its trailing pieces start the next one.
+func pack(pieces []string, size int, overlap func(carry []string) []string) []string {
+	var out, cur []string
+	n := 0
+	for _, p := range pieces {
+		pn := utf8.RuneCountInString(p)
+		if len(cur) > 0 && n+pn > size {
+			out = append(out, strings.TrimSpace(strings.Join(cur, "")))
+			cur = append([]string(nil), overlap(cur)...)
+			n = 0
+			for _, c := range cur {
+				n += utf8.RuneCountInString(c)
+			}
+			// Drop carried pieces that would not leave room for p.
+			for len(cur) > 0 && n+pn > size {
+				n -= utf8.RuneCountInString(cur[0])
+				cur = cur[1:]
+			}
+		}
+		cur = append(cur, p)
+		n += pn
+	}
+	if len(cur) > 0 {
+		out = append(out, strings.TrimSpace(strings.Join(cur, "")))
+	}
+	return out
+}
+
+// ingest applies ingestion limits to d and, with a chunker configured,
+// splits it into chunks. Chunks record the object d maps to, so they
+// fall back to it also when it comes from a ResourceMapper.
+func (r *RAGPipeline) ingest(d Document) ([]Document, error) {
+	if err := r.admit(d); err != nil {
+		return nil, err
+	}
+	if err := r.admitTenant(d); err != nil {
+		return nil, err
+	}
+	if r.strictMapping {
+		if err := r.ValidateMapping(d); err != nil {
+			return nil, err
+		}
+	}
+	if r.chunker == nil {
+		return []Document{d}, nil
+	}
+	chunks, err := r.chunker.Chunk(d)
+	if err != nil {
+		return nil, err
+	}
+	if res, err := r.resourceFor(d); err == nil {
+		for i := range chunks {
+			if chunks[i].Metadata == nil {
+				chunks[i].Metadata = make(map[string]string)
+			}
+			chunks[i].Metadata[ParentObjectKey] = objectKey(res)
+		}
+	}
+	return chunks, nil
+}
+
+// sourceID is the ID d was ingested under: its parent's for chunks.
+func (r *RAGPipeline) sourceID(d Document) string {
+	if r.chunker != nil {
+		if p := d.Metadata[ParentIDKey]; p != "" {
+			return p
+		}
+	}
+	return d.ID
+}
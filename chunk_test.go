@@ -0,0 +1,153 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func chunkTexts(docs []rag.Document) []string {
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Text
+	}
+	return texts
+}
+
+func TestFixedSizeChunker(t *testing.T) {
+	t.Parallel()
+
+	parent := rag.Document{ID: "doc1", Text: "ábcdefghij", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1", "title": "T"}}
+	chunks, err := rag.FixedSizeChunker{Size: 4, Overlap: 1}.Chunk(parent)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ábcd", "defg", "ghij"}, chunkTexts(chunks))
+
+	require.Equal(t, "doc1#1", chunks[1].ID)
+	require.Equal(t, map[string]string{
+		rag.ParentObjectKey: "document:doc1",
+		"title":             "T",
+		rag.ParentIDKey:     "doc1",
+		rag.ChunkIndexKey:   "1",
+	}, chunks[1].Metadata)
+	require.NotContains(t, parent.Metadata, rag.ParentIDKey)
+}
+
+func TestSentenceChunker(t *testing.T) {
+	t.Parallel()
+
+	chunks, err := rag.SentenceChunker{MaxSize: 12, Overlap: 1}.Chunk(rag.Document{ID: "d", Text: "A b. C d. E f. G h."})
+	require.NoError(t, err)
+	require.Equal(t, []string{"A b. C d.", "C d. E f.", "E f. G h."}, chunkTexts(chunks))
+
+	// A sentence longer than MaxSize is cut.
+	chunks, err = rag.SentenceChunker{MaxSize: 4}.Chunk(rag.Document{ID: "d", Text: "abcdefgh. x"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"abcd", "efgh", ". x"}, chunkTexts(chunks))
+}
+
+func TestRecursiveChunker(t *testing.T) {
+	t.Parallel()
+
+	text := "aaa bbb\n\nccc ddd eee\n\nfff"
+	chunks, err := rag.RecursiveChunker{Size: 8}.Chunk(rag.Document{ID: "d", Text: text})
+	require.NoError(t, err)
+	require.Equal(t, []string{"aaa bbb", "ccc", "ddd eee", "fff"}, chunkTexts(chunks))
+
+	chunks, err = rag.RecursiveChunker{Size: 8, Overlap: 4}.Chunk(rag.Document{ID: "d", Text: text})
+	require.NoError(t, err)
+	require.Equal(t, []string{"aaa bbb", "ccc", "ccc ddd", "ddd eee", "eee\n\nfff"}, chunkTexts(chunks))
+
+	for _, c := range chunks {
+		require.LessOrEqual(t, len([]rune(c.Text)), 8)
+	}
+}
+
+func TestInvalidChunkers(t *testing.T) {
+	t.Parallel()
+
+	doc := rag.Document{ID: "d", Text: "text"}
+	for _, c := range []rag.Chunker{
+		rag.FixedSizeChunker{},
+		rag.FixedSizeChunker{Size: 4, Overlap: 4},
+		rag.SentenceChunker{MaxSize: 0},
+		rag.SentenceChunker{MaxSize: 4, Overlap: -1},
+		rag.RecursiveChunker{Size: 4, Overlap: 5},
+	} {
+		_, err := c.Chunk(doc)
+		require.ErrorIs(t, err, rag.ErrInvalidChunker, "%#v", c)
+	}
+}
+
+func TestPipelineChunksOnIngestion(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{
+		{ID: "doc1", Text: strings.Repeat("alpha ", 10), Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}},
+		{ID: "doc2", Text: strings.Repeat("alpha ", 10), Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc2"}},
+	}
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+		rag.WithChunker(rag.FixedSizeChunker{Size: 30}))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "alpha")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1#0", "doc1#1"}, results)
+
+	require.ErrorIs(t, pipeline.AddDocuments(rag.Document{ID: "doc1"}), rag.ErrDuplicateDocument)
+
+	require.NoError(t, pipeline.UpdateDocument(rag.Document{ID: "doc1", Text: "alpha", Metadata: docs[0].Metadata}))
+	results, err = pipeline.Query(context.Background(), "emilia", "alpha")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1#0"}, results)
+
+	require.Equal(t, 2, pipeline.RemoveDocuments("doc2"))
+	require.Equal(t, 1, pipeline.RemoveDocuments("doc1"))
+}
+
+// sectionChunker splits on "---" and restricts sections that start with
+// "secret" to their own object.
+type sectionChunker struct{}
+
+func (sectionChunker) Chunk(doc rag.Document) ([]rag.Document, error) {
+	var chunks []rag.Document
+	for i, text := range strings.Split(doc.Text, "---") {
+		c := rag.Document{
+			ID:       fmt.Sprintf("%s#%d", doc.ID, i),
+			Text:     text,
+			Metadata: map[string]string{rag.ParentIDKey: doc.ID},
+		}
+		if strings.HasPrefix(text, "secret") {
+			c.Metadata[rag.SpiceDBObjectKey] = fmt.Sprintf("section:%s-%d", doc.ID, i)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+func TestChunkPermissionsFallBackToParent(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{{ID: "doc1", Text: "public plan---secret plan---public appendix plan"}}
+	client, _ := newFakeClient(
+		"document:doc1#read@user:emilia",
+		"document:doc1#read@user:beatrice",
+		"section:doc1-1#read@user:beatrice",
+	)
+	mapper, err := rag.NewTemplateMapper("document:{{.ID}}")
+	require.NoError(t, err)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+		rag.WithResourceMapper(mapper), rag.WithChunker(sectionChunker{}))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "plan")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1#0", "doc1#2"}, results)
+
+	results, err = pipeline.Query(context.Background(), "beatrice", "plan")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1#0", "doc1#1", "doc1#2"}, results)
+}
@@ -0,0 +1,84 @@
+package rag
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationSnippetRunes is the length of Citation.Snippet.
+const citationSnippetRunes = 200
+
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// Citation ties a passage of a generated answer to the authorized source
+// it cites. Citations are found by the "[n]" markers PromptData numbers
+// sources with, so custom prompts must keep asking for them. Markers that
+// do not name one of the answer's sources are ignored: a citation always
+// refers to a document the user may read.
+type Citation struct {
+	// Span is the sentence of the answer carrying the marker.
+	Span Span
+
+	// Marker is the marker as written, e.g. "[2]".
+	Marker string
+
+	// DocumentID and Object identify the cited source and the SpiceDB
+	// object it was authorized against.
+	DocumentID string
+	Object     string
+
+	// Snippet is the start of the source's text.
+	Snippet string
+}
+
+// citations extracts the citations of answer to sources.
+func (r *RAGPipeline) citations(answer string, sources []Document) []Citation {
+	var out []Citation
+	for _, m := range citationMarker.FindAllStringSubmatchIndex(answer, -1) {
+		n, err := strconv.Atoi(answer[m[2]:m[3]])
+		if err != nil || n < 1 || n > len(sources) {
+			continue
+		}
+		d := sources[n-1]
+		c := Citation{
+			Span:       sentenceAround(answer, m[0], m[1]),
+			Marker:     answer[m[0]:m[1]],
+			DocumentID: d.ID,
+			Snippet:    snippet(d.Text),
+		}
+		if res, err := r.resourceFor(d); err == nil {
+			c.Object = objectKey(res)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// sentenceAround returns the sentence of text containing [start, end),
+// without surrounding whitespace.
+func sentenceAround(text string, start, end int) Span {
+	from := strings.LastIndexAny(text[:start], ".!?\n") + 1
+	to := len(text)
+	if i := strings.IndexAny(text[end:], ".!?\n"); i >= 0 {
+		to = end + i + 1
+	}
+	for from < start && isSpace(text[from]) {
+		from++
+	}
+	for to > end && isSpace(text[to-1]) {
+		to--
+	}
+	return Span{Start: from, End: to}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func snippet(text string) string {
+	if r := []rune(text); len(r) > citationSnippetRunes {
+		return string(r[:citationSnippetRunes]) + "…"
+	}
+	return text
+}
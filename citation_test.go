@@ -0,0 +1,37 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestAnswerCitations(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc0#read@user:emilia", "document:doc2#read@user:emilia")
+	answer := "Doc zero says hi [1]. Both agree [1][2]!\nNothing in [3] or [0]."
+	gen := &recordingGenerator{answer: answer}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3), rag.WithGenerator(gen))
+
+	resp, err := pipeline.Answer(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0", "doc2"}, resp.Sources)
+
+	require.Len(t, resp.Citations, 3)
+	first, second, third := resp.Citations[0], resp.Citations[1], resp.Citations[2]
+
+	require.Equal(t, "Doc zero says hi [1].", answer[first.Span.Start:first.Span.End])
+	require.Equal(t, "[1]", first.Marker)
+	require.Equal(t, "doc0", first.DocumentID)
+	require.Equal(t, "document:doc0", first.Object)
+	require.Equal(t, "synthetic entry doc0", first.Snippet)
+
+	require.Equal(t, "Both agree [1][2]!", answer[second.Span.Start:second.Span.End])
+	require.Equal(t, second.Span, third.Span)
+	require.Equal(t, "doc2", third.DocumentID)
+	require.Equal(t, "document:doc2", third.Object)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// corpusRecord is one line of a --corpus JSONL file. Owners and viewers are
+// user IDs, where the viewer "*" makes the document public; documents
+// without a spicedb_object in Metadata are mapped to document:<id>.
+type corpusRecord struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Owners   []string          `json:"owners,omitempty"`
+	Viewers  []string          `json:"viewers,omitempty"`
+}
+
+// demoCorpus mirrors the scenario of the package's integration test.
+var demoCorpus = []corpusRecord{
+	{ID: "doc1", Text: "Internal roadmap for 2025. Highly confidential.", Owners: []string{"emilia"}},
+	{ID: "doc2", Text: "Customer success playbook and escalation procedures.", Viewers: []string{"beatrice"}},
+	{ID: "doc3", Text: "Public FAQ for all users.", Viewers: []string{"*"}},
+}
+
+func readCorpus(r io.Reader) ([]corpusRecord, error) {
+	var records []corpusRecord
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec corpusRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.ID == "" {
+			return nil, fmt.Errorf("line %d: missing id", line)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+func (rec corpusRecord) object() string {
+	if obj := rec.Metadata[rag.SpiceDBObjectKey]; obj != "" {
+		return obj
+	}
+	return "document:" + rec.ID
+}
+
+func documents(records []corpusRecord) []rag.Document {
+	docs := make([]rag.Document, 0, len(records))
+	for _, rec := range records {
+		meta := make(map[string]string, len(rec.Metadata)+1)
+		for k, v := range rec.Metadata {
+			meta[k] = v
+		}
+		meta[rag.SpiceDBObjectKey] = rec.object()
+		docs = append(docs, rag.Document{ID: rec.ID, Text: rec.Text, Metadata: meta})
+	}
+	return docs
+}
+
+// maxWriteUpdates is the most updates SpiceDB accepts in one
+// WriteRelationships call by default.
+const maxWriteUpdates = 1000
+
+func seedRelationships(ctx context.Context, client *authzed.Client, records []corpusRecord) error {
+	var updates []*apiv1.RelationshipUpdate
+	for _, rec := range records {
+		res, err := rag.ParseObjectReference(rec.object())
+		if err != nil {
+			return fmt.Errorf("document %q: %w", rec.ID, err)
+		}
+		for _, u := range rec.Owners {
+			updates = append(updates, touch(res, "owner", u))
+		}
+		for _, u := range rec.Viewers {
+			updates = append(updates, touch(res, "viewer", u))
+		}
+	}
+
+	for len(updates) > 0 {
+		n := min(len(updates), maxWriteUpdates)
+		if _, err := client.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{Updates: updates[:n]}); err != nil {
+			return fmt.Errorf("seeding relationships: %w", err)
+		}
+		updates = updates[n:]
+	}
+	return nil
+}
+
+func touch(res *apiv1.ObjectReference, relation, userID string) *apiv1.RelationshipUpdate {
+	return &apiv1.RelationshipUpdate{
+		Operation: apiv1.RelationshipUpdate_OPERATION_TOUCH,
+		Relationship: &apiv1.Relationship{
+			Resource: res,
+			Relation: relation,
+			Subject: &apiv1.SubjectReference{
+				Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: userID},
+			},
+		},
+	}
+}
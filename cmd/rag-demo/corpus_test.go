@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// recordingWriter records the size of each WriteRelationships call.
+type recordingWriter struct {
+	apiv1.PermissionsServiceClient
+	sizes []int
+}
+
+func (w *recordingWriter) WriteRelationships(_ context.Context, in *apiv1.WriteRelationshipsRequest, _ ...grpc.CallOption) (*apiv1.WriteRelationshipsResponse, error) {
+	w.sizes = append(w.sizes, len(in.GetUpdates()))
+	return &apiv1.WriteRelationshipsResponse{}, nil
+}
+
+func TestSeedRelationshipsChunksWrites(t *testing.T) {
+	t.Parallel()
+
+	records := make([]corpusRecord, 1200)
+	for i := range records {
+		records[i] = corpusRecord{ID: fmt.Sprintf("doc%d", i), Owners: []string{"emilia"}, Viewers: []string{"beatrice"}}
+	}
+	w := &recordingWriter{}
+	require.NoError(t, seedRelationships(context.Background(), &authzed.Client{PermissionsServiceClient: w}, records))
+	require.Equal(t, []int{1000, 1000, 400}, w.sizes)
+
+	w.sizes = nil
+	require.NoError(t, seedRelationships(context.Background(), &authzed.Client{PermissionsServiceClient: w}, nil))
+	require.Empty(t, w.sizes)
+}
@@ -0,0 +1,98 @@
+// Command rag-demo starts a throwaway SpiceDB container, seeds it with a
+// small corpus and drops into a REPL for running permission-aware queries:
+//
+//	rag> as emilia: roadmap
+//
+// Use --corpus to load your own JSONL corpus and --keep to leave the
+// container running on exit.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/spicedbtest"
+)
+
+const demoSchema = `
+definition user {}
+
+definition document {
+  relation owner: user
+  relation viewer: user | user:*
+
+  permission read = owner + viewer
+}
+`
+
+func main() {
+	corpusPath := flag.String("corpus", "", "JSONL corpus to load instead of the built-in demo documents")
+	keep := flag.Bool("keep", false, "leave the SpiceDB container running on exit")
+	image := flag.String("image", spicedbtest.DefaultImage, "SpiceDB image to run")
+	flag.Parse()
+
+	if err := run(*corpusPath, *keep, *image); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(corpusPath string, keep bool, image string) error {
+	records := demoCorpus
+	if corpusPath != "" {
+		f, err := os.Open(corpusPath)
+		if err != nil {
+			return err
+		}
+		records, err = readCorpus(f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", corpusPath, err)
+		}
+	}
+
+	if keep {
+		// The reaper would otherwise remove the container when we exit.
+		_ = os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("starting %s ...", image)
+	inst, err := spicedbtest.Run(ctx, spicedbtest.WithImage(image), spicedbtest.WithSchema(demoSchema))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The signal context may already be cancelled; give teardown its own.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if keep {
+			log.Printf("leaving container %s running, SpiceDB at %s (preshared key %q)",
+				inst.ContainerID(), inst.Endpoint, spicedbtest.DefaultPresharedKey)
+			_ = inst.Close()
+			return
+		}
+		if err := inst.Terminate(shutdownCtx); err != nil {
+			log.Printf("terminating container: %v", err)
+		}
+	}()
+
+	if err := seedRelationships(ctx, inst.Client, records); err != nil {
+		return err
+	}
+
+	docs := documents(records)
+	pipeline := rag.NewRAGPipeline(inst.Client, "document", "read", docs)
+	log.Printf("SpiceDB ready at %s with %d documents", inst.Endpoint, len(docs))
+
+	return newREPL(pipeline, docs, os.Stdin, os.Stdout).run(ctx)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+type commandKind int
+
+const (
+	cmdNone commandKind = iota
+	cmdQuery
+	cmdDocs
+	cmdHelp
+	cmdQuit
+)
+
+type command struct {
+	kind  commandKind
+	user  string
+	query string
+}
+
+const helpText = `commands:
+  as <user>: <query>   run a query as <user>, e.g. "as emilia: roadmap"
+  docs                 list the indexed documents
+  help                 show this help
+  quit                 exit (also: exit, Ctrl-D)`
+
+// parseCommand parses one REPL input line.
+func parseCommand(line string) (command, error) {
+	line = strings.TrimSpace(line)
+
+	switch strings.ToLower(line) {
+	case "":
+		return command{kind: cmdNone}, nil
+	case "docs":
+		return command{kind: cmdDocs}, nil
+	case "help", "?":
+		return command{kind: cmdHelp}, nil
+	case "quit", "exit":
+		return command{kind: cmdQuit}, nil
+	}
+
+	rest, ok := cutPrefixFold(line, "as ")
+	if !ok {
+		return command{}, fmt.Errorf("unknown command %q (try \"help\")", line)
+	}
+
+	user, query, ok := strings.Cut(rest, ":")
+	if !ok {
+		return command{}, errors.New(`missing ":" after the user, e.g. "as emilia: roadmap"`)
+	}
+	user, query = strings.TrimSpace(user), strings.TrimSpace(query)
+	if user == "" || strings.ContainsAny(user, " \t") {
+		return command{}, fmt.Errorf("invalid user %q", user)
+	}
+	if query == "" {
+		return command{}, errors.New("empty query")
+	}
+
+	return command{kind: cmdQuery, user: user, query: query}, nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+type repl struct {
+	pipeline *rag.RAGPipeline
+	docs     []rag.Document
+	in       io.Reader
+	out      io.Writer
+}
+
+func newREPL(pipeline *rag.RAGPipeline, docs []rag.Document, in io.Reader, out io.Writer) *repl {
+	return &repl{pipeline: pipeline, docs: docs, in: in, out: out}
+}
+
+// run reads commands until EOF, "quit" or ctx is cancelled.
+func (r *repl) run(ctx context.Context) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r.in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintln(r.out, helpText)
+	for {
+		fmt.Fprint(r.out, "rag> ")
+
+		var line string
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(r.out)
+			return nil
+		case l, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(r.out)
+				return nil
+			}
+			line = l
+		}
+
+		cmd, err := parseCommand(line)
+		if err != nil {
+			fmt.Fprintln(r.out, "error:", err)
+			continue
+		}
+
+		switch cmd.kind {
+		case cmdQuit:
+			return nil
+		case cmdHelp:
+			fmt.Fprintln(r.out, helpText)
+		case cmdDocs:
+			for _, d := range r.docs {
+				fmt.Fprintf(r.out, "  %-12s %s\n", d.ID, d.Metadata[rag.SpiceDBObjectKey])
+			}
+		case cmdQuery:
+			r.query(ctx, cmd)
+		}
+	}
+}
+
+func (r *repl) query(ctx context.Context, cmd command) {
+	resp, err := r.pipeline.Do(ctx, rag.QueryRequest{UserID: cmd.user, Query: cmd.query})
+	if err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+		return
+	}
+
+	stats := resp.Stats
+	fmt.Fprintf(r.out, "%d result(s) for %s (%d matched, %d denied, %d unmapped)\n",
+		len(resp.Results), cmd.user, stats.Candidates, stats.Denied, stats.Unmapped)
+	for _, res := range resp.Results {
+		fmt.Fprintf(r.out, "  %-12s %.2f  %s\n", res.Document.ID, res.Score, res.Document.Text)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line    string
+		want    command
+		wantErr string
+	}{
+		{line: "", want: command{kind: cmdNone}},
+		{line: "   ", want: command{kind: cmdNone}},
+		{line: "help", want: command{kind: cmdHelp}},
+		{line: "?", want: command{kind: cmdHelp}},
+		{line: "docs", want: command{kind: cmdDocs}},
+		{line: "quit", want: command{kind: cmdQuit}},
+		{line: " EXIT ", want: command{kind: cmdQuit}},
+		{line: "as emilia: roadmap", want: command{kind: cmdQuery, user: "emilia", query: "roadmap"}},
+		{line: "AS beatrice:playbook", want: command{kind: cmdQuery, user: "beatrice", query: "playbook"}},
+		{line: "as charlie:  public faq: all ", want: command{kind: cmdQuery, user: "charlie", query: "public faq: all"}},
+		{line: "as emilia roadmap", wantErr: `missing ":"`},
+		{line: "as : roadmap", wantErr: "invalid user"},
+		{line: "as two words: roadmap", wantErr: "invalid user"},
+		{line: "as emilia:   ", wantErr: "empty query"},
+		{line: "roadmap", wantErr: "unknown command"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseCommand(tc.line)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestReadCorpus(t *testing.T) {
+	t.Parallel()
+
+	in := `{"id":"a","text":"alpha","owners":["emilia"]}
+
+{"id":"b","text":"beta","metadata":{"spicedb_object":"wiki_page:b"},"viewers":["charlie"]}
+`
+	records, err := readCorpus(strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	docs := documents(records)
+	require.Equal(t, "document:a", docs[0].Metadata["spicedb_object"])
+	require.Equal(t, "wiki_page:b", docs[1].Metadata["spicedb_object"])
+
+	_, err = readCorpus(strings.NewReader(`{"text":"no id"}`))
+	require.ErrorContains(t, err, "line 1: missing id")
+}
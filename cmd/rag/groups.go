@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/groupsync"
+)
+
+func runGroups(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("groups", flag.ContinueOnError)
+	var g globals
+	g.register(fs)
+	scimURL := fs.String("scim", "", `base URL of the SCIM service, e.g. "https://idp.acme.com/scim/v2" (required)`)
+	scimToken := fs.String("scim-token", os.Getenv("SCIM_TOKEN"), "SCIM bearer token")
+	every := fs.Duration("every", 0, "sync on this interval until interrupted instead of once")
+	keep := fs.Bool("keep-missing", false, "keep the members of groups not in the directory")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || positional[0] != "sync" || *scimURL == "" {
+		return errors.New("usage: rag groups sync --scim URL")
+	}
+
+	pipeline, err := g.pipeline(nil)
+	if err != nil {
+		return err
+	}
+	var opts []groupsync.Option
+	if *keep {
+		opts = append(opts, groupsync.KeepMissingGroups())
+	}
+	syncer := groupsync.New(groupsync.NewSCIM(*scimURL, groupsync.SCIMWithToken(*scimToken)), pipeline, opts...)
+	if *every <= 0 {
+		report, err := syncer.Sync(ctx)
+		if err != nil {
+			return err
+		}
+		printReport(out, report)
+		return nil
+	}
+	err = syncer.Run(ctx, *every, func(report *groupsync.Report, err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rag:", err)
+			return
+		}
+		printReport(out, report)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func printReport(out io.Writer, r *groupsync.Report) {
+	fmt.Fprintf(out, "%d groups, %d changed, %d removed\n", r.Groups, len(r.Changed), len(r.Removed))
+	if len(r.Changed) > 0 {
+		fmt.Fprintln(out, "changed:", strings.Join(r.Changed, " "))
+	}
+	if len(r.Removed) > 0 {
+		fmt.Fprintln(out, "removed:", strings.Join(r.Removed, " "))
+	}
+}
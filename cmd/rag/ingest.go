@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+func runIngest(ctx context.Context, args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	var g globals
+	g.register(fset)
+	var owners, viewers stringList
+	fset.Var(&owners, "owner", `subject granted the owner relation, e.g. "user:emilia" (repeatable)`)
+	fset.Var(&viewers, "viewer", `subject granted the viewer relation, e.g. "group:eng#member" (repeatable)`)
+	exts := fset.String("ext", ".txt,.md,.html,.pdf", "extensions of the files ingested from directories")
+	paths, err := parse(fset, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return errors.New("usage: rag ingest PATH... [--owner SUBJECT] [--viewer SUBJECT]")
+	}
+
+	files, err := collectFiles(paths, strings.Split(*exts, ","))
+	if err != nil {
+		return err
+	}
+	docs, err := loadCorpus(g.corpus)
+	if err != nil {
+		return err
+	}
+	store := &corpusStore{docs: docs}
+	pipeline, err := g.pipeline(nil)
+	if err != nil {
+		return err
+	}
+
+	var opts []rag.IngestOption
+	for _, o := range owners {
+		opts = append(opts, rag.WithOwner(o))
+	}
+	for _, v := range viewers {
+		opts = append(opts, rag.WithViewer(v))
+	}
+	// Documents ingested before a failure have their relationships
+	// written, so they are saved either way.
+	for _, f := range files {
+		doc, err := loadFile(ctx, f)
+		if err != nil {
+			return errors.Join(err, saveCorpus(g.corpus, store.docs))
+		}
+		doc.Metadata[rag.SpiceDBObjectKey] = g.resourceType + ":" + f.id
+		if _, err := pipeline.IngestDocument(ctx, store, doc, opts...); err != nil {
+			return errors.Join(fmt.Errorf("%s: %w", f.path, err), saveCorpus(g.corpus, store.docs))
+		}
+		fmt.Fprintf(out, "%s\t%s\n", doc.Metadata[rag.SpiceDBObjectKey], f.path)
+	}
+	return saveCorpus(g.corpus, store.docs)
+}
+
+// loadFile loads f with the loader for its extension, or as plain text
+// when there is none.
+func loadFile(ctx context.Context, f inputFile) (rag.Document, error) {
+	l, ok := loader.ForExtension(filepath.Ext(f.path))
+	if !ok {
+		l = loader.Text{}
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	defer file.Close()
+
+	doc, err := l.Load(ctx, file)
+	if err != nil {
+		return rag.Document{}, fmt.Errorf("%s: %w", f.path, err)
+	}
+	doc.ID = f.id
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]string)
+	}
+	doc.Metadata[loader.SourceKey] = f.path
+	return doc, nil
+}
+
+type inputFile struct {
+	path string
+	id   string
+}
+
+// collectFiles expands paths into the files to ingest. A file's ID is its
+// name, or its path below a directory argument, as loader.PathID makes
+// it: "docs/team/on call.md" given as "docs" becomes "team/on_call".
+func collectFiles(paths, exts []string) ([]inputFile, error) {
+	var files []inputFile
+	add := func(root, path string) {
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, inputFile{path: path, id: loader.PathID(filepath.ToSlash(rel))})
+	}
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(filepath.Dir(p), p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && slices.Contains(exts, filepath.Ext(path)) {
+				add(p, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// corpusStore is a rag.DocumentStore over the corpus file's documents,
+// which runIngest saves once all files are added.
+type corpusStore struct {
+	docs []rag.Document
+}
+
+func (s *corpusStore) Retrieve(_ context.Context, query string, limit int) ([]rag.Document, error) {
+	var out []rag.Document
+	for _, d := range s.docs {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		if strings.Contains(strings.ToLower(d.Text), strings.ToLower(query)) {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// Add replaces documents with the same ID, so files can be re-ingested.
+func (s *corpusStore) Add(_ context.Context, docs ...rag.Document) error {
+	for _, doc := range docs {
+		i := slices.IndexFunc(s.docs, func(d rag.Document) bool { return d.ID == doc.ID })
+		if i < 0 {
+			s.docs = append(s.docs, doc)
+		} else {
+			s.docs[i] = doc
+		}
+	}
+	return nil
+}
+
+func (s *corpusStore) Remove(_ context.Context, ids ...string) error {
+	s.docs = slices.DeleteFunc(s.docs, func(d rag.Document) bool { return slices.Contains(ids, d.ID) })
+	return nil
+}
+
+// corpusRecord is one line of the corpus file, in the format of
+// rag-demo's --corpus.
+type corpusRecord struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// loadCorpus reads the corpus file at path; a missing file is an empty
+// corpus.
+func loadCorpus(path string) ([]rag.Document, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var docs []rag.Document
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec corpusRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		docs = append(docs, rag.Document{ID: rec.ID, Text: rec.Text, Metadata: rec.Metadata})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return docs, nil
+}
+
+// saveCorpus replaces the corpus file at path with docs.
+func saveCorpus(path string, docs []rag.Document) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, d := range docs {
+		if err := enc.Encode(corpusRecord{ID: d.ID, Text: d.Text, Metadata: d.Metadata}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
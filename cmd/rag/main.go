@@ -0,0 +1,280 @@
+// Command rag indexes, queries and manages access to a SpiceDB-protected
+// corpus from the shell, for demos and ops tasks that should not need Go:
+//
+//	rag ingest ./docs --owner user:emilia
+//	rag query --as user:beatrice "playbook"
+//	rag acl grant document:doc2 viewer user:charlie
+//	rag acl grant --for 72h document:doc2 viewer user:dana
+//	rag acl revoke document:doc2 viewer user:charlie
+//	rag acl list document:doc2
+//	rag groups sync --scim https://idp.acme.com/scim/v2 --every 15m
+//
+// Documents are kept in a JSONL corpus file (--corpus, readable by
+// rag-demo's --corpus) and their relationships in the SpiceDB instance at
+// --endpoint, which must already have a schema. The endpoint and token
+// default to $SPICEDB_ENDPOINT and $SPICEDB_TOKEN. Reads are fully
+// consistent, so each command sees the writes of the previous one.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"github.com/authzed/grpcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+const usage = `usage: rag <command> [flags] [args]
+
+commands:
+  ingest PATH...                 add files, or the .txt, .md, .html and .pdf files under directories
+  query --as SUBJECT QUERY       run a query as SUBJECT, e.g. user:beatrice
+  acl grant [--for DURATION] OBJECT RELATION SUBJECT
+  acl revoke OBJECT RELATION SUBJECT
+  acl list OBJECT                show the relationships on OBJECT, e.g. document:doc2
+  groups sync --scim URL         mirror the groups of a SCIM service into SpiceDB
+
+Run "rag <command> -h" for the flags of a command.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "rag:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+	switch args[0] {
+	case "ingest":
+		return runIngest(ctx, args[1:], out)
+	case "query":
+		return runQuery(ctx, args[1:], out)
+	case "acl":
+		return runACL(ctx, args[1:], out)
+	case "groups":
+		return runGroups(ctx, args[1:], out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+// globals are the flags every command takes.
+type globals struct {
+	endpoint     string
+	token        string
+	plaintext    bool
+	corpus       string
+	resourceType string
+	permission   string
+}
+
+func (g *globals) register(fs *flag.FlagSet) {
+	endpoint := os.Getenv("SPICEDB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "localhost:50051"
+	}
+	fs.StringVar(&g.endpoint, "endpoint", endpoint, "SpiceDB gRPC endpoint")
+	fs.StringVar(&g.token, "token", os.Getenv("SPICEDB_TOKEN"), "SpiceDB preshared key or token")
+	fs.BoolVar(&g.plaintext, "plaintext", true, "connect without TLS")
+	fs.StringVar(&g.corpus, "corpus", "rag-corpus.jsonl", "JSONL file the corpus is kept in")
+	fs.StringVar(&g.resourceType, "resource-type", "document", "SpiceDB object type of documents")
+	fs.StringVar(&g.permission, "permission", "read", "permission checked on documents")
+}
+
+// pipeline connects to SpiceDB and returns a pipeline over docs.
+func (g *globals) pipeline(docs []rag.Document) (*rag.RAGPipeline, error) {
+	var opts []grpc.DialOption
+	if g.plaintext {
+		opts = append(opts,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpcutil.WithInsecureBearerToken(g.token),
+		)
+	} else {
+		certs, err := grpcutil.WithSystemCerts(grpcutil.VerifyCA)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, certs, grpcutil.WithBearerToken(g.token))
+	}
+	client, err := authzed.NewClient(g.endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", g.endpoint, err)
+	}
+	return rag.NewRAGPipeline(client, g.resourceType, g.permission, docs,
+		rag.WithDefaultConsistency(rag.FullyConsistent()),
+		rag.WithResultOrder(rag.ByScoreThenID)), nil
+}
+
+// docID turns an object given on the command line, "document:doc2" or
+// just "doc2", into a document ID.
+func (g *globals) docID(object string) (string, error) {
+	typ, id, ok := strings.Cut(object, ":")
+	if !ok {
+		return object, nil
+	}
+	if typ != g.resourceType {
+		return "", fmt.Errorf("object %q is not of type %q (see -resource-type)", object, g.resourceType)
+	}
+	return id, nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// parse parses args with fs, allowing flags after positional arguments
+// as in "rag ingest ./docs --owner user:emilia", and returns the
+// positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runQuery(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	var g globals
+	g.register(fs)
+	as := fs.String("as", "", `subject to query as, e.g. "user:beatrice" (required)`)
+	topK := fs.Int("top-k", 10, "maximum number of results")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *as == "" || len(positional) == 0 {
+		return errors.New(`usage: rag query --as SUBJECT QUERY`)
+	}
+
+	docs, err := loadCorpus(g.corpus)
+	if err != nil {
+		return err
+	}
+	pipeline, err := g.pipeline(docs)
+	if err != nil {
+		return err
+	}
+	results, err := pipeline.QueryAsSubject(ctx, *as, strings.Join(positional, " "), rag.WithTopK(*topK))
+	if err != nil {
+		return err
+	}
+	for _, d := range results {
+		fmt.Fprintf(out, "%s\t%s\n", d.ID, oneLine(d.Text, 80))
+	}
+	return nil
+}
+
+// oneLine shortens text to at most n runes on a single line.
+func oneLine(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return text
+}
+
+func runACL(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("acl", flag.ContinueOnError)
+	var g globals
+	g.register(fs)
+	grantFor := fs.Duration("for", 0, "make a grant expire after this long, e.g. 72h")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 {
+		return errors.New("usage: rag acl grant|revoke OBJECT RELATION SUBJECT, or rag acl list OBJECT")
+	}
+	op, id := positional[0], positional[1]
+	if id, err = g.docID(id); err != nil {
+		return err
+	}
+
+	docs, err := loadCorpus(g.corpus)
+	if err != nil {
+		return err
+	}
+	pipeline, err := g.pipeline(docs)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case "list":
+		if len(positional) != 2 {
+			return errors.New("usage: rag acl list OBJECT")
+		}
+		entries, err := pipeline.ListAccess(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			line := e.Relation + "\t" + e.Subject
+			if e.Caveat != "" {
+				line += "\t[" + e.Caveat + "]"
+			}
+			if !e.ExpiresAt.IsZero() {
+				line += "\tuntil " + e.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Fprintln(out, line)
+		}
+		return nil
+	case "grant", "revoke":
+		if len(positional) != 4 {
+			return fmt.Errorf("usage: rag acl %s OBJECT RELATION SUBJECT", op)
+		}
+		write := pipeline.GrantAccess
+		switch {
+		case op == "revoke":
+			write = pipeline.RevokeAccess
+		case *grantFor > 0:
+			until := time.Now().Add(*grantFor)
+			write = func(ctx context.Context, docID, relation, subject string) (*apiv1.ZedToken, error) {
+				return pipeline.GrantAccessUntil(ctx, docID, relation, subject, until)
+			}
+		}
+		_, err := write(ctx, id, positional[2], positional[3])
+		return err
+	default:
+		return fmt.Errorf("unknown acl operation %q", op)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestParseInterspersedFlags(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var owners stringList
+	fs.Var(&owners, "owner", "")
+	topK := fs.Int("top-k", 0, "")
+
+	args, err := parse(fs, []string{"./docs", "--owner", "user:emilia", "notes.md", "-top-k=3", "--owner=user:beatrice", "--", "-literal"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"./docs", "notes.md", "-literal"}, args)
+	require.Equal(t, stringList{"user:emilia", "user:beatrice"}, owners)
+	require.Equal(t, 3, *topK)
+
+	_, err = parse(fs, []string{"x", "--unknown"})
+	require.Error(t, err)
+}
+
+func TestCollectFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"doc1.md", "team/on call.txt", "image.png"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o644))
+	}
+
+	files, err := collectFiles([]string{dir, filepath.Join(dir, "image.png")}, []string{".txt", ".md"})
+	require.NoError(t, err)
+	ids := make([]string, len(files))
+	for i, f := range files {
+		ids[i] = f.id
+	}
+	require.Equal(t, []string{"doc1", "team/on_call", "image"}, ids)
+
+	for _, id := range ids {
+		_, err := rag.ParseObjectReference("document:" + id)
+		require.NoError(t, err, id)
+	}
+}
+
+func TestCorpusRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	docs, err := loadCorpus(path)
+	require.NoError(t, err)
+	require.Empty(t, docs, "a missing corpus is empty")
+
+	store := &corpusStore{}
+	require.NoError(t, store.Add(t.Context(),
+		rag.Document{ID: "doc1", Text: "old", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}},
+		rag.Document{ID: "doc2", Text: "two"},
+	))
+	require.NoError(t, store.Add(t.Context(), rag.Document{ID: "doc1", Text: "new"}))
+	require.NoError(t, saveCorpus(path, store.docs))
+
+	docs, err = loadCorpus(path)
+	require.NoError(t, err)
+	require.Equal(t, []rag.Document{{ID: "doc1", Text: "new"}, {ID: "doc2", Text: "two"}}, docs)
+}
+
+func TestDocID(t *testing.T) {
+	t.Parallel()
+
+	g := globals{resourceType: "document"}
+	for in, want := range map[string]string{"document:doc2": "doc2", "doc2": "doc2"} {
+		got, err := g.docID(in)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err := g.docID("folder:eng")
+	require.ErrorContains(t, err, "resource-type")
+}
@@ -0,0 +1,422 @@
+// Package confluence ingests the pages of Confluence spaces and mirrors
+// who may view each space into SpiceDB. A Client's Source feeds
+// loader.Ingest:
+//
+//	client := confluence.New("https://acme.atlassian.net/wiki",
+//		confluence.WithBasicAuth("bot@acme.com", os.Getenv("CONFLUENCE_TOKEN")))
+//	res, err := loader.Ingest(ctx, client.Source("ENG"), pipeline)
+//
+// A page's object is its space, "space:<key>", and the space's
+// permissions are written as that object's owner (space admins) and
+// viewer relationships with SetAccess, replacing those of an earlier
+// run. The schema needs a space definition the mapped subjects fit:
+//
+//	definition space {
+//	  relation owner: user | group#member
+//	  relation viewer: user | group#member
+//	  permission read = owner + viewer
+//	}
+//
+// Access is decided per space, so pages with view restrictions of their
+// own or of an ancestor are left out rather than shown to the whole
+// space. A pipeline configured WithChunker chunks pages as they are
+// added.
+package confluence
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// Metadata keys set on the documents.
+const (
+	SpaceKey   = "space"
+	PageIDKey  = "page_id"
+	VersionKey = "version"
+)
+
+// APIError is a non-2xx response from Confluence.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("confluence: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Subject is a user or group granted a space permission.
+type Subject struct {
+	// Type is "user" or "group".
+	Type string
+	// ID is a user's account ID, or username on Data Center, or a
+	// group's name.
+	ID string
+}
+
+// SubjectFunc maps a Confluence subject to the SpiceDB subject it
+// stands for, as "type:id" or "type:id#relation", reporting false for
+// subjects with none.
+type SubjectFunc func(s Subject) (string, bool)
+
+// DefaultSubject maps users to "user:<ID>" and groups to
+// "group:<ID>#member", with the IDs escaped by loader.EscapeID.
+func DefaultSubject(s Subject) (string, bool) {
+	switch s.Type {
+	case "user":
+		return "user:" + loader.EscapeID(s.ID), true
+	case "group":
+		return "group:" + loader.EscapeID(s.ID) + "#member", true
+	}
+	return "", false
+}
+
+// operations map space permissions to relations.
+var operations = map[string]string{
+	"administer": "owner",
+	"read":       "viewer",
+}
+
+// Client is a client of Confluence's REST API.
+type Client struct {
+	baseURL      string
+	auth         string
+	httpClient   *http.Client
+	resourceType string
+	subject      SubjectFunc
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBasicAuth authenticates as user with an API token, as Confluence
+// Cloud wants.
+func WithBasicAuth(user, apiToken string) Option {
+	return func(c *Client) {
+		c.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+apiToken))
+	}
+}
+
+// WithToken authenticates with a personal access token, as Confluence
+// Data Center wants.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.auth = "Bearer " + token
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithResourceType sets the type of the spaces' objects, "space" by
+// default.
+func WithResourceType(resourceType string) Option {
+	return func(c *Client) {
+		c.resourceType = resourceType
+	}
+}
+
+// WithSubjectFunc replaces DefaultSubject, e.g. to map account IDs to
+// the IDs of an identity provider.
+func WithSubjectFunc(fn SubjectFunc) Option {
+	return func(c *Client) {
+		c.subject = fn
+	}
+}
+
+// New returns a client of the Confluence at baseURL, e.g.
+// "https://acme.atlassian.net/wiki".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		resourceType: "space",
+		subject:      DefaultSubject,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Access returns the permissions of the space key as relationships on
+// its object. Anonymous access is left out.
+func (c *Client) Access(ctx context.Context, key string) (*loader.Access, error) {
+	var space struct {
+		Permissions []struct {
+			Operation struct {
+				Operation  string `json:"operation"`
+				TargetType string `json:"targetType"`
+			} `json:"operation"`
+			Subjects struct {
+				User struct {
+					Results []struct {
+						AccountID string `json:"accountId"`
+						Username  string `json:"username"`
+					} `json:"results"`
+				} `json:"user"`
+				Group struct {
+					Results []struct {
+						Name string `json:"name"`
+					} `json:"results"`
+				} `json:"group"`
+			} `json:"subjects"`
+		} `json:"permissions"`
+	}
+	if err := c.call(ctx, "/rest/api/space/"+url.PathEscape(key), url.Values{"expand": {"permissions"}}, &space); err != nil {
+		return nil, fmt.Errorf("confluence: reading space %s: %w", key, err)
+	}
+
+	access := &loader.Access{Relations: []string{"owner", "viewer"}}
+	granted := make(map[rag.ACLEntry]bool)
+	grant := func(rel string, s Subject) {
+		subject, ok := c.subject(s)
+		if !ok {
+			return
+		}
+		entry := rag.ACLEntry{Relation: rel, Subject: subject}
+		if !granted[entry] {
+			granted[entry] = true
+			access.Entries = append(access.Entries, entry)
+		}
+	}
+	for _, p := range space.Permissions {
+		rel, ok := operations[p.Operation.Operation]
+		if !ok || p.Operation.TargetType != "space" {
+			continue
+		}
+		for _, u := range p.Subjects.User.Results {
+			id := u.AccountID
+			if id == "" {
+				id = u.Username
+			}
+			if id != "" {
+				grant(rel, Subject{Type: "user", ID: id})
+			}
+		}
+		for _, g := range p.Subjects.Group.Results {
+			grant(rel, Subject{Type: "group", ID: g.Name})
+		}
+	}
+	return access, nil
+}
+
+// Page is a page of a space.
+type Page struct {
+	ID        string
+	Title     string
+	Version   int
+	Ancestors []string // titles, outermost first
+	WebURL    string
+	// Restricted reports view restrictions on the page itself; those of
+	// its ancestors apply too.
+	Restricted bool
+
+	ancestorIDs []string
+}
+
+// Pages yields the current pages of the space key, fetching a page of up
+// to 100 at a time.
+func (c *Client) Pages(ctx context.Context, key string) iter.Seq2[Page, error] {
+	return func(yield func(Page, error) bool) {
+		q := url.Values{
+			"spaceKey": {key},
+			"type":     {"page"},
+			"status":   {"current"},
+			"limit":    {"100"},
+			"expand":   {"ancestors,version,restrictions.read.restrictions.user,restrictions.read.restrictions.group"},
+		}
+		for start := 0; ; {
+			q.Set("start", strconv.Itoa(start))
+			var page struct {
+				Results []struct {
+					ID      string `json:"id"`
+					Title   string `json:"title"`
+					Version struct {
+						Number int `json:"number"`
+					} `json:"version"`
+					Ancestors []struct {
+						ID    string `json:"id"`
+						Title string `json:"title"`
+					} `json:"ancestors"`
+					Restrictions struct {
+						Read struct {
+							Restrictions struct {
+								User  struct{ Size int } `json:"user"`
+								Group struct{ Size int } `json:"group"`
+							} `json:"restrictions"`
+						} `json:"read"`
+					} `json:"restrictions"`
+					Links struct {
+						WebUI string `json:"webui"`
+					} `json:"_links"`
+				} `json:"results"`
+				Size  int `json:"size"`
+				Links struct {
+					Base string `json:"base"`
+					Next string `json:"next"`
+				} `json:"_links"`
+			}
+			if err := c.call(ctx, "/rest/api/content", q, &page); err != nil {
+				yield(Page{}, fmt.Errorf("confluence: listing pages of %s: %w", key, err))
+				return
+			}
+			for _, r := range page.Results {
+				p := Page{
+					ID:         r.ID,
+					Title:      r.Title,
+					Version:    r.Version.Number,
+					Restricted: r.Restrictions.Read.Restrictions.User.Size+r.Restrictions.Read.Restrictions.Group.Size > 0,
+				}
+				for _, a := range r.Ancestors {
+					p.Ancestors = append(p.Ancestors, a.Title)
+					p.ancestorIDs = append(p.ancestorIDs, a.ID)
+				}
+				if r.Links.WebUI != "" {
+					p.WebURL = page.Links.Base + r.Links.WebUI
+				}
+				if !yield(p, nil) {
+					return
+				}
+			}
+			if page.Links.Next == "" || len(page.Results) == 0 {
+				return
+			}
+			start += len(page.Results)
+		}
+	}
+}
+
+// Open returns the page id's body in Confluence's XHTML storage format.
+func (c *Client) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	var page struct {
+		Body struct {
+			Storage struct {
+				Value string `json:"value"`
+			} `json:"storage"`
+		} `json:"body"`
+	}
+	if err := c.call(ctx, "/rest/api/content/"+url.PathEscape(id), url.Values{"expand": {"body.storage"}}, &page); err != nil {
+		return nil, fmt.Errorf("confluence: reading page %s: %w", id, err)
+	}
+	return io.NopCloser(strings.NewReader(page.Body.Storage.Value)), nil
+}
+
+// Source returns a loader.Source over the pages of the space key, each
+// carrying the space's Access. A file's Path is its title below those
+// of its ancestors, e.g. "Handbook/Onboarding", and its ID the page ID.
+// Restricted pages and their descendants are left out.
+func (c *Client) Source(key string) loader.Source {
+	return source{client: c, key: key}
+}
+
+type source struct {
+	client *Client
+	key    string
+}
+
+func (s source) Files(ctx context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		access, err := s.client.Access(ctx, s.key)
+		if err != nil {
+			yield(loader.File{}, err)
+			return
+		}
+		// Listing the whole space first finds the restricted pages
+		// whatever order their descendants come in.
+		var pages []Page
+		restricted := make(map[string]bool)
+		for p, err := range s.client.Pages(ctx, s.key) {
+			if err != nil {
+				yield(loader.File{}, err)
+				return
+			}
+			pages = append(pages, p)
+			if p.Restricted {
+				restricted[p.ID] = true
+			}
+		}
+		for _, p := range pages {
+			if restricted[p.ID] || slices.ContainsFunc(p.ancestorIDs, func(id string) bool { return restricted[id] }) {
+				continue
+			}
+			var segments []string
+			for _, title := range append(slices.Clone(p.Ancestors), p.Title) {
+				segments = append(segments, strings.ReplaceAll(title, "/", "_"))
+			}
+			f := loader.File{
+				Path:     path.Join(segments...),
+				Location: p.WebURL,
+				Metadata: map[string]string{
+					rag.SpiceDBObjectKey: s.client.resourceType + ":" + loader.EscapeID(s.key),
+					loader.TitleKey:      p.Title,
+					SpaceKey:             s.key,
+					PageIDKey:            p.ID,
+					VersionKey:           strconv.Itoa(p.Version),
+				},
+				ID:     p.ID,
+				Loader: loader.HTML{},
+				Access: access,
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					return s.client.Open(ctx, p.ID)
+				},
+			}
+			if f.Location == "" {
+				f.Location = s.client.baseURL + "/pages/" + p.ID
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// call sends a GET for path with query q and decodes the JSON response
+// into out.
+func (c *Client) call(ctx context.Context, path string, q url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.auth != "" {
+		req.Header.Set("Authorization", c.auth)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		msg := http.StatusText(resp.StatusCode)
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil && body.Message != "" {
+			msg = body.Message
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
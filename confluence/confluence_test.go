@@ -0,0 +1,211 @@
+package confluence_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/confluence"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+type page struct {
+	id, title, body string
+	ancestors       []string // IDs
+	restricted      bool
+}
+
+// pages are listed in this order, a restricted page's child first.
+var pages = []page{
+	{id: "4", title: "Salaries", body: "<p>Secret.</p>", ancestors: []string{"1", "3"}},
+	{id: "1", title: "Handbook", body: "<h1>Handbook</h1><p>Welcome.</p>"},
+	{id: "2", title: "On/boarding", body: "<p>Get a laptop.</p>", ancestors: []string{"1"}},
+	{id: "3", title: "HR only", body: "<p>Private.</p>", ancestors: []string{"1"}, restricted: true},
+}
+
+func titleOf(id string) string {
+	for _, p := range pages {
+		if p.id == id {
+			return p.title
+		}
+	}
+	return ""
+}
+
+// fakeConfluence serves the space ENG with its permissions, its pages
+// two at a time, and their bodies.
+func fakeConfluence(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "bot@acme.com" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"statusCode": 401, "message": "Client must be authenticated to access this resource."})
+			return
+		}
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/wiki/rest/api/space/ENG" && q.Get("expand") == "permissions":
+			users := func(ids ...string) map[string]any {
+				var results []map[string]string
+				for _, id := range ids {
+					results = append(results, map[string]string{"accountId": id})
+				}
+				return map[string]any{"user": map[string]any{"results": results, "size": len(results)}}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"key": "ENG", "permissions": []map[string]any{
+				{"operation": map[string]string{"operation": "administer", "targetType": "space"}, "subjects": users("557058:emilia")},
+				{"operation": map[string]string{"operation": "read", "targetType": "space"}, "subjects": users("557058:emilia", "beatrice")},
+				{"operation": map[string]string{"operation": "read", "targetType": "space"}, "subjects": map[string]any{
+					"group": map[string]any{"results": []map[string]string{{"name": "eng team"}}, "size": 1},
+				}},
+				{"operation": map[string]string{"operation": "create", "targetType": "page"}, "subjects": users("carl")},
+				{"operation": map[string]string{"operation": "read", "targetType": "space"}, "anonymousAccess": true},
+			}})
+		case r.URL.Path == "/wiki/rest/api/content" && q.Get("spaceKey") == "ENG":
+			start, _ := strconv.Atoi(q.Get("start"))
+			end := min(start+2, len(pages))
+			var results []map[string]any
+			for _, p := range pages[start:end] {
+				var ancestors []map[string]string
+				for _, id := range p.ancestors {
+					ancestors = append(ancestors, map[string]string{"id": id, "title": titleOf(id)})
+				}
+				size := 0
+				if p.restricted {
+					size = 1
+				}
+				results = append(results, map[string]any{
+					"id": p.id, "title": p.title, "version": map[string]int{"number": 3}, "ancestors": ancestors,
+					"restrictions": map[string]any{"read": map[string]any{"restrictions": map[string]any{
+						"user": map[string]int{"size": size}, "group": map[string]int{"size": 0},
+					}}},
+					"_links": map[string]string{"webui": "/spaces/ENG/pages/" + p.id},
+				})
+			}
+			links := map[string]string{"base": "https://acme.atlassian.net/wiki"}
+			if end < len(pages) {
+				links["next"] = "/rest/api/content?start=" + strconv.Itoa(end)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": results, "size": len(results), "_links": links})
+		case strings.HasPrefix(r.URL.Path, "/wiki/rest/api/content/") && q.Get("expand") == "body.storage":
+			id := strings.TrimPrefix(r.URL.Path, "/wiki/rest/api/content/")
+			for _, p := range pages {
+				if p.id == id {
+					_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "body": map[string]any{"storage": map[string]string{"value": p.body}}})
+					return
+				}
+			}
+			fallthrough
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"statusCode": 404, "message": "No space with key : " + strings.TrimPrefix(r.URL.Path, "/wiki/rest/api/space/")})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// accessIngester records documents and the access set on them.
+type accessIngester struct {
+	docs   []rag.Document
+	access map[string][]rag.ACLEntry
+}
+
+func (a *accessIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	a.docs = append(a.docs, doc)
+	return nil, nil
+}
+
+func (a *accessIngester) SetAccess(_ context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	if a.access == nil {
+		a.access = make(map[string][]rag.ACLEntry)
+	}
+	a.access[object+" "+strings.Join(relations, ",")] = entries
+	return &apiv1.ZedToken{Token: "t-" + object}, nil
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	client := confluence.New(fakeConfluence(t).URL+"/wiki", confluence.WithBasicAuth("bot@acme.com", "secret"))
+	dst := &accessIngester{}
+	res, err := loader.Ingest(context.Background(), client.Source("ENG"), dst)
+	require.NoError(t, err)
+	require.Equal(t, "t-space:ENG", res.Token.GetToken())
+
+	var paths []string
+	for _, doc := range res.Documents {
+		paths = append(paths, doc.ID+" "+doc.Metadata[loader.TitleKey])
+	}
+	require.Equal(t, []string{"1 Handbook", "2 On/boarding"}, paths, "restricted pages and their descendants are left out")
+
+	onboarding := res.Documents[1]
+	require.Equal(t, "Get a laptop.", onboarding.Text)
+	require.Equal(t, map[string]string{
+		rag.SpiceDBObjectKey:  "space:ENG",
+		loader.TitleKey:       "On/boarding",
+		loader.FormatKey:      "html",
+		loader.SourceKey:      "https://acme.atlassian.net/wiki/spaces/ENG/pages/2",
+		confluence.SpaceKey:   "ENG",
+		confluence.PageIDKey:  "2",
+		confluence.VersionKey: "3",
+	}, onboarding.Metadata)
+
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"space:ENG owner,viewer": {
+			{Relation: "owner", Subject: "user:557058=3aemilia"},
+			{Relation: "viewer", Subject: "user:557058=3aemilia"},
+			{Relation: "viewer", Subject: "user:beatrice"},
+			{Relation: "viewer", Subject: "group:eng=20team#member"},
+		},
+	}, dst.access, "page permissions and anonymous access are left out")
+}
+
+func TestPathsAndSubjects(t *testing.T) {
+	t.Parallel()
+
+	client := confluence.New(fakeConfluence(t).URL+"/wiki", confluence.WithBasicAuth("bot@acme.com", "secret"),
+		confluence.WithResourceType("wiki_space"),
+		confluence.WithSubjectFunc(func(s confluence.Subject) (string, bool) {
+			if s.Type == "group" {
+				return "", false
+			}
+			return "user:" + strings.TrimPrefix(s.ID, "557058:"), true
+		}))
+	dst := &accessIngester{}
+	res, err := loader.Ingest(context.Background(), client.Source("ENG"), dst, loader.WithInclude("Handbook/On_boarding"))
+	require.NoError(t, err)
+	require.Len(t, res.Documents, 1)
+	require.Equal(t, "Get a laptop.", res.Documents[0].Text)
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"wiki_space:ENG owner,viewer": {
+			{Relation: "owner", Subject: "user:emilia"},
+			{Relation: "viewer", Subject: "user:emilia"},
+			{Relation: "viewer", Subject: "user:beatrice"},
+		},
+	}, dst.access)
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeConfluence(t)
+	_, err := loader.Ingest(context.Background(), confluence.New(srv.URL+"/wiki").Source("ENG"), &accessIngester{})
+	var apiErr *confluence.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	_, err = confluence.New(srv.URL+"/wiki", confluence.WithBasicAuth("bot@acme.com", "secret")).Access(context.Background(), "OPS")
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Contains(t, apiErr.Message, "OPS")
+}
@@ -0,0 +1,46 @@
+package rag
+
+import apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+// MinimizeLatency lets SpiceDB answer from whichever revision is cheapest,
+// typically a cached one a few seconds old. It is SpiceDB's default.
+func MinimizeLatency() *apiv1.Consistency {
+	return &apiv1.Consistency{
+		Requirement: &apiv1.Consistency_MinimizeLatency{MinimizeLatency: true},
+	}
+}
+
+// FullyConsistent makes SpiceDB answer at its newest revision, bypassing
+// caches. It is the most expensive choice.
+func FullyConsistent() *apiv1.Consistency {
+	return &apiv1.Consistency{
+		Requirement: &apiv1.Consistency_FullyConsistent{FullyConsistent: true},
+	}
+}
+
+// AtLeastAsFresh makes SpiceDB answer at a revision no older than token,
+// such as the WrittenAt token of a relationship write. This gives
+// read-your-writes without paying for full consistency.
+func AtLeastAsFresh(token *apiv1.ZedToken) *apiv1.Consistency {
+	return &apiv1.Consistency{
+		Requirement: &apiv1.Consistency_AtLeastAsFresh{AtLeastAsFresh: token},
+	}
+}
+
+// WithDefaultConsistency sets the consistency of permission checks and
+// lookups for queries that do not choose their own. Without it SpiceDB's
+// default, MinimizeLatency, applies.
+func WithDefaultConsistency(c *apiv1.Consistency) Option {
+	return func(r *RAGPipeline) {
+		r.consistency = c
+	}
+}
+
+// consistencyFor returns the consistency a query asked for, falling back
+// to the pipeline default.
+func (r *RAGPipeline) consistencyFor(c *apiv1.Consistency) *apiv1.Consistency {
+	if c != nil {
+		return c
+	}
+	return r.consistency
+}
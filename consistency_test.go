@@ -0,0 +1,92 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func requireConsistencies(t *testing.T, want *apiv1.Consistency, got []*apiv1.Consistency) {
+	t.Helper()
+	require.NotEmpty(t, got)
+	for _, c := range got {
+		require.True(t, proto.Equal(want, c), "got consistency %v, want %v", c, want)
+	}
+}
+
+func TestQueryConsistency(t *testing.T) {
+	t.Parallel()
+
+	token := &apiv1.ZedToken{Token: "written-at"}
+	tests := []struct {
+		name     string
+		pipeline []rag.Option
+		query    []rag.QueryOption
+		want     *apiv1.Consistency
+	}{
+		{name: "spicedb default", want: nil},
+		{name: "pipeline default", pipeline: []rag.Option{rag.WithDefaultConsistency(rag.FullyConsistent())}, want: rag.FullyConsistent()},
+		{name: "per query", query: []rag.QueryOption{rag.WithConsistency(rag.AtLeastAsFresh(token))}, want: rag.AtLeastAsFresh(token)},
+		{name: "at least as fresh", query: []rag.QueryOption{rag.WithAtLeastAsFresh(token)}, want: rag.AtLeastAsFresh(token)},
+		{
+			name:     "no token keeps default",
+			pipeline: []rag.Option{rag.WithDefaultConsistency(rag.FullyConsistent())},
+			query:    []rag.QueryOption{rag.WithAtLeastAsFresh(nil)},
+			want:     rag.FullyConsistent(),
+		},
+		{
+			name:     "per query overrides default",
+			pipeline: []rag.Option{rag.WithDefaultConsistency(rag.FullyConsistent())},
+			query:    []rag.QueryOption{rag.WithConsistency(rag.MinimizeLatency())},
+			want:     rag.MinimizeLatency(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+				client, fake := newFakeClient()
+				opts := append([]rag.Option{rag.WithFilterStrategy(strategy)}, tt.pipeline...)
+				pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3), opts...)
+
+				_, err := pipeline.Query(context.Background(), "emilia", "synthetic", tt.query...)
+				require.NoError(t, err)
+				requireConsistencies(t, tt.want, fake.consistencies())
+			}
+		})
+	}
+}
+
+func TestDoConsistency(t *testing.T) {
+	t.Parallel()
+
+	token := &apiv1.ZedToken{Token: "written-at"}
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+
+	_, err := pipeline.Do(context.Background(), rag.QueryRequest{
+		UserID:      "emilia",
+		Query:       "synthetic",
+		Consistency: rag.AtLeastAsFresh(token),
+	})
+	require.NoError(t, err)
+	requireConsistencies(t, rag.AtLeastAsFresh(token), fake.consistencies())
+}
+
+func TestSuggestUsesDefaultConsistency(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithDefaultConsistency(rag.FullyConsistent()))
+
+	_, err := pipeline.Suggest(context.Background(), "emilia", "syn", 5)
+	require.NoError(t, err)
+	requireConsistencies(t, rag.FullyConsistent(), fake.consistencies())
+}
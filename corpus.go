@@ -0,0 +1,182 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+var (
+	// ErrDuplicateDocument is returned by AddDocuments for an ID that is
+	// already in the corpus or repeated in the call.
+	ErrDuplicateDocument = errors.New("rag: duplicate document ID")
+
+	// ErrDocumentNotFound is returned by UpdateDocument for an unknown ID.
+	ErrDocumentNotFound = errors.New("rag: document not found")
+)
+
+// The corpus is copy-on-write: mutators build a new slice and swap it in
+// under r.mu, so readers can keep scanning a snapshot without holding the
+// lock.
+
+// snapshot returns the current documents. The slice must not be modified.
+func (r *RAGPipeline) snapshot() []Document {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.docs
+}
+
+// applyLocked replaces documents in put that already exist (in place),
+// appends the others, and drops every document whose ID is in remove.
+// The caller must hold r.mu for writing.
+func (r *RAGPipeline) applyLocked(put []Document, remove map[string]struct{}) {
+	pending := make(map[string]int, len(put))
+	for i, d := range put {
+		pending[d.ID] = i
+	}
+	replaced := make(map[string]bool, len(put))
+
+	next := make([]Document, 0, len(r.docs)+len(put))
+	largest := 0
+	keep := func(d Document) {
+		next = append(next, d)
+		largest = max(largest, len(d.Text))
+	}
+
+	for _, d := range r.docs {
+		if _, ok := remove[d.ID]; ok {
+			continue
+		}
+		if i, ok := pending[d.ID]; ok {
+			d = put[i]
+			replaced[d.ID] = true
+		}
+		keep(d)
+	}
+	for _, d := range put {
+		if !replaced[d.ID] {
+			keep(d)
+		}
+	}
+
+	r.docs = next
+	r.largestDocument = largest
+}
+
+// AddDocuments adds docs to the corpus. It is all or nothing: if any
+// document is a duplicate or fails ingestion limits (see
+// WithMaxDocumentBytes and WithStrictMapping), none are added. Queries
+// running concurrently see either the old corpus or the new one.
+//
+// Documents added here are only searched by the built-in retrieval; a
+// Retriever set with WithRetriever maintains its own index.
+func (r *RAGPipeline) AddDocuments(docs ...Document) error {
+	seen := make(map[string]bool, len(docs))
+	var put []Document
+	for _, d := range docs {
+		if seen[d.ID] {
+			return fmt.Errorf("%w: %q", ErrDuplicateDocument, d.ID)
+		}
+		seen[d.ID] = true
+		admitted, err := r.ingest(d)
+		if err != nil {
+			return err
+		}
+		put = append(put, admitted...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.docs {
+		if id := r.sourceID(d); seen[id] {
+			return fmt.Errorf("%w: %q", ErrDuplicateDocument, id)
+		}
+	}
+	for id := range seen {
+		if r.reserved[id] {
+			// AddDocument is adding it.
+			return fmt.Errorf("%w: %q", ErrDuplicateDocument, id)
+		}
+	}
+	r.applyLocked(put, nil)
+	return nil
+}
+
+// UpdateDocument replaces the document with doc's ID, keeping its
+// position in the corpus. With a chunker, all of the document's chunks
+// are replaced.
+func (r *RAGPipeline) UpdateDocument(doc Document) error {
+	put, err := r.ingest(doc)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(put))
+	for _, d := range put {
+		keep[d.ID] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := false
+	remove := make(map[string]struct{})
+	for _, d := range r.docs {
+		if r.sourceID(d) != doc.ID {
+			continue
+		}
+		found = true
+		if !keep[d.ID] {
+			remove[d.ID] = struct{}{}
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %q", ErrDocumentNotFound, doc.ID)
+	}
+	r.applyLocked(put, remove)
+	return nil
+}
+
+// RemoveDocuments removes the documents with the given IDs, including all
+// chunks of those documents, and returns how many corpus entries were
+// removed. Unknown IDs are ignored. Relationships in SpiceDB are left
+// alone; see RemoveDocumentsAndRelationships for that.
+func (r *RAGPipeline) RemoveDocuments(ids ...string) int {
+	return len(r.removeDocuments(ids))
+}
+
+// RemoveDocumentsAndRelationships is RemoveDocuments followed by deleting
+// all relationships on the removed documents' SpiceDB objects, so stale
+// tuples do not accumulate for documents that no longer exist. Objects
+// still referenced by a document left in the corpus keep their
+// relationships. It returns the number of corpus entries removed and of
+// objects purged, and the revision of the last deletion, nil if nothing
+// was purged, to query at with WithAtLeastAsFresh. The documents stay
+// removed if purging fails.
+func (r *RAGPipeline) RemoveDocumentsAndRelationships(ctx context.Context, ids ...string) (removed, purged int, token *apiv1.ZedToken, err error) {
+	docs := r.removeDocuments(ids)
+	purged, token, err = r.purgeRelationships(ctx, docs)
+	return len(docs), purged, token, err
+}
+
+// removeDocuments removes the documents with the given IDs and their
+// chunks, and returns the removed corpus entries.
+func (r *RAGPipeline) removeDocuments(ids []string) []Document {
+	targets := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		targets[id] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var removed []Document
+	remove := make(map[string]struct{})
+	for _, d := range r.docs {
+		if targets[d.ID] || targets[r.sourceID(d)] {
+			remove[d.ID] = struct{}{}
+			removed = append(removed, d)
+		}
+	}
+	r.applyLocked(nil, remove)
+	return removed
+}
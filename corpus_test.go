@@ -0,0 +1,129 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func allowAll(n int) []string {
+	allowed := make([]string, n)
+	for i := range allowed {
+		allowed[i] = fmt.Sprintf("document:doc%d#read@user:emilia", i)
+	}
+	return allowed
+}
+
+func TestAddUpdateRemoveDocuments(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient(allowAll(5)...)
+	docs := syntheticCorpus(5)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs[:2])
+
+	require.NoError(t, pipeline.AddDocuments(docs[2:]...))
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0", "doc1", "doc2", "doc3", "doc4"}, results)
+
+	updated := docs[1]
+	updated.Text = "rewritten"
+	require.NoError(t, pipeline.UpdateDocument(updated))
+	results, err = pipeline.Query(context.Background(), "emilia", "rewritten")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	require.Equal(t, 2, pipeline.RemoveDocuments("doc0", "doc4", "missing"))
+	results, err = pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2", "doc3"}, results)
+}
+
+func TestAddDocumentsIsAllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient(allowAll(5)...)
+	docs := syntheticCorpus(5)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs[:2], rag.WithMaxDocumentBytes(64))
+
+	err := pipeline.AddDocuments(docs[2], docs[0])
+	require.ErrorIs(t, err, rag.ErrDuplicateDocument)
+
+	err = pipeline.AddDocuments(docs[2], docs[2])
+	require.ErrorIs(t, err, rag.ErrDuplicateDocument)
+
+	big := rag.Document{ID: "big", Text: strings.Repeat("x", 65)}
+	err = pipeline.AddDocuments(docs[3], big)
+	require.ErrorIs(t, err, rag.ErrDocumentTooLarge)
+
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0", "doc1"}, results)
+}
+
+func TestUpdateDocumentErrors(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(1), rag.WithMaxDocumentBytes(64))
+
+	require.ErrorIs(t, pipeline.UpdateDocument(rag.Document{ID: "missing"}), rag.ErrDocumentNotFound)
+	require.ErrorIs(t, pipeline.UpdateDocument(rag.Document{ID: "doc0", Text: strings.Repeat("x", 65)}), rag.ErrDocumentTooLarge)
+}
+
+func TestMutationsDuringQueries(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient(allowAll(200)...)
+	docs := syntheticCorpus(200)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs[:100])
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+				if err != nil || len(results) < 99 {
+					t.Errorf("concurrent query: %d results, err %v", len(results), err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 100; i < 200; i++ {
+		require.NoError(t, pipeline.AddDocuments(docs[i]))
+		require.Equal(t, 1, pipeline.RemoveDocuments(docs[i-100].ID))
+	}
+	wg.Wait()
+
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.Len(t, results, 100)
+	require.Equal(t, "doc100", results[0].ID)
+}
+
+func TestRemoveDocumentsAndRelationships(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia", "document:doc3#read@user:emilia")
+	docs := append(scenarioDocs(), rag.Document{ID: "doc3-appendix", Text: "appendix", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc3"}})
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithChunker(rag.FixedSizeChunker{Size: 20}))
+
+	removed, purged, token, err := pipeline.RemoveDocumentsAndRelationships(ctx, "doc1", "doc3", "missing")
+	require.NoError(t, err)
+	require.Equal(t, "fake-revision", token.GetToken())
+	require.Equal(t, 3+2, removed, "the chunks of doc1 and doc3")
+	// doc3-appendix still maps to document:doc3.
+	require.Equal(t, 1, purged)
+	require.Equal(t, []string{"document:doc1"}, fake.deletedObjects())
+	require.Equal(t, []string{"document:doc3#read@user:emilia"}, fake.tuples())
+}
@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"context"
+)
+
+// AccessDiff compares what two subjects can read, as reported by
+// DiffAccess. Documents are identified by ID, in result order.
+type AccessDiff struct {
+	// OnlyA holds the documents the first subject can read and the
+	// second cannot.
+	OnlyA []string
+
+	// OnlyB holds the documents the second subject can read and the
+	// first cannot.
+	OnlyB []string
+
+	// Both counts the documents both subjects can read.
+	Both int
+}
+
+// DiffAccess runs query for subjects a and b, given as "type:id" or
+// "type:id#relation", e.g. "user:emilia" or "group:eng#member", and
+// reports which documents one can read and the other cannot. An empty
+// query compares the whole corpus, or whatever the pipeline's Retriever
+// returns for it. Access reviewers use it to validate a schema change or
+// to check that two roles differ only where they should.
+//
+// opts apply to both queries, except that TopK and paging are ignored so
+// every result is compared. Under WithShadowMode the documents enforcement
+// would withhold do not count as readable.
+func (r *RAGPipeline) DiffAccess(ctx context.Context, a, b, query string, opts ...QueryOption) (*AccessDiff, error) {
+	qc := newQueryConfig(opts)
+	var readable [2][]string
+	for i, subject := range []string{a, b} {
+		ref, err := ParseSubjectReference(subject)
+		if err != nil {
+			return nil, err
+		}
+		req := qc.request(ref.GetObject().GetObjectId(), query)
+		req.SubjectType, req.SubjectRelation = ref.GetObject().GetObjectType(), ref.GetOptionalRelation()
+		req.TopK, req.PageSize, req.Cursor = 0, 0, ""
+		resp, err := r.do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range resp.Results {
+			if res.Decision == DecisionAllowed {
+				readable[i] = append(readable[i], res.Document.ID)
+			}
+		}
+	}
+
+	inA := make(map[string]bool, len(readable[0]))
+	for _, id := range readable[0] {
+		inA[id] = true
+	}
+	diff := &AccessDiff{}
+	inB := make(map[string]bool, len(readable[1]))
+	for _, id := range readable[1] {
+		inB[id] = true
+		if inA[id] {
+			diff.Both++
+		} else {
+			diff.OnlyB = append(diff.OnlyB, id)
+		}
+	}
+	for _, id := range readable[0] {
+		if !inB[id] {
+			diff.OnlyA = append(diff.OnlyA, id)
+		}
+	}
+	return diff, nil
+}
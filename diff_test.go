@@ -0,0 +1,39 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestDiffAccess(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient(
+		"document:doc1#read@user:emilia", "document:doc2#read@user:emilia",
+		"document:doc2#read@user:beatrice", "document:doc3#read@group:eng#member",
+	)
+	for _, opts := range [][]rag.Option{
+		{rag.WithFilterStrategy(rag.FilterPostCheck)},
+		{rag.WithFilterStrategy(rag.FilterPrefilter)},
+		{rag.WithShadowMode()},
+	} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), opts...)
+
+		diff, err := pipeline.DiffAccess(ctx, "user:emilia", "user:beatrice", "", rag.WithTopK(1))
+		require.NoError(t, err)
+		require.Equal(t, &rag.AccessDiff{OnlyA: []string{"doc1"}, Both: 1}, diff)
+
+		diff, err = pipeline.DiffAccess(ctx, "user:beatrice", "group:eng#member", "")
+		require.NoError(t, err)
+		require.Equal(t, &rag.AccessDiff{OnlyA: []string{"doc2"}, OnlyB: []string{"doc3"}}, diff)
+	}
+
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+	_, err := pipeline.DiffAccess(ctx, "emilia", "user:beatrice", "")
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+}
@@ -0,0 +1,125 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxDocumentBytes is the per-document size limit applied when
+// WithMaxDocumentBytes is not used.
+const DefaultMaxDocumentBytes = 16 << 20
+
+// foldScanThreshold is the document size above which retrieval matches
+// case-insensitively in place instead of building a lowercase copy.
+const foldScanThreshold = 64 << 10
+
+// ErrDocumentTooLarge is wrapped by DocumentTooLargeError.
+var ErrDocumentTooLarge = errors.New("rag: document too large")
+
+// DocumentTooLargeError reports a document rejected at ingestion because
+// its text exceeds the configured limit.
+type DocumentTooLargeError struct {
+	ID    string
+	Size  int
+	Limit int
+}
+
+func (e *DocumentTooLargeError) Error() string {
+	return fmt.Sprintf("rag: document %q is %d bytes, limit is %d", e.ID, e.Size, e.Limit)
+}
+
+func (e *DocumentTooLargeError) Unwrap() error {
+	return ErrDocumentTooLarge
+}
+
+// RejectedDocument records a document that was refused at ingestion.
+type RejectedDocument struct {
+	ID  string
+	Err error
+}
+
+// WithMaxDocumentBytes limits the size of a document's Text. Larger
+// documents are rejected at ingestion and listed by Rejected. n <= 0 keeps
+// DefaultMaxDocumentBytes.
+func WithMaxDocumentBytes(n int) Option {
+	return func(r *RAGPipeline) {
+		if n > 0 {
+			r.maxDocumentBytes = n
+		}
+	}
+}
+
+// Rejected lists the documents refused at ingestion, in ingestion order.
+func (r *RAGPipeline) Rejected() []RejectedDocument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RejectedDocument(nil), r.rejected...)
+}
+
+// admit checks d against the ingestion limits.
+func (r *RAGPipeline) admit(d Document) error {
+	if len(d.Text) > r.maxDocumentBytes {
+		return &DocumentTooLargeError{ID: d.ID, Size: len(d.Text), Limit: r.maxDocumentBytes}
+	}
+	return nil
+}
+
+// matcher is a prepared case-insensitive substring query.
+type matcher struct {
+	lower string
+	runes []rune
+}
+
+func newMatcher(query string) matcher {
+	lower := strings.ToLower(query)
+	return matcher{lower: lower, runes: []rune(lower)}
+}
+
+// match reports whether text contains the query, ignoring case. Small
+// texts are lowercased wholesale; large ones are scanned in place so a
+// single huge document does not allocate a second copy of itself on every
+// query.
+func (m matcher) match(text string) bool {
+	if len(text) <= foldScanThreshold {
+		return strings.Contains(strings.ToLower(text), m.lower)
+	}
+	return indexFold(text, m.runes) >= 0
+}
+
+// indexFold returns the byte offset in text of the first occurrence of the
+// lowercased query runes, comparing rune by rune with unicode.ToLower, or
+// -1. It matches exactly where strings.Contains(strings.ToLower(text), q)
+// would, without allocating.
+func indexFold(text string, lq []rune) int {
+	if len(lq) == 0 {
+		return 0
+	}
+	for i := 0; i < len(text); {
+		if prefixFoldLen(text[i:], lq) >= 0 {
+			return i
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return -1
+}
+
+// prefixFoldLen returns the length in bytes of the prefix of s that
+// matches the lowercased query runes, or -1 if s does not start with them.
+func prefixFoldLen(s string, lq []rune) int {
+	n := 0
+	for _, want := range lq {
+		if n == len(s) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if unicode.ToLower(r) != want {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package rag
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexFoldMatchesLowercaseContains(t *testing.T) {
+	t.Parallel()
+
+	alphabet := []rune("aAbBzZ İıKkK ßẞΣσς\xff")
+	rng := rand.New(rand.NewSource(1))
+	randString := func(n int) string {
+		var sb strings.Builder
+		for range n {
+			sb.WriteRune(alphabet[rng.Intn(len(alphabet))])
+		}
+		return sb.String()
+	}
+
+	for range 20000 {
+		text := randString(rng.Intn(24))
+		query := randString(rng.Intn(4))
+		lq := strings.ToLower(query)
+
+		want := strings.Contains(strings.ToLower(text), lq)
+		got := indexFold(text, []rune(lq)) >= 0
+		require.Equal(t, want, got, "text=%q query=%q", text, query)
+	}
+}
+
+func TestIndexFoldOffsets(t *testing.T) {
+	t.Parallel()
+
+	lq := []rune("roadmap")
+	require.Equal(t, 9, indexFold("Internal ROADMAP", lq))
+	require.Equal(t, -1, indexFold("Internal road map", lq))
+	require.Equal(t, 0, indexFold("anything", nil))
+	// Offsets are into the original text, not a lowercased copy.
+	require.Equal(t, len("ẞẞ "), indexFold("ẞẞ RoadMap", lq))
+}
+
+func TestMatcherLargeDocument(t *testing.T) {
+	t.Parallel()
+
+	text := strings.Repeat("filler text ", foldScanThreshold/8) + "Highly CONFIDENTIAL"
+	require.Greater(t, len(text), foldScanThreshold)
+
+	m := newMatcher("confidential")
+	require.True(t, m.match(text))
+	require.False(t, newMatcher("public").match(text))
+}
+
+func BenchmarkMatchLargeDocument(b *testing.B) {
+	text := strings.Repeat("Lorem ipsum dolor sit amet. ", (8<<20)/28)
+	m := newMatcher("not present anywhere")
+
+	b.Run("lowercase copy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(text)))
+		for b.Loop() {
+			_ = strings.Contains(strings.ToLower(text), m.lower)
+		}
+	})
+
+	b.Run("in place", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(text)))
+		for b.Loop() {
+			_ = m.match(text)
+		}
+	})
+}
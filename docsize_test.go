@@ -0,0 +1,62 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestMaxDocumentBytes(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{
+		{ID: "small", Text: "public faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:small"}},
+		{ID: "huge", Text: "public " + strings.Repeat("x", 100), Metadata: map[string]string{rag.SpiceDBObjectKey: "document:huge"}},
+	}
+
+	client, _ := newFakeClient("document:small#read@user:emilia", "document:huge#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithMaxDocumentBytes(64))
+
+	rejected := pipeline.Rejected()
+	require.Len(t, rejected, 1)
+	require.Equal(t, "huge", rejected[0].ID)
+	require.ErrorIs(t, rejected[0].Err, rag.ErrDocumentTooLarge)
+
+	var tooLarge *rag.DocumentTooLargeError
+	require.True(t, errors.As(rejected[0].Err, &tooLarge))
+	require.Equal(t, 107, tooLarge.Size)
+	require.Equal(t, 64, tooLarge.Limit)
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "public", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"small"}, results)
+	require.Equal(t, len("public faq"), stats.LargestDocumentBytes)
+}
+
+func TestLargeDocumentRetrieval(t *testing.T) {
+	t.Parallel()
+
+	big := strings.Repeat("Lorem ipsum dolor sit amet. ", 1<<16) + "Internal ROADMAP"
+	docs := []rag.Document{
+		{ID: "big", Text: big, Metadata: map[string]string{rag.SpiceDBObjectKey: "document:big"}},
+	}
+
+	client, _ := newFakeClient("document:big#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "roadmap", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"big"}, results)
+	require.Equal(t, len(big), stats.LargestDocumentBytes)
+
+	results, err = pipeline.Query(context.Background(), "emilia", "confidential")
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
@@ -0,0 +1,412 @@
+// Package elasticsearch is a rag.DocumentStore backed by an Elasticsearch
+// or OpenSearch index, talking to their REST APIs. It ranks by full-text
+// relevance and, with an Embedder configured, by kNN vector similarity as
+// well, so existing search clusters can sit behind the pipeline's SpiceDB
+// filtering. Package elasticsearchtest starts Elasticsearch in a
+// container.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// MaxSearchLimit is the number of hits requested when a search has no
+// limit. It matches the default index.max_result_window.
+const MaxSearchLimit = 10000
+
+// Field names in the index mapping.
+const (
+	fieldDocID     = "doc_id"
+	fieldText      = "text"
+	fieldMetadata  = "metadata"
+	fieldObject    = "spicedb_object"
+	fieldEmbedding = "embedding"
+)
+
+// APIError is a non-2xx response, or a failed bulk item, from the
+// cluster.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("elasticsearch: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Store is a rag.DocumentStore, rag.ScoredRetriever and
+// rag.FilteringRetriever over one index. Scores are the cluster's _score.
+type Store struct {
+	baseURL    string
+	index      string
+	embedder   rag.Embedder
+	dims       int
+	openSearch bool
+	auth       func(*http.Request)
+	httpClient *http.Client
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithEmbedder adds kNN retrieval over dims-dimensional embeddings from
+// e. Searches then combine full-text and vector relevance.
+func WithEmbedder(e rag.Embedder, dims int) Option {
+	return func(s *Store) {
+		s.embedder, s.dims = e, dims
+	}
+}
+
+// WithOpenSearch switches to OpenSearch's mapping and kNN query syntax,
+// which differ from Elasticsearch's.
+func WithOpenSearch() Option {
+	return func(s *Store) {
+		s.openSearch = true
+	}
+}
+
+// WithBasicAuth authenticates with a username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(s *Store) {
+		s.auth = func(req *http.Request) { req.SetBasicAuth(username, password) }
+	}
+}
+
+// WithAPIKey authenticates with an Elasticsearch API key, as returned
+// base64-encoded by the create API key API.
+func WithAPIKey(key string) Option {
+	return func(s *Store) {
+		s.auth = func(req *http.Request) { req.Header.Set("Authorization", "ApiKey "+key) }
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or TLS
+// settings.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(s *Store) {
+		s.httpClient = hc
+	}
+}
+
+// New returns a Store on index of the cluster at baseURL (e.g.
+// "http://localhost:9200"). Call Migrate once to create the index, or
+// point it at an existing index with a compatible mapping.
+func New(baseURL, index string, opts ...Option) *Store {
+	s := &Store{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		index:      index,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Migrate creates the index with its mapping if it does not exist yet.
+func (s *Store) Migrate(ctx context.Context) error {
+	err := s.call(ctx, http.MethodHead, "/"+url.PathEscape(s.index), nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	props := map[string]any{
+		fieldDocID:    map[string]any{"type": "keyword"},
+		fieldText:     map[string]any{"type": "text"},
+		fieldMetadata: map[string]any{"type": "object", "enabled": false},
+		fieldObject:   map[string]any{"type": "keyword"},
+	}
+	body := map[string]any{"mappings": map[string]any{"properties": props}}
+	if s.embedder != nil {
+		if s.openSearch {
+			body["settings"] = map[string]any{"index.knn": true}
+			props[fieldEmbedding] = map[string]any{
+				"type":      "knn_vector",
+				"dimension": s.dims,
+				"method":    map[string]any{"name": "hnsw", "space_type": "cosinesimil", "engine": "lucene"},
+			}
+		} else {
+			props[fieldEmbedding] = map[string]any{
+				"type": "dense_vector", "dims": s.dims, "index": true, "similarity": "cosine",
+			}
+		}
+	}
+	if err := s.call(ctx, http.MethodPut, "/"+url.PathEscape(s.index), body, nil); err != nil {
+		return fmt.Errorf("elasticsearch: creating index: %w", err)
+	}
+	return nil
+}
+
+// Add implements rag.DocumentStore with one bulk request, refreshing the
+// index before returning so the documents are immediately searchable.
+func (s *Store) Add(ctx context.Context, docs ...rag.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var vectors [][]float32
+	if s.embedder != nil {
+		texts := make([]string, len(docs))
+		for i, d := range docs {
+			texts[i] = d.Text
+		}
+		var err error
+		if vectors, err = s.embed(ctx, texts); err != nil {
+			return fmt.Errorf("elasticsearch: embedding documents: %w", err)
+		}
+	}
+
+	var lines []any
+	for i, d := range docs {
+		source := map[string]any{
+			fieldDocID:    d.ID,
+			fieldText:     d.Text,
+			fieldMetadata: d.Metadata,
+			fieldObject:   d.Metadata[rag.SpiceDBObjectKey],
+		}
+		if vectors != nil {
+			source[fieldEmbedding] = vectors[i]
+		}
+		lines = append(lines, map[string]any{"index": map[string]any{"_index": s.index, "_id": d.ID}}, source)
+	}
+	if err := s.bulk(ctx, lines); err != nil {
+		return fmt.Errorf("elasticsearch: storing documents: %w", err)
+	}
+	return nil
+}
+
+// Remove implements rag.DocumentStore with one bulk request.
+func (s *Store) Remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	lines := make([]any, len(ids))
+	for i, id := range ids {
+		lines[i] = map[string]any{"delete": map[string]any{"_index": s.index, "_id": id}}
+	}
+	if err := s.bulk(ctx, lines); err != nil {
+		return fmt.Errorf("elasticsearch: removing documents: %w", err)
+	}
+	return nil
+}
+
+// Retrieve implements rag.Retriever.
+func (s *Store) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	scored, err := s.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]rag.Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs, nil
+}
+
+// RetrieveScored implements rag.ScoredRetriever.
+func (s *Store) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	return s.search(ctx, query, limit, nil)
+}
+
+// RetrieveAccessible implements rag.FilteringRetriever with a terms filter
+// on the documents' SpiceDB object, applied to both the full-text and the
+// kNN part of the search.
+func (s *Store) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	return s.search(ctx, query, limit, objects)
+}
+
+func (s *Store) search(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	var filter []any
+	if objects != nil {
+		filter = []any{map[string]any{"terms": map[string]any{fieldObject: objects}}}
+	}
+	match := map[string]any{"match": map[string]any{fieldText: query}}
+	boolQuery := map[string]any{"must": []any{match}}
+	if filter != nil {
+		boolQuery["filter"] = filter
+	}
+	body := map[string]any{"size": limit, "query": map[string]any{"bool": boolQuery}}
+
+	if s.embedder != nil {
+		vectors, err := s.embed(ctx, []string{query})
+		if err != nil {
+			return nil, fmt.Errorf("elasticsearch: embedding query: %w", err)
+		}
+		if s.openSearch {
+			knn := map[string]any{"vector": vectors[0], "k": limit}
+			if filter != nil {
+				knn["filter"] = map[string]any{"bool": map[string]any{"filter": filter}}
+			}
+			delete(boolQuery, "must")
+			boolQuery["should"] = []any{match, map[string]any{"knn": map[string]any{fieldEmbedding: knn}}}
+			boolQuery["minimum_should_match"] = 1
+		} else {
+			knn := map[string]any{
+				"field":          fieldEmbedding,
+				"query_vector":   vectors[0],
+				"k":              limit,
+				"num_candidates": max(limit, 100),
+			}
+			if filter != nil {
+				knn["filter"] = filter
+			}
+			body["knn"] = knn
+			// Documents matched only by the vector must still be returned.
+			delete(boolQuery, "must")
+			boolQuery["should"] = []any{match}
+		}
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Score  float64 `json:"_score"`
+				Source struct {
+					DocID    string            `json:"doc_id"`
+					Text     string            `json:"text"`
+					Metadata map[string]string `json:"metadata"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := s.call(ctx, http.MethodPost, "/"+url.PathEscape(s.index)+"/_search", body, &resp); err != nil {
+		return nil, fmt.Errorf("elasticsearch: searching: %w", err)
+	}
+
+	out := make([]rag.ScoredDocument, len(resp.Hits.Hits))
+	for i, hit := range resp.Hits.Hits {
+		out[i] = rag.ScoredDocument{
+			Document: rag.Document{ID: hit.Source.DocID, Text: hit.Source.Text, Metadata: hit.Source.Metadata},
+			Score:    hit.Score,
+		}
+	}
+	return out, nil
+}
+
+// bulk sends lines as an NDJSON bulk request and reports failed items.
+func (s *Store) bulk(ctx context.Context, lines []any) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+	}
+
+	var resp struct {
+		Errors bool                  `json:"errors"`
+		Items  []map[string]bulkItem `json:"items"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/_bulk?refresh=wait_for", "application/x-ndjson", &body, &resp); err != nil {
+		return err
+	}
+	if !resp.Errors {
+		return nil
+	}
+	var errs []error
+	for _, item := range resp.Items {
+		for op, result := range item {
+			// Deleting a missing document is not an error for Remove.
+			if result.Error != nil && (op != "delete" || result.Status != http.StatusNotFound) {
+				errs = append(errs, &APIError{StatusCode: result.Status, Message: fmt.Sprintf("%s: %s", result.ID, result.Error.Reason)})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type bulkItem struct {
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// embed calls the embedder and checks the vectors fit the mapping.
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", rag.ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) != s.dims {
+			return nil, fmt.Errorf("%w: dimension %d, want %d", rag.ErrEmbeddingMismatch, len(v), s.dims)
+		}
+	}
+	return vectors, nil
+}
+
+// call sends body, if any, as JSON and decodes the response into out, if
+// not nil.
+func (s *Store) call(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		r = bytes.NewReader(payload)
+	}
+	return s.do(ctx, method, path, "application/json", r, out)
+}
+
+func (s *Store) do(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.auth != nil {
+		s.auth(req)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(raw))
+		var e struct {
+			Error struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(raw, &e) == nil && e.Error.Reason != "" {
+			msg = e.Error.Reason
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package elasticsearch_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/elasticsearch"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+var (
+	_ rag.DocumentStore      = (*elasticsearch.Store)(nil)
+	_ rag.FilteringRetriever = (*elasticsearch.Store)(nil)
+)
+
+// fakeCluster implements the subset of the Elasticsearch REST API the
+// store uses, for a single index "docs". Searches score by the number of
+// query words in the text and ignore any kNN clause.
+type fakeCluster struct {
+	mu       sync.Mutex
+	mapping  map[string]any
+	sources  map[string]map[string]any
+	searches []map[string]any
+}
+
+func newFakeCluster(t *testing.T) (*fakeCluster, string) {
+	t.Helper()
+	f := &fakeCluster{sources: make(map[string]map[string]any)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("HEAD /docs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.mapping == nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("PUT /docs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_ = json.NewDecoder(r.Body).Decode(&f.mapping)
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	})
+	mux.HandleFunc("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var items []map[string]any
+		failed := false
+		lines := bufio.NewScanner(r.Body)
+		for lines.Scan() {
+			var action map[string]map[string]string
+			_ = json.Unmarshal(lines.Bytes(), &action)
+			for op, meta := range action {
+				status := http.StatusOK
+				result := map[string]any{"_id": meta["_id"]}
+				switch {
+				case meta["_index"] != "docs":
+					status, failed = http.StatusNotFound, true
+					result["error"] = map[string]any{"reason": "no such index [" + meta["_index"] + "]"}
+					if op == "index" {
+						lines.Scan()
+					}
+				case op == "index":
+					lines.Scan()
+					var source map[string]any
+					_ = json.Unmarshal(lines.Bytes(), &source)
+					f.sources[meta["_id"]] = source
+				case op == "delete":
+					if _, ok := f.sources[meta["_id"]]; !ok {
+						status, failed = http.StatusNotFound, true
+						result["error"] = map[string]any{"reason": "not found"}
+					}
+					delete(f.sources, meta["_id"])
+				}
+				result["status"] = status
+				items = append(items, map[string]any{op: result})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": failed, "items": items})
+	})
+	mux.HandleFunc("POST /docs/_search", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		var req struct {
+			Size  int `json:"size"`
+			Query struct {
+				Bool struct {
+					Filter []struct {
+						Terms map[string][]string `json:"terms"`
+					} `json:"filter"`
+				} `json:"bool"`
+			} `json:"query"`
+		}
+		b, _ := json.Marshal(body)
+		_ = json.Unmarshal(b, &req)
+		query, _ := findMatch(body["query"])
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.searches = append(f.searches, body)
+		type hit struct {
+			Score  float64        `json:"_score"`
+			Source map[string]any `json:"_source"`
+		}
+		var hits []hit
+		for _, source := range f.sources {
+			if len(req.Query.Bool.Filter) > 0 {
+				obj, _ := source["spicedb_object"].(string)
+				if !slices.Contains(req.Query.Bool.Filter[0].Terms["spicedb_object"], obj) {
+					continue
+				}
+			}
+			text, _ := source["text"].(string)
+			var score float64
+			for _, word := range strings.Fields(query) {
+				score += float64(strings.Count(text, word))
+			}
+			if score > 0 {
+				hits = append(hits, hit{Score: score, Source: source})
+			}
+		}
+		sort.Slice(hits, func(a, b int) bool { return hits[a].Score > hits[b].Score })
+		if len(hits) > req.Size {
+			hits = hits[:req.Size]
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{"hits": hits}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+// findMatch returns the text of the first match query nested in q.
+func findMatch(q any) (string, bool) {
+	switch q := q.(type) {
+	case map[string]any:
+		if m, ok := q["match"].(map[string]any); ok {
+			text, _ := m["text"].(string)
+			return text, true
+		}
+		for _, v := range q {
+			if text, ok := findMatch(v); ok {
+				return text, true
+			}
+		}
+	case []any:
+		for _, v := range q {
+			if text, ok := findMatch(v); ok {
+				return text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// constantEmbedder embeds every text as the same unit vector.
+type constantEmbedder struct{}
+
+func (constantEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i := range texts {
+		out[i] = []float32{1, 0}
+	}
+	return out, nil
+}
+
+func storeDocs() []rag.Document {
+	return []rag.Document{
+		{ID: "a", Text: "roadmap roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		{ID: "b", Text: "roadmap review", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:b"}},
+		{ID: "c", Text: "budget", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:c"}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeCluster(t)
+	store := elasticsearch.New(endpoint, "docs")
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NotContains(t, fake.mapping["mappings"].(map[string]any)["properties"], "embedding")
+
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+	require.Len(t, fake.sources, 3)
+
+	scored, err := store.RetrieveScored(context.Background(), "roadmap", 0)
+	require.NoError(t, err)
+	require.Len(t, scored, 2)
+	require.Equal(t, storeDocs()[0], scored[0].Document)
+	require.Equal(t, 2.0, scored[0].Score)
+	require.Equal(t, "b", scored[1].Document.ID)
+	require.EqualValues(t, elasticsearch.MaxSearchLimit, fake.searches[0]["size"])
+
+	require.NoError(t, store.Remove(context.Background(), "a", "missing"))
+	docs, err := store.Retrieve(context.Background(), "roadmap", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "b", docs[0].ID)
+}
+
+func TestKNN(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeCluster(t)
+	store := elasticsearch.New(endpoint, "docs", elasticsearch.WithEmbedder(constantEmbedder{}, 2))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.Equal(t, map[string]any{"type": "dense_vector", "dims": 2.0, "index": true, "similarity": "cosine"},
+		fake.mapping["mappings"].(map[string]any)["properties"].(map[string]any)["embedding"])
+
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+	require.Equal(t, []any{1.0, 0.0}, fake.sources["a"]["embedding"])
+
+	_, err := store.RetrieveAccessible(context.Background(), "roadmap", 5, []string{"document:b"})
+	require.NoError(t, err)
+	filter := []any{map[string]any{"terms": map[string]any{"spicedb_object": []any{"document:b"}}}}
+	require.Equal(t, map[string]any{
+		"field":          "embedding",
+		"query_vector":   []any{1.0, 0.0},
+		"k":              5.0,
+		"num_candidates": 100.0,
+		"filter":         filter,
+	}, fake.searches[0]["knn"])
+	require.Equal(t, map[string]any{"bool": map[string]any{
+		"should": []any{map[string]any{"match": map[string]any{"text": "roadmap"}}},
+		"filter": filter,
+	}}, fake.searches[0]["query"])
+}
+
+func TestOpenSearchKNN(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeCluster(t)
+	store := elasticsearch.New(endpoint, "docs",
+		elasticsearch.WithEmbedder(constantEmbedder{}, 2), elasticsearch.WithOpenSearch())
+	require.NoError(t, store.Migrate(context.Background()))
+	require.Equal(t, map[string]any{"index.knn": true}, fake.mapping["settings"])
+	require.Equal(t, "knn_vector",
+		fake.mapping["mappings"].(map[string]any)["properties"].(map[string]any)["embedding"].(map[string]any)["type"])
+
+	_, err := store.RetrieveScored(context.Background(), "roadmap", 5)
+	require.NoError(t, err)
+	require.Nil(t, fake.searches[0]["knn"])
+	require.Equal(t, map[string]any{"bool": map[string]any{
+		"should": []any{
+			map[string]any{"match": map[string]any{"text": "roadmap"}},
+			map[string]any{"knn": map[string]any{"embedding": map[string]any{"vector": []any{1.0, 0.0}, "k": 5.0}}},
+		},
+		"minimum_should_match": 1.0,
+	}}, fake.searches[0]["query"])
+}
+
+func TestPrefilterPushesDownToTermsFilter(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeCluster(t)
+	store := elasticsearch.New(endpoint, "docs")
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+
+	pipeline, _ := ragtest.NewPipeline(t, "document", "read", nil,
+		[]string{"document:b#read@user:emilia", "document:c#read@user:emilia"},
+		rag.WithRetriever(store), rag.WithFilterStrategy(rag.FilterPrefilter), rag.WithScanBudget(0, 1))
+
+	// Unfiltered, "a" would take the only slot and then be denied.
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "roadmap"})
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 1)
+	require.Equal(t, "b", resp.Documents[0].ID)
+
+	require.Equal(t, []any{map[string]any{
+		"terms": map[string]any{"spicedb_object": []any{"document:b", "document:c"}},
+	}}, fake.searches[0]["query"].(map[string]any)["bool"].(map[string]any)["filter"])
+}
+
+func TestAPIError(t *testing.T) {
+	t.Parallel()
+
+	_, endpoint := newFakeCluster(t)
+	err := elasticsearch.New(endpoint, "missing").Add(context.Background(), storeDocs()...)
+	var apiErr *elasticsearch.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Contains(t, apiErr.Message, "no such index [missing]")
+}
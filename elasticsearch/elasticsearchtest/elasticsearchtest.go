@@ -0,0 +1,130 @@
+// Package elasticsearchtest starts throwaway single-node Elasticsearch
+// clusters in containers via Testcontainers.
+package elasticsearchtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// DefaultImage is the Elasticsearch image started when none is
+	// configured.
+	DefaultImage = "docker.elastic.co/elasticsearch/elasticsearch:8.15.3"
+
+	// DefaultStartupTimeout bounds how long Run waits for the cluster to
+	// turn yellow. Elasticsearch is slow to boot, hence the generous
+	// default.
+	DefaultStartupTimeout = 3 * time.Minute
+
+	port = "9200/tcp"
+)
+
+// Instance is a running Elasticsearch container.
+type Instance struct {
+	// Endpoint is the base URL of the REST API, for elasticsearch.New.
+	Endpoint string
+
+	container testcontainers.Container
+}
+
+// Terminate removes the container.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return i.container.Terminate(ctx)
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	startupTimeout time.Duration
+}
+
+// WithImage overrides the Elasticsearch image. It must accept the same
+// environment, so OpenSearch images are not supported.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// Run starts a single-node Elasticsearch container with security
+// disabled, so it is reachable over plain HTTP without credentials. The
+// caller owns the instance and must Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{image: DefaultImage, startupTimeout: DefaultStartupTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.image,
+			ExposedPorts: []string{port},
+			Env: map[string]string{
+				"discovery.type":         "single-node",
+				"xpack.security.enabled": "false",
+				"ES_JAVA_OPTS":           "-Xms512m -Xmx512m",
+			},
+			WaitingFor: wait.ForHTTP("/_cluster/health?wait_for_status=yellow").
+				WithPort(port).
+				WithStartupTimeout(cfg.startupTimeout),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("elasticsearchtest: starting container: %w", err)
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, port, "http")
+	if err != nil {
+		_ = container.Terminate(ctx)
+		return nil, fmt.Errorf("elasticsearchtest: resolving endpoint: %w", err)
+	}
+	return &Instance{Endpoint: endpoint, container: container}, nil
+}
+
+// Cleanup tears down an instance started by StartElasticsearch. It is safe
+// to call more than once.
+type Cleanup func()
+
+// StartElasticsearch runs an Elasticsearch cluster for the duration of a
+// test and returns its endpoint. The test is skipped when no container
+// runtime is available and fails if the cluster cannot be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the cluster earlier.
+func StartElasticsearch(t *testing.T, opts ...Option) (string, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("elasticsearchtest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.Endpoint, cleanup
+}
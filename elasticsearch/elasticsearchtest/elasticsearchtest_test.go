@@ -0,0 +1,30 @@
+package elasticsearchtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/elasticsearch"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/elasticsearch/elasticsearchtest"
+)
+
+func TestStartElasticsearch(t *testing.T) {
+	t.Parallel()
+
+	endpoint, _ := elasticsearchtest.StartElasticsearch(t)
+
+	store := elasticsearch.New(endpoint, "docs")
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NoError(t, store.Add(context.Background(),
+		rag.Document{ID: "a", Text: "quarterly roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		rag.Document{ID: "b", Text: "roadmap review", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:b"}},
+	))
+
+	scored, err := store.RetrieveAccessible(context.Background(), "roadmap", 0, []string{"document:b"})
+	require.NoError(t, err)
+	require.Len(t, scored, 1)
+	require.Equal(t, "b", scored[0].Document.ID)
+}
@@ -0,0 +1,243 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EmbedLimits tunes a BatchingEmbedder. Zero fields take the defaults
+// given.
+type EmbedLimits struct {
+	// BatchSize is the most texts sent per request. The default is 96.
+	BatchSize int
+
+	// RequestsPerMinute and TokensPerMinute are the provider's rate
+	// limits; requests wait until they fit under both. Zero leaves a
+	// limit out. A batch of more tokens than TokensPerMinute waits for a
+	// full minute's allowance rather than forever.
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	// Tokenizer counts the tokens of each text for TokensPerMinute. The
+	// default is ApproxTokenizer.
+	Tokenizer Tokenizer
+
+	// Retry is how failed requests are retried, the default being
+	// DefaultEmbedRetryPolicy. The budget fields are not used: retries
+	// are only bounded by MaxAttempts. Set MaxAttempts to 1 to disable
+	// retries.
+	Retry RetryPolicy
+
+	// Transient reports whether a failed request is worth retrying. The
+	// default retries errors with a Temporary method returning true, such
+	// as ollama.APIError for rate limiting and server errors, and the
+	// gRPC codes Unavailable, ResourceExhausted and DeadlineExceeded.
+	Transient func(error) bool
+}
+
+// DefaultEmbedRetryPolicy retries a request four times, waiting one
+// second before the first retry and doubling the wait each time, which
+// outlasts the usual one-minute throttling window of embedding APIs.
+var DefaultEmbedRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// BatchingEmbedder is an Embedder that splits the texts of each call into
+// batches for another Embedder, sends them one at a time within the
+// provider's rate limits, and retries the ones that fail transiently, so
+// ingesting tens of thousands of chunks neither trips the provider's
+// throttling nor fails halfway. Wrap it in a CachingEmbedder, not the
+// other way round, so cached texts do not count against the limits.
+type BatchingEmbedder struct {
+	inner  Embedder
+	limits EmbedLimits
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex // serializes requests, so the limits hold across calls
+	requests  rateWindow
+	tokens    rateWindow
+	sent      int
+	retries   int
+	throttled time.Duration
+}
+
+// BatchingEmbedderStats is a snapshot of a BatchingEmbedder's counters:
+// the requests sent, including retries, the retries among them, and how
+// long requests waited for the rate limits.
+type BatchingEmbedderStats struct {
+	Requests, Retries int
+	Throttled         time.Duration
+}
+
+// NewBatchingEmbedder wraps inner within limits.
+func NewBatchingEmbedder(inner Embedder, limits EmbedLimits) *BatchingEmbedder {
+	if limits.BatchSize <= 0 {
+		limits.BatchSize = 96
+	}
+	if limits.Tokenizer == nil {
+		limits.Tokenizer = ApproxTokenizer
+	}
+	if limits.Retry == (RetryPolicy{}) {
+		limits.Retry = DefaultEmbedRetryPolicy
+	}
+	if limits.Transient == nil {
+		limits.Transient = transientEmbedError
+	}
+	return &BatchingEmbedder{
+		inner:    inner,
+		limits:   limits,
+		now:      time.Now,
+		sleep:    sleepContext,
+		requests: rateWindow{limit: limits.RequestsPerMinute},
+		tokens:   rateWindow{limit: limits.TokensPerMinute},
+	}
+}
+
+// Stats returns the embedder's counters.
+func (e *BatchingEmbedder) Stats() BatchingEmbedderStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return BatchingEmbedderStats{Requests: e.sent, Retries: e.retries, Throttled: e.throttled}
+}
+
+// Embed implements Embedder. It fails with the first batch that cannot
+// be embedded within the retry policy; the vectors of earlier batches are
+// lost, so wrap it in a CachingEmbedder to keep them.
+func (e *BatchingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.limits.BatchSize {
+		batch := texts[start:min(start+e.limits.BatchSize, len(texts))]
+		embedded, err := e.embedBatch(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("rag: embedding texts %d to %d: %w", start, start+len(batch)-1, err)
+		}
+		if len(embedded) != len(batch) {
+			return nil, fmt.Errorf("%w: got %d vectors for %d texts", ErrEmbeddingMismatch, len(embedded), len(batch))
+		}
+		vectors = append(vectors, embedded...)
+	}
+	return vectors, nil
+}
+
+// embedBatch sends batch within the rate limits, retrying it under the
+// policy.
+func (e *BatchingEmbedder) embedBatch(ctx context.Context, batch []string) ([][]float32, error) {
+	tokens := 0
+	for _, text := range batch {
+		tokens += e.limits.Tokenizer.CountTokens(text)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for attempt := 1; ; attempt++ {
+		if err := e.wait(ctx, tokens); err != nil {
+			return nil, err
+		}
+		vectors, err := e.inner.Embed(ctx, batch)
+		if err == nil || ctx.Err() != nil || !e.limits.Transient(err) || attempt >= e.limits.Retry.MaxAttempts {
+			return vectors, err
+		}
+		e.retries++
+		if err := e.sleep(ctx, e.limits.Retry.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until a request of tokens fits under the rate limits and
+// records it. e.mu must be held.
+func (e *BatchingEmbedder) wait(ctx context.Context, tokens int) error {
+	for {
+		now := e.now()
+		d := max(e.requests.delay(now, 1), e.tokens.delay(now, tokens))
+		if d <= 0 {
+			e.requests.record(now, 1)
+			e.tokens.record(now, tokens)
+			e.sent++
+			return nil
+		}
+		e.throttled += d
+		if err := e.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// rateWindow tracks the usage of a per-minute limit over the last
+// minute, oldest first.
+type rateWindow struct {
+	limit int // zero is unlimited
+	used  []rateUse
+}
+
+type rateUse struct {
+	at time.Time
+	n  int
+}
+
+// delay returns how long to wait at now before n more fit under the
+// limit, zero if they already do.
+func (w *rateWindow) delay(now time.Time, n int) time.Duration {
+	if w.limit <= 0 {
+		return 0
+	}
+	sum := min(n, w.limit)
+	for _, u := range w.used {
+		sum += u.n
+	}
+	var d time.Duration
+	for _, u := range w.used {
+		if sum <= w.limit {
+			break
+		}
+		sum -= u.n
+		d = u.at.Add(time.Minute).Sub(now)
+	}
+	return max(d, 0)
+}
+
+// record notes n used at now and forgets what left the window.
+func (w *rateWindow) record(now time.Time, n int) {
+	i := 0
+	for i < len(w.used) && !w.used[i].at.Add(time.Minute).After(now) {
+		i++
+	}
+	w.used = append(w.used[i:], rateUse{at: now, n: n})
+}
+
+// transientEmbedError is the default EmbedLimits.Transient.
+func transientEmbedError(err error) bool {
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) {
+		return temp.Temporary()
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package rag
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type constantEmbedder struct{ calls []int }
+
+func (e *constantEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls = append(e.calls, len(texts))
+	vectors := make([][]float32, len(texts))
+	for i := range vectors {
+		vectors[i] = []float32{1}
+	}
+	return vectors, nil
+}
+
+// fakeClock makes e sleep on a fake clock, recording the sleeps.
+func fakeClock(e *BatchingEmbedder) *[]time.Duration {
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+	e.now = func() time.Time { return now }
+	e.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return nil
+	}
+	return &slept
+}
+
+func TestBatchingEmbedderRequestLimit(t *testing.T) {
+	inner := &constantEmbedder{}
+	e := NewBatchingEmbedder(inner, EmbedLimits{BatchSize: 2, RequestsPerMinute: 2})
+	slept := fakeClock(e)
+
+	// Two requests fit in the first minute; the third waits for it to end.
+	vectors, err := e.Embed(context.Background(), []string{"a", "b", "c", "d", "e"})
+	require.NoError(t, err)
+	require.Len(t, vectors, 5)
+	require.Equal(t, []int{2, 2, 1}, inner.calls)
+	require.Equal(t, []time.Duration{time.Minute}, *slept)
+	require.Equal(t, BatchingEmbedderStats{Requests: 3, Throttled: time.Minute}, e.Stats())
+}
+
+func TestBatchingEmbedderTokenLimit(t *testing.T) {
+	inner := &constantEmbedder{}
+	e := NewBatchingEmbedder(inner, EmbedLimits{
+		BatchSize:       2,
+		TokensPerMinute: 5,
+		Tokenizer:       TokenizerFunc(func(text string) int { return len(text) }),
+	})
+	slept := fakeClock(e)
+
+	// The first batch spends four of the five tokens, so the second, of
+	// three, waits for it to leave the window. The last batch is over
+	// the limit and only waits for an empty window.
+	_, err := e.Embed(context.Background(), []string{"aa", "bb", "c", "dd", "eeeeee"})
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 2, 1}, inner.calls)
+	require.Equal(t, []time.Duration{time.Minute, time.Minute}, *slept)
+}
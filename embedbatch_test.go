@@ -0,0 +1,70 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// flakyEmbedder fails the calls listed in fail with err, and otherwise
+// embeds each text as its length.
+type flakyEmbedder struct {
+	fail    map[int]error
+	batches [][]string
+}
+
+func (e *flakyEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.batches = append(e.batches, texts)
+	if err := e.fail[len(e.batches)]; err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text))}
+	}
+	return vectors, nil
+}
+
+var fastEmbedRetry = rag.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+func TestBatchingEmbedderRetries(t *testing.T) {
+	t.Parallel()
+
+	inner := &flakyEmbedder{fail: map[int]error{
+		2: status.Error(codes.ResourceExhausted, "slow down"),
+		3: status.Error(codes.Unavailable, "restarting"),
+	}}
+	e := rag.NewBatchingEmbedder(inner, rag.EmbedLimits{BatchSize: 2, Retry: fastEmbedRetry})
+
+	vectors, err := e.Embed(context.Background(), []string{"a", "bb", "ccc", "dddd", "eeeee"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{{1}, {2}, {3}, {4}, {5}}, vectors)
+	require.Equal(t, [][]string{{"a", "bb"}, {"ccc", "dddd"}, {"ccc", "dddd"}, {"ccc", "dddd"}, {"eeeee"}}, inner.batches)
+	require.Equal(t, rag.BatchingEmbedderStats{Requests: 5, Retries: 2}, e.Stats())
+}
+
+func TestBatchingEmbedderGivesUp(t *testing.T) {
+	t.Parallel()
+
+	unavailable := status.Error(codes.Unavailable, "down")
+	inner := &flakyEmbedder{fail: map[int]error{1: unavailable, 2: unavailable, 3: unavailable}}
+	e := rag.NewBatchingEmbedder(inner, rag.EmbedLimits{Retry: fastEmbedRetry})
+	_, err := e.Embed(context.Background(), []string{"a"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Len(t, inner.batches, 3)
+
+	// Other failures are not retried.
+	invalid := errors.New("invalid input")
+	inner = &flakyEmbedder{fail: map[int]error{1: invalid}}
+	e = rag.NewBatchingEmbedder(inner, rag.EmbedLimits{Retry: fastEmbedRetry})
+	_, err = e.Embed(context.Background(), []string{"a"})
+	require.ErrorIs(t, err, invalid)
+	require.Len(t, inner.batches, 1)
+}
@@ -0,0 +1,244 @@
+package rag
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CachingEmbedder is an Embedder that remembers the vectors of texts it
+// has embedded, keyed by a hash of the text and the model version, so
+// re-ingesting an unchanged corpus does not pay for the embeddings again.
+// It keeps them in memory and, with EmbeddingCacheDir, on disk, where
+// they survive restarts and can be shared between CI runs.
+//
+// Cached vectors are shared between callers and must not be modified.
+type CachingEmbedder struct {
+	inner Embedder
+	model string
+	dir   string // "" keeps vectors in memory only
+
+	mu         sync.Mutex
+	maxEntries int
+	lru        *list.List // of *embeddingEntry, most recently used first
+	items      map[string]*list.Element
+	hits       int
+	diskHits   int
+	misses     int
+	diskErrors int
+}
+
+type embeddingEntry struct {
+	key    string
+	vector []float32
+}
+
+// EmbeddingCacheStats is a snapshot of a CachingEmbedder's counters.
+// Hits counts texts answered from the cache, DiskHits the part of them
+// read from disk, and Misses those sent to the inner Embedder. Entries is
+// the number of vectors held in memory. DiskErrors counts the vectors
+// that could not be written to disk; they are still returned and kept in
+// memory.
+type EmbeddingCacheStats struct {
+	Hits, DiskHits, Misses, Entries int
+	DiskErrors                      int
+}
+
+// EmbeddingCacheOption configures a CachingEmbedder.
+type EmbeddingCacheOption func(*CachingEmbedder)
+
+// EmbeddingCacheDir also stores vectors as files under dir, created if
+// needed, and reads them back on a miss in memory. Several processes may
+// share dir.
+func EmbeddingCacheDir(dir string) EmbeddingCacheOption {
+	return func(c *CachingEmbedder) {
+		c.dir = dir
+	}
+}
+
+// NewCachingEmbedder caches inner's vectors, keeping at most maxEntries
+// of them in memory and evicting the least recently used first; zero
+// keeps them all. model names the model and its version, e.g.
+// "nomic-embed-text:v1.5": vectors of another model are never returned,
+// so changing it re-embeds everything.
+func NewCachingEmbedder(inner Embedder, model string, maxEntries int, opts ...EmbeddingCacheOption) *CachingEmbedder {
+	c := &CachingEmbedder{
+		inner:      inner,
+		model:      model,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Stats returns the cache's hit and miss counts and current size.
+func (c *CachingEmbedder) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return EmbeddingCacheStats{Hits: c.hits, DiskHits: c.diskHits, Misses: c.misses, Entries: c.lru.Len(), DiskErrors: c.diskErrors}
+}
+
+// Embed implements Embedder. Only the texts missing from the cache are
+// sent to the inner Embedder, in one call, and each of them once.
+func (c *CachingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	var missing, missingKeys []string
+	pending := make(map[string][]int) // key to the positions awaiting it
+	for i, text := range texts {
+		keys[i] = c.key(text)
+		if v, ok := c.lookup(keys[i]); ok {
+			vectors[i] = v
+			continue
+		}
+		if _, ok := pending[keys[i]]; !ok {
+			missing = append(missing, text)
+			missingKeys = append(missingKeys, keys[i])
+		}
+		pending[keys[i]] = append(pending[keys[i]], i)
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.inner.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missing) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", ErrEmbeddingMismatch, len(embedded), len(missing))
+	}
+	c.mu.Lock()
+	c.misses += len(missing)
+	c.mu.Unlock()
+	for j, key := range missingKeys {
+		for _, i := range pending[key] {
+			vectors[i] = embedded[j]
+		}
+		c.store(key, embedded[j])
+	}
+	return vectors, nil
+}
+
+// key identifies text embedded by the cache's model.
+func (c *CachingEmbedder) key(text string) string {
+	h := sha256.New()
+	h.Write([]byte(c.model))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lookup returns the vector cached under key, from memory or disk.
+func (c *CachingEmbedder) lookup(key string) ([]float32, bool) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.lru.MoveToFront(el)
+		c.hits++
+		c.mu.Unlock()
+		return el.Value.(*embeddingEntry).vector, true
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil, false
+	}
+	v, ok := readVector(c.path(key))
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits++
+	c.diskHits++
+	c.putLocked(key, v)
+	return v, true
+}
+
+// store caches v under key, in memory and on disk. A failed write only
+// costs a later miss, so it is counted rather than failing the call.
+func (c *CachingEmbedder) store(key string, v []float32) {
+	var err error
+	if c.dir != "" {
+		err = writeVector(c.path(key), v)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(key, v)
+	if err != nil {
+		c.diskErrors++
+	}
+}
+
+// putLocked keeps v in memory under key. c.mu must be held.
+func (c *CachingEmbedder) putLocked(key string, v []float32) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*embeddingEntry).vector = v
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&embeddingEntry{key: key, vector: v})
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*embeddingEntry).key)
+	}
+}
+
+// path is the file holding the vector cached under key, spread over 256
+// directories.
+func (c *CachingEmbedder) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// readVector reads a vector written by writeVector. A missing, unreadable
+// or truncated file is a miss.
+func readVector(path string) ([]float32, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 || len(data)%4 != 0 {
+		return nil, false
+	}
+	v := make([]float32, len(data)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return v, true
+}
+
+// writeVector writes v as little-endian float32s. The file is renamed
+// into place, so concurrent readers never see it half written.
+func writeVector(path string, v []float32) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(x))
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
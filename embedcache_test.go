@@ -0,0 +1,97 @@
+package rag_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestCachingEmbedder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	inner := &vocabEmbedder{vocab: []string{"refund", "policy", "roadmap"}}
+	cache := rag.NewCachingEmbedder(inner, "vocab:v1", 2)
+
+	want, err := inner.Embed(ctx, []string{"refund policy", "roadmap"})
+	require.NoError(t, err)
+	inner.calls = 0
+
+	got, err := cache.Embed(ctx, []string{"refund policy", "roadmap", "refund policy"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{want[0], want[1], want[0]}, got)
+	require.Equal(t, 1, inner.calls)
+	require.Equal(t, rag.EmbeddingCacheStats{Misses: 2, Entries: 2}, cache.Stats())
+
+	got, err = cache.Embed(ctx, []string{"roadmap", "refund policy"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{want[1], want[0]}, got)
+	require.Equal(t, 1, inner.calls, "unchanged texts are not embedded again")
+
+	// The least recently used vector makes room for a new one.
+	_, err = cache.Embed(ctx, []string{"policy"})
+	require.NoError(t, err)
+	_, err = cache.Embed(ctx, []string{"roadmap"})
+	require.NoError(t, err)
+	require.Equal(t, 3, inner.calls)
+	require.Equal(t, rag.EmbeddingCacheStats{Hits: 2, Misses: 4, Entries: 2}, cache.Stats())
+
+	inner.err = context.Canceled
+	_, err = cache.Embed(ctx, []string{"something new"})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCachingEmbedderOnDisk(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	inner := &vocabEmbedder{vocab: []string{"refund", "policy", "roadmap"}}
+	docs := scenarioDocs()
+	_, err := rag.NewVectorRetriever(ctx, rag.NewCachingEmbedder(inner, "vocab:v1", 0, rag.EmbeddingCacheDir(dir)), docs)
+	require.NoError(t, err)
+	require.Equal(t, 1, inner.calls)
+
+	// A new process re-ingesting the same corpus reads the vectors back.
+	cache := rag.NewCachingEmbedder(inner, "vocab:v1", 0, rag.EmbeddingCacheDir(dir))
+	_, err = rag.NewVectorRetriever(ctx, cache, docs)
+	require.NoError(t, err)
+	require.Equal(t, 1, inner.calls)
+	require.Equal(t, rag.EmbeddingCacheStats{Hits: 3, DiskHits: 3, Entries: 3}, cache.Stats())
+
+	// Another model version does not reuse them.
+	cache = rag.NewCachingEmbedder(inner, "vocab:v2", 0, rag.EmbeddingCacheDir(dir))
+	_, err = rag.NewVectorRetriever(ctx, cache, docs)
+	require.NoError(t, err)
+	require.Equal(t, 2, inner.calls)
+	require.Equal(t, 3, cache.Stats().Misses)
+}
+
+func TestCachingEmbedderSurvivesDiskErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// A file where the cache directory should be fails every write.
+	dir := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, os.WriteFile(dir, nil, 0o644))
+
+	inner := &vocabEmbedder{vocab: []string{"refund", "policy", "roadmap"}}
+	cache := rag.NewCachingEmbedder(inner, "vocab:v1", 0, rag.EmbeddingCacheDir(dir))
+	want, err := inner.Embed(ctx, []string{"refund policy", "roadmap"})
+	require.NoError(t, err)
+
+	got, err := cache.Embed(ctx, []string{"refund policy", "roadmap"})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	require.Equal(t, rag.EmbeddingCacheStats{Misses: 2, Entries: 2, DiskErrors: 2}, cache.Stats())
+
+	// The vectors are still cached in memory.
+	_, err = cache.Embed(ctx, []string{"roadmap"})
+	require.NoError(t, err)
+	require.Equal(t, 2, inner.calls)
+}
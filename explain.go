@@ -0,0 +1,208 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+)
+
+// Outcome is what happened to a document during an explained query.
+type Outcome int
+
+const (
+	// OutcomeNotRetrieved means the document did not match the query.
+	// Only the built-in substring scan reports it; other retrievers do not
+	// say what they left out.
+	OutcomeNotRetrieved Outcome = iota
+	// OutcomeFiltered means the document matched but was dropped before
+	// authorization: by MinScore, Filters or the scan budget. Reason says
+	// which.
+	OutcomeFiltered
+	// OutcomeUnmapped means the document has no usable SpiceDB object.
+	OutcomeUnmapped
+	// OutcomeDenied means the subject lacks the permission. Decision is
+	// DecisionDenied, or DecisionConditional when caveat context was
+	// missing.
+	OutcomeDenied
+	// OutcomeTruncated means the document was authorized but fell beyond
+	// TopK.
+	OutcomeTruncated
+	// OutcomeReturned means the document is in the query's results.
+	OutcomeReturned
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeNotRetrieved:
+		return "not retrieved"
+	case OutcomeFiltered:
+		return "filtered"
+	case OutcomeUnmapped:
+		return "unmapped"
+	case OutcomeDenied:
+		return "denied"
+	case OutcomeTruncated:
+		return "truncated"
+	case OutcomeReturned:
+		return "returned"
+	default:
+		return fmt.Sprintf("Outcome(%d)", int(o))
+	}
+}
+
+// Explanation accounts for one document in an explained query. It
+// identifies the document but never carries its content.
+type Explanation struct {
+	DocumentID string
+
+	// Resource is the document's SpiceDB object, "type:id", if it has one.
+	Resource string
+
+	Outcome Outcome
+
+	// Decision is the permission decision, for documents that reached
+	// authorization.
+	Decision Decision
+
+	// Score is the retrieval score, for retrieved documents.
+	Score float64
+
+	// Reason details OutcomeFiltered and OutcomeUnmapped.
+	Reason string
+}
+
+// ExplainResponse is the result of QueryExplain.
+type ExplainResponse struct {
+	// Explanations lists the retrieved documents in retrieval order,
+	// followed by the rest of the corpus when the built-in scan was used.
+	Explanations []Explanation
+
+	// Stats describes the work done, as for Query.
+	Stats Stats
+}
+
+// QueryExplain runs a query like Query but reports, for each document,
+// whether it was dropped at retrieval, dropped by the permission check
+// (with the decision) or returned, to answer questions such as "why
+// can't emilia see doc2". Only document IDs and objects are reported, so
+// the response is safe to show to whoever debugs the query.
+//
+// It is a dry run: no Auditor is called, and policies that would fail the
+// query (ConditionalReject, BudgetReject) are reported on instead.
+func (r *RAGPipeline) QueryExplain(ctx context.Context, userID, query string, opts ...QueryOption) (*ExplainResponse, error) {
+	qc := newQueryConfig(opts)
+	ex := &explainer{index: make(map[string]int)}
+	resp, err := r.do(context.WithValue(ctx, explainKey{}, ex), qc.request(userID, query))
+	if qc.stats != nil {
+		*qc.stats = resp.Stats
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainResponse{Explanations: ex.out, Stats: resp.Stats}, nil
+}
+
+type explainKey struct{}
+
+// explainer collects the Explanations of a query run by QueryExplain. Its
+// methods do nothing on a nil explainer, so the query path calls them
+// unconditionally.
+type explainer struct {
+	out   []Explanation
+	index map[string]int // document ID to position in out
+}
+
+func explainerFromContext(ctx context.Context) *explainer {
+	ex, _ := ctx.Value(explainKey{}).(*explainer)
+	return ex
+}
+
+// set records e, replacing an earlier explanation of the same document.
+func (ex *explainer) set(e Explanation) {
+	if ex == nil {
+		return
+	}
+	if i, ok := ex.index[e.DocumentID]; ok {
+		ex.out[i] = e
+		return
+	}
+	ex.index[e.DocumentID] = len(ex.out)
+	ex.out = append(ex.out, e)
+}
+
+// retrieved records the candidates as returned; authorization overrides
+// that for the ones it drops.
+func (ex *explainer) retrieved(r *RAGPipeline, candidates []ScoredDocument) {
+	if ex == nil {
+		return
+	}
+	for _, d := range candidates {
+		ex.set(Explanation{DocumentID: d.Document.ID, Resource: r.objectOf(d.Document), Outcome: OutcomeReturned, Score: d.Score})
+	}
+}
+
+// scanned accounts for the corpus documents the built-in scan did not
+// return: they did not match, were outside the accessible set under the
+// prefilter strategy, or were never reached within the scan budget.
+func (ex *explainer) scanned(r *RAGPipeline, query string, accessible map[string]bool) {
+	if ex == nil {
+		return
+	}
+	m := newMatcher(query)
+	for _, d := range r.snapshot() {
+		if _, ok := ex.index[d.ID]; ok {
+			continue
+		}
+		e := Explanation{DocumentID: d.ID, Resource: r.objectOf(d)}
+		_, inSet := accessible[e.Resource]
+		switch {
+		case !m.match(d.Text):
+			e.Outcome = OutcomeNotRetrieved
+		case r.strategy == FilterPrefilter && !inSet:
+			e.Outcome = OutcomeDenied
+			if e.Resource == "" {
+				e.Outcome, e.Reason = OutcomeUnmapped, "no usable SpiceDB object"
+			}
+		default:
+			e.Outcome, e.Reason = OutcomeFiltered, "scan budget exhausted"
+		}
+		ex.set(e)
+	}
+}
+
+// drop records why d was dropped.
+func (ex *explainer) drop(d Document, outcome Outcome, decision Decision, reason string) {
+	if ex == nil {
+		return
+	}
+	e := Explanation{DocumentID: d.ID}
+	if i, ok := ex.index[d.ID]; ok {
+		e = ex.out[i]
+	}
+	e.Outcome, e.Decision, e.Reason = outcome, decision, reason
+	ex.set(e)
+}
+
+// finish marks the authorized documents that TopK cut off.
+func (ex *explainer) finish(resp *QueryResponse) {
+	if ex == nil {
+		return
+	}
+	returned := make(map[string]bool, len(resp.Documents))
+	for _, d := range resp.Documents {
+		returned[d.ID] = true
+	}
+	for i, e := range ex.out {
+		if e.Outcome == OutcomeReturned && !returned[e.DocumentID] {
+			ex.out[i].Outcome = OutcomeTruncated
+		}
+	}
+}
+
+// objectOf is the "type:id" of d's SpiceDB object, or "" if it has none.
+func (r *RAGPipeline) objectOf(d Document) string {
+	res, err := r.resourceFor(d)
+	if err != nil {
+		return ""
+	}
+	return objectKey(res)
+}
@@ -0,0 +1,91 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func explainDocs() []rag.Document {
+	return append(scenarioDocs(),
+		rag.Document{ID: "unmapped", Text: "Public notes without an ACL."},
+	)
+}
+
+func outcomes(resp *rag.ExplainResponse) map[string]string {
+	out := make(map[string]string)
+	for _, e := range resp.Explanations {
+		out[e.DocumentID] = e.Outcome.String()
+	}
+	return out
+}
+
+func TestQueryExplain(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc3#read@user:emilia")
+	audit := &auditRecorder{}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", explainDocs(), rag.WithAuditor(audit))
+
+	resp, err := pipeline.QueryExplain(context.Background(), "emilia", "u")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"doc1":     "not retrieved",
+		"doc2":     "denied",
+		"doc3":     "returned",
+		"unmapped": "unmapped",
+	}, outcomes(resp))
+
+	// Retrieved documents come first, in retrieval order.
+	require.Equal(t, []string{"doc2", "doc3", "unmapped", "doc1"}, []string{
+		resp.Explanations[0].DocumentID, resp.Explanations[1].DocumentID,
+		resp.Explanations[2].DocumentID, resp.Explanations[3].DocumentID,
+	})
+	require.Equal(t, rag.Explanation{DocumentID: "doc2", Resource: "document:doc2", Outcome: rag.OutcomeDenied, Decision: rag.DecisionDenied, Score: 1}, resp.Explanations[0])
+	require.Equal(t, 1, resp.Stats.Denied)
+
+	// A dry run is not audited.
+	require.Empty(t, audit.events)
+
+	resp, err = pipeline.QueryExplain(context.Background(), "emilia", "o", rag.WithTopK(1))
+	require.NoError(t, err)
+	require.Equal(t, "returned", outcomes(resp)["doc1"])
+	require.Equal(t, "truncated", outcomes(resp)["doc3"])
+}
+
+func TestQueryExplainFilteredAndConditional(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc3#read@user:emilia")
+	fake.conditional = map[string]string{"document:doc1#read@user:emilia": "on_vpn"}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", explainDocs(),
+		rag.WithConditionalPolicy(rag.ConditionalReject))
+
+	resp, err := pipeline.QueryExplain(context.Background(), "emilia", "o", rag.WithFilter("spicedb_object", "document:doc1"))
+	require.NoError(t, err)
+	require.Equal(t, "filtered", outcomes(resp)["doc3"])
+	require.Equal(t, "metadata filter", resp.Explanations[2].Reason)
+
+	// ConditionalReject would fail Query; the explanation reports instead.
+	require.Equal(t, rag.Explanation{DocumentID: "doc1", Resource: "document:doc1", Outcome: rag.OutcomeDenied, Decision: rag.DecisionConditional, Score: 1}, resp.Explanations[0])
+}
+
+func TestQueryExplainPrefilter(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc3#read@user:charlie")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", explainDocs(),
+		rag.WithFilterStrategy(rag.FilterPrefilter))
+
+	resp, err := pipeline.QueryExplain(context.Background(), "charlie", "o")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"doc1":     "denied",
+		"doc2":     "denied",
+		"doc3":     "returned",
+		"unmapped": "unmapped",
+	}, outcomes(resp))
+}
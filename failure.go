@@ -0,0 +1,69 @@
+package rag
+
+import "fmt"
+
+// FailurePolicy decides what a query does when permission checks fail,
+// e.g. because SpiceDB is unreachable. It applies to the checks of
+// individual documents; a failed LookupResources under the prefilter
+// strategy has no document to blame and always fails the query. Under
+// FilterAdaptive, the other policies have the candidates checked instead.
+type FailurePolicy int
+
+const (
+	// FailClosed fails the whole query with the first check error, so no
+	// partial results are ever returned.
+	FailClosed FailurePolicy = iota
+
+	// FailClosedDocument withholds only the documents whose check failed
+	// and answers with the rest. Each failure is listed in
+	// QueryResponse.CheckErrors and counted in Stats.CheckErrors.
+	FailClosedDocument
+
+	// FailOpen returns the documents whose check failed as if they were
+	// allowed, with QueryResult.CheckErr set and the failure listed in
+	// QueryResponse.CheckErrors. Use it only for corpora where showing a
+	// document to the wrong user is acceptable, never to enforce access.
+	FailOpen
+)
+
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailClosed:
+		return "fail closed"
+	case FailClosedDocument:
+		return "fail closed per document"
+	case FailOpen:
+		return "fail open"
+	default:
+		return fmt.Sprintf("FailurePolicy(%d)", int(p))
+	}
+}
+
+// WithFailurePolicy selects what happens to documents whose permission
+// check fails. The default is FailClosed.
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(r *RAGPipeline) {
+		r.failurePolicy = p
+	}
+}
+
+// CheckError reports a document whose permission check failed under
+// FailClosedDocument or FailOpen.
+type CheckError struct {
+	DocumentID string
+
+	// Resource is the document's SpiceDB object, "type:id".
+	Resource string
+
+	// Err is the error the check failed with.
+	Err error
+}
+
+func (e CheckError) Error() string {
+	return fmt.Sprintf("rag: checking %s (document %s): %v", e.Resource, e.DocumentID, e.Err)
+}
+
+// Unwrap returns Err.
+func (e CheckError) Unwrap() error {
+	return e.Err
+}
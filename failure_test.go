@@ -0,0 +1,111 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestFailurePolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  rag.FailurePolicy
+		opts    []rag.Option
+		wantIDs []string
+	}{
+		{name: "per document", policy: rag.FailClosedDocument, wantIDs: []string{"doc0", "doc2", "doc3"}},
+		{name: "open", policy: rag.FailOpen, wantIDs: []string{"doc0", "doc1", "doc2", "doc3"}},
+		{
+			// The cache turns the checker into a BulkPermissionChecker
+			// reporting per-item errors.
+			name:    "per document through cache",
+			policy:  rag.FailClosedDocument,
+			opts:    []rag.Option{rag.WithCheckCache(time.Minute, 0)},
+			wantIDs: []string{"doc0", "doc2", "doc3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			checker := &slowChecker{failOn: "doc1"}
+			opts := append([]rag.Option{rag.WithPermissionChecker(checker), rag.WithFailurePolicy(tt.policy)}, tt.opts...)
+			pipeline := rag.NewRAGPipeline(nil, "document", "read", syntheticCorpus(4), opts...)
+
+			resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+			require.NoError(t, err)
+			requireEqualDocIDs(t, tt.wantIDs, resp.Documents)
+			require.Equal(t, 1, resp.Stats.CheckErrors)
+			require.Len(t, resp.CheckErrors, 1)
+			require.Equal(t, "doc1", resp.CheckErrors[0].DocumentID)
+			require.Equal(t, "document:doc1", resp.CheckErrors[0].Resource)
+			require.ErrorContains(t, resp.CheckErrors[0], "check failed")
+
+			for _, res := range resp.Results {
+				if res.Document.ID == "doc1" {
+					require.ErrorContains(t, res.CheckErr, "check failed")
+				} else {
+					require.NoError(t, res.CheckErr)
+				}
+			}
+		})
+	}
+}
+
+func TestFailClosedIsDefault(t *testing.T) {
+	t.Parallel()
+
+	checker := &slowChecker{failOn: "doc1"}
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", syntheticCorpus(4), rag.WithPermissionChecker(checker))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorContains(t, err, "check failed")
+}
+
+func TestFailOpenWholeRequestFailure(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc0#read@user:emilia")
+	fake.failCheck = status.Error(codes.Unavailable, "connection refused")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3), rag.WithFailurePolicy(rag.FailOpen))
+
+	// A bulk request that fails as a whole fails every item it carried.
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0", "doc1", "doc2"}, resp.Documents)
+	require.Equal(t, 3, resp.Stats.CheckErrors)
+	require.Equal(t, codes.Unavailable, status.Code(resp.CheckErrors[2].Err))
+	require.ErrorIs(t, resp.CheckErrors[2], rag.ErrPermissionBackendUnavailable)
+}
+
+func TestBackendUnavailableError(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	fake.failCheck = status.Error(codes.Unavailable, "connection refused")
+	fake.failLookups = 1
+
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, rag.ErrPermissionBackendUnavailable)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	pipeline = rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3), rag.WithFilterStrategy(rag.FilterPrefilter))
+	_, err = pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, rag.ErrPermissionBackendUnavailable)
+
+	// Errors that are not about reaching the backend are left alone.
+	fake.failCheck = status.Error(codes.InvalidArgument, "bad caveat")
+	pipeline = rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+	_, err = pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NotErrorIs(t, err, rag.ErrPermissionBackendUnavailable)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
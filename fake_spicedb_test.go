@@ -0,0 +1,413 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fakeSpiceDB is an in-process stand-in for SpiceDB's permission and schema
+// services so unit tests can exercise the pipeline without a container.
+// Calls that are not overridden panic via the nil embedded interfaces.
+type fakeSpiceDB struct {
+	apiv1.PermissionsServiceClient
+	apiv1.SchemaServiceClient
+	apiv1.WatchServiceClient
+
+	mu           sync.Mutex
+	allowed      map[string]bool      // "document:doc1#read@user:emilia"
+	checks       int                  // items decided, singly or in bulk
+	bulkRequests []int                // item count of each CheckBulkPermissions call
+	deleted      []string             // "type:id" of DeleteRelationships resource filters
+	consistency  []*apiv1.Consistency // of each check and lookup request, in order
+	// conditional maps tuples to the caveat context key they depend on:
+	// they are allowed when the request's context sets that key to true
+	// and conditional when it is absent.
+	conditional map[string]string
+
+	// schema is returned by ReadSchema and replaced by WriteSchema.
+	schema string
+	// grants maps relations written via WriteRelationships to the
+	// permission they confer.
+	grants map[string]string
+	// failWrite fails WriteRelationships once failWriteAfter calls have
+	// succeeded.
+	failWrite      error
+	failWriteAfter int
+	// beforeWrite, if set, is called at the start of every
+	// WriteRelationships call, e.g. to race it.
+	beforeWrite func()
+	// expires holds the expiry of allowed tuples written with one;
+	// they are not allowed after it.
+	expires map[string]time.Time
+	// relationships holds the relationships written, keyed by
+	// "type:id#relation@subject", for ReadRelationships.
+	relationships map[string]*apiv1.Relationship
+	// failCheck fails every check request when set. failLookups fails
+	// that many LookupResources calls with codes.Unavailable.
+	failCheck   error
+	failLookups int
+
+	// watch feeds Watch streams; closing it ends the current stream.
+	// watchCursors records the start cursor of each Watch call.
+	watch        chan *apiv1.WatchResponse
+	watchCursors []*apiv1.ZedToken
+}
+
+// newFakeClient returns an authzed client whose permission checks succeed
+// exactly for the given "type:id#permission@subjtype:subjid" tuples.
+func newFakeClient(allowed ...string) (*authzed.Client, *fakeSpiceDB) {
+	f := &fakeSpiceDB{
+		allowed: make(map[string]bool, len(allowed)),
+		schema:  "definition user {}\n\ndefinition document {\n  relation viewer: user\n  permission read = viewer\n}\n",
+		grants:  map[string]string{"owner": "read", "viewer": "read"},
+
+		relationships: make(map[string]*apiv1.Relationship),
+		expires:       make(map[string]time.Time),
+	}
+	for _, a := range allowed {
+		f.allowed[a] = true
+	}
+	return &authzed.Client{PermissionsServiceClient: f, SchemaServiceClient: f, WatchServiceClient: f}, f
+}
+
+// consistencies returns the consistency of every check and lookup request
+// received so far.
+func (f *fakeSpiceDB) consistencies() []*apiv1.Consistency {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*apiv1.Consistency(nil), f.consistency...)
+}
+
+func tupleKey(res *apiv1.ObjectReference, permission string, subj *apiv1.SubjectReference) string {
+	return fmt.Sprintf("%s:%s#%s@%s", res.GetObjectType(), res.GetObjectId(), permission, subjectKey(subj))
+}
+
+// wildcardKey replaces the subject ID at the end of key with "*", the
+// way a "user:*" relationship grants every user. Subjects with a relation
+// are not covered by wildcards; their key is returned as is.
+func wildcardKey(key string) string {
+	at := strings.LastIndex(key, "@")
+	if strings.Contains(key[at:], "#") {
+		return key
+	}
+	return key[:strings.LastIndex(key, ":")+1] + "*"
+}
+
+// subjectKey formats subj as "type:id" or "type:id#relation".
+func subjectKey(subj *apiv1.SubjectReference) string {
+	key := subj.GetObject().GetObjectType() + ":" + subj.GetObject().GetObjectId()
+	if rel := subj.GetOptionalRelation(); rel != "" {
+		key += "#" + rel
+	}
+	return key
+}
+
+func (f *fakeSpiceDB) CheckPermission(_ context.Context, in *apiv1.CheckPermissionRequest, _ ...grpc.CallOption) (*apiv1.CheckPermissionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks++
+	f.consistency = append(f.consistency, in.GetConsistency())
+	if f.failCheck != nil {
+		return nil, f.failCheck
+	}
+
+	ship, partial := f.permissionship(tupleKey(in.GetResource(), in.GetPermission(), in.GetSubject()), in.GetContext())
+	return &apiv1.CheckPermissionResponse{Permissionship: ship, PartialCaveatInfo: partial}, nil
+}
+
+func (f *fakeSpiceDB) CheckBulkPermissions(_ context.Context, in *apiv1.CheckBulkPermissionsRequest, _ ...grpc.CallOption) (*apiv1.CheckBulkPermissionsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bulkRequests = append(f.bulkRequests, len(in.GetItems()))
+	f.consistency = append(f.consistency, in.GetConsistency())
+	if f.failCheck != nil {
+		return nil, f.failCheck
+	}
+
+	resp := &apiv1.CheckBulkPermissionsResponse{CheckedAt: &apiv1.ZedToken{Token: "fake-revision"}}
+	for _, item := range in.GetItems() {
+		f.checks++
+
+		ship, partial := f.permissionship(tupleKey(item.GetResource(), item.GetPermission(), item.GetSubject()), item.GetContext())
+		resp.Pairs = append(resp.Pairs, &apiv1.CheckBulkPermissionsPair{
+			Request: item,
+			Response: &apiv1.CheckBulkPermissionsPair_Item{
+				Item: &apiv1.CheckBulkPermissionsResponseItem{Permissionship: ship, PartialCaveatInfo: partial},
+			},
+		})
+	}
+	return resp, nil
+}
+
+// holds reports whether key is allowed and has not expired. The caller
+// holds f.mu.
+func (f *fakeSpiceDB) holds(key string) bool {
+	exp, ok := f.expires[key]
+	return f.allowed[key] && (!ok || time.Now().Before(exp))
+}
+
+// permissionship decides key given the request's caveat context, with
+// the missing context of a conditional decision. The caller holds f.mu.
+func (f *fakeSpiceDB) permissionship(key string, caveat *structpb.Struct) (apiv1.CheckPermissionResponse_Permissionship, *apiv1.PartialCaveatInfo) {
+	if f.holds(key) || f.holds(wildcardKey(key)) {
+		return apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION, nil
+	}
+	if param, ok := f.conditional[key]; ok {
+		v, set := caveat.GetFields()[param]
+		switch {
+		case !set:
+			return apiv1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION, &apiv1.PartialCaveatInfo{MissingRequiredContext: []string{param}}
+		case v.GetBoolValue():
+			return apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION, nil
+		}
+	}
+	return apiv1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION, nil
+}
+
+func (f *fakeSpiceDB) LookupSubjects(_ context.Context, in *apiv1.LookupSubjectsRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[apiv1.LookupSubjectsResponse], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := fmt.Sprintf("%s:%s#%s@%s:",
+		in.GetResource().GetObjectType(), in.GetResource().GetObjectId(), in.GetPermission(), in.GetSubjectObjectType())
+
+	var out []*apiv1.LookupSubjectsResponse
+	for key := range f.allowed {
+		if id, ok := strings.CutPrefix(key, prefix); ok {
+			out = append(out, &apiv1.LookupSubjectsResponse{
+				Subject: &apiv1.ResolvedSubject{
+					SubjectObjectId: id,
+					Permissionship:  apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION,
+				},
+			})
+		}
+	}
+	return &fakeStream[apiv1.LookupSubjectsResponse]{items: out}, nil
+}
+
+func (f *fakeSpiceDB) LookupResources(_ context.Context, in *apiv1.LookupResourcesRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[apiv1.LookupResourcesResponse], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.consistency = append(f.consistency, in.GetConsistency())
+	if f.failLookups > 0 {
+		f.failLookups--
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	prefix := in.GetResourceObjectType() + ":"
+	suffix := "#" + in.GetPermission() + "@" + subjectKey(in.GetSubject())
+
+	var out []*apiv1.LookupResourcesResponse
+	for key := range f.allowed {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || !f.holds(key) {
+			continue
+		}
+		id, ok := strings.CutSuffix(rest, suffix)
+		if !ok {
+			id, ok = strings.CutSuffix(rest, wildcardKey(suffix))
+		}
+		if ok {
+			out = append(out, &apiv1.LookupResourcesResponse{
+				ResourceObjectId: id,
+				Permissionship:   apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION,
+			})
+		}
+	}
+	for key := range f.conditional {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		id, ok := strings.CutSuffix(rest, suffix)
+		if !ok || f.allowed[key] {
+			continue
+		}
+		item := &apiv1.LookupResourcesResponse{
+			ResourceObjectId: id,
+			Permissionship:   apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_CONDITIONAL_PERMISSION,
+		}
+		switch p, _ := f.permissionship(key, in.GetContext()); p {
+		case apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION:
+			item.Permissionship = apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION
+		case apiv1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION:
+			continue
+		}
+		out = append(out, item)
+	}
+	return &fakeStream[apiv1.LookupResourcesResponse]{items: out}, nil
+}
+
+func (f *fakeSpiceDB) ReadSchema(context.Context, *apiv1.ReadSchemaRequest, ...grpc.CallOption) (*apiv1.ReadSchemaResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &apiv1.ReadSchemaResponse{SchemaText: f.schema, ReadAt: &apiv1.ZedToken{Token: "fake-revision"}}, nil
+}
+
+func (f *fakeSpiceDB) WriteSchema(_ context.Context, in *apiv1.WriteSchemaRequest, _ ...grpc.CallOption) (*apiv1.WriteSchemaResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schema = in.GetSchema()
+	return &apiv1.WriteSchemaResponse{WrittenAt: &apiv1.ZedToken{Token: "fake-revision"}}, nil
+}
+
+func (f *fakeSpiceDB) WriteRelationships(_ context.Context, in *apiv1.WriteRelationshipsRequest, _ ...grpc.CallOption) (*apiv1.WriteRelationshipsResponse, error) {
+	if f.beforeWrite != nil {
+		f.beforeWrite()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failWriteAfter > 0 {
+		f.failWriteAfter--
+	} else if f.failWrite != nil {
+		return nil, f.failWrite
+	}
+	for _, u := range in.GetUpdates() {
+		rel := u.GetRelationship()
+		key := tupleKey(rel.GetResource(), f.grants[rel.GetRelation()], rel.GetSubject())
+		relKey := tupleKey(rel.GetResource(), rel.GetRelation(), rel.GetSubject())
+		delete(f.expires, key)
+		if u.GetOperation() == apiv1.RelationshipUpdate_OPERATION_DELETE {
+			delete(f.allowed, key)
+			delete(f.relationships, relKey)
+		} else {
+			f.allowed[key] = true
+			f.relationships[relKey] = rel
+			if exp := rel.GetOptionalExpiresAt(); exp != nil {
+				f.expires[key] = exp.AsTime()
+			}
+		}
+	}
+	return &apiv1.WriteRelationshipsResponse{WrittenAt: &apiv1.ZedToken{Token: "fake-revision"}}, nil
+}
+
+func (f *fakeSpiceDB) DeleteRelationships(ctx context.Context, in *apiv1.DeleteRelationshipsRequest, _ ...grpc.CallOption) (*apiv1.DeleteRelationshipsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	filter := in.GetRelationshipFilter()
+	obj := filter.GetResourceType() + ":" + filter.GetOptionalResourceId()
+	f.deleted = append(f.deleted, obj)
+	for key := range f.allowed {
+		if strings.HasPrefix(key, obj+"#") {
+			delete(f.allowed, key)
+		}
+	}
+	for key := range f.relationships {
+		if strings.HasPrefix(key, obj+"#") {
+			delete(f.relationships, key)
+		}
+	}
+	return &apiv1.DeleteRelationshipsResponse{DeletedAt: &apiv1.ZedToken{Token: "fake-revision"}}, nil
+}
+
+func (f *fakeSpiceDB) ReadRelationships(_ context.Context, in *apiv1.ReadRelationshipsRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[apiv1.ReadRelationshipsResponse], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	filter := in.GetRelationshipFilter()
+	var out []*apiv1.ReadRelationshipsResponse
+	for _, rel := range f.relationships {
+		res := rel.GetResource()
+		if res.GetObjectType() != filter.GetResourceType() {
+			continue
+		}
+		if id := filter.GetOptionalResourceId(); id != "" && res.GetObjectId() != id {
+			continue
+		}
+		if r := filter.GetOptionalRelation(); r != "" && rel.GetRelation() != r {
+			continue
+		}
+		out = append(out, &apiv1.ReadRelationshipsResponse{Relationship: rel})
+	}
+	return &fakeStream[apiv1.ReadRelationshipsResponse]{items: out}, nil
+}
+
+func (f *fakeSpiceDB) deletedObjects() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.deleted...)
+}
+
+// tuples returns the currently granted tuples.
+func (f *fakeSpiceDB) tuples() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := make([]string, 0, len(f.allowed))
+	for key := range f.allowed {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (f *fakeSpiceDB) bulkRequestSizes() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.bulkRequests...)
+}
+
+func (f *fakeSpiceDB) checkCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checks
+}
+
+// fakeStream replays a fixed list of server-streamed messages.
+func (f *fakeSpiceDB) Watch(ctx context.Context, in *apiv1.WatchRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[apiv1.WatchResponse], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.watchCursors = append(f.watchCursors, in.GetOptionalStartCursor())
+	return &chanStream[apiv1.WatchResponse]{ctx: ctx, ch: f.watch}, nil
+}
+
+// chanStream is a server stream fed by a channel. It ends with io.EOF
+// when the channel is closed.
+type chanStream[T any] struct {
+	grpc.ClientStream
+	ctx context.Context
+	ch  <-chan *T
+}
+
+func (s *chanStream[T]) Recv() (*T, error) {
+	select {
+	case item, ok := <-s.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return item, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+type fakeStream[T any] struct {
+	grpc.ClientStream
+	items []*T
+}
+
+func (s *fakeStream[T]) Recv() (*T, error) {
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
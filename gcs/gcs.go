@@ -0,0 +1,252 @@
+// Package gcs lists and reads the objects of a Google Cloud Storage
+// bucket over its JSON API. A Bucket's Source feeds loader.Ingest:
+//
+//	bucket := gcs.New("acme-docs", gcs.WithTokenSource(token))
+//	res, err := loader.Ingest(ctx, bucket.Source("teams/"), pipeline,
+//		loader.WithObjectFunc(loader.ObjectFromPath(`^(?P<team>[^/]+)/`, "folder:$team")))
+//
+// Documents carry the bucket, name and ETag of their object as metadata,
+// and the object's generation under GenerationKey. A pipeline configured
+// WithChunker chunks them as they are added.
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// GenerationKey is the metadata key holding the generation of the object
+// a document was ingested from.
+const GenerationKey = "generation"
+
+// APIError is a non-2xx response from Cloud Storage.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gcs: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Object describes an object in a bucket.
+type Object struct {
+	Name       string
+	ETag       string
+	Generation string
+	Size       int64
+	Updated    time.Time
+}
+
+// Bucket is a Cloud Storage bucket.
+type Bucket struct {
+	name       string
+	endpoint   string
+	token      func(ctx context.Context) (string, error)
+	httpClient *http.Client
+}
+
+// Option configures a Bucket.
+type Option func(*Bucket)
+
+// WithEndpoint addresses another server than
+// "https://storage.googleapis.com", such as an emulator.
+func WithEndpoint(endpoint string) Option {
+	return func(b *Bucket) {
+		b.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithTokenSource authorizes requests with the OAuth 2.0 access tokens
+// token returns, e.g. from golang.org/x/oauth2/google's default
+// credentials. It is called for every request, so it should cache.
+// Without one requests are anonymous, which suits public buckets.
+func WithTokenSource(token func(ctx context.Context) (string, error)) Option {
+	return func(b *Bucket) {
+		b.token = token
+	}
+}
+
+// WithToken authorizes requests with a fixed access token.
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or to
+// use a client that authorizes requests itself.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(b *Bucket) {
+		b.httpClient = hc
+	}
+}
+
+// New returns the bucket named name.
+func New(name string, opts ...Option) *Bucket {
+	b := &Bucket{
+		name:       name,
+		endpoint:   "https://storage.googleapis.com",
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Name returns the bucket's name.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// List yields the objects whose names start with prefix, in name order,
+// fetching a page of up to 1000 at a time.
+func (b *Bucket) List(ctx context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		var token string
+		for {
+			q := url.Values{"prefix": {prefix}, "fields": {"items(name,etag,generation,size,updated),nextPageToken"}}
+			if token != "" {
+				q.Set("pageToken", token)
+			}
+			var page struct {
+				Items []struct {
+					Name       string    `json:"name"`
+					ETag       string    `json:"etag"`
+					Generation string    `json:"generation"`
+					Size       string    `json:"size"`
+					Updated    time.Time `json:"updated"`
+				} `json:"items"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			resp, err := b.do(ctx, "/storage/v1/b/"+url.PathEscape(b.name)+"/o", q)
+			if err == nil {
+				err = json.NewDecoder(resp.Body).Decode(&page)
+				resp.Body.Close()
+			}
+			if err != nil {
+				yield(Object{}, fmt.Errorf("gcs: listing %s/%s: %w", b.name, prefix, err))
+				return
+			}
+			for _, item := range page.Items {
+				size, _ := strconv.ParseInt(item.Size, 10, 64)
+				obj := Object{Name: item.Name, ETag: item.ETag, Generation: item.Generation, Size: size, Updated: item.Updated}
+				if !yield(obj, nil) {
+					return
+				}
+			}
+			if page.NextPageToken == "" {
+				return
+			}
+			token = page.NextPageToken
+		}
+	}
+}
+
+// Open returns the content of the object name. The caller closes it.
+func (b *Bucket) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.open(ctx, name, "")
+}
+
+// open reads generation of the object name, or its latest with "".
+func (b *Bucket) open(ctx context.Context, name, generation string) (io.ReadCloser, error) {
+	q := url.Values{"alt": {"media"}}
+	if generation != "" {
+		q.Set("generation", generation)
+	}
+	resp, err := b.do(ctx, "/storage/v1/b/"+url.PathEscape(b.name)+"/o/"+url.PathEscape(name), q)
+	if err != nil {
+		return nil, fmt.Errorf("gcs: reading %s/%s: %w", b.name, name, err)
+	}
+	return resp.Body, nil
+}
+
+// Source returns a loader.Source over the objects under prefix. A file's
+// Path is its name without prefix, its Location "gs://bucket/name", and
+// its metadata holds the bucket, name, ETag and generation; the listed
+// generation is the one read. Names ending in "/", which consoles create
+// as folder markers, are left out.
+func (b *Bucket) Source(prefix string) loader.Source {
+	return source{bucket: b, prefix: prefix}
+}
+
+type source struct {
+	bucket *Bucket
+	prefix string
+}
+
+func (s source) Files(ctx context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		for obj, err := range s.bucket.List(ctx, s.prefix) {
+			if err != nil {
+				yield(loader.File{}, err)
+				return
+			}
+			path := strings.TrimLeft(strings.TrimPrefix(obj.Name, s.prefix), "/")
+			if path == "" || strings.HasSuffix(obj.Name, "/") {
+				continue
+			}
+			f := loader.File{
+				Path:     path,
+				Location: "gs://" + s.bucket.name + "/" + obj.Name,
+				Metadata: map[string]string{
+					loader.BucketKey:     s.bucket.name,
+					loader.ObjectNameKey: obj.Name,
+					loader.ETagKey:       obj.ETag,
+					GenerationKey:        obj.Generation,
+				},
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					return s.bucket.open(ctx, obj.Name, obj.Generation)
+				},
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// do sends a GET for path with query q, returning a 2xx response.
+func (b *Bucket) do(ctx context.Context, path string, q url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.endpoint+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.token != nil {
+		token, err := b.token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := http.StatusText(resp.StatusCode)
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil && body.Error.Message != "" {
+			msg = body.Error.Message
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return resp, nil
+}
@@ -0,0 +1,144 @@
+package gcs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/gcs"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+var objects = map[string]string{
+	"kb/eng/runbook.md":  "# Runbook\n\nRestart the service.",
+	"kb/eng/on call.txt": "Pager rotation.",
+	"kb/hr/":             "",
+	"kb/hr/policy.html":  "<title>Leave</title><p>Leave policy.</p>",
+	"other/ignored.md":   "Not under the prefix.",
+}
+
+var names = []string{"kb/eng/on call.txt", "kb/eng/runbook.md", "kb/hr/", "kb/hr/policy.html", "other/ignored.md"}
+
+// fakeGCS serves the JSON API's object listing, two per page, and media
+// downloads for the bucket "docs".
+func fakeGCS(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": 401, "message": "Anonymous caller does not have storage.objects.list access."}})
+			return
+		}
+		if r.URL.EscapedPath() == "/storage/v1/b/docs/o" {
+			var matching []string
+			for _, n := range names {
+				if strings.HasPrefix(n, r.URL.Query().Get("prefix")) {
+					matching = append(matching, n)
+				}
+			}
+			start := 0
+			if tok := r.URL.Query().Get("pageToken"); tok != "" {
+				start = len(tok)
+			}
+			end := min(start+2, len(matching))
+			var items []map[string]string
+			for _, n := range matching[start:end] {
+				items = append(items, map[string]string{"name": n, "etag": "E" + n, "generation": "17", "size": "3", "updated": "2024-03-01T10:00:00Z"})
+			}
+			page := map[string]any{"items": items}
+			if end < len(matching) {
+				page["nextPageToken"] = strings.Repeat("x", end)
+			}
+			_ = json.NewEncoder(w).Encode(page)
+			return
+		}
+		name, ok := strings.CutPrefix(r.URL.EscapedPath(), "/storage/v1/b/docs/o/")
+		if !ok || strings.Contains(name, "/") || r.URL.Query().Get("alt") != "media" {
+			http.NotFound(w, r)
+			return
+		}
+		name = strings.ReplaceAll(strings.ReplaceAll(name, "%2F", "/"), "%20", " ")
+		content, ok := objects[name]
+		if !ok || r.URL.Query().Get("generation") != "17" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": 404, "message": "No such object: docs/" + name}})
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type recordingIngester struct{ docs []rag.Document }
+
+func (r *recordingIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	r.docs = append(r.docs, doc)
+	return nil, nil
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	bucket := gcs.New("docs", gcs.WithEndpoint(fakeGCS(t).URL), gcs.WithToken("token"))
+	var got []string
+	for obj, err := range bucket.List(context.Background(), "kb/") {
+		require.NoError(t, err)
+		require.Equal(t, int64(3), obj.Size)
+		require.Equal(t, "17", obj.Generation)
+		got = append(got, obj.Name)
+	}
+	require.Equal(t, names[:4], got, "all pages")
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	bucket := gcs.New("docs", gcs.WithEndpoint(fakeGCS(t).URL), gcs.WithToken("token"))
+	res, err := loader.Ingest(context.Background(), bucket.Source("kb/"), &recordingIngester{},
+		loader.WithObjectFunc(loader.ObjectFromPath(`^(?P<team>[^/]+)/`, "folder:$team")))
+	require.NoError(t, err)
+	require.Len(t, res.Documents, 3)
+
+	onCall := res.Documents[0]
+	require.Equal(t, "eng/on_call", onCall.ID)
+	require.Equal(t, "Pager rotation.", onCall.Text)
+	require.Equal(t, map[string]string{
+		rag.SpiceDBObjectKey: "folder:eng",
+		loader.FormatKey:     "text",
+		loader.SourceKey:     "gs://docs/kb/eng/on call.txt",
+		loader.BucketKey:     "docs",
+		loader.ObjectNameKey: "kb/eng/on call.txt",
+		loader.ETagKey:       "Ekb/eng/on call.txt",
+		gcs.GenerationKey:    "17",
+	}, onCall.Metadata)
+	require.Equal(t, "Leave", res.Documents[2].Metadata[loader.TitleKey])
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeGCS(t)
+	_, err := gcs.New("docs", gcs.WithEndpoint(srv.URL), gcs.WithToken("token")).Open(context.Background(), "kb/missing.md")
+	var apiErr *gcs.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Contains(t, apiErr.Message, "No such object")
+
+	_, err = loader.Ingest(context.Background(), gcs.New("docs", gcs.WithEndpoint(srv.URL)).Source(""), &recordingIngester{})
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	boom := errors.New("no credentials")
+	bucket := gcs.New("docs", gcs.WithEndpoint(srv.URL), gcs.WithTokenSource(func(context.Context) (string, error) { return "", boom }))
+	_, err = bucket.Open(context.Background(), "kb/hr/policy.html")
+	require.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,457 @@
+// Package gdrive ingests Google Drive files and mirrors their sharing
+// into SpiceDB, so the pipeline enforces the access users already have
+// in Drive. A Drive's Source feeds loader.Ingest:
+//
+//	drive := gdrive.New(gdrive.WithTokenSource(token))
+//	res, err := loader.Ingest(ctx, drive.Source(folderID), pipeline)
+//
+// Every file becomes a document whose object is "document:<file ID>",
+// and its permissions are written as that object's owner and viewer
+// relationships with SetAccess, replacing those of an earlier run:
+// revoking a share in Drive revokes it here on the next ingestion. The
+// schema needs relations the mapped subjects fit, e.g.
+//
+//	definition document {
+//	  relation owner: user
+//	  relation viewer: user | group#member
+//	  permission read = owner + viewer
+//	}
+//
+// Google Docs, Sheets and Slides are exported as plain text or CSV;
+// other files are loaded by type, and those without a loader skipped.
+package gdrive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// Metadata keys set on the documents.
+const (
+	FileIDKey   = "drive_file_id"
+	MimeTypeKey = "mime_type"
+	ModifiedKey = "modified_time"
+	LinkKey     = "web_link"
+)
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// exports are the formats Google's own file types are exported in.
+var exports = map[string]string{
+	"application/vnd.google-apps.document":     "text/plain",
+	"application/vnd.google-apps.spreadsheet":  "text/csv",
+	"application/vnd.google-apps.presentation": "text/plain",
+}
+
+// loaders are the loaders of the MIME types Drive reports.
+var loaders = map[string]loader.Loader{
+	"application/pdf": loader.PDF{},
+	"text/html":       loader.HTML{},
+	"text/markdown":   loader.Markdown{},
+	"text/plain":      loader.Text{},
+	"text/csv":        loader.Text{},
+}
+
+// DefaultRoles maps Drive roles to relations: the owner to "owner" and
+// every role that can read the file to "viewer".
+var DefaultRoles = map[string]string{
+	"owner":         "owner",
+	"organizer":     "viewer",
+	"fileOrganizer": "viewer",
+	"writer":        "viewer",
+	"commenter":     "viewer",
+	"reader":        "viewer",
+}
+
+// APIError is a non-2xx response from the Drive API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gdrive: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Permission is a Drive permission on a file.
+type Permission struct {
+	// Type is "user", "group", "domain" or "anyone".
+	Type string `json:"type"`
+	// Role is e.g. "owner", "writer" or "reader".
+	Role         string `json:"role"`
+	EmailAddress string `json:"emailAddress"`
+	Domain       string `json:"domain"`
+	Deleted      bool   `json:"deleted"`
+}
+
+// SubjectFunc maps a permission to the SpiceDB subject it grants, as
+// "type:id" or "type:id#relation", reporting false for permissions with
+// no subject.
+type SubjectFunc func(p Permission) (string, bool)
+
+// DefaultSubject maps users to "user:<EmailID>" and groups to
+// "group:<EmailID>#member". Domain and anyone-with-the-link permissions
+// have no subject: mapping them to "user:*" would let everyone retrieve
+// files they may never have been sent the link to.
+func DefaultSubject(p Permission) (string, bool) {
+	if p.EmailAddress == "" {
+		return "", false
+	}
+	switch p.Type {
+	case "user":
+		return "user:" + EmailID(p.EmailAddress), true
+	case "group":
+		return "group:" + EmailID(p.EmailAddress) + "#member", true
+	}
+	return "", false
+}
+
+// EmailID turns an email address into a SpiceDB object ID with
+// loader.EscapeID, lower-cased first: "Emilia@example.com" becomes
+// "emilia=40example=2ecom". The user IDs queries are made with must be
+// written the same way.
+func EmailID(email string) string {
+	return loader.EscapeID(strings.ToLower(email))
+}
+
+// Drive is a client of the Drive API v3.
+type Drive struct {
+	endpoint     string
+	token        func(ctx context.Context) (string, error)
+	httpClient   *http.Client
+	resourceType string
+	subject      SubjectFunc
+	roles        map[string]string
+}
+
+// Option configures a Drive.
+type Option func(*Drive)
+
+// WithEndpoint addresses another server than
+// "https://www.googleapis.com", such as a test double.
+func WithEndpoint(endpoint string) Option {
+	return func(d *Drive) {
+		d.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithTokenSource authorizes requests with the OAuth 2.0 access tokens
+// token returns, e.g. those of a service account with domain-wide
+// delegation. It is called for every request, so it should cache.
+func WithTokenSource(token func(ctx context.Context) (string, error)) Option {
+	return func(d *Drive) {
+		d.token = token
+	}
+}
+
+// WithToken authorizes requests with a fixed access token.
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or to
+// use a client that authorizes requests itself.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(d *Drive) {
+		d.httpClient = hc
+	}
+}
+
+// WithResourceType sets the type of the files' objects, "document" by
+// default.
+func WithResourceType(resourceType string) Option {
+	return func(d *Drive) {
+		d.resourceType = resourceType
+	}
+}
+
+// WithSubjectFunc replaces DefaultSubject, e.g. to map email addresses to
+// the IDs of an identity provider.
+func WithSubjectFunc(fn SubjectFunc) Option {
+	return func(d *Drive) {
+		d.subject = fn
+	}
+}
+
+// WithRoles replaces DefaultRoles. Permissions whose role is not in
+// roles are left out; the relations in roles are the ones SetAccess
+// replaces.
+func WithRoles(roles map[string]string) Option {
+	return func(d *Drive) {
+		d.roles = roles
+	}
+}
+
+// New returns a Drive client.
+func New(opts ...Option) *Drive {
+	d := &Drive{
+		endpoint:     "https://www.googleapis.com",
+		httpClient:   http.DefaultClient,
+		resourceType: "document",
+		subject:      DefaultSubject,
+		roles:        DefaultRoles,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// File is a Drive file.
+type File struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	MimeType     string    `json:"mimeType"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+	WebViewLink  string    `json:"webViewLink"`
+}
+
+// Source returns a loader.Source over the files in the folder folderID
+// and its subfolders, or every file the caller can see if folderID is
+// empty. A file's Path is its name below the folder, e.g.
+// "Handbook/Onboarding", and its ID the Drive file ID.
+func (d *Drive) Source(folderID string) loader.Source {
+	return source{drive: d, folder: folderID}
+}
+
+type source struct {
+	drive  *Drive
+	folder string
+}
+
+func (s source) Files(ctx context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		if s.folder == "" {
+			for f, err := range s.drive.list(ctx, "trashed = false and mimeType != '"+folderMimeType+"'") {
+				if err != nil {
+					yield(loader.File{}, err)
+					return
+				}
+				if !s.yield(ctx, f, strings.ReplaceAll(f.Name, "/", "_"), yield) {
+					return
+				}
+			}
+			return
+		}
+		s.walk(ctx, s.folder, "", make(map[string]bool), yield)
+	}
+}
+
+// walk yields the files under folder, whose path is dir, reporting false
+// once iteration stopped.
+func (s source) walk(ctx context.Context, folder, dir string, seen map[string]bool, yield func(loader.File, error) bool) bool {
+	if seen[folder] {
+		return true
+	}
+	seen[folder] = true
+	q := "'" + strings.ReplaceAll(folder, "'", `\'`) + "' in parents and trashed = false"
+	for f, err := range s.drive.list(ctx, q) {
+		if err != nil {
+			yield(loader.File{}, err)
+			return false
+		}
+		p := path.Join(dir, strings.ReplaceAll(f.Name, "/", "_"))
+		if f.MimeType == folderMimeType {
+			if !s.walk(ctx, f.ID, p, seen, yield) {
+				return false
+			}
+			continue
+		}
+		if !s.yield(ctx, f, p, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// yield turns f into a loader.File with its permissions and yields it.
+func (s source) yield(ctx context.Context, f File, p string, yield func(loader.File, error) bool) bool {
+	l, open := s.drive.content(f)
+	if open == nil {
+		// Forms, drawings and the like have no text.
+		return true
+	}
+	access, err := s.drive.access(ctx, f.ID)
+	if err != nil {
+		return yield(loader.File{}, err)
+	}
+	md := map[string]string{
+		rag.SpiceDBObjectKey: s.drive.resourceType + ":" + f.ID,
+		loader.TitleKey:      f.Name,
+		FileIDKey:            f.ID,
+		MimeTypeKey:          f.MimeType,
+	}
+	if !f.ModifiedTime.IsZero() {
+		md[ModifiedKey] = f.ModifiedTime.UTC().Format(time.RFC3339)
+	}
+	if f.WebViewLink != "" {
+		md[LinkKey] = f.WebViewLink
+	}
+	return yield(loader.File{
+		Path:     p,
+		Location: "gdrive://" + f.ID,
+		Metadata: md,
+		ID:       f.ID,
+		Loader:   l,
+		Open:     open,
+		Access:   access,
+	}, nil)
+}
+
+// content returns how to load f, with a nil open for files without text.
+func (d *Drive) content(f File) (loader.Loader, func(context.Context) (io.ReadCloser, error)) {
+	if mime, ok := exports[f.MimeType]; ok {
+		return loaders[mime], func(ctx context.Context) (io.ReadCloser, error) {
+			return d.get(ctx, "/drive/v3/files/"+url.PathEscape(f.ID)+"/export", url.Values{"mimeType": {mime}})
+		}
+	}
+	if strings.HasPrefix(f.MimeType, "application/vnd.google-apps.") {
+		return nil, nil
+	}
+	// Without a loader for the MIME type, Ingest picks one by extension.
+	return loaders[f.MimeType], func(ctx context.Context) (io.ReadCloser, error) {
+		return d.get(ctx, "/drive/v3/files/"+url.PathEscape(f.ID), url.Values{"alt": {"media"}, "supportsAllDrives": {"true"}})
+	}
+}
+
+// access maps the permissions of the file id to its Access.
+func (d *Drive) access(ctx context.Context, id string) (*loader.Access, error) {
+	access := &loader.Access{}
+	seen := make(map[string]bool)
+	for _, rel := range d.roles {
+		if !seen[rel] {
+			seen[rel] = true
+			access.Relations = append(access.Relations, rel)
+		}
+	}
+	slices.Sort(access.Relations)
+	granted := make(map[rag.ACLEntry]bool)
+	q := url.Values{
+		"fields":            {"nextPageToken,permissions(type,role,emailAddress,domain,deleted)"},
+		"supportsAllDrives": {"true"},
+	}
+	for {
+		var page struct {
+			Permissions   []Permission `json:"permissions"`
+			NextPageToken string       `json:"nextPageToken"`
+		}
+		if err := d.call(ctx, "/drive/v3/files/"+url.PathEscape(id)+"/permissions", q, &page); err != nil {
+			return nil, fmt.Errorf("gdrive: listing permissions of %s: %w", id, err)
+		}
+		for _, p := range page.Permissions {
+			rel, ok := d.roles[p.Role]
+			if !ok || p.Deleted {
+				continue
+			}
+			subject, ok := d.subject(p)
+			if !ok {
+				continue
+			}
+			entry := rag.ACLEntry{Relation: rel, Subject: subject}
+			if !granted[entry] {
+				granted[entry] = true
+				access.Entries = append(access.Entries, entry)
+			}
+		}
+		if page.NextPageToken == "" {
+			return access, nil
+		}
+		q.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// list yields the files matching the query q, folders first, by name.
+func (d *Drive) list(ctx context.Context, q string) iter.Seq2[File, error] {
+	return func(yield func(File, error) bool) {
+		params := url.Values{
+			"q":                         {q},
+			"fields":                    {"nextPageToken,files(id,name,mimeType,modifiedTime,webViewLink)"},
+			"orderBy":                   {"folder,name"},
+			"pageSize":                  {"1000"},
+			"supportsAllDrives":         {"true"},
+			"includeItemsFromAllDrives": {"true"},
+		}
+		for {
+			var page struct {
+				Files         []File `json:"files"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if err := d.call(ctx, "/drive/v3/files", params, &page); err != nil {
+				yield(File{}, fmt.Errorf("gdrive: listing files: %w", err))
+				return
+			}
+			for _, f := range page.Files {
+				if !yield(f, nil) {
+					return
+				}
+			}
+			if page.NextPageToken == "" {
+				return
+			}
+			params.Set("pageToken", page.NextPageToken)
+		}
+	}
+}
+
+// call sends a GET for path with query q and decodes the JSON response
+// into out.
+func (d *Drive) call(ctx context.Context, path string, q url.Values, out any) error {
+	body, err := d.get(ctx, path, q)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// get sends a GET for path with query q, returning a 2xx response's
+// body.
+func (d *Drive) get(ctx context.Context, path string, q url.Values) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != nil {
+		token, err := d.token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := http.StatusText(resp.StatusCode)
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil && body.Error.Message != "" {
+			msg = body.Error.Message
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return resp.Body, nil
+}
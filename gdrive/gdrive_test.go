@@ -0,0 +1,192 @@
+package gdrive_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/gdrive"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+type driveFile struct {
+	id, name, mime, parent, content string
+	permissions                     []map[string]any
+}
+
+var files = []driveFile{
+	{id: "root", name: "Team", mime: "application/vnd.google-apps.folder"},
+	{id: "eng", name: "Eng", mime: "application/vnd.google-apps.folder", parent: "root"},
+	{id: "doc1", name: "Runbook", mime: "application/vnd.google-apps.document", parent: "eng", content: "Restart the service.",
+		permissions: []map[string]any{
+			{"type": "user", "role": "owner", "emailAddress": "Emilia@example.com"},
+			{"type": "group", "role": "commenter", "emailAddress": "eng@example.com"},
+			{"type": "anyone", "role": "reader"},
+			{"type": "domain", "role": "reader", "domain": "example.com"},
+		}},
+	{id: "form1", name: "Survey", mime: "application/vnd.google-apps.form", parent: "eng"},
+	{id: "txt1", name: "Leave policy.txt", mime: "text/plain", parent: "root", content: "Leave policy.",
+		permissions: []map[string]any{
+			{"type": "user", "role": "writer", "emailAddress": "beatrice@example.com"},
+			{"type": "user", "role": "reader", "emailAddress": "carl@example.com", "deleted": true},
+		}},
+}
+
+// fakeDrive serves files.list, one file per page, permissions.list,
+// exports and media downloads over files.
+func fakeDrive(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": 401, "message": "Request is missing required authentication credential."}})
+			return
+		}
+		q := r.URL.Query()
+		if r.URL.Path == "/drive/v3/files" {
+			var matching []driveFile
+			for _, f := range files {
+				if strings.HasPrefix(q.Get("q"), fmt.Sprintf("'%s' in parents", f.parent)) {
+					matching = append(matching, f)
+				}
+			}
+			start := len(q.Get("pageToken"))
+			page := map[string]any{"files": []map[string]string{}}
+			if start < len(matching) {
+				f := matching[start]
+				page["files"] = []map[string]string{{"id": f.id, "name": f.name, "mimeType": f.mime, "modifiedTime": "2024-03-01T10:00:00Z"}}
+				if start+1 < len(matching) {
+					page["nextPageToken"] = strings.Repeat("x", start+1)
+				}
+			}
+			_ = json.NewEncoder(w).Encode(page)
+			return
+		}
+		rest, _ := strings.CutPrefix(r.URL.Path, "/drive/v3/files/")
+		id, action, _ := strings.Cut(rest, "/")
+		for _, f := range files {
+			if f.id != id {
+				continue
+			}
+			switch {
+			case action == "permissions":
+				_ = json.NewEncoder(w).Encode(map[string]any{"permissions": f.permissions})
+			case action == "export" && q.Get("mimeType") == "text/plain" && strings.HasPrefix(f.mime, "application/vnd.google-apps."):
+				_, _ = w.Write([]byte(f.content))
+			case action == "" && q.Get("alt") == "media":
+				_, _ = w.Write([]byte(f.content))
+			default:
+				http.Error(w, "bad request", http.StatusBadRequest)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": 404, "message": "File not found: " + id + "."}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// accessIngester records documents and the access set on them.
+type accessIngester struct {
+	docs   []rag.Document
+	access map[string][]rag.ACLEntry
+}
+
+func (a *accessIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	a.docs = append(a.docs, doc)
+	return nil, nil
+}
+
+func (a *accessIngester) SetAccess(_ context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	if a.access == nil {
+		a.access = make(map[string][]rag.ACLEntry)
+	}
+	a.access[object+" "+strings.Join(relations, ",")] = entries
+	return nil, nil
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	drive := gdrive.New(gdrive.WithEndpoint(fakeDrive(t).URL), gdrive.WithToken("token"))
+	dst := &accessIngester{}
+	res, err := loader.Ingest(context.Background(), drive.Source("root"), dst)
+	require.NoError(t, err)
+	require.Len(t, res.Documents, 2, "the form has no text")
+
+	runbook := res.Documents[0]
+	require.Equal(t, "doc1", runbook.ID)
+	require.Equal(t, "Restart the service.", runbook.Text)
+	require.Equal(t, map[string]string{
+		rag.SpiceDBObjectKey: "document:doc1",
+		loader.TitleKey:      "Runbook",
+		loader.FormatKey:     "text",
+		loader.SourceKey:     "gdrive://doc1",
+		gdrive.FileIDKey:     "doc1",
+		gdrive.MimeTypeKey:   "application/vnd.google-apps.document",
+		gdrive.ModifiedKey:   "2024-03-01T10:00:00Z",
+	}, runbook.Metadata)
+	require.Equal(t, "Leave policy.", res.Documents[1].Text)
+
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"document:doc1 owner,viewer": {
+			{Relation: "owner", Subject: "user:emilia=40example=2ecom"},
+			{Relation: "viewer", Subject: "group:eng=40example=2ecom#member"},
+		},
+		"document:txt1 owner,viewer": {
+			{Relation: "viewer", Subject: "user:beatrice=40example=2ecom"},
+		},
+	}, dst.access, "link and domain sharing and deleted permissions are left out")
+}
+
+func TestSubjectAndRoleMapping(t *testing.T) {
+	t.Parallel()
+
+	drive := gdrive.New(gdrive.WithEndpoint(fakeDrive(t).URL), gdrive.WithToken("token"),
+		gdrive.WithResourceType("file"),
+		gdrive.WithRoles(map[string]string{"owner": "editor", "writer": "editor"}),
+		gdrive.WithSubjectFunc(func(p gdrive.Permission) (string, bool) {
+			if p.Type == "anyone" {
+				return "user:*", true
+			}
+			return gdrive.DefaultSubject(p)
+		}))
+	dst := &accessIngester{}
+	_, err := loader.Ingest(context.Background(), drive.Source("root"), dst, loader.WithInclude("Eng/**"))
+	require.NoError(t, err)
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"file:doc1 editor": {{Relation: "editor", Subject: "user:emilia=40example=2ecom"}},
+	}, dst.access, "roles outside the mapping are left out")
+}
+
+func TestEmailID(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "emilia=40example=2ecom", gdrive.EmailID("Emilia@Example.com"))
+	require.Equal(t, "a_b-c=2bd=3d=40x", gdrive.EmailID("a_b-c+d=@x"))
+	require.NotEqual(t, gdrive.EmailID("a.b@x"), gdrive.EmailID("a_b@x"))
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeDrive(t)
+	_, err := loader.Ingest(context.Background(), gdrive.New(gdrive.WithEndpoint(srv.URL)).Source("root"), &accessIngester{})
+	var apiErr *gdrive.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	require.Contains(t, apiErr.Message, "authentication")
+
+	_, err = loader.Ingest(context.Background(), gdrive.New(gdrive.WithEndpoint(srv.URL), gdrive.WithToken("token")).Source("root"),
+		&struct{ loader.Ingester }{&accessIngester{}})
+	require.ErrorContains(t, err, "cannot set access", "files with access need an ingester that can set it")
+}
@@ -0,0 +1,136 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrNoGenerator is returned by Answer when the pipeline was built
+	// without WithGenerator.
+	ErrNoGenerator = errors.New("rag: no generator configured")
+
+	// ErrNoSources is returned by Answer when the user may read none of
+	// the retrieved documents. The generator is not called, so it cannot
+	// answer from its own knowledge as if the corpus backed it.
+	ErrNoSources = errors.New("rag: no authorized sources for question")
+
+	// ErrNoRetrieverResults is returned by Answer, together with
+	// ErrNoSources, when nothing was retrieved for the question at all,
+	// so an empty index can be told apart from a user who may read none
+	// of what was found. Query returns no documents and no error instead.
+	ErrNoRetrieverResults = errors.New("rag: retriever returned no documents")
+)
+
+// Generator produces a completion for a prompt, typically by calling an
+// LLM.
+type Generator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// GeneratorFunc adapts a plain function to a Generator.
+type GeneratorFunc func(ctx context.Context, prompt string) (string, error)
+
+// Generate calls f(ctx, prompt).
+func (f GeneratorFunc) Generate(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+// WithGenerator sets the Generator used by Answer.
+func WithGenerator(g Generator) Option {
+	return func(r *RAGPipeline) {
+		r.generator = g
+	}
+}
+
+// AnswerResponse is the result of Answer.
+type AnswerResponse struct {
+	// Answer is the generator's completion.
+	Answer string
+
+	// Sources are the authorized documents the prompt was built from.
+	Sources []Document
+
+	// Citations are the source markers found in Answer, in order. See
+	// Citation.
+	Citations []Citation
+
+	// Stats describes the retrieval and filtering work.
+	Stats Stats
+}
+
+// Answer retrieves the documents relevant to question, keeps those userID
+// may read, and asks the Generator to answer from them. Only authorized
+// documents ever reach the prompt. question is used as the retrieval
+// query as is, so it suits a semantic Retriever (see VectorRetriever)
+// better than the built-in substring scan.
+func (r *RAGPipeline) Answer(ctx context.Context, userID, question string, opts ...QueryOption) (*AnswerResponse, error) {
+	prompt, resp, err := r.prepareAnswer(ctx, userID, question, opts)
+	if err != nil {
+		return nil, err
+	}
+	genCtx, span := r.startGenerate(ctx, prompt, resp)
+	answer, err := r.generator.Generate(genCtx, prompt)
+	endSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("rag: generation: %w", err)
+	}
+	return &AnswerResponse{
+		Answer:    answer,
+		Sources:   resp.Documents,
+		Citations: r.citations(answer, resp.Documents),
+		Stats:     resp.Stats,
+	}, nil
+}
+
+// prepareAnswer runs the retrieval and permission filtering for question
+// and builds the prompt from the authorized documents.
+func (r *RAGPipeline) prepareAnswer(ctx context.Context, userID, question string, opts []QueryOption) (string, *QueryResponse, error) {
+	if r.generator == nil {
+		return "", nil, ErrNoGenerator
+	}
+
+	qc := newQueryConfig(opts)
+	resp, err := r.do(ctx, qc.request(userID, question))
+	if err == nil {
+		resp.withholdShadowed()
+	}
+	if err == nil && resp.Stats.Candidates == 0 {
+		err = fmt.Errorf("%w: %w", ErrNoSources, ErrNoRetrieverResults)
+	} else if err == nil && len(resp.Documents) == 0 {
+		err = ErrNoSources
+	} else if err == nil && r.contextBudget != nil {
+		err = r.contextBudget.pack(resp)
+	}
+	if qc.stats != nil {
+		*qc.stats = resp.Stats
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	build := r.prompt
+	if build == nil {
+		build = DefaultPrompt
+	}
+	prompt, err := build(question, resp.Documents)
+	if err != nil {
+		return "", nil, fmt.Errorf("rag: building prompt: %w", err)
+	}
+	return prompt, resp, nil
+}
+
+// startGenerate starts the "rag.generate" span of an Answer or
+// AnswerStream call.
+func (r *RAGPipeline) startGenerate(ctx context.Context, prompt string, resp *QueryResponse) (context.Context, trace.Span) {
+	return r.tracer().Start(ctx, "rag.generate", trace.WithAttributes(
+		attribute.Int("rag.sources", len(resp.Documents)),
+		attribute.Int("rag.prompt_bytes", len(prompt)),
+		attribute.Int("rag.context_tokens", resp.Stats.ContextTokens),
+		attribute.Int("rag.unpacked", resp.Stats.Unpacked),
+	))
+}
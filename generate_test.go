@@ -0,0 +1,84 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// recordingGenerator answers with a fixed string and records its prompts.
+type recordingGenerator struct {
+	answer  string
+	err     error
+	prompts []string
+}
+
+func (g *recordingGenerator) Generate(_ context.Context, prompt string) (string, error) {
+	g.prompts = append(g.prompts, prompt)
+	return g.answer, g.err
+}
+
+func TestAnswerUsesOnlyAuthorizedSources(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc2#read@user:emilia")
+	gen := &recordingGenerator{answer: "42"}
+	rt := &staticRetriever{docs: syntheticCorpus(3)}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(rt), rag.WithGenerator(gen))
+
+	resp, err := pipeline.Answer(context.Background(), "emilia", "what is the answer?")
+	require.NoError(t, err)
+	require.Equal(t, "42", resp.Answer)
+	requireEqualDocIDs(t, []string{"doc2"}, resp.Sources)
+	require.Equal(t, 2, resp.Stats.Denied)
+
+	require.Len(t, gen.prompts, 1)
+	want, err := rag.DefaultPrompt("what is the answer?", resp.Sources)
+	require.NoError(t, err)
+	require.Equal(t, want, gen.prompts[0])
+	require.Contains(t, gen.prompts[0], resp.Sources[0].Text)
+	for _, d := range rt.docs {
+		if d.ID != "doc2" {
+			require.NotContains(t, gen.prompts[0], "("+d.ID+")")
+		}
+	}
+}
+
+func TestAnswerWithoutSourcesSkipsGeneration(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	gen := &recordingGenerator{answer: "made up"}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3), rag.WithGenerator(gen))
+
+	_, err := pipeline.Answer(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, rag.ErrNoSources)
+	require.NotErrorIs(t, err, rag.ErrNoRetrieverResults)
+	require.Empty(t, gen.prompts)
+
+	// Nothing retrieved at all is reported as such.
+	_, err = pipeline.Answer(context.Background(), "emilia", "no such text")
+	require.ErrorIs(t, err, rag.ErrNoSources)
+	require.ErrorIs(t, err, rag.ErrNoRetrieverResults)
+	require.Empty(t, gen.prompts)
+}
+
+func TestAnswerErrors(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc0#read@user:emilia")
+	_, err := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(1)).
+		Answer(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, rag.ErrNoGenerator)
+
+	boom := errors.New("rate limited")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(1),
+		rag.WithGenerator(&recordingGenerator{err: boom}),
+		rag.WithPromptFunc(func(q string, sources []rag.Document) (string, error) { return q, nil }))
+	_, err = pipeline.Answer(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,451 @@
+// Package github ingests the README, docs and issues of GitHub
+// repositories and mirrors who may read each repository into SpiceDB. A
+// Client's Source feeds loader.Ingest:
+//
+//	client := github.New(github.WithToken(os.Getenv("GITHUB_TOKEN")))
+//	res, err := loader.Ingest(ctx, client.Source("acme", "webapp"), pipeline,
+//		loader.WithExclude("issues/**"))
+//
+// A file's object is its repository, "repository:acme/webapp", and the
+// repository's collaborators and teams are written as that object's
+// owner (admins) and viewer relationships with SetAccess, replacing
+// those of an earlier run. Public repositories are also readable by
+// everyone, "user:*". Listing collaborators needs a token with push
+// access. The schema needs a repository definition the mapped subjects
+// fit:
+//
+//	definition repository {
+//	  relation owner: user | team#member
+//	  relation viewer: user | user:* | team#member
+//	  permission read = owner + viewer
+//	}
+//
+// A pipeline configured WithChunker chunks files as they are added.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// Metadata keys set on the documents.
+const (
+	RepositoryKey = "repository"
+	PathKey       = "path"
+	SHAKey        = "sha"
+	IssueKey      = "issue"
+	StateKey      = "state"
+	UpdatedKey    = "updated_at"
+)
+
+// APIError is a non-2xx response from GitHub.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Subject is a collaborator or team with access to a repository.
+type Subject struct {
+	// Type is "user" or "team".
+	Type string
+	// ID is a user's login, or a team's organization and slug as
+	// "org/slug".
+	ID string
+}
+
+// SubjectFunc maps a GitHub subject to the SpiceDB subject it stands
+// for, as "type:id" or "type:id#relation", reporting false for subjects
+// with none.
+type SubjectFunc func(s Subject) (string, bool)
+
+// DefaultSubject maps users to "user:<login>" and teams to
+// "team:<org>/<slug>#member", lower-cased as GitHub compares them.
+func DefaultSubject(s Subject) (string, bool) {
+	switch s.Type {
+	case "user":
+		return "user:" + strings.ToLower(s.ID), true
+	case "team":
+		return "team:" + strings.ToLower(s.ID) + "#member", true
+	}
+	return "", false
+}
+
+// Client is a client of GitHub's REST API.
+type Client struct {
+	endpoint      string
+	token         string
+	httpClient    *http.Client
+	resourceType  string
+	subject       SubjectFunc
+	publicSubject string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithEndpoint addresses another server than "https://api.github.com",
+// e.g. "https://github.acme.com/api/v3" for GitHub Enterprise Server.
+func WithEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithToken authenticates with a personal access or installation token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithResourceType sets the type of the repositories' objects,
+// "repository" by default.
+func WithResourceType(resourceType string) Option {
+	return func(c *Client) {
+		c.resourceType = resourceType
+	}
+}
+
+// WithSubjectFunc replaces DefaultSubject, e.g. to map logins to the IDs
+// of an identity provider.
+func WithSubjectFunc(fn SubjectFunc) Option {
+	return func(c *Client) {
+		c.subject = fn
+	}
+}
+
+// WithPublicSubject sets the subject public repositories are readable
+// by, "user:*" by default; "" leaves them to their collaborators.
+func WithPublicSubject(subject string) Option {
+	return func(c *Client) {
+		c.publicSubject = subject
+	}
+}
+
+// New returns a GitHub client.
+func New(opts ...Option) *Client {
+	c := &Client{
+		endpoint:      "https://api.github.com",
+		httpClient:    http.DefaultClient,
+		resourceType:  "repository",
+		subject:       DefaultSubject,
+		publicSubject: "user:*",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Repository describes a repository.
+type Repository struct {
+	FullName      string `json:"full_name"`
+	Private       bool   `json:"private"`
+	Visibility    string `json:"visibility"`
+	DefaultBranch string `json:"default_branch"`
+	HTMLURL       string `json:"html_url"`
+}
+
+// Repository returns the repository owner/repo.
+func (c *Client) Repository(ctx context.Context, owner, repo string) (*Repository, error) {
+	var r Repository
+	if err := c.call(ctx, repoPath(owner, repo), nil, &r); err != nil {
+		return nil, fmt.Errorf("github: reading %s/%s: %w", owner, repo, err)
+	}
+	return &r, nil
+}
+
+// Access returns who may read the repository owner/repo as relationships
+// on its object: admins as owners, everyone else with access as viewers.
+func (c *Client) Access(ctx context.Context, owner, repo string) (*loader.Access, error) {
+	r, err := c.Repository(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.access(ctx, owner, repo, r)
+}
+
+func (c *Client) access(ctx context.Context, owner, repo string, r *Repository) (*loader.Access, error) {
+	access := &loader.Access{Relations: []string{"owner", "viewer"}}
+	granted := make(map[rag.ACLEntry]bool)
+	grant := func(rel, subject string) {
+		entry := rag.ACLEntry{Relation: rel, Subject: subject}
+		if !granted[entry] {
+			granted[entry] = true
+			access.Entries = append(access.Entries, entry)
+		}
+	}
+	if !r.Private && r.Visibility != "internal" && c.publicSubject != "" {
+		grant("viewer", c.publicSubject)
+	}
+
+	for page, err := range pages[struct {
+		Login       string          `json:"login"`
+		Permissions map[string]bool `json:"permissions"`
+	}](ctx, c, repoPath(owner, repo)+"/collaborators", url.Values{"affiliation": {"all"}}) {
+		if err != nil {
+			return nil, fmt.Errorf("github: listing collaborators of %s/%s: %w", owner, repo, err)
+		}
+		for _, u := range page {
+			rel := "viewer"
+			if u.Permissions["admin"] {
+				rel = "owner"
+			}
+			if subject, ok := c.subject(Subject{Type: "user", ID: u.Login}); ok {
+				grant(rel, subject)
+			}
+		}
+	}
+	for page, err := range pages[struct {
+		Slug       string `json:"slug"`
+		Permission string `json:"permission"`
+	}](ctx, c, repoPath(owner, repo)+"/teams", nil) {
+		if err != nil {
+			return nil, fmt.Errorf("github: listing teams of %s/%s: %w", owner, repo, err)
+		}
+		for _, t := range page {
+			rel := "viewer"
+			if t.Permission == "admin" {
+				rel = "owner"
+			}
+			if subject, ok := c.subject(Subject{Type: "team", ID: owner + "/" + t.Slug}); ok {
+				grant(rel, subject)
+			}
+		}
+	}
+	return access, nil
+}
+
+// Source returns a loader.Source over the repository owner/repo: the
+// README and docs/ files of its default branch, at their paths, and its
+// issues, pull requests left out, as "issues/<number>". Every file
+// carries the repository's Access. Files without a loader for their
+// extension are skipped by Ingest.
+func (c *Client) Source(owner, repo string) loader.Source {
+	return source{client: c, owner: owner, repo: repo}
+}
+
+type source struct {
+	client      *Client
+	owner, repo string
+}
+
+// readme matches the README files GitHub shows on a repository's page.
+var readme = regexp.MustCompile(`(?i)^readme(\.[a-z]+)?$`)
+
+func (s source) Files(ctx context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		r, err := s.client.Repository(ctx, s.owner, s.repo)
+		if err != nil {
+			yield(loader.File{}, err)
+			return
+		}
+		access, err := s.client.access(ctx, s.owner, s.repo, r)
+		if err != nil {
+			yield(loader.File{}, err)
+			return
+		}
+		name := loader.EscapeID(s.owner) + "/" + loader.EscapeID(s.repo)
+		object := s.client.resourceType + ":" + name
+		file := func(p, location string, md map[string]string, l loader.Loader, open func(context.Context) (io.ReadCloser, error)) loader.File {
+			md[rag.SpiceDBObjectKey] = object
+			md[RepositoryKey] = s.owner + "/" + s.repo
+			return loader.File{
+				Path:     p,
+				Location: location,
+				Metadata: md,
+				ID:       name + "/" + loader.PathID(p),
+				Loader:   l,
+				Access:   access,
+				Open:     open,
+			}
+		}
+
+		var tree struct {
+			Tree []struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+				SHA  string `json:"sha"`
+			} `json:"tree"`
+			Truncated bool `json:"truncated"`
+		}
+		if err := s.client.call(ctx, repoPath(s.owner, s.repo)+"/git/trees/"+url.PathEscape(r.DefaultBranch), url.Values{"recursive": {"1"}}, &tree); err != nil {
+			yield(loader.File{}, fmt.Errorf("github: listing files of %s/%s: %w", s.owner, s.repo, err))
+			return
+		}
+		if tree.Truncated {
+			yield(loader.File{}, fmt.Errorf("github: %s/%s has too many files to list", s.owner, s.repo))
+			return
+		}
+		for _, e := range tree.Tree {
+			if e.Type != "blob" || !readme.MatchString(e.Path) && !strings.HasPrefix(e.Path, "docs/") {
+				continue
+			}
+			location := r.HTMLURL + "/blob/" + r.DefaultBranch + "/" + e.Path
+			f := file(e.Path, location, map[string]string{PathKey: e.Path, SHAKey: e.SHA}, nil, func(ctx context.Context) (io.ReadCloser, error) {
+				return s.client.raw(ctx, repoPath(s.owner, s.repo)+"/git/blobs/"+url.PathEscape(e.SHA))
+			})
+			if !yield(f, nil) {
+				return
+			}
+		}
+
+		for page, err := range pages[struct {
+			Number      int       `json:"number"`
+			Title       string    `json:"title"`
+			Body        string    `json:"body"`
+			State       string    `json:"state"`
+			HTMLURL     string    `json:"html_url"`
+			UpdatedAt   time.Time `json:"updated_at"`
+			PullRequest *struct{} `json:"pull_request"`
+		}](ctx, s.client, repoPath(s.owner, s.repo)+"/issues", url.Values{"state": {"all"}}) {
+			if err != nil {
+				yield(loader.File{}, fmt.Errorf("github: listing issues of %s/%s: %w", s.owner, s.repo, err))
+				return
+			}
+			for _, issue := range page {
+				if issue.PullRequest != nil {
+					continue
+				}
+				text := "# " + issue.Title + "\n\n" + issue.Body
+				f := file(path.Join("issues", strconv.Itoa(issue.Number)), issue.HTMLURL, map[string]string{
+					loader.TitleKey: issue.Title,
+					IssueKey:        strconv.Itoa(issue.Number),
+					StateKey:        issue.State,
+					UpdatedKey:      issue.UpdatedAt.UTC().Format(time.RFC3339),
+				}, loader.Markdown{}, func(context.Context) (io.ReadCloser, error) {
+					return io.NopCloser(strings.NewReader(text)), nil
+				})
+				if !yield(f, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func repoPath(owner, repo string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// pages yields the pages of the list at path, 100 items at a time,
+// following the responses' Link headers.
+func pages[T any](ctx context.Context, c *Client, path string, q url.Values) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		if q == nil {
+			q = url.Values{}
+		}
+		q.Set("per_page", "100")
+		next := c.endpoint + path + "?" + q.Encode()
+		for next != "" {
+			resp, err := c.get(ctx, next, "application/vnd.github+json")
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			var page []T
+			err = json.NewDecoder(resp.Body).Decode(&page)
+			resp.Body.Close()
+			if err != nil {
+				yield(nil, fmt.Errorf("decoding response: %w", err))
+				return
+			}
+			if !yield(page, nil) {
+				return
+			}
+			next = nextLink(resp.Header.Get("Link"))
+		}
+	}
+}
+
+// nextLink returns the rel="next" URL of a Link header, or "".
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if ok && strings.Contains(params, `rel="next"`) {
+			return strings.Trim(strings.TrimSpace(target), "<>")
+		}
+	}
+	return ""
+}
+
+// call sends a GET for path with query q and decodes the JSON response
+// into out.
+func (c *Client) call(ctx context.Context, path string, q url.Values, out any) error {
+	u := c.endpoint + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	resp, err := c.get(ctx, u, "application/vnd.github+json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// raw returns the raw content at path.
+func (c *Client) raw(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, c.endpoint+path, "application/vnd.github.raw")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// get sends a GET for u accepting accept, returning a 2xx response.
+func (c *Client) get(ctx context.Context, u, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var body struct {
+			Message string `json:"message"`
+		}
+		msg := http.StatusText(resp.StatusCode)
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil && body.Message != "" {
+			msg = body.Message
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return resp, nil
+}
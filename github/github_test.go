@@ -0,0 +1,196 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/github"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+var blobs = map[string]string{
+	"sha-readme": "# Webapp\n\nThe storefront.",
+	"sha-setup":  "# Setup\n\nRun make.",
+	"sha-logo":   "\x89PNG",
+}
+
+// fakeGitHub serves the repositories acme/webapp, private, and
+// acme/site.io, public, with their trees, blobs, collaborators, teams
+// and issues. Lists are paginated one item a page over Link headers.
+func fakeGitHub(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	paginate := func(w http.ResponseWriter, r *http.Request, items []map[string]any) {
+		q := r.URL.Query()
+		if q.Get("per_page") != "100" {
+			http.Error(w, "per_page", http.StatusBadRequest)
+			return
+		}
+		page := len(q.Get("page"))
+		if page < len(items)-1 {
+			q.Set("page", strings.Repeat("x", page+1))
+			w.Header().Set("Link", `<`+srv.URL+r.URL.Path+"?"+q.Encode()+`>; rel="next", <`+srv.URL+`/last>; rel="last"`)
+		}
+		_ = json.NewEncoder(w).Encode(items[page : page+1])
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Bad credentials"})
+			return
+		}
+		if q := r.URL.Query(); strings.HasSuffix(r.URL.Path, "/collaborators") && q.Get("affiliation") != "all" ||
+			strings.HasSuffix(r.URL.Path, "/issues") && q.Get("state") != "all" ||
+			strings.Contains(r.URL.Path, "/git/trees/") && q.Get("recursive") != "1" {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/acme/webapp":
+			_ = json.NewEncoder(w).Encode(map[string]any{"full_name": "acme/webapp", "private": true, "visibility": "private", "default_branch": "main", "html_url": "https://github.com/acme/webapp"})
+		case "/repos/acme/site.io":
+			_ = json.NewEncoder(w).Encode(map[string]any{"full_name": "acme/site.io", "private": false, "visibility": "public", "default_branch": "main", "html_url": "https://github.com/acme/site.io"})
+		case "/repos/acme/webapp/git/trees/main", "/repos/acme/site.io/git/trees/main":
+			_ = json.NewEncoder(w).Encode(map[string]any{"truncated": false, "tree": []map[string]string{
+				{"path": "README.md", "type": "blob", "sha": "sha-readme"},
+				{"path": "docs", "type": "tree", "sha": "sha-docs"},
+				{"path": "docs/setup.md", "type": "blob", "sha": "sha-setup"},
+				{"path": "docs/logo.png", "type": "blob", "sha": "sha-logo"},
+				{"path": "main.go", "type": "blob", "sha": "sha-main"},
+			}})
+		case "/repos/acme/webapp/collaborators", "/repos/acme/site.io/collaborators":
+			paginate(w, r, []map[string]any{
+				{"login": "Emilia", "permissions": map[string]bool{"admin": true, "push": true, "pull": true}},
+				{"login": "beatrice", "permissions": map[string]bool{"admin": false, "push": true, "pull": true}},
+			})
+		case "/repos/acme/webapp/teams", "/repos/acme/site.io/teams":
+			paginate(w, r, []map[string]any{{"slug": "platform", "permission": "pull"}})
+		case "/repos/acme/webapp/issues", "/repos/acme/site.io/issues":
+			paginate(w, r, []map[string]any{
+				{"number": 7, "title": "Checkout fails", "body": "500 on submit.", "state": "open", "html_url": "https://github.com/acme/webapp/issues/7", "updated_at": "2024-03-01T10:00:00Z"},
+				{"number": 8, "title": "Fix checkout", "body": "Closes #7.", "state": "open", "pull_request": map[string]string{"url": "…"}},
+			})
+		default:
+			_, sha, ok := strings.Cut(r.URL.Path, "/git/blobs/")
+			if content, found := blobs[sha]; ok && found && r.Header.Get("Accept") == "application/vnd.github.raw" {
+				_, _ = w.Write([]byte(content))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// accessIngester records documents and the access set on them.
+type accessIngester struct {
+	docs   []rag.Document
+	access map[string][]rag.ACLEntry
+}
+
+func (a *accessIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	a.docs = append(a.docs, doc)
+	return nil, nil
+}
+
+func (a *accessIngester) SetAccess(_ context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	if a.access == nil {
+		a.access = make(map[string][]rag.ACLEntry)
+	}
+	a.access[object+" "+strings.Join(relations, ",")] = entries
+	return nil, nil
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	client := github.New(github.WithEndpoint(fakeGitHub(t).URL), github.WithToken("token"))
+	dst := &accessIngester{}
+	res, err := loader.Ingest(context.Background(), client.Source("acme", "webapp"), dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"docs/logo.png"}, res.Skipped)
+
+	var ids []string
+	for _, doc := range res.Documents {
+		ids = append(ids, doc.ID)
+	}
+	require.Equal(t, []string{"acme/webapp/README", "acme/webapp/docs/setup", "acme/webapp/issues/7"}, ids,
+		"only the README, docs and issues, not pull requests")
+
+	require.Equal(t, "Setup\n\nRun make.", res.Documents[1].Text)
+	require.Equal(t, map[string]string{
+		rag.SpiceDBObjectKey: "repository:acme/webapp",
+		loader.TitleKey:      "Setup",
+		loader.FormatKey:     "markdown",
+		loader.SourceKey:     "https://github.com/acme/webapp/blob/main/docs/setup.md",
+		github.RepositoryKey: "acme/webapp",
+		github.PathKey:       "docs/setup.md",
+		github.SHAKey:        "sha-setup",
+	}, res.Documents[1].Metadata)
+
+	issue := res.Documents[2]
+	require.Equal(t, "Checkout fails\n\n500 on submit.", issue.Text)
+	require.Equal(t, "Checkout fails", issue.Metadata[loader.TitleKey])
+	require.Equal(t, "7", issue.Metadata[github.IssueKey])
+	require.Equal(t, "open", issue.Metadata[github.StateKey])
+	require.Equal(t, "https://github.com/acme/webapp/issues/7", issue.Metadata[loader.SourceKey])
+
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"repository:acme/webapp owner,viewer": {
+			{Relation: "owner", Subject: "user:emilia"},
+			{Relation: "viewer", Subject: "user:beatrice"},
+			{Relation: "viewer", Subject: "team:acme/platform#member"},
+		},
+	}, dst.access)
+}
+
+func TestPublicRepository(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeGitHub(t)
+	access, err := github.New(github.WithEndpoint(srv.URL), github.WithToken("token")).Access(context.Background(), "acme", "site.io")
+	require.NoError(t, err)
+	require.Contains(t, access.Entries, rag.ACLEntry{Relation: "viewer", Subject: "user:*"})
+
+	client := github.New(github.WithEndpoint(srv.URL), github.WithToken("token"),
+		github.WithPublicSubject(""),
+		github.WithResourceType("repo"),
+		github.WithSubjectFunc(func(s github.Subject) (string, bool) {
+			return "user:" + s.ID, s.Type == "user"
+		}))
+	dst := &accessIngester{}
+	res, err := loader.Ingest(context.Background(), client.Source("acme", "site.io"), dst, loader.WithInclude("README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "acme/site=2eio/README", res.Documents[0].ID)
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"repo:acme/site=2eio owner,viewer": {
+			{Relation: "owner", Subject: "user:Emilia"},
+			{Relation: "viewer", Subject: "user:beatrice"},
+		},
+	}, dst.access)
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeGitHub(t)
+	_, err := loader.Ingest(context.Background(), github.New(github.WithEndpoint(srv.URL)).Source("acme", "webapp"), &accessIngester{})
+	var apiErr *github.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	require.Equal(t, "Bad credentials", apiErr.Message)
+
+	_, err = github.New(github.WithEndpoint(srv.URL), github.WithToken("token")).Access(context.Background(), "acme", "missing")
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
@@ -0,0 +1,213 @@
+// Package groupsync mirrors the groups of a directory, such as a SCIM
+// service or an LDAP server, into SpiceDB, so documents can be shared
+// with "group:eng#member" and the directory decides who that is:
+//
+//	syncer := groupsync.New(groupsync.NewSCIM("https://idp.acme.com/scim/v2",
+//		groupsync.SCIMWithToken(os.Getenv("SCIM_TOKEN"))), pipeline)
+//	report, err := syncer.Sync(ctx)
+//
+// Every group becomes the object "group:<name>" whose member
+// relationships are the group's users, "user:<name>", and nested
+// groups, "group:<name>#member", replacing those of an earlier sync.
+// Groups gone from the directory lose their members. Names are escaped
+// with loader.EscapeID, so "emilia@acme.com" is "user:emilia=40acme=2ecom"
+// as for the gdrive connector. The schema needs a group definition:
+//
+//	definition group {
+//	  relation member: user | group#member
+//	}
+//
+// Run syncs on a schedule.
+package groupsync
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// Group is a directory group.
+type Group struct {
+	// Name identifies the group, e.g. "eng".
+	Name string
+	// Users are the names of the member users, e.g. "emilia".
+	Users []string
+	// Groups are the names of the member groups, whose members are
+	// members too.
+	Groups []string
+}
+
+// Source is a directory of groups.
+type Source interface {
+	Groups(ctx context.Context) iter.Seq2[Group, error]
+}
+
+// Writer writes the relationships; *rag.RAGPipeline is one.
+type Writer interface {
+	SetAccess(ctx context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error)
+	ListObjects(ctx context.Context, resourceType, relation string) ([]string, error)
+}
+
+// Report summarizes a sync.
+type Report struct {
+	// Groups counts the directory's groups.
+	Groups int
+	// Changed lists the names of the groups whose members changed,
+	// including new ones.
+	Changed []string
+	// Removed lists the object IDs of the groups gone from the
+	// directory, whose members were deleted.
+	Removed []string
+	// Token is the revision of the last write, nil if there was none.
+	Token *apiv1.ZedToken
+}
+
+// Syncer syncs a Source's groups into SpiceDB.
+type Syncer struct {
+	src        Source
+	dst        Writer
+	groupType  string
+	relation   string
+	userType   string
+	keepMissed bool
+}
+
+// Option configures a Syncer.
+type Option func(*Syncer)
+
+// WithGroupType sets the type of the groups' objects, "group" by
+// default.
+func WithGroupType(groupType string) Option {
+	return func(s *Syncer) {
+		s.groupType = groupType
+	}
+}
+
+// WithMemberRelation sets the relation of the groups' members, "member"
+// by default.
+func WithMemberRelation(relation string) Option {
+	return func(s *Syncer) {
+		s.relation = relation
+	}
+}
+
+// WithUserType sets the type of the member users, "user" by default.
+func WithUserType(userType string) Option {
+	return func(s *Syncer) {
+		s.userType = userType
+	}
+}
+
+// KeepMissingGroups leaves the members of groups not in the directory
+// in place, for groups also managed by other means. By default they are
+// deleted, so removing a group from the directory revokes what it was
+// shared.
+func KeepMissingGroups() Option {
+	return func(s *Syncer) {
+		s.keepMissed = true
+	}
+}
+
+// New returns a Syncer of src's groups into dst.
+func New(src Source, dst Writer, opts ...Option) *Syncer {
+	s := &Syncer{src: src, dst: dst, groupType: "group", relation: "member", userType: "user"}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sync makes SpiceDB's groups those of the directory. The directory is
+// read in full before anything is written, so a failing directory
+// leaves SpiceDB as it was; a failing write stops the sync part-way, and
+// the next one finishes it.
+func (s *Syncer) Sync(ctx context.Context) (*Report, error) {
+	var groups []Group
+	names := make(map[string]bool)
+	for g, err := range s.src.Groups(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("groupsync: reading groups: %w", err)
+		}
+		id := loader.EscapeID(g.Name)
+		if names[id] {
+			return nil, fmt.Errorf("groupsync: group %q listed twice", g.Name)
+		}
+		names[id] = true
+		groups = append(groups, g)
+	}
+
+	report := &Report{Groups: len(groups)}
+	// set reports whether the members of the group id changed.
+	set := func(id string, entries []rag.ACLEntry) (bool, error) {
+		token, err := s.dst.SetAccess(ctx, s.groupType+":"+id, []string{s.relation}, entries)
+		if err != nil {
+			return false, fmt.Errorf("groupsync: %w", err)
+		}
+		if token != nil {
+			report.Token = token
+		}
+		return token != nil, nil
+	}
+	for _, g := range groups {
+		entries := make([]rag.ACLEntry, 0, len(g.Users)+len(g.Groups))
+		for _, u := range g.Users {
+			entries = append(entries, rag.ACLEntry{Relation: s.relation, Subject: s.userType + ":" + loader.EscapeID(u)})
+		}
+		for _, sub := range g.Groups {
+			entries = append(entries, rag.ACLEntry{Relation: s.relation, Subject: s.groupType + ":" + loader.EscapeID(sub) + "#" + s.relation})
+		}
+		changed, err := set(loader.EscapeID(g.Name), entries)
+		if err != nil {
+			return report, err
+		}
+		if changed {
+			report.Changed = append(report.Changed, g.Name)
+		}
+	}
+
+	if s.keepMissed {
+		return report, nil
+	}
+	existing, err := s.dst.ListObjects(ctx, s.groupType, s.relation)
+	if err != nil {
+		return report, fmt.Errorf("groupsync: %w", err)
+	}
+	for _, id := range existing {
+		if names[id] {
+			continue
+		}
+		if _, err := set(id, nil); err != nil {
+			return report, err
+		}
+		report.Removed = append(report.Removed, id)
+	}
+	return report, nil
+}
+
+// Run syncs now and then every interval until ctx is done, passing each
+// sync's outcome to report, which may be nil. A failed sync is retried
+// at the next interval. Run returns ctx's error.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration, report func(*Report, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r, err := s.Sync(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if report != nil {
+			report(r, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
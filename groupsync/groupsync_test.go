@@ -0,0 +1,209 @@
+package groupsync_test
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/groupsync"
+)
+
+// memorySource is a Source over fixed groups, failing with err after
+// them if set.
+type memorySource struct {
+	groups []groupsync.Group
+	err    error
+}
+
+func (s *memorySource) Groups(context.Context) iter.Seq2[groupsync.Group, error] {
+	return func(yield func(groupsync.Group, error) bool) {
+		for _, g := range s.groups {
+			if !yield(g, nil) {
+				return
+			}
+		}
+		if s.err != nil {
+			yield(groupsync.Group{}, s.err)
+		}
+	}
+}
+
+// memoryWriter keeps relationships as "type:id#relation@subject".
+type memoryWriter struct {
+	mu        sync.Mutex
+	relations map[string]bool
+	writes    int
+}
+
+func (w *memoryWriter) SetAccess(_ context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.relations == nil {
+		w.relations = make(map[string]bool)
+	}
+	desired := make(map[string]bool)
+	for _, e := range entries {
+		desired[object+"#"+e.Relation+"@"+e.Subject] = true
+	}
+	changed := false
+	for key := range w.relations {
+		obj, rest, _ := strings.Cut(key, "#")
+		rel, _, _ := strings.Cut(rest, "@")
+		if obj == object && slices.Contains(relations, rel) && !desired[key] {
+			delete(w.relations, key)
+			changed = true
+		}
+	}
+	for key := range desired {
+		if !w.relations[key] {
+			w.relations[key] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	w.writes++
+	return &apiv1.ZedToken{Token: strconv.Itoa(w.writes)}, nil
+}
+
+func (w *memoryWriter) ListObjects(_ context.Context, resourceType, relation string) ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ids []string
+	for key := range w.relations {
+		obj, rest, _ := strings.Cut(key, "#")
+		typ, id, _ := strings.Cut(obj, ":")
+		if typ == resourceType && strings.HasPrefix(rest, relation+"@") && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (w *memoryWriter) tuples() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out []string
+	for key := range w.relations {
+		out = append(out, key)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	src := &memorySource{groups: []groupsync.Group{
+		{Name: "eng", Users: []string{"emilia", "beatrice@acme.com"}, Groups: []string{"sre"}},
+		{Name: "sre", Users: []string{"carl"}},
+		{Name: "sales", Users: []string{"dana"}},
+	}}
+	dst := &memoryWriter{}
+	_, err := dst.SetAccess(ctx, "group:sales", []string{"manager"}, []rag.ACLEntry{{Relation: "manager", Subject: "user:erin"}})
+	require.NoError(t, err)
+	syncer := groupsync.New(src, dst)
+
+	report, err := syncer.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Groups)
+	require.Equal(t, []string{"eng", "sre", "sales"}, report.Changed)
+	require.Empty(t, report.Removed)
+	require.NotNil(t, report.Token)
+	require.Equal(t, []string{
+		"group:eng#member@group:sre#member",
+		"group:eng#member@user:beatrice=40acme=2ecom",
+		"group:eng#member@user:emilia",
+		"group:sales#manager@user:erin",
+		"group:sales#member@user:dana",
+		"group:sre#member@user:carl",
+	}, dst.tuples())
+
+	report, err = syncer.Sync(ctx)
+	require.NoError(t, err)
+	require.Empty(t, report.Changed, "nothing changed in the directory")
+	require.Nil(t, report.Token)
+
+	src.groups = []groupsync.Group{
+		{Name: "eng", Users: []string{"emilia"}, Groups: []string{"sre"}},
+		{Name: "sre", Users: []string{"carl"}},
+	}
+	report, err = syncer.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"eng"}, report.Changed)
+	require.Equal(t, []string{"sales"}, report.Removed)
+	require.Equal(t, []string{
+		"group:eng#member@group:sre#member",
+		"group:eng#member@user:emilia",
+		"group:sales#manager@user:erin",
+		"group:sre#member@user:carl",
+	}, dst.tuples(), "beatrice left eng and sales is gone; other relations are kept")
+}
+
+func TestSyncOptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	dst := &memoryWriter{}
+	_, err := dst.SetAccess(ctx, "team:legacy", []string{"direct_member"}, []rag.ACLEntry{{Relation: "direct_member", Subject: "account:erin"}})
+	require.NoError(t, err)
+	src := &memorySource{groups: []groupsync.Group{{Name: "Eng Team", Users: []string{"emilia"}, Groups: []string{"SRE"}}}}
+	report, err := groupsync.New(src, dst,
+		groupsync.WithGroupType("team"),
+		groupsync.WithMemberRelation("direct_member"),
+		groupsync.WithUserType("account"),
+		groupsync.KeepMissingGroups()).Sync(ctx)
+	require.NoError(t, err)
+	require.Empty(t, report.Removed)
+	require.Equal(t, []string{
+		"team:Eng=20Team#direct_member@account:emilia",
+		"team:Eng=20Team#direct_member@team:SRE#direct_member",
+		"team:legacy#direct_member@account:erin",
+	}, dst.tuples())
+}
+
+func TestSyncErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	dst := &memoryWriter{}
+	boom := errors.New("directory unavailable")
+	_, err := groupsync.New(&memorySource{groups: []groupsync.Group{{Name: "eng", Users: []string{"emilia"}}}, err: boom}, dst).Sync(ctx)
+	require.ErrorIs(t, err, boom)
+	require.Empty(t, dst.tuples(), "nothing is written from a partial directory")
+
+	_, err = groupsync.New(&memorySource{groups: []groupsync.Group{{Name: "eng"}, {Name: "eng"}}}, dst).Sync(ctx)
+	require.ErrorContains(t, err, `group "eng" listed twice`)
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	src := &memorySource{groups: []groupsync.Group{{Name: "eng", Users: []string{"emilia"}}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	var reports []*groupsync.Report
+	err := groupsync.New(src, &memoryWriter{}).Run(ctx, time.Millisecond, func(r *groupsync.Report, err error) {
+		require.NoError(t, err)
+		reports = append(reports, r)
+		if len(reports) == 3 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, reports, 3)
+	require.Equal(t, []string{"eng"}, reports[0].Changed)
+	require.Empty(t, reports[2].Changed)
+}
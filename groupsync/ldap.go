@@ -0,0 +1,188 @@
+package groupsync
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// Entry is an LDAP entry.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Searcher runs LDAP subtree searches, returning every matching entry
+// with the given attributes. It adapts an LDAP client, e.g. a
+// github.com/go-ldap/ldap/v3 connection with
+//
+//	func (c conn) Search(ctx context.Context, baseDN, filter string, attrs []string) ([]groupsync.Entry, error) {
+//		res, err := c.SearchWithPaging(ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree,
+//			ldap.NeverDerefAliases, 0, 0, false, filter, attrs, nil), 500)
+//		if err != nil {
+//			return nil, err
+//		}
+//		var entries []groupsync.Entry
+//		for _, e := range res.Entries {
+//			attributes := make(map[string][]string)
+//			for _, a := range e.Attributes {
+//				attributes[a.Name] = a.Values
+//			}
+//			entries = append(entries, groupsync.Entry{DN: e.DN, Attributes: attributes})
+//		}
+//		return entries, nil
+//	}
+type Searcher interface {
+	Search(ctx context.Context, baseDN, filter string, attributes []string) ([]Entry, error)
+}
+
+// LDAP is an LDAP directory, such as OpenLDAP or Active Directory, as a
+// Source. Groups list their members by DN ("member", "uniqueMember") or,
+// for POSIX groups, by name ("memberUid"). Groups are named by their
+// "cn" and users by their "uid" by default; members that are not among
+// the users the user filter finds, such as disabled accounts with a
+// suitable filter, are left out.
+type LDAP struct {
+	searcher    Searcher
+	groupBaseDN string
+	userBaseDN  string
+	groupFilter string
+	userFilter  string
+	groupAttr   string
+	userAttr    string
+}
+
+// LDAPOption configures an LDAP.
+type LDAPOption func(*LDAP)
+
+// LDAPGroups sets where groups are searched and the filter finding
+// them, by default the base DN and
+// "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup)(objectClass=group))".
+func LDAPGroups(baseDN, filter string) LDAPOption {
+	return func(l *LDAP) {
+		l.groupBaseDN, l.groupFilter = baseDN, filter
+	}
+}
+
+// LDAPUsers sets where users are searched and the filter finding them,
+// by default the base DN and "(|(objectClass=person)(objectClass=posixAccount))".
+// On Active Directory,
+// "(&(objectClass=user)(!(userAccountControl:1.2.840.113556.1.4.803:=2)))"
+// leaves out disabled accounts.
+func LDAPUsers(baseDN, filter string) LDAPOption {
+	return func(l *LDAP) {
+		l.userBaseDN, l.userFilter = baseDN, filter
+	}
+}
+
+// LDAPNameAttributes sets the attributes naming groups and users, "cn"
+// and "uid" by default; Active Directory names users by
+// "sAMAccountName".
+func LDAPNameAttributes(group, user string) LDAPOption {
+	return func(l *LDAP) {
+		l.groupAttr, l.userAttr = group, user
+	}
+}
+
+// NewLDAP returns the directory under baseDN, e.g. "dc=acme,dc=com",
+// searched with s.
+func NewLDAP(s Searcher, baseDN string, opts ...LDAPOption) *LDAP {
+	l := &LDAP{
+		searcher:    s,
+		groupBaseDN: baseDN,
+		userBaseDN:  baseDN,
+		groupFilter: "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup)(objectClass=group))",
+		userFilter:  "(|(objectClass=person)(objectClass=posixAccount))",
+		groupAttr:   "cn",
+		userAttr:    "uid",
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Groups yields the directory's groups, searching the users and groups
+// first to resolve the members' DNs.
+func (l *LDAP) Groups(ctx context.Context) iter.Seq2[Group, error] {
+	return func(yield func(Group, error) bool) {
+		userEntries, err := l.searcher.Search(ctx, l.userBaseDN, l.userFilter, []string{l.userAttr})
+		if err != nil {
+			yield(Group{}, fmt.Errorf("groupsync: searching users: %w", err))
+			return
+		}
+		users := make(map[string]string, len(userEntries))
+		names := make(map[string]bool, len(userEntries))
+		for _, e := range userEntries {
+			if name := first(e, l.userAttr); name != "" {
+				users[normalizeDN(e.DN)] = name
+				names[name] = true
+			}
+		}
+		groupEntries, err := l.searcher.Search(ctx, l.groupBaseDN, l.groupFilter, []string{l.groupAttr, "member", "uniqueMember", "memberUid"})
+		if err != nil {
+			yield(Group{}, fmt.Errorf("groupsync: searching groups: %w", err))
+			return
+		}
+		groups := make(map[string]string, len(groupEntries))
+		for _, e := range groupEntries {
+			groups[normalizeDN(e.DN)] = first(e, l.groupAttr)
+		}
+
+		for _, e := range groupEntries {
+			group := Group{Name: first(e, l.groupAttr)}
+			if group.Name == "" {
+				continue
+			}
+			for _, dn := range append(attr(e, "member"), attr(e, "uniqueMember")...) {
+				dn = normalizeDN(dn)
+				if name, ok := users[dn]; ok {
+					group.Users = append(group.Users, name)
+				} else if name := groups[dn]; name != "" {
+					group.Groups = append(group.Groups, name)
+				}
+			}
+			for _, name := range attr(e, "memberUid") {
+				if names[name] {
+					group.Users = append(group.Users, name)
+				}
+			}
+			if !yield(group, nil) {
+				return
+			}
+		}
+	}
+}
+
+// attr returns the values of the attribute name, matched ignoring case
+// as LDAP does.
+func attr(e Entry, name string) []string {
+	if v, ok := e.Attributes[name]; ok {
+		return v
+	}
+	for k, v := range e.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func first(e Entry, name string) string {
+	if v := attr(e, name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// normalizeDN lower-cases dn and drops the spaces around its separators,
+// so "CN=Eng, OU=Groups" and "cn=eng,ou=groups" compare equal.
+func normalizeDN(dn string) string {
+	parts := strings.Split(strings.ToLower(dn), ",")
+	for i, p := range parts {
+		k, v, _ := strings.Cut(p, "=")
+		parts[i] = strings.TrimSpace(k) + "=" + strings.TrimSpace(v)
+	}
+	return strings.Join(parts, ",")
+}
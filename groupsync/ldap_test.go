@@ -0,0 +1,90 @@
+package groupsync_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/groupsync"
+)
+
+// fakeSearcher answers searches by base DN and filter.
+type fakeSearcher map[string][]groupsync.Entry
+
+func (f fakeSearcher) Search(_ context.Context, baseDN, filter string, _ []string) ([]groupsync.Entry, error) {
+	entries, ok := f[baseDN+" "+filter]
+	if !ok {
+		return nil, errors.New("no such object")
+	}
+	return entries, nil
+}
+
+const (
+	userFilter  = "(|(objectClass=person)(objectClass=posixAccount))"
+	groupFilter = "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup)(objectClass=group))"
+)
+
+func TestLDAP(t *testing.T) {
+	t.Parallel()
+
+	searcher := fakeSearcher{
+		"dc=acme,dc=com " + userFilter: {
+			{DN: "uid=emilia,ou=people,dc=acme,dc=com", Attributes: map[string][]string{"uid": {"emilia"}}},
+			{DN: "uid=beatrice,ou=people,dc=acme,dc=com", Attributes: map[string][]string{"UID": {"beatrice"}}},
+			{DN: "uid=carl,ou=people,dc=acme,dc=com", Attributes: map[string][]string{"uid": {"carl"}}},
+		},
+		"dc=acme,dc=com " + groupFilter: {
+			{DN: "cn=eng,ou=groups,dc=acme,dc=com", Attributes: map[string][]string{
+				"cn":     {"eng"},
+				"member": {"UID=Emilia, OU=People, DC=acme, DC=com", "cn=sre,ou=groups,dc=acme,dc=com", "uid=gone,ou=people,dc=acme,dc=com"},
+			}},
+			{DN: "cn=sre,ou=groups,dc=acme,dc=com", Attributes: map[string][]string{
+				"cn":           {"sre"},
+				"uniqueMember": {"uid=beatrice,ou=people,dc=acme,dc=com"},
+			}},
+			{DN: "cn=ops,ou=groups,dc=acme,dc=com", Attributes: map[string][]string{
+				"cn":        {"ops"},
+				"memberUid": {"carl", "gone"},
+			}},
+		},
+	}
+	var groups []groupsync.Group
+	for g, err := range groupsync.NewLDAP(searcher, "dc=acme,dc=com").Groups(context.Background()) {
+		require.NoError(t, err)
+		groups = append(groups, g)
+	}
+	require.Equal(t, []groupsync.Group{
+		{Name: "eng", Users: []string{"emilia"}, Groups: []string{"sre"}},
+		{Name: "sre", Users: []string{"beatrice"}},
+		{Name: "ops", Users: []string{"carl"}},
+	}, groups, "DNs compare ignoring case and spaces; unknown members are left out")
+}
+
+func TestLDAPOptions(t *testing.T) {
+	t.Parallel()
+
+	searcher := fakeSearcher{
+		"ou=staff,dc=acme,dc=com (objectClass=user)": {
+			{DN: "CN=Emilia Lopez,OU=Staff,DC=acme,DC=com", Attributes: map[string][]string{"sAMAccountName": {"emilia"}}},
+		},
+		"ou=groups,dc=acme,dc=com (objectClass=group)": {
+			{DN: "CN=Engineering,OU=Groups,DC=acme,DC=com", Attributes: map[string][]string{
+				"name":   {"Engineering"},
+				"member": {"CN=Emilia Lopez,OU=Staff,DC=acme,DC=com"},
+			}},
+		},
+	}
+	ldap := groupsync.NewLDAP(searcher, "dc=acme,dc=com",
+		groupsync.LDAPUsers("ou=staff,dc=acme,dc=com", "(objectClass=user)"),
+		groupsync.LDAPGroups("ou=groups,dc=acme,dc=com", "(objectClass=group)"),
+		groupsync.LDAPNameAttributes("name", "sAMAccountName"))
+	dst := &memoryWriter{}
+	_, err := groupsync.New(ldap, dst).Sync(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"group:Engineering#member@user:emilia"}, dst.tuples())
+
+	_, err = groupsync.New(groupsync.NewLDAP(searcher, "dc=other"), dst).Sync(context.Background())
+	require.ErrorContains(t, err, "searching users: no such object")
+}
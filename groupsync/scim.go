@@ -0,0 +1,178 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// APIError is a non-2xx response from a SCIM service.
+type APIError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("groupsync: SCIM service returned %d: %s", e.StatusCode, e.Detail)
+}
+
+// SCIM is a SCIM 2.0 service, such as the provisioning API of Okta,
+// Entra ID or OneLogin, as a Source. Groups are named by their
+// displayName and users by their userName; inactive users are left out
+// of their groups.
+type SCIM struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// SCIMOption configures a SCIM.
+type SCIMOption func(*SCIM)
+
+// SCIMWithToken authenticates with a bearer token.
+func SCIMWithToken(token string) SCIMOption {
+	return func(s *SCIM) {
+		s.token = token
+	}
+}
+
+// SCIMWithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func SCIMWithHTTPClient(hc *http.Client) SCIMOption {
+	return func(s *SCIM) {
+		s.httpClient = hc
+	}
+}
+
+// NewSCIM returns the SCIM service at baseURL, e.g.
+// "https://idp.acme.com/scim/v2".
+func NewSCIM(baseURL string, opts ...SCIMOption) *SCIM {
+	s := &SCIM{baseURL: strings.TrimRight(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type scimUser struct {
+	ID       string `json:"id"`
+	UserName string `json:"userName"`
+	Active   *bool  `json:"active"`
+}
+
+type scimGroup struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Members     []struct {
+		Value string `json:"value"`
+		Type  string `json:"type"`
+	} `json:"members"`
+}
+
+// Groups yields the service's groups. Members are listed by ID, so the
+// users and groups are read in full first to name them.
+func (s *SCIM) Groups(ctx context.Context) iter.Seq2[Group, error] {
+	return func(yield func(Group, error) bool) {
+		users := make(map[string]string)
+		for page, err := range scimList[scimUser](ctx, s, "/Users") {
+			if err != nil {
+				yield(Group{}, err)
+				return
+			}
+			for _, u := range page {
+				if u.Active == nil || *u.Active {
+					users[u.ID] = u.UserName
+				}
+			}
+		}
+		var groups []scimGroup
+		names := make(map[string]string)
+		for page, err := range scimList[scimGroup](ctx, s, "/Groups") {
+			if err != nil {
+				yield(Group{}, err)
+				return
+			}
+			for _, g := range page {
+				groups = append(groups, g)
+				names[g.ID] = g.DisplayName
+			}
+		}
+
+		for _, g := range groups {
+			group := Group{Name: g.DisplayName}
+			for _, m := range g.Members {
+				// The type is optional; IDs tell users and groups apart.
+				if name, ok := users[m.Value]; ok && !strings.EqualFold(m.Type, "Group") {
+					group.Users = append(group.Users, name)
+				} else if name, ok := names[m.Value]; ok && !strings.EqualFold(m.Type, "User") {
+					group.Groups = append(group.Groups, name)
+				}
+			}
+			if !yield(group, nil) {
+				return
+			}
+		}
+	}
+}
+
+// scimList yields the pages of the resources at path, 100 at a time.
+func scimList[T any](ctx context.Context, s *SCIM, path string) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		for start := 1; ; {
+			q := url.Values{"startIndex": {strconv.Itoa(start)}, "count": {"100"}}
+			var page struct {
+				TotalResults int `json:"totalResults"`
+				Resources    []T `json:"Resources"`
+			}
+			if err := s.call(ctx, path, q, &page); err != nil {
+				yield(nil, fmt.Errorf("groupsync: listing %s: %w", strings.TrimPrefix(path, "/"), err))
+				return
+			}
+			if !yield(page.Resources, nil) {
+				return
+			}
+			start += len(page.Resources)
+			if len(page.Resources) == 0 || start > page.TotalResults {
+				return
+			}
+		}
+	}
+}
+
+// call sends a GET for path with query q and decodes the JSON response
+// into out.
+func (s *SCIM) call(ctx context.Context, path string, q url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/scim+json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var body struct {
+			Detail string `json:"detail"`
+		}
+		detail := http.StatusText(resp.StatusCode)
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil && body.Detail != "" {
+			detail = body.Detail
+		}
+		return &APIError{StatusCode: resp.StatusCode, Detail: detail}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
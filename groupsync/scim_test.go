@@ -0,0 +1,91 @@
+package groupsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/groupsync"
+)
+
+// fakeSCIM serves users and groups two per page.
+func fakeSCIM(t *testing.T) *httptest.Server {
+	t.Helper()
+	resources := map[string][]map[string]any{
+		"/scim/v2/Users": {
+			{"id": "u1", "userName": "emilia@acme.com", "active": true},
+			{"id": "u2", "userName": "beatrice@acme.com"},
+			{"id": "u3", "userName": "carl@acme.com", "active": false},
+		},
+		"/scim/v2/Groups": {
+			{"id": "g1", "displayName": "eng", "members": []map[string]string{
+				{"value": "u1", "type": "User"},
+				{"value": "u3", "type": "User"},
+				{"value": "g2", "type": "Group"},
+				{"value": "u-unknown"},
+			}},
+			{"id": "g2", "displayName": "sre", "members": []map[string]string{{"value": "u2"}}},
+			{"id": "g3", "displayName": "empty"},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/scim+json")
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"}, "status": "401", "detail": "Invalid bearer token."})
+			return
+		}
+		all, ok := resources[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		if start < 1 || count != 100 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page := all[min(start-1, len(all)):min(start+1, len(all))]
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"schemas":      []string{"urn:ietf:params:scim:api:messages:2.0:ListResponse"},
+			"totalResults": len(all),
+			"startIndex":   start,
+			"itemsPerPage": len(page),
+			"Resources":    page,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSCIM(t *testing.T) {
+	t.Parallel()
+
+	scim := groupsync.NewSCIM(fakeSCIM(t).URL+"/scim/v2", groupsync.SCIMWithToken("token"))
+	var groups []groupsync.Group
+	for g, err := range scim.Groups(context.Background()) {
+		require.NoError(t, err)
+		groups = append(groups, g)
+	}
+	require.Equal(t, []groupsync.Group{
+		{Name: "eng", Users: []string{"emilia@acme.com"}, Groups: []string{"sre"}},
+		{Name: "sre", Users: []string{"beatrice@acme.com"}},
+		{Name: "empty"},
+	}, groups, "inactive and unknown members are left out")
+}
+
+func TestSCIMErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := groupsync.New(groupsync.NewSCIM(fakeSCIM(t).URL+"/scim/v2"), &memoryWriter{}).Sync(context.Background())
+	var apiErr *groupsync.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	require.Equal(t, "Invalid bearer token.", apiErr.Detail)
+}
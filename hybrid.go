@@ -0,0 +1,110 @@
+package rag
+
+import (
+	"context"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultRRFK is the rank constant of reciprocal rank fusion. Larger
+// values flatten the difference between top and lower ranks.
+const DefaultRRFK = 60
+
+// HybridOption configures a HybridRetriever.
+type HybridOption func(*HybridRetriever)
+
+// WithRRFK overrides DefaultRRFK.
+func WithRRFK(k float64) HybridOption {
+	return func(h *HybridRetriever) {
+		h.k = k
+	}
+}
+
+// WithFanout makes each underlying retriever return up to n times the
+// requested limit, giving fusion a deeper pool to rank from. The default
+// is 1.
+func WithFanout(n int) HybridOption {
+	return func(h *HybridRetriever) {
+		h.fanout = n
+	}
+}
+
+// HybridRetriever runs several retrievers, typically a BM25Retriever for
+// exact identifiers and a VectorRetriever for paraphrases, and merges
+// their results with reciprocal rank fusion: a document scores
+// sum(1 / (k + rank)) over the result lists it appears in, with ranks
+// starting at 1. Documents are identified by ID.
+//
+// Fusion happens before authorization like any other retrieval; the
+// pipeline filters the merged list.
+type HybridRetriever struct {
+	retrievers []Retriever
+	k          float64
+	fanout     int
+}
+
+// NewHybridRetriever returns a retriever fusing the results of
+// retrievers.
+func NewHybridRetriever(retrievers []Retriever, opts ...HybridOption) *HybridRetriever {
+	h := &HybridRetriever{retrievers: retrievers, k: DefaultRRFK, fanout: 1}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Retrieve implements Retriever.
+func (h *HybridRetriever) Retrieve(ctx context.Context, query string, limit int) ([]Document, error) {
+	scored, err := h.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return documentsOf(scored), nil
+}
+
+// RetrieveScored implements ScoredRetriever; the score is the fused RRF
+// score. The underlying retrievers run concurrently, and any error fails
+// the whole retrieval.
+func (h *HybridRetriever) RetrieveScored(ctx context.Context, query string, limit int) ([]ScoredDocument, error) {
+	fetch := limit
+	if limit > 0 && h.fanout > 1 {
+		fetch = limit * h.fanout
+	}
+
+	lists := make([][]Document, len(h.retrievers))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, rt := range h.retrievers {
+		g.Go(func() error {
+			docs, err := rt.Retrieve(gctx, query, fetch)
+			lists[i] = docs
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float64)
+	var fused []Document // first occurrence of each ID, in list order
+	for _, docs := range lists {
+		for rank, d := range docs {
+			if _, ok := scores[d.ID]; !ok {
+				fused = append(fused, d)
+			}
+			scores[d.ID] += 1 / (h.k + float64(rank+1))
+		}
+	}
+	sort.SliceStable(fused, func(a, b int) bool {
+		return scores[fused[a].ID] > scores[fused[b].ID]
+	})
+	if limit > 0 && len(fused) > limit {
+		fused = fused[:limit]
+	}
+
+	out := make([]ScoredDocument, len(fused))
+	for i, d := range fused {
+		out[i] = ScoredDocument{Document: d, Score: scores[d.ID]}
+	}
+	return out, nil
+}
@@ -0,0 +1,78 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func docsWithIDs(ids ...string) []rag.Document {
+	docs := make([]rag.Document, len(ids))
+	for i, id := range ids {
+		docs[i] = rag.Document{ID: id, Text: id, Metadata: map[string]string{rag.SpiceDBObjectKey: "document:" + id}}
+	}
+	return docs
+}
+
+func TestHybridRetrieverFusesRanks(t *testing.T) {
+	t.Parallel()
+
+	keyword := &staticRetriever{docs: docsWithIDs("a", "b", "c")}
+	vector := &staticRetriever{docs: docsWithIDs("c", "d")}
+	h := rag.NewHybridRetriever([]rag.Retriever{keyword, vector})
+
+	scored, err := h.RetrieveScored(context.Background(), "q", 0)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"c", "a", "b", "d"}, documentsOf(scored))
+	require.InDelta(t, 1.0/61+1.0/63, scored[0].Score, 1e-12)
+
+	docs, err := h.Retrieve(context.Background(), "q", 2)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"c", "a"}, docs)
+}
+
+func TestHybridRetrieverFanout(t *testing.T) {
+	t.Parallel()
+
+	keyword := &staticRetriever{docs: docsWithIDs("a", "b", "c")}
+	h := rag.NewHybridRetriever([]rag.Retriever{keyword}, rag.WithFanout(3), rag.WithRRFK(1))
+
+	scored, err := h.RetrieveScored(context.Background(), "q", 1)
+	require.NoError(t, err)
+	require.Equal(t, []int{3}, keyword.limits)
+	require.Len(t, scored, 1)
+	require.InDelta(t, 0.5, scored[0].Score, 1e-12)
+}
+
+func TestHybridRetrieverErrorsAndAuthorization(t *testing.T) {
+	t.Parallel()
+
+	boom := errors.New("index offline")
+	h := rag.NewHybridRetriever([]rag.Retriever{
+		&staticRetriever{docs: docsWithIDs("a")},
+		&staticRetriever{err: boom},
+	})
+	_, err := h.Retrieve(context.Background(), "q", 0)
+	require.ErrorIs(t, err, boom)
+
+	client, _ := newFakeClient("document:b#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(rag.NewHybridRetriever([]rag.Retriever{
+		rag.NewBM25Retriever(docsWithIDs("a", "b")),
+		&staticRetriever{docs: docsWithIDs("b", "c")},
+	})))
+	results, err := pipeline.Query(context.Background(), "emilia", "a b")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"b"}, results)
+}
+
+func documentsOf(scored []rag.ScoredDocument) []rag.Document {
+	docs := make([]rag.Document, len(scored))
+	for i, s := range scored {
+		docs[i] = s.Document
+	}
+	return docs
+}
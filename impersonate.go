@@ -0,0 +1,87 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// DefaultImpersonationPermission is the permission QueryAs checks unless
+// configured otherwise.
+const DefaultImpersonationPermission = "can_impersonate"
+
+// ErrImpersonationDenied is returned by QueryAs when the actor may not
+// act on behalf of the user.
+var ErrImpersonationDenied = errors.New("rag: impersonation denied")
+
+// WithImpersonationPermission sets the permission an actor must hold on
+// a user's SpiceDB object to query on the user's behalf with QueryAs.
+// The default is DefaultImpersonationPermission, e.g.
+//
+//	definition user {
+//	  relation support: user | serviceaccount
+//	  permission can_impersonate = support
+//	}
+func WithImpersonationPermission(permission string) Option {
+	return func(r *RAGPipeline) {
+		r.impersonation = permission
+	}
+}
+
+// QueryAs runs Query for onBehalfOf, a user ID like Query's, on behalf of
+// actor, a subject given as "type:id" or "type:id#relation" such as
+// "user:support-bob". It serves support and debugging workflows, where
+// an admin or service needs to see exactly what a user sees.
+//
+// The actor must hold the pipeline's impersonation permission (see
+// WithImpersonationPermission) on the user's object, e.g.
+// "user:emilia#can_impersonate@user:support-bob"; otherwise QueryAs
+// fails with ErrImpersonationDenied before retrieving anything. The
+// Auditor, if any, receives an event for the impersonation check,
+// allowed or not, and the events of the query carry both identities:
+// the user as Subject and the actor as Actor.
+func (r *RAGPipeline) QueryAs(ctx context.Context, actor, onBehalfOf, query string, opts ...QueryOption) ([]Document, error) {
+	actorRef, err := ParseSubjectReference(actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := (QueryRequest{UserID: onBehalfOf}).Validate(); err != nil {
+		return nil, err
+	}
+	// Under WithTenantPrefixes the user is in the query tenant's
+	// definitions; the actor is taken as given.
+	tenant := QueryRequest{UserID: onBehalfOf, Tenant: newQueryConfig(opts).tenant}.withContextSubject(ctx).Tenant
+	target := &apiv1.ObjectReference{ObjectType: r.tenantType(tenant, r.subjectType), ObjectId: onBehalfOf}
+
+	decision, err := r.checker.Check(ctx, actorRef, target, r.impersonation)
+	if err != nil {
+		return nil, fmt.Errorf("rag: checking impersonation of %s by %s: %w", objectKey(target), actor, backendError(ctx, err))
+	}
+	if r.auditor != nil {
+		if err := r.auditor.Audit(ctx, AuditEvent{
+			Time:       time.Now(),
+			Subject:    subjectKey(actorRef),
+			Resource:   objectKey(target),
+			Permission: r.impersonation,
+			Decision:   decision,
+		}); err != nil {
+			return nil, fmt.Errorf("rag: audit: %w", err)
+		}
+	}
+	if decision != DecisionAllowed {
+		return nil, fmt.Errorf("%w: %s may not act on behalf of %s", ErrImpersonationDenied, actor, objectKey(target))
+	}
+
+	return r.Query(context.WithValue(ctx, actorKey{}, subjectKey(actorRef)), onBehalfOf, query, opts...)
+}
+
+type actorKey struct{}
+
+// actorFromContext returns the actor of a QueryAs call, or "".
+func actorFromContext(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
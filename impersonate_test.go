@@ -0,0 +1,68 @@
+package rag_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestQueryAs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	audit := &auditRecorder{}
+	client, fake := newFakeClient(
+		"user:emilia#can_impersonate@user:support",
+		"document:doc1#read@user:emilia",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithAuditor(audit))
+
+	results, err := pipeline.QueryAs(ctx, "user:support", "emilia", "o")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	require.Len(t, audit.events, 3)
+	require.Equal(t, "user:support", audit.events[0].Subject)
+	require.Equal(t, "user:emilia", audit.events[0].Resource)
+	require.Equal(t, "can_impersonate", audit.events[0].Permission)
+	require.Equal(t, rag.DecisionAllowed, audit.events[0].Decision)
+	require.Empty(t, audit.events[0].Actor)
+	for _, e := range audit.events[1:] {
+		require.Equal(t, "user:emilia", e.Subject, "withheld documents are audited for the user")
+		require.Equal(t, "user:support", e.Actor)
+	}
+
+	checks := fake.checkCount()
+	_, err = pipeline.QueryAs(ctx, "user:support", "beatrice", "o")
+	require.ErrorIs(t, err, rag.ErrImpersonationDenied)
+	require.Equal(t, checks+1, fake.checkCount(), "nothing is retrieved when impersonation is denied")
+	require.Len(t, audit.events, 4)
+	require.Equal(t, rag.DecisionDenied, audit.events[3].Decision)
+	require.Equal(t, "user:beatrice", audit.events[3].Resource)
+
+	_, err = pipeline.QueryAs(ctx, "support", "emilia", "o")
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+	_, err = pipeline.QueryAs(ctx, "user:support", "", "o")
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+}
+
+func TestQueryAsCustomPermission(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	client, _ := newFakeClient(
+		"user:emilia#debug@serviceaccount:debugger",
+		"document:doc1#read@user:emilia",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithImpersonationPermission("debug"), rag.WithAuditor(rag.NewJSONAuditLog(&buf)))
+
+	results, err := pipeline.QueryAs(context.Background(), "serviceaccount:debugger", "emilia", "roadmap")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+	require.Contains(t, buf.String(), `"subject":"serviceaccount:debugger","resource":"user:emilia","permission":"debug","decision":"allowed"}`)
+}
@@ -0,0 +1,188 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// IngestOption configures AddDocument and IngestDocument.
+type IngestOption func(*ingestConfig)
+
+type ingestConfig struct {
+	relationships []relationshipSpec
+}
+
+type relationshipSpec struct {
+	relation, subject string
+}
+
+// WithRelationship makes AddDocument grant subject ("user:emilia",
+// "group:eng#member", "user:*") relation on the document's object.
+func WithRelationship(relation, subject string) IngestOption {
+	return func(c *ingestConfig) {
+		c.relationships = append(c.relationships, relationshipSpec{relation: relation, subject: subject})
+	}
+}
+
+// WithOwner is WithRelationship("owner", subject).
+func WithOwner(subject string) IngestOption {
+	return WithRelationship("owner", subject)
+}
+
+// WithViewer is WithRelationship("viewer", subject).
+func WithViewer(subject string) IngestOption {
+	return WithRelationship("viewer", subject)
+}
+
+// AddDocument adds doc to the corpus like AddDocuments and writes the
+// relationships given by opts on its object in one WriteRelationships
+// call, e.g.
+//
+//	token, err := pipeline.AddDocument(ctx, doc, rag.WithOwner("user:emilia"))
+//
+// It returns the revision of the write, nil without relationships, so
+// that queries made with AtLeastAsFresh(token) see the document together
+// with its access. The two happen as a unit: the document is validated
+// before anything is written, it is not added if the write fails, and
+// the relationships are deleted again if it cannot be added. The ID is
+// reserved from the start, so a concurrent call adding the same ID fails
+// with ErrDuplicateDocument before writing anything.
+func (r *RAGPipeline) AddDocument(ctx context.Context, doc Document, opts ...IngestOption) (*apiv1.ZedToken, error) {
+	put, err := r.ingest(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.reserve(doc.ID); err != nil {
+		return nil, err
+	}
+	defer r.release(doc.ID)
+
+	return r.ingestWith(ctx, doc, opts, func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.containsSourceLocked(doc.ID) {
+			// Sync added the same ID after the reservation.
+			return fmt.Errorf("%w: %q", ErrDuplicateDocument, doc.ID)
+		}
+		r.applyLocked(put, nil)
+		return nil
+	})
+}
+
+// reserve claims id for AddDocument until release, failing if it is in
+// the corpus or already claimed.
+func (r *RAGPipeline) reserve(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reserved[id] || r.containsSourceLocked(id) {
+		return fmt.Errorf("%w: %q", ErrDuplicateDocument, id)
+	}
+	if r.reserved == nil {
+		r.reserved = make(map[string]bool)
+	}
+	r.reserved[id] = true
+	return nil
+}
+
+// release gives up the claim reserve made on id.
+func (r *RAGPipeline) release(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.reserved, id)
+}
+
+// IngestDocument is AddDocument for documents kept in store rather than
+// in the pipeline's corpus: it writes doc's relationships and adds doc to
+// store as a unit. If the write fails, store is not called; if store.Add
+// fails, the relationships are deleted again, so no document is ever
+// retrievable without its ACL, nor an ACL left behind for a document
+// that was never stored.
+//
+// A rollback deletes the relationships it wrote, including identical
+// ones that existed before. If the rollback itself fails, its error is
+// joined to the returned one.
+func (r *RAGPipeline) IngestDocument(ctx context.Context, store DocumentStore, doc Document, opts ...IngestOption) (*apiv1.ZedToken, error) {
+	if err := r.admitTenant(doc); err != nil {
+		return nil, err
+	}
+	if r.strictMapping {
+		if err := r.ValidateMapping(doc); err != nil {
+			return nil, err
+		}
+	}
+	return r.ingestWith(ctx, doc, opts, func() error {
+		return store.Add(ctx, doc)
+	})
+}
+
+// ingestWith writes the relationships of opts on doc's object, then
+// calls add, deleting the relationships again if add fails.
+func (r *RAGPipeline) ingestWith(ctx context.Context, doc Document, opts []IngestOption, add func() error) (*apiv1.ZedToken, error) {
+	var cfg ingestConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.relationships) == 0 {
+		return nil, add()
+	}
+
+	updates, err := r.relationshipUpdates(doc, cfg.relationships)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.spiceClient.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{Updates: updates})
+	if err != nil {
+		return nil, fmt.Errorf("rag: writing relationships of document %q: %w", doc.ID, err)
+	}
+
+	if err := add(); err != nil {
+		for _, u := range updates {
+			u.Operation = apiv1.RelationshipUpdate_OPERATION_DELETE
+		}
+		// Roll back even if ctx was cancelled while adding.
+		rollbackCtx := context.WithoutCancel(ctx)
+		if _, rbErr := r.spiceClient.WriteRelationships(rollbackCtx, &apiv1.WriteRelationshipsRequest{Updates: updates}); rbErr != nil {
+			err = errors.Join(err, fmt.Errorf("rag: rolling back relationships of document %q: %w", doc.ID, rbErr))
+		}
+		return nil, err
+	}
+	return resp.GetWrittenAt(), nil
+}
+
+// containsSourceLocked reports whether the corpus holds the document id
+// or chunks of it. The caller must hold r.mu.
+func (r *RAGPipeline) containsSourceLocked(id string) bool {
+	for _, d := range r.docs {
+		if r.sourceID(d) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// relationshipUpdates builds the TOUCH updates granting specs on doc's
+// object.
+func (r *RAGPipeline) relationshipUpdates(doc Document, specs []relationshipSpec) ([]*apiv1.RelationshipUpdate, error) {
+	res, err := r.resourceFor(doc)
+	if err != nil {
+		return nil, fmt.Errorf("rag: document %q: %w", doc.ID, err)
+	}
+	updates := make([]*apiv1.RelationshipUpdate, len(specs))
+	for i, spec := range specs {
+		if spec.relation == "" {
+			return nil, fmt.Errorf("rag: no relation to %s on document %q", spec.subject, doc.ID)
+		}
+		subj, err := ParseSubjectReference(spec.subject)
+		if err != nil {
+			return nil, fmt.Errorf("rag: document %q: %w", doc.ID, err)
+		}
+		updates[i] = &apiv1.RelationshipUpdate{
+			Operation:    apiv1.RelationshipUpdate_OPERATION_TOUCH,
+			Relationship: &apiv1.Relationship{Resource: res, Relation: spec.relation, Subject: subj},
+		}
+	}
+	return updates, nil
+}
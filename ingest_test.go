@@ -0,0 +1,172 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestAddDocumentWritesRelationships(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil)
+
+	doc := rag.Document{ID: "doc1", Text: "roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}}
+	token, err := pipeline.AddDocument(ctx, doc, rag.WithOwner("user:emilia"), rag.WithViewer("group:eng#member"))
+	require.NoError(t, err)
+	require.NotEmpty(t, token.GetToken())
+	require.Equal(t, []string{"document:doc1#read@group:eng#member", "document:doc1#read@user:emilia"}, fake.tuples())
+
+	results, err := pipeline.Query(ctx, "emilia", "roadmap", rag.WithConsistency(rag.AtLeastAsFresh(token)))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	// Without relationships nothing is written.
+	token, err = pipeline.AddDocument(ctx, rag.Document{ID: "doc2", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc2"}})
+	require.NoError(t, err)
+	require.Nil(t, token)
+	require.Len(t, fake.tuples(), 2)
+}
+
+func TestAddDocumentValidatesBeforeWriting(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	_, err := pipeline.AddDocument(ctx, scenarioDocs()[0], rag.WithOwner("user:emilia"))
+	require.ErrorIs(t, err, rag.ErrDuplicateDocument)
+
+	_, err = pipeline.AddDocument(ctx, rag.Document{ID: "unmapped", Text: "x"}, rag.WithOwner("user:emilia"))
+	require.ErrorIs(t, err, rag.ErrNoResourceMapping)
+
+	_, err = pipeline.AddDocument(ctx, rag.Document{ID: "doc4", Text: "x", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc4"}},
+		rag.WithOwner("emilia"))
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+	require.Empty(t, fake.tuples())
+
+	fake.failWrite = errors.New("write failed")
+	_, err = pipeline.AddDocument(ctx, rag.Document{ID: "doc4", Text: "x", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc4"}},
+		rag.WithOwner("user:emilia"))
+	require.ErrorContains(t, err, "write failed")
+	// doc4 was not added, so adding it again is no duplicate.
+	require.NoError(t, pipeline.AddDocuments(rag.Document{ID: "doc4", Text: "x", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc4"}}))
+}
+
+func TestAddDocumentConcurrentDuplicate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil)
+	doc := rag.Document{ID: "doc1", Text: "roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}}
+
+	// A second call for the same ID runs while the first is writing.
+	var raced error
+	fake.beforeWrite = func() {
+		fake.beforeWrite = nil
+		_, raced = pipeline.AddDocument(ctx, doc, rag.WithViewer("user:emilia"))
+	}
+	_, err := pipeline.AddDocument(ctx, doc, rag.WithViewer("user:emilia"))
+	require.NoError(t, err)
+	require.ErrorIs(t, raced, rag.ErrDuplicateDocument)
+	require.Equal(t, []string{"document:doc1#read@user:emilia"}, fake.tuples(), "the loser wrote and deleted nothing")
+
+	// The winner stays readable with its access.
+	acl, err := pipeline.ListAccess(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{{Relation: "viewer", Subject: "user:emilia"}}, acl)
+	results, err := pipeline.Query(ctx, "emilia", "roadmap")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	// Nor can AddDocuments slip the ID in meanwhile.
+	fake.beforeWrite = func() {
+		fake.beforeWrite = nil
+		raced = pipeline.AddDocuments(rag.Document{ID: "doc2", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc2"}})
+	}
+	_, err = pipeline.AddDocument(ctx, rag.Document{ID: "doc2", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc2"}},
+		rag.WithViewer("user:emilia"))
+	require.NoError(t, err)
+	require.ErrorIs(t, raced, rag.ErrDuplicateDocument)
+}
+
+// failingStore is a DocumentStore over a map whose Add can be made to
+// fail.
+type failingStore struct {
+	rag.SubstringRetriever
+
+	docs    map[string]rag.Document
+	failAdd error
+}
+
+func (s *failingStore) Add(_ context.Context, docs ...rag.Document) error {
+	if s.failAdd != nil {
+		return s.failAdd
+	}
+	for _, d := range docs {
+		s.docs[d.ID] = d
+	}
+	return nil
+}
+
+func (s *failingStore) Remove(_ context.Context, ids ...string) error {
+	for _, id := range ids {
+		delete(s.docs, id)
+	}
+	return nil
+}
+
+func TestIngestDocumentIsAtomic(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	store := &failingStore{docs: make(map[string]rag.Document)}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(store))
+	doc := rag.Document{ID: "doc1", Text: "roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}}
+
+	// The store fails: the relationships are rolled back.
+	store.failAdd = errors.New("store unavailable")
+	_, err := pipeline.IngestDocument(ctx, store, doc, rag.WithOwner("user:emilia"))
+	require.ErrorContains(t, err, "store unavailable")
+	require.Empty(t, fake.tuples())
+	require.Empty(t, store.docs)
+
+	// SpiceDB fails: the store is not called.
+	store.failAdd = nil
+	fake.failWrite = errors.New("write failed")
+	_, err = pipeline.IngestDocument(ctx, store, doc, rag.WithOwner("user:emilia"))
+	require.ErrorContains(t, err, "write failed")
+	require.Empty(t, store.docs)
+
+	fake.failWrite = nil
+	token, err := pipeline.IngestDocument(ctx, store, doc, rag.WithOwner("user:emilia"))
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	require.Equal(t, []string{"document:doc1#read@user:emilia"}, fake.tuples())
+	require.Contains(t, store.docs, "doc1")
+}
+
+func TestIngestDocumentReportsFailedRollback(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	store := &failingStore{docs: make(map[string]rag.Document), failAdd: errors.New("store unavailable")}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil)
+	doc := rag.Document{ID: "doc1", Text: "roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}}
+
+	// The first write succeeds and the rollback fails.
+	fake.failWriteAfter = 1
+	fake.failWrite = errors.New("spicedb went away")
+	_, err := pipeline.IngestDocument(context.Background(), store, doc, rag.WithOwner("user:emilia"))
+	require.ErrorContains(t, err, "store unavailable")
+	require.ErrorContains(t, err, "rolling back relationships of document \"doc1\": spicedb went away")
+}
@@ -0,0 +1,120 @@
+package rag
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Results runs req like Do but yields the authorized results as their
+// permission checks complete, so callers can render the first results
+// before every candidate is decided:
+//
+//	for res, err := range pipeline.Results(ctx, req) {
+//		if err != nil {
+//			return err
+//		}
+//		render(res.Document)
+//	}
+//
+// Candidates are checked in retrieval order, a chunk at a time: as many
+// as one CheckBulkPermissions request carries (see
+// WithBulkCheckChunkSize), or as many as run at once for checkers that
+// cannot check in bulk (see WithCheckConcurrency). Results come in the
+// same order as from Do. Checking stops once TopK results were yielded or
+// the loop ends early, so breaking out also saves the remaining checks.
+//
+// An error is yielded once, with a zero QueryResult, and ends the
+// sequence; results yielded before it stand. Under the prefilter strategy
+// every candidate is decided during retrieval, and under
+// RerankAfterFilter or WithMMR before the results are ordered, so all
+// results arrive at once. A paged request (see QueryRequest.PageSize)
+// yields its page once it is decided; use Do to get its NextCursor.
+func (r *RAGPipeline) Results(ctx context.Context, req QueryRequest) iter.Seq2[QueryResult, error] {
+	return func(yield func(QueryResult, error) bool) {
+		ctx, span := r.tracer().Start(ctx, "rag.query", trace.WithAttributes(
+			attribute.Bool("rag.prefilter", r.strategy == FilterPrefilter),
+			attribute.Int("rag.top_k", req.TopK),
+			attribute.Bool("rag.iterate", true),
+		))
+		start := time.Now()
+		q, emitted, err := r.iterate(ctx, req, yield)
+		r.metrics.observeQuery(q.resp.Stats, time.Since(start), err)
+		span.SetAttributes(statsAttributes(q.resp.Stats)...)
+		span.SetAttributes(attribute.Int("rag.returned", emitted))
+		endSpan(span, err)
+		if err != nil {
+			yield(QueryResult{}, err)
+		}
+	}
+}
+
+// iterate runs the query of Results, yielding results as they are
+// decided. It reports how many it yielded.
+func (r *RAGPipeline) iterate(ctx context.Context, req QueryRequest, yield func(QueryResult, error) bool) (*pendingQuery, int, error) {
+	q, err := r.prepare(ctx, req)
+	if err != nil {
+		return q, 0, err
+	}
+
+	emitted := 0
+	// emit yields the results from index from on and reports whether to
+	// go on.
+	emit := func(from int) bool {
+		for _, res := range q.resp.Results[from:] {
+			if req.TopK > 0 && emitted == req.TopK {
+				return false
+			}
+			if !yield(res, nil) {
+				return false
+			}
+			emitted++
+		}
+		return req.TopK <= 0 || emitted < req.TopK
+	}
+	if q.paged() {
+		if err := q.page(); err != nil {
+			return q, emitted, err
+		}
+		emit(0)
+		return q, emitted, nil
+	}
+	if r.selectsFromAll() {
+		if err := q.decideAll(); err != nil {
+			return q, emitted, err
+		}
+	}
+	if !emit(0) {
+		return q, emitted, nil
+	}
+
+	chunk := r.iterateChunkSize()
+	for start := 0; start < len(q.docs); start += chunk {
+		end := min(start+chunk, len(q.docs))
+		from := len(q.resp.Results)
+		if err := q.decide(q.docs[start:end], q.resources[start:end]); err != nil {
+			return q, emitted, err
+		}
+		if !emit(from) {
+			break
+		}
+	}
+	return q, emitted, nil
+}
+
+// iterateChunkSize is how many candidates Results decides at a time.
+func (r *RAGPipeline) iterateChunkSize() int {
+	if _, ok := r.checker.(BulkPermissionChecker); ok {
+		if r.bulkChunkSize > 0 {
+			return r.bulkChunkSize
+		}
+		return DefaultBulkCheckChunkSize
+	}
+	if r.checkConcurrency > 0 {
+		return r.checkConcurrency
+	}
+	return DefaultCheckConcurrency
+}
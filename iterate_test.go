@@ -0,0 +1,77 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestResultsMatchesDo(t *testing.T) {
+	t.Parallel()
+
+	var allowed []string
+	for _, id := range []string{"doc1", "doc4", "doc7", "doc8", "doc15"} {
+		allowed = append(allowed, "document:"+id+"#read@user:emilia")
+	}
+	client, _ := newFakeClient(allowed...)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(20), rag.WithBulkCheckChunkSize(3))
+
+	req := rag.QueryRequest{UserID: "emilia", Query: "synthetic"}
+	want, err := pipeline.Do(context.Background(), req)
+	require.NoError(t, err)
+
+	var got []string
+	for res, err := range pipeline.Results(context.Background(), req) {
+		require.NoError(t, err)
+		require.Equal(t, rag.DecisionAllowed, res.Decision)
+		got = append(got, res.Document.ID)
+	}
+	var wantIDs []string
+	for _, d := range want.Documents {
+		wantIDs = append(wantIDs, d.ID)
+	}
+	require.Len(t, got, 5)
+	require.Equal(t, wantIDs, got)
+}
+
+func TestResultsStopsChecking(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc0#read@user:emilia", "document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(20), rag.WithBulkCheckChunkSize(5))
+
+	// The first chunk holds enough results for TopK, so the rest of the
+	// candidates are never checked.
+	var got []string
+	for res, err := range pipeline.Results(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic", TopK: 1}) {
+		require.NoError(t, err)
+		got = append(got, res.Document.ID)
+	}
+	require.Equal(t, []string{"doc0"}, got)
+	require.Equal(t, 5, fake.checkCount())
+
+	// Breaking out of the loop stops checking too.
+	for range pipeline.Results(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"}) {
+		break
+	}
+	require.Equal(t, 10, fake.checkCount())
+}
+
+func TestResultsYieldsErrors(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+
+	var errs []error
+	for res, err := range pipeline.Results(context.Background(), rag.QueryRequest{Query: "synthetic"}) {
+		require.Zero(t, res)
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], rag.ErrInvalidRequest), errs[0])
+}
@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IngestDir loads the files under dir with the loader for their
+// extension and adds each to dst, e.g.
+//
+//	res, err := loader.IngestDir(ctx, "./docs", pipeline,
+//		loader.WithExclude("drafts/**"),
+//		loader.WithObjectType("document"),
+//		loader.WithIngestOptions(rag.WithOwner("group:eng#member")))
+//
+// Files and directories whose names start with "." are skipped, and
+// excluded directories are not walked. Files are ingested one at a time
+// in lexical order; IngestDir stops at the first error, returning what
+// was ingested before it.
+func IngestDir(ctx context.Context, dir string, dst Ingester, opts ...Option) (*Result, error) {
+	cfg, err := newIngestConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return Ingest(ctx, dirSource{dir: dir, skip: cfg.excluded}, dst, opts...)
+}
+
+// dirSource is a Source over the regular files under dir.
+type dirSource struct {
+	dir  string
+	skip func(rel string) bool
+}
+
+func (s dirSource) Files(ctx context.Context) iter.Seq2[File, error] {
+	return func(yield func(File, error) bool) {
+		err := filepath.WalkDir(s.dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(s.dir, name)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			if strings.HasPrefix(d.Name(), ".") || d.IsDir() && s.skip(rel) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			f := File{
+				Path:     rel,
+				Location: name,
+				Open: func(context.Context) (io.ReadCloser, error) {
+					return os.Open(name)
+				},
+			}
+			if !yield(f, nil) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			yield(File{}, err)
+		}
+	}
+}
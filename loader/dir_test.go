@@ -0,0 +1,159 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+var _ loader.Ingester = (*rag.RAGPipeline)(nil)
+
+// recordingIngester records the documents added to it.
+type recordingIngester struct {
+	docs []rag.Document
+	opts [][]rag.IngestOption
+	err  error
+}
+
+func (r *recordingIngester) AddDocument(_ context.Context, doc rag.Document, opts ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.docs = append(r.docs, doc)
+	r.opts = append(r.opts, opts)
+	return &apiv1.ZedToken{Token: doc.ID}, nil
+}
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return dir
+}
+
+func ids(docs []rag.Document) []string {
+	out := make([]string, len(docs))
+	for i, d := range docs {
+		out[i] = d.ID
+	}
+	return out
+}
+
+var tree = map[string]string{
+	"handbook.md":             "# Handbook\n\nWelcome.",
+	"team/on call.txt":        "Pager rotation.",
+	"team/drafts/plan.md":     "Draft plan.",
+	"site/index.html":         "<title>Site</title><p>Home page</p>",
+	"site/logo.png":           "\x89PNG",
+	".git/config":             "[core]",
+	"notes/.hidden.md":        "secret",
+	"notes/2024/q1/review.md": "Q1 review.",
+}
+
+func TestIngestDir(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, tree)
+	dst := &recordingIngester{}
+	res, err := loader.IngestDir(context.Background(), dir, dst,
+		loader.WithExclude("drafts"),
+		loader.WithObjectType("document"),
+		loader.WithIngestOptions(rag.WithOwner("user:emilia")))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"handbook", "notes/2024/q1/review", "site/index", "team/on_call"}, ids(res.Documents))
+	require.Equal(t, res.Documents, dst.docs)
+	require.Equal(t, []string{"site/logo.png"}, res.Skipped)
+	require.Equal(t, "team/on_call", res.Token.GetToken(), "the last write's revision")
+
+	handbook := res.Documents[0]
+	require.Equal(t, "Handbook\n\nWelcome.", handbook.Text)
+	require.Equal(t, "document:handbook", handbook.Metadata[rag.SpiceDBObjectKey])
+	require.Equal(t, filepath.Join(dir, "handbook.md"), handbook.Metadata[loader.SourceKey])
+	require.Equal(t, "Site", res.Documents[2].Metadata[loader.TitleKey])
+	for _, opts := range dst.opts {
+		require.Len(t, opts, 1)
+	}
+}
+
+func TestIngestDirGlobs(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, tree)
+	for _, tc := range []struct {
+		include, exclude []string
+		want             []string
+	}{
+		{include: []string{"*.md"}, want: []string{"handbook", "notes/2024/q1/review", "team/drafts/plan"}},
+		{include: []string{"notes/**/*.md"}, want: []string{"notes/2024/q1/review"}},
+		{include: []string{"**/*.md"}, exclude: []string{"team/**"}, want: []string{"handbook", "notes/2024/q1/review"}},
+		{include: []string{"team/*"}, want: []string{"team/on_call"}},
+		{exclude: []string{"*.md", "site"}, want: []string{"team/on_call"}},
+	} {
+		dst := &recordingIngester{}
+		res, err := loader.IngestDir(context.Background(), dir, dst,
+			loader.WithInclude(tc.include...), loader.WithExclude(tc.exclude...))
+		require.NoError(t, err)
+		require.Equal(t, tc.want, ids(res.Documents), "include %v exclude %v", tc.include, tc.exclude)
+	}
+
+	_, err := loader.IngestDir(context.Background(), dir, &recordingIngester{}, loader.WithInclude("[a-"))
+	require.ErrorContains(t, err, `pattern "[a-"`)
+}
+
+func TestIngestDirMapping(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{
+		"eng/runbook.md": "---\nclassification: internal\n---\nRestart the service.",
+		"hr/policy.md":   "Leave policy.",
+		"misc/readme.md": "Unowned.",
+	})
+	// The top-level directory decides the team folder a file belongs to.
+	res, err := loader.IngestDir(context.Background(), dir, &recordingIngester{},
+		loader.WithIDFunc(func(path string) string { return "f-" + loader.PathID(filepath.Base(path)) }),
+		loader.WithObjectFunc(func(path string, doc rag.Document) (string, error) {
+			switch team, _, _ := strings.Cut(path, "/"); team {
+			case "eng", "hr":
+				return "folder:" + team, nil
+			}
+			return "", nil
+		}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"f-runbook", "f-policy", "f-readme"}, ids(res.Documents))
+	require.Equal(t, "folder:eng", res.Documents[0].Metadata[rag.SpiceDBObjectKey])
+	require.Equal(t, "internal", res.Documents[0].Metadata["classification"])
+	require.Equal(t, "folder:hr", res.Documents[1].Metadata[rag.SpiceDBObjectKey])
+	require.NotContains(t, res.Documents[2].Metadata, rag.SpiceDBObjectKey, "left to the pipeline's mapper")
+
+	_, err = loader.IngestDir(context.Background(), dir, &recordingIngester{},
+		loader.WithObjectFunc(func(string, rag.Document) (string, error) { return "no-colon", nil }))
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+}
+
+func TestIngestDirStopsAtFirstError(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, tree)
+	boom := errors.New("boom")
+	res, err := loader.IngestDir(context.Background(), dir, &recordingIngester{err: boom})
+	require.ErrorIs(t, err, boom)
+	require.ErrorContains(t, err, "handbook.md")
+	require.Empty(t, res.Documents)
+
+	_, err = loader.IngestDir(context.Background(), filepath.Join(dir, "missing"), &recordingIngester{})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
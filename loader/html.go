@@ -0,0 +1,145 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// HTML loads HTML, keeping the visible text of the body with a line
+// break around every block element. Scripts, styles, form controls,
+// navigation and hidden elements are left out. The <title>, or else the
+// first <h1>, becomes TitleKey; the document's lang and its description,
+// author and keywords <meta> elements become metadata.
+type HTML struct{}
+
+// skipped are the elements whose content is not part of the text.
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Nav: true, atom.Button: true,
+	atom.Input: true, atom.Select: true, atom.Textarea: true,
+}
+
+// blocks are the elements that start a new line.
+var blocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Ol: true,
+	atom.P: true, atom.Pre: true, atom.Section: true, atom.Table: true, atom.Tr: true,
+	atom.Ul: true, atom.Details: true, atom.Summary: true,
+}
+
+// Load implements Loader.
+func (HTML) Load(ctx context.Context, r io.Reader) (rag.Document, error) {
+	b, err := readAll(ctx, r)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	root, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return rag.Document{}, err
+	}
+
+	md := map[string]string{FormatKey: "html"}
+	var text strings.Builder
+	var h1 string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Head:
+				// Only the title and meta elements of the head matter.
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if c.DataAtom == atom.Title || c.DataAtom == atom.Meta {
+						walk(c)
+					}
+				}
+				return
+			case atom.Title:
+				setMetadata(md, TitleKey, strings.Join(strings.Fields(textOf(n)), " "))
+				return
+			case atom.Meta:
+				if name := strings.ToLower(attr(n, "name")); name == "description" || name == "author" || name == "keywords" {
+					setMetadata(md, name, strings.TrimSpace(attr(n, "content")))
+				}
+				return
+			case atom.Img:
+				text.WriteString(" " + attr(n, "alt") + " ")
+				return
+			case atom.Html:
+				setMetadata(md, "lang", attr(n, "lang"))
+			case atom.H1:
+				if h1 == "" {
+					h1 = strings.Join(strings.Fields(textOf(n)), " ")
+				}
+			case atom.Td, atom.Th:
+				text.WriteByte(' ')
+			}
+			if skipped[n.DataAtom] || hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && blocks[n.DataAtom]
+		if block {
+			text.WriteByte('\n')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			text.WriteByte('\n')
+		}
+	}
+	walk(root)
+
+	if md[TitleKey] == "" {
+		setMetadata(md, TitleKey, h1)
+	}
+	return rag.Document{Text: normalize(text.String()), Metadata: md}, nil
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textOf returns all the text below n.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
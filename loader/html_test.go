@@ -0,0 +1,58 @@
+package loader_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+func TestHTML(t *testing.T) {
+	t.Parallel()
+
+	src := `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <title> Launch Plan </title>
+  <meta name="description" content="How we launch">
+  <meta name="author" content="emilia">
+  <meta name="spicedb_object" content="document:secret">
+  <style>body { color: red }</style>
+  <script>var secret = "token";</script>
+</head>
+<body>
+  <nav><a href="/">Home</a> <a href="/docs">Docs</a></nav>
+  <h1>Overview</h1>
+  <p>The <b>launch</b> is planned for <a href="/q3">Q3</a>.</p>
+  <div hidden>hidden text</div>
+  <span aria-hidden="true">decorative</span>
+  <ul><li>first</li><li>second</li></ul>
+  <table><tr><td>a</td><td>b</td></tr></table>
+  <img src="d.png" alt="diagram">
+  <noscript>enable javascript</noscript>
+</body>
+</html>`
+
+	doc, err := loader.HTML{}.Load(context.Background(), strings.NewReader(src))
+	require.NoError(t, err)
+	require.Equal(t, "Overview\n\nThe launch is planned for Q3.\n\nfirst\n\nsecond\n\na b\n\ndiagram", doc.Text)
+	require.Equal(t, map[string]string{
+		loader.TitleKey:  "Launch Plan",
+		loader.FormatKey: "html",
+		"lang":           "en",
+		"description":    "How we launch",
+		"author":         "emilia",
+	}, doc.Metadata)
+}
+
+func TestHTMLTitleFromHeading(t *testing.T) {
+	t.Parallel()
+
+	doc, err := loader.HTML{}.Load(context.Background(), strings.NewReader("<p>intro</p><h1>The <em>Heading</em></h1>"))
+	require.NoError(t, err)
+	require.Equal(t, "The Heading", doc.Metadata[loader.TitleKey])
+	require.Equal(t, "intro\n\nThe Heading", doc.Text)
+}
@@ -0,0 +1,424 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// Ingester adds a document together with its relationships.
+// *rag.RAGPipeline implements it with AddDocument; IntoStore adapts a
+// pipeline and an external DocumentStore.
+type Ingester interface {
+	AddDocument(ctx context.Context, doc rag.Document, opts ...rag.IngestOption) (*apiv1.ZedToken, error)
+}
+
+// Updater is implemented by Ingesters that reject documents they already
+// hold, such as *rag.RAGPipeline, so Ingest can replace them instead when
+// a source is ingested again.
+type Updater interface {
+	UpdateDocument(doc rag.Document) error
+}
+
+// AccessSetter is implemented by Ingesters that can mirror a File's
+// Access; *rag.RAGPipeline does with SetAccess.
+type AccessSetter interface {
+	SetAccess(ctx context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error)
+}
+
+// IntoStore returns an Ingester that adds documents to store with
+// pipeline.IngestDocument.
+func IntoStore(pipeline *rag.RAGPipeline, store rag.DocumentStore) Ingester {
+	return storeIngester{pipeline: pipeline, store: store}
+}
+
+type storeIngester struct {
+	pipeline *rag.RAGPipeline
+	store    rag.DocumentStore
+}
+
+func (s storeIngester) AddDocument(ctx context.Context, doc rag.Document, opts ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	return s.pipeline.IngestDocument(ctx, s.store, doc, opts...)
+}
+
+func (s storeIngester) SetAccess(ctx context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	return s.pipeline.SetAccess(ctx, object, relations, entries)
+}
+
+// Source lists the files Ingest loads, such as a directory tree or the
+// objects under a bucket prefix.
+type Source interface {
+	// Files yields the files in a stable order. Ingest stops at the
+	// first error.
+	Files(ctx context.Context) iter.Seq2[File, error]
+}
+
+// File is a file listed by a Source.
+type File struct {
+	// Path is the file's slash-separated path relative to the source,
+	// e.g. "team/handbook.md". Patterns are matched against it, and
+	// document IDs and objects derived from it.
+	Path string
+	// Location is recorded under SourceKey: a file name, or a URL such
+	// as "s3://bucket/team/handbook.md".
+	Location string
+	// Metadata is added to the document's, e.g. the bucket and ETag of
+	// an object.
+	Metadata map[string]string
+	// Open opens the file's content.
+	Open func(ctx context.Context) (io.ReadCloser, error)
+
+	// ID, if set, is the document's ID, for sources with stable IDs of
+	// their own. WithIDFunc overrides it.
+	ID string
+	// Loader, if set, loads the file instead of the loader for its
+	// Path's extension, e.g. for exports without a file name.
+	Loader Loader
+	// Access, if set, is the file's sharing in the source system, which
+	// Ingest mirrors onto the document's object.
+	Access *Access
+}
+
+// Access is the sharing of a file in its source system, as SpiceDB
+// relationships on the file's document object.
+type Access struct {
+	// Relations are the relations the source decides, e.g. "owner" and
+	// "viewer". Relationships of these relations not in Entries are
+	// deleted.
+	Relations []string
+	// Entries are the relationships the file's sharing grants.
+	Entries []rag.ACLEntry
+}
+
+// ObjectFunc maps a file to the SpiceDB object, "type:id", its document
+// is authorized against. path is the file's slash-separated path relative
+// to the source, and doc the loaded document with its ID set. An empty
+// object leaves the document to the pipeline's ResourceMapper.
+type ObjectFunc func(path string, doc rag.Document) (string, error)
+
+// Option configures Ingest and IngestDir.
+type Option func(*ingestConfig)
+
+type ingestConfig struct {
+	include, exclude []string
+	id               func(path string) string
+	object           ObjectFunc
+	ingest           []rag.IngestOption
+}
+
+// WithInclude restricts ingestion to files matching one of patterns. By
+// default every file with a loader is included.
+//
+// Patterns are matched against the slash-separated path relative to the
+// source, as with path.Match, except that "**" matches any number of
+// directories: "docs/**/*.md". A pattern without a slash matches the base
+// name at any depth, so "*.pdf" includes every PDF.
+func WithInclude(patterns ...string) Option {
+	return func(c *ingestConfig) {
+		c.include = append(c.include, patterns...)
+	}
+}
+
+// WithExclude skips files matching one of patterns, written as for
+// WithInclude, and the files in directories matching one. Exclusions win
+// over inclusions.
+func WithExclude(patterns ...string) Option {
+	return func(c *ingestConfig) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
+// WithIDFunc sets how document IDs are derived from the files'
+// slash-separated relative paths. By default a File's own ID is used,
+// and PathID for files without one.
+func WithIDFunc(fn func(path string) string) Option {
+	return func(c *ingestConfig) {
+		c.id = fn
+	}
+}
+
+// WithObjectFunc sets how files are mapped to SpiceDB objects; the
+// result is stored as the document's rag.SpiceDBObjectKey, replacing any
+// object the source set.
+func WithObjectFunc(fn ObjectFunc) Option {
+	return func(c *ingestConfig) {
+		c.object = fn
+	}
+}
+
+// WithObjectType maps every file to an object of objType whose ID is the
+// document's: "document:team/handbook".
+func WithObjectType(objType string) Option {
+	return WithObjectFunc(func(_ string, doc rag.Document) (string, error) {
+		return objType + ":" + doc.ID, nil
+	})
+}
+
+// ObjectFromPath returns an ObjectFunc deriving objects from the path
+// structure: paths matching the regular expression pattern map to
+// object, in which $name or ${name} expands to the pattern's named
+// groups, as in regexp.Regexp.Expand. Other paths are left unmapped.
+// With
+//
+//	loader.ObjectFromPath(`^teams/(?P<team>[^/]+)/`, "folder:$team")
+//
+// "teams/eng/runbook.md" is authorized against folder:eng. It panics if
+// pattern does not compile.
+func ObjectFromPath(pattern, object string) ObjectFunc {
+	re := regexp.MustCompile(pattern)
+	return func(path string, _ rag.Document) (string, error) {
+		m := re.FindStringSubmatchIndex(path)
+		if m == nil {
+			return "", nil
+		}
+		return string(re.ExpandString(nil, object, path, m)), nil
+	}
+}
+
+// WithIngestOptions passes opts, such as rag.WithOwner, to every
+// AddDocument call.
+func WithIngestOptions(opts ...rag.IngestOption) Option {
+	return func(c *ingestConfig) {
+		c.ingest = append(c.ingest, opts...)
+	}
+}
+
+// Result describes what Ingest ingested.
+type Result struct {
+	// Documents are the ingested documents, in the source's order.
+	Documents []rag.Document
+	// Skipped holds the paths of included files no loader handles.
+	Skipped []string
+	// Token is the revision of the last relationship write, nil if none
+	// was made. Queries made with rag.AtLeastAsFresh(Token) see every
+	// ingested document with its access.
+	Token *apiv1.ZedToken
+}
+
+// invalidIDChars are the characters SpiceDB object IDs may not hold.
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9/_|\-=+]`)
+
+// PathID derives a document ID from a slash-separated relative path: the
+// path without its extension, with the characters SpiceDB object IDs may
+// not hold replaced by "_". "team/on call.md" becomes "team/on_call".
+func PathID(p string) string {
+	return invalidIDChars.ReplaceAllString(strings.TrimSuffix(p, path.Ext(p)), "_")
+}
+
+// EscapeID turns an identity from another system, such as an email
+// address or account ID, into a SpiceDB object ID: every character other
+// than letters, digits, "_" and "-" is written as "=" and its hex code,
+// so "emilia@example.com" becomes "emilia=40example=2ecom". Unlike
+// PathID it maps distinct identities to distinct IDs.
+func EscapeID(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "=%02x", c)
+	}
+	return b.String()
+}
+
+// Ingest loads the files of src with the loader for their extension and
+// adds each to dst. Files are ingested one at a time; Ingest stops at
+// the first error, returning what was ingested before it.
+//
+// A document dst already holds is replaced if dst is an Updater; the
+// relationships of WithIngestOptions are only written when it is first
+// added. A file's Access is set, with dst's AccessSetter, before its
+// document is added or replaced, so revoked sharing never outlives the
+// content it protected.
+func Ingest(ctx context.Context, src Source, dst Ingester, opts ...Option) (*Result, error) {
+	cfg, err := newIngestConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	for f, err := range src.Files(ctx) {
+		if err != nil {
+			return res, err
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if cfg.excluded(f.Path) || len(cfg.include) > 0 && !matchAny(cfg.include, f.Path) {
+			continue
+		}
+		l := f.Loader
+		if l == nil {
+			var ok bool
+			if l, ok = ForExtension(path.Ext(f.Path)); !ok {
+				res.Skipped = append(res.Skipped, f.Path)
+				continue
+			}
+		}
+
+		doc, err := cfg.load(ctx, l, f)
+		if err == nil {
+			err = ingestFile(ctx, dst, doc, f.Access, cfg, res)
+		}
+		if err != nil {
+			return res, fmt.Errorf("loader: %s: %w", f.Location, err)
+		}
+		res.Documents = append(res.Documents, doc)
+	}
+	return res, nil
+}
+
+// ingestFile sets doc's access, if given, and adds or replaces doc.
+func ingestFile(ctx context.Context, dst Ingester, doc rag.Document, access *Access, cfg *ingestConfig, res *Result) error {
+	if access != nil {
+		setter, ok := dst.(AccessSetter)
+		if !ok {
+			return fmt.Errorf("%T cannot set access", dst)
+		}
+		object := doc.Metadata[rag.SpiceDBObjectKey]
+		if object == "" {
+			return errors.New("no SpiceDB object to set access on")
+		}
+		token, err := setter.SetAccess(ctx, object, access.Relations, access.Entries)
+		if err != nil {
+			return err
+		}
+		if token != nil {
+			res.Token = token
+		}
+	}
+
+	token, err := dst.AddDocument(ctx, doc, cfg.ingest...)
+	if updater, ok := dst.(Updater); ok && errors.Is(err, rag.ErrDuplicateDocument) {
+		err = updater.UpdateDocument(doc)
+	}
+	if err != nil {
+		return err
+	}
+	if token != nil {
+		res.Token = token
+	}
+	return nil
+}
+
+func newIngestConfig(opts []Option) (*ingestConfig, error) {
+	cfg := &ingestConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	for _, p := range slices.Concat(cfg.include, cfg.exclude) {
+		if _, err := path.Match(strings.ReplaceAll(p, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("loader: pattern %q: %w", p, err)
+		}
+	}
+	return cfg, nil
+}
+
+// load loads f with l and sets its ID, metadata and object.
+func (c *ingestConfig) load(ctx context.Context, l Loader, f File) (rag.Document, error) {
+	rc, err := f.Open(ctx)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	defer rc.Close()
+
+	doc, err := l.Load(ctx, rc)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]string)
+	}
+	for k, v := range f.Metadata {
+		doc.Metadata[k] = v
+	}
+	doc.Metadata[SourceKey] = f.Location
+	switch {
+	case c.id != nil:
+		doc.ID = c.id(f.Path)
+	case f.ID != "":
+		doc.ID = f.ID
+	default:
+		doc.ID = PathID(f.Path)
+	}
+	if doc.ID == "" {
+		return rag.Document{}, errors.New("empty document ID")
+	}
+	if c.object != nil {
+		obj, err := c.object(f.Path, doc)
+		if err != nil {
+			return rag.Document{}, err
+		}
+		if obj != "" {
+			if _, err := rag.ParseObjectReference(obj); err != nil {
+				return rag.Document{}, err
+			}
+			doc.Metadata[rag.SpiceDBObjectKey] = obj
+		}
+	}
+	return doc, nil
+}
+
+// excluded reports whether p, or a directory containing it, matches an
+// exclude pattern.
+func (c *ingestConfig) excluded(p string) bool {
+	for {
+		if matchAny(c.exclude, p) {
+			return true
+		}
+		dir := path.Dir(p)
+		if dir == "." || dir == "/" || dir == p {
+			return false
+		}
+		p = dir
+	}
+}
+
+// matchAny reports whether rel matches one of patterns.
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(p, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where
+// "**" matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
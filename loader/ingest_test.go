@@ -0,0 +1,208 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// memorySource is a Source over in-memory files, in the given order.
+type memorySource struct {
+	paths []string
+	files map[string]string
+	err   error
+}
+
+func (s memorySource) Files(context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		for _, p := range s.paths {
+			f := loader.File{
+				Path:     p,
+				Location: "mem://" + p,
+				Metadata: map[string]string{"origin": "memory"},
+				Open: func(context.Context) (io.ReadCloser, error) {
+					return io.NopCloser(strings.NewReader(s.files[p])), nil
+				},
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+		if s.err != nil {
+			yield(loader.File{}, s.err)
+		}
+	}
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	src := memorySource{
+		paths: []string{"teams/eng/runbook.md", "teams/eng/tmp/scratch.md", "teams/hr/policy.txt", "readme.md", "image.png"},
+		files: map[string]string{
+			"teams/eng/runbook.md":     "# Runbook",
+			"teams/eng/tmp/scratch.md": "scratch",
+			"teams/hr/policy.txt":      "Leave policy.",
+			"readme.md":                "Read me.",
+		},
+	}
+	dst := &recordingIngester{}
+	res, err := loader.Ingest(context.Background(), src, dst,
+		loader.WithExclude("tmp"),
+		loader.WithObjectFunc(loader.ObjectFromPath(`^teams/(?P<team>[^/]+)/`, "folder:$team")))
+	require.NoError(t, err)
+	require.Equal(t, []string{"teams/eng/runbook", "teams/hr/policy", "readme"}, ids(res.Documents))
+	require.Equal(t, []string{"image.png"}, res.Skipped)
+
+	runbook := res.Documents[0]
+	require.Equal(t, "folder:eng", runbook.Metadata[rag.SpiceDBObjectKey])
+	require.Equal(t, "memory", runbook.Metadata["origin"])
+	require.Equal(t, "mem://teams/eng/runbook.md", runbook.Metadata[loader.SourceKey])
+	require.Equal(t, "Runbook", runbook.Metadata[loader.TitleKey])
+	require.Equal(t, "folder:hr", res.Documents[1].Metadata[rag.SpiceDBObjectKey])
+	require.NotContains(t, res.Documents[2].Metadata, rag.SpiceDBObjectKey)
+}
+
+func TestIngestSourceError(t *testing.T) {
+	t.Parallel()
+
+	boom := errors.New("listing failed")
+	src := memorySource{paths: []string{"a.txt"}, files: map[string]string{"a.txt": "alpha"}, err: boom}
+	res, err := loader.Ingest(context.Background(), src, &recordingIngester{})
+	require.ErrorIs(t, err, boom)
+	require.Equal(t, []string{"a"}, ids(res.Documents), "files before the error are ingested")
+}
+
+func TestObjectFromPath(t *testing.T) {
+	t.Parallel()
+
+	fn := loader.ObjectFromPath(`^(?P<type>[a-z]+)/(?P<id>[^/]+)/`, "${type}:${id}")
+	obj, err := fn("project/apollo/plan.md", rag.Document{})
+	require.NoError(t, err)
+	require.Equal(t, "project:apollo", obj)
+
+	obj, err = fn("plan.md", rag.Document{})
+	require.NoError(t, err)
+	require.Empty(t, obj)
+}
+
+func TestEscapeID(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "557058=3aab-12_C", loader.EscapeID("557058:ab-12_C"))
+	require.Equal(t, "a=3db", loader.EscapeID("a=b"))
+	require.NotEqual(t, loader.EscapeID("a.b"), loader.EscapeID("a_b"), "distinct identities stay distinct")
+}
+
+func TestIngestDirIntoStore(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	store := &memoryStore{}
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", nil)
+	res, err := loader.IngestDir(context.Background(), dir, loader.IntoStore(pipeline, store), loader.WithObjectType("document"))
+	require.NoError(t, err)
+	require.Nil(t, res.Token, "no relationships were written")
+	require.Equal(t, []string{"a", "b"}, ids(store.docs))
+}
+
+type memoryStore struct{ docs []rag.Document }
+
+func (s *memoryStore) Retrieve(context.Context, string, int) ([]rag.Document, error) {
+	return s.docs, nil
+}
+
+func (s *memoryStore) Add(_ context.Context, docs ...rag.Document) error {
+	s.docs = append(s.docs, docs...)
+	return nil
+}
+
+func (s *memoryStore) Remove(context.Context, ...string) error { return nil }
+
+// syncingIngester is a recordingIngester that also sets access and
+// updates documents, logging the calls in order.
+type syncingIngester struct {
+	calls []string
+	held  map[string]bool
+}
+
+func (s *syncingIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	if s.held[doc.ID] {
+		return nil, rag.ErrDuplicateDocument
+	}
+	s.held[doc.ID] = true
+	s.calls = append(s.calls, "add "+doc.ID)
+	return nil, nil
+}
+
+func (s *syncingIngester) UpdateDocument(doc rag.Document) error {
+	s.calls = append(s.calls, "update "+doc.ID)
+	return nil
+}
+
+func (s *syncingIngester) SetAccess(_ context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	var subjects []string
+	for _, e := range entries {
+		subjects = append(subjects, e.Relation+"@"+e.Subject)
+	}
+	s.calls = append(s.calls, fmt.Sprintf("access %s %v %v", object, relations, subjects))
+	return &apiv1.ZedToken{Token: "access-" + object}, nil
+}
+
+func TestIngestAccessAndUpdates(t *testing.T) {
+	t.Parallel()
+
+	src := sharedSource{}
+	dst := &syncingIngester{held: make(map[string]bool)}
+	for range 2 {
+		res, err := loader.Ingest(context.Background(), src, dst)
+		require.NoError(t, err)
+		require.Equal(t, "access-document:f1", res.Token.GetToken())
+		require.Equal(t, "f1", res.Documents[0].ID, "the file's own ID")
+		require.Equal(t, "Plan text", res.Documents[0].Text, "the file's own loader")
+	}
+	require.Equal(t, []string{
+		"access document:f1 [owner viewer] [owner@user:emilia viewer@group:eng#member]",
+		"add f1",
+		"access document:f1 [owner viewer] [owner@user:emilia viewer@group:eng#member]",
+		"update f1",
+	}, dst.calls, "access is set before the document is added, and documents are replaced when ingested again")
+
+	_, err := loader.Ingest(context.Background(), src, &recordingIngester{})
+	require.ErrorContains(t, err, "cannot set access")
+}
+
+// sharedSource lists one extensionless file with sharing settings.
+type sharedSource struct{}
+
+func (sharedSource) Files(context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		yield(loader.File{
+			Path:     "Team/Plan",
+			Location: "drive://f1",
+			ID:       "f1",
+			Metadata: map[string]string{rag.SpiceDBObjectKey: "document:f1"},
+			Loader:   loader.Text{},
+			Open: func(context.Context) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("Plan text")), nil
+			},
+			Access: &loader.Access{
+				Relations: []string{"owner", "viewer"},
+				Entries: []rag.ACLEntry{
+					{Relation: "owner", Subject: "user:emilia"},
+					{Relation: "viewer", Subject: "group:eng#member"},
+				},
+			},
+		}, nil)
+	}
+}
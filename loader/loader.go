@@ -0,0 +1,191 @@
+// Package loader parses Markdown, HTML, PDF and plain text files into
+// rag.Documents, so a corpus can be ingested without bespoke extraction
+// code:
+//
+//	doc, err := loader.LoadFile(ctx, "docs/handbook.pdf")
+//	doc.ID = "handbook"
+//	doc.Metadata[rag.SpiceDBObjectKey] = "document:handbook"
+//	err = pipeline.AddDocuments(ctx, doc)
+//
+// Loaders extract the text, a title and whatever metadata the format
+// carries. The document's ID and SpiceDB mapping are left to the caller;
+// a pipeline configured WithChunker chunks the documents as they are
+// added, and the chunks inherit the metadata.
+//
+// Ingest does the same for every file of a Source, deriving IDs and
+// SpiceDB objects from the files' paths: IngestDir for a directory tree,
+// and packages s3 and gcs for the objects in a bucket.
+package loader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// Metadata keys set by the loaders.
+const (
+	// TitleKey holds the document's title, when the format has one.
+	TitleKey = "title"
+	// FormatKey holds the name of the loader's format, e.g. "markdown".
+	FormatKey = "format"
+	// SourceKey holds the path LoadFile read the document from, or the
+	// Location of the File Ingest loaded it from.
+	SourceKey = "source"
+
+	// BucketKey, ObjectNameKey and ETagKey hold the bucket, key and ETag
+	// of documents ingested from an object store.
+	BucketKey     = "bucket"
+	ObjectNameKey = "key"
+	ETagKey       = "etag"
+)
+
+// ErrUnsupportedFormat is returned by LoadFile for files no loader
+// handles.
+var ErrUnsupportedFormat = errors.New("loader: unsupported format")
+
+// Loader parses a file's content into a Document with its Text and
+// Metadata set.
+type Loader interface {
+	Load(ctx context.Context, r io.Reader) (rag.Document, error)
+}
+
+// LoaderFunc adapts a plain function to a Loader.
+type LoaderFunc func(ctx context.Context, r io.Reader) (rag.Document, error)
+
+// Load calls f(ctx, r).
+func (f LoaderFunc) Load(ctx context.Context, r io.Reader) (rag.Document, error) {
+	return f(ctx, r)
+}
+
+// loaders maps file extensions to the loader of their format.
+var loaders = map[string]Loader{
+	".md":       Markdown{},
+	".markdown": Markdown{},
+	".html":     HTML{},
+	".htm":      HTML{},
+	".pdf":      PDF{},
+	".txt":      Text{},
+}
+
+// ForExtension returns the loader for files with extension ext, such as
+// ".md", compared case-insensitively.
+func ForExtension(ext string) (Loader, bool) {
+	l, ok := loaders[strings.ToLower(ext)]
+	return l, ok
+}
+
+// Extensions lists the extensions ForExtension knows, e.g. for filtering
+// a directory walk.
+func Extensions() []string {
+	exts := make([]string, 0, len(loaders))
+	for ext := range loaders {
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// LoadFile loads the file at path with the loader for its extension and
+// records path under SourceKey. The document's ID is left empty.
+func LoadFile(ctx context.Context, path string) (rag.Document, error) {
+	l, ok := ForExtension(filepath.Ext(path))
+	if !ok {
+		return rag.Document{}, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	defer f.Close()
+
+	doc, err := l.Load(ctx, f)
+	if err != nil {
+		return rag.Document{}, fmt.Errorf("loader: %s: %w", path, err)
+	}
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]string)
+	}
+	doc.Metadata[SourceKey] = path
+	return doc, nil
+}
+
+// Text loads plain text as is. Invalid UTF-8 is replaced.
+type Text struct{}
+
+// Load implements Loader.
+func (Text) Load(ctx context.Context, r io.Reader) (rag.Document, error) {
+	b, err := readAll(ctx, r)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	return rag.Document{
+		Text:     strings.ToValidUTF8(string(b), string(utf8.RuneError)),
+		Metadata: map[string]string{FormatKey: "text"},
+	}, nil
+}
+
+// reserved are the metadata keys a file's content may not set: they
+// decide what the document is authorized against, or are set by the
+// loaders and chunkers themselves.
+var reserved = map[string]bool{
+	rag.SpiceDBObjectKey: true,
+	rag.ParentObjectKey:  true,
+	rag.ParentIDKey:      true,
+	rag.ChunkIndexKey:    true,
+	FormatKey:            true,
+	SourceKey:            true,
+	BucketKey:            true,
+	ObjectNameKey:        true,
+	ETagKey:              true,
+}
+
+// setMetadata sets md[key] to value taken from a file's content, unless
+// key is reserved or value empty.
+func setMetadata(md map[string]string, key, value string) {
+	if key != "" && value != "" && !reserved[key] {
+		md[key] = value
+	}
+}
+
+// normalize tidies extracted text: runs of spaces within a line become
+// one, lines are trimmed and there is at most one blank line between
+// paragraphs.
+func normalize(text string) string {
+	var b strings.Builder
+	blank := false
+	for line := range strings.Lines(text) {
+		line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " ")
+		if line == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+			if blank {
+				b.WriteByte('\n')
+			}
+		}
+		blank = false
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// readAll reads r, failing once ctx is done.
+func readAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
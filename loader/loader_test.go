@@ -0,0 +1,86 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+func TestLoadFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.MD")
+	require.NoError(t, os.WriteFile(path, []byte("# Notes\n\nSome *text*."), 0o600))
+
+	doc, err := loader.LoadFile(context.Background(), path)
+	require.NoError(t, err)
+	require.Empty(t, doc.ID)
+	require.Equal(t, "Notes\n\nSome text.", doc.Text)
+	require.Equal(t, map[string]string{
+		loader.TitleKey:  "Notes",
+		loader.FormatKey: "markdown",
+		loader.SourceKey: path,
+	}, doc.Metadata)
+
+	_, err = loader.LoadFile(context.Background(), filepath.Join(dir, "image.png"))
+	require.ErrorIs(t, err, loader.ErrUnsupportedFormat)
+
+	_, err = loader.LoadFile(context.Background(), filepath.Join(dir, "missing.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestForExtension(t *testing.T) {
+	t.Parallel()
+
+	for _, ext := range []string{".md", ".markdown", ".html", ".HTM", ".pdf", ".txt"} {
+		_, ok := loader.ForExtension(ext)
+		require.True(t, ok, ext)
+	}
+	_, ok := loader.ForExtension(".docx")
+	require.False(t, ok)
+
+	exts := loader.Extensions()
+	slices.Sort(exts)
+	require.Equal(t, []string{".htm", ".html", ".markdown", ".md", ".pdf", ".txt"}, exts)
+}
+
+func TestText(t *testing.T) {
+	t.Parallel()
+
+	doc, err := loader.Text{}.Load(context.Background(), strings.NewReader("plain \xff text"))
+	require.NoError(t, err)
+	require.Equal(t, "plain � text", doc.Text)
+	require.Equal(t, "text", doc.Metadata[loader.FormatKey])
+}
+
+func TestLoaderFunc(t *testing.T) {
+	t.Parallel()
+
+	var l loader.Loader = loader.LoaderFunc(func(context.Context, io.Reader) (rag.Document, error) {
+		return rag.Document{}, errors.New("boom")
+	})
+	_, err := l.Load(context.Background(), strings.NewReader(""))
+	require.EqualError(t, err, "boom")
+}
+
+func TestLoadCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, l := range []loader.Loader{loader.Text{}, loader.Markdown{}, loader.HTML{}, loader.PDF{}} {
+		_, err := l.Load(ctx, strings.NewReader("text"))
+		require.ErrorIs(t, err, context.Canceled)
+	}
+}
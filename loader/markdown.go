@@ -0,0 +1,163 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// Markdown loads Markdown, stripping the markup but keeping the text of
+// headings, links, images' alt text and code. YAML front matter between
+// "---" lines becomes metadata; its "title", or else the first heading,
+// becomes TitleKey.
+type Markdown struct{}
+
+var (
+	mdImage     = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink      = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdRefLink   = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	mdLinkDef   = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s`)
+	mdAutolink  = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	mdTag       = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdEmphasis  = regexp.MustCompile(`(\*\*|\*|~~)([^\s*~](?:.*?[^\s*~])?)(?:\*\*|\*|~~)`)
+	mdUnderline = regexp.MustCompile(`(^|\W)(?:__|_)([^\s_](?:.*?[^\s_])?)(?:__|_)($|\W)`)
+	mdCode      = regexp.MustCompile("`+([^`]+)`+")
+	mdHeading   = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdSetext    = regexp.MustCompile(`^\s{0,3}(=+|-+)\s*$`)
+	mdListItem  = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(?:\[[ xX]\]\s+)?`)
+	mdQuote     = regexp.MustCompile(`^\s{0,3}(?:>\s?)+`)
+	mdRule      = regexp.MustCompile(`^\s{0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	mdFence     = regexp.MustCompile("^\\s{0,3}(```+|~~~+)")
+	mdTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// Load implements Loader.
+func (Markdown) Load(ctx context.Context, r io.Reader) (rag.Document, error) {
+	b, err := readAll(ctx, r)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	src := strings.ReplaceAll(string(b), "\r\n", "\n")
+	md := map[string]string{FormatKey: "markdown"}
+
+	src, err = frontMatter(src, md)
+	if err != nil {
+		return rag.Document{}, err
+	}
+
+	var out []string
+	var fence string
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+				continue
+			}
+			out = append(out, line)
+			continue
+		}
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			continue
+		}
+		// A setext underline makes the line before it a heading.
+		if mdSetext.MatchString(line) && i > 0 && strings.TrimSpace(lines[i-1]) != "" && len(out) > 0 {
+			if md[TitleKey] == "" {
+				md[TitleKey] = out[len(out)-1]
+			}
+			out = append(out, "")
+			continue
+		}
+		if strings.Contains(line, "|") && mdTableRule.MatchString(line) {
+			continue
+		}
+		if mdRule.MatchString(line) || mdLinkDef.MatchString(line) {
+			out = append(out, "")
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			text := inlineMarkdown(m[2])
+			if md[TitleKey] == "" {
+				md[TitleKey] = text
+			}
+			out = append(out, "", text, "")
+			continue
+		}
+		line = mdQuote.ReplaceAllString(line, "")
+		line = mdListItem.ReplaceAllString(line, "")
+		if strings.HasPrefix(strings.TrimSpace(line), "|") {
+			line = strings.ReplaceAll(strings.Trim(strings.TrimSpace(line), "|"), "|", " ")
+		}
+		out = append(out, inlineMarkdown(line))
+	}
+	return rag.Document{Text: normalize(strings.Join(out, "\n")), Metadata: md}, nil
+}
+
+// inlineMarkdown strips inline markup from a line.
+func inlineMarkdown(s string) string {
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdRefLink.ReplaceAllString(s, "$1")
+	s = mdAutolink.ReplaceAllString(s, "$1")
+	s = mdCode.ReplaceAllString(s, "$1")
+	s = mdTag.ReplaceAllString(s, "")
+	for {
+		stripped := mdEmphasis.ReplaceAllString(s, "$2")
+		stripped = mdUnderline.ReplaceAllString(stripped, "$1$2$3")
+		if stripped == s {
+			break
+		}
+		s = stripped
+	}
+	return strings.TrimSpace(s)
+}
+
+// frontMatter moves the scalar values of src's YAML front matter, if
+// any, into md and returns src without it. Reserved keys, such as
+// rag.SpiceDBObjectKey, are ignored: a file does not get to choose what it
+// is authorized against.
+func frontMatter(src string, md map[string]string) (string, error) {
+	if !strings.HasPrefix(src, "---\n") {
+		return src, nil
+	}
+	end := strings.Index(src[4:], "\n---")
+	if end < 0 {
+		return src, nil
+	}
+	block, rest := src[4:4+end], src[4+end+4:]
+	rest = strings.TrimPrefix(strings.TrimLeft(rest, "-"), "\n")
+
+	var values map[string]any
+	if err := yaml.Unmarshal([]byte(block), &values); err != nil {
+		return "", fmt.Errorf("front matter: %w", err)
+	}
+	for k, v := range values {
+		switch v := v.(type) {
+		case string:
+			setMetadata(md, k, v)
+		case int, float64, bool:
+			setMetadata(md, k, fmt.Sprint(v))
+		case time.Time:
+			if v.Equal(v.Truncate(24 * time.Hour)) {
+				setMetadata(md, k, v.Format(time.DateOnly))
+			} else {
+				setMetadata(md, k, v.Format(time.RFC3339))
+			}
+		case []any:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			setMetadata(md, k, strings.Join(items, ","))
+		}
+	}
+	return rest, nil
+}
@@ -0,0 +1,74 @@
+package loader_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+func TestMarkdown(t *testing.T) {
+	t.Parallel()
+
+	src := "---\n" +
+		"title: Launch Plan\n" +
+		"author: emilia\n" +
+		"date: 2024-03-01\n" +
+		"tags: [launch, q3]\n" +
+		"spicedb_object: document:secret\n" +
+		"format: pdf\n" +
+		"---\n" +
+		"# Overview\n\n" +
+		"The **launch** is _planned_ for [Q3](https://example.com/q3).\n\n" +
+		"- first item\n" +
+		"- [x] done item\n\n" +
+		"> quoted `code`\n\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\n\n" +
+		"***\n\n" +
+		"snake_case_name stays ![diagram](d.png)\n"
+
+	doc, err := loader.Markdown{}.Load(context.Background(), strings.NewReader(src))
+	require.NoError(t, err)
+	require.Equal(t, "Overview\n\n"+
+		"The launch is planned for Q3.\n\n"+
+		"first item\n"+
+		"done item\n\n"+
+		"quoted code\n\n"+
+		"fmt.Println(\"hi\")\n\n"+
+		"a b\n"+
+		"1 2\n\n"+
+		"snake_case_name stays diagram", doc.Text)
+	require.Equal(t, map[string]string{
+		loader.TitleKey:  "Launch Plan",
+		loader.FormatKey: "markdown",
+		"author":         "emilia",
+		"date":           "2024-03-01",
+		"tags":           "launch,q3",
+	}, doc.Metadata, "reserved keys are not taken from front matter")
+	require.NotContains(t, doc.Metadata, rag.SpiceDBObjectKey)
+}
+
+func TestMarkdownTitle(t *testing.T) {
+	t.Parallel()
+
+	doc, err := loader.Markdown{}.Load(context.Background(), strings.NewReader("Intro text\n\nSetext Title\n============\n\n## Later\n"))
+	require.NoError(t, err)
+	require.Equal(t, "Setext Title", doc.Metadata[loader.TitleKey])
+	require.Equal(t, "Intro text\n\nSetext Title\n\nLater", doc.Text)
+
+	doc, err = loader.Markdown{}.Load(context.Background(), strings.NewReader("no headings here"))
+	require.NoError(t, err)
+	require.NotContains(t, doc.Metadata, loader.TitleKey)
+}
+
+func TestMarkdownBadFrontMatter(t *testing.T) {
+	t.Parallel()
+
+	_, err := loader.Markdown{}.Load(context.Background(), strings.NewReader("---\ntitle: [unclosed\n---\nbody"))
+	require.ErrorContains(t, err, "front matter")
+}
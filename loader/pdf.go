@@ -0,0 +1,875 @@
+package loader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// ErrEncryptedPDF is returned for PDFs that need a password to read.
+var ErrEncryptedPDF = errors.New("loader: PDF is encrypted")
+
+// PDF loads the text of a PDF's pages in page order, with a blank line
+// between pages. The Info dictionary's Title becomes TitleKey, and its
+// Author, Subject and Keywords become "author", "subject" and "keywords";
+// "pages" holds the number of pages.
+//
+// Text is decoded with the fonts' ToUnicode maps where they have one and
+// as WinAnsi otherwise, which covers what common tools produce. Text
+// drawn as images, such as in scanned documents, is not recognized.
+// Streams must be uncompressed or Flate-compressed.
+type PDF struct{}
+
+// Load implements Loader.
+func (PDF) Load(ctx context.Context, r io.Reader) (rag.Document, error) {
+	b, err := readAll(ctx, r)
+	if err != nil {
+		return rag.Document{}, err
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(b, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return rag.Document{}, errors.New("not a PDF file")
+	}
+	f := parsePDF(b)
+	if f.trailer["Encrypt"] != nil {
+		return rag.Document{}, ErrEncryptedPDF
+	}
+
+	md := map[string]string{FormatKey: "pdf"}
+	if info, ok := f.resolve(f.trailer["Info"]).(pdfDict); ok {
+		for key, name := range map[string]string{"Title": TitleKey, "Author": "author", "Subject": "subject", "Keywords": "keywords"} {
+			if s, ok := f.resolve(info[key]).(pdfString); ok {
+				setMetadata(md, name, strings.TrimSpace(textString(s)))
+			}
+		}
+	}
+
+	var pages []string
+	for _, page := range f.pages() {
+		if err := ctx.Err(); err != nil {
+			return rag.Document{}, err
+		}
+		pages = append(pages, f.pageText(page))
+	}
+	md["pages"] = strconv.Itoa(len(pages))
+	return rag.Document{Text: normalize(strings.Join(pages, "\n\n")), Metadata: md}, nil
+}
+
+// The PDF object types.
+type (
+	pdfDict   map[string]any
+	pdfName   string
+	pdfString []byte
+	pdfRef    struct{ num, gen int }
+)
+
+// pdfStream is a stream object: its dictionary and raw, undecoded data.
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+type pdfFile struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF reads every object of the file by scanning for their headers
+// rather than trusting the cross-reference table, so damaged or
+// incrementally updated files load too; later definitions win.
+func parsePDF(b []byte) *pdfFile {
+	f := &pdfFile{objects: make(map[int]any), trailer: make(pdfDict)}
+	var objStreams []pdfStream
+	for _, m := range pdfObjectHeader.FindAllSubmatchIndex(b, -1) {
+		num, _ := strconv.Atoi(string(b[m[2]:m[3]]))
+		l := &pdfLexer{b: b, pos: m[1]}
+		v, err := l.value()
+		if err != nil {
+			continue
+		}
+		if d, ok := v.(pdfDict); ok && l.keyword("stream") {
+			v = pdfStream{dict: d, data: l.streamData(d)}
+		}
+		f.objects[num] = v
+		if s, ok := v.(pdfStream); ok {
+			switch s.dict["Type"] {
+			case pdfName("ObjStm"):
+				objStreams = append(objStreams, s)
+			case pdfName("XRef"):
+				f.mergeTrailer(s.dict)
+			}
+		}
+	}
+	for i := 0; ; {
+		j := bytes.Index(b[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		i += j + len("trailer")
+		l := &pdfLexer{b: b, pos: i}
+		if d, err := l.value(); err == nil {
+			if d, ok := d.(pdfDict); ok {
+				f.mergeTrailer(d)
+			}
+		}
+	}
+	// Objects compressed into object streams, unless defined directly.
+	for _, s := range objStreams {
+		data, err := f.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := f.resolve(s.dict["N"]).(float64)
+		first, _ := f.resolve(s.dict["First"]).(float64)
+		header := &pdfLexer{b: data}
+		for range int(n) {
+			v1, err1 := header.value()
+			v2, err2 := header.value()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			num, _ := v1.(float64)
+			off, _ := v2.(float64)
+			pos := int(first + off)
+			if _, ok := f.objects[int(num)]; ok || pos < 0 || pos >= len(data) {
+				continue
+			}
+			l := &pdfLexer{b: data, pos: pos}
+			if v, err := l.value(); err == nil {
+				f.objects[int(num)] = v
+			}
+		}
+	}
+	return f
+}
+
+func (f *pdfFile) mergeTrailer(d pdfDict) {
+	for _, key := range []string{"Root", "Info", "Encrypt"} {
+		if v, ok := d[key]; ok {
+			f.trailer[key] = v
+		}
+	}
+}
+
+// resolve follows references, returning nil for missing objects.
+func (f *pdfFile) resolve(v any) any {
+	for range 32 {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves v to a dictionary, taking a stream's dictionary.
+func (f *pdfFile) dict(v any) pdfDict {
+	switch v := f.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decode returns the decoded data of s.
+func (f *pdfFile) decode(s pdfStream) ([]byte, error) {
+	var filters []any
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{v}
+	case []any:
+		filters = v
+	}
+	data := s.data
+	for _, filter := range filters {
+		switch f.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Truncated streams are common; keep what decompressed.
+			out, err := io.ReadAll(zr)
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			data = out
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = hexDecode(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+	}
+	return data, nil
+}
+
+// pages returns the page dictionaries in order, with inherited resources
+// filled in.
+func (f *pdfFile) pages() []pdfDict {
+	root := f.dict(f.trailer["Root"])
+	var out []pdfDict
+	seen := make(map[any]bool)
+	var walk func(node any, resources any)
+	walk = func(node any, resources any) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		d := f.dict(node)
+		if d == nil {
+			return
+		}
+		if r, ok := d["Resources"]; ok {
+			resources = r
+		}
+		if kids, ok := f.resolve(d["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				walk(kid, resources)
+			}
+			return
+		}
+		page := maps.Clone(d)
+		page["Resources"] = resources
+		out = append(out, page)
+	}
+	if root != nil {
+		walk(root["Pages"], nil)
+	}
+	if len(out) > 0 {
+		return out
+	}
+
+	// Without a usable page tree, take every content stream in object
+	// order.
+	nums := make([]int, 0, len(f.objects))
+	for num, v := range f.objects {
+		if s, ok := v.(pdfStream); ok && s.dict["Type"] == nil && s.dict["Subtype"] == nil {
+			nums = append(nums, num)
+		}
+	}
+	slices.Sort(nums)
+	for _, num := range nums {
+		out = append(out, pdfDict{"Contents": pdfRef{num: num}})
+	}
+	return out
+}
+
+// pageText extracts the text of page's content streams.
+func (f *pdfFile) pageText(page pdfDict) string {
+	var contents []any
+	switch v := f.resolve(page["Contents"]).(type) {
+	case []any:
+		contents = v
+	default:
+		contents = []any{page["Contents"]}
+	}
+	var data []byte
+	for _, c := range contents {
+		s, ok := f.resolve(c).(pdfStream)
+		if !ok {
+			continue
+		}
+		d, err := f.decode(s)
+		if err != nil {
+			continue
+		}
+		data = append(append(data, d...), '\n')
+	}
+
+	fonts := make(map[string]*pdfFont)
+	if res := f.dict(page["Resources"]); res != nil {
+		for name, ref := range f.dict(res["Font"]) {
+			fonts[name] = f.font(ref)
+		}
+	}
+	return showText(data, fonts)
+}
+
+// pdfFont decodes the strings shown with a font.
+type pdfFont struct {
+	toUnicode map[string]string // by character code
+	codeLen   int               // bytes per character code
+	composite bool              // Type0 font without a ToUnicode map
+}
+
+func (f *pdfFile) font(ref any) *pdfFont {
+	d := f.dict(ref)
+	font := &pdfFont{codeLen: 1}
+	if d == nil {
+		return font
+	}
+	if d["Subtype"] == pdfName("Type0") {
+		font.codeLen = 2
+		font.composite = true
+	}
+	if s, ok := f.resolve(d["ToUnicode"]).(pdfStream); ok {
+		if data, err := f.decode(s); err == nil {
+			font.toUnicode, font.codeLen = parseCMap(data, font.codeLen)
+			font.composite = false
+		}
+	}
+	return font
+}
+
+func (font *pdfFont) decode(s []byte) string {
+	if font == nil {
+		font = &pdfFont{codeLen: 1}
+	}
+	if font.composite {
+		// Without a ToUnicode map the glyph IDs mean nothing.
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := min(font.codeLen, len(s)-i)
+		code := s[i : i+n]
+		i += n
+		if font.toUnicode != nil {
+			if u, ok := font.toUnicode[string(code)]; ok {
+				b.WriteString(u)
+				continue
+			}
+			if n > 1 {
+				continue
+			}
+		}
+		for _, c := range code {
+			b.WriteRune(winAnsi(c))
+		}
+	}
+	return b.String()
+}
+
+var (
+	cmapBFChar  = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	cmapBFRange = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	cmapSpace   = regexp.MustCompile(`(?s)begincodespacerange\s*<([0-9A-Fa-f]+)>`)
+	cmapHex     = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>|\[|\]`)
+)
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap,
+// and the length of its character codes.
+func parseCMap(data []byte, codeLen int) (map[string]string, int) {
+	if m := cmapSpace.FindSubmatch(data); m != nil {
+		codeLen = max(len(bytes.TrimSpace(m[1]))/2, 1)
+	}
+	out := make(map[string]string)
+	for _, block := range cmapBFChar.FindAllSubmatch(data, -1) {
+		hexes := cmapHex.FindAllSubmatch(block[1], -1)
+		for i := 0; i+1 < len(hexes); i += 2 {
+			out[string(hexDecode(hexes[i][1]))] = utf16String(hexDecode(hexes[i+1][1]))
+		}
+	}
+	for _, block := range cmapBFRange.FindAllSubmatch(data, -1) {
+		tokens := cmapHex.FindAllSubmatch(block[1], -1)
+		for i := 0; i+2 < len(tokens); {
+			lo, hi := hexDecode(tokens[i][1]), hexDecode(tokens[i+1][1])
+			i += 2
+			if string(tokens[i][0]) == "[" {
+				// <lo> <hi> [<u1> <u2> ...]
+				code := slices.Clone(lo)
+				for i++; i < len(tokens) && string(tokens[i][0]) != "]"; i++ {
+					out[string(code)] = utf16String(hexDecode(tokens[i][1]))
+					increment(code)
+				}
+				i++
+				continue
+			}
+			dst := hexDecode(tokens[i][1])
+			i++
+			if len(lo) != len(hi) || len(dst) == 0 {
+				continue
+			}
+			for code, n := slices.Clone(lo), 0; bytes.Compare(code, hi) <= 0 && n < 1<<16; n++ {
+				out[string(code)] = utf16String(dst)
+				dst = slices.Clone(dst)
+				increment(dst)
+				if !increment(code) {
+					break
+				}
+			}
+		}
+	}
+	return out, codeLen
+}
+
+// increment adds one to the big-endian number b, reporting false on
+// overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func utf16String(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// textString decodes a PDF text string, such as an Info entry: UTF-16
+// with a byte order mark, or PDFDocEncoding otherwise.
+func textString(s pdfString) string {
+	if bytes.HasPrefix(s, []byte{0xfe, 0xff}) {
+		return utf16String(s[2:])
+	}
+	if bytes.HasPrefix(s, []byte{0xef, 0xbb, 0xbf}) {
+		return string(s[3:])
+	}
+	var b strings.Builder
+	for _, c := range s {
+		b.WriteRune(winAnsi(c))
+	}
+	return b.String()
+}
+
+// winAnsiHigh maps the WinAnsi codes 0x80-0x9f that differ from Latin-1.
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘',
+	0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜',
+	0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+func winAnsi(c byte) rune {
+	if r, ok := winAnsiHigh[c]; ok {
+		return r
+	}
+	return rune(c)
+}
+
+// showText interprets the text operators of a content stream.
+func showText(data []byte, fonts map[string]*pdfFont) string {
+	var b strings.Builder
+	var operands []any
+	var font *pdfFont
+	var lastY float64
+	number := func(i int) float64 {
+		if i < len(operands) {
+			n, _ := operands[i].(float64)
+			return n
+		}
+		return 0
+	}
+	show := func(v any) {
+		switch v := v.(type) {
+		case pdfString:
+			b.WriteString(font.decode(v))
+		case []any:
+			for _, item := range v {
+				switch item := item.(type) {
+				case pdfString:
+					b.WriteString(font.decode(item))
+				case float64:
+					// A large negative adjustment separates words.
+					if item < -200 {
+						b.WriteByte(' ')
+					}
+				}
+			}
+		}
+	}
+
+	l := &pdfLexer{b: data}
+	for {
+		tok, err := l.token()
+		if err != nil {
+			break
+		}
+		op, ok := tok.(pdfKeyword)
+		if !ok {
+			if v, err := l.complete(tok); err == nil {
+				operands = append(operands, v)
+			}
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) > 0 {
+				name, _ := operands[0].(pdfName)
+				font = fonts[string(name)]
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", `"`:
+			b.WriteByte('\n')
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "T*", "ET":
+			b.WriteByte('\n')
+		case "Td", "TD":
+			if number(1) != 0 {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(' ')
+			}
+		case "Tm":
+			if y := number(5); y != lastY {
+				b.WriteByte('\n')
+				lastY = y
+			} else {
+				b.WriteByte(' ')
+			}
+		case "BI":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	return b.String()
+}
+
+// pdfKeyword is a bare word: an operator, or true, false, null, R and
+// the like.
+type pdfKeyword string
+
+// pdfDelim is one of the delimiters [ ] << >> { }.
+type pdfDelim string
+
+// pdfLexer reads PDF tokens and objects from b.
+type pdfLexer struct {
+	b   []byte
+	pos int
+}
+
+var errEOF = errors.New("unexpected end of data")
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads the next token: a float64, pdfName, pdfString, pdfKeyword
+// or pdfDelim.
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, errEOF
+	}
+	c := l.b[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '<':
+		l.pos += 2
+		return pdfDelim("<<"), nil
+	case c == '>' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '>':
+		l.pos += 2
+		return pdfDelim(">>"), nil
+	case c == '<':
+		end := bytes.IndexByte(l.b[l.pos:], '>')
+		if end < 0 {
+			return nil, errEOF
+		}
+		s := hexDecode(l.b[l.pos+1 : l.pos+end])
+		l.pos += end + 1
+		return pdfString(s), nil
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return pdfDelim(c), nil
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+			l.pos++
+		}
+		return pdfName(unescapeName(l.b[start:l.pos])), nil
+	case c == ')' || c == '>':
+		l.pos++
+		return pdfKeyword(c), nil
+	}
+	start := l.pos
+	for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	word := string(l.b[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// value reads a complete object.
+func (l *pdfLexer) value() (any, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.complete(tok)
+}
+
+// complete finishes the object tok starts: the rest of an array,
+// dictionary or reference.
+func (l *pdfLexer) complete(tok any) (any, error) {
+	switch tok := tok.(type) {
+	case pdfDelim:
+		switch tok {
+		case "[":
+			var arr []any
+			for {
+				t, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if t == pdfDelim("]") {
+					return arr, nil
+				}
+				v, err := l.complete(t)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+		case "<<":
+			d := make(pdfDict)
+			for {
+				t, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if t == pdfDelim(">>") {
+					return d, nil
+				}
+				key, ok := t.(pdfName)
+				if !ok {
+					return nil, fmt.Errorf("dictionary key %v", t)
+				}
+				v, err := l.value()
+				if err != nil {
+					return nil, err
+				}
+				d[string(key)] = v
+			}
+		}
+		return tok, nil
+	case float64:
+		// "num gen R" is a reference.
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(float64); ok {
+				if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{num: int(tok), gen: int(g)}, nil
+				}
+			}
+		}
+		l.pos = save
+		return tok, nil
+	case pdfKeyword:
+		switch tok {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return tok, nil
+}
+
+// keyword reports whether the next token is the keyword kw, consuming it
+// if so.
+func (l *pdfLexer) keyword(kw string) bool {
+	save := l.pos
+	if tok, err := l.token(); err == nil && tok == pdfKeyword(kw) {
+		return true
+	}
+	l.pos = save
+	return false
+}
+
+// streamData returns the data of the stream whose "stream" keyword was
+// just read, using its Length when it is right.
+func (l *pdfLexer) streamData(d pdfDict) []byte {
+	if l.pos < len(l.b) && l.b[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	if n, ok := d["Length"].(float64); ok {
+		end := start + int(n)
+		if end <= len(l.b) && bytes.HasPrefix(bytes.TrimLeft(l.b[end:], "\r\n "), []byte("endstream")) {
+			l.pos = end
+			return l.b[start:end]
+		}
+	}
+	end := bytes.Index(l.b[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.b)
+		return l.b[start:]
+	}
+	l.pos = start + end
+	return bytes.TrimRight(l.b[start:start+end], "\r\n")
+}
+
+// literalString reads a (string), handling nested parentheses and
+// escapes.
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				return out
+			}
+			e := l.b[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// skipInlineImage skips the data of an inline image, up to and including
+// its EI operator.
+func (l *pdfLexer) skipInlineImage() {
+	i := bytes.Index(l.b[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.b)
+		return
+	}
+	l.pos += i + 2
+	for l.pos < len(l.b) {
+		j := bytes.Index(l.b[l.pos:], []byte("EI"))
+		if j < 0 {
+			l.pos = len(l.b)
+			return
+		}
+		l.pos += j + 2
+		if isPDFSpace(l.b[l.pos-3]) && (l.pos == len(l.b) || isPDFSpace(l.b[l.pos])) {
+			return
+		}
+	}
+}
+
+func unescapeName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+// hexDecode decodes hex digits, ignoring white space and padding an odd
+// final digit with 0.
+func hexDecode(b []byte) []byte {
+	digits := make([]byte, 0, len(b)+1)
+	for _, c := range b {
+		if c == '>' {
+			break
+		}
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return nil
+	}
+	return out
+}
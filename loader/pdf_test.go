@@ -0,0 +1,138 @@
+package loader_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// buildPDF assembles a PDF from objects numbered from 1, with the given
+// trailer entries.
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return b.Bytes()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< /Length %d %s >>\nstream\n%s\nendstream", len(data), dict, data)
+}
+
+func flateStream(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+	return stream("/Filter /FlateDecode", b.String())
+}
+
+func loadPDF(t *testing.T, pdf []byte) (string, map[string]string) {
+	t.Helper()
+	doc, err := loader.PDF{}.Load(context.Background(), bytes.NewReader(pdf))
+	require.NoError(t, err)
+	return doc.Text, doc.Metadata
+}
+
+func TestPDF(t *testing.T) {
+	t.Parallel()
+
+	pdf := buildPDF("/Root 1 0 R /Info 7 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		flateStream("BT /F1 12 Tf 72 720 Td (Launch \\(Q3\\) plan) Tj T* [(Ker) 20 (ning) -300 (works)] TJ ET"),
+		"<< /Title (Launch Plan) /Author <FEFF0045006D0069006C00690061> /Producer (test) >>",
+		stream("", "BT /F1 12 Tf 72 720 Td (Page two \\222s caf\\351) Tj ET"),
+	)
+	text, md := loadPDF(t, pdf)
+	require.Equal(t, "Launch (Q3) plan\nKerning works\n\nPage two ’s café", text)
+	require.Equal(t, map[string]string{
+		loader.TitleKey:  "Launch Plan",
+		loader.FormatKey: "pdf",
+		"author":         "Emilia",
+		"pages":          "2",
+	}, md)
+}
+
+func TestPDFToUnicode(t *testing.T) {
+	t.Parallel()
+
+	cmap := "/CIDInit /ProcSet findresource begin\nbegincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"1 beginbfchar <0003> <0020> endbfchar\n" +
+		"2 beginbfrange <0010> <0012> <0061>\n<0020> <0021> [<00E9> <FB01>] endbfrange\n" +
+		"endcmap"
+	pdf := buildPDF("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F0 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Embedded /Encoding /Identity-H /ToUnicode 6 0 R >>",
+		stream("", "BT /F0 10 Tf <001000110012000300200021> Tj ET"),
+		stream("", cmap),
+	)
+	text, _ := loadPDF(t, pdf)
+	require.Equal(t, "abc éﬁ", text)
+}
+
+func TestPDFObjectStream(t *testing.T) {
+	t.Parallel()
+
+	// Objects 3 and 4 live in the object stream 5; the trailer is an
+	// XRef stream.
+	objs := "<< /Type /Page /Parent 2 0 R /Contents 6 0 R >> << /Title (Compressed) >>"
+	header := fmt.Sprintf("3 0 4 %d ", len("<< /Type /Page /Parent 2 0 R /Contents 6 0 R >> "))
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, _ = w.Write([]byte(header + objs))
+	_ = w.Close()
+
+	pdf := buildPDF("",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"null",
+		"null",
+		stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), b.String()),
+		stream("", "BT (from an object stream) Tj ET"),
+		stream("/Type /XRef /Root 1 0 R /Info 4 0 R", ""),
+	)
+	// Drop the direct placeholders so the compressed definitions apply.
+	pdf = bytes.Replace(pdf, []byte("3 0 obj\nnull\nendobj\n"), nil, 1)
+	pdf = bytes.Replace(pdf, []byte("4 0 obj\nnull\nendobj\n"), nil, 1)
+
+	text, md := loadPDF(t, pdf)
+	require.Equal(t, "from an object stream", text)
+	require.Equal(t, "Compressed", md[loader.TitleKey])
+}
+
+func TestPDFErrors(t *testing.T) {
+	t.Parallel()
+
+	encrypted := buildPDF("/Root 1 0 R /Encrypt 2 0 R",
+		"<< /Type /Catalog >>",
+		"<< /Filter /Standard /V 2 >>",
+	)
+	_, err := loader.PDF{}.Load(context.Background(), bytes.NewReader(encrypted))
+	require.ErrorIs(t, err, loader.ErrEncryptedPDF)
+
+	_, err = loader.PDF{}.Load(context.Background(), bytes.NewReader([]byte("<html></html>")))
+	require.ErrorContains(t, err, "not a PDF")
+}
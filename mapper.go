@@ -0,0 +1,160 @@
+package rag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"text/template"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// SpiceDBObjectKey is the metadata key holding a document's SpiceDB object,
+// written as "type:id" (e.g. "document:doc1").
+const SpiceDBObjectKey = "spicedb_object"
+
+var (
+	// ErrNoResourceMapping is returned by a ResourceMapper that has no
+	// SpiceDB object for a document.
+	ErrNoResourceMapping = errors.New("rag: document has no SpiceDB mapping")
+
+	// ErrInvalidSpiceDBObject is returned when a mapping is not of the
+	// form "type:id".
+	ErrInvalidSpiceDBObject = errors.New("rag: invalid SpiceDB object")
+)
+
+// ResourceMapper derives the SpiceDB object a document's permission is
+// checked against.
+//
+// Documents that fail to map are treated like documents with a malformed
+// spicedb_object: they are never returned and are counted in
+// Stats.Unmapped.
+type ResourceMapper interface {
+	Map(doc Document) (*apiv1.ObjectReference, error)
+}
+
+// MapperFunc adapts a plain function to a ResourceMapper, e.g. to look the
+// object up in another system of record.
+type MapperFunc func(doc Document) (*apiv1.ObjectReference, error)
+
+// Map calls f(doc).
+func (f MapperFunc) Map(doc Document) (*apiv1.ObjectReference, error) {
+	return f(doc)
+}
+
+// MetadataMapper reads the object from the document's spicedb_object
+// metadata. It is the pipeline's default mapper.
+type MetadataMapper struct{}
+
+// Map implements ResourceMapper.
+func (MetadataMapper) Map(doc Document) (*apiv1.ObjectReference, error) {
+	obj := doc.Metadata[SpiceDBObjectKey]
+	if obj == "" {
+		return nil, fmt.Errorf("%w: %q", ErrNoResourceMapping, doc.ID)
+	}
+	return ParseObjectReference(obj)
+}
+
+// TemplateMapper renders a text/template against the Document to obtain the
+// object, e.g. "document:{{.ID}}" or "{{.Metadata.kind}}:{{.ID}}".
+type TemplateMapper struct {
+	tmpl *template.Template
+}
+
+// NewTemplateMapper parses text into a TemplateMapper.
+func NewTemplateMapper(text string) (*TemplateMapper, error) {
+	tmpl, err := template.New("resource").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("rag: parsing resource template: %w", err)
+	}
+	return &TemplateMapper{tmpl: tmpl}, nil
+}
+
+// Map implements ResourceMapper.
+func (m *TemplateMapper) Map(doc Document) (*apiv1.ObjectReference, error) {
+	var buf bytes.Buffer
+	if err := m.tmpl.Execute(&buf, doc); err != nil {
+		return nil, fmt.Errorf("rag: rendering resource for %q: %w", doc.ID, err)
+	}
+	return ParseObjectReference(buf.String())
+}
+
+// WithResourceMapper sets how documents are mapped to SpiceDB objects.
+//
+// An explicit spicedb_object in a document's metadata always takes
+// precedence; m is only consulted for documents that do not carry one. This
+// keeps per-document overrides working when a blanket template is
+// configured.
+func WithResourceMapper(m ResourceMapper) Option {
+	return func(r *RAGPipeline) {
+		r.mapper = m
+	}
+}
+
+// WithTypePermissions sets the permission checked on objects of the
+// given types, for corpora mixing several of them: documents map to
+// objects of any type through their spicedb_object metadata ("ticket:42",
+// "wiki_page:onboarding") or a ResourceMapper, and each is checked for
+// its type's permission, e.g.
+//
+//	rag.WithTypePermissions(map[string]string{"wiki_page": "view", "ticket": "read_ticket"})
+//
+// Types not in perms are checked for the pipeline's permission. Bulk
+// checks make one round trip per permission. Under FilterPrefilter with
+// a FilteringRetriever the accessible objects of every type in perms are
+// looked up along with the pipeline's resource type. Under
+// WithTenantPrefixes the types are given without the tenant prefix.
+func WithTypePermissions(perms map[string]string) Option {
+	return func(r *RAGPipeline) {
+		r.typePerms = maps.Clone(perms)
+	}
+}
+
+// permissionFor returns the permission checked on objects of objectType.
+func (r *RAGPipeline) permissionFor(objectType string) string {
+	if r.tenantPrefixes {
+		if _, base, ok := strings.Cut(objectType, "/"); ok {
+			objectType = base
+		}
+	}
+	if perm, ok := r.typePerms[objectType]; ok {
+		return perm
+	}
+	return r.permission
+}
+
+// ParseObjectReference parses "type:id" into an ObjectReference.
+func ParseObjectReference(s string) (*apiv1.ObjectReference, error) {
+	objType, objID, ok := strings.Cut(s, ":")
+	if !ok || objType == "" || objID == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSpiceDBObject, s)
+	}
+	return &apiv1.ObjectReference{ObjectType: objType, ObjectId: objID}, nil
+}
+
+// resourceFor maps d to its SpiceDB object, applying the documented
+// metadata-first precedence, in the definitions of d's tenant under
+// WithTenantPrefixes.
+func (r *RAGPipeline) resourceFor(d Document) (*apiv1.ObjectReference, error) {
+	res, err := r.mappedResource(d)
+	if err != nil || !r.tenantPrefixes {
+		return res, err
+	}
+	return tenantObject(res, d.Metadata[TenantKey])
+}
+
+// mappedResource maps d to its SpiceDB object. A chunk without an object
+// of its own falls back to its parent's.
+func (r *RAGPipeline) mappedResource(d Document) (*apiv1.ObjectReference, error) {
+	if d.Metadata[SpiceDBObjectKey] == "" {
+		if parent := d.Metadata[ParentObjectKey]; parent != "" {
+			return ParseObjectReference(parent)
+		}
+	}
+	if r.mapper == nil || d.Metadata[SpiceDBObjectKey] != "" {
+		return MetadataMapper{}.Map(d)
+	}
+	return r.mapper.Map(d)
+}
@@ -0,0 +1,151 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestMetadataMapper(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		meta    map[string]string
+		want    string
+		wantErr error
+	}{
+		{"valid", map[string]string{rag.SpiceDBObjectKey: "document:doc1"}, "document:doc1", nil},
+		{"id with colon", map[string]string{rag.SpiceDBObjectKey: "document:a:b"}, "document:a:b", nil},
+		{"missing", nil, "", rag.ErrNoResourceMapping},
+		{"no separator", map[string]string{rag.SpiceDBObjectKey: "doc1"}, "", rag.ErrInvalidSpiceDBObject},
+		{"empty id", map[string]string{rag.SpiceDBObjectKey: "document:"}, "", rag.ErrInvalidSpiceDBObject},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := rag.MetadataMapper{}.Map(rag.Document{ID: "doc1", Metadata: tc.meta})
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, obj.GetObjectType()+":"+obj.GetObjectId())
+		})
+	}
+}
+
+func TestTemplateMapper(t *testing.T) {
+	t.Parallel()
+
+	m, err := rag.NewTemplateMapper("{{.Metadata.kind}}:{{.ID}}")
+	require.NoError(t, err)
+
+	obj, err := m.Map(rag.Document{ID: "42", Metadata: map[string]string{"kind": "ticket"}})
+	require.NoError(t, err)
+	require.Equal(t, "ticket", obj.GetObjectType())
+	require.Equal(t, "42", obj.GetObjectId())
+
+	_, err = m.Map(rag.Document{ID: "42"})
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+
+	_, err = rag.NewTemplateMapper("document:{{.ID")
+	require.Error(t, err)
+}
+
+func TestMapperFunc(t *testing.T) {
+	t.Parallel()
+
+	sor := map[string]string{"doc1": "wiki_page:home"}
+	m := rag.MapperFunc(func(d rag.Document) (*apiv1.ObjectReference, error) {
+		obj, ok := sor[d.ID]
+		if !ok {
+			return nil, rag.ErrNoResourceMapping
+		}
+		return rag.ParseObjectReference(obj)
+	})
+
+	obj, err := m.Map(rag.Document{ID: "doc1"})
+	require.NoError(t, err)
+	require.Equal(t, "wiki_page", obj.GetObjectType())
+
+	_, err = m.Map(rag.Document{ID: "doc2"})
+	require.ErrorIs(t, err, rag.ErrNoResourceMapping)
+}
+
+func TestPipelineResourceMapper(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{
+		// Explicit metadata wins over the template.
+		{ID: "doc1", Text: "alpha", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:override"}},
+		// No metadata: the template applies.
+		{ID: "doc2", Text: "alpha"},
+		// The mapper fails: skipped like a malformed mapping.
+		{ID: "skip-me", Text: "alpha"},
+	}
+
+	tmpl, err := rag.NewTemplateMapper("document:{{.ID}}")
+	require.NoError(t, err)
+	mapper := rag.MapperFunc(func(d rag.Document) (*apiv1.ObjectReference, error) {
+		if d.ID == "skip-me" {
+			return nil, errors.New("system of record unavailable")
+		}
+		return tmpl.Map(d)
+	})
+
+	client, _ := newFakeClient(
+		"document:override#read@user:emilia",
+		"document:doc2#read@user:emilia",
+		// Would grant doc1 if the template were (wrongly) preferred.
+		"document:doc1#read@user:beatrice",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithResourceMapper(mapper))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "alpha", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc2"}, results)
+	require.Equal(t, 1, stats.Unmapped)
+
+	results, err = pipeline.Query(context.Background(), "beatrice", "alpha")
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestTypePermissions(t *testing.T) {
+	t.Parallel()
+
+	doc := func(id, object string) rag.Document {
+		return rag.Document{ID: id, Text: "onboarding " + id, Metadata: map[string]string{rag.SpiceDBObjectKey: object}}
+	}
+	docs := []rag.Document{
+		doc("handbook", "document:handbook"),
+		doc("wiki", "wiki_page:onboarding"),
+		doc("ticket42", "ticket:42"),
+		doc("ticket43", "ticket:43"),
+	}
+	client, fake := newFakeClient(
+		"document:handbook#read@user:emilia",
+		"wiki_page:onboarding#view@user:emilia",
+		"ticket:42#read_ticket@user:emilia",
+		// The pipeline's permission does not apply to tickets.
+		"ticket:43#read@user:emilia",
+	)
+	perms := rag.WithTypePermissions(map[string]string{"wiki_page": "view", "ticket": "read_ticket"})
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", docs, perms, rag.WithFilterStrategy(strategy))
+		results, err := pipeline.Query(context.Background(), "emilia", "onboarding")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"handbook", "wiki", "ticket42"}, results)
+	}
+	require.Equal(t, []int{1, 1, 2}, fake.bulkRequestSizes(), "one bulk check per permission")
+}
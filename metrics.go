@@ -0,0 +1,271 @@
+package rag
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the
+// Collector's latency histograms. They match the Prometheus client's
+// defaults.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector accumulates metrics for the pipelines it is attached to with
+// WithMetrics and serves them in the Prometheus text exposition format:
+// mount it on "/metrics" and add it as a scrape target. It has no
+// dependency on the Prometheus client library, so it is scraped directly
+// rather than registered with a prometheus.Registry.
+//
+// Metric names are prefixed with the namespace given to NewCollector:
+//
+//	<ns>_queries_total                          counter
+//	<ns>_query_errors_total{reason}             counter
+//	<ns>_query_duration_seconds                 histogram
+//	<ns>_candidates_total                       counter
+//	<ns>_documents_total{decision}              counter (allowed, denied, conditional, unmapped)
+//	<ns>_shadowed_documents_total               counter, see WithShadowMode
+//	<ns>_query_plans_total{plan}                counter (check_each, bulk, lookup), see Stats.Plan
+//	<ns>_permission_check_duration_seconds      histogram, time per query in the PermissionChecker
+//	<ns>_permission_check_errors_total          counter
+//	<ns>_check_cache_hits_total, _misses_total  counters, with WithCheckCache
+//	<ns>_check_cache_denied_hits_total          counter, the hits on denials cached by WithDeniedCheckCache
+type Collector struct {
+	namespace string
+
+	mu            sync.Mutex
+	queries       uint64
+	errors        map[string]uint64
+	queryDuration histogram
+	candidates    uint64
+	documents     map[string]uint64
+	plans         map[string]uint64
+	shadowed      uint64
+	checkDuration histogram
+	checkErrors   uint64
+	caches        []*CachingChecker
+}
+
+// NewCollector returns an empty Collector whose metric names start with
+// namespace, or "rag" if namespace is empty.
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = "rag"
+	}
+	return &Collector{
+		namespace:     namespace,
+		errors:        make(map[string]uint64),
+		documents:     make(map[string]uint64),
+		plans:         make(map[string]uint64),
+		queryDuration: newHistogram(DefaultDurationBuckets),
+		checkDuration: newHistogram(DefaultDurationBuckets),
+	}
+}
+
+// WithMetrics records the pipeline's queries in c. One Collector may be
+// shared by several pipelines; their metrics are summed.
+func WithMetrics(c *Collector) Option {
+	return func(r *RAGPipeline) {
+		r.metrics = c
+	}
+}
+
+// observeQuery records a finished query. A nil Collector records nothing,
+// as do the other observe methods.
+func (c *Collector) observeQuery(stats Stats, d time.Duration, err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries++
+	c.queryDuration.observe(d.Seconds())
+	c.candidates += uint64(stats.Candidates)
+	c.documents["allowed"] += uint64(stats.Allowed)
+	c.documents["denied"] += uint64(stats.Denied)
+	c.documents["conditional"] += uint64(stats.Conditional)
+	c.documents["unmapped"] += uint64(stats.Unmapped)
+	c.shadowed += uint64(stats.Shadowed)
+	if stats.Plan != PlanNone {
+		c.plans[stats.Plan.String()]++
+	}
+	if err != nil {
+		c.errors[errorReason(err)]++
+	}
+}
+
+func (c *Collector) observePermissionCheck(d time.Duration, err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkDuration.observe(d.Seconds())
+	if err != nil {
+		c.checkErrors++
+	}
+}
+
+func (c *Collector) addCache(cache *CachingChecker) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.caches = append(c.caches, cache)
+}
+
+// errorReason is the reason label of a failed query.
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		return "invalid_request"
+	case errors.Is(err, ErrQueryTooBroad):
+		return "query_too_broad"
+	case errors.Is(err, ErrConditionalPermission):
+		return "conditional_permission"
+	case errors.Is(err, ErrPermissionBackendUnavailable):
+		return "backend_unavailable"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	default:
+		return "other"
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	name := func(s string) string { return c.namespace + "_" + s }
+
+	header(cw, name("queries_total"), "counter", "Queries run, including failed ones.")
+	fmt.Fprintf(cw, "%s %d\n", name("queries_total"), c.queries)
+
+	header(cw, name("query_errors_total"), "counter", "Failed queries by reason.")
+	for _, reason := range sortedKeys(c.errors) {
+		fmt.Fprintf(cw, "%s{reason=%q} %d\n", name("query_errors_total"), reason, c.errors[reason])
+	}
+
+	c.queryDuration.write(cw, name("query_duration_seconds"), "Time to run a query, retrieval and authorization included.")
+
+	header(cw, name("candidates_total"), "counter", "Documents retrieved for queries, before authorization.")
+	fmt.Fprintf(cw, "%s %d\n", name("candidates_total"), c.candidates)
+
+	header(cw, name("documents_total"), "counter", "Candidate documents by authorization outcome.")
+	for _, decision := range sortedKeys(c.documents) {
+		fmt.Fprintf(cw, "%s{decision=%q} %d\n", name("documents_total"), decision, c.documents[decision])
+	}
+
+	header(cw, name("shadowed_documents_total"), "counter", "Documents returned under shadow mode that enforcement would have withheld.")
+	fmt.Fprintf(cw, "%s %d\n", name("shadowed_documents_total"), c.shadowed)
+
+	header(cw, name("query_plans_total"), "counter", "Queries by how their candidates were authorized.")
+	for _, plan := range sortedKeys(c.plans) {
+		fmt.Fprintf(cw, "%s{plan=%q} %d\n", name("query_plans_total"), plan, c.plans[plan])
+	}
+
+	c.checkDuration.write(cw, name("permission_check_duration_seconds"), "Time a query spent in the PermissionChecker, e.g. SpiceDB round trips.")
+
+	header(cw, name("permission_check_errors_total"), "counter", "Queries whose permission checks failed.")
+	fmt.Fprintf(cw, "%s %d\n", name("permission_check_errors_total"), c.checkErrors)
+
+	if len(c.caches) > 0 {
+		var hits, misses, deniedHits int
+		for _, cache := range c.caches {
+			s := cache.Stats()
+			hits += s.Hits
+			misses += s.Misses
+			deniedHits += s.DeniedHits
+		}
+		header(cw, name("check_cache_hits_total"), "counter", "Permission checks answered from the check cache.")
+		fmt.Fprintf(cw, "%s %d\n", name("check_cache_hits_total"), hits)
+		header(cw, name("check_cache_misses_total"), "counter", "Permission checks the check cache passed through.")
+		fmt.Fprintf(cw, "%s %d\n", name("check_cache_misses_total"), misses)
+		header(cw, name("check_cache_denied_hits_total"), "counter", "Permission checks answered from the check cache's denials.")
+		fmt.Fprintf(cw, "%s %d\n", name("check_cache_denied_hits_total"), deniedHits)
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	header(w, name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// countingWriter tracks the bytes written and the first error for WriteTo.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,76 @@
+package rag_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func scrape(t *testing.T, c *rag.Collector) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	metrics := rag.NewCollector("")
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc3#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithMetrics(metrics), rag.WithCheckCache(time.Minute, 100))
+
+	for range 2 {
+		_, err := pipeline.Query(context.Background(), "emilia", "o")
+		require.NoError(t, err)
+	}
+	_, err := pipeline.Query(context.Background(), "", "o")
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+
+	out := scrape(t, metrics)
+	for _, line := range []string{
+		"# TYPE rag_queries_total counter",
+		"rag_queries_total 3",
+		`rag_query_errors_total{reason="invalid_request"} 1`,
+		"rag_candidates_total 6",
+		`rag_documents_total{decision="allowed"} 4`,
+		`rag_documents_total{decision="denied"} 2`,
+		"# TYPE rag_query_duration_seconds histogram",
+		`rag_query_duration_seconds_bucket{le="+Inf"} 3`,
+		"rag_query_duration_seconds_count 3",
+		"rag_permission_check_duration_seconds_count 2",
+		"rag_permission_check_errors_total 0",
+		"rag_check_cache_hits_total 3",
+		"rag_check_cache_misses_total 3",
+	} {
+		require.Contains(t, strings.Split(out, "\n"), line)
+	}
+}
+
+func TestCollectorNamespaceAndSharing(t *testing.T) {
+	t.Parallel()
+
+	metrics := rag.NewCollector("search")
+	for range 2 {
+		client, _ := newFakeClient()
+		pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithMetrics(metrics))
+		_, err := pipeline.Query(context.Background(), "nobody", "roadmap")
+		require.NoError(t, err)
+	}
+
+	out := scrape(t, metrics)
+	require.Contains(t, out, "\nsearch_queries_total 2\n")
+	require.Contains(t, out, "\nsearch_documents_total{decision=\"denied\"} 2\n")
+	require.NotContains(t, out, "check_cache")
+}
@@ -0,0 +1,155 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Similarity reports how alike two documents are, from 0 for unrelated
+// documents to 1 for duplicates.
+type Similarity func(a, b Document) float64
+
+// WithMMR selects each query's results by Maximal Marginal Relevance, so
+// the top results are not near-duplicates, such as several chunks of the
+// same document: each next result is the one maximizing
+//
+//	lambda*relevance - (1-lambda)*(its highest similarity to a result before it)
+//
+// Relevance is the score scaled to [0, 1] across the authorized results,
+// and similarity is measured by WithMMRSimilarity, DefaultSimilarity by
+// default. Lambda 1 keeps the plain relevance order; lower values trade
+// relevance for diversity, 0.5 weighing both equally. Lambda is clamped to
+// [0, 1].
+//
+// Diversification needs every authorized result at hand, so, as under
+// RerankAfterFilter, every candidate is authorized before the first
+// result is returned, also by Results and paged queries. Scores are left
+// as they are.
+func WithMMR(lambda float64) Option {
+	return func(r *RAGPipeline) {
+		r.mmr = true
+		r.mmrLambda = min(max(lambda, 0), 1)
+	}
+}
+
+// WithMMRSimilarity replaces DefaultSimilarity for WithMMR, e.g. with the
+// cosine similarity of embeddings the documents carry.
+func WithMMRSimilarity(sim Similarity) Option {
+	return func(r *RAGPipeline) {
+		r.similarity = sim
+	}
+}
+
+// DefaultSimilarity treats chunks of the same parent document (see
+// ParentIDKey) as duplicates and otherwise compares the sets of words of
+// the documents' text by their Jaccard index.
+func DefaultSimilarity(a, b Document) float64 {
+	return newSimilarityKey(a).similarity(newSimilarityKey(b))
+}
+
+type similarityKey struct {
+	parent string
+	words  map[string]struct{}
+}
+
+func newSimilarityKey(d Document) similarityKey {
+	words := make(map[string]struct{})
+	for _, w := range strings.FieldsFunc(strings.ToLower(d.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		words[w] = struct{}{}
+	}
+	return similarityKey{parent: d.Metadata[ParentIDKey], words: words}
+}
+
+func (k similarityKey) similarity(o similarityKey) float64 {
+	if k.parent != "" && k.parent == o.parent {
+		return 1
+	}
+	if len(k.words) == 0 && len(o.words) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range k.words {
+		if _, ok := o.words[w]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(k.words)+len(o.words)-shared)
+}
+
+// selectsFromAll reports whether the pipeline orders a query's results
+// only once all of them are authorized.
+func (r *RAGPipeline) selectsFromAll() bool {
+	return r.reranks(RerankAfterFilter) || r.mmr
+}
+
+// diversify reorders the response's results by Maximal Marginal
+// Relevance. Only the first TopK are selected that way; the rest follow
+// in their previous order.
+func (q *pendingQuery) diversify() {
+	r, resp := q.r, q.resp
+	n := len(resp.Results)
+	if !r.mmr || n < 2 {
+		return
+	}
+	k := n
+	if q.req.TopK > 0 && q.req.TopK < n {
+		k = q.req.TopK
+	}
+
+	sim := func(i, j int) float64 { return r.similarity(resp.Results[i].Document, resp.Results[j].Document) }
+	if r.similarity == nil {
+		keys := make([]similarityKey, n)
+		for i, res := range resp.Results {
+			keys[i] = newSimilarityKey(res.Document)
+		}
+		sim = func(i, j int) float64 { return keys[i].similarity(keys[j]) }
+	}
+
+	lo, hi := resp.Results[0].Score, resp.Results[0].Score
+	for _, res := range resp.Results {
+		lo, hi = min(lo, res.Score), max(hi, res.Score)
+	}
+	relevance := func(i int) float64 {
+		if hi == lo {
+			return 1
+		}
+		return (resp.Results[i].Score - lo) / (hi - lo)
+	}
+
+	selected := make([]bool, n)
+	redundancy := make([]float64, n) // highest similarity to a selected result
+	order := make([]int, 0, n)
+	for len(order) < k {
+		best, bestValue := -1, 0.0
+		for i := range n {
+			if selected[i] {
+				continue
+			}
+			v := r.mmrLambda*relevance(i) - (1-r.mmrLambda)*redundancy[i]
+			if best < 0 || v > bestValue {
+				best, bestValue = i, v
+			}
+		}
+		selected[best] = true
+		order = append(order, best)
+		for i := range n {
+			if !selected[i] {
+				redundancy[i] = max(redundancy[i], sim(best, i))
+			}
+		}
+	}
+	for i := range n {
+		if !selected[i] {
+			order = append(order, i)
+		}
+	}
+
+	results := make([]QueryResult, n)
+	for i, j := range order {
+		results[i] = resp.Results[j]
+		resp.Documents[i] = results[i].Document
+	}
+	resp.Results = results
+}
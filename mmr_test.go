@@ -0,0 +1,100 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// chunkedCorpus holds a handbook cut into three chunks about onboarding,
+// followed by two short documents about it.
+func chunkedCorpus() []rag.Document {
+	object := func(id string) map[string]string { return map[string]string{rag.SpiceDBObjectKey: "document:" + id} }
+	return []rag.Document{
+		{ID: "handbook", Text: "onboarding step one. onboarding step two. onboarding step 3.", Metadata: object("handbook")},
+		{ID: "faq", Text: "onboarding questions", Metadata: object("faq")},
+		{ID: "wiki", Text: "onboarding wiki page", Metadata: object("wiki")},
+	}
+}
+
+func TestMMRDiversifiesChunks(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:handbook#read@user:emilia", "document:faq#read@user:emilia", "document:wiki#read@user:emilia")
+	chunker := rag.WithChunker(rag.SentenceChunker{MaxSize: 25})
+
+	plain := rag.NewRAGPipeline(client, "document", "read", chunkedCorpus(), chunker)
+	got, err := plain.Query(context.Background(), "emilia", "onboarding", rag.WithTopK(3))
+	require.NoError(t, err)
+	require.Equal(t, []string{"handbook#0", "handbook#1", "handbook#2"}, docIDs(got))
+
+	diverse := rag.NewRAGPipeline(client, "document", "read", chunkedCorpus(), chunker, rag.WithMMR(0.5))
+	got, err = diverse.Query(context.Background(), "emilia", "onboarding", rag.WithTopK(3))
+	require.NoError(t, err)
+	// The wiki page shares fewer words with the first chunk than the FAQ.
+	require.Equal(t, []string{"handbook#0", "wiki#0", "faq#0"}, docIDs(got))
+
+	// Without TopK the duplicates come last; pages follow the same order.
+	got, err = diverse.Query(context.Background(), "emilia", "onboarding")
+	require.NoError(t, err)
+	require.Equal(t, []string{"handbook#0", "wiki#0", "faq#0", "handbook#1", "handbook#2"}, docIDs(got))
+
+	var cursor string
+	var paged []string
+	for {
+		page, err := diverse.Query(context.Background(), "emilia", "onboarding", rag.WithPageSize(2), rag.WithCursor(&cursor))
+		require.NoError(t, err)
+		paged = append(paged, docIDs(page)...)
+		if cursor == "" {
+			break
+		}
+	}
+	require.Equal(t, docIDs(got), paged)
+}
+
+func TestMMRLambdaOneKeepsRelevanceOrder(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:handbook#read@user:emilia", "document:faq#read@user:emilia", "document:wiki#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", chunkedCorpus(),
+		rag.WithChunker(rag.SentenceChunker{MaxSize: 25}), rag.WithMMR(1))
+	got, err := pipeline.Query(context.Background(), "emilia", "onboarding", rag.WithTopK(3))
+	require.NoError(t, err)
+	require.Equal(t, []string{"handbook#0", "handbook#1", "handbook#2"}, docIDs(got))
+}
+
+func TestMMRSimilarity(t *testing.T) {
+	t.Parallel()
+
+	var compared int
+	sim := func(a, b rag.Document) float64 {
+		compared++
+		if a.Text[0] == b.Text[0] {
+			return 1
+		}
+		return 0
+	}
+	docs := docsWithIDs("apple", "avocado", "banana")
+	client, _ := newFakeClient("document:apple#read@user:emilia", "document:avocado#read@user:emilia", "document:banana#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithMMR(0.3), rag.WithMMRSimilarity(sim))
+
+	got, err := pipeline.Query(context.Background(), "emilia", "a", rag.WithTopK(2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"apple", "banana"}, docIDs(got))
+	require.Positive(t, compared)
+}
+
+func TestDefaultSimilarity(t *testing.T) {
+	t.Parallel()
+
+	chunk := func(parent, text string) rag.Document {
+		return rag.Document{Text: text, Metadata: map[string]string{rag.ParentIDKey: parent}}
+	}
+	require.Equal(t, 1.0, rag.DefaultSimilarity(chunk("a", "one"), chunk("a", "two")))
+	require.Equal(t, 0.0, rag.DefaultSimilarity(chunk("a", "one"), chunk("b", "two")))
+	require.InDelta(t, 0.5, rag.DefaultSimilarity(rag.Document{Text: "Red apple, green"}, rag.Document{Text: "green red pear"}), 1e-9)
+	require.Equal(t, 0.0, rag.DefaultSimilarity(rag.Document{}, rag.Document{}))
+}
@@ -0,0 +1,475 @@
+// Package notion ingests the Notion pages shared with an integration and
+// mirrors the workspace's membership into SpiceDB. A Client's Source
+// feeds loader.Ingest:
+//
+//	client := notion.New(os.Getenv("NOTION_TOKEN"))
+//	res, err := loader.Ingest(ctx, client.Source("acme"), pipeline)
+//
+// A page's object is its workspace, "workspace:acme", and the
+// workspace's members are written as that object's viewer relationships
+// with SetAccess, replacing those of an earlier run. Notion's API lists
+// members but not guests, nor who a page is shared with, so share only
+// pages every member may read with the integration. The schema needs a
+// workspace definition, e.g.
+//
+//	definition workspace {
+//	  relation viewer: user
+//	  permission read = viewer
+//	}
+//
+// Pages are rendered as Markdown and loaded with loader.Markdown; a
+// pipeline configured WithChunker chunks them as they are added.
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// Metadata keys set on the documents.
+const (
+	PageIDKey = "page_id"
+	EditedKey = "last_edited_time"
+)
+
+// Version is the Notion API version requests are made with.
+const Version = "2022-06-28"
+
+// APIError is a non-2xx response from Notion.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notion: server returned %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// User is a member of the workspace.
+type User struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// SubjectFunc maps a workspace member to the SpiceDB subject they stand
+// for, as "type:id", reporting false for members with none.
+type SubjectFunc func(u User) (string, bool)
+
+// DefaultSubject maps members to "user:<Notion user ID>".
+func DefaultSubject(u User) (string, bool) {
+	return "user:" + loader.EscapeID(u.ID), true
+}
+
+// Client is a client of the Notion API.
+type Client struct {
+	token        string
+	endpoint     string
+	httpClient   *http.Client
+	resourceType string
+	subject      SubjectFunc
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithEndpoint addresses another server than "https://api.notion.com",
+// such as a test double.
+func WithEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithResourceType sets the type of the workspace's object, "workspace"
+// by default.
+func WithResourceType(resourceType string) Option {
+	return func(c *Client) {
+		c.resourceType = resourceType
+	}
+}
+
+// WithSubjectFunc replaces DefaultSubject, e.g. to map members by email
+// address.
+func WithSubjectFunc(fn SubjectFunc) Option {
+	return func(c *Client) {
+		c.subject = fn
+	}
+}
+
+// New returns a client authenticating with an integration's token.
+func New(token string, opts ...Option) *Client {
+	c := &Client{
+		token:        token,
+		endpoint:     "https://api.notion.com",
+		httpClient:   http.DefaultClient,
+		resourceType: "workspace",
+		subject:      DefaultSubject,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Users yields the workspace's members; bots and guests are left out.
+func (c *Client) Users(ctx context.Context) iter.Seq2[User, error] {
+	return func(yield func(User, error) bool) {
+		for cursor := ""; ; {
+			q := url.Values{"page_size": {"100"}}
+			if cursor != "" {
+				q.Set("start_cursor", cursor)
+			}
+			var page struct {
+				Results []struct {
+					ID     string `json:"id"`
+					Type   string `json:"type"`
+					Name   string `json:"name"`
+					Person struct {
+						Email string `json:"email"`
+					} `json:"person"`
+				} `json:"results"`
+				NextCursor string `json:"next_cursor"`
+				HasMore    bool   `json:"has_more"`
+			}
+			if err := c.call(ctx, http.MethodGet, "/v1/users?"+q.Encode(), nil, &page); err != nil {
+				yield(User{}, fmt.Errorf("notion: listing users: %w", err))
+				return
+			}
+			for _, u := range page.Results {
+				if u.Type != "person" {
+					continue
+				}
+				if !yield(User{ID: u.ID, Name: u.Name, Email: u.Person.Email}, nil) {
+					return
+				}
+			}
+			if !page.HasMore || page.NextCursor == "" {
+				return
+			}
+			cursor = page.NextCursor
+		}
+	}
+}
+
+// Access returns the workspace's members as viewer relationships on its
+// object.
+func (c *Client) Access(ctx context.Context) (*loader.Access, error) {
+	access := &loader.Access{Relations: []string{"viewer"}}
+	granted := make(map[string]bool)
+	for u, err := range c.Users(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		subject, ok := c.subject(u)
+		if !ok || granted[subject] {
+			continue
+		}
+		granted[subject] = true
+		access.Entries = append(access.Entries, rag.ACLEntry{Relation: "viewer", Subject: subject})
+	}
+	return access, nil
+}
+
+// Page is a page shared with the integration.
+type Page struct {
+	ID         string
+	Title      string
+	URL        string
+	LastEdited time.Time
+}
+
+// Pages yields the pages shared with the integration, archived ones left
+// out, fetching a page of up to 100 at a time.
+func (c *Client) Pages(ctx context.Context) iter.Seq2[Page, error] {
+	return func(yield func(Page, error) bool) {
+		body := map[string]any{
+			"filter":    map[string]string{"property": "object", "value": "page"},
+			"page_size": 100,
+		}
+		for {
+			var page struct {
+				Results []struct {
+					ID             string    `json:"id"`
+					URL            string    `json:"url"`
+					LastEditedTime time.Time `json:"last_edited_time"`
+					Archived       bool      `json:"archived"`
+					InTrash        bool      `json:"in_trash"`
+					Properties     map[string]struct {
+						Type  string     `json:"type"`
+						Title []richText `json:"title"`
+					} `json:"properties"`
+				} `json:"results"`
+				NextCursor string `json:"next_cursor"`
+				HasMore    bool   `json:"has_more"`
+			}
+			if err := c.call(ctx, http.MethodPost, "/v1/search", body, &page); err != nil {
+				yield(Page{}, fmt.Errorf("notion: searching pages: %w", err))
+				return
+			}
+			for _, r := range page.Results {
+				if r.Archived || r.InTrash {
+					continue
+				}
+				p := Page{ID: r.ID, URL: r.URL, LastEdited: r.LastEditedTime}
+				for _, prop := range r.Properties {
+					if prop.Type == "title" {
+						p.Title = plainText(prop.Title)
+					}
+				}
+				if !yield(p, nil) {
+					return
+				}
+			}
+			if !page.HasMore || page.NextCursor == "" {
+				return
+			}
+			body["start_cursor"] = page.NextCursor
+		}
+	}
+}
+
+// Markdown renders the blocks of the page id as Markdown. Child pages
+// and databases are left out; Pages yields them by themselves.
+func (c *Client) Markdown(ctx context.Context, id string) (string, error) {
+	var b bytes.Buffer
+	if err := c.render(ctx, &b, id, ""); err != nil {
+		return "", fmt.Errorf("notion: reading page %s: %w", id, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+type richText struct {
+	PlainText string `json:"plain_text"`
+}
+
+func plainText(rt []richText) string {
+	var b strings.Builder
+	for _, t := range rt {
+		b.WriteString(t.PlainText)
+	}
+	return b.String()
+}
+
+// block is the content of a block of any type.
+type block struct {
+	RichText []richText `json:"rich_text"`
+	Checked  bool       `json:"checked"`
+	Language string     `json:"language"`
+}
+
+// render writes the children of the block id to b, list items and
+// nested blocks indented by indent.
+func (c *Client) render(ctx context.Context, b *bytes.Buffer, id, indent string) error {
+	number := 0
+	for cursor := ""; ; {
+		q := url.Values{"page_size": {"100"}}
+		if cursor != "" {
+			q.Set("start_cursor", cursor)
+		}
+		var page struct {
+			Results    []json.RawMessage `json:"results"`
+			NextCursor string            `json:"next_cursor"`
+			HasMore    bool              `json:"has_more"`
+		}
+		if err := c.call(ctx, http.MethodGet, "/v1/blocks/"+url.PathEscape(id)+"/children?"+q.Encode(), nil, &page); err != nil {
+			return err
+		}
+		for _, raw := range page.Results {
+			var head struct {
+				ID          string `json:"id"`
+				Type        string `json:"type"`
+				HasChildren bool   `json:"has_children"`
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &head); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				return err
+			}
+			var blk block
+			if content, ok := fields[head.Type]; ok {
+				_ = json.Unmarshal(content, &blk)
+			}
+			text := plainText(blk.RichText)
+			if head.Type == "numbered_list_item" {
+				number++
+			} else {
+				number = 0
+			}
+
+			nested := indent
+			switch head.Type {
+			case "child_page", "child_database":
+				continue
+			case "heading_1", "heading_2", "heading_3":
+				level, _ := strconv.Atoi(strings.TrimPrefix(head.Type, "heading_"))
+				fmt.Fprintf(b, "\n%s%s %s\n\n", indent, strings.Repeat("#", level), text)
+			case "bulleted_list_item", "toggle":
+				fmt.Fprintf(b, "%s- %s\n", indent, text)
+				nested += "  "
+			case "numbered_list_item":
+				fmt.Fprintf(b, "%s%d. %s\n", indent, number, text)
+				nested += "   "
+			case "to_do":
+				mark := " "
+				if blk.Checked {
+					mark = "x"
+				}
+				fmt.Fprintf(b, "%s- [%s] %s\n", indent, mark, text)
+				nested += "  "
+			case "quote", "callout":
+				fmt.Fprintf(b, "%s> %s\n\n", indent, text)
+			case "code":
+				fmt.Fprintf(b, "%s```%s\n%s\n%s```\n\n", indent, blk.Language, text, indent)
+			default:
+				if text != "" {
+					fmt.Fprintf(b, "%s%s\n\n", indent, text)
+				}
+			}
+			if head.HasChildren {
+				if err := c.render(ctx, b, head.ID, nested); err != nil {
+					return err
+				}
+			}
+		}
+		if !page.HasMore || page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// Source returns a loader.Source over the pages shared with the
+// integration, each carrying the workspace's Access on the object of
+// workspace, an ID of the caller's choosing. A file's Path is the page's
+// title and its ID the page ID.
+func (c *Client) Source(workspace string) loader.Source {
+	return source{client: c, workspace: workspace}
+}
+
+type source struct {
+	client    *Client
+	workspace string
+}
+
+func (s source) Files(ctx context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		access, err := s.client.Access(ctx)
+		if err != nil {
+			yield(loader.File{}, err)
+			return
+		}
+		for p, err := range s.client.Pages(ctx) {
+			if err != nil {
+				yield(loader.File{}, err)
+				return
+			}
+			f := loader.File{
+				Path:     strings.ReplaceAll(p.Title, "/", "_"),
+				Location: p.URL,
+				Metadata: map[string]string{
+					rag.SpiceDBObjectKey: s.client.resourceType + ":" + loader.EscapeID(s.workspace),
+					loader.TitleKey:      p.Title,
+					PageIDKey:            p.ID,
+					EditedKey:            p.LastEdited.UTC().Format(time.RFC3339),
+				},
+				ID:     p.ID,
+				Loader: loader.Markdown{},
+				Access: access,
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					text, err := s.client.Markdown(ctx, p.ID)
+					if err != nil {
+						return nil, err
+					}
+					return io.NopCloser(strings.NewReader(text)), nil
+				},
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// maxRetries bounds the retries of a rate-limited request.
+const maxRetries = 3
+
+// call sends a request for path with body, if any, as JSON and decodes
+// the JSON response into out. Rate-limited requests are retried after
+// the delay Notion asks for.
+func (c *Client) call(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Notion-Version", Version)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			resp.Body.Close()
+			delay := time.Second
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				delay = time.Duration(secs) * time.Second
+			}
+			select {
+			case <-time.After(delay):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			apiErr := &APIError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+			var e struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e) == nil && e.Code != "" {
+				apiErr.Code, apiErr.Message = e.Code, e.Message
+			}
+			return apiErr
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding response: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,202 @@
+package notion_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/notion"
+)
+
+func text(s string) map[string]any {
+	return map[string]any{"rich_text": []map[string]string{{"plain_text": s}}}
+}
+
+func blk(id, typ string, content map[string]any, children bool) map[string]any {
+	return map[string]any{"object": "block", "id": id, "type": typ, typ: content, "has_children": children}
+}
+
+var children = map[string][]map[string]any{
+	"page-1": {
+		blk("b1", "heading_1", text("Runbook"), false),
+		blk("b2", "paragraph", text("Restart the service."), false),
+		blk("b3", "bulleted_list_item", text("Check the logs"), true),
+		blk("b4", "numbered_list_item", text("Drain"), false),
+		blk("b5", "numbered_list_item", text("Restart"), false),
+		blk("b6", "to_do", map[string]any{"rich_text": []map[string]string{{"plain_text": "Page on call"}}, "checked": true}, false),
+		blk("b7", "child_page", map[string]any{"title": "Appendix"}, false),
+		blk("b8", "code", map[string]any{"rich_text": []map[string]string{{"plain_text": "make restart"}}, "language": "bash"}, false),
+	},
+	"b3":     {blk("b31", "bulleted_list_item", text("grep for panics"), false)},
+	"page-2": {blk("b9", "quote", text("Leave is unlimited."), false)},
+}
+
+// fakeNotion serves users, search results and block children, one
+// result per page, and rate-limits the first search.
+func fakeNotion(t *testing.T) *httptest.Server {
+	t.Helper()
+	var searches atomic.Int32
+	paginate := func(w http.ResponseWriter, results []map[string]any, cursor string) {
+		start := len(cursor)
+		page := map[string]any{"object": "list", "results": []map[string]any{}, "has_more": false, "next_cursor": nil}
+		if start < len(results) {
+			page["results"] = results[start : start+1]
+			if start+1 < len(results) {
+				page["has_more"], page["next_cursor"] = true, strings.Repeat("x", start+1)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Notion-Version") != notion.Version {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"object": "error", "status": 401, "code": "unauthorized", "message": "API token is invalid."})
+			return
+		}
+		switch {
+		case r.URL.Path == "/v1/users":
+			paginate(w, []map[string]any{
+				{"object": "user", "id": "u-emilia", "type": "person", "name": "Emilia", "person": map[string]string{"email": "emilia@acme.com"}},
+				{"object": "user", "id": "u-bot", "type": "bot", "name": "Indexer"},
+				{"object": "user", "id": "u-beatrice", "type": "person", "name": "Beatrice", "person": map[string]string{"email": "beatrice@acme.com"}},
+			}, r.URL.Query().Get("start_cursor"))
+		case r.URL.Path == "/v1/search" && r.Method == http.MethodPost:
+			if searches.Add(1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			var body struct {
+				StartCursor string `json:"start_cursor"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			title := func(s string) map[string]any {
+				return map[string]any{"title": map[string]any{"type": "title", "title": []map[string]string{{"plain_text": s}}}}
+			}
+			paginate(w, []map[string]any{
+				{"object": "page", "id": "page-1", "url": "https://www.notion.so/Runbook-page1", "last_edited_time": "2024-03-01T10:00:00.000Z", "properties": title("Runbook")},
+				{"object": "page", "id": "page-old", "archived": true, "properties": title("Old")},
+				{"object": "page", "id": "page-2", "url": "https://www.notion.so/Leave-page2", "last_edited_time": "2024-03-02T10:00:00.000Z", "properties": title("Leave/PTO")},
+			}, body.StartCursor)
+		case strings.HasPrefix(r.URL.Path, "/v1/blocks/") && strings.HasSuffix(r.URL.Path, "/children"):
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/blocks/"), "/children")
+			results, ok := children[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]any{"object": "error", "status": 404, "code": "object_not_found", "message": "Could not find block with ID: " + id + "."})
+				return
+			}
+			paginate(w, results, r.URL.Query().Get("start_cursor"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// accessIngester records documents and the access set on them.
+type accessIngester struct {
+	docs   []rag.Document
+	access map[string][]rag.ACLEntry
+}
+
+func (a *accessIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	a.docs = append(a.docs, doc)
+	return nil, nil
+}
+
+func (a *accessIngester) SetAccess(_ context.Context, object string, relations []string, entries []rag.ACLEntry) (*apiv1.ZedToken, error) {
+	if a.access == nil {
+		a.access = make(map[string][]rag.ACLEntry)
+	}
+	a.access[object+" "+strings.Join(relations, ",")] = entries
+	return nil, nil
+}
+
+func TestMarkdown(t *testing.T) {
+	t.Parallel()
+
+	client := notion.New("secret", notion.WithEndpoint(fakeNotion(t).URL))
+	md, err := client.Markdown(context.Background(), "page-1")
+	require.NoError(t, err)
+	require.Equal(t, "# Runbook\n\n"+
+		"Restart the service.\n\n"+
+		"- Check the logs\n"+
+		"  - grep for panics\n"+
+		"1. Drain\n"+
+		"2. Restart\n"+
+		"- [x] Page on call\n"+
+		"```bash\nmake restart\n```", md, "child pages are left out")
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	client := notion.New("secret", notion.WithEndpoint(fakeNotion(t).URL))
+	dst := &accessIngester{}
+	res, err := loader.Ingest(context.Background(), client.Source("acme"), dst)
+	require.NoError(t, err, "the rate-limited search is retried")
+	require.Len(t, res.Documents, 2, "archived pages are left out")
+
+	leave := res.Documents[1]
+	require.Equal(t, "page-2", leave.ID)
+	require.Equal(t, "Leave is unlimited.", leave.Text)
+	require.Equal(t, map[string]string{
+		rag.SpiceDBObjectKey: "workspace:acme",
+		loader.TitleKey:      "Leave/PTO",
+		loader.FormatKey:     "markdown",
+		loader.SourceKey:     "https://www.notion.so/Leave-page2",
+		notion.PageIDKey:     "page-2",
+		notion.EditedKey:     "2024-03-02T10:00:00Z",
+	}, leave.Metadata)
+	require.Contains(t, res.Documents[0].Text, "grep for panics")
+
+	require.Equal(t, map[string][]rag.ACLEntry{
+		"workspace:acme viewer": {
+			{Relation: "viewer", Subject: "user:u-emilia"},
+			{Relation: "viewer", Subject: "user:u-beatrice"},
+		},
+	}, dst.access, "bots are left out")
+}
+
+func TestSubjectFunc(t *testing.T) {
+	t.Parallel()
+
+	client := notion.New("secret", notion.WithEndpoint(fakeNotion(t).URL),
+		notion.WithResourceType("wiki"),
+		notion.WithSubjectFunc(func(u notion.User) (string, bool) {
+			name, ok := strings.CutSuffix(u.Email, "@acme.com")
+			return "user:" + name, ok
+		}))
+	access, err := client.Access(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{
+		{Relation: "viewer", Subject: "user:emilia"},
+		{Relation: "viewer", Subject: "user:beatrice"},
+	}, access.Entries)
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeNotion(t)
+	_, err := loader.Ingest(context.Background(), notion.New("wrong", notion.WithEndpoint(srv.URL)).Source("acme"), &accessIngester{})
+	var apiErr *notion.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	require.Equal(t, "unauthorized", apiErr.Code)
+
+	_, err = notion.New("secret", notion.WithEndpoint(srv.URL)).Markdown(context.Background(), "page-missing")
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "object_not_found", apiErr.Code)
+}
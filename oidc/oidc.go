@@ -0,0 +1,222 @@
+// Package oidc maps verified OIDC ID tokens and other JWTs to the SpiceDB
+// subjects a rag.RAGPipeline authorizes queries for, so web services can
+// plug their authentication layer into the pipeline: Middleware puts the
+// caller's subject on the request context with rag.WithSubject.
+//
+// Signature verification is delegated to a Verifier. For an OIDC provider,
+// wrap the ID token verifier of a library such as
+// github.com/coreos/go-oidc, imported here as gooidc:
+//
+//	idv := provider.Verifier(&gooidc.Config{ClientID: clientID})
+//	verifier := oidc.VerifierFunc(func(ctx context.Context, token string) (oidc.Claims, error) {
+//		idt, err := idv.Verify(ctx, token)
+//		if err != nil {
+//			return nil, err
+//		}
+//		var claims oidc.Claims
+//		return claims, idt.Claims(&claims)
+//	})
+//
+// NewHS256Verifier covers tokens signed with a shared secret.
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+var (
+	// ErrInvalidToken is returned for a token that is malformed, badly
+	// signed or expired.
+	ErrInvalidToken = errors.New("oidc: invalid token")
+
+	// ErrNoSubject is returned when no Rule matches a token's claims.
+	ErrNoSubject = errors.New("oidc: no subject claim")
+)
+
+// Claims are the claims of a verified token.
+type Claims map[string]any
+
+// Verifier checks a raw token's signature and validity and returns its
+// claims.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (Claims, error)
+}
+
+// VerifierFunc adapts a plain function to a Verifier.
+type VerifierFunc func(ctx context.Context, token string) (Claims, error)
+
+// Verify calls f(ctx, token).
+func (f VerifierFunc) Verify(ctx context.Context, token string) (Claims, error) {
+	return f(ctx, token)
+}
+
+// Rule maps a claim to a subject: a token whose Claim is a non-empty
+// string becomes the subject of type SubjectType, and optionally
+// Relation, with the claim as ID.
+type Rule struct {
+	Claim string
+
+	// SubjectType and Relation are the subject's type and relation. An
+	// empty SubjectType selects the pipeline's default type and relation.
+	SubjectType string
+	Relation    string
+
+	// ID, if set, turns the claim into a SpiceDB object ID. Claims such
+	// as "email" hold characters object IDs cannot, e.g. "@" and ".".
+	ID func(claim string) string
+}
+
+// Extractor derives subjects from tokens.
+type Extractor struct {
+	verifier Verifier
+	rules    []Rule
+}
+
+// Option configures an Extractor.
+type Option func(*Extractor)
+
+// WithRule adds r to the rules tried, in order, against a token's
+// claims; the first one whose claim is present wins. Without rules, the
+// "sub" claim is the ID of a subject of the pipeline's default type. For
+// example, to map end users by email and machine clients to service
+// accounts:
+//
+//	oidc.WithRule(oidc.Rule{Claim: "email", SubjectType: "user", ID: escape}),
+//	oidc.WithRule(oidc.Rule{Claim: "client_id", SubjectType: "serviceaccount"}),
+func WithRule(r Rule) Option {
+	return func(e *Extractor) {
+		e.rules = append(e.rules, r)
+	}
+}
+
+// New returns an Extractor verifying tokens with v.
+func New(v Verifier, opts ...Option) *Extractor {
+	e := &Extractor{verifier: v}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if len(e.rules) == 0 {
+		e.rules = []Rule{{Claim: "sub"}}
+	}
+	return e
+}
+
+// Subject verifies token and returns its subject.
+func (e *Extractor) Subject(ctx context.Context, token string) (rag.Subject, error) {
+	claims, err := e.verifier.Verify(ctx, token)
+	if err != nil {
+		return rag.Subject{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return e.SubjectFromClaims(claims)
+}
+
+// SubjectFromClaims returns the subject of already verified claims. The
+// subject is checked against SpiceDB's syntax, so a bad mapping fails
+// here rather than at query time.
+func (e *Extractor) SubjectFromClaims(claims Claims) (rag.Subject, error) {
+	for _, rule := range e.rules {
+		id, _ := claims[rule.Claim].(string)
+		if id == "" {
+			continue
+		}
+		if rule.ID != nil {
+			id = rule.ID(id)
+		}
+		req := rag.QueryRequest{UserID: id, SubjectType: rule.SubjectType, SubjectRelation: rule.Relation}
+		if err := req.Validate(); err != nil {
+			return rag.Subject{}, fmt.Errorf("oidc: claim %q: %w", rule.Claim, err)
+		}
+		return rag.Subject{Type: rule.SubjectType, ID: id, Relation: rule.Relation}, nil
+	}
+	return rag.Subject{}, ErrNoSubject
+}
+
+// Middleware authenticates each request by the bearer token in its
+// Authorization header and passes it on with the token's subject set by
+// rag.WithSubject. Requests without a valid token are answered with
+// 401 Unauthorized and do not reach next.
+func (e *Extractor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			unauthorized(w)
+			return
+		}
+		subject, err := e.Subject(req.Context(), token)
+		if err != nil {
+			unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(rag.WithSubject(req.Context(), subject)))
+	})
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// NewHS256Verifier returns a Verifier for JWTs signed with HMAC-SHA256
+// under secret, as issued by internal services sharing a key with this
+// one. It rejects other algorithms and tokens outside their "nbf" and
+// "exp" times.
+func NewHS256Verifier(secret []byte) Verifier {
+	return VerifierFunc(func(_ context.Context, token string) (Claims, error) {
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return nil, errors.New("not a JWS compact serialization")
+		}
+
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		if err := decodeSegment(parts[0], &header); err != nil {
+			return nil, fmt.Errorf("header: %w", err)
+		}
+		if header.Alg != "HS256" {
+			return nil, fmt.Errorf("unexpected algorithm %q", header.Alg)
+		}
+
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("signature: %w", err)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errors.New("signature mismatch")
+		}
+
+		var claims Claims
+		if err := decodeSegment(parts[1], &claims); err != nil {
+			return nil, fmt.Errorf("claims: %w", err)
+		}
+		now := time.Now()
+		if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+			return nil, errors.New("token expired")
+		}
+		if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+			return nil, errors.New("token not yet valid")
+		}
+		return claims, nil
+	})
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
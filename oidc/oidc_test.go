@@ -0,0 +1,121 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/oidc"
+)
+
+var secret = []byte("test-secret")
+
+// sign returns an HS256 JWT of claims under key.
+func sign(t *testing.T, key []byte, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signing := enc(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + enc(claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signing))
+	return signing + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSubjectDefaultRule(t *testing.T) {
+	t.Parallel()
+
+	e := oidc.New(oidc.NewHS256Verifier(secret))
+	s, err := e.Subject(context.Background(), sign(t, secret, map[string]any{"sub": "emilia"}))
+	require.NoError(t, err)
+	require.Equal(t, rag.Subject{ID: "emilia"}, s)
+}
+
+func TestSubjectRules(t *testing.T) {
+	t.Parallel()
+
+	escape := func(email string) string {
+		return strings.NewReplacer("@", "_at_", ".", "_").Replace(email)
+	}
+	e := oidc.New(oidc.NewHS256Verifier(secret),
+		oidc.WithRule(oidc.Rule{Claim: "email", SubjectType: "user", ID: escape}),
+		oidc.WithRule(oidc.Rule{Claim: "client_id", SubjectType: "serviceaccount"}),
+	)
+
+	s, err := e.SubjectFromClaims(oidc.Claims{"sub": "1234", "email": "emilia@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, rag.Subject{Type: "user", ID: "emilia_at_example_com"}, s)
+
+	s, err = e.SubjectFromClaims(oidc.Claims{"sub": "1234", "client_id": "indexer"})
+	require.NoError(t, err)
+	require.Equal(t, rag.Subject{Type: "serviceaccount", ID: "indexer"}, s)
+
+	_, err = e.SubjectFromClaims(oidc.Claims{"sub": "1234"})
+	require.ErrorIs(t, err, oidc.ErrNoSubject)
+
+	// IDs SpiceDB would reject fail at extraction.
+	raw := oidc.New(nil, oidc.WithRule(oidc.Rule{Claim: "email"}))
+	_, err = raw.SubjectFromClaims(oidc.Claims{"email": "emilia@example.com"})
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+}
+
+func TestHS256VerifierRejects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	v := oidc.NewHS256Verifier(secret)
+
+	_, err := v.Verify(ctx, sign(t, secret, map[string]any{"sub": "emilia", "exp": time.Now().Add(time.Hour).Unix()}))
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"malformed":     "not-a-jwt",
+		"wrong key":     sign(t, []byte("other"), map[string]any{"sub": "emilia"}),
+		"expired":       sign(t, secret, map[string]any{"sub": "emilia", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"not yet valid": sign(t, secret, map[string]any{"sub": "emilia", "nbf": time.Now().Add(time.Hour).Unix()}),
+		"alg none":      base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"emilia"}`)) + ".",
+	} {
+		_, err := v.Verify(ctx, token)
+		require.Error(t, err, name)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	e := oidc.New(oidc.NewHS256Verifier(secret))
+	handler := e.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := rag.SubjectFromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(s.ID))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, secret, map[string]any{"sub": "emilia"}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "emilia", rec.Body.String())
+
+	for _, auth := range []string{"", "Basic ZW1pbGlhOg==", "Bearer " + sign(t, []byte("other"), map[string]any{"sub": "emilia"})} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+		require.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,205 @@
+// Package ollama implements rag.Generator and rag.Embedder on top of a
+// local Ollama server, so the whole permission-aware RAG flow can run
+// without external API keys. Package ollamatest starts such a server in a
+// container.
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultBaseURL is the address Ollama listens on by default.
+const DefaultBaseURL = "http://localhost:11434"
+
+// APIError is a non-2xx response from the Ollama server.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ollama: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried: the
+// server was overloaded or failed, rather than rejecting it. A
+// rag.BatchingEmbedder retries such errors.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Option configures a Generator or an Embedder.
+type Option func(*transport)
+
+type transport struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// WithBaseURL overrides DefaultBaseURL, e.g. with the endpoint returned by
+// ollamatest.
+func WithBaseURL(u string) Option {
+	return func(t *transport) {
+		t.baseURL = strings.TrimRight(u, "/")
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(t *transport) {
+		t.httpClient = hc
+	}
+}
+
+func newTransport(opts []Option) transport {
+	t := transport{baseURL: DefaultBaseURL, httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t
+}
+
+// Generator is a rag.Generator backed by Ollama's /api/generate endpoint.
+type Generator struct {
+	transport
+	model string
+}
+
+// NewGenerator returns a Generator completing prompts with model, e.g.
+// "llama3.2". The model must have been pulled.
+func NewGenerator(model string, opts ...Option) *Generator {
+	return &Generator{transport: newTransport(opts), model: model}
+}
+
+type generateRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+}
+
+type generateResponse struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+}
+
+// Generate implements rag.Generator.
+func (g *Generator) Generate(ctx context.Context, prompt string) (string, error) {
+	var resp generateResponse
+	if err := g.post(ctx, "/api/generate", generateRequest{Model: g.model, Prompt: prompt}, &resp); err != nil {
+		return "", err
+	}
+	return resp.Response, nil
+}
+
+// GenerateStream implements rag.StreamingGenerator, reading Ollama's
+// newline-delimited JSON stream.
+func (g *Generator) GenerateStream(ctx context.Context, prompt string, yield func(token string) error) error {
+	resp, err := g.send(ctx, "/api/generate", generateRequest{Model: g.model, Prompt: prompt, Stream: true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk generateResponse
+		if err := dec.Decode(&chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("ollama: decoding stream: %w", err)
+		}
+		if chunk.Response != "" {
+			if err := yield(chunk.Response); err != nil {
+				return err
+			}
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+}
+
+// Embedder is a rag.Embedder backed by Ollama's /api/embed endpoint.
+type Embedder struct {
+	transport
+	model string
+}
+
+// NewEmbedder returns an Embedder using model, e.g. "nomic-embed-text".
+// The model must have been pulled.
+func NewEmbedder(model string, opts ...Option) *Embedder {
+	return &Embedder{transport: newTransport(opts), model: model}
+}
+
+// Embed implements rag.Embedder.
+func (e *Embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	req := struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{Model: e.model, Input: texts}
+
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := e.post(ctx, "/api/embed", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama: got %d embeddings for %d texts", len(resp.Embeddings), len(texts))
+	}
+	return resp.Embeddings, nil
+}
+
+// post sends body as JSON to path and decodes the response into out.
+func (t *transport) post(ctx context.Context, path string, body, out any) error {
+	resp, err := t.send(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ollama: decoding response: %w", err)
+	}
+	return nil
+}
+
+// send sends body as JSON to path and returns the response if it is
+// successful. The caller must close its body.
+func (t *transport) send(ctx context.Context, path string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("ollama: building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(raw))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(raw, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return resp, nil
+}
@@ -0,0 +1,105 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ollama"
+)
+
+var (
+	_ rag.StreamingGenerator = (*ollama.Generator)(nil)
+	_ rag.Embedder           = (*ollama.Embedder)(nil)
+)
+
+// fakeOllama serves /api/generate and /api/embed, echoing the prompt
+// (streamed word by word if asked to) and embedding each text as
+// {len(text), 1}.
+func fakeOllama(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/generate", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Prompt string `json:"prompt"`
+			Stream *bool  `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream == nil || *req.Stream {
+			enc := json.NewEncoder(w)
+			for _, word := range strings.Fields(req.Prompt) {
+				_ = enc.Encode(map[string]any{"response": word, "done": false})
+			}
+			_ = enc.Encode(map[string]any{"response": "", "done": true})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "response": req.Model + ": " + req.Prompt, "done": true})
+	})
+	mux.HandleFunc("POST /api/embed", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"model \"missing\" not found, try pulling it first"}`))
+			return
+		}
+		embeddings := make([][]float32, len(req.Input))
+		for i, text := range req.Input {
+			embeddings[i] = []float32{float32(len(text)), 1}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "embeddings": embeddings})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGenerator(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeOllama(t)
+	answer, err := ollama.NewGenerator("llama3.2", ollama.WithBaseURL(srv.URL+"/")).Generate(context.Background(), "hi")
+	require.NoError(t, err)
+	require.Equal(t, "llama3.2: hi", answer)
+}
+
+func TestGeneratorStream(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeOllama(t)
+	var tokens []string
+	err := ollama.NewGenerator("llama3.2", ollama.WithBaseURL(srv.URL)).GenerateStream(context.Background(), "a b c", func(tok string) error {
+		tokens = append(tokens, tok)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, tokens)
+}
+
+func TestEmbedder(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeOllama(t)
+	vecs, err := ollama.NewEmbedder("nomic-embed-text", ollama.WithBaseURL(srv.URL)).Embed(context.Background(), []string{"a", "abc"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{{1, 1}, {3, 1}}, vecs)
+
+	_, err = ollama.NewEmbedder("missing", ollama.WithBaseURL(srv.URL)).Embed(context.Background(), []string{"a"})
+	var apiErr *ollama.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Contains(t, apiErr.Message, "try pulling it first")
+	require.False(t, apiErr.Temporary())
+	require.True(t, (&ollama.APIError{StatusCode: http.StatusTooManyRequests}).Temporary())
+	require.True(t, (&ollama.APIError{StatusCode: http.StatusServiceUnavailable}).Temporary())
+}
@@ -0,0 +1,151 @@
+// Package ollamatest starts throwaway Ollama servers in containers via
+// Testcontainers, so generation and embeddings can run in CI without
+// external API keys.
+package ollamatest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// DefaultImage is the Ollama image started when none is configured.
+	DefaultImage = "ollama/ollama:0.5.7"
+
+	// DefaultStartupTimeout bounds how long Run waits for the server to
+	// answer once the container is up. Pulling models is not included.
+	DefaultStartupTimeout = time.Minute
+
+	port = "11434/tcp"
+)
+
+// Instance is a running Ollama container.
+type Instance struct {
+	// Endpoint is the server's base URL, for ollama.WithBaseURL.
+	Endpoint string
+
+	container testcontainers.Container
+}
+
+// Terminate removes the container.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return i.container.Terminate(ctx)
+}
+
+// Pull downloads model into the running server.
+func (i *Instance) Pull(ctx context.Context, model string) error {
+	code, out, err := i.container.Exec(ctx, []string{"ollama", "pull", model})
+	if err != nil {
+		return fmt.Errorf("ollamatest: pulling %s: %w", model, err)
+	}
+	if code != 0 {
+		msg, _ := io.ReadAll(out)
+		return fmt.Errorf("ollamatest: pulling %s: exit code %d: %s", model, code, msg)
+	}
+	return nil
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	models         []string
+	startupTimeout time.Duration
+}
+
+// WithImage overrides the Ollama image.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithModels pulls models before Run returns.
+func WithModels(models ...string) Option {
+	return func(c *config) {
+		c.models = append(c.models, models...)
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// Run starts an Ollama container and pulls the configured models. The
+// caller owns the instance and must Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{image: DefaultImage, startupTimeout: DefaultStartupTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.image,
+			ExposedPorts: []string{port},
+			WaitingFor:   wait.ForHTTP("/").WithPort(port).WithStartupTimeout(cfg.startupTimeout),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("ollamatest: starting container: %w", err)
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, port, "http")
+	if err != nil {
+		_ = container.Terminate(ctx)
+		return nil, fmt.Errorf("ollamatest: resolving endpoint: %w", err)
+	}
+
+	inst := &Instance{Endpoint: endpoint, container: container}
+	for _, model := range cfg.models {
+		if err := inst.Pull(ctx, model); err != nil {
+			_ = inst.Terminate(ctx)
+			return nil, err
+		}
+	}
+	return inst, nil
+}
+
+// Cleanup tears down an instance started by StartOllama. It is safe to
+// call more than once.
+type Cleanup func()
+
+// StartOllama runs an Ollama server for the duration of a test and returns
+// its endpoint once the configured models are pulled. The test is skipped
+// when no container runtime is available and fails if the server cannot
+// be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the server earlier.
+func StartOllama(t *testing.T, opts ...Option) (string, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("ollamatest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.Endpoint, cleanup
+}
@@ -0,0 +1,26 @@
+package ollamatest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ollama"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ollama/ollamatest"
+)
+
+func TestStartOllama(t *testing.T) {
+	if testing.Short() {
+		t.Skip("pulls a model")
+	}
+	t.Parallel()
+
+	endpoint, _ := ollamatest.StartOllama(t, ollamatest.WithModels("all-minilm"))
+
+	vecs, err := ollama.NewEmbedder("all-minilm", ollama.WithBaseURL(endpoint)).
+		Embed(context.Background(), []string{"hello", "world"})
+	require.NoError(t, err)
+	require.Len(t, vecs, 2)
+	require.Equal(t, len(vecs[0]), len(vecs[1]))
+}
@@ -0,0 +1,255 @@
+// Package openai implements rag.Generator on top of OpenAI-compatible chat
+// completion APIs: OpenAI itself, Azure OpenAI, and self-hosted servers
+// such as vLLM that expose the same HTTP API.
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL is the OpenAI API endpoint used when none is configured.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// ErrEmptyCompletion is returned when the API answers without a choice.
+var ErrEmptyCompletion = errors.New("openai: completion has no choices")
+
+// APIError is a non-2xx response from the API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("openai: API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client is a rag.Generator sending each prompt as a single user message
+// to the chat completions endpoint.
+type Client struct {
+	baseURL      string
+	apiKey       string
+	model        string
+	azureVersion string
+	system       string
+	temperature  *float64
+	httpClient   *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL overrides DefaultBaseURL, e.g. "http://localhost:8000/v1"
+// for vLLM. For Azure OpenAI, pass the deployment URL
+// "https://<resource>.openai.azure.com/openai/deployments/<deployment>"
+// together with WithAzureAPIVersion.
+func WithBaseURL(u string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(u, "/")
+	}
+}
+
+// WithAPIKey sets the API key. Servers that need none, like a local vLLM,
+// can leave it unset.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithAzureAPIVersion switches to Azure OpenAI conventions: the key is
+// sent in the api-key header and version as the api-version parameter.
+func WithAzureAPIVersion(version string) Option {
+	return func(c *Client) {
+		c.azureVersion = version
+	}
+}
+
+// WithSystemPrompt sends prompt as a system message before every user
+// message.
+func WithSystemPrompt(prompt string) Option {
+	return func(c *Client) {
+		c.system = prompt
+	}
+}
+
+// WithTemperature sets the sampling temperature. The server default is
+// used otherwise.
+func WithTemperature(t float64) Option {
+	return func(c *Client) {
+		c.temperature = &t
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// New returns a Client generating with model. Azure OpenAI ignores model
+// in favour of the deployment in the base URL.
+func New(model string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    DefaultBaseURL,
+		model:      model,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string    `json:"model,omitempty"`
+	Messages    []message `json:"messages"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message message `json:"message"`
+	} `json:"choices"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type chatChunk struct {
+	Choices []struct {
+		Delta message `json:"delta"`
+	} `json:"choices"`
+}
+
+func (c *Client) chatRequest(prompt string) chatRequest {
+	req := chatRequest{Model: c.model, Temperature: c.temperature}
+	if c.system != "" {
+		req.Messages = append(req.Messages, message{Role: "system", Content: c.system})
+	}
+	req.Messages = append(req.Messages, message{Role: "user", Content: prompt})
+	return req
+}
+
+// Generate implements rag.Generator.
+func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := c.post(ctx, "/chat/completions", c.chatRequest(prompt))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("openai: decoding response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", ErrEmptyCompletion
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+// GenerateStream implements rag.StreamingGenerator, reading the
+// server-sent events of a streamed chat completion.
+func (c *Client) GenerateStream(ctx context.Context, prompt string, yield func(token string) error) error {
+	req := c.chatRequest(prompt)
+	req.Stream = true
+	resp, err := c.post(ctx, "/chat/completions", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("openai: decoding stream: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		if err := yield(chunk.Choices[0].Delta.Content); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("openai: reading stream: %w", err)
+	}
+	return nil
+}
+
+// post sends body as JSON to path and returns the response if it is
+// successful. The caller must close its body.
+func (c *Client) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("openai: encoding request: %w", err)
+	}
+
+	endpoint := c.baseURL + path
+	if c.azureVersion != "" {
+		endpoint += "?api-version=" + url.QueryEscape(c.azureVersion)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("openai: building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case c.apiKey == "":
+	case c.azureVersion != "":
+		req.Header.Set("api-key", c.apiKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, apiError(resp)
+	}
+	return resp, nil
+}
+
+// apiError builds an APIError from resp, preferring the message of an
+// OpenAI-style error body over the raw body.
+func apiError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := strings.TrimSpace(string(raw))
+	var e errorResponse
+	if json.Unmarshal(raw, &e) == nil && e.Error.Message != "" {
+		msg = e.Error.Message
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: msg}
+}
@@ -0,0 +1,120 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/openai"
+)
+
+var _ rag.StreamingGenerator = (*openai.Client)(nil)
+
+// completionServer answers every chat completion with answer and records
+// the last request.
+func completionServer(t *testing.T, answer string, last *http.Request, body *map[string]any) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = *r.Clone(context.Background())
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": answer}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	var req http.Request
+	var body map[string]any
+	srv := completionServer(t, "Paris", &req, &body)
+
+	c := openai.New("gpt-4o-mini", openai.WithBaseURL(srv.URL+"/v1/"), openai.WithAPIKey("sk-test"),
+		openai.WithSystemPrompt("Be brief."), openai.WithTemperature(0))
+	answer, err := c.Generate(context.Background(), "Capital of France?")
+	require.NoError(t, err)
+	require.Equal(t, "Paris", answer)
+
+	require.Equal(t, "/v1/chat/completions", req.URL.Path)
+	require.Equal(t, "Bearer sk-test", req.Header.Get("Authorization"))
+	require.Equal(t, "gpt-4o-mini", body["model"])
+	require.Equal(t, float64(0), body["temperature"])
+	require.Equal(t, []any{
+		map[string]any{"role": "system", "content": "Be brief."},
+		map[string]any{"role": "user", "content": "Capital of France?"},
+	}, body["messages"])
+}
+
+func TestGenerateAzure(t *testing.T) {
+	t.Parallel()
+
+	var req http.Request
+	var body map[string]any
+	srv := completionServer(t, "ok", &req, &body)
+
+	c := openai.New("", openai.WithBaseURL(srv.URL+"/openai/deployments/chat"),
+		openai.WithAPIKey("azure-key"), openai.WithAzureAPIVersion("2024-06-01"))
+	_, err := c.Generate(context.Background(), "hi")
+	require.NoError(t, err)
+
+	require.Equal(t, "/openai/deployments/chat/chat/completions", req.URL.Path)
+	require.Equal(t, "2024-06-01", req.URL.Query().Get("api-version"))
+	require.Equal(t, "azure-key", req.Header.Get("api-key"))
+	require.Empty(t, req.Header.Get("Authorization"))
+	require.NotContains(t, body, "model")
+}
+
+func TestGenerateAPIError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"message":"Rate limit reached"}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := openai.New("m", openai.WithBaseURL(srv.URL)).Generate(context.Background(), "hi")
+	var apiErr *openai.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	require.Equal(t, "Rate limit reached", apiErr.Message)
+}
+
+func TestGenerateStream(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			http.Error(w, "expected stream", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, tok := range []string{"Pa", "", "ris"} {
+			chunk, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": tok}}}})
+			_, _ = w.Write([]byte("data: " + string(chunk) + "\n\n"))
+		}
+		_, _ = w.Write([]byte(": keep-alive\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	var tokens []string
+	err := openai.New("m", openai.WithBaseURL(srv.URL)).GenerateStream(context.Background(), "hi", func(tok string) error {
+		tokens = append(tokens, tok)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Pa", "ris"}, tokens)
+}
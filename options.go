@@ -0,0 +1,151 @@
+package rag
+
+import apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+// Option configures a RAGPipeline at construction time.
+type Option func(*RAGPipeline)
+
+// QueryOption configures a single Query call.
+type QueryOption func(*queryConfig)
+
+type queryConfig struct {
+	stats       *Stats
+	consistency *apiv1.Consistency
+	topK        int
+	minScore    float64
+	caveat      map[string]any
+	filters     map[string]string
+
+	subjectType     string
+	subjectRelation string
+	tenant          string
+
+	permissionMode PermissionMode
+	permissions    []string
+
+	pageSize int
+	cursor   *string
+}
+
+func newQueryConfig(opts []QueryOption) *queryConfig {
+	qc := &queryConfig{}
+	for _, opt := range opts {
+		opt(qc)
+	}
+	return qc
+}
+
+// request returns the QueryRequest equivalent to a legacy-style call
+// configured by qc.
+func (qc *queryConfig) request(userID, query string) QueryRequest {
+	req := MigrateLegacyCall(userID, query)
+	req.TopK = qc.topK
+	req.MinScore = qc.minScore
+	req.Consistency = qc.consistency
+	req.CaveatContext = qc.caveat
+	req.Filters = qc.filters
+	req.SubjectType = qc.subjectType
+	req.SubjectRelation = qc.subjectRelation
+	req.Tenant = qc.tenant
+	req.Permissions = qc.permissions
+	req.PermissionMode = qc.permissionMode
+	req.PageSize = qc.pageSize
+	if qc.cursor != nil {
+		req.Cursor = *qc.cursor
+	}
+	return req
+}
+
+// WithStats makes Query copy the statistics it gathered into dst once it
+// returns, including when it returns an error.
+func WithStats(dst *Stats) QueryOption {
+	return func(qc *queryConfig) {
+		qc.stats = dst
+	}
+}
+
+// WithConsistency sets the consistency of the query's permission checks,
+// overriding WithDefaultConsistency. See QueryRequest.Consistency.
+func WithConsistency(c *apiv1.Consistency) QueryOption {
+	return func(qc *queryConfig) {
+		qc.consistency = c
+	}
+}
+
+// WithAtLeastAsFresh makes the query see every relationship written up
+// to token, such as the token returned by AddDocument or GrantAccess, so
+// a document shared just before shows up and one unshared just before
+// does not. It is WithConsistency(AtLeastAsFresh(token)); a nil token,
+// as returned when nothing was written, keeps the default consistency.
+// Such queries bypass WithCheckCache and WithAccessSets.
+func WithAtLeastAsFresh(token *apiv1.ZedToken) QueryOption {
+	return func(qc *queryConfig) {
+		if token != nil {
+			qc.consistency = AtLeastAsFresh(token)
+		}
+	}
+}
+
+// WithTopK makes Query return at most k documents, counted after
+// permission filtering. See QueryRequest.TopK.
+func WithTopK(k int) QueryOption {
+	return func(qc *queryConfig) {
+		qc.topK = k
+	}
+}
+
+// WithMinScore makes Query drop candidates scoring below min. See
+// QueryRequest.MinScore.
+func WithMinScore(min float64) QueryOption {
+	return func(qc *queryConfig) {
+		qc.minScore = min
+	}
+}
+
+// WithCaveatContext supplies caveat context for the query's permission
+// checks. See QueryRequest.CaveatContext.
+func WithCaveatContext(caveat map[string]any) QueryOption {
+	return func(qc *queryConfig) {
+		qc.caveat = caveat
+	}
+}
+
+// WithFilter restricts the query to documents whose metadata has key set
+// to value. Repeated calls add filters, which must all match. See
+// QueryRequest.Filters.
+func WithFilter(key, value string) QueryOption {
+	return func(qc *queryConfig) {
+		if qc.filters == nil {
+			qc.filters = make(map[string]string)
+		}
+		qc.filters[key] = value
+	}
+}
+
+// WithPageSize makes Query return at most n documents per page. See
+// QueryRequest.PageSize; WithCursor pages through the rest.
+func WithPageSize(n int) QueryOption {
+	return func(qc *queryConfig) {
+		qc.pageSize = n
+	}
+}
+
+// WithCursor makes Query continue after the page *cursor points at and
+// replace *cursor with the cursor of the next page, or "" once there is
+// none:
+//
+//	var cursor string
+//	for {
+//		docs, err := pipeline.Query(ctx, "emilia", "playbook", rag.WithPageSize(10), rag.WithCursor(&cursor))
+//		...
+//		if cursor == "" {
+//			break
+//		}
+//	}
+//
+// *cursor is left alone if Query fails. See QueryRequest.Cursor.
+func WithCursor(cursor *string) QueryOption {
+	return func(qc *queryConfig) {
+		qc.cursor = cursor
+	}
+}
@@ -0,0 +1,42 @@
+package rag
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// ResultOrder compares two candidates the way slices.SortFunc expects: it
+// is negative if a comes before b, positive if after and zero if either
+// order will do. Candidates are ordered before they are authorized, so
+// the order also decides which ones TopK, pages and Results reach first.
+type ResultOrder func(a, b ScoredDocument) int
+
+// ByScoreThenID orders candidates by descending score, breaking ties by
+// ascending document ID. It yields the same order for the same corpus
+// whatever order the documents were added or retrieved in.
+func ByScoreThenID(a, b ScoredDocument) int {
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Document.ID, b.Document.ID)
+}
+
+// WithResultOrder orders every query's results by order, e.g.
+// ByScoreThenID for output that tests and paginated clients can rely on.
+// Without it results keep retrieval order: the order of the corpus for
+// the built-in scan, which the legacy Query is pinned to, or the order the
+// Retriever returned.
+func WithResultOrder(order ResultOrder) Option {
+	return func(r *RAGPipeline) {
+		r.order = order
+	}
+}
+
+// sortCandidates orders candidates by the pipeline's ResultOrder, keeping
+// retrieval order among equal ones.
+func (r *RAGPipeline) sortCandidates(candidates []ScoredDocument) {
+	if r.order != nil {
+		slices.SortStableFunc(candidates, r.order)
+	}
+}
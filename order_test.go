@@ -0,0 +1,69 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestByScoreThenID(t *testing.T) {
+	t.Parallel()
+
+	scored := func(id string, score float64) rag.ScoredDocument {
+		return rag.ScoredDocument{Document: rag.Document{ID: id}, Score: score}
+	}
+	require.Negative(t, rag.ByScoreThenID(scored("b", 0.9), scored("a", 0.5)))
+	require.Negative(t, rag.ByScoreThenID(scored("a", 0.5), scored("b", 0.5)))
+	require.Positive(t, rag.ByScoreThenID(scored("b", 0.5), scored("a", 0.5)))
+	require.Zero(t, rag.ByScoreThenID(scored("a", 0.5), scored("a", 0.5)))
+}
+
+func TestWithResultOrder(t *testing.T) {
+	t.Parallel()
+
+	// "a" and "b" tie; the hybrid retriever returns them in whichever
+	// order it fused them.
+	keyword := &staticRetriever{docs: docsWithIDs("b", "a", "c")}
+	vector := &staticRetriever{docs: docsWithIDs("a", "b")}
+	allowed := []string{"document:a#read@user:emilia", "document:b#read@user:emilia", "document:c#read@user:emilia"}
+	client, _ := newFakeClient(allowed...)
+
+	for _, tc := range []struct {
+		name  string
+		order rag.ResultOrder
+		want  []string
+	}{
+		{"score then ID", rag.ByScoreThenID, []string{"a", "b", "c"}},
+		{"custom", func(a, b rag.ScoredDocument) int {
+			return -rag.ByScoreThenID(a, b)
+		}, []string{"c", "b", "a"}},
+	} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+			rag.WithRetriever(rag.NewHybridRetriever([]rag.Retriever{keyword, vector})),
+			rag.WithResultOrder(tc.order))
+		resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "q"})
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.want, docIDs(resp.Documents), tc.name)
+	}
+}
+
+func TestResultOrderAppliesBeforeTopK(t *testing.T) {
+	t.Parallel()
+
+	docs := docsWithIDs("doc9", "doc3", "doc5")
+	client, _ := newFakeClient("document:doc9#read@user:emilia", "document:doc3#read@user:emilia", "document:doc5#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithResultOrder(rag.ByScoreThenID))
+
+	// The substring scan scores every match alike, so IDs decide.
+	got, err := pipeline.Query(context.Background(), "emilia", "doc", rag.WithTopK(2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc3", "doc5"}, docIDs(got))
+
+	legacy := rag.NewRAGPipeline(client, "document", "read", docs)
+	got, err = legacy.Query(context.Background(), "emilia", "doc", rag.WithTopK(2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc9", "doc3"}, docIDs(got), "retrieval order by default")
+}
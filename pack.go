@@ -0,0 +1,117 @@
+package rag
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrContextBudget is returned by Answer when none of the authorized
+// sources fits the budget of WithContextBudget.
+var ErrContextBudget = errors.New("rag: no source fits the context budget")
+
+// Tokenizer counts the tokens a text takes up in the model's context
+// window.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc adapts a plain function to a Tokenizer.
+type TokenizerFunc func(text string) int
+
+// CountTokens calls f(text).
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// ApproxTokenizer estimates a token per four bytes, rounded up, which is
+// close for English text and the common BPE vocabularies. Use the
+// model's own tokenizer when the budget is tight.
+var ApproxTokenizer Tokenizer = TokenizerFunc(func(text string) int {
+	return (len(text) + 3) / 4
+})
+
+// ContextBudget tunes WithContextBudget. Zero fields other than
+// MaxTokens take the defaults given.
+type ContextBudget struct {
+	// MaxTokens is the most tokens of source text the prompt may hold.
+	// The question and the prompt template's own text are not counted,
+	// so leave room for them and for the answer.
+	MaxTokens int
+
+	// Tokenizer counts the tokens of each source. The default is
+	// ApproxTokenizer.
+	Tokenizer Tokenizer
+
+	// DedupThreshold leaves out a source at least this similar to one
+	// already packed. The default is 0.9; a negative value keeps
+	// near-duplicates.
+	DedupThreshold float64
+
+	// Similarity measures how alike two sources are. The default
+	// compares their sets of words like DefaultSimilarity, but does not
+	// treat chunks of the same document as duplicates.
+	Similarity Similarity
+}
+
+// WithContextBudget makes Answer and AnswerStream pack the authorized
+// sources into the prompt greedily, in retrieval order, under a budget
+// of b.MaxTokens: a source that no longer fits is left out and the
+// following, smaller ones are still tried, and near-duplicates, such as
+// overlapping chunks or copies of the same text, are left out as well.
+// With a Chunker the sources are chunks, so a long document contributes
+// only the chunks that matched rather than crowding out the others.
+//
+// The sources left out are not reported in AnswerResponse.Sources, so
+// citation markers stay aligned with the prompt, and are counted in
+// Stats.Unpacked. If none fits, Answer returns ErrContextBudget.
+func WithContextBudget(b ContextBudget) Option {
+	return func(r *RAGPipeline) {
+		if b.Tokenizer == nil {
+			b.Tokenizer = ApproxTokenizer
+		}
+		if b.DedupThreshold == 0 {
+			b.DedupThreshold = 0.9
+		}
+		r.contextBudget = &b
+	}
+}
+
+// pack keeps the sources of resp that fit the context budget, in order,
+// and records what it did in resp.Stats.
+func (b *ContextBudget) pack(resp *QueryResponse) error {
+	similar := func(i, j int) bool {
+		return b.Similarity(resp.Results[i].Document, resp.Results[j].Document) >= b.DedupThreshold
+	}
+	if b.Similarity == nil {
+		keys := make([]similarityKey, len(resp.Results))
+		for i, res := range resp.Results {
+			keys[i] = newSimilarityKey(res.Document)
+			keys[i].parent = ""
+		}
+		similar = func(i, j int) bool { return keys[i].similarity(keys[j]) >= b.DedupThreshold }
+	}
+
+	var kept []int
+	tokens := 0
+	for i, res := range resp.Results {
+		n := b.Tokenizer.CountTokens(res.Document.Text)
+		if tokens+n > b.MaxTokens || (b.DedupThreshold >= 0 && slices.ContainsFunc(kept, func(j int) bool { return similar(j, i) })) {
+			resp.Stats.Unpacked++
+			continue
+		}
+		tokens += n
+		kept = append(kept, i)
+	}
+
+	// kept is increasing, so the results can be compacted in place.
+	for k, i := range kept {
+		resp.Results[k] = resp.Results[i]
+		resp.Documents[k] = resp.Results[i].Document
+	}
+	resp.Results, resp.Documents = resp.Results[:len(kept)], resp.Documents[:len(kept)]
+	resp.Stats.ContextTokens = tokens
+	if len(kept) == 0 {
+		return ErrContextBudget
+	}
+	return nil
+}
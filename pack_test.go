@@ -0,0 +1,85 @@
+package rag_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// words counts whitespace-separated words as tokens.
+var words = rag.TokenizerFunc(func(text string) int { return len(strings.Fields(text)) })
+
+func packedDocs() []rag.Document {
+	doc := func(id, text string) rag.Document {
+		return rag.Document{ID: id, Text: text, Metadata: map[string]string{rag.SpiceDBObjectKey: "document:" + id}}
+	}
+	return []rag.Document{
+		doc("intro", "Refunds are issued within fourteen days of purchase."),
+		doc("intro-copy", "Refunds are issued within fourteen days of purchase!"),
+		doc("secret", "Refunds for enterprise customers follow the negotiated contract."),
+		doc("policy", strings.Repeat("Every refund request needs an order number. ", 5)),
+		doc("contact", "Write to billing for refunds."),
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:intro#read@user:emilia", "document:intro-copy#read@user:emilia",
+		"document:policy#read@user:emilia", "document:contact#read@user:emilia")
+	gen := &recordingGenerator{answer: "Within fourteen days [1]."}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+		rag.WithRetriever(&staticRetriever{docs: packedDocs()}), rag.WithGenerator(gen),
+		rag.WithContextBudget(rag.ContextBudget{MaxTokens: 20, Tokenizer: words}))
+
+	var stats rag.Stats
+	resp, err := pipeline.Answer(context.Background(), "emilia", "refunds", rag.WithStats(&stats))
+	require.NoError(t, err)
+	// The copy is a near-duplicate and the policy does not fit, but the
+	// contact details after it still do.
+	requireEqualDocIDs(t, []string{"intro", "contact"}, resp.Sources)
+	require.Equal(t, 13, resp.Stats.ContextTokens)
+	require.Equal(t, 2, resp.Stats.Unpacked)
+	require.Equal(t, resp.Stats, stats)
+	require.Len(t, resp.Citations, 1)
+	require.Equal(t, "intro", resp.Citations[0].DocumentID)
+
+	want, err := rag.DefaultPrompt("refunds", resp.Sources)
+	require.NoError(t, err)
+	require.Equal(t, want, gen.prompts[0])
+	require.NotContains(t, gen.prompts[0], "enterprise", "unauthorized sources are never packed")
+}
+
+func TestContextBudgetTooSmall(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:policy#read@user:emilia")
+	gen := &recordingGenerator{}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", packedDocs(),
+		rag.WithGenerator(gen), rag.WithContextBudget(rag.ContextBudget{MaxTokens: 10}))
+
+	_, err := pipeline.Answer(context.Background(), "emilia", "refund")
+	require.ErrorIs(t, err, rag.ErrContextBudget)
+	require.Empty(t, gen.prompts)
+}
+
+func TestContextBudgetDeduplicatesChunks(t *testing.T) {
+	t.Parallel()
+
+	// The policy repeats one sentence, so its chunks are identical.
+	client, _ := newFakeClient("document:policy#read@user:emilia")
+	for threshold, want := range map[float64]int{0: 1, -1: 3} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", packedDocs(),
+			rag.WithChunker(rag.SentenceChunker{MaxSize: 90}), rag.WithGenerator(&recordingGenerator{}),
+			rag.WithContextBudget(rag.ContextBudget{MaxTokens: 1000, DedupThreshold: threshold}))
+
+		resp, err := pipeline.Answer(context.Background(), "emilia", "order number")
+		require.NoError(t, err)
+		require.Len(t, resp.Sources, want, threshold)
+		require.Equal(t, 3-want, resp.Stats.Unpacked)
+	}
+}
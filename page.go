@@ -0,0 +1,185 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// cursor is the decoded form of QueryRequest.Cursor and
+// QueryResponse.NextCursor.
+type cursor struct {
+	// Query identifies the query the cursor continues; see cursorHash.
+	Query string `json:"q"`
+
+	// Last is the ID of the last document returned, and Offset the
+	// position after it in the ordered list it was found in: the
+	// candidates, or under the prefilter strategy the results. A page
+	// resumes after Last, or at Offset if Last is gone.
+	Last   string `json:"l"`
+	Offset int    `json:"o"`
+
+	// Returned counts the results returned so far, for TopK.
+	Returned int `json:"n"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if c.Query == "" || c.Offset < 0 || c.Returned < 0 {
+		return c, errors.New("malformed cursor")
+	}
+	return c, nil
+}
+
+// resume returns the index in ids the page after c starts at.
+func (c cursor) resume(ids []string) int {
+	if i := slices.Index(ids, c.Last); i >= 0 {
+		return i + 1
+	}
+	return min(c.Offset, len(ids))
+}
+
+// cursorHash identifies the query req pages through, so a cursor is only
+// accepted for the subject and query it was issued for.
+func cursorHash(req QueryRequest) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%d\x00%x",
+		req.UserID, req.SubjectType, req.SubjectRelation, req.Query, req.TopK, math.Float64bits(req.MinScore))
+
+	keys := make([]string, 0, len(req.Filters))
+	for k := range req.Filters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = io.WriteString(h, "\x00"+k+"\x00"+req.Filters[k])
+	}
+	if len(req.Permissions) > 0 {
+		fmt.Fprintf(h, "\x02%d\x00%s", req.PermissionMode, strings.Join(req.Permissions, "\x00"))
+	}
+	if req.Tenant != "" {
+		_, _ = io.WriteString(h, "\x01"+req.Tenant)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
+
+// paged reports whether the query returns a page rather than every
+// result.
+func (q *pendingQuery) paged() bool {
+	return q.req.PageSize > 0 || q.req.Cursor != ""
+}
+
+// page decides the candidates of the page q.req asks for and sets the
+// response's NextCursor if another page may follow. Candidates are
+// decided a chunk at a time, as by Results, so only the candidates up to
+// the end of the page are checked.
+func (q *pendingQuery) page() error {
+	req, resp := q.req, q.resp
+	var c cursor
+	if req.Cursor != "" {
+		// Validate made sure it decodes.
+		c, _ = decodeCursor(req.Cursor)
+	}
+	limit := req.PageSize
+	if req.TopK > 0 {
+		left := req.TopK - c.Returned
+		if left <= 0 {
+			resp.Results, resp.Documents = nil, nil
+			return nil
+		}
+		if limit == 0 || left < limit {
+			limit = left
+		}
+	}
+
+	if q.r.selectsFromAll() {
+		if err := q.decideAll(); err != nil {
+			return err
+		}
+	}
+	if q.docs == nil {
+		// Every candidate was decided already, during retrieval under the
+		// prefilter strategy or to select the results from all of them.
+		start := c.resume(resultIDs(resp.Results))
+		resp.Results = resp.Results[start:]
+		resp.Documents = resp.Documents[start:]
+		more := limit > 0 && len(resp.Results) > limit
+		resp.truncate(limit)
+		if more {
+			q.setNextCursor(c, start+limit)
+		}
+		return nil
+	}
+
+	ids := make([]string, len(q.docs))
+	for i, d := range q.docs {
+		ids[i] = d.Document.ID
+	}
+	start := c.resume(ids)
+	chunk := len(q.docs)
+	if limit > 0 {
+		chunk = q.r.iterateChunkSize()
+	}
+	end := start
+	for end < len(q.docs) && (limit == 0 || len(resp.Results) < limit) {
+		next := min(end+chunk, len(q.docs))
+		if err := q.decide(q.docs[end:next], q.resources[end:next]); err != nil {
+			return err
+		}
+		end = next
+	}
+	if limit == 0 || len(resp.Results) < limit {
+		return nil
+	}
+	resp.truncate(limit)
+	// The last chunk may have decided candidates past the page; the next
+	// page checks them again.
+	after := start + slices.Index(ids[start:], resp.Results[limit-1].Document.ID) + 1
+	if after < len(q.docs) {
+		q.setNextCursor(c, after)
+	}
+	return nil
+}
+
+// setNextCursor sets the cursor continuing after the response's results,
+// the last of which is just before offset, unless they reach TopK.
+func (q *pendingQuery) setNextCursor(prev cursor, offset int) {
+	resp := q.resp
+	if q.req.TopK > 0 && prev.Returned+len(resp.Results) >= q.req.TopK {
+		return
+	}
+	resp.NextCursor = cursor{
+		Query:    cursorHash(q.req),
+		Last:     resp.Results[len(resp.Results)-1].Document.ID,
+		Offset:   offset,
+		Returned: prev.Returned + len(resp.Results),
+	}.encode()
+}
+
+func resultIDs(results []QueryResult) []string {
+	ids := make([]string, len(results))
+	for i, res := range results {
+		ids[i] = res.Document.ID
+	}
+	return ids
+}
@@ -0,0 +1,120 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestPagination(t *testing.T) {
+	t.Parallel()
+
+	var allowed []string
+	for _, id := range []string{"doc2", "doc3", "doc5", "doc8", "doc11", "doc13", "doc17"} {
+		allowed = append(allowed, "document:"+id+"#read@user:emilia")
+	}
+	for name, strategy := range map[string]rag.FilterStrategy{"postfilter": rag.FilterPostCheck, "prefilter": rag.FilterPrefilter} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, _ := newFakeClient(allowed...)
+			pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(20),
+				rag.WithFilterStrategy(strategy), rag.WithBulkCheckChunkSize(4))
+			all, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+			require.NoError(t, err)
+
+			var cursor string
+			var pages [][]string
+			for {
+				docs, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithPageSize(3), rag.WithCursor(&cursor))
+				require.NoError(t, err)
+				pages = append(pages, docIDs(docs))
+				if cursor == "" {
+					break
+				}
+			}
+			require.Equal(t, [][]string{docIDs(all[:3]), docIDs(all[3:6]), docIDs(all[6:])}, pages)
+		})
+	}
+}
+
+func TestPaginationChecksOnlyThePage(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc0#read@user:emilia", "document:doc1#read@user:emilia", "document:doc9#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(20), rag.WithBulkCheckChunkSize(5))
+
+	req := rag.QueryRequest{UserID: "emilia", Query: "synthetic", PageSize: 1}
+	resp, err := pipeline.Do(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc0"}, docIDs(resp.Documents))
+	require.Equal(t, 5, fake.checkCount())
+
+	// doc1 was checked with the first page but not returned, so the
+	// second page starts with it.
+	req.Cursor = resp.NextCursor
+	resp, err = pipeline.Do(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1"}, docIDs(resp.Documents))
+	require.Equal(t, 10, fake.checkCount())
+
+	// Without a page size the cursor returns all the rest.
+	req.Cursor, req.PageSize = resp.NextCursor, 0
+	resp, err = pipeline.Do(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc9"}, docIDs(resp.Documents))
+	require.Empty(t, resp.NextCursor)
+}
+
+func TestPaginationTopK(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc2#read@user:emilia",
+		"document:doc3#read@user:emilia", "document:doc4#read@user:emilia", "document:doc5#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10))
+
+	req := rag.QueryRequest{UserID: "emilia", Query: "synthetic", TopK: 4, PageSize: 3}
+	resp, err := pipeline.Do(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 3)
+
+	req.Cursor = resp.NextCursor
+	resp, err = pipeline.Do(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 1)
+	require.Empty(t, resp.NextCursor, "TopK results were returned")
+}
+
+func TestPaginationRejectsForeignCursors(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc2#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(5))
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic", PageSize: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.NextCursor)
+
+	for name, req := range map[string]rag.QueryRequest{
+		"other user":   {UserID: "beatrice", Query: "synthetic", Cursor: resp.NextCursor},
+		"other query":  {UserID: "emilia", Query: "entry", Cursor: resp.NextCursor},
+		"other filter": {UserID: "emilia", Query: "synthetic", Filters: map[string]string{"lang": "en"}, Cursor: resp.NextCursor},
+		"malformed":    {UserID: "emilia", Query: "synthetic", Cursor: "not a cursor"},
+		"negative":     {UserID: "emilia", Query: "synthetic", PageSize: -1},
+	} {
+		_, err := pipeline.Do(context.Background(), req)
+		require.True(t, errors.Is(err, rag.ErrInvalidRequest), name)
+	}
+}
+
+func docIDs(docs []rag.Document) []string {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids
+}
@@ -0,0 +1,199 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// PermissionMode combines the permissions of a query.
+type PermissionMode int
+
+const (
+	// AnyPermission returns documents the subject holds at least one of
+	// the permissions on, e.g. read or comment.
+	AnyPermission PermissionMode = iota
+
+	// AllPermissions returns documents the subject holds every one of the
+	// permissions on, e.g. read and export.
+	AllPermissions
+)
+
+func (m PermissionMode) String() string {
+	switch m {
+	case AnyPermission:
+		return "any"
+	case AllPermissions:
+		return "all"
+	default:
+		return fmt.Sprintf("PermissionMode(%d)", int(m))
+	}
+}
+
+// permissionName is SpiceDB's syntax for relation and permission names.
+var permissionName = regexp.MustCompile(`^[a-z][a-z0-9_]{1,62}[a-z0-9]$`)
+
+// permissionSet is the permissions a query checks and how their
+// decisions combine.
+type permissionSet struct {
+	mode  PermissionMode
+	perms []string
+}
+
+// WithDefaultPermissions makes queries check perms, combined by mode,
+// instead of the pipeline's single permission. It applies to objects of
+// every type; WithTypePermissions only changes the single permission.
+// Queries may choose their own with WithPermissions.
+func WithDefaultPermissions(mode PermissionMode, perms ...string) Option {
+	return func(r *RAGPipeline) {
+		r.permissions = &permissionSet{mode: mode, perms: perms}
+	}
+}
+
+// WithPermissions makes the query check perms, combined by mode. See
+// QueryRequest.Permissions.
+func WithPermissions(mode PermissionMode, perms ...string) QueryOption {
+	return func(qc *queryConfig) {
+		qc.permissionMode = mode
+		qc.permissions = perms
+	}
+}
+
+// permissionsFor returns the permission set of req, nil if it uses the
+// pipeline's single permission.
+func (r *RAGPipeline) permissionsFor(req QueryRequest) *permissionSet {
+	if len(req.Permissions) > 0 {
+		return &permissionSet{mode: req.PermissionMode, perms: req.Permissions}
+	}
+	return r.permissions
+}
+
+type permissionsKey struct{}
+
+// contextWithPermissions attaches the permission set of a query, in the
+// same way as contextWithConsistency.
+func contextWithPermissions(ctx context.Context, ps *permissionSet) context.Context {
+	if ps == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, permissionsKey{}, ps)
+}
+
+// permissionsOf returns the permissions checked on objects of objectType
+// in ctx, and how they combine.
+func (r *RAGPipeline) permissionsOf(ctx context.Context, objectType string) permissionSet {
+	if ps, ok := ctx.Value(permissionsKey{}).(*permissionSet); ok && len(ps.perms) > 0 {
+		return *ps
+	}
+	return permissionSet{perms: []string{r.permissionFor(objectType)}}
+}
+
+// String returns the set as SpiceDB would write the permission combining
+// it, e.g. "read + comment" or "read & export".
+func (ps permissionSet) String() string {
+	if ps.mode == AllPermissions {
+		return strings.Join(ps.perms, " & ")
+	}
+	return strings.Join(ps.perms, " + ")
+}
+
+// combine folds the decision for one permission into the decision so
+// far. Under AnyPermission an allowed permission decides the document
+// and errors only count while none is; under AllPermissions a denied
+// one does, and errors count while none is.
+func (ps permissionSet) combine(acc, next CheckResult, first bool) CheckResult {
+	if first {
+		return next
+	}
+	decisive := DecisionAllowed
+	if ps.mode == AllPermissions {
+		decisive = DecisionDenied
+	}
+	switch {
+	case acc.Err == nil && acc.Decision == decisive:
+		return acc
+	case next.Err == nil && next.Decision == decisive:
+		return next
+	case acc.Err != nil:
+		return acc
+	case next.Err != nil:
+		return next
+	case acc.Decision == DecisionConditional || next.Decision == DecisionConditional:
+		missing := slices.Concat(acc.MissingContext, next.MissingContext)
+		slices.Sort(missing)
+		return CheckResult{Decision: DecisionConditional, MissingContext: slices.Compact(missing)}
+	}
+	return acc
+}
+
+// decided reports whether res settles a document under ps, so its
+// remaining permissions need not be checked.
+func (ps permissionSet) decided(res CheckResult) bool {
+	if res.Err != nil {
+		return false
+	}
+	if ps.mode == AllPermissions {
+		return res.Decision == DecisionDenied
+	}
+	return res.Decision == DecisionAllowed
+}
+
+// lookup returns the IDs of the objectType objects subject holds ps on:
+// the union of the lookups of each permission under AnyPermission, their
+// intersection under AllPermissions. The objects subject would hold ps on
+// only if a caveat allowed it are returned as conditional.
+func (ps permissionSet) lookup(ctx context.Context, lister ResourceLister, subject *apiv1.SubjectReference, objectType string) (allowed, conditional []string, err error) {
+	var ids []string
+	held := make(map[string]int)
+	counts := make(map[string]int)
+	for _, perm := range ps.perms {
+		found, maybe, err := lookupResources(ctx, lister, subject, objectType, perm)
+		if err != nil {
+			return nil, nil, err
+		}
+		seen := make(map[string]bool, len(found)+len(maybe))
+		for i, id := range append(found, maybe...) {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if counts[id] == 0 {
+				ids = append(ids, id)
+			}
+			counts[id]++
+			if i < len(found) {
+				held[id]++
+			}
+		}
+	}
+	need := 1
+	if ps.mode == AllPermissions {
+		need = len(ps.perms)
+	}
+	for _, id := range ids {
+		switch {
+		case held[id] >= need:
+			allowed = append(allowed, id)
+		case counts[id] >= need:
+			conditional = append(conditional, id)
+		}
+	}
+	return allowed, conditional, nil
+}
+
+// validate reports a malformed permission set as ValidationErrors of
+// QueryRequest.Permissions.
+func (ps permissionSet) validate(invalid func(field, format string, args ...any)) {
+	if ps.mode != AnyPermission && ps.mode != AllPermissions {
+		invalid("PermissionMode", "%v is unknown", ps.mode)
+	}
+	for _, perm := range ps.perms {
+		if !permissionName.MatchString(perm) {
+			invalid("Permissions", "%q is not a valid SpiceDB permission", perm)
+		}
+	}
+}
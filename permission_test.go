@@ -0,0 +1,81 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestAnyPermission(t *testing.T) {
+	t.Parallel()
+
+	allowed := []string{
+		"document:doc1#read@user:emilia",
+		"document:doc2#comment@user:emilia",
+		"document:doc3#export@user:emilia",
+	}
+	client, fake := newFakeClient(allowed...)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	results, err := pipeline.Query(context.Background(), "emilia", "", rag.WithPermissions(rag.AnyPermission, "read", "comment"))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc2"}, results)
+	require.Equal(t, []int{3, 2}, fake.bulkRequestSizes(), "comment is only checked where read was denied")
+
+	pre := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithFilterStrategy(rag.FilterPrefilter))
+	results, err = pre.Query(context.Background(), "emilia", "", rag.WithPermissions(rag.AnyPermission, "read", "comment"))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc2"}, results)
+}
+
+func TestAllPermissions(t *testing.T) {
+	t.Parallel()
+
+	allowed := []string{
+		"document:doc1#read@user:emilia",
+		"document:doc1#export@user:emilia",
+		"document:doc2#read@user:emilia",
+		"document:doc3#export@user:emilia",
+	}
+	client, fake := newFakeClient(allowed...)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithDefaultPermissions(rag.AllPermissions, "read", "export"))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+	require.Equal(t, []int{3, 2}, fake.bulkRequestSizes(), "export is only checked where read was allowed")
+
+	// A query's own permissions replace the pipeline's.
+	results, err = pipeline.Query(context.Background(), "emilia", "", rag.WithPermissions(rag.AllPermissions, "read"))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc2"}, results)
+
+	pre := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithDefaultPermissions(rag.AllPermissions, "read", "export"), rag.WithFilterStrategy(rag.FilterPrefilter))
+	results, err = pre.Query(context.Background(), "emilia", "")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	subjects, err := pipeline.WhoCanRead(context.Background(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []rag.Subject{{Type: "user", ID: "emilia"}}, subjects)
+	subjects, err = pipeline.WhoCanRead(context.Background(), "doc2")
+	require.NoError(t, err)
+	require.Empty(t, subjects, "read alone is not enough")
+}
+
+func TestPermissionsValidation(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	_, err := pipeline.Query(context.Background(), "emilia", "", rag.WithPermissions(rag.AnyPermission, "read", "Export!"))
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+	_, err = pipeline.Query(context.Background(), "emilia", "", rag.WithPermissions(rag.PermissionMode(7), "read"))
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+}
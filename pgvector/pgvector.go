@@ -0,0 +1,227 @@
+// Package pgvector is a rag.DocumentStore persisted in Postgres with the
+// pgvector extension, so the corpus survives restarts and scales beyond
+// memory. It works on a *sql.DB and is driver-agnostic: register any
+// Postgres driver, such as github.com/jackc/pgx/v5/stdlib, and open the
+// database with it. Package pgvectortest starts such a database in a
+// container.
+package pgvector
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// DefaultTable is the table documents are stored in.
+const DefaultTable = "rag_documents"
+
+// ErrInvalidTable is returned by New for a table name that is not a plain
+// SQL identifier.
+var ErrInvalidTable = errors.New("pgvector: invalid table name")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Store is a rag.DocumentStore and rag.ScoredRetriever ranking documents
+// by the cosine distance of their embeddings, computed by Postgres.
+type Store struct {
+	db       *sql.DB
+	embedder rag.Embedder
+	dims     int
+	table    string
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithTable overrides DefaultTable.
+func WithTable(name string) Option {
+	return func(s *Store) {
+		s.table = name
+	}
+}
+
+// New returns a Store on db embedding text with embedder, whose vectors
+// have dims dimensions. Call Migrate once to create the table.
+func New(db *sql.DB, embedder rag.Embedder, dims int, opts ...Option) (*Store, error) {
+	s := &Store{db: db, embedder: embedder, dims: dims, table: DefaultTable}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !identifier.MatchString(s.table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTable, s.table)
+	}
+	if dims <= 0 {
+		return nil, fmt.Errorf("pgvector: invalid dimensions %d", dims)
+	}
+	return s, nil
+}
+
+// Migrate creates the vector extension, the table and an HNSW index on
+// the embeddings if they do not exist yet.
+func (s *Store) Migrate(ctx context.Context) error {
+	stmts := []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id text PRIMARY KEY,
+	text text NOT NULL,
+	metadata jsonb NOT NULL DEFAULT '{}',
+	embedding vector(%d) NOT NULL
+)`, s.table, s.dims),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_embedding_idx ON %[1]s USING hnsw (embedding vector_cosine_ops)`, s.table),
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("pgvector: migrating: %w", err)
+		}
+	}
+	return nil
+}
+
+// Add implements rag.DocumentStore. Documents are embedded first and then
+// upserted in one transaction, so either all or none are stored.
+func (s *Store) Add(ctx context.Context, docs ...rag.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Text
+	}
+	vectors, err := s.embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("pgvector: embedding documents: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("pgvector: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	upsert := fmt.Sprintf(`INSERT INTO %s (id, text, metadata, embedding) VALUES ($1, $2, $3::jsonb, $4::vector)
+ON CONFLICT (id) DO UPDATE SET text = EXCLUDED.text, metadata = EXCLUDED.metadata, embedding = EXCLUDED.embedding`, s.table)
+	for i, d := range docs {
+		md := d.Metadata
+		if md == nil {
+			md = map[string]string{}
+		}
+		metadata, err := json.Marshal(md)
+		if err != nil {
+			return fmt.Errorf("pgvector: encoding metadata of %q: %w", d.ID, err)
+		}
+		if _, err := tx.ExecContext(ctx, upsert, d.ID, d.Text, string(metadata), vectorLiteral(vectors[i])); err != nil {
+			return fmt.Errorf("pgvector: storing %q: %w", d.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("pgvector: %w", err)
+	}
+	return nil
+}
+
+// Remove implements rag.DocumentStore.
+func (s *Store) Remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id IN (%s)`, s.table, strings.Join(placeholders, ", "))
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("pgvector: removing documents: %w", err)
+	}
+	return nil
+}
+
+// Retrieve implements rag.Retriever.
+func (s *Store) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	scored, err := s.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]rag.Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs, nil
+}
+
+// RetrieveScored implements rag.ScoredRetriever; the score is the cosine
+// similarity, 1 minus pgvector's cosine distance.
+func (s *Store) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("pgvector: embedding query: %w", err)
+	}
+
+	q := fmt.Sprintf(`SELECT id, text, metadata::text, 1 - (embedding <=> $1::vector) FROM %s ORDER BY embedding <=> $1::vector, id`, s.table)
+	args := []any{vectorLiteral(vectors[0])}
+	if limit > 0 {
+		q += ` LIMIT $2`
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector: querying: %w", err)
+	}
+	defer rows.Close()
+
+	var out []rag.ScoredDocument
+	for rows.Next() {
+		var d rag.ScoredDocument
+		var metadata string
+		if err := rows.Scan(&d.Document.ID, &d.Document.Text, &metadata, &d.Score); err != nil {
+			return nil, fmt.Errorf("pgvector: reading row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &d.Document.Metadata); err != nil {
+			return nil, fmt.Errorf("pgvector: decoding metadata of %q: %w", d.Document.ID, err)
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pgvector: reading rows: %w", err)
+	}
+	return out, nil
+}
+
+// embed calls the embedder and checks the vectors fit the table.
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", rag.ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) != s.dims {
+			return nil, fmt.Errorf("%w: dimension %d, want %d", rag.ErrEmbeddingMismatch, len(v), s.dims)
+		}
+	}
+	return vectors, nil
+}
+
+// vectorLiteral formats v in pgvector's text representation, "[1,2,3]".
+func vectorLiteral(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
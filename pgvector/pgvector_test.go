@@ -0,0 +1,189 @@
+package pgvector_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/pgvector"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+var _ rag.DocumentStore = (*pgvector.Store)(nil)
+
+// fakeDB is a database/sql connector recording statements and answering
+// every query with rows.
+type fakeDB struct {
+	mu        sync.Mutex
+	stmts     []string
+	args      [][]driver.NamedValue
+	committed int
+	rows      [][]driver.Value
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stmts = append(f.stmts, query)
+	f.args = append(f.args, args)
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *fakeConn) Rollback() error                     { return nil }
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.committed++
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.record(query, args)
+	return &fakeRows{rows: c.db.rows}, nil
+}
+
+type fakeRows struct{ rows [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"id", "text", "metadata", "score"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// lengthEmbedder embeds text as {len(text), 0.5}.
+type lengthEmbedder struct{}
+
+func (lengthEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = []float32{float32(len(text)), 0.5}
+	}
+	return out, nil
+}
+
+func newStore(t *testing.T, opts ...pgvector.Option) (*pgvector.Store, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { _ = db.Close() })
+	store, err := pgvector.New(db, lengthEmbedder{}, 2, opts...)
+	require.NoError(t, err)
+	return store, fake
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t, pgvector.WithTable("docs"))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.Len(t, fake.stmts, 3)
+	require.Contains(t, fake.stmts[0], "CREATE EXTENSION IF NOT EXISTS vector")
+	require.Contains(t, fake.stmts[1], "CREATE TABLE IF NOT EXISTS docs")
+	require.Contains(t, fake.stmts[1], "embedding vector(2) NOT NULL")
+	require.Contains(t, fake.stmts[2], "ON docs USING hnsw (embedding vector_cosine_ops)")
+}
+
+func TestAddAndRemove(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t)
+	require.NoError(t, store.Add(context.Background(),
+		rag.Document{ID: "a", Text: "abc", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		rag.Document{ID: "b", Text: "b"},
+	))
+	require.Equal(t, 1, fake.committed)
+	require.Len(t, fake.stmts, 2)
+	require.Contains(t, fake.stmts[0], "INSERT INTO rag_documents")
+	require.Contains(t, fake.stmts[0], "ON CONFLICT (id) DO UPDATE")
+	require.Equal(t, []any{"a", "abc", `{"spicedb_object":"document:a"}`, "[3,0.5]"}, values(fake.args[0]))
+	require.Equal(t, []any{"b", "b", `{}`, "[1,0.5]"}, values(fake.args[1]))
+
+	require.NoError(t, store.Remove(context.Background(), "a", "b"))
+	require.Equal(t, "DELETE FROM rag_documents WHERE id IN ($1, $2)", fake.stmts[2])
+	require.Equal(t, []any{"a", "b"}, values(fake.args[2]))
+}
+
+func TestRetrieveScored(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t)
+	fake.rows = [][]driver.Value{
+		{"a", "abc", `{"spicedb_object":"document:a"}`, 0.9},
+		{"b", "b", `{}`, 0.25},
+	}
+
+	scored, err := store.RetrieveScored(context.Background(), "ab", 5)
+	require.NoError(t, err)
+	require.Equal(t, []rag.ScoredDocument{
+		{Document: rag.Document{ID: "a", Text: "abc", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}}, Score: 0.9},
+		{Document: rag.Document{ID: "b", Text: "b", Metadata: map[string]string{}}, Score: 0.25},
+	}, scored)
+	require.True(t, strings.HasSuffix(fake.stmts[0], "ORDER BY embedding <=> $1::vector, id LIMIT $2"))
+	require.Equal(t, []any{"[2,0.5]", int64(5)}, values(fake.args[0]))
+}
+
+func TestStoreResultsAreAuthorized(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t)
+	fake.rows = [][]driver.Value{
+		{"a", "abc", `{"spicedb_object":"document:a"}`, 0.9},
+		{"b", "b", `{"spicedb_object":"document:b"}`, 0.25},
+	}
+	pipeline, _ := ragtest.NewPipeline(t, "document", "read", nil,
+		[]string{"document:b#read@user:emilia"}, rag.WithRetriever(store))
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "anything"})
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 1)
+	require.Equal(t, "b", resp.Documents[0].ID)
+}
+
+func TestNewValidates(t *testing.T) {
+	t.Parallel()
+
+	_, err := pgvector.New(nil, lengthEmbedder{}, 2, pgvector.WithTable("docs; DROP TABLE users"))
+	require.ErrorIs(t, err, pgvector.ErrInvalidTable)
+
+	_, err = pgvector.New(nil, lengthEmbedder{}, 0)
+	require.Error(t, err)
+
+	wide, err := pgvector.New(sql.OpenDB(&fakeDB{}), lengthEmbedder{}, 3)
+	require.NoError(t, err)
+	require.ErrorIs(t, wide.Add(context.Background(), rag.Document{ID: "a"}), rag.ErrEmbeddingMismatch)
+}
+
+func values(args []driver.NamedValue) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+// Package pgvectortest starts throwaway Postgres databases with the
+// pgvector extension in containers via Testcontainers.
+package pgvectortest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// DefaultImage is the Postgres image started when none is configured.
+	DefaultImage = "pgvector/pgvector:pg16"
+
+	// DefaultStartupTimeout bounds how long Run waits for Postgres to
+	// accept connections.
+	DefaultStartupTimeout = time.Minute
+
+	port     = "5432/tcp"
+	user     = "rag"
+	password = "rag"
+	database = "rag"
+)
+
+// Instance is a running Postgres container.
+type Instance struct {
+	// DSN is a postgres:// connection URL for the database, accepted by
+	// the common Postgres drivers.
+	DSN string
+
+	container testcontainers.Container
+}
+
+// Terminate removes the container.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return i.container.Terminate(ctx)
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	startupTimeout time.Duration
+}
+
+// WithImage overrides the Postgres image. It must ship pgvector.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// Run starts a Postgres container. The caller owns the instance and must
+// Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{image: DefaultImage, startupTimeout: DefaultStartupTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.image,
+			ExposedPorts: []string{port},
+			Env: map[string]string{
+				"POSTGRES_USER":     user,
+				"POSTGRES_PASSWORD": password,
+				"POSTGRES_DB":       database,
+			},
+			// The server restarts once after initialization, so wait for
+			// the second readiness message.
+			WaitingFor: wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(cfg.startupTimeout),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("pgvectortest: starting container: %w", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err == nil {
+		var mapped string
+		if p, perr := container.MappedPort(ctx, port); perr == nil {
+			mapped = p.Port()
+		} else {
+			err = perr
+		}
+		host = net.JoinHostPort(host, mapped)
+	}
+	if err != nil {
+		_ = container.Terminate(ctx)
+		return nil, fmt.Errorf("pgvectortest: resolving endpoint: %w", err)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     host,
+		Path:     database,
+		RawQuery: "sslmode=disable",
+	}
+	return &Instance{DSN: dsn.String(), container: container}, nil
+}
+
+// Cleanup tears down an instance started by StartPostgres. It is safe to
+// call more than once.
+type Cleanup func()
+
+// StartPostgres runs a pgvector-enabled Postgres for the duration of a
+// test and returns its DSN. The test is skipped when no container runtime
+// is available and fails if the database cannot be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the database earlier.
+func StartPostgres(t *testing.T, opts ...Option) (string, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("pgvectortest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.DSN, cleanup
+}
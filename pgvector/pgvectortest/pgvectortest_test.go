@@ -0,0 +1,28 @@
+package pgvectortest_test
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/pgvector/pgvectortest"
+)
+
+func TestStartPostgres(t *testing.T) {
+	t.Parallel()
+
+	dsn, cleanup := pgvectortest.StartPostgres(t)
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "postgres", u.Scheme)
+	conn, err := net.DialTimeout("tcp", u.Host, 5*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	cleanup()
+	cleanup()
+}
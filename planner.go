@@ -0,0 +1,233 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// Plan is how a query's candidates were authorized. It is reported as
+// Stats.Plan and counted by the Collector.
+type Plan int
+
+const (
+	// PlanNone means there were no candidates to authorize.
+	PlanNone Plan = iota
+
+	// PlanCheckEach checks every candidate with its own Check call.
+	PlanCheckEach
+
+	// PlanBulk checks the candidates in bulk, one round trip per chunk.
+	PlanBulk
+
+	// PlanLookup looks up every object the subject can access and keeps
+	// the candidates among them, as FilterPrefilter does.
+	PlanLookup
+)
+
+func (p Plan) String() string {
+	switch p {
+	case PlanNone:
+		return "none"
+	case PlanCheckEach:
+		return "check_each"
+	case PlanBulk:
+		return "bulk"
+	case PlanLookup:
+		return "lookup"
+	default:
+		return fmt.Sprintf("Plan(%d)", int(p))
+	}
+}
+
+// Planner tunes FilterAdaptive. Zero fields take the defaults given.
+type Planner struct {
+	// CheckEachMax is the most candidates checked with a Check call each
+	// rather than in bulk, which saves building a bulk request for a
+	// handful of them and lets WithCheckCache answer them one by one.
+	// The default is 2.
+	CheckEachMax int
+
+	// LookupRatio makes the planner look up the subject's accessible set
+	// instead of checking the candidates when the set is estimated to
+	// hold at most LookupRatio objects per candidate. The default is 1.
+	LookupRatio float64
+
+	// ProbeCandidates is the number of candidates above which a subject
+	// whose accessible set has not been estimated yet is authorized with
+	// a lookup, which also provides the estimate. The default is 1000.
+	ProbeCandidates int
+
+	// EstimateTTL is how long an estimate of a subject's accessible set
+	// is used. The default is five minutes.
+	EstimateTTL time.Duration
+
+	// MaxEstimates caps the number of subjects estimates are kept for;
+	// when it is reached, the oldest are forgotten. The default is
+	// 10000.
+	MaxEstimates int
+}
+
+// WithPlanner selects FilterAdaptive, tuned by p.
+func WithPlanner(p Planner) Option {
+	return func(r *RAGPipeline) {
+		r.strategy = FilterAdaptive
+		r.planner = newPlanState(p)
+	}
+}
+
+// planState is a Planner with its defaults applied and the estimates of
+// accessible-set sizes it has gathered.
+type planState struct {
+	Planner
+
+	mu        sync.Mutex
+	estimates map[string]estimate
+}
+
+// estimate is the estimated size of a subject's accessible set.
+type estimate struct {
+	size int
+	at   time.Time
+}
+
+func newPlanState(p Planner) *planState {
+	if p.CheckEachMax == 0 {
+		p.CheckEachMax = 2
+	}
+	if p.LookupRatio == 0 {
+		p.LookupRatio = 1
+	}
+	if p.ProbeCandidates == 0 {
+		p.ProbeCandidates = 1000
+	}
+	if p.EstimateTTL == 0 {
+		p.EstimateTTL = 5 * time.Minute
+	}
+	if p.MaxEstimates == 0 {
+		p.MaxEstimates = 10000
+	}
+	return &planState{Planner: p, estimates: make(map[string]estimate)}
+}
+
+// plan picks how to authorize n candidates for the subject whose
+// estimates are kept under key. lookup and bulk report whether the
+// checker can list resources and check in bulk.
+func (p *planState) plan(key string, n int, lookup, bulk bool) Plan {
+	switch {
+	case n == 0:
+		return PlanNone
+	case n <= p.CheckEachMax:
+		return PlanCheckEach
+	}
+	if lookup {
+		size, ok := p.estimate(key)
+		if (ok && float64(size) <= p.LookupRatio*float64(n)) || (!ok && n > p.ProbeCandidates) {
+			return PlanLookup
+		}
+	}
+	if bulk {
+		return PlanBulk
+	}
+	return PlanCheckEach
+}
+
+// estimate returns the fresh estimate kept under key, if any.
+func (p *planState) estimate(key string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.estimates[key]
+	if !ok || time.Since(e.at) > p.EstimateTTL {
+		return 0, false
+	}
+	return e.size, true
+}
+
+// observe records size as the estimate kept under key.
+func (p *planState) observe(key string, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.estimates[key]; !ok && len(p.estimates) >= p.MaxEstimates {
+		var oldest string
+		for k, e := range p.estimates {
+			if oldest == "" || e.at.Before(p.estimates[oldest].at) {
+				oldest = k
+			}
+		}
+		delete(p.estimates, oldest)
+	}
+	p.estimates[key] = estimate{size: size, at: time.Now()}
+}
+
+// planKey is the key the planner keeps subject's estimates under for the
+// permissions of ctx.
+func (r *RAGPipeline) planKey(ctx context.Context, subject *apiv1.SubjectReference) string {
+	return subjectKey(subject) + "@" + r.permissionsOf(ctx, r.resourceType).String()
+}
+
+// planQuery picks the plan of q's candidates under FilterAdaptive and,
+// for PlanLookup, decides them right away. Under FilterPostCheck it
+// reports the plan the checker allows.
+func (q *pendingQuery) planQuery() error {
+	r, stats := q.r, &q.resp.Stats
+	_, bulk := r.checkerFor(q.ctx).(BulkPermissionChecker)
+	if r.strategy != FilterAdaptive {
+		switch {
+		case len(q.resources) == 0:
+			q.plan = PlanNone
+		case bulk:
+			q.plan = PlanBulk
+		default:
+			q.plan = PlanCheckEach
+		}
+		stats.Plan = q.plan
+		return nil
+	}
+
+	_, lookup := r.checkerFor(q.ctx).(ResourceLister)
+	key := r.planKey(q.ctx, q.subject)
+	q.plan = r.planner.plan(key, len(q.resources), lookup, bulk)
+	stats.Plan = q.plan
+	if q.plan != PlanLookup {
+		return nil
+	}
+
+	_, accessible, err := r.accessibleSet(q.ctx, q.subject, documentsOf(q.docs))
+	if err != nil {
+		// Unlike a lookup, checks fail per document, so a policy other
+		// than FailClosed decides the candidates as the check plans would.
+		if r.failurePolicy == FailClosed || q.ctx.Err() != nil {
+			return err
+		}
+		q.plan = PlanCheckEach
+		if bulk {
+			q.plan = PlanBulk
+		}
+		stats.Plan = q.plan
+		return nil
+	}
+	r.planner.observe(key, definitelyAccessible(accessible))
+	stats.Accessible = definitelyAccessible(accessible)
+	docs := q.docs
+	q.docs, q.resources = nil, nil
+	return q.restrict(docs, accessible)
+}
+
+// sample refines the estimate of the subject's accessible set from a
+// bulk or single check of n candidates, allowed of which were allowed,
+// assuming the corpus is accessible in the same proportion.
+func (q *pendingQuery) sample(n, allowed int) {
+	r := q.r
+	if r.strategy != FilterAdaptive || n == 0 {
+		return
+	}
+	corpus := len(r.snapshot())
+	if corpus == 0 {
+		// Documents live in an external store of unknown size.
+		return
+	}
+	r.planner.observe(r.planKey(q.ctx, q.subject), allowed*corpus/n)
+}
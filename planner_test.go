@@ -0,0 +1,137 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestPlannerChecksFewCandidatesEach(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc3#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10), rag.WithPlanner(rag.Planner{}))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "doc3", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc3"}, results)
+	require.Equal(t, rag.PlanCheckEach, stats.Plan)
+	require.Equal(t, 1, fake.checkCount())
+	require.Empty(t, fake.bulkRequestSizes())
+}
+
+func TestPlannerLearnsAccessibleSetSize(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var allowed []string
+	for i := range 8 {
+		allowed = append(allowed, fmt.Sprintf("document:doc%d#read@user:emilia", i))
+	}
+	allowed = append(allowed, "document:doc0#read@user:carl")
+	client, fake := newFakeClient(allowed...)
+	metrics := rag.NewCollector("")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10),
+		rag.WithPlanner(rag.Planner{ProbeCandidates: 5, LookupRatio: 0.5}), rag.WithMetrics(metrics))
+
+	query := func(user string) ([]rag.Document, rag.Stats) {
+		t.Helper()
+		var stats rag.Stats
+		results, err := pipeline.Query(ctx, user, "synthetic", rag.WithStats(&stats))
+		require.NoError(t, err)
+		return results, stats
+	}
+
+	// Without an estimate, ten candidates are enough to look the sets up.
+	results, stats := query("emilia")
+	require.Len(t, results, 8)
+	require.Equal(t, rag.PlanLookup, stats.Plan)
+	results, stats = query("carl")
+	requireEqualDocIDs(t, []string{"doc0"}, results)
+	require.Equal(t, rag.PlanLookup, stats.Plan)
+	require.Empty(t, fake.bulkRequestSizes())
+
+	// Emilia can read too much for a lookup to pay off; Carl cannot.
+	results, stats = query("emilia")
+	require.Len(t, results, 8)
+	require.Equal(t, rag.PlanBulk, stats.Plan)
+	require.Equal(t, []int{10}, fake.bulkRequestSizes())
+	results, stats = query("carl")
+	requireEqualDocIDs(t, []string{"doc0"}, results)
+	require.Equal(t, rag.PlanLookup, stats.Plan)
+
+	lines := strings.Split(scrape(t, metrics), "\n")
+	require.Contains(t, lines, `rag_query_plans_total{plan="bulk"} 1`)
+	require.Contains(t, lines, `rag_query_plans_total{plan="lookup"} 3`)
+}
+
+func TestPlanReportedForFixedStrategies(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	for strategy, plan := range map[rag.FilterStrategy]rag.Plan{
+		rag.FilterPostCheck: rag.PlanBulk,
+		rag.FilterPrefilter: rag.PlanLookup,
+	} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithFilterStrategy(strategy))
+		var stats rag.Stats
+		_, err := pipeline.Query(context.Background(), "emilia", "o", rag.WithStats(&stats))
+		require.NoError(t, err)
+		require.Equal(t, plan, stats.Plan, strategy)
+	}
+}
+
+func TestPlannerLookupDecidesAsChecks(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []rag.FailurePolicy{rag.FailClosedDocument, rag.FailOpen} {
+		client, fake := newFakeClient("document:doc0#read@user:emilia", "document:doc2#read@user:emilia")
+		fake.conditional = map[string]string{"document:doc1#read@user:emilia": "on_vpn"}
+		opts := []rag.Option{rag.WithFailurePolicy(policy)}
+		checked := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(4), opts...)
+		planned := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(4),
+			append(opts, rag.WithPlanner(rag.Planner{ProbeCandidates: 1}))...)
+
+		want, err := checked.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+		require.NoError(t, err, policy)
+		require.Equal(t, 1, want.Stats.Conditional, policy)
+
+		got, err := planned.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+		require.NoError(t, err, policy)
+		require.Equal(t, rag.PlanLookup, got.Stats.Plan, policy)
+		require.Equal(t, want.Documents, got.Documents, policy)
+		require.Equal(t, want.Stats.Conditional, got.Stats.Conditional, policy)
+
+		// A failed lookup falls back to checking the candidates.
+		fake.failLookups = 1
+		got, err = planned.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+		require.NoError(t, err, policy)
+		require.Equal(t, rag.PlanBulk, got.Stats.Plan, policy)
+		require.Equal(t, want.Documents, got.Documents, policy)
+		require.Equal(t, want.Stats.Conditional, got.Stats.Conditional, policy)
+
+		// So do failed checks, under the policy.
+		fake.failCheck = status.Error(codes.Unavailable, "connection refused")
+		want, err = checked.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+		require.NoError(t, err, policy)
+		fake.failLookups = 1
+		got, err = planned.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"})
+		require.NoError(t, err, policy)
+		require.Equal(t, want.Documents, got.Documents, policy)
+		require.Equal(t, len(want.CheckErrors), len(got.CheckErrors), policy)
+	}
+
+	client, fake := newFakeClient("document:doc0#read@user:emilia")
+	fake.failLookups = 1
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(4), rag.WithPlanner(rag.Planner{ProbeCandidates: 1}))
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, rag.ErrPermissionBackendUnavailable)
+}
@@ -0,0 +1,294 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// ErrPrefilterUnsupported is returned when the prefilter strategy is used
+// with a PermissionChecker that cannot list resources.
+var ErrPrefilterUnsupported = errors.New("rag: permission checker cannot look up resources")
+
+// FilterStrategy selects how a query's results are authorized.
+type FilterStrategy int
+
+const (
+	// FilterPostCheck retrieves candidates first and then checks each one.
+	// It is the default and suits users who can access most of the corpus.
+	FilterPostCheck FilterStrategy = iota
+
+	// FilterPrefilter looks up everything the user can access first and
+	// restricts retrieval to that set. It is much cheaper when the user
+	// can access few documents but the query matches many.
+	FilterPrefilter
+
+	// FilterAdaptive retrieves candidates first, like FilterPostCheck,
+	// and then plans each query on its own: a few candidates are checked
+	// one by one, many are checked in bulk, and when the user's
+	// accessible set is estimated to be smaller than the candidates it is
+	// looked up instead, like FilterPrefilter. Stats.Plan reports the
+	// choice. See WithPlanner for tuning.
+	FilterAdaptive
+)
+
+// WithFilterStrategy selects the pipeline's FilterStrategy.
+func WithFilterStrategy(s FilterStrategy) Option {
+	return func(r *RAGPipeline) {
+		r.strategy = s
+	}
+}
+
+// ResourceLister is implemented by checkers that can enumerate the
+// resources a subject holds a permission on. The prefilter strategy and
+// Suggest require it.
+type ResourceLister interface {
+	// LookupResources returns the IDs of the resourceType objects on which
+	// subject definitively holds permission. Conditional results are
+	// left out.
+	LookupResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) ([]string, error)
+}
+
+// ConditionalLister is implemented by ResourceListers that can also
+// report the resources on which a subject's permission depends on caveat
+// context it was not given. The prefilter strategy checks those as the
+// post-check strategy would, so WithConditionalPolicy and
+// WithConditionalResolver apply to them alike; a plain ResourceLister
+// leaves them out as inaccessible.
+type ConditionalLister interface {
+	// LookupConditionalResources is LookupResources that also returns
+	// the IDs of the objects on which subject holds permission
+	// conditionally.
+	LookupConditionalResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) (allowed, conditional []string, err error)
+}
+
+// FilteringRetriever is implemented by retrievers whose index can restrict
+// a search to given SpiceDB objects, such as vector databases with payload
+// filters. Under FilterPrefilter the pipeline looks up the objects of its
+// resource type the user can access and passes them down, so the index
+// ranks only accessible documents instead of having its top results
+// filtered away afterwards. Results are still authorized as usual.
+type FilteringRetriever interface {
+	Retriever
+
+	// RetrieveAccessible is RetrieveScored restricted to documents whose
+	// object, as "type:id", is one of objects.
+	RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]ScoredDocument, error)
+}
+
+// LookupResources implements ResourceLister using SpiceDB's streaming
+// LookupResources API.
+func (c *SpiceDBChecker) LookupResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) ([]string, error) {
+	ids, _, err := c.LookupConditionalResources(ctx, subject, resourceType, permission)
+	return ids, err
+}
+
+// LookupConditionalResources implements ConditionalLister using SpiceDB's
+// streaming LookupResources API.
+func (c *SpiceDBChecker) LookupConditionalResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) (allowed, conditional []string, err error) {
+	stream, err := c.client.LookupResources(ctx, &apiv1.LookupResourcesRequest{
+		Consistency:        consistencyFromContext(ctx),
+		ResourceObjectType: resourceType,
+		Permission:         permission,
+		Subject:            subject,
+		Context:            caveatFromContext(ctx),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return allowed, conditional, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch resp.GetPermissionship() {
+		case apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION:
+			allowed = append(allowed, resp.GetResourceObjectId())
+		case apiv1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_CONDITIONAL_PERMISSION:
+			conditional = append(conditional, resp.GetResourceObjectId())
+		}
+	}
+}
+
+// lookupResources looks up with lister the resources subject holds
+// permission on, and those it holds it on conditionally if lister is a
+// ConditionalLister.
+func lookupResources(ctx context.Context, lister ResourceLister, subject *apiv1.SubjectReference, resourceType, permission string) (allowed, conditional []string, err error) {
+	if cl, ok := lister.(ConditionalLister); ok {
+		return cl.LookupConditionalResources(ctx, subject, resourceType, permission)
+	}
+	allowed, err = lister.LookupResources(ctx, subject, resourceType, permission)
+	return allowed, nil, err
+}
+
+// accessibleSet maps docs to their object keys ("" when unmapped) and
+// returns the set of those objects subject can access, looking up every
+// resource type that occurs in docs. Objects subject can access only
+// conditionally are in the set as false, to be checked.
+func (r *RAGPipeline) accessibleSet(ctx context.Context, subject *apiv1.SubjectReference, docs []Document) ([]string, map[string]bool, error) {
+	lister, ok := r.checkerFor(ctx).(ResourceLister)
+	if !ok {
+		return nil, nil, ErrPrefilterUnsupported
+	}
+
+	keys := make([]string, len(docs))
+	var types []string
+	var tenant string
+	seen := make(map[string]bool)
+	for i, d := range docs {
+		res, err := r.resourceFor(d)
+		if err != nil {
+			continue
+		}
+		keys[i] = objectKey(res)
+		if !seen[res.GetObjectType()] {
+			seen[res.GetObjectType()] = true
+			types = append(types, res.GetObjectType())
+			tenant = r.tenantOf(res)
+		}
+	}
+
+	// Documents of the types WithAccessSets keeps sets of are filtered
+	// against the subject's set; mapping them to other types is rare.
+	if r.access != nil && cacheable(ctx) && !slices.ContainsFunc(types, func(t string) bool {
+		return !slices.Contains(r.accessTypes(tenant), t)
+	}) {
+		accessible, _, err := r.access.materialized(ctx, r, subject, tenant)
+		return keys, accessible, err
+	}
+
+	accessible := make(map[string]bool)
+	for _, objType := range types {
+		ids, conditional, err := r.permissionsOf(ctx, objType).lookup(ctx, lister, subject, objType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rag: looking up accessible %s resources: %w", objType, backendError(ctx, err))
+		}
+		for _, id := range ids {
+			accessible[objType+":"+id] = true
+		}
+		for _, id := range conditional {
+			accessible[objType+":"+id] = false
+		}
+	}
+	return keys, accessible, nil
+}
+
+// accessibleObjects returns the objects of the pipeline's resource type
+// and those of WithTypePermissions, in tenant's definitions, subject can
+// access, as a set and as a sorted list of keys. Objects subject can
+// access only conditionally are listed too, and in the set as false.
+func (r *RAGPipeline) accessibleObjects(ctx context.Context, subject *apiv1.SubjectReference, tenant string) (map[string]bool, []string, error) {
+	if r.access != nil && cacheable(ctx) {
+		return r.access.materialized(ctx, r, subject, tenant)
+	}
+	return r.lookupObjects(ctx, subject, tenant)
+}
+
+// lookupObjects is accessibleObjects without WithAccessSets.
+func (r *RAGPipeline) lookupObjects(ctx context.Context, subject *apiv1.SubjectReference, tenant string) (map[string]bool, []string, error) {
+	lister, ok := r.checkerFor(ctx).(ResourceLister)
+	if !ok {
+		return nil, nil, ErrPrefilterUnsupported
+	}
+
+	accessible := make(map[string]bool)
+	var objects []string
+	for _, objType := range r.accessTypes(tenant) {
+		ids, conditional, err := r.permissionsOf(ctx, objType).lookup(ctx, lister, subject, objType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rag: looking up accessible %s resources: %w", objType, backendError(ctx, err))
+		}
+		for _, id := range ids {
+			key := objType + ":" + id
+			if _, ok := accessible[key]; !ok {
+				objects = append(objects, key)
+			}
+			accessible[key] = true
+		}
+		for _, id := range conditional {
+			key := objType + ":" + id
+			if _, ok := accessible[key]; !ok {
+				objects = append(objects, key)
+				accessible[key] = false
+			}
+		}
+	}
+	slices.Sort(objects)
+	return accessible, objects, nil
+}
+
+// restrict adds the candidates whose object is in accessible to resp,
+// counting them in its stats as if they had been checked, and audits the
+// others. Candidates accessible only conditionally are checked, and
+// decided like the candidates of the post-check strategy.
+func (q *pendingQuery) restrict(candidates []ScoredDocument, accessible map[string]bool) error {
+	r, ctx, resp, stats := q.r, q.ctx, q.resp, &q.resp.Stats
+	ex := explainerFromContext(ctx)
+
+	resources := make([]*apiv1.ObjectReference, len(candidates))
+	var conditional []ScoredDocument
+	var conditionalResources []*apiv1.ObjectReference
+	for i, d := range candidates {
+		res, err := r.resourceFor(d.Document)
+		if err != nil {
+			stats.Unmapped++
+			ex.drop(d.Document, OutcomeUnmapped, DecisionDenied, err.Error())
+			continue
+		}
+		resources[i] = res
+		if allowed, ok := accessible[objectKey(res)]; ok && !allowed {
+			conditional = append(conditional, d)
+			conditionalResources = append(conditionalResources, res)
+		}
+	}
+	var results []CheckResult
+	if len(conditional) > 0 {
+		var err error
+		if results, err = q.authorize(conditional, conditionalResources); err != nil {
+			return err
+		}
+	}
+
+	for i, d := range candidates {
+		res := resources[i]
+		if res == nil {
+			continue
+		}
+		allowed, ok := accessible[objectKey(res)]
+		switch {
+		case allowed:
+			resp.add(d, DecisionAllowed, q.req.Query, r.snippets)
+			stats.Allowed++
+		case ok:
+			if err := q.admit(d, res, results[0]); err != nil {
+				return err
+			}
+			results = results[1:]
+		default:
+			if err := q.admit(d, res, CheckResult{Decision: DecisionDenied}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// definitelyAccessible counts the objects of accessible subject can
+// access without condition.
+func definitelyAccessible(accessible map[string]bool) int {
+	n := 0
+	for _, ok := range accessible {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,119 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestPrefilterRestrictsRetrievalToAccessibleSet(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc3#read@user:emilia", "document:doc42#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(100),
+		rag.WithFilterStrategy(rag.FilterPrefilter))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc3", "doc42"}, results)
+	require.Zero(t, fake.checkCount())
+	require.Empty(t, fake.bulkRequestSizes())
+	require.Equal(t, 2, stats.Accessible)
+	require.Equal(t, 2, stats.DocsScanned)
+	require.Equal(t, 2, stats.Allowed)
+}
+
+func TestPrefilterMatchesPostCheck(t *testing.T) {
+	t.Parallel()
+
+	allowed := []string{"document:doc1#read@user:emilia", "document:doc7#read@user:emilia", "document:doc70#read@user:emilia"}
+	client, _ := newFakeClient(allowed...)
+	post := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(100))
+	pre := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(100),
+		rag.WithFilterStrategy(rag.FilterPrefilter))
+
+	for _, query := range []string{"synthetic", "doc7", "doc1", "nothing"} {
+		want, err := post.Query(context.Background(), "emilia", query)
+		require.NoError(t, err)
+		got, err := pre.Query(context.Background(), "emilia", query)
+		require.NoError(t, err)
+		require.Equal(t, want, got, query)
+	}
+}
+
+func TestPrefilterBudgetCountsOnlyAccessibleDocs(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc90#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(100),
+		rag.WithFilterStrategy(rag.FilterPrefilter), rag.WithScanBudget(10, 0))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc90"}, results)
+	require.False(t, stats.BudgetExceeded)
+}
+
+type checkOnly struct{}
+
+func (checkOnly) Check(context.Context, *apiv1.SubjectReference, *apiv1.ObjectReference, string) (rag.Decision, error) {
+	return rag.DecisionAllowed, nil
+}
+
+func TestPrefilterRequiresResourceLister(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithFilterStrategy(rag.FilterPrefilter), rag.WithPermissionChecker(checkOnly{}))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "policy")
+	require.ErrorIs(t, err, rag.ErrPrefilterUnsupported)
+}
+
+// objectFilterRetriever is a FilteringRetriever over static documents that
+// records the objects it was restricted to.
+type objectFilterRetriever struct {
+	staticRetriever
+	objects [][]string
+}
+
+func (o *objectFilterRetriever) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	o.objects = append(o.objects, objects)
+	var out []rag.ScoredDocument
+	for _, d := range o.docs {
+		for _, obj := range objects {
+			if d.Metadata[rag.SpiceDBObjectKey] == obj {
+				out = append(out, rag.ScoredDocument{Document: d, Score: 1})
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestPrefilterPushesAccessibleSetToFilteringRetriever(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc2#read@user:emilia", "document:doc1#read@user:emilia")
+	rt := &objectFilterRetriever{staticRetriever: staticRetriever{docs: syntheticCorpus(4)}}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+		rag.WithRetriever(rt), rag.WithFilterStrategy(rag.FilterPrefilter))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "anything")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc2"}, results)
+	require.Equal(t, [][]string{{"document:doc1", "document:doc2"}}, rt.objects)
+	require.Empty(t, rt.limits)
+
+	// Nothing accessible: the retriever is not asked at all.
+	results, err = pipeline.Query(context.Background(), "charlie", "anything")
+	require.NoError(t, err)
+	require.Empty(t, results)
+	require.Len(t, rt.objects, 1)
+}
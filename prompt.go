@@ -0,0 +1,121 @@
+package rag
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"text/template"
+)
+
+// DefaultPromptTemplate numbers the sources, quotes them and asks for an
+// answer based on them alone, citing them by marker.
+const DefaultPromptTemplate = `Answer the question using only the sources below, citing them by their [n] markers. If they do not contain the answer, say so.
+
+{{ range .Sources }}{{ .Citation }} ({{ .ID }})
+{{ .Text }}
+
+{{ end }}Question: {{ .Question }}
+Answer:`
+
+// PromptFunc assembles the prompt sent to the Generator from the question
+// and the authorized sources, in retrieval order.
+type PromptFunc func(question string, sources []Document) (string, error)
+
+// WithPromptFunc replaces DefaultPrompt as the way Answer assembles its
+// prompt. See also WithPromptTemplate.
+func WithPromptFunc(f PromptFunc) Option {
+	return func(r *RAGPipeline) {
+		r.prompt = f
+	}
+}
+
+// WithPromptTemplate makes Answer render t to assemble its prompt.
+func WithPromptTemplate(t *PromptTemplate) Option {
+	return WithPromptFunc(t.Render)
+}
+
+// PromptData is the input of a PromptTemplate.
+type PromptData struct {
+	Question string
+
+	// Sources are the documents the user may read, in retrieval order.
+	// Answer builds them from the permission-filtered results only, so a
+	// template cannot reference a document SpiceDB filtered out.
+	Sources []PromptSource
+}
+
+// PromptSource is one authorized document as seen by a PromptTemplate.
+type PromptSource struct {
+	// Index is the source's 1-based position and Citation its marker,
+	// "[Index]".
+	Index    int
+	Citation string
+
+	ID       string
+	Text     string
+	Metadata map[string]string
+}
+
+// PromptTemplate renders prompts from a text/template executed against
+// PromptData. Besides the text/template builtins it provides
+//
+//	truncate n s   s cut to at most n runes
+//	join sep list  strings.Join
+type PromptTemplate struct {
+	tmpl *template.Template
+}
+
+var promptFuncs = template.FuncMap{
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:n])
+		}
+		return s
+	},
+	"join": func(sep string, list []string) string {
+		return strings.Join(list, sep)
+	},
+}
+
+// NewPromptTemplate parses text into a PromptTemplate. A field or map key
+// missing from the data is an error rather than an empty string, so a
+// mistyped metadata key fails loudly.
+func NewPromptTemplate(text string) (*PromptTemplate, error) {
+	tmpl, err := template.New("prompt").Funcs(promptFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("rag: parsing prompt template: %w", err)
+	}
+	return &PromptTemplate{tmpl: tmpl}, nil
+}
+
+// Render implements PromptFunc.
+func (t *PromptTemplate) Render(question string, sources []Document) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, promptData(question, sources)); err != nil {
+		return "", fmt.Errorf("rag: rendering prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+var defaultPrompt = template.Must(template.New("prompt").Funcs(promptFuncs).Parse(DefaultPromptTemplate))
+
+// DefaultPrompt renders DefaultPromptTemplate.
+func DefaultPrompt(question string, sources []Document) (string, error) {
+	return (&PromptTemplate{tmpl: defaultPrompt}).Render(question, sources)
+}
+
+// promptData copies sources into a PromptData, so a template cannot
+// modify the corpus through shared metadata maps.
+func promptData(question string, sources []Document) PromptData {
+	data := PromptData{Question: question, Sources: make([]PromptSource, len(sources))}
+	for i, d := range sources {
+		data.Sources[i] = PromptSource{
+			Index:    i + 1,
+			Citation: fmt.Sprintf("[%d]", i+1),
+			ID:       d.ID,
+			Text:     d.Text,
+			Metadata: maps.Clone(d.Metadata),
+		}
+	}
+	return data
+}
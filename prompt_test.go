@@ -0,0 +1,46 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := rag.NewPromptTemplate(`{{ range .Sources }}{{ .Citation }} {{ .Metadata.title }}: {{ truncate 5 .Text }}
+{{ end }}Q: {{ .Question }}`)
+	require.NoError(t, err)
+
+	prompt, err := tmpl.Render("why?", []rag.Document{
+		{ID: "a", Text: "first document", Metadata: map[string]string{"title": "A"}},
+		{ID: "b", Text: "second", Metadata: map[string]string{"title": "B"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "[1] A: first\n[2] B: secon\nQ: why?", prompt)
+
+	_, err = tmpl.Render("why?", []rag.Document{{ID: "c", Text: "untitled"}})
+	require.ErrorContains(t, err, "title")
+
+	_, err = rag.NewPromptTemplate("{{ .Sources ")
+	require.Error(t, err)
+}
+
+func TestPromptTemplateSeesOnlyAuthorizedSources(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	tmpl, err := rag.NewPromptTemplate(`{{ range .Sources }}{{ .Citation }}={{ .ID }};{{ end }}{{ len .Sources }}`)
+	require.NoError(t, err)
+	gen := &recordingGenerator{answer: "ok"}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithGenerator(gen), rag.WithPromptTemplate(tmpl))
+
+	_, err = pipeline.Answer(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1]=doc1;1"}, gen.prompts)
+}
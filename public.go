@@ -0,0 +1,76 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// PublicKey is the metadata key marking a document as readable by every
+// subject, see MarkPublic.
+const PublicKey = "spicedb_public"
+
+// MarkPublic returns a copy of doc marked as public, without modifying
+// doc's metadata. Marking only records intent: WritePublicRelationships
+// grants the access in SpiceDB.
+func MarkPublic(doc Document) Document {
+	meta := make(map[string]string, len(doc.Metadata)+1)
+	maps.Copy(meta, doc.Metadata)
+	meta[PublicKey] = "true"
+	doc.Metadata = meta
+	return doc
+}
+
+// IsPublic reports whether doc was marked with MarkPublic.
+func IsPublic(doc Document) bool {
+	return doc.Metadata[PublicKey] == "true"
+}
+
+// WritePublicRelationships grants relation on the object of every public
+// document in the corpus to all subjects of the pipeline's subject type,
+// by touching one wildcard relationship per object, e.g.
+// "document:doc3#viewer@user:*", instead of one per user. The schema must
+// allow the wildcard on relation:
+//
+//	relation viewer: user | user:*
+//
+// Checks and lookups need nothing further; SpiceDB resolves wildcards
+// itself. It returns the revision of the write, to query at with
+// AtLeastAsFresh, or nil if no document is public.
+func (r *RAGPipeline) WritePublicRelationships(ctx context.Context, relation string) (*apiv1.ZedToken, error) {
+	seen := make(map[string]bool)
+	var updates []*apiv1.RelationshipUpdate
+	for _, d := range r.snapshot() {
+		if !IsPublic(d) {
+			continue
+		}
+		res, err := r.resourceFor(d)
+		if err != nil {
+			return nil, fmt.Errorf("rag: public document %q: %w", d.ID, err)
+		}
+		if seen[objectKey(res)] {
+			// Chunks of one document share its object.
+			continue
+		}
+		seen[objectKey(res)] = true
+		updates = append(updates, &apiv1.RelationshipUpdate{
+			Operation: apiv1.RelationshipUpdate_OPERATION_TOUCH,
+			Relationship: &apiv1.Relationship{
+				Resource: res,
+				Relation: relation,
+				Subject:  &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: r.tenantType(r.tenantOf(res), r.subjectType), ObjectId: "*"}},
+			},
+		})
+	}
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	resp, err := r.spiceClient.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{Updates: updates})
+	if err != nil {
+		return nil, fmt.Errorf("rag: writing public relationships: %w", err)
+	}
+	return resp.GetWrittenAt(), nil
+}
@@ -0,0 +1,56 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestMarkPublic(t *testing.T) {
+	t.Parallel()
+
+	doc := rag.Document{ID: "doc1", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}}
+	public := rag.MarkPublic(doc)
+	require.True(t, rag.IsPublic(public))
+	require.False(t, rag.IsPublic(doc), "the original's metadata is left alone")
+	require.Equal(t, "document:doc1", public.Metadata[rag.SpiceDBObjectKey])
+	require.True(t, rag.IsPublic(rag.MarkPublic(rag.Document{ID: "bare"})))
+}
+
+func TestWritePublicRelationships(t *testing.T) {
+	t.Parallel()
+
+	docs := syntheticCorpus(3)
+	docs[1] = rag.MarkPublic(docs[1])
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+		rag.WithChunker(rag.FixedSizeChunker{Size: 10}))
+
+	token, err := pipeline.WritePublicRelationships(context.Background(), "viewer")
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	// One wildcard relationship for the document, however many chunks.
+	require.Equal(t, []string{"document:doc1#read@user:*"}, fake.tuples())
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithFilterStrategy(strategy))
+		results, err := pipeline.Query(context.Background(), "anyone", "synthetic")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc1"}, results)
+	}
+}
+
+func TestWritePublicRelationshipsWithoutPublicDocuments(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(2))
+
+	token, err := pipeline.WritePublicRelationships(context.Background(), "viewer")
+	require.NoError(t, err)
+	require.Nil(t, token)
+	require.Empty(t, fake.tuples())
+}
@@ -0,0 +1,326 @@
+// Package qdrant is a rag.DocumentStore backed by a Qdrant collection,
+// talking to Qdrant's REST API. Documents are stored with their embedding
+// and metadata, and their SpiceDB object is indexed as a payload field so
+// the pipeline's prefilter strategy can push the accessible set down to
+// Qdrant as a filter. Package qdranttest starts Qdrant in a container.
+package qdrant
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// MaxSearchLimit is the number of points requested when a search has no
+// limit; Qdrant requires one.
+const MaxSearchLimit = 10000
+
+// objectField is the payload field holding a document's SpiceDB object.
+const objectField = "spicedb_object"
+
+// APIError is a non-2xx response from Qdrant.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("qdrant: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Store is a rag.DocumentStore, rag.ScoredRetriever and
+// rag.FilteringRetriever over one Qdrant collection, ranking by cosine
+// similarity.
+type Store struct {
+	baseURL    string
+	collection string
+	embedder   rag.Embedder
+	dims       int
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithAPIKey sets the API key sent to Qdrant Cloud or secured instances.
+func WithAPIKey(key string) Option {
+	return func(s *Store) {
+		s.apiKey = key
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(s *Store) {
+		s.httpClient = hc
+	}
+}
+
+// New returns a Store on collection of the Qdrant server at baseURL (e.g.
+// "http://localhost:6333"), embedding text with embedder, whose vectors
+// have dims dimensions. Call Migrate once to create the collection.
+func New(baseURL, collection string, embedder rag.Embedder, dims int, opts ...Option) *Store {
+	s := &Store{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		collection: collection,
+		embedder:   embedder,
+		dims:       dims,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Migrate creates the collection, if it does not exist, and a keyword
+// index on the SpiceDB object payload field used for filtering.
+func (s *Store) Migrate(ctx context.Context) error {
+	path := "/collections/" + url.PathEscape(s.collection)
+	err := s.call(ctx, http.MethodGet, path, nil, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		err = s.call(ctx, http.MethodPut, path, map[string]any{
+			"vectors": map[string]any{"size": s.dims, "distance": "Cosine"},
+		}, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("qdrant: creating collection: %w", err)
+	}
+
+	err = s.call(ctx, http.MethodPut, path+"/index?wait=true", map[string]any{
+		"field_name":   objectField,
+		"field_schema": "keyword",
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("qdrant: indexing %s: %w", objectField, err)
+	}
+	return nil
+}
+
+type payload struct {
+	DocID    string            `json:"doc_id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Object   string            `json:"spicedb_object,omitempty"`
+}
+
+type point struct {
+	ID      string    `json:"id"`
+	Vector  []float32 `json:"vector"`
+	Payload payload   `json:"payload"`
+}
+
+// Add implements rag.DocumentStore, upserting all docs in one request.
+// A document's spicedb_object metadata is copied into the filterable
+// payload field; documents without one are never found by
+// RetrieveAccessible.
+func (s *Store) Add(ctx context.Context, docs ...rag.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Text
+	}
+	vectors, err := s.embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("qdrant: embedding documents: %w", err)
+	}
+
+	points := make([]point, len(docs))
+	for i, d := range docs {
+		points[i] = point{
+			ID:     pointID(d.ID),
+			Vector: vectors[i],
+			Payload: payload{
+				DocID:    d.ID,
+				Text:     d.Text,
+				Metadata: d.Metadata,
+				Object:   d.Metadata[rag.SpiceDBObjectKey],
+			},
+		}
+	}
+	err = s.call(ctx, http.MethodPut, s.pointsPath("?wait=true"), map[string]any{"points": points}, nil)
+	if err != nil {
+		return fmt.Errorf("qdrant: storing documents: %w", err)
+	}
+	return nil
+}
+
+// Remove implements rag.DocumentStore.
+func (s *Store) Remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = pointID(id)
+	}
+	err := s.call(ctx, http.MethodPost, s.pointsPath("/delete?wait=true"), map[string]any{"points": points}, nil)
+	if err != nil {
+		return fmt.Errorf("qdrant: removing documents: %w", err)
+	}
+	return nil
+}
+
+// Retrieve implements rag.Retriever.
+func (s *Store) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	scored, err := s.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]rag.Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs, nil
+}
+
+// RetrieveScored implements rag.ScoredRetriever; the score is Qdrant's
+// cosine similarity.
+func (s *Store) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	return s.search(ctx, query, limit, nil)
+}
+
+// RetrieveAccessible implements rag.FilteringRetriever with a payload
+// filter on the documents' SpiceDB object.
+func (s *Store) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	filter := map[string]any{
+		"must": []any{map[string]any{
+			"key":   objectField,
+			"match": map[string]any{"any": objects},
+		}},
+	}
+	return s.search(ctx, query, limit, filter)
+}
+
+func (s *Store) search(ctx context.Context, query string, limit int, filter map[string]any) ([]rag.ScoredDocument, error) {
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("qdrant: embedding query: %w", err)
+	}
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	req := map[string]any{
+		"vector":       vectors[0],
+		"limit":        limit,
+		"with_payload": true,
+	}
+	if filter != nil {
+		req["filter"] = filter
+	}
+	var resp struct {
+		Result []struct {
+			Score   float64 `json:"score"`
+			Payload payload `json:"payload"`
+		} `json:"result"`
+	}
+	if err := s.call(ctx, http.MethodPost, s.pointsPath("/search"), req, &resp); err != nil {
+		return nil, fmt.Errorf("qdrant: searching: %w", err)
+	}
+
+	out := make([]rag.ScoredDocument, len(resp.Result))
+	for i, hit := range resp.Result {
+		out[i] = rag.ScoredDocument{
+			Document: rag.Document{ID: hit.Payload.DocID, Text: hit.Payload.Text, Metadata: hit.Payload.Metadata},
+			Score:    hit.Score,
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) pointsPath(suffix string) string {
+	return "/collections/" + url.PathEscape(s.collection) + "/points" + suffix
+}
+
+// embed calls the embedder and checks the vectors fit the collection.
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", rag.ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) != s.dims {
+			return nil, fmt.Errorf("%w: dimension %d, want %d", rag.ErrEmbeddingMismatch, len(v), s.dims)
+		}
+	}
+	return vectors, nil
+}
+
+// call sends body, if any, as JSON and decodes the response into out, if
+// not nil.
+func (s *Store) call(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		r = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(raw))
+		var e struct {
+			Status struct {
+				Error string `json:"error"`
+			} `json:"status"`
+		}
+		if json.Unmarshal(raw, &e) == nil && e.Status.Error != "" {
+			msg = e.Status.Error
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// pointID derives a stable UUID from a document ID, since Qdrant point IDs
+// must be integers or UUIDs.
+func pointID(docID string) string {
+	h := sha1.Sum([]byte(docID))
+	h[6] = h[6]&0x0f | 0x50 // version 5
+	h[8] = h[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
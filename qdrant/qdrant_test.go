@@ -0,0 +1,242 @@
+package qdrant_test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/qdrant"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+var (
+	_ rag.DocumentStore      = (*qdrant.Store)(nil)
+	_ rag.FilteringRetriever = (*qdrant.Store)(nil)
+)
+
+type fakePoint struct {
+	Vector  []float64      `json:"vector"`
+	Payload map[string]any `json:"payload"`
+}
+
+// fakeQdrant implements the subset of Qdrant's REST API the store uses,
+// for a single collection "docs".
+type fakeQdrant struct {
+	mu       sync.Mutex
+	created  bool
+	indexed  []string
+	points   map[string]fakePoint
+	searches []map[string]any
+}
+
+func newFakeQdrant(t *testing.T) (*fakeQdrant, string) {
+	t.Helper()
+	f := &fakeQdrant{points: make(map[string]fakePoint)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections/docs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.created {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"status":{"error":"Not found: Collection docs doesn't exist!"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":{},"status":"ok"}`))
+	})
+	mux.HandleFunc("PUT /collections/docs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.created = true
+		_, _ = w.Write([]byte(`{"result":true,"status":"ok"}`))
+	})
+	mux.HandleFunc("PUT /collections/docs/index", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			FieldName string `json:"field_name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.indexed = append(f.indexed, req.FieldName)
+		_, _ = w.Write([]byte(`{"result":{},"status":"ok"}`))
+	})
+	mux.HandleFunc("PUT /collections/docs/points", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Points []struct {
+				ID string `json:"id"`
+				fakePoint
+			} `json:"points"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, p := range req.Points {
+			f.points[p.ID] = p.fakePoint
+		}
+		_, _ = w.Write([]byte(`{"result":{},"status":"ok"}`))
+	})
+	mux.HandleFunc("POST /collections/docs/points/delete", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Points []string `json:"points"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, id := range req.Points {
+			delete(f.points, id)
+		}
+		_, _ = w.Write([]byte(`{"result":{},"status":"ok"}`))
+	})
+	mux.HandleFunc("POST /collections/docs/points/search", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Vector []float64 `json:"vector"`
+			Limit  int       `json:"limit"`
+			Filter *struct {
+				Must []struct {
+					Key   string `json:"key"`
+					Match struct {
+						Any []string `json:"any"`
+					} `json:"match"`
+				} `json:"must"`
+			} `json:"filter"`
+		}
+		var raw map[string]any
+		body := json.NewDecoder(r.Body)
+		_ = body.Decode(&raw)
+		b, _ := json.Marshal(raw)
+		_ = json.Unmarshal(b, &req)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.searches = append(f.searches, raw)
+		type hit struct {
+			Score   float64        `json:"score"`
+			Payload map[string]any `json:"payload"`
+		}
+		var hits []hit
+		for _, p := range f.points {
+			if req.Filter != nil {
+				obj, _ := p.Payload[req.Filter.Must[0].Key].(string)
+				if !slices.Contains(req.Filter.Must[0].Match.Any, obj) {
+					continue
+				}
+			}
+			hits = append(hits, hit{Score: cosine(req.Vector, p.Vector), Payload: p.Payload})
+		}
+		sort.Slice(hits, func(a, b int) bool { return hits[a].Score > hits[b].Score })
+		if len(hits) > req.Limit {
+			hits = hits[:req.Limit]
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"result": hits, "status": "ok"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// axisEmbedder embeds known words on their own axis.
+type axisEmbedder struct{}
+
+func (axisEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	axes := map[string][]float32{
+		"cats":   {1, 0, 0},
+		"kitten": {0.9, 0.1, 0},
+		"money":  {0, 1, 0},
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		if v, ok := axes[text]; ok {
+			out[i] = v
+		} else {
+			out[i] = []float32{0, 0, 1}
+		}
+	}
+	return out, nil
+}
+
+func storeDocs() []rag.Document {
+	return []rag.Document{
+		{ID: "a", Text: "cats", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		{ID: "b", Text: "kitten", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:b"}},
+		{ID: "c", Text: "money", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:c"}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeQdrant(t)
+	store := qdrant.New(endpoint, "docs", axisEmbedder{}, 3)
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.True(t, fake.created)
+	require.Equal(t, []string{"spicedb_object", "spicedb_object"}, fake.indexed)
+
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+	require.Len(t, fake.points, 3)
+
+	scored, err := store.RetrieveScored(context.Background(), "cats", 2)
+	require.NoError(t, err)
+	require.Len(t, scored, 2)
+	require.Equal(t, storeDocs()[0], scored[0].Document)
+	require.Equal(t, "b", scored[1].Document.ID)
+	require.InDelta(t, 1, scored[0].Score, 1e-6)
+
+	require.NoError(t, store.Remove(context.Background(), "a"))
+	docs, err := store.Retrieve(context.Background(), "cats", 1)
+	require.NoError(t, err)
+	require.Equal(t, "b", docs[0].ID)
+}
+
+func TestPrefilterPushesDownToPayloadFilter(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeQdrant(t)
+	store := qdrant.New(endpoint, "docs", axisEmbedder{}, 3)
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+
+	pipeline, _ := ragtest.NewPipeline(t, "document", "read", nil,
+		[]string{"document:b#read@user:emilia", "document:c#read@user:emilia"},
+		rag.WithRetriever(store), rag.WithFilterStrategy(rag.FilterPrefilter), rag.WithScanBudget(0, 1))
+
+	// Unfiltered, "a" would take the only slot and then be denied.
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "cats"})
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 1)
+	require.Equal(t, "b", resp.Documents[0].ID)
+
+	require.Equal(t, map[string]any{
+		"must": []any{map[string]any{
+			"key":   "spicedb_object",
+			"match": map[string]any{"any": []any{"document:b", "document:c"}},
+		}},
+	}, fake.searches[0]["filter"])
+}
+
+func TestAPIError(t *testing.T) {
+	t.Parallel()
+
+	_, endpoint := newFakeQdrant(t)
+	err := qdrant.New(endpoint, "missing", axisEmbedder{}, 3).Add(context.Background(), storeDocs()...)
+	var apiErr *qdrant.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
@@ -0,0 +1,119 @@
+// Package qdranttest starts throwaway Qdrant servers in containers via
+// Testcontainers.
+package qdranttest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// DefaultImage is the Qdrant image started when none is configured.
+	DefaultImage = "qdrant/qdrant:v1.12.4"
+
+	// DefaultStartupTimeout bounds how long Run waits for Qdrant to be
+	// ready.
+	DefaultStartupTimeout = time.Minute
+
+	port = "6333/tcp"
+)
+
+// Instance is a running Qdrant container.
+type Instance struct {
+	// Endpoint is the base URL of the REST API, for qdrant.New.
+	Endpoint string
+
+	container testcontainers.Container
+}
+
+// Terminate removes the container.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return i.container.Terminate(ctx)
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	startupTimeout time.Duration
+}
+
+// WithImage overrides the Qdrant image.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// Run starts a Qdrant container. The caller owns the instance and must
+// Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{image: DefaultImage, startupTimeout: DefaultStartupTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.image,
+			ExposedPorts: []string{port},
+			WaitingFor:   wait.ForHTTP("/readyz").WithPort(port).WithStartupTimeout(cfg.startupTimeout),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("qdranttest: starting container: %w", err)
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, port, "http")
+	if err != nil {
+		_ = container.Terminate(ctx)
+		return nil, fmt.Errorf("qdranttest: resolving endpoint: %w", err)
+	}
+	return &Instance{Endpoint: endpoint, container: container}, nil
+}
+
+// Cleanup tears down an instance started by StartQdrant. It is safe to
+// call more than once.
+type Cleanup func()
+
+// StartQdrant runs a Qdrant server for the duration of a test and returns
+// its endpoint. The test is skipped when no container runtime is available
+// and fails if the server cannot be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the server earlier.
+func StartQdrant(t *testing.T, opts ...Option) (string, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("qdranttest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.Endpoint, cleanup
+}
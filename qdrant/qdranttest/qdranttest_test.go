@@ -0,0 +1,41 @@
+package qdranttest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/qdrant"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/qdrant/qdranttest"
+)
+
+// constantEmbedder embeds every text as the same unit vector.
+type constantEmbedder struct{}
+
+func (constantEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i := range texts {
+		out[i] = []float32{1, 0}
+	}
+	return out, nil
+}
+
+func TestStartQdrant(t *testing.T) {
+	t.Parallel()
+
+	endpoint, _ := qdranttest.StartQdrant(t)
+
+	store := qdrant.New(endpoint, "docs", constantEmbedder{}, 2)
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NoError(t, store.Add(context.Background(),
+		rag.Document{ID: "a", Text: "a", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		rag.Document{ID: "b", Text: "b", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:b"}},
+	))
+
+	scored, err := store.RetrieveAccessible(context.Background(), "q", 0, []string{"document:b"})
+	require.NoError(t, err)
+	require.Len(t, scored, 1)
+	require.Equal(t, "b", scored[0].Document.ID)
+}
@@ -2,10 +2,17 @@ package rag
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 	authzed "github.com/authzed/authzed-go/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
 // Document is a trivial "chunk" for the RAG pipeline.
@@ -17,76 +24,640 @@ type Document struct {
 
 // RAGPipeline holds docs and a SpiceDB client used for access checks.
 type RAGPipeline struct {
-	docs         []Document
+	mu       sync.RWMutex
+	docs     []Document      // copy-on-write, see corpus.go
+	reserved map[string]bool // IDs AddDocument is adding
+
 	spiceClient  *authzed.Client
-	resourceType string // e.g. "document"
-	permission   string // e.g. "read"
+	checker      PermissionChecker
+	retriever    Retriever // nil means the built-in substring scan
+	resourceType string    // e.g. "document"
+	permission   string    // e.g. "read"
+	typePerms    map[string]string
+	permissions  *permissionSet // nil checks permission alone
+	mapper       ResourceMapper
+	suggestKey   string
+
+	selfTestRelation   string
+	selfTestTenant     string
+	bulkChunkSize      int
+	consistency        *apiv1.Consistency
+	conditionalPolicy  ConditionalPolicy
+	resolver           ConditionalResolver
+	failurePolicy      FailurePolicy
+	subjectType        string
+	subjectRelation    string
+	chunker            Chunker
+	cacheTTL           time.Duration
+	cacheEntries       int
+	deniedCacheTTL     time.Duration
+	deniedCacheEntries int
+	retry              *RetryPolicy
+	checkConcurrency   int
+	strategy           FilterStrategy
+	planner            *planState
+	access             *accessStore
+	order              ResultOrder
+	reranker           Reranker
+	rerankStage        RerankStage
+	mmr                bool
+	mmrLambda          float64
+	similarity         Similarity
+	snippets           snippetConfig
+	generator          Generator
+	prompt             PromptFunc
+	contextBudget      *ContextBudget
+	tracerProvider     trace.TracerProvider
+	metrics            *Collector
+	auditor            Auditor
+	impersonation      string // permission, see WithImpersonationPermission
+	shadow             bool
+
+	// scan budget, see WithScanBudget. Zero means unlimited.
+	maxDocsScanned int
+	maxMatches     int
+	budgetPolicy   BudgetPolicy
+
+	maxDocumentBytes int
+	strictMapping    bool
+	tenancy          bool
+	tenantPrefixes   bool
+	largestDocument  int
+	rejected         []RejectedDocument
 }
 
-// NewRAGPipeline constructs a new pipeline.
-func NewRAGPipeline(spiceClient *authzed.Client, resourceType, permission string, docs []Document) *RAGPipeline {
-	return &RAGPipeline{
-		docs:         docs,
-		spiceClient:  spiceClient,
-		resourceType: resourceType,
-		permission:   permission,
+// NewRAGPipeline constructs a new pipeline. Documents failing ingestion
+// limits (see WithMaxDocumentBytes and WithStrictMapping) are left out
+// and reported by Rejected.
+func NewRAGPipeline(spiceClient *authzed.Client, resourceType, permission string, docs []Document, opts ...Option) *RAGPipeline {
+	r := &RAGPipeline{
+		spiceClient:      spiceClient,
+		resourceType:     resourceType,
+		permission:       permission,
+		maxDocumentBytes: DefaultMaxDocumentBytes,
+		selfTestRelation: "viewer",
+		selfTestTenant:   "selftest",
+		subjectType:      DefaultSubjectType,
+		impersonation:    DefaultImpersonationPermission,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.checker == nil {
+		r.checker = &SpiceDBChecker{client: spiceClient, chunkSize: r.bulkChunkSize}
+	}
+	if r.access != nil && r.strategy == FilterPostCheck {
+		r.strategy = FilterPrefilter
+	}
+	if r.strategy == FilterAdaptive && r.planner == nil {
+		r.planner = newPlanState(Planner{})
+	}
+	if r.retry != nil {
+		r.checker = NewRetryingChecker(r.checker, *r.retry)
+	}
+	if r.cacheTTL > 0 || r.deniedCacheTTL > 0 {
+		var opts []CacheOption
+		if r.deniedCacheTTL > 0 {
+			opts = append(opts, CacheDenials(r.deniedCacheTTL, r.deniedCacheEntries))
+		}
+		cache := NewCachingChecker(r.checker, r.cacheTTL, r.cacheEntries, opts...)
+		r.metrics.addCache(cache)
+		r.checker = cache
+	}
+
+	for _, d := range docs {
+		admitted, err := r.ingest(d)
+		if err != nil {
+			r.rejected = append(r.rejected, RejectedDocument{ID: d.ID, Err: err})
+			continue
+		}
+		for _, d := range admitted {
+			r.docs = append(r.docs, d)
+			r.largestDocument = max(r.largestDocument, len(d.Text))
+		}
 	}
+	return r
 }
 
 // Query performs a trivial "retrieval" and then filters with SpiceDB.
-// - retrieval: substring match on Text
-// - filtering: CheckPermission(user, permission, resource) via SpiceDB
-func (r *RAGPipeline) Query(ctx context.Context, userID, query string) ([]Document, error) {
-	var candidates []Document
-	lq := strings.ToLower(query)
+// - retrieval: substring match on Text, or the Retriever from WithRetriever
+// - filtering: CheckBulkPermissions(user, permission, resources) via SpiceDB
+//
+// The check goes through the pipeline's PermissionChecker, which is
+// SpiceDB unless WithPermissionChecker says otherwise.
+//
+// Query is the original entry point and is kept for compatibility; it
+// behaves exactly like Do(ctx, MigrateLegacyCall(userID, query)).
+func (r *RAGPipeline) Query(ctx context.Context, userID, query string, opts ...QueryOption) ([]Document, error) {
+	qc := newQueryConfig(opts)
+	resp, err := r.do(ctx, qc.request(userID, query))
+	if qc.stats != nil {
+		*qc.stats = resp.Stats
+	}
+	if err != nil {
+		return nil, err
+	}
+	if qc.cursor != nil {
+		*qc.cursor = resp.NextCursor
+	}
+	return resp.Documents, nil
+}
 
-	// naive retrieval
-	for _, d := range r.docs {
-		if strings.Contains(strings.ToLower(d.Text), lq) {
-			candidates = append(candidates, d)
+// do runs a query in a "rag.query" span and records it in the pipeline's
+// Collector, if any. It always returns a non-nil response so the stats
+// gathered so far survive an error.
+func (r *RAGPipeline) do(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	ctx, span := r.tracer().Start(ctx, "rag.query", trace.WithAttributes(
+		attribute.Bool("rag.prefilter", r.strategy == FilterPrefilter),
+		attribute.Int("rag.top_k", req.TopK),
+	))
+	start := time.Now()
+	resp, err := r.query(ctx, req)
+	r.metrics.observeQuery(resp.Stats, time.Since(start), err)
+	span.SetAttributes(statsAttributes(resp.Stats)...)
+	span.SetAttributes(attribute.Int("rag.returned", len(resp.Documents)))
+	endSpan(span, err)
+	return resp, err
+}
+
+func (r *RAGPipeline) query(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	q, err := r.prepare(ctx, req)
+	if err != nil {
+		return q.resp, err
+	}
+	if q.paged() {
+		err = q.page()
+	} else {
+		err = q.decideAll()
+		q.resp.truncate(req.TopK)
+	}
+	if err != nil {
+		return q.resp, err
+	}
+	explainerFromContext(q.ctx).finish(q.resp)
+	return q.resp, nil
+}
+
+// pendingQuery is a query that has retrieved its candidates but not yet
+// authorized them.
+type pendingQuery struct {
+	r       *RAGPipeline
+	ctx     context.Context // carries consistency and caveat context
+	req     QueryRequest
+	subject *apiv1.SubjectReference
+	resp    *QueryResponse
+
+	// docs are the candidates left to authorize, and resources their
+	// objects. Under the prefilter strategy there are none: the
+	// candidates were decided during retrieval.
+	docs      []ScoredDocument
+	resources []*apiv1.ObjectReference
+
+	// plan is how docs are authorized, see planQuery.
+	plan Plan
+}
+
+// prepare runs a query up to authorization. It always returns a
+// pendingQuery with a non-nil resp, so the stats gathered so far survive
+// an error.
+func (r *RAGPipeline) prepare(ctx context.Context, req QueryRequest) (*pendingQuery, error) {
+	q := &pendingQuery{r: r, ctx: ctx, resp: &QueryResponse{}}
+	stats := &q.resp.Stats
+	req = req.withContextSubject(ctx)
+	q.req = req
+	if err := req.Validate(); err != nil {
+		return q, err
+	}
+	if err := r.validateTenant(req.Tenant); err != nil {
+		return q, err
+	}
+
+	r.mu.RLock()
+	stats.LargestDocumentBytes = r.largestDocument
+	r.mu.RUnlock()
+
+	ctx = contextWithConsistency(ctx, r.consistencyFor(req.Consistency))
+	ctx = contextWithPermissions(ctx, r.permissionsFor(req))
+	ctx, err := contextWithCaveat(ctx, req.CaveatContext)
+	if err != nil {
+		return q, err
+	}
+	q.ctx = ctx
+	subject := r.querySubject(req)
+	q.subject = subject
+
+	retrieveCtx, span := r.tracer().Start(ctx, "rag.retrieve")
+	candidates, accessible, err := r.candidates(retrieveCtx, subject, req.Tenant, req.Query, stats)
+	span.SetAttributes(
+		attribute.Int("rag.docs_scanned", stats.DocsScanned),
+		attribute.Int("rag.candidates", len(candidates)),
+	)
+	endSpan(span, err)
+	if err != nil {
+		return q, err
+	}
+	stats.Accessible = definitelyAccessible(accessible)
+	ex := explainerFromContext(ctx)
+	ex.retrieved(r, candidates)
+	if r.retriever == nil {
+		ex.scanned(r, req.Query, accessible)
+	}
+	if req.MinScore != 0 {
+		candidates = slices.DeleteFunc(candidates, func(d ScoredDocument) bool {
+			if d.Score < req.MinScore {
+				ex.drop(d.Document, OutcomeFiltered, DecisionDenied, "below MinScore")
+				return true
+			}
+			return false
+		})
+	}
+	if len(req.Filters) > 0 {
+		candidates = slices.DeleteFunc(candidates, func(d ScoredDocument) bool {
+			if !req.matches(d.Document) {
+				ex.drop(d.Document, OutcomeFiltered, DecisionDenied, "metadata filter")
+				return true
+			}
+			return false
+		})
+	}
+
+	if r.reranks(RerankBeforeFilter) {
+		if candidates, err = r.rerank(ctx, req.Query, candidates, DecisionDenied, stats); err != nil {
+			return q, err
 		}
 	}
+	r.sortCandidates(candidates)
 
-	var allowed []Document
+	if stats.BudgetExceeded && r.budgetPolicy == BudgetReject && ex == nil {
+		return q, fmt.Errorf("%w: stopped after scanning %d documents with %d matches",
+			ErrQueryTooBroad, stats.DocsScanned, stats.Candidates)
+	}
+
+	if r.strategy == FilterPrefilter {
+		stats.Plan = PlanLookup
+		q.plan = PlanLookup
+		return q, q.restrict(candidates, accessible)
+	}
 
+	q.docs = make([]ScoredDocument, 0, len(candidates))
+	q.resources = make([]*apiv1.ObjectReference, 0, len(candidates))
 	for _, d := range candidates {
-		spiceObj := d.Metadata["spicedb_object"]
-		if spiceObj == "" {
-			// If there's no SpiceDB mapping, treat as non-readable
+		res, err := r.resourceFor(d.Document)
+		if err != nil {
+			// If there's no usable SpiceDB mapping, treat as non-readable
+			stats.Unmapped++
+			ex.drop(d.Document, OutcomeUnmapped, DecisionDenied, err.Error())
 			continue
 		}
+		q.docs = append(q.docs, d)
+		q.resources = append(q.resources, res)
+	}
+	return q, q.planQuery()
+}
 
-		// We store IDs as e.g. "document:doc1"
-		parts := strings.SplitN(spiceObj, ":", 2)
-		if len(parts) != 2 {
-			continue
+// decide authorizes docs, whose objects are resources, and adds those the
+// subject may read to the response, in order.
+func (q *pendingQuery) decide(docs []ScoredDocument, resources []*apiv1.ObjectReference) error {
+	results, err := q.authorize(docs, resources)
+	if err != nil {
+		return err
+	}
+	allowed := 0
+	for _, res := range results {
+		if res.Err == nil && res.Decision == DecisionAllowed {
+			allowed++
 		}
-		objType, objID := parts[0], parts[1]
+	}
+	q.sample(len(results), allowed)
+
+	for i, d := range docs {
+		if err := q.admit(d, resources[i], results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		res := &apiv1.ObjectReference{
-			ObjectType: objType,
-			ObjectId:   objID,
+// authorize checks docs, whose objects are resources, resolving the
+// conditional results with the pipeline's ConditionalResolver.
+func (q *pendingQuery) authorize(docs []ScoredDocument, resources []*apiv1.ObjectReference) ([]CheckResult, error) {
+	results, err := q.r.authorize(q.ctx, q.subject, resources, q.plan, &q.resp.Stats)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.resolveConditional(docs, resources, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// admit adds d, whose object is resource, to the response if result
+// allows it, and otherwise records why it was left out.
+func (q *pendingQuery) admit(d ScoredDocument, resource *apiv1.ObjectReference, result CheckResult) error {
+	r, ctx, resp, stats := q.r, q.ctx, q.resp, &q.resp.Stats
+	ex := explainerFromContext(ctx)
+
+	if err := result.Err; err != nil {
+		err = backendError(ctx, err)
+		ce := CheckError{DocumentID: d.Document.ID, Resource: objectKey(resource), Err: err}
+		resp.CheckErrors = append(resp.CheckErrors, ce)
+		stats.CheckErrors++
+		if r.failurePolicy == FailOpen {
+			resp.add(d, DecisionAllowed, q.req.Query, r.snippets)
+			resp.Results[len(resp.Results)-1].CheckErr = err
+			return nil
+		}
+		ex.drop(d.Document, OutcomeDenied, DecisionDenied, ce.Error())
+		return nil
+	}
+	switch result.Decision {
+	case DecisionAllowed:
+		resp.add(d, DecisionAllowed, q.req.Query, r.snippets)
+		stats.Allowed++
+	case DecisionConditional:
+		if r.shadows(ctx) {
+			return r.admitShadowed(ctx, resp, q.subject, q.req.Query, d, resource, DecisionConditional)
+		}
+		ex.drop(d.Document, OutcomeDenied, DecisionConditional, "")
+		if err := r.audit(ctx, q.subject, d.Document, resource, DecisionConditional); err != nil {
+			return err
 		}
-		subject := &apiv1.SubjectReference{
-			Object: &apiv1.ObjectReference{
-				ObjectType: "user",
-				ObjectId:   userID,
-			},
+		if r.conditionalPolicy == ConditionalReject && ex == nil {
+			return ConditionalError{DocumentID: d.Document.ID, Resource: objectKey(resource), Missing: result.MissingContext}
 		}
+		stats.Conditional++
+	default:
+		if r.shadows(ctx) {
+			return r.admitShadowed(ctx, resp, q.subject, q.req.Query, d, resource, DecisionDenied)
+		}
+		ex.drop(d.Document, OutcomeDenied, DecisionDenied, "")
+		if err := r.audit(ctx, q.subject, d.Document, resource, DecisionDenied); err != nil {
+			return err
+		}
+		stats.Denied++
+	}
+	return nil
+}
 
-		resp, err := r.spiceClient.CheckPermission(ctx, &apiv1.CheckPermissionRequest{
-			Resource:   res,
-			Permission: r.permission,
-			Subject:    subject,
+// candidates retrieves the documents of tenant (all documents if it is
+// empty) matching query. Under the prefilter strategy it also returns the
+// set of objects subject can access, keyed as by objectKey; the built-in
+// scan is then restricted to that set. SelfTest's queries scan its corpus
+// instead.
+func (r *RAGPipeline) candidates(ctx context.Context, subject *apiv1.SubjectReference, tenant, query string, stats *Stats) ([]ScoredDocument, map[string]bool, error) {
+	corpus, selfTest := selfTestCorpus(ctx)
+	if fr, ok := r.retriever.(FilteringRetriever); ok && r.strategy == FilterPrefilter && !r.shadows(ctx) && !selfTest {
+		accessible, objects, err := r.accessibleObjects(ctx, subject, tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(objects) == 0 {
+			return nil, accessible, nil
+		}
+		candidates, err := r.retrieveWith(ctx, query, stats, func(ctx context.Context, query string, limit int) ([]ScoredDocument, error) {
+			return fr.RetrieveAccessible(ctx, query, limit, objects)
 		})
+		return tenantCandidates(candidates, tenant, stats), accessible, err
+	}
+	if r.retriever != nil && !selfTest {
+		candidates, err := r.retrieveWith(ctx, query, stats, nil)
+		candidates = tenantCandidates(candidates, tenant, stats)
+		if err != nil || r.strategy != FilterPrefilter {
+			return candidates, nil, err
+		}
+		// An external index cannot be restricted up front, so look up
+		// access for the resource types it returned instead.
+		_, accessible, err := r.accessibleSet(ctx, subject, documentsOf(candidates))
+		return candidates, accessible, err
+	}
+
+	if !selfTest {
+		corpus = r.snapshot()
+	}
+	corpus = tenantDocs(corpus, tenant)
+	if r.strategy != FilterPrefilter {
+		return substringScored(r.retrieve(corpus, query, stats, nil)), nil, nil
+	}
+	keys, accessible, err := r.accessibleSet(ctx, subject, corpus)
+	if err != nil {
+		return nil, nil, err
+	}
+	keep := func(i int) bool {
+		_, ok := accessible[keys[i]]
+		return keys[i] != "" && ok
+	}
+	if r.shadows(ctx) {
+		// Retrieve what enforcement would leave out too.
+		keep = nil
+	}
+	return substringScored(r.retrieve(corpus, query, stats, keep)), accessible, nil
+}
+
+// authorize decides every resource for subject, in one bulk round trip
+// per chunk when the checker supports it and plan is not PlanCheckEach,
+// and with up to checkConcurrency concurrent Check calls otherwise.
+// Under FailClosed any failed check fails the whole call; otherwise
+// failures are returned as the Err of the affected results, and a
+// request that failed as a whole fails every resource it carried.
+func (r *RAGPipeline) authorize(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, plan Plan, stats *Stats) (results []CheckResult, err error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+
+	start := time.Now()
+	ctx, span := r.tracer().Start(ctx, "rag.authorize", trace.WithAttributes(attribute.Int("rag.resources", len(resources))))
+	defer func() {
+		err = backendError(ctx, err)
+		r.metrics.observePermissionCheck(time.Since(start), err)
+		allowed, failed := 0, 0
+		for _, res := range results {
+			if res.Err != nil {
+				failed++
+			} else if res.Decision == DecisionAllowed {
+				allowed++
+			}
+		}
+		span.SetAttributes(attribute.Int("rag.checked", stats.Checked), attribute.Int("rag.allowed", allowed))
+		if failed > 0 {
+			span.SetAttributes(attribute.Int("rag.check_errors", failed))
+		}
+		endSpan(span, err)
+	}()
+
+	groups := r.byPermission(ctx, resources)
+	if len(groups) == 1 && len(groups[0].set.perms) == 1 {
+		return r.check(ctx, subject, resources, groups[0].set.perms[0], plan, stats)
+	}
+	results = make([]CheckResult, len(resources))
+	for _, g := range groups {
+		decided, err := r.checkSet(ctx, subject, g.resources, g.set, plan, stats)
 		if err != nil {
 			return nil, err
 		}
+		for i, idx := range g.indexes {
+			results[idx] = decided[i]
+		}
+	}
+	return results, nil
+}
+
+// permissionGroup is the resources of one authorize call that are
+// checked for the same permissions, and their indexes in the call.
+type permissionGroup struct {
+	set       permissionSet
+	indexes   []int
+	resources []*apiv1.ObjectReference
+}
+
+// byPermission groups resources by the permissions they are checked for,
+// in order of first occurrence.
+func (r *RAGPipeline) byPermission(ctx context.Context, resources []*apiv1.ObjectReference) []*permissionGroup {
+	var groups []*permissionGroup
+	index := make(map[string]*permissionGroup)
+	for i, res := range resources {
+		set := r.permissionsOf(ctx, res.GetObjectType())
+		g, ok := index[set.String()]
+		if !ok {
+			g = &permissionGroup{set: set}
+			index[set.String()] = g
+			groups = append(groups, g)
+		}
+		g.indexes = append(g.indexes, i)
+		g.resources = append(g.resources, res)
+	}
+	return groups
+}
 
-		if resp.Permissionship == apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION {
-			allowed = append(allowed, d)
+// checkSet decides resources for subject's permissions in ps, checking
+// each permission only on the resources the ones before left undecided.
+func (r *RAGPipeline) checkSet(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, ps permissionSet, plan Plan, stats *Stats) ([]CheckResult, error) {
+	results := make([]CheckResult, len(resources))
+	pending := make([]int, len(resources))
+	for i := range pending {
+		pending[i] = i
+	}
+	for n, perm := range ps.perms {
+		batch := make([]*apiv1.ObjectReference, len(pending))
+		for j, i := range pending {
+			batch[j] = resources[i]
+		}
+		decided, err := r.check(ctx, subject, batch, perm, plan, stats)
+		if err != nil {
+			return nil, err
+		}
+		undecided := pending[:0]
+		for j, i := range pending {
+			results[i] = ps.combine(results[i], decided[j], n == 0)
+			if !ps.decided(results[i]) {
+				undecided = append(undecided, i)
+			}
+		}
+		if pending = undecided; len(pending) == 0 {
+			break
+		}
+	}
+	return results, nil
+}
+
+// check decides resources for subject's permission, as described for
+// authorize.
+func (r *RAGPipeline) check(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string, plan Plan, stats *Stats) ([]CheckResult, error) {
+	failFast := r.failurePolicy == FailClosed
+	if bulk, ok := r.checkerFor(ctx).(BulkPermissionChecker); ok && plan != PlanCheckEach {
+		results, err := bulk.CheckBulk(ctx, subject, resources, permission)
+		if err != nil {
+			if failFast || ctx.Err() != nil {
+				return nil, err
+			}
+			return failedResults(len(resources), err), nil
+		}
+		stats.Checked += len(results)
+		if failFast {
+			for _, res := range results {
+				if res.Err != nil {
+					return nil, res.Err
+				}
+			}
+		}
+		return results, nil
+	}
+
+	results, checked, err := checkEach(ctx, r.checkerFor(ctx), subject, resources, permission, r.checkConcurrency, failFast)
+	stats.Checked += checked
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// failedResults is n results that all failed with err.
+func failedResults(n int, err error) []CheckResult {
+	results := make([]CheckResult, n)
+	for i := range results {
+		results[i].Err = err
+	}
+	return results
+}
+
+// checkEach decides every resource with one Check call each, running up
+// to limit of them at once (DefaultCheckConcurrency if limit <= 0). With
+// failFast it stops at the first error; otherwise failed checks are
+// reported as the Err of their result and only a done ctx is an error.
+// It also reports how many checks were issued.
+func checkEach(ctx context.Context, checker PermissionChecker, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string, limit int, failFast bool) ([]CheckResult, int, error) {
+	if limit <= 0 {
+		limit = DefaultCheckConcurrency
+	}
+
+	var checked atomic.Int64
+	results := make([]CheckResult, len(resources))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+	for i, res := range resources {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				// An earlier check failed; don't start new ones.
+				return err
+			}
+			checked.Add(1)
+			decision, err := checker.Check(gctx, subject, res, permission)
+			if err != nil {
+				if failFast || ctx.Err() != nil {
+					return err
+				}
+				results[i] = CheckResult{Err: err}
+				return nil
+			}
+			results[i] = CheckResult{Decision: decision}
+			return nil
+		})
+	}
+	err := g.Wait()
+	return results, int(checked.Load()), err
+}
+
+// retrieve runs the naive substring scan over docs, honouring the
+// pipeline's scan budget. When keep is set, documents it rejects are
+// skipped without counting against the budget.
+func (r *RAGPipeline) retrieve(docs []Document, query string, stats *Stats, keep func(i int) bool) []Document {
+	var candidates []Document
+	m := newMatcher(query)
+
+	for i, d := range docs {
+		if keep != nil && !keep(i) {
+			continue
+		}
+		if r.budgetExhausted(stats.DocsScanned, len(candidates)) {
+			stats.BudgetExceeded = true
+			break
+		}
+		stats.DocsScanned++
+
+		if m.match(d.Text) {
+			candidates = append(candidates, d)
 		}
 	}
 
-	return allowed, nil
+	stats.Candidates = len(candidates)
+	return candidates
 }
@@ -1,28 +1,24 @@
 package rag_test
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"testing"
 	"time"
 
-	spicedbcontainer "github.com/Mariscal6/testcontainers-spicedb-go"
 	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 	authzed "github.com/authzed/authzed-go/v1"
-	"github.com/authzed/grpcutil"
 	"github.com/stretchr/testify/require"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/spicedbtest"
 )
 
 // Shared test constants
 const (
-	testImage       = "authzed/spicedb:v1.46.2" // or any recent SpiceDB image
-	testPreshared   = "somepresharedkey"
 	spiceDBTypeDoc  = "document"
 	spiceDBPermRead = "read"
 )
@@ -33,89 +29,14 @@ const (
 func TestRAGWithSpiceDBPermissions(t *testing.T) {
 	t.Parallel()
 
-	ctx := context.Background()
+	ctx, client := startSpiceDB(t)
 
-	// 1. Start SpiceDB via the community Testcontainers module
-	container, err := spicedbcontainer.Run(ctx, testImage)
-	require.NoError(t, err, "failed to start SpiceDB container")
-
-	{
-		logs, err := container.Logs(ctx)
-		require.NoError(t, err)
-
-		buf := new(bytes.Buffer)
-		_, _ = io.Copy(buf, logs)
-
-		t.Logf("=== SpiceDB Container Logs ===\n%s\n===============================\n", buf.String())
-	}
-
-	defer func() { _ = container.Terminate(ctx) }()
-
-	// Discover host:port for gRPC (50051 inside container)
-	host, err := container.Host(ctx)
-	require.NoError(t, err)
-
-	mappedPort, err := container.MappedPort(ctx, "50051/tcp")
-	require.NoError(t, err)
-
-	endpoint := fmt.Sprintf("%s:%s", host, mappedPort.Port())
-
-	// 2. Connect to this SpiceDB using the insecure local pattern
-	client, err := authzed.NewClient(
-		endpoint,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpcutil.WithInsecureBearerToken(testPreshared),
-	)
-	require.NoError(t, err, "failed to create authzed client")
-
-	// Give SpiceDB a moment if needed (depending on config)
-	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
-
-	// 3. Write a minimal schema + relationships:
-	//
-	// definition user {}
-	//
-	// definition document {
-	//   relation owner: user
-	//   relation viewer: user | owner
-	//   permission read = owner + viewer
-	// }
-	//
-	// Emilia owns doc1, Beatrice can view doc2, everyone can view doc3.
-	writeTestSchema(t, ctx, client)
-	writeTestTuples(t, ctx, client)
-
-	// 4. Prepare 3 documents for the RAG index.
+	// Prepare 3 documents for the RAG index.
 	//
 	// Important: metadata.spicedb_object matches the SpiceDB object IDs we wrote.
-	docs := []rag.Document{
-		{
-			ID:   "doc1",
-			Text: "Internal roadmap for 2025. Highly confidential.",
-			Metadata: map[string]string{
-				"spicedb_object": "document:doc1",
-			},
-		},
-		{
-			ID:   "doc2",
-			Text: "Customer success playbook and escalation procedures.",
-			Metadata: map[string]string{
-				"spicedb_object": "document:doc2",
-			},
-		},
-		{
-			ID:   "doc3",
-			Text: "Public FAQ for all users.",
-			Metadata: map[string]string{
-				"spicedb_object": "document:doc3",
-			},
-		},
-	}
-
-	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, docs)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
 
-	// 5. Run some queries as different users and assert which docs appear.
+	// Run some queries as different users and assert which docs appear.
 
 	// Emilia should see doc1 + doc3, but not doc2.
 	{
@@ -139,86 +60,75 @@ func TestRAGWithSpiceDBPermissions(t *testing.T) {
 		requireEqualDocIDs(t, []string{"doc3"}, results)
 	}
 
-	// A random user 'charlie' should only see the public doc3.
-	{
-		results, err := pipeline.Query(ctx, "charlie", "public")
+	// A random user 'charlie' should only see the public doc3, as should
+	// a user with no relationships at all.
+	for _, user := range []string{"charlie", "dora"} {
+		results, err := pipeline.Query(ctx, user, "public")
 		require.NoError(t, err)
 		requireEqualDocIDs(t, []string{"doc3"}, results)
 	}
 }
 
-// writeTestSchema configures a tiny SpiceDB schema for documents/users.
-func writeTestSchema(t *testing.T, ctx context.Context, client *authzed.Client) {
-	t.Helper()
+func TestWritePublicRelationshipsWithSpiceDB(t *testing.T) {
+	t.Parallel()
 
-	schema := `
-definition user {}
+	ctx, client := startSpiceDB(t)
+	docs := append(scenarioDocs(), rag.MarkPublic(rag.Document{
+		ID:       "doc4",
+		Text:     "Public holiday calendar.",
+		Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc4"},
+	}))
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, docs)
 
-definition document {
-  relation owner: user
-  relation viewer: user
+	token, err := pipeline.WritePublicRelationships(ctx, "viewer")
+	require.NoError(t, err)
+	require.NotEmpty(t, token.GetToken())
 
-  permission read = owner + viewer
-}
-`
-	_, err := client.WriteSchema(ctx, &apiv1.WriteSchemaRequest{
-		Schema: schema,
-	})
-	require.NoError(t, err, "failed to write schema")
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, docs, rag.WithFilterStrategy(strategy))
+		results, err := pipeline.Query(ctx, "dora", "public", rag.WithConsistency(rag.AtLeastAsFresh(token)))
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc3", "doc4"}, results)
+	}
 }
 
-// writeTestTuples seeds a few relationships in SpiceDB:
-// - Emilia owns doc1
-// - Beatrice can view doc2
-// - Everyone can view doc3 (via viewer).
-func writeTestTuples(t *testing.T, ctx context.Context, client *authzed.Client) {
+// startSpiceDB runs a fresh SpiceDB Testcontainer seeded with the test
+// schema and relationships, and returns a connected client. The container
+// is terminated when the test ends. Tests are skipped when no container
+// runtime is available.
+func startSpiceDB(t *testing.T) (context.Context, *authzed.Client) {
 	t.Helper()
 
-	var updates []*apiv1.RelationshipUpdate
-
-	// Emilia owns doc1
-	updates = append(updates, relUpdate(
-		spiceDBTypeDoc, "doc1",
-		"owner",
-		"user", "emilia",
-	))
-
-	// Beatrice views doc2
-	updates = append(updates, relUpdate(
-		spiceDBTypeDoc, "doc2",
-		"viewer",
-		"user", "beatrice",
-	))
-
-	// Everyone can view doc3 (viewer for emilia + beatrice + charlie)
-	for _, userID := range []string{"emilia", "beatrice", "charlie"} {
-		updates = append(updates, relUpdate(
-			spiceDBTypeDoc, "doc3",
-			"viewer",
-			"user", userID,
-		))
-	}
+	client, _ := spicedbtest.StartSpiceDB(t, spicedbtest.WithFixtureFile("testdata/scenario.yaml"))
 
-	_, err := client.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{
-		Updates: updates,
-	})
-	require.NoError(t, err, "failed to write relationships")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	return ctx, client
 }
 
-func relUpdate(resType, resID, relation, subjType, subjID string) *apiv1.RelationshipUpdate {
-	return &apiv1.RelationshipUpdate{
-		Operation: apiv1.RelationshipUpdate_OPERATION_CREATE,
-		Relationship: &apiv1.Relationship{
-			Resource: &apiv1.ObjectReference{
-				ObjectType: resType,
-				ObjectId:   resID,
+// scenarioDocs returns the three documents seeded by testdata/scenario.yaml.
+func scenarioDocs() []rag.Document {
+	return []rag.Document{
+		{
+			ID:   "doc1",
+			Text: "Internal roadmap for 2025. Highly confidential.",
+			Metadata: map[string]string{
+				"spicedb_object": "document:doc1",
 			},
-			Relation: relation,
-			Subject: &apiv1.SubjectReference{
-				Object: &apiv1.ObjectReference{
-					ObjectType: subjType,
-					ObjectId:   subjID,
-				},
+		},
+		{
+			ID:   "doc2",
+			Text: "Customer success playbook and escalation procedures.",
+			Metadata: map[string]string{
+				"spicedb_object": "document:doc2",
+			},
+		},
+		{
+			ID:   "doc3",
+			Text: "Public FAQ for all users.",
+			Metadata: map[string]string{
+				"spicedb_object": "document:doc3",
 			},
 		},
 	}
@@ -244,3 +154,165 @@ func requireEqualDocIDs(t *testing.T, expected []string, docs []rag.Document) {
 		}
 	}
 }
+
+func TestExportACLAnnotationsWithSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	ctx, client := startSpiceDB(t)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
+
+	export, err := pipeline.ExportACLAnnotations(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, export.ZedToken.GetToken())
+	require.Equal(t, map[string][]string{
+		"doc1": {"user:emilia"},
+		"doc2": {"user:beatrice"},
+		"doc3": {"user:*"},
+	}, export.Principals)
+}
+
+func TestSuggestWithSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	ctx, client := startSpiceDB(t)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
+
+	// "confidential" only appears in doc1, which charlie cannot read.
+	got, err := pipeline.Suggest(ctx, "charlie", "conf", 10)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	got, err = pipeline.Suggest(ctx, "emilia", "conf", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"confidential"}, got)
+}
+
+func TestSelfTestWithSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	ctx, client := startSpiceDB(t)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
+
+	before := readAllRelationships(t, ctx, client)
+	require.NoError(t, pipeline.SelfTest(ctx))
+	require.Equal(t, before, readAllRelationships(t, ctx, client), "self test left relationships behind")
+
+	var stats rag.Stats
+	_, err := pipeline.Query(ctx, "emilia", "selftest", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.DocsScanned, "self test left documents behind")
+	require.Zero(t, stats.Candidates)
+}
+
+// readAllRelationships returns every document relationship as a sorted
+// list of strings.
+func readAllRelationships(t *testing.T, ctx context.Context, client *authzed.Client) []string {
+	t.Helper()
+
+	stream, err := client.ReadRelationships(ctx, &apiv1.ReadRelationshipsRequest{
+		Consistency: &apiv1.Consistency{
+			Requirement: &apiv1.Consistency_FullyConsistent{FullyConsistent: true},
+		},
+		RelationshipFilter: &apiv1.RelationshipFilter{ResourceType: spiceDBTypeDoc},
+	})
+	require.NoError(t, err)
+
+	var rels []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		rel := resp.GetRelationship()
+		rels = append(rels, fmt.Sprintf("%s:%s#%s@%s:%s",
+			rel.GetResource().GetObjectType(), rel.GetResource().GetObjectId(), rel.GetRelation(),
+			rel.GetSubject().GetObject().GetObjectType(), rel.GetSubject().GetObject().GetObjectId()))
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+// TestLegacyQueryCompatibilityWithSpiceDB runs the original scenario through
+// the legacy Query and Do and requires byte-identical output.
+func TestLegacyQueryCompatibilityWithSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	ctx, client := startSpiceDB(t)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
+
+	legacy := runLegacyScenario(t, legacyAPI(ctx, pipeline))
+	current := runLegacyScenario(t, doAPI(ctx, pipeline))
+	require.Equal(t, string(legacy), string(current))
+}
+
+func TestGrantAccessWithSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	ctx, client := startSpiceDB(t)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
+
+	token, err := pipeline.GrantAccess(ctx, "doc2", "viewer", "user:charlie")
+	require.NoError(t, err)
+	results, err := pipeline.Query(ctx, "charlie", "playbook", rag.WithConsistency(rag.AtLeastAsFresh(token)))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+
+	acl, err := pipeline.ListAccess(ctx, "doc2")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{
+		{Relation: "viewer", Subject: "user:beatrice"},
+		{Relation: "viewer", Subject: "user:charlie"},
+	}, acl)
+
+	token, err = pipeline.RevokeAccess(ctx, "doc2", "viewer", "user:charlie")
+	require.NoError(t, err)
+	results, err = pipeline.Query(ctx, "charlie", "playbook", rag.WithConsistency(rag.AtLeastAsFresh(token)))
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+// TestNestedGroupsWithSpiceDB grants documents to groups instead of users,
+// using testdata/groups.yaml: sre is a member of eng, so Beatrice reads
+// eng's documents without a tuple of her own.
+func TestNestedGroupsWithSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	client, _ := spicedbtest.StartSpiceDB(t, spicedbtest.WithFixtureFile("testdata/groups.yaml"))
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+	pipeline := rag.NewRAGPipeline(client, spiceDBTypeDoc, spiceDBPermRead, scenarioDocs())
+
+	results, err := pipeline.Query(ctx, "beatrice", "roadmap")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	results, err = pipeline.Query(ctx, "emilia", "playbook")
+	require.NoError(t, err)
+	require.Empty(t, results, "membership is not inherited upwards")
+
+	// A group can be queried for as a subject set.
+	results, err = pipeline.QueryAsSubject(ctx, "group:sre#member", "playbook")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+
+	subjects, err := pipeline.WhoCanRead(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []rag.Subject{
+		{Type: "user", ID: "beatrice"},
+		{Type: "user", ID: "emilia"},
+	}, subjects, "groups are resolved to their members")
+
+	token, err := pipeline.GrantAccess(ctx, "doc3", "viewer", "group:eng#member")
+	require.NoError(t, err)
+	results, err = pipeline.Query(ctx, "beatrice", "public", rag.WithConsistency(rag.AtLeastAsFresh(token)))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc3"}, results)
+
+	acl, err := pipeline.ListAccess(ctx, "doc3")
+	require.NoError(t, err)
+	require.Equal(t, []rag.ACLEntry{
+		{Relation: "viewer", Subject: "group:eng#member"},
+		{Relation: "viewer", Subject: "user:carl"},
+	}, acl, "ListAccess shows the direct grants")
+}
@@ -0,0 +1,221 @@
+// Package ragmcp serves a rag.RAGPipeline to agents over the Model
+// Context Protocol (MCP). It exposes a single tool, search_documents,
+// which runs a query as the end user of the MCP session, so assistants
+// and agentic IDEs only ever retrieve documents that user may read.
+//
+// Two transports are provided. HTTPHandler serves MCP's Streamable HTTP
+// transport, authenticating every request with a ragserver.Authenticator
+// and binding each session to the user who initialized it. ServeStdio
+// serves a local client over stdin and stdout as one fixed user, the way
+// IDEs launch MCP servers as subprocesses.
+//
+// Only the parts of the protocol the tool needs are implemented:
+// initialization, ping, tools/list and tools/call, with JSON responses
+// rather than server-sent event streams.
+package ragmcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// ProtocolVersion is the latest MCP revision the server speaks. Clients
+// asking for an older supported revision get that one.
+const ProtocolVersion = "2025-06-18"
+
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// SearchTool is the name of the tool the server exposes.
+const SearchTool = "search_documents"
+
+// DefaultTopK bounds search results when the tool call sets no top_k.
+const DefaultTopK = 5
+
+// Server answers MCP requests with a pipeline.
+type Server struct {
+	pipeline *rag.RAGPipeline
+	name     string
+	version  string
+	topK     int
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithImplementation sets the name and version the server reports to
+// clients on initialization. The default is "rag" and "dev".
+func WithImplementation(name, version string) Option {
+	return func(s *Server) {
+		s.name = name
+		s.version = version
+	}
+}
+
+// WithDefaultTopK overrides DefaultTopK.
+func WithDefaultTopK(k int) Option {
+	return func(s *Server) {
+		s.topK = k
+	}
+}
+
+// New returns a Server for p.
+func New(p *rag.RAGPipeline, opts ...Option) *Server {
+	s := &Server{pipeline: p, name: "rag", version: "dev", topK: DefaultTopK}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// JSON-RPC 2.0 error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// handle answers one JSON-RPC message, read as the subject set on ctx by
+// rag.WithSubject. It returns nil for notifications, which get no
+// response.
+func (s *Server) handle(ctx context.Context, msg []byte) *response {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, err.Error()}}
+	}
+	if req.ID == nil {
+		// Notifications, such as notifications/initialized, need no
+		// action.
+		return nil
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{codeInvalidRequest, "not a JSON-RPC 2.0 request"}
+		return resp
+	}
+
+	var err *rpcError
+	switch req.Method {
+	case "initialize":
+		resp.Result, err = s.initialize(req.Params)
+	case "ping":
+		resp.Result = struct{}{}
+	case "tools/list":
+		resp.Result = map[string]any{"tools": []any{searchToolSpec}}
+	case "tools/call":
+		resp.Result, err = s.callTool(ctx, req.Params)
+	default:
+		err = &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not found", req.Method)}
+	}
+	resp.Error = err
+	return resp
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	version := ProtocolVersion
+	for _, v := range supportedVersions {
+		if v == p.ProtocolVersion {
+			version = v
+		}
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo":      map[string]string{"name": s.name, "version": s.version},
+	}, nil
+}
+
+var searchToolSpec = map[string]any{
+	"name":        SearchTool,
+	"description": "Search the document corpus. Only documents the current user is allowed to read are returned.",
+	"inputSchema": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{"type": "string", "description": "Text to search for."},
+			"top_k": map[string]any{"type": "integer", "minimum": 1, "description": "Maximum number of documents to return."},
+		},
+		"required": []string{"query"},
+	},
+}
+
+type toolContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content []toolContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+// callTool runs search_documents. Pipeline failures are tool results
+// with isError set, as MCP asks, so the model can see and react to them.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Query string `json:"query"`
+			TopK  int    `json:"top_k"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	if p.Name != SearchTool {
+		return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool %q", p.Name)}
+	}
+	if strings.TrimSpace(p.Arguments.Query) == "" {
+		return nil, &rpcError{codeInvalidParams, "query is empty"}
+	}
+	topK := p.Arguments.TopK
+	if topK <= 0 {
+		topK = s.topK
+	}
+
+	resp, err := s.pipeline.Do(ctx, rag.QueryRequest{Query: p.Arguments.Query, TopK: topK})
+	if err != nil {
+		return toolResult{Content: []toolContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	// The results go straight into a model's context, so documents a
+	// pipeline in shadow mode returned without permission are left out.
+	var out toolResult
+	for _, res := range resp.Results {
+		if res.Decision != rag.DecisionAllowed {
+			continue
+		}
+		out.Content = append(out.Content, toolContent{Type: "text", Text: fmt.Sprintf("[%s] %s", res.Document.ID, res.Document.Text)})
+	}
+	if len(out.Content) == 0 {
+		return toolResult{Content: []toolContent{{Type: "text", Text: "No documents found."}}}, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,186 @@
+package ragmcp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragmcp"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragserver"
+)
+
+func newServer(t *testing.T, opts ...rag.Option) *ragmcp.Server {
+	t.Helper()
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, opts...)
+	for id, owner := range map[string]string{"roadmap": "user:emilia", "playbook": "user:beatrice"} {
+		_, err := pipeline.AddDocument(context.Background(), rag.Document{
+			ID:       id,
+			Text:     "The " + id + " for the launch.",
+			Metadata: map[string]string{rag.SpiceDBObjectKey: "document:" + id},
+		}, rag.WithOwner(owner))
+		require.NoError(t, err)
+	}
+	return ragmcp.New(pipeline)
+}
+
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+type toolResult struct {
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+func searchCall(id int, query string) map[string]any {
+	return map[string]any{
+		"jsonrpc": "2.0", "id": id, "method": "tools/call",
+		"params": map[string]any{"name": ragmcp.SearchTool, "arguments": map[string]any{"query": query}},
+	}
+}
+
+func texts(t *testing.T, resp rpcResponse) []string {
+	t.Helper()
+	require.Nil(t, resp.Error)
+	var res toolResult
+	require.NoError(t, json.Unmarshal(resp.Result, &res))
+	out := []string{}
+	for _, c := range res.Content {
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+func TestStdio(t *testing.T) {
+	t.Parallel()
+	var in bytes.Buffer
+	enc := json.NewEncoder(&in)
+	for _, msg := range []map[string]any{
+		{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{"protocolVersion": "2025-03-26"}},
+		{"jsonrpc": "2.0", "method": "notifications/initialized"},
+		{"jsonrpc": "2.0", "id": 2, "method": "tools/list"},
+		searchCall(3, "launch"),
+		{"jsonrpc": "2.0", "id": 4, "method": "resources/list"},
+	} {
+		require.NoError(t, enc.Encode(msg))
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, newServer(t).ServeStdio(context.Background(), rag.Subject{ID: "emilia"}, &in, &out))
+
+	var resps []rpcResponse
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r rpcResponse
+		require.NoError(t, dec.Decode(&r))
+		resps = append(resps, r)
+	}
+	require.Len(t, resps, 4, "the notification gets no response")
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	require.NoError(t, json.Unmarshal(resps[0].Result, &init))
+	require.Equal(t, "2025-03-26", init.ProtocolVersion)
+	require.Contains(t, string(resps[1].Result), ragmcp.SearchTool)
+	require.Equal(t, []string{"[roadmap] The roadmap for the launch."}, texts(t, resps[2]))
+	require.Equal(t, -32601, resps[3].Error.Code)
+}
+
+func TestSearchWithholdsShadowedDocuments(t *testing.T) {
+	t.Parallel()
+	var in bytes.Buffer
+	require.NoError(t, json.NewEncoder(&in).Encode(searchCall(1, "launch")))
+
+	var out bytes.Buffer
+	require.NoError(t, newServer(t, rag.WithShadowMode()).ServeStdio(context.Background(), rag.Subject{ID: "emilia"}, &in, &out))
+	var resp rpcResponse
+	require.NoError(t, json.NewDecoder(&out).Decode(&resp))
+	require.Equal(t, []string{"[roadmap] The roadmap for the launch."}, texts(t, resp))
+}
+
+// session is an MCP client of the HTTP transport.
+type session struct {
+	t   *testing.T
+	srv *httptest.Server
+	id  string
+}
+
+func (s *session) post(user string, msg any) (int, rpcResponse) {
+	s.t.Helper()
+	b, err := json.Marshal(msg)
+	require.NoError(s.t, err)
+	req, err := http.NewRequest(http.MethodPost, s.srv.URL, bytes.NewReader(b))
+	require.NoError(s.t, err)
+	req.Header.Set("X-User", user)
+	if s.id != "" {
+		req.Header.Set("Mcp-Session-Id", s.id)
+	}
+	resp, err := s.srv.Client().Do(req)
+	require.NoError(s.t, err)
+	defer resp.Body.Close()
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		s.id = id
+	}
+	var out rpcResponse
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(s.t, json.NewDecoder(resp.Body).Decode(&out))
+	}
+	return resp.StatusCode, out
+}
+
+func TestHTTPSessions(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(newServer(t).HTTPHandler(ragserver.TrustedHeader("X-User")))
+	t.Cleanup(srv.Close)
+
+	s := &session{t: t, srv: srv}
+	code, _ := s.post("beatrice", searchCall(1, "launch"))
+	require.Equal(t, http.StatusBadRequest, code, "no session yet")
+
+	code, _ = s.post("beatrice", map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{}})
+	require.Equal(t, http.StatusOK, code)
+	require.NotEmpty(t, s.id)
+
+	code, _ = s.post("beatrice", map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"})
+	require.Equal(t, http.StatusAccepted, code)
+
+	code, resp := s.post("beatrice", searchCall(2, "launch"))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []string{"[playbook] The playbook for the launch."}, texts(t, resp))
+
+	// The session is beatrice's; emilia cannot search through it.
+	code, _ = s.post("emilia", searchCall(3, "launch"))
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = s.post("", searchCall(3, "launch"))
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, resp = s.post("beatrice", searchCall(4, "nothing matches"))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, strings.HasPrefix(texts(t, resp)[0], "No documents"))
+
+	req, err := http.NewRequest(http.MethodDelete, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("X-User", "beatrice")
+	req.Header.Set("Mcp-Session-Id", s.id)
+	del, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	del.Body.Close()
+	require.Equal(t, http.StatusNoContent, del.StatusCode)
+
+	code, _ = s.post("beatrice", searchCall(5, "launch"))
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,150 @@
+package ragmcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragserver"
+)
+
+// sessionHeader carries the session ID of the Streamable HTTP transport.
+const sessionHeader = "Mcp-Session-Id"
+
+// maxMessageBytes bounds a single JSON-RPC message.
+const maxMessageBytes = 1 << 20
+
+// HTTPHandler returns the Streamable HTTP transport, to mount at the MCP
+// endpoint, e.g. "/mcp". Every request is authenticated with auth, and
+// the session started by initialize belongs to the user who sent it:
+// requests for the session from anyone else are refused with 403
+// Forbidden, so a leaked session ID does not grant another user's view
+// of the corpus. Clients end sessions with DELETE.
+func (s *Server) HTTPHandler(auth ragserver.Authenticator) http.Handler {
+	return &httpTransport{server: s, auth: auth, sessions: make(map[string]string)}
+}
+
+type httpTransport struct {
+	server *Server
+	auth   ragserver.Authenticator
+
+	mu       sync.Mutex
+	sessions map[string]string // session ID -> subject
+}
+
+func (t *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caller, err := t.auth.Authenticate(r)
+	if err != nil || caller.ID == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		if t.checkSession(w, r, caller) {
+			t.mu.Lock()
+			delete(t.sessions, r.Header.Get(sessionHeader))
+			t.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	default:
+		// No server-initiated messages are sent, so there is no stream
+		// to GET.
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var head struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(msg, &head)
+	if head.Method == "initialize" {
+		id := newSessionID()
+		t.mu.Lock()
+		t.sessions[id] = caller.String()
+		t.mu.Unlock()
+		w.Header().Set(sessionHeader, id)
+	} else if !t.checkSession(w, r, caller) {
+		return
+	}
+
+	resp := t.server.handle(rag.WithSubject(r.Context(), caller), msg)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// checkSession reports whether the request names a session of caller,
+// answering it otherwise.
+func (t *httpTransport) checkSession(w http.ResponseWriter, r *http.Request, caller rag.Subject) bool {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		http.Error(w, "missing "+sessionHeader, http.StatusBadRequest)
+		return false
+	}
+	t.mu.Lock()
+	owner, ok := t.sessions[id]
+	t.mu.Unlock()
+	switch {
+	case !ok:
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return false
+	case owner != caller.String():
+		http.Error(w, "session belongs to another user", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ServeStdio serves the stdio transport, reading newline-delimited
+// messages from in and writing responses to out, until in is exhausted
+// or ctx is done. Every call runs as subject, the user the client was
+// launched for.
+func (s *Server) ServeStdio(ctx context.Context, subject rag.Subject, in io.Reader, out io.Writer) error {
+	ctx = rag.WithSubject(ctx, subject)
+	r := bufio.NewReaderSize(in, 64*1024)
+	enc := json.NewEncoder(out)
+	for ctx.Err() == nil {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if resp := s.handle(ctx, line); resp != nil {
+				if err := enc.Encode(resp); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
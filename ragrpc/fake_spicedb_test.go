@@ -0,0 +1,142 @@
+package ragrpc_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"google.golang.org/grpc"
+)
+
+// fakeSpiceDB stores relationships in memory and grants "read" to the
+// owner and viewer relations, as the schema
+//
+//	definition document {
+//	  relation owner: user
+//	  relation viewer: user | user:*
+//	  permission read = owner + viewer
+//	}
+//
+// would. Calls that are not overridden panic via the nil embedded
+// interfaces.
+type fakeSpiceDB struct {
+	apiv1.PermissionsServiceClient
+	apiv1.SchemaServiceClient
+
+	mu            sync.Mutex
+	relationships map[string]*apiv1.Relationship // "document:doc1#owner@user:emilia"
+}
+
+func newFakeClient() *authzed.Client {
+	f := &fakeSpiceDB{relationships: make(map[string]*apiv1.Relationship)}
+	return &authzed.Client{PermissionsServiceClient: f, SchemaServiceClient: f}
+}
+
+func relKey(res *apiv1.ObjectReference, relation string, subj *apiv1.SubjectReference) string {
+	key := fmt.Sprintf("%s:%s#%s@%s:%s", res.GetObjectType(), res.GetObjectId(), relation, subj.GetObject().GetObjectType(), subj.GetObject().GetObjectId())
+	if rel := subj.GetOptionalRelation(); rel != "" {
+		key += "#" + rel
+	}
+	return key
+}
+
+func (f *fakeSpiceDB) allowed(res *apiv1.ObjectReference, subj *apiv1.SubjectReference) bool {
+	wildcard := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: subj.GetObject().GetObjectType(), ObjectId: "*"}}
+	for _, relation := range []string{"owner", "viewer"} {
+		if f.relationships[relKey(res, relation, subj)] != nil || f.relationships[relKey(res, relation, wildcard)] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeSpiceDB) CheckPermission(_ context.Context, in *apiv1.CheckPermissionRequest, _ ...grpc.CallOption) (*apiv1.CheckPermissionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ship := apiv1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION
+	if f.allowed(in.GetResource(), in.GetSubject()) {
+		ship = apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+	}
+	return &apiv1.CheckPermissionResponse{Permissionship: ship}, nil
+}
+
+func (f *fakeSpiceDB) CheckBulkPermissions(_ context.Context, in *apiv1.CheckBulkPermissionsRequest, _ ...grpc.CallOption) (*apiv1.CheckBulkPermissionsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &apiv1.CheckBulkPermissionsResponse{}
+	for _, item := range in.GetItems() {
+		ship := apiv1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION
+		if f.allowed(item.GetResource(), item.GetSubject()) {
+			ship = apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+		}
+		resp.Pairs = append(resp.Pairs, &apiv1.CheckBulkPermissionsPair{
+			Request:  item,
+			Response: &apiv1.CheckBulkPermissionsPair_Item{Item: &apiv1.CheckBulkPermissionsResponseItem{Permissionship: ship}},
+		})
+	}
+	return resp, nil
+}
+
+func (f *fakeSpiceDB) WriteRelationships(_ context.Context, in *apiv1.WriteRelationshipsRequest, _ ...grpc.CallOption) (*apiv1.WriteRelationshipsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range in.GetUpdates() {
+		rel := u.GetRelationship()
+		key := relKey(rel.GetResource(), rel.GetRelation(), rel.GetSubject())
+		if u.GetOperation() == apiv1.RelationshipUpdate_OPERATION_DELETE {
+			delete(f.relationships, key)
+		} else {
+			f.relationships[key] = rel
+		}
+	}
+	return &apiv1.WriteRelationshipsResponse{WrittenAt: &apiv1.ZedToken{Token: "fake-revision"}}, nil
+}
+
+func (f *fakeSpiceDB) DeleteRelationships(_ context.Context, in *apiv1.DeleteRelationshipsRequest, _ ...grpc.CallOption) (*apiv1.DeleteRelationshipsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filter := in.GetRelationshipFilter()
+	prefix := filter.GetResourceType() + ":" + filter.GetOptionalResourceId() + "#"
+	for key := range f.relationships {
+		if strings.HasPrefix(key, prefix) {
+			delete(f.relationships, key)
+		}
+	}
+	return &apiv1.DeleteRelationshipsResponse{DeletedAt: &apiv1.ZedToken{Token: "fake-revision"}}, nil
+}
+
+func (f *fakeSpiceDB) ReadRelationships(_ context.Context, in *apiv1.ReadRelationshipsRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[apiv1.ReadRelationshipsResponse], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filter := in.GetRelationshipFilter()
+	stream := &relationshipStream{}
+	for _, rel := range f.relationships {
+		res := rel.GetResource()
+		if res.GetObjectType() == filter.GetResourceType() && res.GetObjectId() == filter.GetOptionalResourceId() {
+			stream.items = append(stream.items, &apiv1.ReadRelationshipsResponse{Relationship: rel})
+		}
+	}
+	return stream, nil
+}
+
+func (f *fakeSpiceDB) ReadSchema(context.Context, *apiv1.ReadSchemaRequest, ...grpc.CallOption) (*apiv1.ReadSchemaResponse, error) {
+	return &apiv1.ReadSchemaResponse{SchemaText: "definition user {}\n\ndefinition document {\n  relation viewer: user\n  permission read = viewer\n}\n"}, nil
+}
+
+type relationshipStream struct {
+	grpc.ClientStream
+	items []*apiv1.ReadRelationshipsResponse
+}
+
+func (s *relationshipStream) Recv() (*apiv1.ReadRelationshipsResponse, error) {
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
@@ -0,0 +1,5 @@
+// Package ragpb holds the protocol buffer messages and gRPC stubs of
+// rag.proto, the RAGService served by package ragrpc.
+package ragpb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative ragrpc/ragpb/rag.proto
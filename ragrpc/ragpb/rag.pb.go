@@ -0,0 +1,1072 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: ragrpc/ragpb/rag.proto
+
+package ragpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Explanation_Outcome int32
+
+const (
+	Explanation_OUTCOME_UNSPECIFIED   Explanation_Outcome = 0
+	Explanation_OUTCOME_NOT_RETRIEVED Explanation_Outcome = 1
+	Explanation_OUTCOME_FILTERED      Explanation_Outcome = 2
+	Explanation_OUTCOME_UNMAPPED      Explanation_Outcome = 3
+	Explanation_OUTCOME_DENIED        Explanation_Outcome = 4
+	Explanation_OUTCOME_TRUNCATED     Explanation_Outcome = 5
+	Explanation_OUTCOME_RETURNED      Explanation_Outcome = 6
+)
+
+// Enum value maps for Explanation_Outcome.
+var (
+	Explanation_Outcome_name = map[int32]string{
+		0: "OUTCOME_UNSPECIFIED",
+		1: "OUTCOME_NOT_RETRIEVED",
+		2: "OUTCOME_FILTERED",
+		3: "OUTCOME_UNMAPPED",
+		4: "OUTCOME_DENIED",
+		5: "OUTCOME_TRUNCATED",
+		6: "OUTCOME_RETURNED",
+	}
+	Explanation_Outcome_value = map[string]int32{
+		"OUTCOME_UNSPECIFIED":   0,
+		"OUTCOME_NOT_RETRIEVED": 1,
+		"OUTCOME_FILTERED":      2,
+		"OUTCOME_UNMAPPED":      3,
+		"OUTCOME_DENIED":        4,
+		"OUTCOME_TRUNCATED":     5,
+		"OUTCOME_RETURNED":      6,
+	}
+)
+
+func (x Explanation_Outcome) Enum() *Explanation_Outcome {
+	p := new(Explanation_Outcome)
+	*p = x
+	return p
+}
+
+func (x Explanation_Outcome) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Explanation_Outcome) Descriptor() protoreflect.EnumDescriptor {
+	return file_ragrpc_ragpb_rag_proto_enumTypes[0].Descriptor()
+}
+
+func (Explanation_Outcome) Type() protoreflect.EnumType {
+	return &file_ragrpc_ragpb_rag_proto_enumTypes[0]
+}
+
+func (x Explanation_Outcome) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Explanation_Outcome.Descriptor instead.
+func (Explanation_Outcome) EnumDescriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{7, 0}
+}
+
+type Explanation_Decision int32
+
+const (
+	Explanation_DECISION_UNSPECIFIED Explanation_Decision = 0
+	Explanation_DECISION_DENIED      Explanation_Decision = 1
+	Explanation_DECISION_ALLOWED     Explanation_Decision = 2
+	Explanation_DECISION_CONDITIONAL Explanation_Decision = 3
+)
+
+// Enum value maps for Explanation_Decision.
+var (
+	Explanation_Decision_name = map[int32]string{
+		0: "DECISION_UNSPECIFIED",
+		1: "DECISION_DENIED",
+		2: "DECISION_ALLOWED",
+		3: "DECISION_CONDITIONAL",
+	}
+	Explanation_Decision_value = map[string]int32{
+		"DECISION_UNSPECIFIED": 0,
+		"DECISION_DENIED":      1,
+		"DECISION_ALLOWED":     2,
+		"DECISION_CONDITIONAL": 3,
+	}
+)
+
+func (x Explanation_Decision) Enum() *Explanation_Decision {
+	p := new(Explanation_Decision)
+	*p = x
+	return p
+}
+
+func (x Explanation_Decision) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Explanation_Decision) Descriptor() protoreflect.EnumDescriptor {
+	return file_ragrpc_ragpb_rag_proto_enumTypes[1].Descriptor()
+}
+
+func (Explanation_Decision) Type() protoreflect.EnumType {
+	return &file_ragrpc_ragpb_rag_proto_enumTypes[1]
+}
+
+func (x Explanation_Decision) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Explanation_Decision.Descriptor instead.
+func (Explanation_Decision) EnumDescriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{7, 1}
+}
+
+type ManageACLRequest_Operation int32
+
+const (
+	ManageACLRequest_OPERATION_UNSPECIFIED ManageACLRequest_Operation = 0
+	ManageACLRequest_OPERATION_LIST        ManageACLRequest_Operation = 1
+	ManageACLRequest_OPERATION_GRANT       ManageACLRequest_Operation = 2
+	ManageACLRequest_OPERATION_REVOKE      ManageACLRequest_Operation = 3
+)
+
+// Enum value maps for ManageACLRequest_Operation.
+var (
+	ManageACLRequest_Operation_name = map[int32]string{
+		0: "OPERATION_UNSPECIFIED",
+		1: "OPERATION_LIST",
+		2: "OPERATION_GRANT",
+		3: "OPERATION_REVOKE",
+	}
+	ManageACLRequest_Operation_value = map[string]int32{
+		"OPERATION_UNSPECIFIED": 0,
+		"OPERATION_LIST":        1,
+		"OPERATION_GRANT":       2,
+		"OPERATION_REVOKE":      3,
+	}
+)
+
+func (x ManageACLRequest_Operation) Enum() *ManageACLRequest_Operation {
+	p := new(ManageACLRequest_Operation)
+	*p = x
+	return p
+}
+
+func (x ManageACLRequest_Operation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ManageACLRequest_Operation) Descriptor() protoreflect.EnumDescriptor {
+	return file_ragrpc_ragpb_rag_proto_enumTypes[2].Descriptor()
+}
+
+func (ManageACLRequest_Operation) Type() protoreflect.EnumType {
+	return &file_ragrpc_ragpb_rag_proto_enumTypes[2]
+}
+
+func (x ManageACLRequest_Operation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ManageACLRequest_Operation.Descriptor instead.
+func (ManageACLRequest_Operation) EnumDescriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{8, 0}
+}
+
+type QueryRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Query    string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	TopK     int32                  `protobuf:"varint,2,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
+	MinScore float64                `protobuf:"fixed64,3,opt,name=min_score,json=minScore,proto3" json:"min_score,omitempty"`
+	// Filters restricts results to documents with these metadata values.
+	Filters map[string]string `protobuf:"bytes,4,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// ZedToken, as returned by Ingest and ManageACL, makes the query see at
+	// least that revision.
+	ZedToken      string `protobuf:"bytes,5,opt,name=zed_token,json=zedToken,proto3" json:"zed_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *QueryRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetTopK() int32 {
+	if x != nil {
+		return x.TopK
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetMinScore() float64 {
+	if x != nil {
+		return x.MinScore
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetZedToken() string {
+	if x != nil {
+		return x.ZedToken
+	}
+	return ""
+}
+
+type QueryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*Result              `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryResponse) Reset() {
+	*x = QueryResponse{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryResponse) ProtoMessage() {}
+
+func (x *QueryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryResponse.ProtoReflect.Descriptor instead.
+func (*QueryResponse) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QueryResponse) GetResults() []*Result {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// Result is one authorized document.
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Score         float64                `protobuf:"fixed64,4,opt,name=score,proto3" json:"score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Result) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Result) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Result) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Result) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+type IngestRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Text     string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	Metadata map[string]string      `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Viewers ("user:beatrice", "group:eng#member", "user:*") are granted
+	// the viewer relation.
+	Viewers       []string `protobuf:"bytes,4,rep,name=viewers,proto3" json:"viewers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestRequest) Reset() {
+	*x = IngestRequest{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRequest) ProtoMessage() {}
+
+func (x *IngestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRequest.ProtoReflect.Descriptor instead.
+func (*IngestRequest) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IngestRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *IngestRequest) GetViewers() []string {
+	if x != nil {
+		return x.Viewers
+	}
+	return nil
+}
+
+type IngestResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ZedToken      string                 `protobuf:"bytes,2,opt,name=zed_token,json=zedToken,proto3" json:"zed_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResponse) Reset() {
+	*x = IngestResponse{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResponse) ProtoMessage() {}
+
+func (x *IngestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResponse.ProtoReflect.Descriptor instead.
+func (*IngestResponse) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *IngestResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *IngestResponse) GetZedToken() string {
+	if x != nil {
+		return x.ZedToken
+	}
+	return ""
+}
+
+type ExplainRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Subject is whom to explain the query for, as "type:id",
+	// "type:id#relation" or an ID of the default subject type. It defaults
+	// to the caller.
+	Subject       string            `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	Query         string            `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	TopK          int32             `protobuf:"varint,3,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
+	MinScore      float64           `protobuf:"fixed64,4,opt,name=min_score,json=minScore,proto3" json:"min_score,omitempty"`
+	Filters       map[string]string `protobuf:"bytes,5,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	ZedToken      string            `protobuf:"bytes,6,opt,name=zed_token,json=zedToken,proto3" json:"zed_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainRequest) Reset() {
+	*x = ExplainRequest{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainRequest) ProtoMessage() {}
+
+func (x *ExplainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainRequest.ProtoReflect.Descriptor instead.
+func (*ExplainRequest) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExplainRequest) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *ExplainRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *ExplainRequest) GetTopK() int32 {
+	if x != nil {
+		return x.TopK
+	}
+	return 0
+}
+
+func (x *ExplainRequest) GetMinScore() float64 {
+	if x != nil {
+		return x.MinScore
+	}
+	return 0
+}
+
+func (x *ExplainRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *ExplainRequest) GetZedToken() string {
+	if x != nil {
+		return x.ZedToken
+	}
+	return ""
+}
+
+type ExplainResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Explanations  []*Explanation         `protobuf:"bytes,1,rep,name=explanations,proto3" json:"explanations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainResponse) Reset() {
+	*x = ExplainResponse{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainResponse) ProtoMessage() {}
+
+func (x *ExplainResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainResponse.ProtoReflect.Descriptor instead.
+func (*ExplainResponse) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExplainResponse) GetExplanations() []*Explanation {
+	if x != nil {
+		return x.Explanations
+	}
+	return nil
+}
+
+// Explanation accounts for one document in an explained query.
+type Explanation struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	// Resource is the document's SpiceDB object, "type:id", if it has one.
+	Resource string              `protobuf:"bytes,2,opt,name=resource,proto3" json:"resource,omitempty"`
+	Outcome  Explanation_Outcome `protobuf:"varint,3,opt,name=outcome,proto3,enum=rag.v1.Explanation_Outcome" json:"outcome,omitempty"`
+	// Decision is set for documents that reached authorization.
+	Decision      Explanation_Decision `protobuf:"varint,4,opt,name=decision,proto3,enum=rag.v1.Explanation_Decision" json:"decision,omitempty"`
+	Score         float64              `protobuf:"fixed64,5,opt,name=score,proto3" json:"score,omitempty"`
+	Reason        string               `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Explanation) Reset() {
+	*x = Explanation{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Explanation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Explanation) ProtoMessage() {}
+
+func (x *Explanation) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Explanation.ProtoReflect.Descriptor instead.
+func (*Explanation) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Explanation) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *Explanation) GetResource() string {
+	if x != nil {
+		return x.Resource
+	}
+	return ""
+}
+
+func (x *Explanation) GetOutcome() Explanation_Outcome {
+	if x != nil {
+		return x.Outcome
+	}
+	return Explanation_OUTCOME_UNSPECIFIED
+}
+
+func (x *Explanation) GetDecision() Explanation_Decision {
+	if x != nil {
+		return x.Decision
+	}
+	return Explanation_DECISION_UNSPECIFIED
+}
+
+func (x *Explanation) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Explanation) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ManageACLRequest struct {
+	state      protoimpl.MessageState     `protogen:"open.v1"`
+	DocumentId string                     `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Operation  ManageACLRequest_Operation `protobuf:"varint,2,opt,name=operation,proto3,enum=rag.v1.ManageACLRequest_Operation" json:"operation,omitempty"`
+	// Relation and subject ("user:beatrice", "group:eng#member") are the
+	// relationship to grant or revoke.
+	Relation      string `protobuf:"bytes,3,opt,name=relation,proto3" json:"relation,omitempty"`
+	Subject       string `protobuf:"bytes,4,opt,name=subject,proto3" json:"subject,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ManageACLRequest) Reset() {
+	*x = ManageACLRequest{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManageACLRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManageACLRequest) ProtoMessage() {}
+
+func (x *ManageACLRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManageACLRequest.ProtoReflect.Descriptor instead.
+func (*ManageACLRequest) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ManageACLRequest) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *ManageACLRequest) GetOperation() ManageACLRequest_Operation {
+	if x != nil {
+		return x.Operation
+	}
+	return ManageACLRequest_OPERATION_UNSPECIFIED
+}
+
+func (x *ManageACLRequest) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *ManageACLRequest) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+type ManageACLResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Entries are the document's relationships, for OPERATION_LIST.
+	Entries []*ACLEntry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	// ZedToken is the revision of a grant or revoke.
+	ZedToken      string `protobuf:"bytes,2,opt,name=zed_token,json=zedToken,proto3" json:"zed_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ManageACLResponse) Reset() {
+	*x = ManageACLResponse{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManageACLResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManageACLResponse) ProtoMessage() {}
+
+func (x *ManageACLResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManageACLResponse.ProtoReflect.Descriptor instead.
+func (*ManageACLResponse) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ManageACLResponse) GetEntries() []*ACLEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *ManageACLResponse) GetZedToken() string {
+	if x != nil {
+		return x.ZedToken
+	}
+	return ""
+}
+
+type ACLEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Relation      string                 `protobuf:"bytes,1,opt,name=relation,proto3" json:"relation,omitempty"`
+	Subject       string                 `protobuf:"bytes,2,opt,name=subject,proto3" json:"subject,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ACLEntry) Reset() {
+	*x = ACLEntry{}
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ACLEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ACLEntry) ProtoMessage() {}
+
+func (x *ACLEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_ragrpc_ragpb_rag_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ACLEntry.ProtoReflect.Descriptor instead.
+func (*ACLEntry) Descriptor() ([]byte, []int) {
+	return file_ragrpc_ragpb_rag_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ACLEntry) GetRelation() string {
+	if x != nil {
+		return x.Relation
+	}
+	return ""
+}
+
+func (x *ACLEntry) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+var File_ragrpc_ragpb_rag_proto protoreflect.FileDescriptor
+
+const file_ragrpc_ragpb_rag_proto_rawDesc = "" +
+	"\n" +
+	"\x16ragrpc/ragpb/rag.proto\x12\x06rag.v1\"\xec\x01\n" +
+	"\fQueryRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x13\n" +
+	"\x05top_k\x18\x02 \x01(\x05R\x04topK\x12\x1b\n" +
+	"\tmin_score\x18\x03 \x01(\x01R\bminScore\x12;\n" +
+	"\afilters\x18\x04 \x03(\v2!.rag.v1.QueryRequest.FiltersEntryR\afilters\x12\x1b\n" +
+	"\tzed_token\x18\x05 \x01(\tR\bzedToken\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"9\n" +
+	"\rQueryResponse\x12(\n" +
+	"\aresults\x18\x01 \x03(\v2\x0e.rag.v1.ResultR\aresults\"\xb9\x01\n" +
+	"\x06Result\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x128\n" +
+	"\bmetadata\x18\x03 \x03(\v2\x1c.rag.v1.Result.MetadataEntryR\bmetadata\x12\x14\n" +
+	"\x05score\x18\x04 \x01(\x01R\x05score\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xcb\x01\n" +
+	"\rIngestRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12?\n" +
+	"\bmetadata\x18\x03 \x03(\v2#.rag.v1.IngestRequest.MetadataEntryR\bmetadata\x12\x18\n" +
+	"\aviewers\x18\x04 \x03(\tR\aviewers\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"=\n" +
+	"\x0eIngestResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tzed_token\x18\x02 \x01(\tR\bzedToken\"\x8a\x02\n" +
+	"\x0eExplainRequest\x12\x18\n" +
+	"\asubject\x18\x01 \x01(\tR\asubject\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x13\n" +
+	"\x05top_k\x18\x03 \x01(\x05R\x04topK\x12\x1b\n" +
+	"\tmin_score\x18\x04 \x01(\x01R\bminScore\x12=\n" +
+	"\afilters\x18\x05 \x03(\v2#.rag.v1.ExplainRequest.FiltersEntryR\afilters\x12\x1b\n" +
+	"\tzed_token\x18\x06 \x01(\tR\bzedToken\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"J\n" +
+	"\x0fExplainResponse\x127\n" +
+	"\fexplanations\x18\x01 \x03(\v2\x13.rag.v1.ExplanationR\fexplanations\"\x81\x04\n" +
+	"\vExplanation\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1a\n" +
+	"\bresource\x18\x02 \x01(\tR\bresource\x125\n" +
+	"\aoutcome\x18\x03 \x01(\x0e2\x1b.rag.v1.Explanation.OutcomeR\aoutcome\x128\n" +
+	"\bdecision\x18\x04 \x01(\x0e2\x1c.rag.v1.Explanation.DecisionR\bdecision\x12\x14\n" +
+	"\x05score\x18\x05 \x01(\x01R\x05score\x12\x16\n" +
+	"\x06reason\x18\x06 \x01(\tR\x06reason\"\xaa\x01\n" +
+	"\aOutcome\x12\x17\n" +
+	"\x13OUTCOME_UNSPECIFIED\x10\x00\x12\x19\n" +
+	"\x15OUTCOME_NOT_RETRIEVED\x10\x01\x12\x14\n" +
+	"\x10OUTCOME_FILTERED\x10\x02\x12\x14\n" +
+	"\x10OUTCOME_UNMAPPED\x10\x03\x12\x12\n" +
+	"\x0eOUTCOME_DENIED\x10\x04\x12\x15\n" +
+	"\x11OUTCOME_TRUNCATED\x10\x05\x12\x14\n" +
+	"\x10OUTCOME_RETURNED\x10\x06\"i\n" +
+	"\bDecision\x12\x18\n" +
+	"\x14DECISION_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fDECISION_DENIED\x10\x01\x12\x14\n" +
+	"\x10DECISION_ALLOWED\x10\x02\x12\x18\n" +
+	"\x14DECISION_CONDITIONAL\x10\x03\"\x92\x02\n" +
+	"\x10ManageACLRequest\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12@\n" +
+	"\toperation\x18\x02 \x01(\x0e2\".rag.v1.ManageACLRequest.OperationR\toperation\x12\x1a\n" +
+	"\brelation\x18\x03 \x01(\tR\brelation\x12\x18\n" +
+	"\asubject\x18\x04 \x01(\tR\asubject\"e\n" +
+	"\tOperation\x12\x19\n" +
+	"\x15OPERATION_UNSPECIFIED\x10\x00\x12\x12\n" +
+	"\x0eOPERATION_LIST\x10\x01\x12\x13\n" +
+	"\x0fOPERATION_GRANT\x10\x02\x12\x14\n" +
+	"\x10OPERATION_REVOKE\x10\x03\"\\\n" +
+	"\x11ManageACLResponse\x12*\n" +
+	"\aentries\x18\x01 \x03(\v2\x10.rag.v1.ACLEntryR\aentries\x12\x1b\n" +
+	"\tzed_token\x18\x02 \x01(\tR\bzedToken\"@\n" +
+	"\bACLEntry\x12\x1a\n" +
+	"\brelation\x18\x01 \x01(\tR\brelation\x12\x18\n" +
+	"\asubject\x18\x02 \x01(\tR\asubject2\xf9\x01\n" +
+	"\n" +
+	"RAGService\x124\n" +
+	"\x05Query\x12\x14.rag.v1.QueryRequest\x1a\x15.rag.v1.QueryResponse\x127\n" +
+	"\x06Ingest\x12\x15.rag.v1.IngestRequest\x1a\x16.rag.v1.IngestResponse\x12:\n" +
+	"\aExplain\x12\x16.rag.v1.ExplainRequest\x1a\x17.rag.v1.ExplainResponse\x12@\n" +
+	"\tManageACL\x12\x18.rag.v1.ManageACLRequest\x1a\x19.rag.v1.ManageACLResponseBCZAgithub.com/sohanmaheshwar/rag-spicedb-testcontainers/ragrpc/ragpbb\x06proto3"
+
+var (
+	file_ragrpc_ragpb_rag_proto_rawDescOnce sync.Once
+	file_ragrpc_ragpb_rag_proto_rawDescData []byte
+)
+
+func file_ragrpc_ragpb_rag_proto_rawDescGZIP() []byte {
+	file_ragrpc_ragpb_rag_proto_rawDescOnce.Do(func() {
+		file_ragrpc_ragpb_rag_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ragrpc_ragpb_rag_proto_rawDesc), len(file_ragrpc_ragpb_rag_proto_rawDesc)))
+	})
+	return file_ragrpc_ragpb_rag_proto_rawDescData
+}
+
+var file_ragrpc_ragpb_rag_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_ragrpc_ragpb_rag_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_ragrpc_ragpb_rag_proto_goTypes = []any{
+	(Explanation_Outcome)(0),        // 0: rag.v1.Explanation.Outcome
+	(Explanation_Decision)(0),       // 1: rag.v1.Explanation.Decision
+	(ManageACLRequest_Operation)(0), // 2: rag.v1.ManageACLRequest.Operation
+	(*QueryRequest)(nil),            // 3: rag.v1.QueryRequest
+	(*QueryResponse)(nil),           // 4: rag.v1.QueryResponse
+	(*Result)(nil),                  // 5: rag.v1.Result
+	(*IngestRequest)(nil),           // 6: rag.v1.IngestRequest
+	(*IngestResponse)(nil),          // 7: rag.v1.IngestResponse
+	(*ExplainRequest)(nil),          // 8: rag.v1.ExplainRequest
+	(*ExplainResponse)(nil),         // 9: rag.v1.ExplainResponse
+	(*Explanation)(nil),             // 10: rag.v1.Explanation
+	(*ManageACLRequest)(nil),        // 11: rag.v1.ManageACLRequest
+	(*ManageACLResponse)(nil),       // 12: rag.v1.ManageACLResponse
+	(*ACLEntry)(nil),                // 13: rag.v1.ACLEntry
+	nil,                             // 14: rag.v1.QueryRequest.FiltersEntry
+	nil,                             // 15: rag.v1.Result.MetadataEntry
+	nil,                             // 16: rag.v1.IngestRequest.MetadataEntry
+	nil,                             // 17: rag.v1.ExplainRequest.FiltersEntry
+}
+var file_ragrpc_ragpb_rag_proto_depIdxs = []int32{
+	14, // 0: rag.v1.QueryRequest.filters:type_name -> rag.v1.QueryRequest.FiltersEntry
+	5,  // 1: rag.v1.QueryResponse.results:type_name -> rag.v1.Result
+	15, // 2: rag.v1.Result.metadata:type_name -> rag.v1.Result.MetadataEntry
+	16, // 3: rag.v1.IngestRequest.metadata:type_name -> rag.v1.IngestRequest.MetadataEntry
+	17, // 4: rag.v1.ExplainRequest.filters:type_name -> rag.v1.ExplainRequest.FiltersEntry
+	10, // 5: rag.v1.ExplainResponse.explanations:type_name -> rag.v1.Explanation
+	0,  // 6: rag.v1.Explanation.outcome:type_name -> rag.v1.Explanation.Outcome
+	1,  // 7: rag.v1.Explanation.decision:type_name -> rag.v1.Explanation.Decision
+	2,  // 8: rag.v1.ManageACLRequest.operation:type_name -> rag.v1.ManageACLRequest.Operation
+	13, // 9: rag.v1.ManageACLResponse.entries:type_name -> rag.v1.ACLEntry
+	3,  // 10: rag.v1.RAGService.Query:input_type -> rag.v1.QueryRequest
+	6,  // 11: rag.v1.RAGService.Ingest:input_type -> rag.v1.IngestRequest
+	8,  // 12: rag.v1.RAGService.Explain:input_type -> rag.v1.ExplainRequest
+	11, // 13: rag.v1.RAGService.ManageACL:input_type -> rag.v1.ManageACLRequest
+	4,  // 14: rag.v1.RAGService.Query:output_type -> rag.v1.QueryResponse
+	7,  // 15: rag.v1.RAGService.Ingest:output_type -> rag.v1.IngestResponse
+	9,  // 16: rag.v1.RAGService.Explain:output_type -> rag.v1.ExplainResponse
+	12, // 17: rag.v1.RAGService.ManageACL:output_type -> rag.v1.ManageACLResponse
+	14, // [14:18] is the sub-list for method output_type
+	10, // [10:14] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_ragrpc_ragpb_rag_proto_init() }
+func file_ragrpc_ragpb_rag_proto_init() {
+	if File_ragrpc_ragpb_rag_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ragrpc_ragpb_rag_proto_rawDesc), len(file_ragrpc_ragpb_rag_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ragrpc_ragpb_rag_proto_goTypes,
+		DependencyIndexes: file_ragrpc_ragpb_rag_proto_depIdxs,
+		EnumInfos:         file_ragrpc_ragpb_rag_proto_enumTypes,
+		MessageInfos:      file_ragrpc_ragpb_rag_proto_msgTypes,
+	}.Build()
+	File_ragrpc_ragpb_rag_proto = out.File
+	file_ragrpc_ragpb_rag_proto_goTypes = nil
+	file_ragrpc_ragpb_rag_proto_depIdxs = nil
+}
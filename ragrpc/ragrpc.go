@@ -0,0 +1,388 @@
+// Package ragrpc exposes a rag.RAGPipeline as the gRPC service RAGService
+// defined in ragpb/rag.proto, so the pipeline can run as a sidecar next to
+// services in any language:
+//
+//	srv := grpc.NewServer()
+//	ragpb.RegisterRAGServiceServer(srv, ragrpc.New(pipeline, ragrpc.BearerToken(extractor.Subject)))
+//
+// Every call authenticates the caller with an Authenticator, which maps
+// the call's metadata to the SpiceDB subject queries are authorized for.
+// Documents are managed with the same rules as ragserver: the caller owns
+// what it ingests, and only owners may change a document's access.
+package ragrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragrpc/ragpb"
+)
+
+// ErrUnauthenticated is returned by an Authenticator for a call without
+// valid credentials.
+var ErrUnauthenticated = errors.New("ragrpc: unauthenticated")
+
+// Authenticator identifies the caller of a call from its context, which
+// carries the incoming metadata.
+type Authenticator interface {
+	Authenticate(ctx context.Context) (rag.Subject, error)
+}
+
+// AuthenticatorFunc adapts a plain function to an Authenticator.
+type AuthenticatorFunc func(ctx context.Context) (rag.Subject, error)
+
+// Authenticate calls f(ctx).
+func (f AuthenticatorFunc) Authenticate(ctx context.Context) (rag.Subject, error) {
+	return f(ctx)
+}
+
+// BearerToken authenticates calls by the bearer token in their
+// "authorization" metadata, which subject maps to the caller, e.g. the
+// Subject method of an oidc.Extractor.
+func BearerToken(subject func(ctx context.Context, token string) (rag.Subject, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (rag.Subject, error) {
+		scheme, token, ok := strings.Cut(firstMetadata(ctx, "authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return rag.Subject{}, ErrUnauthenticated
+		}
+		s, err := subject(ctx, token)
+		if err != nil {
+			return rag.Subject{}, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+		}
+		return s, nil
+	})
+}
+
+// TrustedMetadata authenticates calls by a metadata key set by an
+// authenticating proxy in front of the server, holding "type:id",
+// "type:id#relation" or just an ID of the default subject type. Only use it when clients cannot
+// reach the server around the proxy.
+func TrustedMetadata(key string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (rag.Subject, error) {
+		v := firstMetadata(ctx, key)
+		if v == "" {
+			return rag.Subject{}, ErrUnauthenticated
+		}
+		return rag.ParseSubject(v), nil
+	})
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Server implements ragpb.RAGServiceServer for a pipeline.
+type Server struct {
+	ragpb.UnimplementedRAGServiceServer
+
+	pipeline *rag.RAGPipeline
+	auth     Authenticator
+
+	admin         func(rag.Subject) bool
+	resourceType  string
+	subjectType   string
+	ownerRelation string
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAdmin allows Explain for callers admin returns true for. Without
+// it Explain fails with PermissionDenied.
+func WithAdmin(admin func(rag.Subject) bool) Option {
+	return func(s *Server) {
+		s.admin = admin
+	}
+}
+
+// WithResourceType sets the SpiceDB object type of ingested documents,
+// which are mapped to "<type>:<id>". It must match the pipeline's
+// resource type; the default is "document".
+func WithResourceType(objectType string) Option {
+	return func(s *Server) {
+		s.resourceType = objectType
+	}
+}
+
+// WithSubjectType sets the type of callers the Authenticator returns
+// without one. It must match the pipeline's rag.WithDefaultSubjectType;
+// the default is rag.DefaultSubjectType.
+func WithSubjectType(objectType string) Option {
+	return func(s *Server) {
+		s.subjectType = objectType
+	}
+}
+
+// WithOwnerRelation sets the relation Ingest grants the caller and
+// ManageACL requires. The default is "owner".
+func WithOwnerRelation(relation string) Option {
+	return func(s *Server) {
+		s.ownerRelation = relation
+	}
+}
+
+// New returns a Server for p, authenticating callers with auth.
+func New(p *rag.RAGPipeline, auth Authenticator, opts ...Option) *Server {
+	s := &Server{
+		pipeline:      p,
+		auth:          auth,
+		resourceType:  "document",
+		subjectType:   rag.DefaultSubjectType,
+		ownerRelation: "owner",
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// authenticate returns the caller and ctx with the caller set by
+// rag.WithSubject.
+func (s *Server) authenticate(ctx context.Context) (context.Context, rag.Subject, error) {
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil || caller.ID == "" {
+		return nil, rag.Subject{}, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	if caller.Type == "" {
+		caller.Type = s.subjectType
+	}
+	return rag.WithSubject(ctx, caller), caller, nil
+}
+
+// Query implements ragpb.RAGServiceServer.
+func (s *Server) Query(ctx context.Context, in *ragpb.QueryRequest) (*ragpb.QueryResponse, error) {
+	ctx, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.pipeline.Do(ctx, queryRequest(in.GetQuery(), in.GetTopK(), in.GetMinScore(), in.GetFilters(), in.GetZedToken()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	// Clients cannot tell shadowed results apart, so documents a pipeline
+	// in shadow mode returned without permission are left out.
+	out := &ragpb.QueryResponse{Results: make([]*ragpb.Result, 0, len(resp.Results))}
+	for _, res := range resp.Results {
+		if res.Decision != rag.DecisionAllowed {
+			continue
+		}
+		out.Results = append(out.Results, &ragpb.Result{
+			Id:       res.Document.ID,
+			Text:     res.Document.Text,
+			Metadata: res.Document.Metadata,
+			Score:    res.Score,
+		})
+	}
+	return out, nil
+}
+
+func queryRequest(query string, topK int32, minScore float64, filters map[string]string, zedToken string) rag.QueryRequest {
+	req := rag.QueryRequest{
+		Query:    query,
+		TopK:     int(topK),
+		MinScore: minScore,
+		Filters:  filters,
+	}
+	if zedToken != "" {
+		req.Consistency = rag.AtLeastAsFresh(&apiv1.ZedToken{Token: zedToken})
+	}
+	return req
+}
+
+// reservedMetadata are the metadata keys that decide a document's SpiceDB
+// object and tenant, which clients may not choose.
+var reservedMetadata = []string{rag.SpiceDBObjectKey, rag.ParentObjectKey, rag.TenantKey}
+
+// Ingest implements ragpb.RAGServiceServer. The caller becomes the
+// document's owner and Viewers are granted the viewer relation. The
+// document belongs to the caller's tenant, if any. Documents
+// whose object already has relationships are refused with AlreadyExists,
+// as claiming them would make the caller owner of someone else's document.
+func (s *Server) Ingest(ctx context.Context, in *ragpb.IngestRequest) (*ragpb.IngestResponse, error) {
+	ctx, caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is empty")
+	}
+	meta := make(map[string]string, len(in.GetMetadata())+1)
+	for k, v := range in.GetMetadata() {
+		meta[k] = v
+	}
+	for _, key := range reservedMetadata {
+		if _, ok := meta[key]; ok {
+			return nil, status.Errorf(codes.InvalidArgument, "metadata key %q is reserved", key)
+		}
+	}
+	meta[rag.SpiceDBObjectKey] = s.resourceType + ":" + in.GetId()
+	if caller.Tenant != "" {
+		meta[rag.TenantKey] = caller.Tenant
+	}
+
+	acl, err := s.pipeline.ListAccess(ctx, in.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(acl) > 0 {
+		return nil, status.Errorf(codes.AlreadyExists, "document %q already exists", in.GetId())
+	}
+
+	opts := []rag.IngestOption{rag.WithRelationship(s.ownerRelation, caller.String())}
+	for _, v := range in.GetViewers() {
+		opts = append(opts, rag.WithViewer(v))
+	}
+	token, err := s.pipeline.AddDocument(ctx, rag.Document{ID: in.GetId(), Text: in.GetText(), Metadata: meta}, opts...)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ragpb.IngestResponse{Id: in.GetId(), ZedToken: token.GetToken()}, nil
+}
+
+// Explain implements ragpb.RAGServiceServer with rag.QueryExplain, for
+// the caller or the request's subject.
+func (s *Server) Explain(ctx context.Context, in *ragpb.ExplainRequest) (*ragpb.ExplainResponse, error) {
+	ctx, caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.admin == nil || !s.admin(caller) {
+		return nil, status.Error(codes.PermissionDenied, "explain is reserved for admins")
+	}
+	if in.GetSubject() != "" {
+		subject := rag.ParseSubject(in.GetSubject())
+		if subject.Type == "" {
+			subject.Type = s.subjectType
+		}
+		ctx = rag.WithSubject(ctx, subject)
+	}
+
+	req := queryRequest(in.GetQuery(), in.GetTopK(), in.GetMinScore(), in.GetFilters(), in.GetZedToken())
+	opts := []rag.QueryOption{rag.WithTopK(req.TopK), rag.WithMinScore(req.MinScore)}
+	for k, v := range req.Filters {
+		opts = append(opts, rag.WithFilter(k, v))
+	}
+	if req.Consistency != nil {
+		opts = append(opts, rag.WithConsistency(req.Consistency))
+	}
+	resp, err := s.pipeline.QueryExplain(ctx, "", req.Query, opts...)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	out := &ragpb.ExplainResponse{Explanations: make([]*ragpb.Explanation, len(resp.Explanations))}
+	for i, e := range resp.Explanations {
+		pe := &ragpb.Explanation{
+			DocumentId: e.DocumentID,
+			Resource:   e.Resource,
+			Outcome:    outcomes[e.Outcome],
+			Score:      e.Score,
+			Reason:     e.Reason,
+		}
+		if e.Outcome >= rag.OutcomeDenied {
+			pe.Decision = decisions[e.Decision]
+		}
+		out.Explanations[i] = pe
+	}
+	return out, nil
+}
+
+var outcomes = map[rag.Outcome]ragpb.Explanation_Outcome{
+	rag.OutcomeNotRetrieved: ragpb.Explanation_OUTCOME_NOT_RETRIEVED,
+	rag.OutcomeFiltered:     ragpb.Explanation_OUTCOME_FILTERED,
+	rag.OutcomeUnmapped:     ragpb.Explanation_OUTCOME_UNMAPPED,
+	rag.OutcomeDenied:       ragpb.Explanation_OUTCOME_DENIED,
+	rag.OutcomeTruncated:    ragpb.Explanation_OUTCOME_TRUNCATED,
+	rag.OutcomeReturned:     ragpb.Explanation_OUTCOME_RETURNED,
+}
+
+var decisions = map[rag.Decision]ragpb.Explanation_Decision{
+	rag.DecisionDenied:      ragpb.Explanation_DECISION_DENIED,
+	rag.DecisionAllowed:     ragpb.Explanation_DECISION_ALLOWED,
+	rag.DecisionConditional: ragpb.Explanation_DECISION_CONDITIONAL,
+}
+
+// ManageACL implements ragpb.RAGServiceServer. Only direct owners of the
+// document may list or change its access; for anyone else it fails with
+// NotFound, so the document's existence does not leak.
+func (s *Server) ManageACL(ctx context.Context, in *ragpb.ManageACLRequest) (*ragpb.ManageACLResponse, error) {
+	ctx, caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := in.GetDocumentId()
+	acl, err := s.pipeline.ListAccess(ctx, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	owner := false
+	for _, e := range acl {
+		if e.Relation == s.ownerRelation && e.Subject == caller.String() {
+			owner = true
+		}
+	}
+	if !owner {
+		return nil, status.Errorf(codes.NotFound, "document %q not found", id)
+	}
+
+	grant := in.GetOperation() == ragpb.ManageACLRequest_OPERATION_GRANT
+	if (grant || in.GetOperation() == ragpb.ManageACLRequest_OPERATION_REVOKE) && in.GetRelation() == "" {
+		return nil, status.Error(codes.InvalidArgument, "relation is empty")
+	}
+
+	var token *apiv1.ZedToken
+	switch in.GetOperation() {
+	case ragpb.ManageACLRequest_OPERATION_LIST:
+		out := &ragpb.ManageACLResponse{Entries: make([]*ragpb.ACLEntry, len(acl))}
+		for i, e := range acl {
+			out.Entries[i] = &ragpb.ACLEntry{Relation: e.Relation, Subject: e.Subject}
+		}
+		return out, nil
+	case ragpb.ManageACLRequest_OPERATION_GRANT:
+		token, err = s.pipeline.GrantAccess(ctx, id, in.GetRelation(), in.GetSubject())
+	case ragpb.ManageACLRequest_OPERATION_REVOKE:
+		token, err = s.pipeline.RevokeAccess(ctx, id, in.GetRelation(), in.GetSubject())
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown operation %v", in.GetOperation())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ragpb.ManageACLResponse{ZedToken: token.GetToken()}, nil
+}
+
+// toStatus converts a pipeline error to the matching gRPC status.
+func toStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, rag.ErrInvalidRequest),
+		errors.Is(err, rag.ErrInvalidSpiceDBObject),
+		errors.Is(err, rag.ErrNoResourceMapping),
+		errors.Is(err, rag.ErrNoTenant):
+		code = codes.InvalidArgument
+	case errors.Is(err, rag.ErrDuplicateDocument):
+		code = codes.AlreadyExists
+	case errors.Is(err, rag.ErrDocumentTooLarge),
+		errors.Is(err, rag.ErrQueryTooBroad):
+		code = codes.ResourceExhausted
+	case errors.Is(err, rag.ErrPermissionBackendUnavailable):
+		code = codes.Unavailable
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
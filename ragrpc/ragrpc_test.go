@@ -0,0 +1,254 @@
+package ragrpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragrpc"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragrpc/ragpb"
+)
+
+// newClient serves a fresh pipeline over an in-memory connection.
+func newClient(t *testing.T, opts ...ragrpc.Option) ragpb.RAGServiceClient {
+	t.Helper()
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil)
+	return newClientFor(t, pipeline, ragrpc.TrustedMetadata("x-user"), opts...)
+}
+
+// newClientFor serves pipeline over an in-memory connection,
+// authenticating callers with auth.
+func newClientFor(t *testing.T, pipeline *rag.RAGPipeline, auth ragrpc.Authenticator, opts ...ragrpc.Option) ragpb.RAGServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	ragpb.RegisterRAGServiceServer(srv, ragrpc.New(pipeline, auth, opts...))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return ragpb.NewRAGServiceClient(conn)
+}
+
+func as(user string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-user", user)
+}
+
+func requireCode(t *testing.T, want codes.Code, err error) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, want, status.Code(err), err.Error())
+}
+
+func resultIDs(resp *ragpb.QueryResponse) []string {
+	ids := []string{}
+	for _, r := range resp.GetResults() {
+		ids = append(ids, r.GetId())
+	}
+	return ids
+}
+
+func TestIngestAndQuery(t *testing.T) {
+	t.Parallel()
+	client := newClient(t)
+
+	written, err := client.Ingest(as("emilia"), &ragpb.IngestRequest{
+		Id:      "roadmap",
+		Text:    "Internal roadmap for 2025.",
+		Viewers: []string{"user:beatrice"},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, written.GetZedToken())
+
+	query := &ragpb.QueryRequest{Query: "roadmap", ZedToken: written.GetZedToken()}
+	for user, want := range map[string][]string{
+		"emilia":   {"roadmap"},
+		"beatrice": {"roadmap"},
+		"charlie":  {},
+	} {
+		resp, err := client.Query(as(user), query)
+		require.NoError(t, err)
+		require.Equal(t, want, resultIDs(resp), user)
+	}
+
+	_, err = client.Ingest(as("charlie"), &ragpb.IngestRequest{Id: "roadmap", Text: "mine now"})
+	requireCode(t, codes.AlreadyExists, err)
+	_, err = client.Ingest(as("charlie"), &ragpb.IngestRequest{Id: "x", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:roadmap"}})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = client.Query(as("emilia"), &ragpb.QueryRequest{Query: "x", TopK: -1})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestManageACL(t *testing.T) {
+	t.Parallel()
+	client := newClient(t)
+
+	_, err := client.Ingest(as("emilia"), &ragpb.IngestRequest{Id: "notes", Text: "meeting notes"})
+	require.NoError(t, err)
+
+	grant := &ragpb.ManageACLRequest{
+		DocumentId: "notes",
+		Operation:  ragpb.ManageACLRequest_OPERATION_GRANT,
+		Relation:   "viewer",
+		Subject:    "user:beatrice",
+	}
+	// Only owners manage access; others are told the document does not
+	// exist.
+	_, err = client.ManageACL(as("beatrice"), grant)
+	requireCode(t, codes.NotFound, err)
+
+	granted, err := client.ManageACL(as("emilia"), grant)
+	require.NoError(t, err)
+	resp, err := client.Query(as("beatrice"), &ragpb.QueryRequest{Query: "notes", ZedToken: granted.GetZedToken()})
+	require.NoError(t, err)
+	require.Equal(t, []string{"notes"}, resultIDs(resp))
+
+	list, err := client.ManageACL(as("emilia"), &ragpb.ManageACLRequest{DocumentId: "notes", Operation: ragpb.ManageACLRequest_OPERATION_LIST})
+	require.NoError(t, err)
+	require.Len(t, list.GetEntries(), 2)
+	require.Equal(t, "owner", list.GetEntries()[0].GetRelation())
+	require.Equal(t, "user:beatrice", list.GetEntries()[1].GetSubject())
+
+	revoke := &ragpb.ManageACLRequest{DocumentId: "notes", Operation: ragpb.ManageACLRequest_OPERATION_REVOKE, Relation: "viewer", Subject: "user:beatrice"}
+	revoked, err := client.ManageACL(as("emilia"), revoke)
+	require.NoError(t, err)
+	resp, err = client.Query(as("beatrice"), &ragpb.QueryRequest{Query: "notes", ZedToken: revoked.GetZedToken()})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetResults())
+
+	_, err = client.ManageACL(as("emilia"), &ragpb.ManageACLRequest{DocumentId: "notes", Operation: ragpb.ManageACLRequest_OPERATION_GRANT})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = client.ManageACL(as("emilia"), &ragpb.ManageACLRequest{DocumentId: "notes"})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+	client := newClient(t, ragrpc.WithAdmin(func(s rag.Subject) bool { return s.ID == "admin" }))
+
+	_, err := client.Ingest(as("emilia"), &ragpb.IngestRequest{Id: "roadmap", Text: "Internal roadmap."})
+	require.NoError(t, err)
+
+	req := &ragpb.ExplainRequest{Subject: "beatrice", Query: "roadmap"}
+	_, err = client.Explain(as("emilia"), req)
+	requireCode(t, codes.PermissionDenied, err)
+
+	resp, err := client.Explain(as("admin"), req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetExplanations(), 1)
+	e := resp.GetExplanations()[0]
+	require.Equal(t, "roadmap", e.GetDocumentId())
+	require.Equal(t, "document:roadmap", e.GetResource())
+	require.Equal(t, ragpb.Explanation_OUTCOME_DENIED, e.GetOutcome())
+	require.Equal(t, ragpb.Explanation_DECISION_DENIED, e.GetDecision())
+
+	req.Subject = "user:emilia"
+	resp, err = client.Explain(as("admin"), req)
+	require.NoError(t, err)
+	require.Equal(t, ragpb.Explanation_OUTCOME_RETURNED, resp.GetExplanations()[0].GetOutcome())
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+	client := newClient(t)
+
+	_, err := client.Query(context.Background(), &ragpb.QueryRequest{Query: "x"})
+	requireCode(t, codes.Unauthenticated, err)
+
+	auth := ragrpc.BearerToken(func(_ context.Context, token string) (rag.Subject, error) {
+		if token != "secret" {
+			return rag.Subject{}, errors.New("bad token")
+		}
+		return rag.Subject{Type: "serviceaccount", ID: "indexer"}, nil
+	})
+	for header, wantErr := range map[string]bool{"Bearer secret": false, "Bearer wrong": true, "secret": true} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", header))
+		s, err := auth.Authenticate(ctx)
+		if wantErr {
+			require.ErrorIs(t, err, ragrpc.ErrUnauthenticated, header)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, "serviceaccount:indexer", s.String())
+	}
+
+	for value, want := range map[string]rag.Subject{
+		"emilia":           {ID: "emilia"},
+		"user:emilia":      {Type: "user", ID: "emilia"},
+		"group:eng#member": {Type: "group", ID: "eng", Relation: "member"},
+	} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user", value))
+		s, err := ragrpc.TrustedMetadata("x-user").Authenticate(ctx)
+		require.NoError(t, err)
+		require.Equal(t, want, s, value)
+	}
+}
+
+func TestIngestStaysInCallerTenant(t *testing.T) {
+	t.Parallel()
+
+	// x-user holds "tenant/user".
+	auth := ragrpc.AuthenticatorFunc(func(ctx context.Context) (rag.Subject, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tenant, id, _ := strings.Cut(md.Get("x-user")[0], "/")
+		return rag.Subject{ID: id, Tenant: tenant}, nil
+	})
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, rag.WithTenancy())
+	client := newClientFor(t, pipeline, auth)
+
+	smuggled := &ragpb.IngestRequest{Id: "plan", Text: "Acme plan.", Metadata: map[string]string{rag.TenantKey: "globex"}, Viewers: []string{"user:*"}}
+	_, err := client.Ingest(as("acme/emilia"), smuggled)
+	requireCode(t, codes.InvalidArgument, err)
+
+	smuggled.Metadata = nil
+	written, err := client.Ingest(as("acme/emilia"), smuggled)
+	require.NoError(t, err)
+
+	query := &ragpb.QueryRequest{Query: "plan", ZedToken: written.GetZedToken()}
+	for user, want := range map[string][]string{"acme/beatrice": {"plan"}, "globex/beatrice": {}} {
+		resp, err := client.Query(as(user), query)
+		require.NoError(t, err)
+		require.Equal(t, want, resultIDs(resp), user)
+	}
+
+	_, err = client.Ingest(as("/emilia"), &ragpb.IngestRequest{Id: "orphan", Text: "x"})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestQueryWithholdsShadowedDocuments(t *testing.T) {
+	t.Parallel()
+
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, rag.WithShadowMode())
+	client := newClientFor(t, pipeline, ragrpc.TrustedMetadata("x-user"))
+
+	written, err := client.Ingest(as("emilia"), &ragpb.IngestRequest{Id: "roadmap", Text: "Internal roadmap."})
+	require.NoError(t, err)
+
+	// The pipeline returns the roadmap to charlie, marked as denied.
+	results, err := pipeline.Query(context.Background(), "charlie", "roadmap")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	query := &ragpb.QueryRequest{Query: "roadmap", ZedToken: written.GetZedToken()}
+	for user, want := range map[string][]string{"emilia": {"roadmap"}, "charlie": {}} {
+		resp, err := client.Query(as(user), query)
+		require.NoError(t, err)
+		require.Equal(t, want, resultIDs(resp), user)
+	}
+}
@@ -0,0 +1,251 @@
+package ragserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// DefaultModelName is the model the OpenAI-compatible routes report
+// unless configured otherwise.
+const DefaultModelName = "rag"
+
+// WithModelName sets the model name GET /v1/models lists and chat
+// completions report. The default is DefaultModelName.
+func WithModelName(name string) Option {
+	return func(s *Server) {
+		s.modelName = name
+	}
+}
+
+// ChatMessage is one message of a chat completion request. Content is a
+// string or, as some clients send it, a list of parts of which the text
+// parts are used.
+type ChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message's text content.
+func (m ChatMessage) text() (string, error) {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", errors.New("content is neither a string nor a list of parts")
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String(), nil
+}
+
+// ChatCompletionRequest is the body of POST /v1/chat/completions. Other
+// fields OpenAI clients send, such as temperature, are accepted and
+// ignored: generation is configured on the pipeline's Generator.
+type ChatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+}
+
+// ChatCompletion answers a non-streaming POST /v1/chat/completions.
+// Sources is an extension OpenAI clients ignore: the IDs of the
+// authorized documents the answer was generated from.
+type ChatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Sources []string     `json:"sources,omitempty"`
+}
+
+// ChatChoice is the single choice of a ChatCompletion. Message is set in
+// completions and Delta in streamed chunks.
+type ChatChoice struct {
+	Index        int             `json:"index"`
+	Message      *ChatChoiceText `json:"message,omitempty"`
+	Delta        *ChatChoiceText `json:"delta,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
+}
+
+// ChatChoiceText is the assistant's text in a ChatChoice.
+type ChatChoiceText struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+// chatCompletions serves POST /v1/chat/completions with Answer or, when
+// the request asks for a stream, AnswerStream as server-sent events. The
+// question is the last user message; earlier turns are not used for
+// retrieval or generation.
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request, _ rag.Subject) {
+	var body ChatCompletionRequest
+	// OpenAI clients send many optional fields, so unknown ones are
+	// ignored here.
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodyBytes)).Decode(&body); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeOpenAIError(w, status, "decoding body: "+err.Error())
+		return
+	}
+	question, err := lastUserMessage(body.Messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	completion := ChatCompletion{
+		ID:      newCompletionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   s.modelName,
+	}
+	stop := "stop"
+
+	if !body.Stream {
+		resp, err := s.pipeline.Answer(r.Context(), "", question)
+		if err != nil {
+			writeChatError(w, err)
+			return
+		}
+		completion.Choices = []ChatChoice{{
+			Message:      &ChatChoiceText{Role: "assistant", Content: resp.Answer},
+			FinishReason: &stop,
+		}}
+		completion.Sources = sourceIDs(resp.Sources)
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+
+	stream, err := s.pipeline.AnswerStream(r.Context(), "", question)
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(v any) {
+		b, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	completion.Object = "chat.completion.chunk"
+	completion.Sources = sourceIDs(stream.Sources)
+	completion.Choices = []ChatChoice{{Delta: &ChatChoiceText{Role: "assistant"}}}
+	send(completion)
+	completion.Sources = nil
+	for tok := range stream.Tokens {
+		if tok.Err != nil {
+			// The status is already sent; report the failure in the
+			// stream as OpenAI does.
+			send(openAIErrorBody(tok.Err.Error()))
+			return
+		}
+		completion.Choices = []ChatChoice{{Delta: &ChatChoiceText{Content: tok.Text}}}
+		send(completion)
+	}
+	completion.Choices = []ChatChoice{{Delta: &ChatChoiceText{}, FinishReason: &stop}}
+	send(completion)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func lastUserMessage(msgs []ChatMessage) (string, error) {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != "user" {
+			continue
+		}
+		text, err := msgs[i].text()
+		if err != nil {
+			return "", fmt.Errorf("message %d: %w", i, err)
+		}
+		if strings.TrimSpace(text) == "" {
+			return "", fmt.Errorf("message %d is empty", i)
+		}
+		return text, nil
+	}
+	return "", errors.New("no user message")
+}
+
+func sourceIDs(docs []rag.Document) []string {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+func newCompletionID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+// models serves GET /v1/models, which chat frontends call to list the
+// models they may pick.
+func (s *Server) models(w http.ResponseWriter, _ *http.Request, _ rag.Subject) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data": []map[string]any{{
+			"id":       s.modelName,
+			"object":   "model",
+			"owned_by": "rag",
+		}},
+	})
+}
+
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func openAIErrorBody(msg string) openAIError {
+	var e openAIError
+	e.Error.Message = msg
+	e.Error.Type = "rag_error"
+	return e
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, openAIErrorBody(msg))
+}
+
+// writeChatError is writeError in the error format of the OpenAI API. A
+// caller who may read none of the retrieved documents gets 404 Not
+// Found, as nothing answers the question for them.
+func writeChatError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rag.ErrNoSources):
+		writeOpenAIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, rag.ErrNoGenerator):
+		writeOpenAIError(w, http.StatusNotImplemented, err.Error())
+	default:
+		writeOpenAIError(w, errorStatus(err), err.Error())
+	}
+}
@@ -0,0 +1,100 @@
+package ragserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/openai"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragserver"
+)
+
+// newChatServer serves a pipeline whose generator answers with its
+// prompt, authenticating callers by API key: the key is the user ID.
+func newChatServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	echo := rag.GeneratorFunc(func(_ context.Context, prompt string) (string, error) {
+		return prompt, nil
+	})
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, rag.WithGenerator(echo))
+	_, err := pipeline.AddDocument(context.Background(), rag.Document{
+		ID:       "roadmap",
+		Text:     "The roadmap ships search in March.",
+		Metadata: map[string]string{rag.SpiceDBObjectKey: "document:roadmap"},
+	}, rag.WithOwner("user:emilia"))
+	require.NoError(t, err)
+
+	auth := ragserver.BearerToken(func(_ context.Context, key string) (rag.Subject, error) {
+		return rag.Subject{ID: key}, nil
+	})
+	srv := httptest.NewServer(ragserver.New(pipeline, auth))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestChatCompletions(t *testing.T) {
+	t.Parallel()
+	srv := newChatServer(t)
+	ctx := context.Background()
+
+	emilia := openai.New("rag", openai.WithBaseURL(srv.URL+"/v1"), openai.WithAPIKey("emilia"))
+	answer, err := emilia.Generate(ctx, "roadmap")
+	require.NoError(t, err)
+	require.Contains(t, answer, "ships search in March")
+
+	var streamed strings.Builder
+	require.NoError(t, emilia.GenerateStream(ctx, "roadmap", func(token string) error {
+		streamed.WriteString(token)
+		return nil
+	}))
+	require.Equal(t, answer, streamed.String())
+
+	// Nothing charlie may read answers the question.
+	charlie := openai.New("rag", openai.WithBaseURL(srv.URL+"/v1"), openai.WithAPIKey("charlie"))
+	_, err = charlie.Generate(ctx, "roadmap")
+	var apiErr *openai.APIError
+	require.True(t, errors.As(err, &apiErr), err)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	anonymous := openai.New("rag", openai.WithBaseURL(srv.URL+"/v1"))
+	_, err = anonymous.Generate(ctx, "roadmap")
+	require.True(t, errors.As(err, &apiErr), err)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestChatCompletionsRequest(t *testing.T) {
+	t.Parallel()
+	srv := newChatServer(t)
+
+	var completion ragserver.ChatCompletion
+	body := map[string]any{
+		"model":       "rag",
+		"temperature": 0.2,
+		"messages": []map[string]any{
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": []map[string]string{{"type": "text", "text": "roadmap"}}},
+		},
+	}
+	require.Equal(t, http.StatusOK, callBearer(t, srv, http.MethodPost, "/v1/chat/completions", "emilia", body, &completion))
+	require.Equal(t, "chat.completion", completion.Object)
+	require.Equal(t, []string{"roadmap"}, completion.Sources)
+	require.Len(t, completion.Choices, 1)
+	require.Equal(t, "assistant", completion.Choices[0].Message.Role)
+
+	noUser := map[string]any{"messages": []map[string]string{{"role": "system", "content": "x"}}}
+	require.Equal(t, http.StatusBadRequest, callBearer(t, srv, http.MethodPost, "/v1/chat/completions", "emilia", noUser, nil))
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	require.Equal(t, http.StatusOK, callBearer(t, srv, http.MethodGet, "/v1/models", "emilia", nil, &models))
+	require.Equal(t, ragserver.DefaultModelName, models.Data[0].ID)
+}
@@ -0,0 +1,501 @@
+// Package ragserver exposes a rag.RAGPipeline over HTTP with JSON bodies,
+// for services not written in Go:
+//
+//	POST   /query            run a query as the caller
+//	POST   /documents        add a document owned by the caller
+//	DELETE /documents/{id}   remove a document the caller owns
+//	GET    /healthz          liveness, without authentication
+//	POST   /admin/selftest   run the pipeline's SelfTest, for admins
+//	POST   /admin/diff       compare what two subjects can read, for admins
+//
+// It also serves the part of the OpenAI API chat frontends use, so they
+// can point at it as at any OpenAI-compatible server and get answers
+// generated only from documents the caller may read:
+//
+//	POST   /v1/chat/completions  answer the last user message with Answer
+//	GET    /v1/models            list the single model, see WithModelName
+//
+// Every route but /healthz authenticates the caller with an
+// Authenticator, which maps the request to the SpiceDB subject queries
+// are authorized for.
+package ragserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// DefaultMaxBodyBytes bounds request bodies unless configured otherwise.
+const DefaultMaxBodyBytes = 8 << 20
+
+// ErrUnauthenticated is returned by an Authenticator for a request
+// without valid credentials.
+var ErrUnauthenticated = errors.New("ragserver: unauthenticated")
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (rag.Subject, error)
+}
+
+// AuthenticatorFunc adapts a plain function to an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (rag.Subject, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (rag.Subject, error) {
+	return f(r)
+}
+
+// BearerToken authenticates requests by the bearer token in their
+// Authorization header, which subject maps to the caller, e.g. the
+// Subject method of an oidc.Extractor.
+func BearerToken(subject func(ctx context.Context, token string) (rag.Subject, error)) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (rag.Subject, error) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return rag.Subject{}, ErrUnauthenticated
+		}
+		s, err := subject(r.Context(), token)
+		if err != nil {
+			return rag.Subject{}, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+		}
+		return s, nil
+	})
+}
+
+// TrustedHeader authenticates requests by a header set by an
+// authenticating proxy in front of the server, holding "type:id",
+// "type:id#relation" or just an ID of the default subject type. Only use it when clients cannot
+// reach the server around the proxy.
+func TrustedHeader(name string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (rag.Subject, error) {
+		v := r.Header.Get(name)
+		if v == "" {
+			return rag.Subject{}, ErrUnauthenticated
+		}
+		return rag.ParseSubject(v), nil
+	})
+}
+
+// Server is an http.Handler serving a pipeline.
+type Server struct {
+	pipeline *rag.RAGPipeline
+	auth     Authenticator
+	mux      *http.ServeMux
+
+	admin         func(rag.Subject) bool
+	resourceType  string
+	subjectType   string
+	ownerRelation string
+	maxBodyBytes  int64
+	modelName     string
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAdmin enables the /admin routes for callers admin returns true for.
+// Without it they answer 403 Forbidden.
+func WithAdmin(admin func(rag.Subject) bool) Option {
+	return func(s *Server) {
+		s.admin = admin
+	}
+}
+
+// WithResourceType sets the SpiceDB object type of documents added with
+// POST /documents, which are mapped to "<type>:<id>". It must match the
+// pipeline's resource type; the default is "document".
+func WithResourceType(objectType string) Option {
+	return func(s *Server) {
+		s.resourceType = objectType
+	}
+}
+
+// WithSubjectType sets the type of callers the Authenticator returns
+// without one, for the relationships written on their behalf. It must
+// match the pipeline's rag.WithDefaultSubjectType; the default is
+// rag.DefaultSubjectType.
+func WithSubjectType(objectType string) Option {
+	return func(s *Server) {
+		s.subjectType = objectType
+	}
+}
+
+// WithOwnerRelation sets the relation POST /documents grants the caller
+// and DELETE /documents/{id} requires. The default is "owner".
+func WithOwnerRelation(relation string) Option {
+	return func(s *Server) {
+		s.ownerRelation = relation
+	}
+}
+
+// WithMaxBodyBytes overrides DefaultMaxBodyBytes.
+func WithMaxBodyBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxBodyBytes = n
+	}
+}
+
+// New returns a Server for p, authenticating callers with auth.
+func New(p *rag.RAGPipeline, auth Authenticator, opts ...Option) *Server {
+	s := &Server{
+		pipeline:      p,
+		auth:          auth,
+		mux:           http.NewServeMux(),
+		resourceType:  "document",
+		subjectType:   rag.DefaultSubjectType,
+		ownerRelation: "owner",
+		maxBodyBytes:  DefaultMaxBodyBytes,
+		modelName:     DefaultModelName,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("GET /healthz", s.healthz)
+	s.mux.HandleFunc("POST /query", s.authenticated(s.query))
+	s.mux.HandleFunc("POST /documents", s.authenticated(s.addDocument))
+	s.mux.HandleFunc("DELETE /documents/{id}", s.authenticated(s.removeDocument))
+	s.mux.HandleFunc("POST /admin/selftest", s.authenticated(s.selfTest))
+	s.mux.HandleFunc("POST /admin/diff", s.authenticated(s.diff))
+	s.mux.HandleFunc("POST /v1/chat/completions", s.authenticated(s.chatCompletions))
+	s.mux.HandleFunc("GET /v1/models", s.authenticated(s.models))
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authenticated wraps h to run with the caller set by rag.WithSubject.
+func (s *Server) authenticated(h func(http.ResponseWriter, *http.Request, rag.Subject)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, err := s.auth.Authenticate(r)
+		if err != nil || caller.ID == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, errorBody{Error: "unauthenticated"})
+			return
+		}
+		if caller.Type == "" {
+			caller.Type = s.subjectType
+		}
+		h(w, r.WithContext(rag.WithSubject(r.Context(), caller)), caller)
+	}
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// QueryRequest is the body of POST /query. ZedToken, as returned by the
+// document routes, makes the query see at least that revision. PageSize
+// pages through the results: Cursor is the NextCursor of the previous
+// page.
+type QueryRequest struct {
+	Query    string            `json:"query"`
+	TopK     int               `json:"top_k,omitempty"`
+	MinScore float64           `json:"min_score,omitempty"`
+	Filters  map[string]string `json:"filters,omitempty"`
+	ZedToken string            `json:"zed_token,omitempty"`
+	PageSize int               `json:"page_size,omitempty"`
+	Cursor   string            `json:"cursor,omitempty"`
+}
+
+// QueryResponse is the body answering POST /query.
+type QueryResponse struct {
+	Results    []Result `json:"results"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// Result is one authorized document. Snippets are only set for pipelines
+// configured with rag.WithSnippets.
+type Result struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Score    float64           `json:"score"`
+	Snippets []Snippet         `json:"snippets,omitempty"`
+}
+
+// Snippet is a passage of a result's text around its matches. Start and
+// End are byte offsets into the result's text; Highlights are the
+// [start, end) byte offsets of the matches within Text.
+type Snippet struct {
+	Start      int      `json:"start"`
+	End        int      `json:"end"`
+	Text       string   `json:"text"`
+	Highlights [][2]int `json:"highlights,omitempty"`
+}
+
+func (s *Server) query(w http.ResponseWriter, r *http.Request, _ rag.Subject) {
+	var body QueryRequest
+	if !s.decode(w, r, &body) {
+		return
+	}
+	req := rag.QueryRequest{
+		Query:    body.Query,
+		TopK:     body.TopK,
+		MinScore: body.MinScore,
+		Filters:  body.Filters,
+		PageSize: body.PageSize,
+		Cursor:   body.Cursor,
+	}
+	if body.ZedToken != "" {
+		req.Consistency = rag.AtLeastAsFresh(&apiv1.ZedToken{Token: body.ZedToken})
+	}
+
+	resp, err := s.pipeline.Do(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Clients cannot tell shadowed results apart, so documents a pipeline
+	// in shadow mode returned without permission are left out.
+	out := QueryResponse{Results: make([]Result, 0, len(resp.Results)), NextCursor: resp.NextCursor}
+	for _, res := range resp.Results {
+		if res.Decision != rag.DecisionAllowed {
+			continue
+		}
+		out.Results = append(out.Results, Result{
+			ID:       res.Document.ID,
+			Text:     res.Document.Text,
+			Metadata: res.Document.Metadata,
+			Score:    res.Score,
+			Snippets: snippets(res.Snippets),
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func snippets(in []rag.Snippet) []Snippet {
+	var out []Snippet
+	for _, s := range in {
+		sn := Snippet{Start: s.Span.Start, End: s.Span.End, Text: s.Text}
+		for _, h := range s.Highlights {
+			sn.Highlights = append(sn.Highlights, [2]int{h.Start, h.End})
+		}
+		out = append(out, sn)
+	}
+	return out
+}
+
+// DocumentRequest is the body of POST /documents. The caller becomes the
+// document's owner; Viewers ("user:beatrice", "group:eng#member",
+// "user:*") are granted the viewer relation. The document belongs to the
+// caller's tenant, if any.
+type DocumentRequest struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Viewers  []string          `json:"viewers,omitempty"`
+}
+
+// WriteResponse answers the document routes with the revision of the
+// write, to pass as QueryRequest.ZedToken.
+type WriteResponse struct {
+	ID       string `json:"id"`
+	ZedToken string `json:"zed_token,omitempty"`
+}
+
+// reservedMetadata are the metadata keys that decide a document's SpiceDB
+// object and tenant, which clients may not choose.
+var reservedMetadata = []string{rag.SpiceDBObjectKey, rag.ParentObjectKey, rag.TenantKey}
+
+func (s *Server) addDocument(w http.ResponseWriter, r *http.Request, caller rag.Subject) {
+	var body DocumentRequest
+	if !s.decode(w, r, &body) {
+		return
+	}
+	if body.ID == "" {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "id is empty"})
+		return
+	}
+	meta := make(map[string]string, len(body.Metadata)+1)
+	for k, v := range body.Metadata {
+		meta[k] = v
+	}
+	for _, key := range reservedMetadata {
+		if _, ok := meta[key]; ok {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("metadata key %q is reserved", key)})
+			return
+		}
+	}
+	meta[rag.SpiceDBObjectKey] = s.resourceType + ":" + body.ID
+	if caller.Tenant != "" {
+		meta[rag.TenantKey] = caller.Tenant
+	}
+
+	// Claiming an object that already has relationships would make the
+	// caller owner of someone else's document.
+	acl, err := s.pipeline.ListAccess(r.Context(), body.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(acl) > 0 {
+		writeJSON(w, http.StatusConflict, errorBody{Error: fmt.Sprintf("document %q already exists", body.ID)})
+		return
+	}
+
+	opts := []rag.IngestOption{rag.WithRelationship(s.ownerRelation, caller.String())}
+	for _, v := range body.Viewers {
+		opts = append(opts, rag.WithViewer(v))
+	}
+	token, err := s.pipeline.AddDocument(r.Context(), rag.Document{ID: body.ID, Text: body.Text, Metadata: meta}, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, WriteResponse{ID: body.ID, ZedToken: token.GetToken()})
+}
+
+func (s *Server) removeDocument(w http.ResponseWriter, r *http.Request, caller rag.Subject) {
+	id := r.PathValue("id")
+	acl, err := s.pipeline.ListAccess(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	owner := false
+	for _, e := range acl {
+		if e.Relation == s.ownerRelation && e.Subject == caller.String() {
+			owner = true
+		}
+	}
+	// Documents the caller does not own are reported as missing, so their
+	// existence does not leak.
+	if !owner {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: fmt.Sprintf("document %q not found", id)})
+		return
+	}
+
+	removed, _, token, err := s.pipeline.RemoveDocumentsAndRelationships(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if removed == 0 {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: fmt.Sprintf("document %q not found", id)})
+		return
+	}
+	writeJSON(w, http.StatusOK, WriteResponse{ID: id, ZedToken: token.GetToken()})
+}
+
+func (s *Server) selfTest(w http.ResponseWriter, r *http.Request, caller rag.Subject) {
+	if s.admin == nil || !s.admin(caller) {
+		writeJSON(w, http.StatusForbidden, errorBody{Error: "forbidden"})
+		return
+	}
+	if err := s.pipeline.SelfTest(r.Context()); err != nil {
+		body := errorBody{Error: err.Error()}
+		var stErr *rag.SelfTestError
+		if errors.As(err, &stErr) {
+			body.Stage = string(stErr.Stage)
+		}
+		writeJSON(w, http.StatusInternalServerError, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// DiffRequest is the body of POST /admin/diff. A and B are subjects such
+// as "user:emilia" or "group:eng#member"; an empty Query compares the
+// whole corpus.
+type DiffRequest struct {
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Query string `json:"query,omitempty"`
+}
+
+// DiffResponse answers POST /admin/diff with rag.DiffAccess's report.
+type DiffResponse struct {
+	OnlyA []string `json:"only_a"`
+	OnlyB []string `json:"only_b"`
+	Both  int      `json:"both"`
+}
+
+func (s *Server) diff(w http.ResponseWriter, r *http.Request, caller rag.Subject) {
+	if s.admin == nil || !s.admin(caller) {
+		writeJSON(w, http.StatusForbidden, errorBody{Error: "forbidden"})
+		return
+	}
+	var body DiffRequest
+	if !s.decode(w, r, &body) {
+		return
+	}
+	diff, err := s.pipeline.DiffAccess(r.Context(), body.A, body.B, body.Query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := DiffResponse{OnlyA: diff.OnlyA, OnlyB: diff.OnlyB, Both: diff.Both}
+	if out.OnlyA == nil {
+		out.OnlyA = []string{}
+	}
+	if out.OnlyB == nil {
+		out.OnlyB = []string{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// decode reads a JSON body into v, answering 400 and returning false if
+// it is malformed or too large.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, errorBody{Error: "decoding body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+	Stage string `json:"stage,omitempty"`
+}
+
+// writeError answers with the status matching err.
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), errorBody{Error: err.Error()})
+}
+
+// errorStatus returns the HTTP status matching a pipeline error.
+func errorStatus(err error) int {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, rag.ErrInvalidRequest),
+		errors.Is(err, rag.ErrInvalidSpiceDBObject),
+		errors.Is(err, rag.ErrNoResourceMapping),
+		errors.Is(err, rag.ErrNoTenant):
+		status = http.StatusBadRequest
+	case errors.Is(err, rag.ErrDuplicateDocument):
+		status = http.StatusConflict
+	case errors.Is(err, rag.ErrDocumentTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, rag.ErrQueryTooBroad):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, rag.ErrPermissionBackendUnavailable):
+		status = http.StatusServiceUnavailable
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,314 @@
+package ragserver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragserver"
+)
+
+func newServer(t *testing.T, opts ...ragserver.Option) *httptest.Server {
+	t.Helper()
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil)
+	return newServerFor(t, pipeline, ragserver.TrustedHeader("X-User"), opts...)
+}
+
+// newServerFor serves pipeline, authenticating callers with auth.
+func newServerFor(t *testing.T, pipeline *rag.RAGPipeline, auth ragserver.Authenticator, opts ...ragserver.Option) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(ragserver.New(pipeline, auth, opts...))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// call sends body as JSON on behalf of user, if any, and decodes the
+// response into out, if any.
+func call(t *testing.T, srv *httptest.Server, method, path, user string, body, out any) int {
+	t.Helper()
+	return callWithHeader(t, srv, method, path, "X-User", user, body, out)
+}
+
+// callBearer is call for servers authenticating by bearer token.
+func callBearer(t *testing.T, srv *httptest.Server, method, path, token string, body, out any) int {
+	t.Helper()
+	return callWithHeader(t, srv, method, path, "Authorization", "Bearer "+token, body, out)
+}
+
+func callWithHeader(t *testing.T, srv *httptest.Server, method, path, header, value string, body, out any) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req, err := http.NewRequest(method, srv.URL+path, &buf)
+	require.NoError(t, err)
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func resultIDs(resp ragserver.QueryResponse) []string {
+	ids := []string{}
+	for _, r := range resp.Results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestHealthz(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+
+	var body map[string]string
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/healthz", "", nil, &body))
+	require.Equal(t, "ok", body["status"])
+}
+
+func TestDocumentLifecycle(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+
+	var written ragserver.WriteResponse
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia", ragserver.DocumentRequest{
+		ID:      "roadmap",
+		Text:    "Internal roadmap for 2025.",
+		Viewers: []string{"user:beatrice"},
+	}, &written))
+	require.Equal(t, "roadmap", written.ID)
+	require.NotEmpty(t, written.ZedToken)
+
+	query := ragserver.QueryRequest{Query: "roadmap", ZedToken: written.ZedToken}
+	for user, want := range map[string][]string{
+		"emilia":   {"roadmap"},
+		"beatrice": {"roadmap"},
+		"charlie":  {},
+	} {
+		var resp ragserver.QueryResponse
+		require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", user, query, &resp))
+		require.Equal(t, want, resultIDs(resp), user)
+	}
+
+	// Only the owner may delete; others are told it does not exist.
+	require.Equal(t, http.StatusNotFound, call(t, srv, http.MethodDelete, "/documents/roadmap", "beatrice", nil, nil))
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodDelete, "/documents/roadmap", "emilia", nil, nil))
+	require.Equal(t, http.StatusNotFound, call(t, srv, http.MethodDelete, "/documents/roadmap", "emilia", nil, nil))
+
+	var resp ragserver.QueryResponse
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", "emilia", query, &resp))
+	require.Empty(t, resp.Results)
+}
+
+func TestQueryPaging(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+
+	var written ragserver.WriteResponse
+	for _, id := range []string{"notes1", "notes2", "notes3"} {
+		require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia",
+			ragserver.DocumentRequest{ID: id, Text: "Meeting notes.", Viewers: []string{"user:beatrice"}}, &written))
+	}
+
+	query := ragserver.QueryRequest{Query: "notes", ZedToken: written.ZedToken, PageSize: 2}
+	var first, second ragserver.QueryResponse
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", "emilia", query, &first))
+	require.Len(t, first.Results, 2)
+	require.NotEmpty(t, first.NextCursor)
+
+	// A cursor only continues the query of the user it was issued to.
+	query.Cursor = first.NextCursor
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/query", "beatrice", query, nil))
+
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", "emilia", query, &second))
+	require.Len(t, second.Results, 1)
+	require.Empty(t, second.NextCursor)
+	require.ElementsMatch(t, []string{"notes1", "notes2", "notes3"}, append(resultIDs(first), resultIDs(second)...))
+}
+
+func TestQuerySnippets(t *testing.T) {
+	t.Parallel()
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, rag.WithSnippets(20, 1))
+	srv := httptest.NewServer(ragserver.New(pipeline, ragserver.TrustedHeader("X-User")))
+	t.Cleanup(srv.Close)
+
+	var written ragserver.WriteResponse
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia",
+		ragserver.DocumentRequest{ID: "plan", Text: "Launch plan: the rollout starts on Monday."}, &written))
+
+	var resp ragserver.QueryResponse
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", "emilia",
+		ragserver.QueryRequest{Query: "rollout", ZedToken: written.ZedToken}, &resp))
+	require.Len(t, resp.Results, 1)
+	require.Equal(t, []ragserver.Snippet{{Start: 13, End: 24, Text: "the rollout", Highlights: [][2]int{{4, 11}}}}, resp.Results[0].Snippets)
+}
+
+func TestAddDocumentRejections(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+
+	doc := ragserver.DocumentRequest{ID: "notes", Text: "meeting notes"}
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia", doc, nil))
+
+	var errBody map[string]string
+	require.Equal(t, http.StatusConflict, call(t, srv, http.MethodPost, "/documents", "beatrice", doc, &errBody))
+	require.Contains(t, errBody["error"], "already exists")
+
+	hijack := ragserver.DocumentRequest{ID: "other", Text: "x", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:notes"}}
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/documents", "beatrice", hijack, nil))
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/documents", "beatrice", ragserver.DocumentRequest{Text: "x"}, nil))
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/documents", "beatrice", map[string]string{"unknown": "x"}, nil))
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+
+	require.Equal(t, http.StatusUnauthorized, call(t, srv, http.MethodPost, "/query", "", ragserver.QueryRequest{Query: "x"}, nil))
+	require.Equal(t, http.StatusUnauthorized, call(t, srv, http.MethodPost, "/documents", "", ragserver.DocumentRequest{ID: "x"}, nil))
+
+	auth := ragserver.BearerToken(func(_ context.Context, token string) (rag.Subject, error) {
+		if token != "secret" {
+			return rag.Subject{}, errors.New("bad token")
+		}
+		return rag.Subject{Type: "serviceaccount", ID: "indexer"}, nil
+	})
+	for header, wantErr := range map[string]bool{"Bearer secret": false, "Bearer wrong": true, "secret": true} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+		s, err := auth.Authenticate(req)
+		if wantErr {
+			require.ErrorIs(t, err, ragserver.ErrUnauthenticated, header)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, "serviceaccount:indexer", s.String())
+	}
+
+	for header, want := range map[string]rag.Subject{
+		"emilia":           {ID: "emilia"},
+		"user:emilia":      {Type: "user", ID: "emilia"},
+		"group:eng#member": {Type: "group", ID: "eng", Relation: "member"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", header)
+		s, err := ragserver.TrustedHeader("X-User").Authenticate(req)
+		require.NoError(t, err)
+		require.Equal(t, want, s, header)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+
+	var errBody map[string]string
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/query", "emilia", ragserver.QueryRequest{Query: "x", TopK: -1}, &errBody))
+	require.Contains(t, errBody["error"], "TopK")
+
+	small := newServer(t, ragserver.WithMaxBodyBytes(16))
+	require.Equal(t, http.StatusRequestEntityTooLarge,
+		call(t, small, http.MethodPost, "/query", "emilia", ragserver.QueryRequest{Query: "a query longer than sixteen bytes"}, nil))
+}
+
+func TestSelfTestRoute(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t, ragserver.WithAdmin(func(s rag.Subject) bool { return s.ID == "admin" }))
+
+	require.Equal(t, http.StatusForbidden, call(t, srv, http.MethodPost, "/admin/selftest", "emilia", nil, nil))
+
+	var body map[string]string
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/admin/selftest", "admin", nil, &body))
+	require.Equal(t, "ok", body["status"])
+
+	require.Equal(t, http.StatusForbidden, call(t, newServer(t), http.MethodPost, "/admin/selftest", "admin", nil, nil))
+}
+
+func TestDiffRoute(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t, ragserver.WithAdmin(func(s rag.Subject) bool { return s.ID == "admin" }))
+
+	var written ragserver.WriteResponse
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia",
+		ragserver.DocumentRequest{ID: "roadmap", Text: "Internal roadmap.", Viewers: []string{"user:beatrice"}}, &written))
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia",
+		ragserver.DocumentRequest{ID: "salaries", Text: "Salary bands."}, &written))
+
+	diff := ragserver.DiffRequest{A: "user:emilia", B: "user:beatrice"}
+	require.Equal(t, http.StatusForbidden, call(t, srv, http.MethodPost, "/admin/diff", "emilia", diff, nil))
+
+	var body ragserver.DiffResponse
+	require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/admin/diff", "admin", diff, &body))
+	require.Equal(t, ragserver.DiffResponse{OnlyA: []string{"salaries"}, OnlyB: []string{}, Both: 1}, body)
+
+	diff.B = "beatrice"
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/admin/diff", "admin", diff, nil))
+}
+
+func TestAddDocumentStaysInCallerTenant(t *testing.T) {
+	t.Parallel()
+
+	// X-User holds "tenant/user".
+	auth := ragserver.AuthenticatorFunc(func(r *http.Request) (rag.Subject, error) {
+		tenant, id, _ := strings.Cut(r.Header.Get("X-User"), "/")
+		return rag.Subject{ID: id, Tenant: tenant}, nil
+	})
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, rag.WithTenancy())
+	srv := newServerFor(t, pipeline, auth)
+
+	smuggled := ragserver.DocumentRequest{ID: "plan", Text: "Acme plan.", Metadata: map[string]string{rag.TenantKey: "globex"}, Viewers: []string{"user:*"}}
+	var errBody map[string]string
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/documents", "acme/emilia", smuggled, &errBody))
+	require.Contains(t, errBody["error"], "reserved")
+
+	smuggled.Metadata = nil
+	var written ragserver.WriteResponse
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "acme/emilia", smuggled, &written))
+
+	query := ragserver.QueryRequest{Query: "plan", ZedToken: written.ZedToken}
+	for user, want := range map[string][]string{"acme/beatrice": {"plan"}, "globex/beatrice": {}} {
+		var resp ragserver.QueryResponse
+		require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", user, query, &resp))
+		require.Equal(t, want, resultIDs(resp), user)
+	}
+
+	require.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/documents", "/emilia", ragserver.DocumentRequest{ID: "orphan", Text: "x"}, nil),
+		"documents of callers without a tenant are refused")
+}
+
+func TestQueryWithholdsShadowedDocuments(t *testing.T) {
+	t.Parallel()
+
+	pipeline := rag.NewRAGPipeline(newFakeClient(), "document", "read", nil, rag.WithShadowMode())
+	srv := newServerFor(t, pipeline, ragserver.TrustedHeader("X-User"))
+
+	var written ragserver.WriteResponse
+	require.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/documents", "emilia", ragserver.DocumentRequest{ID: "roadmap", Text: "Internal roadmap."}, &written))
+
+	// The pipeline returns the roadmap to charlie, marked as denied.
+	results, err := pipeline.Query(context.Background(), "charlie", "roadmap")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	query := ragserver.QueryRequest{Query: "roadmap", ZedToken: written.ZedToken}
+	for user, want := range map[string][]string{"emilia": {"roadmap"}, "charlie": {}} {
+		var resp ragserver.QueryResponse
+		require.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/query", user, query, &resp))
+		require.Equal(t, want, resultIDs(resp), user)
+	}
+}
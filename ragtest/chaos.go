@@ -0,0 +1,387 @@
+// Package ragtest provides test doubles for exercising the rag pipeline
+// and code built on it without depending on a live SpiceDB's timing.
+package ragtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// Duration is a time.Duration that reads and writes JSON as a string such
+// as "150ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Latency describes the delay added to a call.
+type Latency struct {
+	// Distribution is "fixed" (always Min), "uniform" (between Min and
+	// Max) or "exponential" (mean Mean, capped at Max when set).
+	Distribution string   `json:"distribution"`
+	Min          Duration `json:"min,omitempty"`
+	Max          Duration `json:"max,omitempty"`
+	Mean         Duration `json:"mean,omitempty"`
+}
+
+// ChaosRule scripts the behavior of matching calls. A rule matches a call
+// when every selector that is set matches; the first matching rule wins.
+type ChaosRule struct {
+	// Calls selects calls by their 1-based index.
+	Calls []int `json:"calls,omitempty"`
+	// FromCall and ToCall select an inclusive range of call indexes;
+	// ToCall zero means open-ended.
+	FromCall int `json:"from_call,omitempty"`
+	ToCall   int `json:"to_call,omitempty"`
+	// Resource is a regular expression matched against "type:id".
+	Resource string `json:"resource,omitempty"`
+	// Probability applies the rule to only this fraction of matching
+	// calls, drawn from the plan's seeded source. Zero means always.
+	Probability float64 `json:"probability,omitempty"`
+
+	// Error fails the call with a gRPC status of this code, named as in
+	// codes.Code.String (e.g. "Unavailable", "DeadlineExceeded").
+	Error string `json:"error,omitempty"`
+	// Decision overrides the inner checker's decision without calling
+	// it: "allowed", "denied" or "conditional".
+	Decision string `json:"decision,omitempty"`
+	// Latency replaces the plan's default latency for matching calls.
+	Latency *Latency `json:"latency,omitempty"`
+
+	resource *regexp.Regexp
+	code     codes.Code
+	decision rag.Decision
+}
+
+// ChaosPlan is a reproducible script of latencies, failures and overrides.
+type ChaosPlan struct {
+	// Seed makes latency sampling and probabilistic rules reproducible.
+	Seed int64 `json:"seed"`
+	// Latency is applied to every call not matched by a rule with its
+	// own latency.
+	Latency *Latency    `json:"latency,omitempty"`
+	Rules   []ChaosRule `json:"rules,omitempty"`
+}
+
+// LoadChaosPlan reads a JSON ChaosPlan, e.g. one attached to a bug report.
+func LoadChaosPlan(r io.Reader) (ChaosPlan, error) {
+	var plan ChaosPlan
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&plan); err != nil {
+		return ChaosPlan{}, fmt.Errorf("ragtest: decoding chaos plan: %w", err)
+	}
+	return plan, nil
+}
+
+// ChaosChecker wraps a PermissionChecker with the behaviors of a
+// ChaosPlan. Each Check, CheckBulk and lookup is one call.
+type ChaosChecker struct {
+	inner rag.PermissionChecker
+	plan  ChaosPlan
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	calls int
+}
+
+var (
+	_ rag.BulkPermissionChecker = (*ChaosChecker)(nil)
+	_ rag.ConditionalLister     = (*ChaosChecker)(nil)
+)
+
+var codesByName = func() map[string]codes.Code {
+	m := make(map[string]codes.Code)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		m[strings.ToLower(c.String())] = c
+	}
+	return m
+}()
+
+// NewChaosChecker wraps inner, which may be the SpiceDB checker of a real
+// client. It fails if the plan is invalid.
+func NewChaosChecker(inner rag.PermissionChecker, plan ChaosPlan) (*ChaosChecker, error) {
+	if err := validateLatency(plan.Latency); err != nil {
+		return nil, err
+	}
+
+	rules := make([]ChaosRule, len(plan.Rules))
+	for i, rule := range plan.Rules {
+		if err := validateLatency(rule.Latency); err != nil {
+			return nil, fmt.Errorf("ragtest: rule %d: %w", i, err)
+		}
+		if rule.Resource != "" {
+			re, err := regexp.Compile(rule.Resource)
+			if err != nil {
+				return nil, fmt.Errorf("ragtest: rule %d: %w", i, err)
+			}
+			rule.resource = re
+		}
+		if rule.Error != "" {
+			code, ok := codesByName[strings.ToLower(rule.Error)]
+			if !ok || code == codes.OK {
+				return nil, fmt.Errorf("ragtest: rule %d: unknown error code %q", i, rule.Error)
+			}
+			rule.code = code
+		}
+		switch strings.ToLower(rule.Decision) {
+		case "":
+		case "allowed":
+			rule.decision = rag.DecisionAllowed
+		case "denied":
+			rule.decision = rag.DecisionDenied
+		case "conditional":
+			rule.decision = rag.DecisionConditional
+		default:
+			return nil, fmt.Errorf("ragtest: rule %d: unknown decision %q", i, rule.Decision)
+		}
+		rules[i] = rule
+	}
+	plan.Rules = rules
+
+	return &ChaosChecker{inner: inner, plan: plan, rng: rand.New(rand.NewSource(plan.Seed))}, nil
+}
+
+func validateLatency(l *Latency) error {
+	if l == nil {
+		return nil
+	}
+	switch l.Distribution {
+	case "", "fixed", "uniform", "exponential":
+		return nil
+	default:
+		return fmt.Errorf("ragtest: unknown latency distribution %q", l.Distribution)
+	}
+}
+
+// Calls returns the number of calls made through c so far.
+func (c *ChaosChecker) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// Check implements rag.PermissionChecker.
+func (c *ChaosChecker) Check(ctx context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (rag.Decision, error) {
+	rules, delay := c.next([]string{objectOf(resource)})
+	if err := wait(ctx, delay); err != nil {
+		return rag.DecisionDenied, err
+	}
+
+	switch rule := rules[0]; {
+	case rule == nil:
+	case rule.Error != "":
+		return rag.DecisionDenied, rule.err()
+	case rule.Decision != "":
+		return rule.decision, nil
+	}
+	return c.inner.Check(ctx, subject, resource, permission)
+}
+
+// CheckBulk implements rag.BulkPermissionChecker. The rules are matched
+// against each resource, and the call is delayed by the longest latency
+// drawn for them. A failing rule without a Resource selector fails the
+// whole call, as a lost connection would; the others fail or override
+// the items they match. The remaining items are passed on in one call,
+// or one Check each if the inner checker cannot check in bulk.
+func (c *ChaosChecker) CheckBulk(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string) ([]rag.CheckResult, error) {
+	objects := make([]string, len(resources))
+	for i, res := range resources {
+		objects[i] = objectOf(res)
+	}
+	rules, delay := c.next(objects)
+	if err := wait(ctx, delay); err != nil {
+		return nil, err
+	}
+
+	results := make([]rag.CheckResult, len(resources))
+	var pending []int
+	var batch []*apiv1.ObjectReference
+	for i, rule := range rules {
+		switch {
+		case rule != nil && rule.Error != "" && rule.resource == nil:
+			return nil, rule.err()
+		case rule != nil && rule.Error != "":
+			results[i].Err = rule.err()
+		case rule != nil && rule.Decision != "":
+			results[i].Decision = rule.decision
+		default:
+			pending = append(pending, i)
+			batch = append(batch, resources[i])
+		}
+	}
+	if len(batch) == 0 {
+		return results, nil
+	}
+
+	var fresh []rag.CheckResult
+	if bulk, ok := c.inner.(rag.BulkPermissionChecker); ok {
+		var err error
+		if fresh, err = bulk.CheckBulk(ctx, subject, batch, permission); err != nil {
+			return nil, err
+		}
+	} else {
+		fresh = make([]rag.CheckResult, len(batch))
+		for j, res := range batch {
+			fresh[j].Decision, fresh[j].Err = c.inner.Check(ctx, subject, res, permission)
+		}
+	}
+	for j, i := range pending {
+		results[i] = fresh[j]
+	}
+	return results, nil
+}
+
+// LookupResources implements rag.ResourceLister, see
+// LookupConditionalResources.
+func (c *ChaosChecker) LookupResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) ([]string, error) {
+	ids, _, err := c.LookupConditionalResources(ctx, subject, resourceType, permission)
+	return ids, err
+}
+
+// LookupConditionalResources implements rag.ConditionalLister. Only rules
+// without a Resource selector match a lookup, and their Decision does
+// not apply. It returns rag.ErrPrefilterUnsupported if the inner checker
+// is not a rag.ResourceLister.
+func (c *ChaosChecker) LookupConditionalResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) (allowed, conditional []string, err error) {
+	lister, ok := c.inner.(rag.ResourceLister)
+	if !ok {
+		return nil, nil, rag.ErrPrefilterUnsupported
+	}
+	rules, delay := c.next([]string{""})
+	if err := wait(ctx, delay); err != nil {
+		return nil, nil, err
+	}
+	if rule := rules[0]; rule != nil && rule.Error != "" {
+		return nil, nil, rule.err()
+	}
+
+	if cl, ok := lister.(rag.ConditionalLister); ok {
+		return cl.LookupConditionalResources(ctx, subject, resourceType, permission)
+	}
+	allowed, err = lister.LookupResources(ctx, subject, resourceType, permission)
+	return allowed, nil, err
+}
+
+// wait sleeps for delay unless ctx is done first.
+func wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func objectOf(resource *apiv1.ObjectReference) string {
+	return resource.GetObjectType() + ":" + resource.GetObjectId()
+}
+
+// next assigns the call its index and picks the rule matching each of
+// objects, "" standing for none, and the longest delay drawn for them.
+func (c *ChaosChecker) next(objects []string) ([]*ChaosRule, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	matched := make([]*ChaosRule, len(objects))
+	var delay time.Duration
+	for i, object := range objects {
+		latency := c.plan.Latency
+		for j := range c.plan.Rules {
+			rule := &c.plan.Rules[j]
+			if !rule.matches(c.calls, object) {
+				continue
+			}
+			if rule.Probability > 0 && c.rng.Float64() >= rule.Probability {
+				continue
+			}
+			matched[i] = rule
+			if rule.Latency != nil {
+				latency = rule.Latency
+			}
+			break
+		}
+		delay = max(delay, c.sample(latency))
+	}
+	return matched, delay
+}
+
+// err is the error a call failed by the rule returns.
+func (r *ChaosRule) err() error {
+	return status.Errorf(r.code, "ragtest: injected %s", r.code)
+}
+
+func (r *ChaosRule) matches(call int, object string) bool {
+	if len(r.Calls) > 0 {
+		found := false
+		for _, n := range r.Calls {
+			found = found || n == call
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.FromCall > 0 && call < r.FromCall {
+		return false
+	}
+	if r.ToCall > 0 && call > r.ToCall {
+		return false
+	}
+	return r.resource == nil || (object != "" && r.resource.MatchString(object))
+}
+
+// sample draws a delay from l. The caller holds c.mu.
+func (c *ChaosChecker) sample(l *Latency) time.Duration {
+	if l == nil {
+		return 0
+	}
+	switch l.Distribution {
+	case "uniform":
+		lo, hi := time.Duration(l.Min), time.Duration(l.Max)
+		if hi <= lo {
+			return lo
+		}
+		return lo + time.Duration(c.rng.Int63n(int64(hi-lo)))
+	case "exponential":
+		d := time.Duration(c.rng.ExpFloat64() * float64(l.Mean))
+		if l.Max > 0 {
+			d = min(d, time.Duration(l.Max))
+		}
+		return d
+	default:
+		return time.Duration(l.Min)
+	}
+}
@@ -0,0 +1,265 @@
+package ragtest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+type allowAll struct{}
+
+func (allowAll) Check(context.Context, *apiv1.SubjectReference, *apiv1.ObjectReference, string) (rag.Decision, error) {
+	return rag.DecisionAllowed, nil
+}
+
+func check(t *testing.T, c rag.PermissionChecker, object string) (rag.Decision, error) {
+	t.Helper()
+
+	res, err := rag.ParseObjectReference(object)
+	require.NoError(t, err)
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	return c.Check(context.Background(), subject, res, "read")
+}
+
+func TestChaosCheckerRules(t *testing.T) {
+	t.Parallel()
+
+	chaos, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{
+			{Calls: []int{2}, Error: "Unavailable"},
+			{Resource: `^document:secret-`, Decision: "denied"},
+			{Resource: `^document:caveated$`, Decision: "conditional"},
+			{FromCall: 6, ToCall: 6, Error: "DeadlineExceeded"},
+		},
+	})
+	require.NoError(t, err)
+
+	d, err := check(t, chaos, "document:doc1")
+	require.NoError(t, err)
+	require.Equal(t, rag.DecisionAllowed, d)
+
+	_, err = check(t, chaos, "document:doc1")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	d, err = check(t, chaos, "document:secret-plans")
+	require.NoError(t, err)
+	require.Equal(t, rag.DecisionDenied, d)
+
+	d, err = check(t, chaos, "document:caveated")
+	require.NoError(t, err)
+	require.Equal(t, rag.DecisionConditional, d)
+
+	_, err = check(t, chaos, "document:doc1")
+	require.NoError(t, err)
+
+	_, err = check(t, chaos, "document:doc1")
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	require.Equal(t, 6, chaos.Calls())
+}
+
+func TestChaosCheckerIsReproducible(t *testing.T) {
+	t.Parallel()
+
+	plan := ragtest.ChaosPlan{
+		Seed:  42,
+		Rules: []ragtest.ChaosRule{{Probability: 0.3, Error: "Unavailable"}},
+	}
+	outcomes := func() string {
+		chaos, err := ragtest.NewChaosChecker(allowAll{}, plan)
+		require.NoError(t, err)
+
+		var sb strings.Builder
+		for range 64 {
+			if _, err := check(t, chaos, "document:doc1"); err != nil {
+				sb.WriteByte('x')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		return sb.String()
+	}
+
+	first := outcomes()
+	require.Equal(t, first, outcomes())
+	require.Contains(t, first, "x")
+	require.Contains(t, first, ".")
+}
+
+func TestChaosCheckerLatencyHonorsContext(t *testing.T) {
+	t.Parallel()
+
+	chaos, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{
+		Latency: &ragtest.Latency{Distribution: "fixed", Min: ragtest.Duration(time.Hour)},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	res := &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"}
+	_, err = chaos.Check(ctx, &apiv1.SubjectReference{}, res, "read")
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestLoadChaosPlan(t *testing.T) {
+	t.Parallel()
+
+	plan, err := ragtest.LoadChaosPlan(strings.NewReader(`{
+		"seed": 7,
+		"latency": {"distribution": "uniform", "min": "1ms", "max": "2ms"},
+		"rules": [
+			{"calls": [1, 3], "error": "unavailable"},
+			{"resource": "^document:doc2$", "decision": "conditional", "latency": {"distribution": "fixed", "min": "0s"}}
+		]
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(7), plan.Seed)
+	require.Equal(t, ragtest.Duration(2*time.Millisecond), plan.Latency.Max)
+	require.Len(t, plan.Rules, 2)
+
+	_, err = ragtest.NewChaosChecker(allowAll{}, plan)
+	require.NoError(t, err)
+
+	_, err = ragtest.LoadChaosPlan(strings.NewReader(`{"rulez": []}`))
+	require.Error(t, err)
+
+	for _, bad := range []ragtest.ChaosRule{
+		{Error: "Kaboom"},
+		{Decision: "maybe"},
+		{Resource: "("},
+		{Latency: &ragtest.Latency{Distribution: "pareto"}},
+	} {
+		_, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{Rules: []ragtest.ChaosRule{bad}})
+		require.Error(t, err, "%+v", bad)
+	}
+}
+
+func TestChaosCheckerInPipeline(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	docs := []rag.Document{
+		{ID: "doc1", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}},
+		{ID: "doc2", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc2"}},
+	}
+
+	chaos, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{{Resource: "doc2", Decision: "conditional"}},
+	})
+	require.NoError(t, err)
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", docs, rag.WithPermissionChecker(chaos))
+
+	// A conditional decision without caveat context is not access.
+	results, err := pipeline.Query(ctx, "emilia", "faq")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "doc1", results[0].ID)
+
+	// Both documents are checked in one bulk call.
+	failing, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{{Calls: []int{1}, Error: "Unavailable"}},
+	})
+	require.NoError(t, err)
+	pipeline = rag.NewRAGPipeline(nil, "document", "read", docs, rag.WithPermissionChecker(failing))
+
+	_, err = pipeline.Query(ctx, "emilia", "faq")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestChaosFailurePolicy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	docs := []rag.Document{
+		{ID: "doc1", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}},
+		{ID: "doc2", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc2"}},
+		{ID: "doc3", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc3"}},
+	}
+	chaos, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{{Resource: "doc2", Error: "DeadlineExceeded"}},
+	})
+	require.NoError(t, err)
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", docs,
+		rag.WithPermissionChecker(chaos), rag.WithFailurePolicy(rag.FailClosedDocument))
+
+	resp, err := pipeline.Do(ctx, rag.QueryRequest{UserID: "emilia", Query: "faq"})
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 2)
+	require.Equal(t, "doc1", resp.Documents[0].ID)
+	require.Equal(t, "doc3", resp.Documents[1].ID)
+	require.Len(t, resp.CheckErrors, 1)
+	require.Equal(t, "document:doc2", resp.CheckErrors[0].Resource)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(resp.CheckErrors[0].Err))
+}
+
+func TestChaosCheckerBulk(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	inner, err := ragtest.NewMemoryChecker("document:doc1#read@user:emilia", "document:doc3#read@user:emilia")
+	require.NoError(t, err)
+	chaos, err := ragtest.NewChaosChecker(inner, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{
+			{Calls: []int{2}, Error: "Unavailable"},
+			{Resource: `^document:doc2$`, Decision: "allowed"},
+			{Resource: `^document:doc3$`, Error: "DeadlineExceeded"},
+		},
+	})
+	require.NoError(t, err)
+
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	var resources []*apiv1.ObjectReference
+	for _, id := range []string{"doc1", "doc2", "doc3", "doc4"} {
+		resources = append(resources, &apiv1.ObjectReference{ObjectType: "document", ObjectId: id})
+	}
+
+	results, err := chaos.CheckBulk(ctx, subject, resources, "read")
+	require.NoError(t, err)
+	require.Equal(t, rag.DecisionAllowed, results[0].Decision)
+	require.Equal(t, rag.DecisionAllowed, results[1].Decision, "overridden")
+	require.Equal(t, codes.DeadlineExceeded, status.Code(results[2].Err))
+	require.Equal(t, rag.DecisionDenied, results[3].Decision)
+	require.Equal(t, 2, inner.Checks(), "only the other items are passed on")
+
+	_, err = chaos.CheckBulk(ctx, subject, resources, "read")
+	require.Equal(t, codes.Unavailable, status.Code(err), "the second call fails as a whole")
+	require.Equal(t, 2, chaos.Calls())
+}
+
+func TestChaosCheckerLookupResources(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	inner, err := ragtest.NewMemoryChecker("document:doc1#read@user:emilia", "document:doc2#read@user:emilia")
+	require.NoError(t, err)
+	chaos, err := ragtest.NewChaosChecker(inner, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{
+			{Resource: `doc1`, Error: "Unavailable"},
+			{FromCall: 2, Error: "Unavailable"},
+		},
+	})
+	require.NoError(t, err)
+
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	ids, err := chaos.LookupResources(ctx, subject, "document", "read")
+	require.NoError(t, err, "resource rules do not match lookups")
+	require.Equal(t, []string{"doc1", "doc2"}, ids)
+
+	_, err = chaos.LookupResources(ctx, subject, "document", "read")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	unlisted, err := ragtest.NewChaosChecker(allowAll{}, ragtest.ChaosPlan{})
+	require.NoError(t, err)
+	_, err = unlisted.LookupResources(ctx, subject, "document", "read")
+	require.ErrorIs(t, err, rag.ErrPrefilterUnsupported)
+}
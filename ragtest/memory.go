@@ -0,0 +1,212 @@
+package ragtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// MemoryChecker is an in-memory rag.PermissionChecker and
+// rag.ResourceLister for unit tests that need no SpiceDB at all. It knows
+// nothing about schemas: a subject holds a permission on a resource
+// exactly when that grant was added, either for the subject itself, for
+// the "type:*" wildcard of its type, or for a subject set it belongs to.
+// Membership is a grant like any other, so with
+//
+//	document:doc1#read@group:eng#member
+//	group:eng#member@group:sre#member
+//	group:sre#member@user:beatrice
+//
+// beatrice can read doc1 through sre's membership of eng.
+type MemoryChecker struct {
+	mu     sync.RWMutex
+	grants map[string]bool // "document:doc1#read@user:emilia"
+	checks atomic.Int64
+}
+
+// NewMemoryChecker returns a checker holding grants written as
+// "resource_type:resource_id#permission@subject_type:subject_id", with an
+// optional "#relation" after the subject.
+func NewMemoryChecker(grants ...string) (*MemoryChecker, error) {
+	c := &MemoryChecker{grants: make(map[string]bool, len(grants))}
+	if err := c.Grant(grants...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Grant adds grants in the format of NewMemoryChecker.
+func (c *MemoryChecker) Grant(grants ...string) error {
+	for _, g := range grants {
+		if err := validGrant(g); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range grants {
+		c.grants[g] = true
+	}
+	return nil
+}
+
+// Revoke removes grants; unknown ones are ignored.
+func (c *MemoryChecker) Revoke(grants ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range grants {
+		delete(c.grants, g)
+	}
+}
+
+// Check implements rag.PermissionChecker.
+func (c *MemoryChecker) Check(_ context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (rag.Decision, error) {
+	c.checks.Add(1)
+	prefix := resource.GetObjectType() + ":" + resource.GetObjectId() + "#" + permission + "@"
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, subj := range c.subjectKeys(subject) {
+		if c.grants[prefix+subj] {
+			return rag.DecisionAllowed, nil
+		}
+	}
+	return rag.DecisionDenied, nil
+}
+
+// CheckBulk implements rag.BulkPermissionChecker, so pipelines using the
+// checker take the same bulk path as with SpiceDB.
+func (c *MemoryChecker) CheckBulk(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string) ([]rag.CheckResult, error) {
+	results := make([]rag.CheckResult, len(resources))
+	for i, res := range resources {
+		d, _ := c.Check(ctx, subject, res, permission)
+		results[i] = rag.CheckResult{Decision: d}
+	}
+	return results, nil
+}
+
+// Checks returns the number of decisions made so far, for asserting that
+// code under test did (or avoided) permission checks.
+func (c *MemoryChecker) Checks() int {
+	return int(c.checks.Load())
+}
+
+// Simulate implements rag.Simulator. It returns a new MemoryChecker
+// holding c's grants plus one per relationship, which grants the
+// relationship's relation as a permission; c is not changed. Caveated
+// relationships are rejected, as the checker cannot evaluate caveats.
+func (c *MemoryChecker) Simulate(_ context.Context, relationships []*apiv1.Relationship) (rag.PermissionChecker, error) {
+	grants := make([]string, 0, len(relationships))
+	for _, rel := range relationships {
+		if rel.GetOptionalCaveat() != nil {
+			return nil, fmt.Errorf("ragtest: relationship of %s:%s is caveated", rel.GetResource().GetObjectType(), rel.GetResource().GetObjectId())
+		}
+		subj := rel.GetSubject()
+		g := fmt.Sprintf("%s:%s#%s@%s:%s", rel.GetResource().GetObjectType(), rel.GetResource().GetObjectId(), rel.GetRelation(),
+			subj.GetObject().GetObjectType(), subj.GetObject().GetObjectId())
+		if subj.GetOptionalRelation() != "" {
+			g += "#" + subj.GetOptionalRelation()
+		}
+		grants = append(grants, g)
+	}
+
+	c.mu.RLock()
+	for g := range c.grants {
+		grants = append(grants, g)
+	}
+	c.mu.RUnlock()
+	return NewMemoryChecker(grants...)
+}
+
+// NewPipeline returns a pipeline over docs whose permissions come from a
+// MemoryChecker holding grants, for unit tests of code built on rag. It
+// fails tb if a grant is malformed.
+func NewPipeline(tb testing.TB, resourceType, permission string, docs []rag.Document, grants []string, opts ...rag.Option) (*rag.RAGPipeline, *MemoryChecker) {
+	tb.Helper()
+
+	checker, err := NewMemoryChecker(grants...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	opts = append([]rag.Option{rag.WithPermissionChecker(checker)}, opts...)
+	return rag.NewRAGPipeline(nil, resourceType, permission, docs, opts...), checker
+}
+
+// LookupResources implements rag.ResourceLister. IDs are sorted.
+func (c *MemoryChecker) LookupResources(_ context.Context, subject *apiv1.SubjectReference, resourceType, permission string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	suffixes := c.subjectKeys(subject)
+	for i, s := range suffixes {
+		suffixes[i] = "#" + permission + "@" + s
+	}
+	seen := make(map[string]bool)
+	for g := range c.grants {
+		rest, ok := strings.CutPrefix(g, resourceType+":")
+		if !ok {
+			continue
+		}
+		for _, suffix := range suffixes {
+			if id, ok := strings.CutSuffix(rest, suffix); ok {
+				seen[id] = true
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// subjectKeys returns the grant suffixes that match subject: itself, for
+// subjects without a relation its type's wildcard, and every subject set
+// those belong to, directly or through other sets. c.mu must be held.
+func (c *MemoryChecker) subjectKeys(subject *apiv1.SubjectReference) []string {
+	obj := subject.GetObject()
+	keys := []string{obj.GetObjectType() + ":" + obj.GetObjectId()}
+	if rel := subject.GetOptionalRelation(); rel != "" {
+		keys[0] += "#" + rel
+	} else {
+		keys = append(keys, obj.GetObjectType()+":*")
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		seen[k] = true
+	}
+	for i := 0; i < len(keys); i++ {
+		for g := range c.grants {
+			set, member, _ := strings.Cut(g, "@")
+			if member == keys[i] && !seen[set] {
+				seen[set] = true
+				keys = append(keys, set)
+			}
+		}
+	}
+	return keys
+}
+
+func validGrant(g string) error {
+	resource, subject, ok := strings.Cut(g, "@")
+	object, permission, hasPermission := strings.Cut(resource, "#")
+	subjObject, _, _ := strings.Cut(subject, "#")
+	if !ok || !hasPermission || permission == "" {
+		return fmt.Errorf("ragtest: grant %q is not resource#permission@subject", g)
+	}
+	for _, obj := range []string{object, subjObject} {
+		if _, err := rag.ParseObjectReference(obj); err != nil {
+			return fmt.Errorf("ragtest: grant %q: %w", g, err)
+		}
+	}
+	return nil
+}
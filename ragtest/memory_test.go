@@ -0,0 +1,147 @@
+package ragtest_test
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+func memoryDocs() []rag.Document {
+	docs := make([]rag.Document, 4)
+	for i, id := range []string{"doc1", "doc2", "doc3", "doc4"} {
+		docs[i] = rag.Document{ID: id, Text: "memo " + id, Metadata: map[string]string{rag.SpiceDBObjectKey: "document:" + id}}
+	}
+	return docs
+}
+
+func docIDs(docs []rag.Document) []string {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+func TestMemoryCheckerInPipeline(t *testing.T) {
+	t.Parallel()
+
+	checker, err := ragtest.NewMemoryChecker(
+		"document:doc1#read@user:emilia",
+		"document:doc2#read@user:*",
+		"document:doc3#read@group:eng#member",
+	)
+	require.NoError(t, err)
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(nil, "document", "read", memoryDocs(),
+			rag.WithPermissionChecker(checker), rag.WithFilterStrategy(strategy))
+
+		results, err := pipeline.Query(context.Background(), "emilia", "memo")
+		require.NoError(t, err)
+		require.Equal(t, []string{"doc1", "doc2"}, docIDs(results))
+
+		results, err = pipeline.Query(context.Background(), "eng", "memo", rag.WithSubjectType("group", "member"))
+		require.NoError(t, err)
+		require.Equal(t, []string{"doc3"}, docIDs(results))
+	}
+}
+
+func TestMemoryCheckerNestedGroups(t *testing.T) {
+	t.Parallel()
+
+	checker, err := ragtest.NewMemoryChecker(
+		"document:doc1#read@group:eng#member",
+		"document:doc2#read@group:sre#member",
+		"group:eng#member@user:emilia",
+		"group:eng#member@group:sre#member",
+		"group:sre#member@user:beatrice",
+		"group:sre#member@group:eng#member", // cycles are harmless
+	)
+	require.NoError(t, err)
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(nil, "document", "read", memoryDocs(),
+			rag.WithPermissionChecker(checker), rag.WithFilterStrategy(strategy))
+
+		results, err := pipeline.Query(context.Background(), "beatrice", "memo")
+		require.NoError(t, err)
+		require.Equal(t, []string{"doc1", "doc2"}, docIDs(results), "beatrice is in eng through sre")
+
+		results, err = pipeline.Query(context.Background(), "carl", "memo")
+		require.NoError(t, err)
+		require.Empty(t, results)
+	}
+
+	checker.Revoke("group:eng#member@group:sre#member", "group:sre#member@group:eng#member")
+	d, err := checker.Check(context.Background(),
+		&apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "beatrice"}},
+		&apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"}, "read")
+	require.NoError(t, err)
+	require.Equal(t, rag.DecisionDenied, d)
+}
+
+func TestMemoryCheckerGrantRevoke(t *testing.T) {
+	t.Parallel()
+
+	checker, err := ragtest.NewMemoryChecker()
+	require.NoError(t, err)
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+
+	require.NoError(t, checker.Grant("document:doc4#read@user:emilia"))
+	ids, err := checker.LookupResources(context.Background(), subject, "document", "read")
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc4"}, ids)
+
+	checker.Revoke("document:doc4#read@user:emilia")
+	d, err := checker.Check(context.Background(), subject, &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc4"}, "read")
+	require.NoError(t, err)
+	require.Equal(t, rag.DecisionDenied, d)
+
+	for _, bad := range []string{"document:doc1@user:emilia", "doc1#read@user:emilia", "document:doc1#read@emilia"} {
+		require.Error(t, checker.Grant(bad), bad)
+	}
+}
+
+func TestMemoryCheckerSimulate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	checker, err := ragtest.NewMemoryChecker("group:eng#member@user:emilia")
+	require.NoError(t, err)
+	emilia := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	eng := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "group", ObjectId: "eng"}, OptionalRelation: "member"}
+	rel := &apiv1.Relationship{Resource: &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc2"}, Relation: "read", Subject: eng}
+
+	sim, err := checker.Simulate(ctx, []*apiv1.Relationship{rel})
+	require.NoError(t, err)
+	ids, err := sim.(rag.ResourceLister).LookupResources(ctx, emilia, "document", "read")
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc2"}, ids)
+
+	ids, err = checker.LookupResources(ctx, emilia, "document", "read")
+	require.NoError(t, err)
+	require.Empty(t, ids, "the checker itself is unchanged")
+
+	rel.OptionalCaveat = &apiv1.ContextualizedCaveat{CaveatName: "on_vpn"}
+	_, err = checker.Simulate(ctx, []*apiv1.Relationship{rel})
+	require.Error(t, err)
+}
+
+func TestNewPipeline(t *testing.T) {
+	t.Parallel()
+
+	pipeline, checker := ragtest.NewPipeline(t, "document", "read", memoryDocs(),
+		[]string{"document:doc3#read@user:beatrice", "document:doc4#read@user:beatrice"})
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "beatrice", "memo", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc3", "doc4"}, docIDs(results))
+	require.Equal(t, 4, checker.Checks())
+	require.Equal(t, 4, stats.Checked)
+}
@@ -0,0 +1,362 @@
+// Package redis is a rag.DocumentStore backed by Redis Stack's vector
+// search (RediSearch), spoken to over a minimal built-in RESP client so it
+// pulls in no driver. Documents are stored as hashes under a key prefix
+// and searched by KNN over an HNSW index. Package redistest starts Redis
+// Stack in a container.
+package redis
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// MaxSearchLimit is the number of nearest neighbours requested when a
+// search has no limit. It matches RediSearch's default MAXSEARCHRESULTS.
+const MaxSearchLimit = 10000
+
+// ErrInvalidIndex is returned by Migrate for index names RediSearch would
+// not accept.
+var ErrInvalidIndex = errors.New("redis: invalid index name")
+
+// Hash fields of a stored document.
+const (
+	fieldDocID     = "doc_id"
+	fieldText      = "text"
+	fieldMetadata  = "metadata"
+	fieldObject    = "spicedb_object"
+	fieldEmbedding = "embedding"
+)
+
+// Store is a rag.DocumentStore, rag.ScoredRetriever and
+// rag.FilteringRetriever over one RediSearch index. Scores are cosine
+// similarities. Store holds a single connection, redialled after
+// failures; calls are serialized on it.
+type Store struct {
+	addr     string
+	index    string
+	prefix   string
+	embedder rag.Embedder
+	dims     int
+	username string
+	password string
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithAuth authenticates new connections with AUTH. An empty username
+// authenticates as the default user.
+func WithAuth(username, password string) Option {
+	return func(s *Store) {
+		s.username, s.password = username, password
+	}
+}
+
+// WithKeyPrefix overrides the prefix of the documents' hash keys, which
+// defaults to the index name followed by a colon.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// New returns a Store on index of the Redis server at addr (host:port),
+// embedding documents and queries into dims dimensions with embedder.
+// Call Migrate once to create the index.
+func New(addr, index string, embedder rag.Embedder, dims int, opts ...Option) *Store {
+	s := &Store{addr: addr, index: index, prefix: index + ":", embedder: embedder, dims: dims}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Close closes the connection, if any. The Store redials on its next use.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.close()
+	s.conn = nil
+	return err
+}
+
+// Migrate creates the index if it does not exist yet.
+func (s *Store) Migrate(ctx context.Context) error {
+	if s.index == "" || strings.ContainsAny(s.index, " \t\r\n") {
+		return fmt.Errorf("%w: %q", ErrInvalidIndex, s.index)
+	}
+	_, err := s.do(ctx, []any{"FT.INFO", s.index})
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+	if msg := strings.ToLower(serverErr.Message); !strings.Contains(msg, "unknown index") && !strings.Contains(msg, "no such index") {
+		return err
+	}
+
+	_, err = s.do(ctx, []any{
+		"FT.CREATE", s.index, "ON", "HASH", "PREFIX", "1", s.prefix,
+		"SCHEMA",
+		fieldObject, "TAG",
+		fieldEmbedding, "VECTOR", "HNSW", "6",
+		"TYPE", "FLOAT32", "DIM", s.dims, "DISTANCE_METRIC", "COSINE",
+	})
+	if err != nil {
+		return fmt.Errorf("redis: creating index: %w", err)
+	}
+	return nil
+}
+
+// Add implements rag.DocumentStore, writing all documents in one
+// MULTI/EXEC transaction.
+func (s *Store) Add(ctx context.Context, docs ...rag.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Text
+	}
+	vectors, err := s.embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("redis: embedding documents: %w", err)
+	}
+
+	cmds := [][]any{{"MULTI"}}
+	for i, d := range docs {
+		metadata, err := json.Marshal(d.Metadata)
+		if err != nil {
+			return fmt.Errorf("redis: encoding metadata of %s: %w", d.ID, err)
+		}
+		// HSET only sets fields, so clear the old hash to drop stale
+		// fields of a replaced document.
+		key := s.prefix + d.ID
+		cmds = append(cmds, []any{"DEL", key}, []any{
+			"HSET", key,
+			fieldDocID, d.ID,
+			fieldText, d.Text,
+			fieldMetadata, metadata,
+			fieldObject, d.Metadata[rag.SpiceDBObjectKey],
+			fieldEmbedding, vectorBytes(vectors[i]),
+		})
+	}
+	cmds = append(cmds, []any{"EXEC"})
+	if _, err := s.do(ctx, cmds...); err != nil {
+		return fmt.Errorf("redis: storing documents: %w", err)
+	}
+	return nil
+}
+
+// Remove implements rag.DocumentStore.
+func (s *Store) Remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	cmd := []any{"DEL"}
+	for _, id := range ids {
+		cmd = append(cmd, s.prefix+id)
+	}
+	if _, err := s.do(ctx, cmd); err != nil {
+		return fmt.Errorf("redis: removing documents: %w", err)
+	}
+	return nil
+}
+
+// Retrieve implements rag.Retriever.
+func (s *Store) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	scored, err := s.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]rag.Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs, nil
+}
+
+// RetrieveScored implements rag.ScoredRetriever.
+func (s *Store) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	return s.search(ctx, query, limit, "*")
+}
+
+// RetrieveAccessible implements rag.FilteringRetriever with a hybrid KNN
+// query whose pre-filter is a tag match on the documents' SpiceDB object.
+func (s *Store) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	tags := make([]string, len(objects))
+	for i, o := range objects {
+		tags[i] = escapeTag(o)
+	}
+	return s.search(ctx, query, limit, "(@"+fieldObject+":{"+strings.Join(tags, "|")+"})")
+}
+
+func (s *Store) search(ctx context.Context, query string, limit int, filter string) ([]rag.ScoredDocument, error) {
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("redis: embedding query: %w", err)
+	}
+
+	reply, err := s.do(ctx, []any{
+		"FT.SEARCH", s.index,
+		filter + "=>[KNN $k @" + fieldEmbedding + " $vec AS dist]",
+		"PARAMS", "4", "k", limit, "vec", vectorBytes(vectors[0]),
+		"SORTBY", "dist", "ASC",
+		"RETURN", "4", fieldDocID, fieldText, fieldMetadata, "dist",
+		"LIMIT", "0", limit,
+		"DIALECT", "2",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis: searching: %w", err)
+	}
+
+	// The reply is the total followed by key, field list pairs.
+	items, _ := reply[0].([]any)
+	if len(items) == 0 || len(items)%2 != 1 {
+		return nil, fmt.Errorf("redis: searching: %w", errProtocol)
+	}
+	out := make([]rag.ScoredDocument, 0, len(items)/2)
+	for i := 2; i < len(items); i += 2 {
+		fields, _ := items[i].([]any)
+		var d rag.ScoredDocument
+		for j := 0; j+1 < len(fields); j += 2 {
+			name, _ := fields[j].([]byte)
+			value, _ := fields[j+1].([]byte)
+			switch string(name) {
+			case fieldDocID:
+				d.Document.ID = string(value)
+			case fieldText:
+				d.Document.Text = string(value)
+			case fieldMetadata:
+				if err := json.Unmarshal(value, &d.Document.Metadata); err != nil {
+					return nil, fmt.Errorf("redis: decoding metadata of %s: %w", items[i-1], err)
+				}
+			case "dist":
+				dist, err := strconv.ParseFloat(string(value), 64)
+				if err != nil {
+					return nil, fmt.Errorf("redis: searching: %w", errProtocol)
+				}
+				d.Score = 1 - dist
+			}
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// do runs cmds as one pipeline and returns their replies, or the first
+// error reply as a *ServerError.
+func (s *Store) do(ctx context.Context, cmds ...[]any) ([]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		c, err := dial(ctx, s.addr)
+		if err != nil {
+			return nil, err
+		}
+		if s.password != "" {
+			auth := []any{"AUTH", s.password}
+			if s.username != "" {
+				auth = []any{"AUTH", s.username, s.password}
+			}
+			replies, err := c.pipeline(ctx, [][]any{auth})
+			if err == nil {
+				err = replyError(replies)
+			}
+			if err != nil {
+				_ = c.close()
+				return nil, err
+			}
+		}
+		s.conn = c
+	}
+
+	replies, err := s.conn.pipeline(ctx, cmds)
+	if err != nil {
+		_ = s.conn.close()
+		s.conn = nil
+		return nil, err
+	}
+	if err := replyError(replies); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// replyError returns the first error reply, including those nested in an
+// EXEC result.
+func replyError(replies []any) error {
+	for _, r := range replies {
+		switch r := r.(type) {
+		case *ServerError:
+			return r
+		case []any:
+			if err := replyError(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// embed calls the embedder and checks the vectors fit the index.
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", rag.ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) != s.dims {
+			return nil, fmt.Errorf("%w: dimension %d, want %d", rag.ErrEmbeddingMismatch, len(v), s.dims)
+		}
+	}
+	return vectors, nil
+}
+
+// vectorBytes encodes v as RediSearch expects FLOAT32 vectors: packed
+// little-endian floats.
+func vectorBytes(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+// escapeTag escapes s for use inside a tag query, where punctuation such
+// as the colon in "document:doc1" is syntax.
+func escapeTag(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
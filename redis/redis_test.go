@@ -0,0 +1,351 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/redis"
+)
+
+var (
+	_ rag.DocumentStore      = (*redis.Store)(nil)
+	_ rag.FilteringRetriever = (*redis.Store)(nil)
+)
+
+// fakeRedis implements the subset of Redis Stack the store uses, for a
+// single index "docs" over the prefix "docs:".
+type fakeRedis struct {
+	password string
+
+	mu       sync.Mutex
+	created  int
+	hashes   map[string]map[string]string
+	searches [][]string
+}
+
+func newFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	f := &fakeRedis{password: password, hashes: make(map[string]map[string]string)}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	authed := f.password == ""
+	var queued [][]string
+	inMulti := false
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(cmd[0])
+		switch {
+		case name == "AUTH":
+			if cmd[len(cmd)-1] != f.password {
+				w.WriteString("-WRONGPASS invalid username-password pair\r\n")
+			} else {
+				authed = true
+				w.WriteString("+OK\r\n")
+			}
+		case !authed:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		case name == "MULTI":
+			inMulti = true
+			w.WriteString("+OK\r\n")
+		case name == "EXEC":
+			fmt.Fprintf(w, "*%d\r\n", len(queued))
+			for _, q := range queued {
+				w.WriteString(f.exec(q))
+			}
+			queued, inMulti = nil, false
+		case inMulti:
+			queued = append(queued, cmd)
+			w.WriteString("+QUEUED\r\n")
+		default:
+			w.WriteString(f.exec(cmd))
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs cmd and returns its encoded reply.
+func (f *fakeRedis) exec(cmd []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(cmd[0]) {
+	case "FT.INFO":
+		if f.created == 0 || cmd[1] != "docs" {
+			return "-Unknown index name\r\n"
+		}
+		return "*0\r\n"
+	case "FT.CREATE":
+		f.created++
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range cmd[1:] {
+			if _, ok := f.hashes[key]; ok {
+				n++
+				delete(f.hashes, key)
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "HSET":
+		h := make(map[string]string)
+		for i := 2; i+1 < len(cmd); i += 2 {
+			h[cmd[i]] = cmd[i+1]
+		}
+		f.hashes[cmd[1]] = h
+		return fmt.Sprintf(":%d\r\n", len(h))
+	case "FT.SEARCH":
+		return f.search(cmd)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+var knnQuery = regexp.MustCompile(`^(\*|\(@spicedb_object:\{(.*)\}\))=>\[KNN \$k @embedding \$vec AS dist\]$`)
+
+func (f *fakeRedis) search(cmd []string) string {
+	if cmd[1] != "docs" {
+		return "-no such index\r\n"
+	}
+	f.searches = append(f.searches, cmd)
+	m := knnQuery.FindStringSubmatch(cmd[2])
+	if m == nil {
+		return "-Syntax error\r\n"
+	}
+	var allowed map[string]bool
+	if m[1] != "*" {
+		allowed = make(map[string]bool)
+		for _, tag := range strings.Split(m[2], "|") {
+			allowed[strings.ReplaceAll(tag, `\`, "")] = true
+		}
+	}
+	k, _ := strconv.Atoi(cmd[6])
+	query := floats(cmd[8])
+
+	type hit struct {
+		key  string
+		h    map[string]string
+		dist float64
+	}
+	var hits []hit
+	for key, h := range f.hashes {
+		if allowed != nil && !allowed[h["spicedb_object"]] {
+			continue
+		}
+		hits = append(hits, hit{key, h, 1 - cosine(query, floats(h["embedding"]))})
+	}
+	sort.Slice(hits, func(a, b int) bool { return hits[a].dist < hits[b].dist })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n:%d\r\n", 1+2*len(hits), len(hits))
+	bulk := func(s string) { fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(s), s) }
+	for _, h := range hits {
+		bulk(h.key)
+		b.WriteString("*8\r\n")
+		for _, field := range []string{"doc_id", "text", "metadata"} {
+			bulk(field)
+			bulk(h.h[field])
+		}
+		bulk("dist")
+		bulk(strconv.FormatFloat(h.dist, 'g', -1, 64))
+	}
+	return b.String()
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	cmd := make([]string, n)
+	for i := range cmd {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(buf[:size])
+	}
+	return cmd, nil
+}
+
+func floats(b string) []float64 {
+	out := make([]float64, len(b)/4)
+	for i := range out {
+		out[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32([]byte(b[4*i:]))))
+	}
+	return out
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// axisEmbedder embeds known words on their own axis.
+type axisEmbedder struct{}
+
+func (axisEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	axes := map[string][]float32{
+		"cats":   {1, 0, 0},
+		"kitten": {0.9, 0.1, 0},
+		"money":  {0, 1, 0},
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		if v, ok := axes[text]; ok {
+			out[i] = v
+		} else {
+			out[i] = []float32{0, 0, 1}
+		}
+	}
+	return out, nil
+}
+
+func storeDocs() []rag.Document {
+	return []rag.Document{
+		{ID: "a", Text: "cats", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		{ID: "b", Text: "kitten", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:b"}},
+		{ID: "c", Text: "money", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:c"}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	fake, addr := newFakeRedis(t, "")
+	store := redis.New(addr, "docs", axisEmbedder{}, 3)
+	t.Cleanup(func() { _ = store.Close() })
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.Equal(t, 1, fake.created)
+
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+	require.Len(t, fake.hashes, 3)
+	require.Equal(t, "document:a", fake.hashes["docs:a"]["spicedb_object"])
+
+	scored, err := store.RetrieveScored(context.Background(), "cats", 2)
+	require.NoError(t, err)
+	require.Len(t, scored, 2)
+	require.Equal(t, storeDocs()[0], scored[0].Document)
+	require.Equal(t, "b", scored[1].Document.ID)
+	require.InDelta(t, 1, scored[0].Score, 1e-6)
+
+	require.NoError(t, store.Remove(context.Background(), "a"))
+	docs, err := store.Retrieve(context.Background(), "cats", 1)
+	require.NoError(t, err)
+	require.Equal(t, "b", docs[0].ID)
+
+	// The store redials after Close.
+	require.NoError(t, store.Close())
+	docs, err = store.Retrieve(context.Background(), "cats", 0)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, strconv.Itoa(redis.MaxSearchLimit), fake.searches[len(fake.searches)-1][6])
+}
+
+func TestPrefilterPushesDownToTagFilter(t *testing.T) {
+	t.Parallel()
+
+	fake, addr := newFakeRedis(t, "")
+	store := redis.New(addr, "docs", axisEmbedder{}, 3)
+	t.Cleanup(func() { _ = store.Close() })
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+
+	pipeline, _ := ragtest.NewPipeline(t, "document", "read", nil,
+		[]string{"document:b#read@user:emilia", "document:c#read@user:emilia"},
+		rag.WithRetriever(store), rag.WithFilterStrategy(rag.FilterPrefilter), rag.WithScanBudget(0, 1))
+
+	// Unfiltered, "a" would take the only slot and then be denied.
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "cats"})
+	require.NoError(t, err)
+	require.Len(t, resp.Documents, 1)
+	require.Equal(t, "b", resp.Documents[0].ID)
+
+	require.Equal(t, `(@spicedb_object:{document\:b|document\:c})=>[KNN $k @embedding $vec AS dist]`, fake.searches[0][2])
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	_, addr := newFakeRedis(t, "secret")
+
+	store := redis.New(addr, "docs", axisEmbedder{}, 3, redis.WithAuth("", "secret"))
+	t.Cleanup(func() { _ = store.Close() })
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+
+	wrong := redis.New(addr, "docs", axisEmbedder{}, 3, redis.WithAuth("", "guess"))
+	t.Cleanup(func() { _ = wrong.Close() })
+	var serverErr *redis.ServerError
+	require.ErrorAs(t, wrong.Add(context.Background(), storeDocs()...), &serverErr)
+	require.Contains(t, serverErr.Message, "WRONGPASS")
+}
+
+func TestServerError(t *testing.T) {
+	t.Parallel()
+
+	_, addr := newFakeRedis(t, "")
+	store := redis.New(addr, "missing", axisEmbedder{}, 3)
+	t.Cleanup(func() { _ = store.Close() })
+	_, err := store.Retrieve(context.Background(), "cats", 1)
+	var serverErr *redis.ServerError
+	require.ErrorAs(t, err, &serverErr)
+	require.Equal(t, "no such index", serverErr.Message)
+
+	// An error reply leaves the connection usable.
+	require.NoError(t, store.Add(context.Background(), storeDocs()...))
+}
+
+func TestEmbeddingMismatch(t *testing.T) {
+	t.Parallel()
+
+	_, addr := newFakeRedis(t, "")
+	store := redis.New(addr, "docs", axisEmbedder{}, 4)
+	require.ErrorIs(t, store.Add(context.Background(), storeDocs()...), rag.ErrEmbeddingMismatch)
+}
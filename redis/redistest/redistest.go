@@ -0,0 +1,120 @@
+// Package redistest starts throwaway Redis Stack servers in containers via
+// Testcontainers.
+package redistest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// DefaultImage is the Redis Stack image started when none is
+	// configured. Plain Redis images lack the search module.
+	DefaultImage = "redis/redis-stack-server:7.4.0-v1"
+
+	// DefaultStartupTimeout bounds how long Run waits for Redis to be
+	// ready.
+	DefaultStartupTimeout = time.Minute
+
+	port = "6379/tcp"
+)
+
+// Instance is a running Redis Stack container.
+type Instance struct {
+	// Addr is the host:port of the server, for redis.New.
+	Addr string
+
+	container testcontainers.Container
+}
+
+// Terminate removes the container.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return i.container.Terminate(ctx)
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	startupTimeout time.Duration
+}
+
+// WithImage overrides the Redis Stack image.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// Run starts a Redis Stack container. The caller owns the instance and must
+// Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{image: DefaultImage, startupTimeout: DefaultStartupTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.image,
+			ExposedPorts: []string{port},
+			WaitingFor:   wait.ForLog("Ready to accept connections").WithStartupTimeout(cfg.startupTimeout),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("redistest: starting container: %w", err)
+	}
+
+	addr, err := container.PortEndpoint(ctx, port, "")
+	if err != nil {
+		_ = container.Terminate(ctx)
+		return nil, fmt.Errorf("redistest: resolving address: %w", err)
+	}
+	return &Instance{Addr: addr, container: container}, nil
+}
+
+// Cleanup tears down an instance started by StartRedis. It is safe to
+// call more than once.
+type Cleanup func()
+
+// StartRedis runs a Redis Stack server for the duration of a test and
+// returns its address. The test is skipped when no container runtime is available
+// and fails if the server cannot be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the server earlier.
+func StartRedis(t *testing.T, opts ...Option) (string, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("redistest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.Addr, cleanup
+}
@@ -0,0 +1,160 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ServerError is an error reply from Redis.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "redis: " + e.Message
+}
+
+// conn speaks just enough RESP2 for the store: commands are arrays of
+// bulk strings and replies are decoded into string, int64, []byte, []any,
+// nil or *ServerError.
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+func dial(ctx context.Context, addr string) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
+
+// pipeline sends cmds in one write and reads one reply per command. Error
+// replies are returned in place; only I/O and protocol failures, after
+// which the connection is unusable, are returned as err.
+func (c *conn) pipeline(ctx context.Context, cmds [][]any) ([]any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.nc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// Unblock reads and writes as soon as ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { _ = c.nc.SetDeadline(time.Now()) })
+	defer stop()
+
+	for _, cmd := range cmds {
+		if err := c.writeCommand(cmd); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, c.wrap(ctx, err)
+	}
+
+	replies := make([]any, len(cmds))
+	for i := range replies {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, c.wrap(ctx, err)
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// wrap reports ctx's error instead of the deadline it caused.
+func (c *conn) wrap(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *conn) writeCommand(args []any) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch arg := arg.(type) {
+		case string:
+			b = []byte(arg)
+		case []byte:
+			b = arg
+		case int:
+			b = strconv.AppendInt(nil, int64(arg), 10)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(c.w, "$%d\r\n", len(b))
+		c.w.Write(b)
+		c.w.WriteString("\r\n")
+	}
+	return nil
+}
+
+var errProtocol = errors.New("redis: protocol error")
+
+func (c *conn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return &ServerError{Message: rest}, nil
+	case ':':
+		n, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, errProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, errProtocol
+	}
+}
+
+func (c *conn) close() error {
+	return c.nc.Close()
+}
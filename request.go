@@ -0,0 +1,213 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// QueryRequest describes a query run by Do. New query features are added
+// as fields here rather than as more positional parameters.
+type QueryRequest struct {
+	// UserID is the ID of the subject the results are authorized for. If
+	// it is empty, the subject set on the context with WithSubject is
+	// used.
+	UserID string
+
+	// SubjectType and SubjectRelation override the pipeline's subject
+	// type (see WithDefaultSubjectType) for this query, so UserID may name
+	// e.g. a "serviceaccount" or the members of a "group". An empty
+	// SubjectType keeps the default type and relation.
+	SubjectType     string
+	SubjectRelation string
+
+	// Tenant restricts the query to the documents whose TenantKey
+	// metadata is Tenant. A pipeline with WithTenancy requires it; if it
+	// is empty, the tenant of the Subject set with WithSubject is used.
+	Tenant string
+
+	// Permissions are checked instead of the pipeline's permission (or
+	// those of WithDefaultPermissions), combined by PermissionMode: with
+	// AnyPermission a document is returned if the subject holds one of
+	// them, with AllPermissions only if it holds all. Each permission
+	// after the first is only checked on the documents the ones before
+	// left undecided.
+	Permissions    []string
+	PermissionMode PermissionMode
+
+	// Query is the retrieval query.
+	Query string
+
+	// TopK caps the number of documents returned. It is applied after
+	// authorization, so up to TopK documents the user may read are
+	// returned. Zero means no cap.
+	TopK int
+
+	// PageSize makes the query return at most PageSize results and a
+	// QueryResponse.NextCursor to fetch the ones after them with. Only
+	// the candidates up to the end of the page are checked. Zero returns
+	// every result, or all after Cursor. TopK still caps the results
+	// across all pages.
+	PageSize int
+
+	// Cursor continues a paged query: it is the NextCursor of the
+	// previous page. It is opaque and only valid for the same subject,
+	// Query, TopK, MinScore and Filters; PageSize may change between
+	// pages. Pages follow the order of the results (see WithResultOrder),
+	// and a page resumes after the last document returned, so documents
+	// added or removed meanwhile neither shift nor repeat the ones
+	// already paged through.
+	Cursor string
+
+	// Filters restricts candidates to documents whose metadata holds
+	// every key with exactly the given value, e.g. {"lang": "en"}. Like
+	// MinScore it is applied before authorization, so filtered documents
+	// cost no permission checks.
+	Filters map[string]string
+
+	// MinScore drops candidates whose relevance score is below it before
+	// they are authorized. Documents from retrievers that do not score
+	// (see ScoredRetriever) have score 0.
+	MinScore float64
+
+	// Consistency is the SpiceDB consistency the query's permission checks
+	// are evaluated at, e.g. AtLeastAsFresh(token) to see relationships
+	// written just before. Nil uses the pipeline default (see
+	// WithDefaultConsistency).
+	Consistency *apiv1.Consistency
+
+	// CaveatContext is forwarded to SpiceDB with every check and lookup,
+	// supplying the values caveated relationships are evaluated with
+	// (e.g. "ip_address" or "now"). Values must be representable as
+	// protobuf Struct values.
+	CaveatContext map[string]any
+}
+
+// ErrInvalidRequest is wrapped by every ValidationError, so callers can
+// tell malformed requests from failed queries with errors.Is.
+var ErrInvalidRequest = errors.New("rag: invalid query request")
+
+// ValidationError reports a QueryRequest field that is malformed.
+type ValidationError struct {
+	// Field is the name of the offending QueryRequest field.
+	Field string
+
+	// Reason says what is wrong with it.
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("rag: invalid query request: %s %s", e.Field, e.Reason)
+}
+
+// Unwrap returns ErrInvalidRequest.
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidRequest
+}
+
+// SpiceDB's object ID syntax, up to 1024 bytes; the wildcard is not a
+// subject that can be checked.
+var subjectID = regexp.MustCompile(`^[a-zA-Z0-9/_|\-=+]+$`)
+
+// Validate reports every malformed field of req as a *ValidationError,
+// joined with errors.Join. Do, Query and Answer validate their request
+// before doing any work.
+func (req QueryRequest) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, &ValidationError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case req.UserID == "":
+		invalid("UserID", "is empty")
+	case len(req.UserID) > 1024 || !subjectID.MatchString(req.UserID):
+		invalid("UserID", "%q is not a valid SpiceDB object ID", req.UserID)
+	}
+	if req.SubjectType != "" && !objectType.MatchString(req.SubjectType) {
+		invalid("SubjectType", "%q is not a valid SpiceDB object type", req.SubjectType)
+	}
+	if req.SubjectRelation != "" && req.SubjectType == "" {
+		invalid("SubjectRelation", "is set without SubjectType")
+	}
+	if len(req.Permissions) > 0 {
+		permissionSet{mode: req.PermissionMode, perms: req.Permissions}.validate(invalid)
+	}
+	if req.TopK < 0 {
+		invalid("TopK", "is negative (%d)", req.TopK)
+	}
+	if req.PageSize < 0 {
+		invalid("PageSize", "is negative (%d)", req.PageSize)
+	}
+	if req.Cursor != "" {
+		if c, err := decodeCursor(req.Cursor); err != nil {
+			invalid("Cursor", "is malformed")
+		} else if c.Query != cursorHash(req) {
+			invalid("Cursor", "was issued for a different query")
+		}
+	}
+	if math.IsNaN(req.MinScore) {
+		invalid("MinScore", "is NaN")
+	}
+	for key := range req.Filters {
+		if key == "" {
+			invalid("Filters", "has an empty key")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// matches reports whether d's metadata satisfies every filter.
+func (req QueryRequest) matches(d Document) bool {
+	for key, value := range req.Filters {
+		if v, ok := d.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryResponse is the result of Do.
+type QueryResponse struct {
+	// Documents are the authorized documents, in retrieval order.
+	Documents []Document
+
+	// Results holds the same documents as Documents, with their scores,
+	// matched spans and permission decisions.
+	Results []QueryResult
+
+	// CheckErrors lists the documents whose permission check failed,
+	// under a FailurePolicy other than FailClosed. They were withheld, or
+	// returned unchecked under FailOpen.
+	CheckErrors []CheckError
+
+	// NextCursor fetches the next page as QueryRequest.Cursor. It is
+	// only set for a paged query (see QueryRequest.PageSize) with
+	// candidates left after this page; the next page may still turn out
+	// empty.
+	NextCursor string
+
+	// Stats describes the work done to answer the query.
+	Stats Stats
+}
+
+// Do runs req and returns the authorized documents together with the
+// query's statistics.
+func (r *RAGPipeline) Do(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	resp, err := r.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// MigrateLegacyCall returns the QueryRequest equivalent to the legacy call
+// Query(ctx, userID, query): Do(ctx, MigrateLegacyCall(userID, query))
+// returns the same documents in the same order.
+func MigrateLegacyCall(userID, query string) QueryRequest {
+	return QueryRequest{UserID: userID, Query: query}
+}
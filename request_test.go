@@ -0,0 +1,184 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// legacyScenario are the (user, query) pairs whose results are pinned for
+// both the legacy Query and Do.
+var legacyScenario = [][2]string{
+	{"emilia", "roadmap"},
+	{"emilia", "public"},
+	{"emilia", ""},
+	{"beatrice", "playbook"},
+	{"beatrice", "public"},
+	{"charlie", "public"},
+	{"charlie", "confidential"},
+	{"nobody", "o"},
+}
+
+// runLegacyScenario renders the results of every scenario query, as
+// returned by query, to JSON.
+func runLegacyScenario(t *testing.T, query func(user, q string) ([]rag.Document, error)) []byte {
+	t.Helper()
+
+	type entry struct {
+		User    string
+		Query   string
+		Results []rag.Document
+	}
+	var out []entry
+	for _, c := range legacyScenario {
+		docs, err := query(c[0], c[1])
+		require.NoError(t, err)
+		out = append(out, entry{User: c[0], Query: c[1], Results: docs})
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	require.NoError(t, err)
+	return append(b, '\n')
+}
+
+func legacyAPI(ctx context.Context, p *rag.RAGPipeline) func(user, q string) ([]rag.Document, error) {
+	return func(user, q string) ([]rag.Document, error) {
+		return p.Query(ctx, user, q)
+	}
+}
+
+func doAPI(ctx context.Context, p *rag.RAGPipeline) func(user, q string) ([]rag.Document, error) {
+	return func(user, q string) ([]rag.Document, error) {
+		resp, err := p.Do(ctx, rag.MigrateLegacyCall(user, q))
+		if err != nil {
+			return nil, err
+		}
+		return resp.Documents, nil
+	}
+}
+
+func TestLegacyQueryGolden(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	docs := append(scenarioDocs(),
+		// Silently skipped: no mapping and a malformed mapping.
+		rag.Document{ID: "unmapped", Text: "Public notes without an ACL."},
+		rag.Document{ID: "malformed", Text: "Public notes, broken ACL.", Metadata: map[string]string{rag.SpiceDBObjectKey: "doc9"}},
+		// Retrieval order follows corpus order.
+		rag.Document{ID: "doc0", Text: "Public archive.", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc0"}},
+	)
+	client, _ := newFakeClient(
+		"document:doc1#read@user:emilia",
+		"document:doc2#read@user:beatrice",
+		"document:doc3#read@user:emilia",
+		"document:doc3#read@user:beatrice",
+		"document:doc3#read@user:charlie",
+		"document:doc0#read@user:emilia",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	legacy := runLegacyScenario(t, legacyAPI(ctx, pipeline))
+	current := runLegacyScenario(t, doAPI(ctx, pipeline))
+	require.Equal(t, string(legacy), string(current))
+
+	golden := filepath.Join("testdata", "legacy_query.golden")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, legacy, 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(legacy))
+}
+
+func TestMigrateLegacyCall(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, rag.QueryRequest{UserID: "emilia", Query: "roadmap"}, rag.MigrateLegacyCall("emilia", "roadmap"))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := rag.QueryRequest{UserID: "emilia", Query: "roadmap"}
+	require.NoError(t, valid.Validate())
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(*rag.QueryRequest)
+		field  string
+	}{
+		{"empty user", func(r *rag.QueryRequest) { r.UserID = "" }, "UserID"},
+		{"wildcard user", func(r *rag.QueryRequest) { r.UserID = "*" }, "UserID"},
+		{"user with spaces", func(r *rag.QueryRequest) { r.UserID = "emilia smith" }, "UserID"},
+		{"malformed subject type", func(r *rag.QueryRequest) { r.SubjectType = "Service Account" }, "SubjectType"},
+		{"relation without type", func(r *rag.QueryRequest) { r.SubjectRelation = "member" }, "SubjectRelation"},
+		{"negative top k", func(r *rag.QueryRequest) { r.TopK = -1 }, "TopK"},
+		{"NaN min score", func(r *rag.QueryRequest) { r.MinScore = math.NaN() }, "MinScore"},
+		{"empty filter key", func(r *rag.QueryRequest) { r.Filters = map[string]string{"": "x"} }, "Filters"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := valid
+			tc.mutate(&req)
+			err := req.Validate()
+			require.ErrorIs(t, err, rag.ErrInvalidRequest)
+			var verr *rag.ValidationError
+			require.ErrorAs(t, err, &verr)
+			require.Equal(t, tc.field, verr.Field)
+		})
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	t.Parallel()
+
+	err := rag.QueryRequest{TopK: -1}.Validate()
+	require.ErrorContains(t, err, "UserID is empty")
+	require.ErrorContains(t, err, "TopK is negative (-1)")
+}
+
+func TestDoRejectsInvalidRequestBeforeChecking(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	_, err := pipeline.Do(context.Background(), rag.QueryRequest{Query: "roadmap"})
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+	_, err = pipeline.Query(context.Background(), "", "roadmap")
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+	require.Zero(t, fake.checkCount())
+}
+
+func TestFilters(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{
+		{ID: "en", Text: "release notes", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:en", "lang": "en"}},
+		{ID: "de", Text: "release notes", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:de", "lang": "de"}},
+		{ID: "none", Text: "release notes", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:none"}},
+	}
+	client, _ := newFakeClient("document:en#read@user:emilia", "document:de#read@user:emilia", "document:none#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{
+		UserID: "emilia", Query: "release", Filters: map[string]string{"lang": "de"},
+	})
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"de"}, resp.Documents)
+	require.Equal(t, 1, resp.Stats.Checked)
+
+	results, err := pipeline.Query(context.Background(), "emilia", "release", rag.WithFilter("lang", "en"))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"en"}, results)
+}
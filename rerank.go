@@ -0,0 +1,217 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Reranker reorders a query's candidates by a more precise, and usually
+// more expensive, relevance model than the retriever's, such as a
+// cross-encoder reading the query and each document together.
+type Reranker interface {
+	// Rerank returns docs ordered for query, most relevant first, with
+	// their new scores. It may leave documents out, e.g. to keep only the
+	// best; documents it returns that were not among docs are ignored.
+	Rerank(ctx context.Context, query string, docs []ScoredDocument) ([]ScoredDocument, error)
+}
+
+// RerankerFunc adapts a plain function to a Reranker.
+type RerankerFunc func(ctx context.Context, query string, docs []ScoredDocument) ([]ScoredDocument, error)
+
+// Rerank calls f(ctx, query, docs).
+func (f RerankerFunc) Rerank(ctx context.Context, query string, docs []ScoredDocument) ([]ScoredDocument, error) {
+	return f(ctx, query, docs)
+}
+
+// RerankStage selects where in a query the Reranker runs.
+type RerankStage int
+
+const (
+	// RerankBeforeFilter reranks the retrieved candidates before they
+	// are authorized. It is the default: TopK, pages and Results then
+	// check the best candidates first, so fewer checks are needed.
+	RerankBeforeFilter RerankStage = iota
+
+	// RerankAfterFilter reranks only the documents the subject may read.
+	// The Reranker never sees a document the subject may not read, which
+	// matters when it is a remote service, and scores fewer documents
+	// when most candidates are denied. Every candidate is authorized
+	// before the first result is returned, also by Results and paged
+	// queries.
+	RerankAfterFilter
+)
+
+// WithReranker makes every query rerank its candidates with rr, at the
+// RerankStage set by WithRerankStage. Without one, candidates keep the
+// retriever's order and scores. The pipeline's ResultOrder, if any, is
+// applied to the reranked scores.
+func WithReranker(rr Reranker) Option {
+	return func(r *RAGPipeline) {
+		r.reranker = rr
+	}
+}
+
+// WithRerankStage selects where the Reranker runs; see RerankStage.
+func WithRerankStage(s RerankStage) Option {
+	return func(r *RAGPipeline) {
+		r.rerankStage = s
+	}
+}
+
+// reranks reports whether the pipeline reranks at stage.
+func (r *RAGPipeline) reranks(stage RerankStage) bool {
+	return r.reranker != nil && r.rerankStage == stage
+}
+
+// rerank runs the Reranker over docs in a "rag.rerank" span. The
+// documents returned are those of docs, whatever the Reranker returned in
+// their place, so it cannot alter a document's text or SpiceDB mapping.
+// The documents it left out are explained as filtered, with decision.
+func (r *RAGPipeline) rerank(ctx context.Context, query string, docs []ScoredDocument, decision Decision, stats *Stats) ([]ScoredDocument, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	ctx, span := r.tracer().Start(ctx, "rag.rerank")
+	span.SetAttributes(attribute.Int("rag.rerank_input", len(docs)))
+	reranked, err := r.reranker.Rerank(ctx, query, docs)
+	endSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("rag: rerank: %w", err)
+	}
+	stats.Reranked += len(docs)
+
+	byID := make(map[string]int, len(docs))
+	for i, d := range docs {
+		byID[d.Document.ID] = i
+	}
+	out := make([]ScoredDocument, 0, len(reranked))
+	for _, d := range reranked {
+		i, ok := byID[d.Document.ID]
+		if !ok {
+			continue
+		}
+		delete(byID, d.Document.ID)
+		out = append(out, ScoredDocument{Document: docs[i].Document, Score: d.Score})
+	}
+	if ex := explainerFromContext(ctx); ex != nil {
+		for _, i := range byID {
+			ex.drop(docs[i].Document, OutcomeFiltered, decision, "dropped by reranker")
+		}
+	}
+	return out, nil
+}
+
+// rerankResults reranks the authorized results of resp under
+// RerankAfterFilter.
+func (q *pendingQuery) rerankResults() error {
+	r, resp := q.r, q.resp
+	if !r.reranks(RerankAfterFilter) {
+		return nil
+	}
+	scored := make([]ScoredDocument, len(resp.Results))
+	byID := make(map[string]QueryResult, len(resp.Results))
+	for i, res := range resp.Results {
+		scored[i] = ScoredDocument{Document: res.Document, Score: res.Score}
+		byID[res.Document.ID] = res
+	}
+	reranked, err := r.rerank(q.ctx, q.req.Query, scored, DecisionAllowed, &resp.Stats)
+	if err != nil {
+		return err
+	}
+	r.sortCandidates(reranked)
+
+	resp.Results = resp.Results[:0]
+	resp.Documents = resp.Documents[:0]
+	for _, d := range reranked {
+		res := byID[d.Document.ID]
+		res.Score = d.Score
+		resp.Results = append(resp.Results, res)
+		resp.Documents = append(resp.Documents, res.Document)
+	}
+	return nil
+}
+
+// decideAll authorizes every candidate left and, under
+// RerankAfterFilter and WithMMR, reorders the results.
+func (q *pendingQuery) decideAll() error {
+	if err := q.decide(q.docs, q.resources); err != nil {
+		return err
+	}
+	q.docs, q.resources = nil, nil
+	if err := q.rerankResults(); err != nil {
+		return err
+	}
+	q.diversify()
+	return nil
+}
+
+// CrossEncoder scores how relevant texts are to a query by reading the
+// query and each text together, which is slower but more precise than
+// comparing embeddings. Package tei implements it on a Text Embeddings
+// Inference server, which runs cross-encoders such as BAAI/bge-reranker
+// with ONNX or Candle.
+type CrossEncoder interface {
+	// Score returns one score per text, in order; higher is more
+	// relevant.
+	Score(ctx context.Context, query string, texts []string) ([]float64, error)
+}
+
+// CrossEncoderReranker is a Reranker ordering documents by the scores of
+// a CrossEncoder.
+type CrossEncoderReranker struct {
+	encoder CrossEncoder
+	depth   int
+}
+
+// CrossEncoderOption configures a CrossEncoderReranker.
+type CrossEncoderOption func(*CrossEncoderReranker)
+
+// WithRerankDepth makes the reranker score only the first n documents it
+// is given and drop the rest, bounding the cost of a query with many
+// candidates. Zero, the default, scores them all.
+func WithRerankDepth(n int) CrossEncoderOption {
+	return func(c *CrossEncoderReranker) {
+		c.depth = n
+	}
+}
+
+// NewCrossEncoderReranker returns a Reranker scoring documents' text with
+// encoder.
+func NewCrossEncoderReranker(encoder CrossEncoder, opts ...CrossEncoderOption) *CrossEncoderReranker {
+	c := &CrossEncoderReranker{encoder: encoder}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Rerank scores docs with the CrossEncoder and orders them by descending
+// score, keeping the given order among equal scores.
+func (c *CrossEncoderReranker) Rerank(ctx context.Context, query string, docs []ScoredDocument) ([]ScoredDocument, error) {
+	if c.depth > 0 && len(docs) > c.depth {
+		docs = docs[:c.depth]
+	}
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Document.Text
+	}
+	scores, err := c.encoder.Score(ctx, query, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(docs) {
+		return nil, fmt.Errorf("cross-encoder returned %d scores for %d documents", len(scores), len(docs))
+	}
+	out := make([]ScoredDocument, len(docs))
+	for i, d := range docs {
+		out[i] = ScoredDocument{Document: d.Document, Score: scores[i]}
+	}
+	slices.SortStableFunc(out, func(a, b ScoredDocument) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return out, nil
+}
@@ -0,0 +1,143 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// reverseReranker reverses the candidates' order and records the IDs it
+// was given.
+type reverseReranker struct {
+	seen []string
+}
+
+func (rr *reverseReranker) Rerank(_ context.Context, _ string, docs []rag.ScoredDocument) ([]rag.ScoredDocument, error) {
+	out := slices.Clone(docs)
+	slices.Reverse(out)
+	for i := range out {
+		rr.seen = append(rr.seen, out[i].Document.ID)
+		out[i].Score = float64(i)
+	}
+	return out, nil
+}
+
+func TestRerankBeforeFilter(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia", "document:doc8#read@user:emilia", "document:doc9#read@user:emilia")
+	rr := &reverseReranker{}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10),
+		rag.WithReranker(rr), rag.WithBulkCheckChunkSize(2))
+
+	var stats rag.Stats
+	got, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc9", "doc8", "doc1"}, docIDs(got))
+	require.Len(t, rr.seen, 10)
+	require.Equal(t, 10, stats.Reranked)
+
+	// The best candidates are checked first, so a page needs fewer checks.
+	checks := fake.checkCount()
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic", PageSize: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc9", "doc8"}, docIDs(resp.Documents))
+	require.Equal(t, 2, fake.checkCount()-checks)
+}
+
+func TestRerankAfterFilter(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc8#read@user:emilia", "document:doc9#read@user:emilia")
+	rr := &reverseReranker{}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(10),
+		rag.WithReranker(rr), rag.WithRerankStage(rag.RerankAfterFilter))
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic", TopK: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc9", "doc8"}, docIDs(resp.Documents))
+	require.Equal(t, []float64{0, 1}, []float64{resp.Results[0].Score, resp.Results[1].Score})
+	require.NotEmpty(t, resp.Results[0].Matches, "results keep their matches")
+	require.Equal(t, []string{"doc9", "doc8", "doc1"}, rr.seen, "denied documents are never reranked")
+
+	var streamed []string
+	for res, err := range pipeline.Results(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "synthetic"}) {
+		require.NoError(t, err)
+		streamed = append(streamed, res.Document.ID)
+	}
+	require.Equal(t, []string{"doc9", "doc8", "doc1"}, streamed)
+}
+
+func TestRerankCannotInjectDocuments(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc2#read@user:emilia")
+	rr := rag.RerankerFunc(func(_ context.Context, _ string, docs []rag.ScoredDocument) ([]rag.ScoredDocument, error) {
+		tampered := docs[1]
+		tampered.Document.Text = "tampered"
+		return []rag.ScoredDocument{
+			{Document: rag.Document{ID: "secret", Text: "injected"}},
+			tampered,
+		}, nil
+	})
+	for _, stage := range []rag.RerankStage{rag.RerankBeforeFilter, rag.RerankAfterFilter} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+			rag.WithReranker(rr), rag.WithRerankStage(stage))
+		got, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.True(t, strings.HasPrefix(got[0].Text, "synthetic entry"), got[0].Text)
+	}
+}
+
+func TestRerankError(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	boom := errors.New("boom")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithReranker(rag.RerankerFunc(func(context.Context, string, []rag.ScoredDocument) ([]rag.ScoredDocument, error) {
+			return nil, boom
+		})))
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.ErrorIs(t, err, boom)
+}
+
+// lengthEncoder scores each text by its length.
+type lengthEncoder struct{}
+
+func (lengthEncoder) Score(_ context.Context, _ string, texts []string) ([]float64, error) {
+	scores := make([]float64, len(texts))
+	for i, text := range texts {
+		scores[i] = float64(len(text))
+	}
+	return scores, nil
+}
+
+func TestCrossEncoderReranker(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.ScoredDocument{
+		{Document: rag.Document{ID: "short", Text: "ab"}, Score: 9},
+		{Document: rag.Document{ID: "long", Text: "abcd"}, Score: 1},
+		{Document: rag.Document{ID: "medium", Text: "abc"}, Score: 5},
+	}
+	reranked, err := rag.NewCrossEncoderReranker(lengthEncoder{}).Rerank(context.Background(), "q", docs)
+	require.NoError(t, err)
+	require.Equal(t, []rag.ScoredDocument{
+		{Document: docs[1].Document, Score: 4},
+		{Document: docs[2].Document, Score: 3},
+		{Document: docs[0].Document, Score: 2},
+	}, reranked)
+
+	reranked, err = rag.NewCrossEncoderReranker(lengthEncoder{}, rag.WithRerankDepth(2)).Rerank(context.Background(), "q", docs)
+	require.NoError(t, err)
+	require.Len(t, reranked, 2)
+	require.Equal(t, "long", reranked[0].Document.ID)
+}
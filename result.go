@@ -0,0 +1,116 @@
+package rag
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// Span is a half-open byte range [Start, End) of a document's Text, or of
+// an answer's text for Citation.
+type Span struct {
+	Start, End int
+}
+
+// QueryResult is one authorized document together with why and how well
+// it matched.
+type QueryResult struct {
+	Document Document
+
+	// Score is the retriever's relevance score; higher is better. The
+	// built-in substring scan scores every match 1, and retrievers that do
+	// not implement ScoredRetriever leave it 0.
+	Score float64
+
+	// Matches are the non-overlapping occurrences of the query in
+	// Document.Text, compared case-insensitively. Semantic matches may
+	// have none.
+	Matches []Span
+
+	// Snippets are passages of Document.Text around Matches, with the
+	// matches highlighted. They are only cut with WithSnippets.
+	Snippets []Snippet
+
+	// Decision is the permission decision that admitted the document.
+	// Under WithShadowMode it is the decision that would have withheld
+	// it, if any.
+	Decision Decision
+
+	// CheckErr is set when the document's permission check failed and
+	// it was returned anyway under FailOpen.
+	CheckErr error
+}
+
+// ScoredDocument is a retrieved document with its relevance score.
+type ScoredDocument struct {
+	Document Document
+	Score    float64
+}
+
+// ScoredRetriever is implemented by retrievers that can report how
+// relevant each document is. The pipeline prefers RetrieveScored when it
+// is available.
+type ScoredRetriever interface {
+	Retriever
+
+	// RetrieveScored is Retrieve with scores, most relevant first.
+	RetrieveScored(ctx context.Context, query string, limit int) ([]ScoredDocument, error)
+}
+
+// matchSpans returns the non-overlapping occurrences of query in text,
+// using the same case folding as the substring scan.
+func matchSpans(text, query string) []Span {
+	lq := newMatcher(query).runes
+	if len(lq) == 0 {
+		return nil
+	}
+
+	var spans []Span
+	for i := 0; i < len(text); {
+		if n := prefixFoldLen(text[i:], lq); n >= 0 {
+			spans = append(spans, Span{Start: i, End: i + n})
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return spans
+}
+
+// substringScored scores the matches of the substring scan.
+func substringScored(docs []Document) []ScoredDocument {
+	out := make([]ScoredDocument, len(docs))
+	for i, d := range docs {
+		out[i] = ScoredDocument{Document: d, Score: 1}
+	}
+	return out
+}
+
+func documentsOf(scored []ScoredDocument) []Document {
+	docs := make([]Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs
+}
+
+// add appends an authorized document to the response.
+func (resp *QueryResponse) add(d ScoredDocument, decision Decision, query string, snippets snippetConfig) {
+	matches := matchSpans(d.Document.Text, query)
+	resp.Documents = append(resp.Documents, d.Document)
+	resp.Results = append(resp.Results, QueryResult{
+		Document: d.Document,
+		Score:    d.Score,
+		Matches:  matches,
+		Snippets: snippets.snippets(d.Document.Text, matches),
+		Decision: decision,
+	})
+}
+
+// truncate keeps the first k results; k <= 0 keeps them all.
+func (resp *QueryResponse) truncate(k int) {
+	if k > 0 && len(resp.Results) > k {
+		resp.Results = resp.Results[:k]
+		resp.Documents = resp.Documents[:k]
+	}
+}
@@ -0,0 +1,106 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestDoReturnsResults(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{
+		{ID: "a", Text: "Roadmap: the roadmap for ROADMAPS", Metadata: map[string]string{"spicedb_object": "document:a"}},
+		{ID: "b", Text: "roadmap", Metadata: map[string]string{"spicedb_object": "document:b"}},
+	}
+	client, _ := newFakeClient("document:a#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "roadmap"})
+	require.NoError(t, err)
+	require.Equal(t, []rag.QueryResult{{
+		Document: docs[0],
+		Score:    1,
+		Matches:  []rag.Span{{Start: 0, End: 7}, {Start: 13, End: 20}, {Start: 25, End: 32}},
+		Decision: rag.DecisionAllowed,
+	}}, resp.Results)
+	require.Equal(t, []rag.Document{docs[0]}, resp.Documents)
+}
+
+func TestResultSpansUseByteOffsets(t *testing.T) {
+	t.Parallel()
+
+	text := "Ünïcode ROADMAP"
+	docs := []rag.Document{{ID: "u", Text: text, Metadata: map[string]string{"spicedb_object": "document:u"}}}
+	client, _ := newFakeClient("document:u#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "roadmap"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	span := resp.Results[0].Matches[0]
+	require.Equal(t, "ROADMAP", text[span.Start:span.End])
+}
+
+func TestResultsCarryRetrieverScores(t *testing.T) {
+	t.Parallel()
+
+	embedder := &vocabEmbedder{vocab: []string{"cats", "dogs", "budget", "forecast"}}
+	rt, err := rag.NewVectorRetriever(context.Background(), embedder, vectorDocs())
+	require.NoError(t, err)
+	client, _ := newFakeClient("document:pets#read@user:emilia", "document:cats#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(rt))
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "cats"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 2)
+	require.Equal(t, "cats", resp.Results[0].Document.ID)
+	require.InDelta(t, 1.0, resp.Results[0].Score, 1e-9)
+	require.Less(t, resp.Results[1].Score, resp.Results[0].Score)
+	require.Greater(t, resp.Results[1].Score, 0.0)
+}
+
+func TestTopKCountsAuthorizedDocuments(t *testing.T) {
+	t.Parallel()
+
+	// The first 50 candidates are denied; TopK must still fill up from
+	// the authorized ones that follow.
+	var allowed []string
+	for i := 50; i < 60; i++ {
+		allowed = append(allowed, fmt.Sprintf("document:doc%d#read@user:emilia", i))
+	}
+	client, _ := newFakeClient(allowed...)
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(100), rag.WithFilterStrategy(strategy))
+
+		results, err := pipeline.Query(context.Background(), "emilia", "synthetic", rag.WithTopK(3))
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"doc50", "doc51", "doc52"}, results)
+	}
+}
+
+func TestMinScoreDropsCandidatesBeforeAuthorization(t *testing.T) {
+	t.Parallel()
+
+	embedder := &vocabEmbedder{vocab: []string{"cats", "dogs", "budget", "forecast"}}
+	rt, err := rag.NewVectorRetriever(context.Background(), embedder, vectorDocs())
+	require.NoError(t, err)
+	client, _ := newFakeClient("document:pets#read@user:emilia", "document:cats#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(rt))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "cats", rag.WithMinScore(0.9), rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"cats"}, results)
+	require.Equal(t, 1, stats.Checked)
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "cats", MinScore: 0.5, TopK: 1})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	require.Equal(t, "cats", resp.Results[0].Document.ID)
+}
@@ -0,0 +1,124 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+)
+
+// Retriever finds the documents relevant to a query. Authorization is
+// applied to whatever it returns, so it must not filter by user itself.
+//
+// Implementations may be backed by an embedding model, a search index or
+// anything else; the pipeline only relies on this method.
+type Retriever interface {
+	// Retrieve returns at most limit documents for query, most relevant
+	// first. A limit of zero means no limit.
+	Retrieve(ctx context.Context, query string, limit int) ([]Document, error)
+}
+
+// DocumentStore is a Retriever that owns its documents, such as a vector
+// database. Stores are kept in sync by the application: documents are
+// authorized by the pipeline after retrieval, so a store never needs to
+// know about permissions.
+type DocumentStore interface {
+	Retriever
+
+	// Add stores docs, replacing documents with the same ID.
+	Add(ctx context.Context, docs ...Document) error
+
+	// Remove deletes the documents with the given IDs. Unknown IDs are
+	// ignored.
+	Remove(ctx context.Context, ids ...string) error
+}
+
+// WithRetriever replaces the built-in substring scan over the pipeline's
+// corpus with rt.
+//
+// The scan budget's maxMatches becomes the limit passed to rt.
+// maxDocsScanned only applies to BM25Retriever, which reports what it
+// examined; the pipeline cannot see into other retrievers. Under the
+// prefilter strategy rt's results are restricted to the accessible set
+// after retrieval, unless rt is a FilteringRetriever that can search the
+// accessible set directly.
+func WithRetriever(rt Retriever) Option {
+	return func(r *RAGPipeline) {
+		r.retriever = rt
+	}
+}
+
+// SubstringRetriever is the pipeline's default retrieval: a case-insensitive
+// substring match on Text, returning documents in corpus order. It is
+// exported so it can be used on its own or wrapped by other retrievers.
+type SubstringRetriever struct {
+	docs []Document
+}
+
+// NewSubstringRetriever returns a SubstringRetriever over docs.
+func NewSubstringRetriever(docs []Document) *SubstringRetriever {
+	return &SubstringRetriever{docs: docs}
+}
+
+// Retrieve implements Retriever.
+func (s *SubstringRetriever) Retrieve(ctx context.Context, query string, limit int) ([]Document, error) {
+	var out []Document
+	m := newMatcher(query)
+	for _, d := range s.docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		if m.match(d.Text) {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// retrieveWith asks the configured Retriever for candidates, with scores
+// when it is a ScoredRetriever, or calls search instead if it is not nil.
+// One result beyond maxMatches is requested so that an exhausted budget
+// can be told apart from a query with exactly maxMatches results.
+func (r *RAGPipeline) retrieveWith(ctx context.Context, query string, stats *Stats, search func(ctx context.Context, query string, limit int) ([]ScoredDocument, error)) ([]ScoredDocument, error) {
+	limit := 0
+	if r.maxMatches > 0 {
+		limit = r.maxMatches + 1
+	}
+	budget := &scanBudget{max: r.maxDocsScanned}
+	ctx = contextWithScanBudget(ctx, budget)
+
+	if search == nil {
+		if scored, ok := r.retriever.(ScoredRetriever); ok {
+			search = scored.RetrieveScored
+		}
+	}
+
+	var candidates []ScoredDocument
+	if search != nil {
+		var err error
+		if candidates, err = search(ctx, query, limit); err != nil {
+			return nil, fmt.Errorf("rag: retrieval: %w", err)
+		}
+	} else {
+		docs, err := r.retriever.Retrieve(ctx, query, limit)
+		if err != nil {
+			return nil, fmt.Errorf("rag: retrieval: %w", err)
+		}
+		candidates = make([]ScoredDocument, len(docs))
+		for i, d := range docs {
+			candidates[i] = ScoredDocument{Document: d}
+		}
+	}
+	if r.maxMatches > 0 && len(candidates) > r.maxMatches {
+		candidates = candidates[:r.maxMatches]
+		stats.BudgetExceeded = true
+	}
+	stats.DocsScanned = budget.scanned
+	if budget.exceeded {
+		stats.BudgetExceeded = true
+	}
+
+	stats.Candidates = len(candidates)
+	return candidates, nil
+}
@@ -0,0 +1,108 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// staticRetriever returns its documents regardless of the query and
+// records the limits it was asked for.
+type staticRetriever struct {
+	docs   []rag.Document
+	err    error
+	limits []int
+}
+
+func (s *staticRetriever) Retrieve(_ context.Context, _ string, limit int) ([]rag.Document, error) {
+	s.limits = append(s.limits, limit)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if limit > 0 && len(s.docs) > limit {
+		return s.docs[:limit], nil
+	}
+	return s.docs, nil
+}
+
+func TestCustomRetrieverResultsAreAuthorized(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc2#read@user:emilia")
+	rt := &staticRetriever{docs: syntheticCorpus(4)}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(rt))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "anything", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+	require.Equal(t, []int{0}, rt.limits)
+	require.Equal(t, 4, stats.Candidates)
+	require.Equal(t, 3, stats.Denied)
+}
+
+func TestCustomRetrieverHonoursMaxMatches(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc0#read@user:emilia")
+	rt := &staticRetriever{docs: syntheticCorpus(10)}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+		rag.WithRetriever(rt), rag.WithScanBudget(0, 3))
+
+	var stats rag.Stats
+	_, err := pipeline.Query(context.Background(), "emilia", "anything", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.Equal(t, []int{4}, rt.limits)
+	require.Equal(t, 3, stats.Candidates)
+	require.True(t, stats.BudgetExceeded)
+
+	rt.docs = syntheticCorpus(3)
+	_, err = pipeline.Query(context.Background(), "emilia", "anything", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.False(t, stats.BudgetExceeded)
+}
+
+func TestCustomRetrieverError(t *testing.T) {
+	t.Parallel()
+
+	errIndex := errors.New("index unavailable")
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+		rag.WithRetriever(&staticRetriever{err: errIndex}))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "anything")
+	require.ErrorIs(t, err, errIndex)
+}
+
+func TestCustomRetrieverWithPrefilter(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil,
+		rag.WithRetriever(&staticRetriever{docs: syntheticCorpus(3)}),
+		rag.WithFilterStrategy(rag.FilterPrefilter))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "anything")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+	require.Zero(t, fake.checkCount())
+	require.Empty(t, fake.bulkRequestSizes())
+}
+
+func TestSubstringRetriever(t *testing.T) {
+	t.Parallel()
+
+	rt := rag.NewSubstringRetriever(syntheticCorpus(20))
+
+	docs, err := rt.Retrieve(context.Background(), "DOC1", 0)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc10", "doc11", "doc12", "doc13", "doc14", "doc15", "doc16", "doc17", "doc18", "doc19"}, docs)
+
+	docs, err = rt.Retrieve(context.Background(), "doc1", 2)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1", "doc10"}, docs)
+}
@@ -0,0 +1,265 @@
+package rag
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy configures how a RetryingChecker retries transient failures.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per call, including the
+	// first. Values below 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry. Each further
+	// delay is Multiplier times the previous one, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter randomizes each delay by up to this fraction of it in either
+	// direction, so clients that failed together do not retry together.
+	Jitter float64
+
+	// BudgetRatio is the fraction of calls that may be retried on top of
+	// BudgetReserve. Once it is spent, failures are returned at once, so
+	// retries cannot multiply the load on a SpiceDB that is down.
+	BudgetRatio   float64
+	BudgetReserve int
+}
+
+// DefaultRetryPolicy retries a call twice, after about 50ms and 100ms,
+// and retries at most one call in ten once a reserve of ten retries is
+// spent.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	BudgetRatio:    0.1,
+	BudgetReserve:  10,
+}
+
+// WithRetry wraps the pipeline's PermissionChecker in a RetryingChecker
+// with policy p. Like WithCheckCache it applies to whichever checker the
+// pipeline ends up with; with both, only cache misses are retried.
+func WithRetry(p RetryPolicy) Option {
+	return func(r *RAGPipeline) {
+		r.retry = &p
+	}
+}
+
+// RetryingChecker is a PermissionChecker that retries the checks and
+// lookups of another checker when they fail with codes.Unavailable or
+// codes.DeadlineExceeded, waiting with exponential backoff in between.
+// A call whose own context is done is never retried.
+type RetryingChecker struct {
+	inner  PermissionChecker
+	policy RetryPolicy
+
+	mu        sync.Mutex
+	tokens    float64
+	retries   int
+	throttled int
+}
+
+// RetryStats reports a RetryingChecker's activity. Throttled counts the
+// retries the budget refused.
+type RetryStats struct {
+	Retries, Throttled int
+}
+
+// NewRetryingChecker wraps inner with retries under policy.
+func NewRetryingChecker(inner PermissionChecker, policy RetryPolicy) *RetryingChecker {
+	return &RetryingChecker{inner: inner, policy: policy, tokens: float64(policy.BudgetReserve)}
+}
+
+// Stats returns the number of retries made and refused so far.
+func (c *RetryingChecker) Stats() RetryStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return RetryStats{Retries: c.retries, Throttled: c.throttled}
+}
+
+// Check implements PermissionChecker.
+func (c *RetryingChecker) Check(ctx context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (Decision, error) {
+	var d Decision
+	err := c.do(ctx, func() (err error) {
+		d, err = c.inner.Check(ctx, subject, resource, permission)
+		return err
+	})
+	return d, err
+}
+
+// CheckBulk implements BulkPermissionChecker. A request that fails as a
+// whole is retried as a whole; items that fail individually are retried
+// together in a smaller request. Checkers that cannot check in bulk are
+// called with DefaultCheckConcurrency concurrent Check calls.
+func (c *RetryingChecker) CheckBulk(ctx context.Context, subject *apiv1.SubjectReference, resources []*apiv1.ObjectReference, permission string) ([]CheckResult, error) {
+	bulk, ok := c.inner.(BulkPermissionChecker)
+	if !ok {
+		results, _, err := checkEach(ctx, c, subject, resources, permission, 0, false)
+		return results, err
+	}
+
+	results := make([]CheckResult, len(resources))
+	pending := make([]int, len(resources))
+	for i := range pending {
+		pending[i] = i
+	}
+	attempt := 0
+	for {
+		batch := make([]*apiv1.ObjectReference, len(pending))
+		for j, i := range pending {
+			batch[j] = resources[i]
+		}
+		var fresh []CheckResult
+		if err := c.do(ctx, func() (err error) {
+			fresh, err = bulk.CheckBulk(ctx, subject, batch, permission)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		var failed []int
+		for j, i := range pending {
+			results[i] = fresh[j]
+			if transient(ctx, fresh[j].Err) {
+				failed = append(failed, i)
+			}
+		}
+		attempt++
+		if len(failed) == 0 || !c.retry(ctx, attempt) {
+			return results, nil
+		}
+		pending = failed
+	}
+}
+
+// LookupResources implements ResourceLister by retrying the inner
+// checker's lookup from the start.
+func (c *RetryingChecker) LookupResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) ([]string, error) {
+	lister, ok := c.inner.(ResourceLister)
+	if !ok {
+		return nil, ErrPrefilterUnsupported
+	}
+	var ids []string
+	err := c.do(ctx, func() (err error) {
+		ids, err = lister.LookupResources(ctx, subject, resourceType, permission)
+		return err
+	})
+	return ids, err
+}
+
+// LookupConditionalResources implements ConditionalLister by retrying
+// the inner checker's lookup from the start.
+func (c *RetryingChecker) LookupConditionalResources(ctx context.Context, subject *apiv1.SubjectReference, resourceType, permission string) (allowed, conditional []string, err error) {
+	lister, ok := c.inner.(ResourceLister)
+	if !ok {
+		return nil, nil, ErrPrefilterUnsupported
+	}
+	err = c.do(ctx, func() (err error) {
+		allowed, conditional, err = lookupResources(ctx, lister, subject, resourceType, permission)
+		return err
+	})
+	return allowed, conditional, err
+}
+
+// Simulate implements Simulator by wrapping the inner checker's simulated
+// checker with retries under the same policy, and a budget of its own.
+func (c *RetryingChecker) Simulate(ctx context.Context, relationships []*apiv1.Relationship) (PermissionChecker, error) {
+	sim, ok := c.inner.(Simulator)
+	if !ok {
+		return nil, ErrSimulationUnsupported
+	}
+	checker, err := sim.Simulate(ctx, relationships)
+	if err != nil {
+		return nil, err
+	}
+	return NewRetryingChecker(checker, c.policy), nil
+}
+
+// do runs call, retrying it while it fails transiently and the policy
+// allows.
+func (c *RetryingChecker) do(ctx context.Context, call func() error) error {
+	c.deposit()
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if !transient(ctx, err) || !c.retry(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// deposit credits the retry budget for a new call.
+func (c *RetryingChecker) deposit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = min(c.tokens+c.policy.BudgetRatio, max(float64(c.policy.BudgetReserve), 1))
+}
+
+// retry reports whether another attempt may follow attempt, having waited
+// for the backoff if so. It returns false once ctx is done.
+func (c *RetryingChecker) retry(ctx context.Context, attempt int) bool {
+	if attempt >= c.policy.MaxAttempts {
+		return false
+	}
+	c.mu.Lock()
+	if c.tokens < 1 {
+		c.throttled++
+		c.mu.Unlock()
+		return false
+	}
+	c.tokens--
+	c.retries++
+	c.mu.Unlock()
+
+	t := time.NewTimer(c.policy.backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoff is the delay after the given failed attempt, counting from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	for range attempt - 1 {
+		d *= mult
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// transient reports whether err is a transient SpiceDB failure, worth
+// retrying. A deadline is only transient if it is not ctx's own.
+func transient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
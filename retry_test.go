@@ -0,0 +1,214 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+// fastRetry retries without noticeable delay.
+var fastRetry = rag.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+	Multiplier:     2,
+	Jitter:         0.5,
+	BudgetReserve:  10,
+}
+
+type allowAllChecker struct{}
+
+func (allowAllChecker) Check(context.Context, *apiv1.SubjectReference, *apiv1.ObjectReference, string) (rag.Decision, error) {
+	return rag.DecisionAllowed, nil
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		fail      []int
+		code      string
+		policy    rag.RetryPolicy
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		{name: "recovers", fail: []int{1, 2}, code: "Unavailable", policy: fastRetry, wantCalls: 3},
+		{name: "deadline", fail: []int{1}, code: "DeadlineExceeded", policy: fastRetry, wantCalls: 2},
+		{name: "attempts exhausted", fail: []int{1, 2, 3}, code: "Unavailable", policy: fastRetry, wantCalls: 3, wantCode: codes.Unavailable},
+		{name: "not transient", fail: []int{1}, code: "PermissionDenied", policy: fastRetry, wantCalls: 1, wantCode: codes.PermissionDenied},
+		{name: "disabled", fail: []int{1}, code: "Unavailable", policy: rag.RetryPolicy{}, wantCalls: 1, wantCode: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			chaos, err := ragtest.NewChaosChecker(allowAllChecker{}, ragtest.ChaosPlan{
+				Rules: []ragtest.ChaosRule{{Calls: tt.fail, Error: tt.code}},
+			})
+			require.NoError(t, err)
+			pipeline := rag.NewRAGPipeline(nil, "document", "read", syntheticCorpus(1),
+				rag.WithPermissionChecker(chaos), rag.WithRetry(tt.policy))
+
+			results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+			require.Equal(t, tt.wantCalls, chaos.Calls())
+			if tt.wantCode != codes.OK {
+				require.Equal(t, tt.wantCode, status.Code(err))
+				require.Equal(t, tt.wantCode == codes.Unavailable, errors.Is(err, rag.ErrPermissionBackendUnavailable))
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Parallel()
+
+	chaos, err := ragtest.NewChaosChecker(allowAllChecker{}, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{{Error: "Unavailable"}},
+	})
+	require.NoError(t, err)
+	policy := fastRetry
+	policy.BudgetReserve = 2
+	retrying := rag.NewRetryingChecker(chaos, policy)
+
+	// The reserve covers both retries of the first check and none of
+	// the second.
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	resource := &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"}
+	for range 2 {
+		_, err := retrying.Check(context.Background(), subject, resource, "read")
+		require.Equal(t, codes.Unavailable, status.Code(err))
+	}
+	require.Equal(t, 4, chaos.Calls())
+	require.Equal(t, rag.RetryStats{Retries: 2, Throttled: 1}, retrying.Stats())
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	t.Parallel()
+
+	chaos, err := ragtest.NewChaosChecker(allowAllChecker{}, ragtest.ChaosPlan{
+		Rules: []ragtest.ChaosRule{{Error: "Unavailable"}},
+	})
+	require.NoError(t, err)
+	policy := fastRetry
+	policy.InitialBackoff, policy.MaxBackoff = time.Hour, time.Hour
+	retrying := rag.NewRetryingChecker(chaos, policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	subject := &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}}
+	_, err = retrying.Check(ctx, subject, &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"}, "read")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 1, chaos.Calls())
+}
+
+// flakyBulk fails its first CheckBulk as a whole and its second for doc1
+// only, and allows everything after that.
+type flakyBulk struct {
+	allowAllChecker
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (f *flakyBulk) CheckBulk(_ context.Context, _ *apiv1.SubjectReference, resources []*apiv1.ObjectReference, _ string) ([]rag.CheckResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for _, res := range resources {
+		ids = append(ids, res.GetObjectId())
+	}
+	f.batches = append(f.batches, ids)
+	if len(f.batches) == 1 {
+		return nil, status.Error(codes.Unavailable, "connection reset")
+	}
+	results := make([]rag.CheckResult, len(resources))
+	for i, res := range resources {
+		results[i].Decision = rag.DecisionAllowed
+		if len(f.batches) == 2 && res.GetObjectId() == "doc1" {
+			results[i].Err = status.Error(codes.DeadlineExceeded, "dispatch timed out")
+		}
+	}
+	return results, nil
+}
+
+func TestRetryBulkRetriesFailedItems(t *testing.T) {
+	t.Parallel()
+
+	checker := &flakyBulk{}
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", syntheticCorpus(3),
+		rag.WithPermissionChecker(checker), rag.WithRetry(fastRetry))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0", "doc1", "doc2"}, results)
+	require.Equal(t, [][]string{{"doc0", "doc1", "doc2"}, {"doc0", "doc1", "doc2"}, {"doc1"}}, checker.batches)
+}
+
+func TestRetryLookupResources(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	fake.failLookups = 1
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithFilterStrategy(rag.FilterPrefilter), rag.WithRetry(fastRetry))
+
+	results, err := pipeline.Query(context.Background(), "emilia", "o")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+}
+
+// The retry budget is the pipeline's circuit breaker: once an outage has
+// spent it, each query costs SpiceDB a single call until it recovers.
+func TestRetryBudgetTripsDuringOutage(t *testing.T) {
+	t.Parallel()
+
+	for name, strategy := range map[string]rag.FilterStrategy{
+		"bulk":   rag.FilterPostCheck,
+		"lookup": rag.FilterPrefilter,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			inner, err := ragtest.NewMemoryChecker("document:doc0#read@user:emilia")
+			require.NoError(t, err)
+			chaos, err := ragtest.NewChaosChecker(inner, ragtest.ChaosPlan{
+				Rules: []ragtest.ChaosRule{{ToCall: 5, Error: "Unavailable"}},
+			})
+			require.NoError(t, err)
+			policy := fastRetry
+			policy.BudgetReserve = 2
+			pipeline := rag.NewRAGPipeline(nil, "document", "read", syntheticCorpus(3),
+				rag.WithPermissionChecker(chaos), rag.WithRetry(policy), rag.WithFilterStrategy(strategy))
+
+			// The first query spends the budget on its two retries.
+			_, err = pipeline.Query(context.Background(), "emilia", "synthetic")
+			require.ErrorIs(t, err, rag.ErrPermissionBackendUnavailable)
+			require.Equal(t, 3, chaos.Calls())
+
+			for calls := 4; calls <= 5; calls++ {
+				_, err = pipeline.Query(context.Background(), "emilia", "synthetic")
+				require.ErrorIs(t, err, rag.ErrPermissionBackendUnavailable)
+				require.Equal(t, calls, chaos.Calls(), "failed calls are not retried")
+			}
+
+			results, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+			require.NoError(t, err)
+			requireEqualDocIDs(t, []string{"doc0"}, results)
+			require.Equal(t, 6, chaos.Calls())
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// Package s3 lists and reads the objects of an Amazon S3 bucket, or of an
+// S3-compatible store such as MinIO, over S3's REST API signed with
+// Signature Version 4. A Bucket's Source feeds loader.Ingest:
+//
+//	bucket := s3.New("acme-docs", s3.WithRegion("eu-west-1"),
+//		s3.WithCredentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), ""))
+//	res, err := loader.Ingest(ctx, bucket.Source("teams/"), pipeline,
+//		loader.WithObjectFunc(loader.ObjectFromPath(`^(?P<team>[^/]+)/`, "folder:$team")))
+//
+// Documents carry the bucket, key and ETag of their object as metadata.
+// A pipeline configured WithChunker chunks them as they are added.
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+)
+
+// APIError is a non-2xx response from S3.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("s3: server returned %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Object describes an object in a bucket.
+type Object struct {
+	Key          string
+	ETag         string // without quotes
+	Size         int64
+	LastModified time.Time
+}
+
+// Bucket is an S3 bucket.
+type Bucket struct {
+	name       string
+	region     string
+	endpoint   string
+	accessKey  string
+	secretKey  string
+	token      string
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// Option configures a Bucket.
+type Option func(*Bucket)
+
+// WithRegion sets the bucket's region, "us-east-1" by default.
+func WithRegion(region string) Option {
+	return func(b *Bucket) {
+		b.region = region
+	}
+}
+
+// WithEndpoint addresses an S3-compatible server, e.g.
+// "http://localhost:9000" for MinIO, using path-style URLs. By default
+// requests go to AWS's virtual-hosted endpoint of the bucket's region.
+func WithEndpoint(endpoint string) Option {
+	return func(b *Bucket) {
+		b.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithCredentials signs requests with an access key; sessionToken is
+// only needed for temporary credentials. Without credentials requests
+// are anonymous, which suits public buckets.
+func WithCredentials(accessKeyID, secretAccessKey, sessionToken string) Option {
+	return func(b *Bucket) {
+		b.accessKey, b.secretKey, b.token = accessKeyID, secretAccessKey, sessionToken
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(b *Bucket) {
+		b.httpClient = hc
+	}
+}
+
+// New returns the bucket named name.
+func New(name string, opts ...Option) *Bucket {
+	b := &Bucket{
+		name:       name,
+		region:     "us-east-1",
+		httpClient: http.DefaultClient,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Name returns the bucket's name.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// List yields the objects whose keys start with prefix, in key order,
+// fetching a page of up to 1000 at a time.
+func (b *Bucket) List(ctx context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		var token string
+		for {
+			q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+			if token != "" {
+				q.Set("continuation-token", token)
+			}
+			var page struct {
+				IsTruncated           bool
+				NextContinuationToken string
+				Contents              []struct {
+					Key          string
+					ETag         string
+					Size         int64
+					LastModified time.Time
+				}
+			}
+			if err := b.call(ctx, "", q, &page); err != nil {
+				yield(Object{}, fmt.Errorf("s3: listing %s/%s: %w", b.name, prefix, err))
+				return
+			}
+			for _, c := range page.Contents {
+				obj := Object{Key: c.Key, ETag: strings.Trim(c.ETag, `"`), Size: c.Size, LastModified: c.LastModified}
+				if !yield(obj, nil) {
+					return
+				}
+			}
+			if !page.IsTruncated || page.NextContinuationToken == "" {
+				return
+			}
+			token = page.NextContinuationToken
+		}
+	}
+}
+
+// Open returns the content of the object key. The caller closes it.
+func (b *Bucket) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("s3: reading %s/%s: %w", b.name, key, err)
+	}
+	return resp.Body, nil
+}
+
+// Source returns a loader.Source over the objects under prefix. A file's
+// Path is its key without prefix, its Location "s3://bucket/key", and its
+// metadata holds the bucket, key and ETag. Keys ending in "/", which
+// consoles create as folder markers, are left out.
+func (b *Bucket) Source(prefix string) loader.Source {
+	return source{bucket: b, prefix: prefix}
+}
+
+type source struct {
+	bucket *Bucket
+	prefix string
+}
+
+func (s source) Files(ctx context.Context) iter.Seq2[loader.File, error] {
+	return func(yield func(loader.File, error) bool) {
+		for obj, err := range s.bucket.List(ctx, s.prefix) {
+			if err != nil {
+				yield(loader.File{}, err)
+				return
+			}
+			path := strings.TrimLeft(strings.TrimPrefix(obj.Key, s.prefix), "/")
+			if path == "" || strings.HasSuffix(obj.Key, "/") {
+				continue
+			}
+			key := obj.Key
+			f := loader.File{
+				Path:     path,
+				Location: "s3://" + s.bucket.name + "/" + key,
+				Metadata: map[string]string{
+					loader.BucketKey:     s.bucket.name,
+					loader.ObjectNameKey: key,
+					loader.ETagKey:       obj.ETag,
+				},
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					return s.bucket.Open(ctx, key)
+				},
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// call sends a GET for key with query q and decodes the XML response
+// into out.
+func (b *Bucket) call(ctx context.Context, key string, q url.Values, out any) error {
+	resp, err := b.do(ctx, key, q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// do sends a signed GET for key with query q, returning a 2xx response.
+func (b *Bucket) do(ctx context.Context, key string, q url.Values) (*http.Response, error) {
+	u := b.endpoint + "/" + escape(b.name, false) + "/" + escape(key, false)
+	if b.endpoint == "" {
+		u = "https://" + b.name + ".s3." + b.region + ".amazonaws.com/" + escape(key, false)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = canonicalQuery(q)
+	if b.accessKey != "" {
+		b.sign(req, emptyPayloadHash)
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var body struct {
+			Code    string
+			Message string
+		}
+		if xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil {
+			apiErr.Code, apiErr.Message = body.Code, body.Message
+		}
+		if apiErr.Code == "" {
+			apiErr.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds Signature Version 4 headers to req, whose body hashes to
+// payloadHash. Host, Range and the x-amz- headers are signed.
+func (b *Bucket) sign(req *http.Request, payloadHash string) {
+	now := b.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.token != "" {
+		req.Header.Set("X-Amz-Security-Token", b.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + b.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), day)
+	for _, part := range []string{b.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery encodes q sorted by key, as Signature Version 4 wants
+// it signed and sent.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes everything but the unreserved characters, and
+// "/" unless slash is set.
+func escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !slash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/loader"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/s3"
+)
+
+// fakeS3 serves ListObjectsV2, two keys per page, and GetObject for the
+// bucket "docs".
+func fakeS3(t *testing.T, objects map[string]string, keys []string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+			return
+		}
+		if r.URL.Path == "/docs/" && r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			var matching []string
+			for _, k := range keys {
+				if strings.HasPrefix(k, prefix) {
+					matching = append(matching, k)
+				}
+			}
+			start := 0
+			fmt.Sscan(r.URL.Query().Get("continuation-token"), &start)
+			end := min(start+2, len(matching))
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for _, k := range matching[start:end] {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>"etag-%s"</ETag><Size>%d</Size><LastModified>2024-03-01T10:00:00.000Z</LastModified></Contents>`,
+					k, strings.ReplaceAll(k, "/", "-"), len(objects[k]))
+			}
+			if end < len(matching) {
+				fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>`, end)
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		content, ok := objects[strings.TrimPrefix(r.URL.Path, "/docs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+var objects = map[string]string{
+	"kb/eng/runbook.md":  "# Runbook\n\nRestart the service.",
+	"kb/eng/on call.txt": "Pager rotation.",
+	"kb/hr/":             "",
+	"kb/hr/policy.html":  "<title>Leave</title><p>Leave policy.</p>",
+	"kb/hr/scan.png":     "\x89PNG",
+	"other/ignored.md":   "Not under the prefix.",
+}
+
+var keys = []string{"kb/eng/on call.txt", "kb/eng/runbook.md", "kb/hr/", "kb/hr/policy.html", "kb/hr/scan.png", "other/ignored.md"}
+
+func newBucket(srv *httptest.Server, opts ...s3.Option) *s3.Bucket {
+	return s3.New("docs", append([]s3.Option{
+		s3.WithEndpoint(srv.URL),
+		s3.WithCredentials("AKID", "secret", ""),
+	}, opts...)...)
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	bucket := newBucket(fakeS3(t, objects, keys))
+	var got []string
+	for obj, err := range bucket.List(context.Background(), "kb/") {
+		require.NoError(t, err)
+		got = append(got, obj.Key)
+	}
+	require.Equal(t, keys[:5], got, "all pages")
+
+	for obj, err := range bucket.List(context.Background(), "kb/eng/runbook") {
+		require.NoError(t, err)
+		require.Equal(t, "etag-kb-eng-runbook.md", obj.ETag, "quotes are removed")
+		require.Equal(t, int64(len(objects["kb/eng/runbook.md"])), obj.Size)
+		require.Equal(t, 2024, obj.LastModified.Year())
+	}
+}
+
+type recordingIngester struct{ docs []rag.Document }
+
+func (r *recordingIngester) AddDocument(_ context.Context, doc rag.Document, _ ...rag.IngestOption) (*apiv1.ZedToken, error) {
+	r.docs = append(r.docs, doc)
+	return nil, nil
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	bucket := newBucket(fakeS3(t, objects, keys))
+	dst := &recordingIngester{}
+	res, err := loader.Ingest(context.Background(), bucket.Source("kb/"), dst,
+		loader.WithObjectFunc(loader.ObjectFromPath(`^(?P<team>[^/]+)/`, "folder:$team")))
+	require.NoError(t, err)
+	require.Equal(t, []string{"hr/scan.png"}, res.Skipped)
+	require.Len(t, res.Documents, 3)
+
+	onCall := res.Documents[0]
+	require.Equal(t, "eng/on_call", onCall.ID)
+	require.Equal(t, "Pager rotation.", onCall.Text, "keys with spaces are escaped and signed")
+	require.Equal(t, map[string]string{
+		rag.SpiceDBObjectKey: "folder:eng",
+		loader.FormatKey:     "text",
+		loader.SourceKey:     "s3://docs/kb/eng/on call.txt",
+		loader.BucketKey:     "docs",
+		loader.ObjectNameKey: "kb/eng/on call.txt",
+		loader.ETagKey:       "etag-kb-eng-on call.txt",
+	}, onCall.Metadata)
+
+	policy := res.Documents[2]
+	require.Equal(t, "hr/policy", policy.ID)
+	require.Equal(t, "folder:hr", policy.Metadata[rag.SpiceDBObjectKey])
+	require.Equal(t, "Leave", policy.Metadata[loader.TitleKey])
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeS3(t, objects, keys)
+	_, err := newBucket(srv).Open(context.Background(), "kb/missing.md")
+	var apiErr *s3.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Equal(t, "NoSuchKey", apiErr.Code)
+
+	_, err = loader.Ingest(context.Background(), s3.New("docs", s3.WithEndpoint(srv.URL)).Source(""), &recordingIngester{})
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "AccessDenied", apiErr.Code, "anonymous requests are unsigned")
+}
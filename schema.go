@@ -0,0 +1,193 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+)
+
+// ApplySchema writes schema to SpiceDB, replacing the current one, like
+// "zed schema write". SpiceDB rejects a schema that does not parse or
+// that would orphan existing relationships. It returns the revision of
+// the write.
+func ApplySchema(ctx context.Context, client *authzed.Client, schema string) (*apiv1.ZedToken, error) {
+	resp, err := client.WriteSchema(ctx, &apiv1.WriteSchemaRequest{Schema: schema})
+	if err != nil {
+		return nil, fmt.Errorf("rag: writing schema: %w", err)
+	}
+	return resp.GetWrittenAt(), nil
+}
+
+// ApplySchemaFile is ApplySchema with the schema read from path.
+func ApplySchemaFile(ctx context.Context, client *authzed.Client, path string) (*apiv1.ZedToken, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("rag: reading schema: %w", err)
+	}
+	return ApplySchema(ctx, client, string(b))
+}
+
+// ReadSchema returns SpiceDB's current schema and the revision it was
+// read at.
+func ReadSchema(ctx context.Context, client *authzed.Client) (string, *apiv1.ZedToken, error) {
+	resp, err := client.ReadSchema(ctx, &apiv1.ReadSchemaRequest{})
+	if err != nil {
+		return "", nil, fmt.Errorf("rag: reading schema: %w", err)
+	}
+	return resp.GetSchemaText(), resp.GetReadAt(), nil
+}
+
+// SchemaDiff lists the differences between two schemas. Definitions and
+// caveats are named "definition document" and "caveat on_vpn"; relations
+// and permissions of a definition present in both schemas are named
+// "document#viewer". The lists are sorted.
+type SchemaDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether the schemas are equivalent.
+func (d SchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String renders d one change per line, prefixed with "+", "-" or "~".
+func (d SchemaDiff) String() string {
+	var b strings.Builder
+	for _, c := range []struct {
+		prefix string
+		names  []string
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Changed}} {
+		for _, name := range c.names {
+			fmt.Fprintf(&b, "%s %s\n", c.prefix, name)
+		}
+	}
+	return b.String()
+}
+
+// DiffSchemas compares two schemas, e.g. the one read from SpiceDB and
+// the one about to be applied. It is a structural comparison, not a
+// parser: comments and whitespace are ignored, and a relation or
+// permission counts as changed when its text differs, even if the change
+// is equivalent. Malformed schemas give unspecified results.
+func DiffSchemas(from, to string) SchemaDiff {
+	a, b := schemaBlocks(from), schemaBlocks(to)
+
+	var d SchemaDiff
+	for key, old := range a {
+		cur, ok := b[key]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, key)
+		case old.kind == "caveat":
+			if old.text != cur.text {
+				d.Changed = append(d.Changed, key)
+			}
+		default:
+			for name, text := range old.members {
+				curText, ok := cur.members[name]
+				switch {
+				case !ok:
+					d.Removed = append(d.Removed, old.name+"#"+name)
+				case text != curText:
+					d.Changed = append(d.Changed, old.name+"#"+name)
+				}
+			}
+			for name := range cur.members {
+				if _, ok := old.members[name]; !ok {
+					d.Added = append(d.Added, old.name+"#"+name)
+				}
+			}
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			d.Added = append(d.Added, key)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+var (
+	schemaComment = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+	schemaMember  = regexp.MustCompile(`\b(?:relation|permission)\s+([a-z][a-z0-9_]*)`)
+)
+
+// schemaBlock is a top-level definition or caveat.
+type schemaBlock struct {
+	kind, name string
+	// text is the block without whitespace, for caveats.
+	text string
+	// members maps relation and permission names of a definition to
+	// their declaration without whitespace.
+	members map[string]string
+}
+
+// schemaBlocks splits schema into its top-level blocks, keyed by kind
+// and name.
+func schemaBlocks(schema string) map[string]schemaBlock {
+	schema = schemaComment.ReplaceAllString(schema, "")
+	blocks := make(map[string]schemaBlock)
+	for len(schema) > 0 {
+		open := strings.IndexByte(schema, '{')
+		if open < 0 {
+			break
+		}
+		end := matchingBrace(schema, open)
+		header, body := schema[:open], schema[open+1:end]
+		schema = schema[min(end+1, len(schema)):]
+
+		fields := strings.Fields(strings.ReplaceAll(header, "(", " ("))
+		if len(fields) < 2 {
+			continue
+		}
+		blk := schemaBlock{kind: fields[0], name: fields[1]}
+		if blk.kind == "definition" {
+			blk.members = make(map[string]string)
+			locs := schemaMember.FindAllStringSubmatchIndex(body, -1)
+			for i, loc := range locs {
+				next := len(body)
+				if i+1 < len(locs) {
+					next = locs[i+1][0]
+				}
+				blk.members[body[loc[2]:loc[3]]] = stripSpace(body[loc[0]:next])
+			}
+		} else {
+			blk.text = stripSpace(header + body)
+		}
+		blocks[blk.kind+" "+blk.name] = blk
+	}
+	return blocks
+}
+
+// matchingBrace returns the index of the brace closing the one at open,
+// or len(s) if it is never closed.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
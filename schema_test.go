@@ -0,0 +1,91 @@
+package rag_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+const baseSchema = `
+definition user {}
+
+/** document is a retrievable document. */
+definition document {
+	relation owner: user
+	relation viewer: user
+	permission read = owner + viewer
+}
+
+caveat on_vpn(ip ipaddress) {
+	ip.in_cidr('10.0.0.0/8')
+}
+`
+
+func TestApplyAndReadSchema(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	token, err := rag.ApplySchema(ctx, client, baseSchema)
+	require.NoError(t, err)
+	require.NotEmpty(t, token.GetToken())
+	require.Equal(t, baseSchema, fake.schema)
+
+	path := filepath.Join(t.TempDir(), "schema.zed")
+	require.NoError(t, os.WriteFile(path, []byte("definition user {}\n"), 0o600))
+	_, err = rag.ApplySchemaFile(ctx, client, path)
+	require.NoError(t, err)
+
+	schema, readAt, err := rag.ReadSchema(ctx, client)
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}\n", schema)
+	require.NotNil(t, readAt)
+
+	_, err = rag.ApplySchemaFile(ctx, client, filepath.Join(t.TempDir(), "missing.zed"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDiffSchemas(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, rag.DiffSchemas(baseSchema, baseSchema).Empty())
+
+	// Whitespace and comments do not matter.
+	reformatted := `definition user {}
+definition document {
+	// owners and viewers
+	relation owner: user
+	relation viewer:   user
+	permission read =
+		owner + viewer
+}
+caveat on_vpn(ip ipaddress) { ip.in_cidr('10.0.0.0/8') }`
+	require.True(t, rag.DiffSchemas(baseSchema, reformatted).Empty())
+
+	changed := `
+definition user {}
+definition group {
+	relation member: user
+}
+definition document {
+	relation viewer: user | user:* | group#member
+	relation editor: user
+	permission read = viewer + editor
+}
+caveat on_vpn(ip ipaddress) {
+	ip.in_cidr('10.1.0.0/16')
+}
+`
+	diff := rag.DiffSchemas(baseSchema, changed)
+	require.Equal(t, rag.SchemaDiff{
+		Added:   []string{"definition group", "document#editor"},
+		Removed: []string{"document#owner"},
+		Changed: []string{"caveat on_vpn", "document#read", "document#viewer"},
+	}, diff)
+	require.Equal(t, "+ definition group\n+ document#editor\n- document#owner\n~ caveat on_vpn\n~ document#read\n~ document#viewer\n", diff.String())
+}
@@ -0,0 +1,186 @@
+package rag
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// selfTestCleanupTimeout bounds the cleanup of SelfTest, which runs even
+// after ctx is done.
+const selfTestCleanupTimeout = 10 * time.Second
+
+// SelfTestStage names the part of the authorized-retrieval path a self
+// test exercises.
+type SelfTestStage string
+
+const (
+	SelfTestSchema    SelfTestStage = "schema"
+	SelfTestWrite     SelfTestStage = "write"
+	SelfTestRetrieval SelfTestStage = "retrieval"
+	SelfTestCheck     SelfTestStage = "check"
+	SelfTestCleanup   SelfTestStage = "cleanup"
+)
+
+// SelfTestError reports which stage of SelfTest failed.
+type SelfTestError struct {
+	Stage SelfTestStage
+	Err   error
+}
+
+func (e *SelfTestError) Error() string {
+	return fmt.Sprintf("rag: self test failed at %s stage: %v", e.Stage, e.Err)
+}
+
+func (e *SelfTestError) Unwrap() error {
+	return e.Err
+}
+
+// WithSelfTestRelation sets the relation SelfTest writes to grant its
+// synthetic subject the pipeline's permission. The default is "viewer".
+func WithSelfTestRelation(relation string) Option {
+	return func(r *RAGPipeline) {
+		r.selfTestRelation = relation
+	}
+}
+
+// WithSelfTestTenant sets the tenant SelfTest runs as under WithTenancy.
+// The default is "selftest"; under WithTenantPrefixes, name a tenant
+// whose prefixed schema is written.
+func WithSelfTestTenant(tenant string) Option {
+	return func(r *RAGPipeline) {
+		r.selfTestTenant = tenant
+	}
+}
+
+// SelfTest smoke-tests the whole authorized-retrieval path against the live
+// SpiceDB: it grants a synthetic subject access to a synthetic document
+// and queries for it, as that subject and as a second synthetic subject,
+// expecting the document to be returned to the first only. The queries
+// run as Query does, through the pipeline's filter strategy, permission
+// sets and policies, but against a corpus of the synthetic document
+// alone, so concurrent queries never see it; a Retriever set with
+// WithRetriever is not exercised, as it keeps its own index. The
+// relationship is removed afterwards, also when a stage fails. Failures
+// are reported as a *SelfTestError. Under WithTenancy the document and
+// the queries belong to the tenant set by WithSelfTestTenant.
+func (r *RAGPipeline) SelfTest(ctx context.Context) (err error) {
+	fail := func(stage SelfTestStage, err error) error {
+		return &SelfTestError{Stage: stage, Err: err}
+	}
+
+	tenant := ""
+	if r.tenancy {
+		tenant = r.selfTestTenant
+	}
+
+	schema, err := r.spiceClient.ReadSchema(ctx, &apiv1.ReadSchemaRequest{})
+	if err != nil {
+		return fail(SelfTestSchema, err)
+	}
+	definition := regexp.MustCompile(`(?m)^\s*definition\s+` + regexp.QuoteMeta(r.tenantType(tenant, r.resourceType)) + `\s*\{`)
+	if !definition.MatchString(schema.GetSchemaText()) {
+		return fail(SelfTestSchema, fmt.Errorf("schema has no definition for %q", r.tenantType(tenant, r.resourceType)))
+	}
+
+	var nonce [8]byte
+	_, _ = rand.Read(nonce[:])
+	id := "selftest-" + hex.EncodeToString(nonce[:])
+	allowedUser, deniedUser := id+"-allowed", id+"-denied"
+
+	doc := Document{
+		ID:       id,
+		Text:     "synthetic self test document " + id,
+		Metadata: map[string]string{SpiceDBObjectKey: r.resourceType + ":" + id},
+	}
+	if tenant != "" {
+		doc.Metadata[TenantKey] = tenant
+	}
+	res, err := r.resourceFor(doc)
+	if err != nil {
+		return fail(SelfTestWrite, err)
+	}
+
+	written, err := r.spiceClient.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{
+		Updates: []*apiv1.RelationshipUpdate{{
+			Operation: apiv1.RelationshipUpdate_OPERATION_TOUCH,
+			Relationship: &apiv1.Relationship{
+				Resource: res,
+				Relation: r.selfTestRelation,
+				Subject:  r.querySubject(QueryRequest{UserID: allowedUser, Tenant: tenant}),
+			},
+		}},
+	})
+	if err != nil {
+		return fail(SelfTestWrite, err)
+	}
+
+	defer func() {
+		// Clean up even if ctx was cancelled during a stage.
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), selfTestCleanupTimeout)
+		defer cancel()
+		if _, _, cerr := r.purgeRelationships(cleanupCtx, []Document{doc}); cerr != nil && err == nil {
+			err = fail(SelfTestCleanup, cerr)
+		}
+	}()
+
+	corpus := []Document{doc}
+	var stats Stats
+	if candidates := r.retrieve(corpus, id, &stats, nil); len(candidates) != 1 || candidates[0].ID != id {
+		return fail(SelfTestRetrieval, fmt.Errorf("synthetic document %q was not retrieved", id))
+	}
+
+	// Read our own write: the default minimize-latency consistency may
+	// evaluate at a revision that predates it.
+	probeCtx := context.WithValue(ctx, selfTestKey{}, corpus)
+	returned := func(user string) (bool, error) {
+		resp, err := r.do(probeCtx, QueryRequest{
+			UserID:      user,
+			Tenant:      tenant,
+			Query:       id,
+			Consistency: AtLeastAsFresh(written.GetWrittenAt()),
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, res := range resp.Results {
+			if res.Document.ID == id && res.Decision == DecisionAllowed {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	ok, err := returned(allowedUser)
+	if err != nil {
+		return fail(SelfTestCheck, err)
+	}
+	if !ok {
+		return fail(SelfTestCheck, errors.New("permitted subject was denied the synthetic document"))
+	}
+
+	ok, err = returned(deniedUser)
+	if err != nil {
+		return fail(SelfTestCheck, err)
+	}
+	if ok {
+		return fail(SelfTestCheck, errors.New("unrelated subject was granted the synthetic document"))
+	}
+
+	return nil
+}
+
+type selfTestKey struct{}
+
+// selfTestCorpus returns the corpus the query of ctx runs against if
+// SelfTest runs it.
+func selfTestCorpus(ctx context.Context) ([]Document, bool) {
+	docs, ok := ctx.Value(selfTestKey{}).([]Document)
+	return docs, ok
+}
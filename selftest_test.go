@@ -0,0 +1,184 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient("document:doc3#read@user:charlie")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+
+	require.NoError(t, pipeline.SelfTest(ctx))
+
+	// No residue: the corpus and the relationships are as before.
+	require.Equal(t, []string{"document:doc3#read@user:charlie"}, fake.tuples())
+	var stats rag.Stats
+	_, err := pipeline.Query(ctx, "charlie", "", rag.WithStats(&stats))
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.DocsScanned)
+}
+
+func TestSelfTestStages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("schema", func(t *testing.T) {
+		t.Parallel()
+
+		client, _ := newFakeClient()
+		pipeline := rag.NewRAGPipeline(client, "wiki_page", "read", nil)
+
+		var stErr *rag.SelfTestError
+		require.ErrorAs(t, pipeline.SelfTest(ctx), &stErr)
+		require.Equal(t, rag.SelfTestSchema, stErr.Stage)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		t.Parallel()
+
+		client, fake := newFakeClient()
+		fake.failWrite = errors.New("datastore is read-only")
+		pipeline := rag.NewRAGPipeline(client, "document", "read", nil)
+
+		err := pipeline.SelfTest(ctx)
+		var stErr *rag.SelfTestError
+		require.ErrorAs(t, err, &stErr)
+		require.Equal(t, rag.SelfTestWrite, stErr.Stage)
+		require.ErrorIs(t, err, fake.failWrite)
+	})
+
+	t.Run("check", func(t *testing.T) {
+		t.Parallel()
+
+		// A relation that does not confer the permission.
+		client, fake := newFakeClient()
+		pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithSelfTestRelation("commenter"))
+
+		var stErr *rag.SelfTestError
+		require.ErrorAs(t, pipeline.SelfTest(ctx), &stErr)
+		require.Equal(t, rag.SelfTestCheck, stErr.Stage)
+		require.Empty(t, fake.tuples(), "cleanup runs after a failed stage")
+	})
+}
+
+func TestSelfTestTenancy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", tenantDocs(), rag.WithTenancy())
+	require.NoError(t, pipeline.SelfTest(ctx))
+	require.Empty(t, fake.tuples())
+
+	client, fake = newFakeClient()
+	fake.schema = "definition acme/user {}\n\ndefinition acme/document {\n  relation viewer: acme/user\n  permission read = viewer\n}\n"
+	pipeline = rag.NewRAGPipeline(client, "document", "read", tenantDocs(), rag.WithTenantPrefixes())
+
+	var stErr *rag.SelfTestError
+	require.ErrorAs(t, pipeline.SelfTest(ctx), &stErr, "the default tenant has no schema")
+	require.Equal(t, rag.SelfTestSchema, stErr.Stage)
+
+	pipeline = rag.NewRAGPipeline(client, "document", "read", tenantDocs(), rag.WithTenantPrefixes(), rag.WithSelfTestTenant("acme"))
+	require.NoError(t, pipeline.SelfTest(ctx))
+	require.Empty(t, fake.tuples())
+}
+
+func TestSelfTestBypassesRetriever(t *testing.T) {
+	t.Parallel()
+
+	// The BM25 index knows nothing of the synthetic document.
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithRetriever(rag.NewBM25Retriever(scenarioDocs())))
+
+	require.NoError(t, pipeline.SelfTest(context.Background()))
+	require.Empty(t, fake.tuples())
+}
+
+// cancellingChecker cancels the self test's context while checking, as a
+// caller giving up halfway would.
+type cancellingChecker struct{ cancel context.CancelFunc }
+
+func (c cancellingChecker) Check(ctx context.Context, _ *apiv1.SubjectReference, _ *apiv1.ObjectReference, _ string) (rag.Decision, error) {
+	c.cancel()
+	return rag.DecisionDenied, ctx.Err()
+}
+
+func TestSelfTestCleansUpAfterCancellation(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithPermissionChecker(cancellingChecker{cancel}))
+
+	var stErr *rag.SelfTestError
+	require.ErrorAs(t, pipeline.SelfTest(ctx), &stErr)
+	require.Equal(t, rag.SelfTestCheck, stErr.Stage)
+	require.ErrorIs(t, stErr, context.Canceled)
+	require.Empty(t, fake.tuples(), "cleanup outlives the cancelled context")
+}
+
+// peekingChecker queries the pipeline while the self test checks, as a
+// concurrent user would.
+type peekingChecker struct {
+	rag.PermissionChecker
+	peek func()
+}
+
+func (c peekingChecker) Check(ctx context.Context, subject *apiv1.SubjectReference, resource *apiv1.ObjectReference, permission string) (rag.Decision, error) {
+	c.peek()
+	return c.PermissionChecker.Check(ctx, subject, resource, permission)
+}
+
+func TestSelfTestIsInvisibleToQueries(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	var pipeline *rag.RAGPipeline
+	var peeked []rag.Stats
+	peek := func() {
+		var stats rag.Stats
+		results, err := pipeline.Query(ctx, "charlie", "synthetic self test", rag.WithStats(&stats))
+		require.NoError(t, err)
+		require.Empty(t, results)
+		peeked = append(peeked, stats)
+	}
+	pipeline = rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithPermissionChecker(peekingChecker{rag.NewSpiceDBChecker(client), peek}))
+
+	require.NoError(t, pipeline.SelfTest(ctx))
+	require.Len(t, peeked, 2)
+	for _, stats := range peeked {
+		require.Equal(t, 3, stats.DocsScanned)
+		require.Zero(t, stats.Candidates)
+	}
+}
+
+func TestSelfTestUsesFilterStrategy(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithFilterStrategy(rag.FilterPrefilter))
+	require.NoError(t, pipeline.SelfTest(context.Background()))
+	require.Zero(t, fake.checkCount(), "the prefilter strategy looks the document up")
+
+	pipeline = rag.NewRAGPipeline(client, "document", "read", nil, rag.WithFilterStrategy(rag.FilterPrefilter),
+		rag.WithPermissionChecker(singleChecker{rag.NewSpiceDBChecker(client)}))
+	var stErr *rag.SelfTestError
+	require.ErrorAs(t, pipeline.SelfTest(context.Background()), &stErr)
+	require.Equal(t, rag.SelfTestCheck, stErr.Stage)
+	require.ErrorIs(t, stErr, rag.ErrPrefilterUnsupported)
+	require.Empty(t, fake.tuples())
+}
@@ -0,0 +1,66 @@
+package rag
+
+import (
+	"context"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// WithShadowMode authorizes queries as usual but withholds nothing, so a
+// team moving an existing RAG system onto SpiceDB can measure what
+// enforcement would change before turning it on. Documents the subject
+// may not read are returned with their Decision, DecisionDenied or
+// DecisionConditional, and counted in Stats.Shadowed; the Auditor
+// receives them with AuditEvent.Shadow set, which logs exactly the
+// difference between the enforced and the unenforced results.
+//
+// Failed checks still follow the FailurePolicy, and QueryExplain reports
+// what enforcement would do. Answer and AnswerStream enforce regardless:
+// a generated answer cannot mark which of its sources were shadowed, so
+// only documents the subject may read reach the prompt. The servers in
+// ragserver, ragrpc and ragmcp enforce too, as their results carry no
+// Decision.
+func WithShadowMode() Option {
+	return func(r *RAGPipeline) {
+		r.shadow = true
+	}
+}
+
+// shadows reports whether the query of ctx returns the documents it
+// would withhold.
+func (r *RAGPipeline) shadows(ctx context.Context) bool {
+	return r.shadow && explainerFromContext(ctx) == nil && !simulating(ctx)
+}
+
+// admitShadowed adds d, which decision would withhold, to resp under
+// WithShadowMode, auditing it and counting it by decision.
+func (r *RAGPipeline) admitShadowed(ctx context.Context, resp *QueryResponse, subject *apiv1.SubjectReference, query string, d ScoredDocument, resource *apiv1.ObjectReference, decision Decision) error {
+	if err := r.audit(ctx, subject, d.Document, resource, decision); err != nil {
+		return err
+	}
+	resp.add(d, decision, query, r.snippets)
+	stats := &resp.Stats
+	if decision == DecisionConditional {
+		stats.Conditional++
+	} else {
+		stats.Denied++
+	}
+	stats.Shadowed++
+	return nil
+}
+
+// withholdShadowed drops the results WithShadowMode returned although
+// enforcement would withhold them, for callers that must never pass them
+// on, such as Answer building its prompt.
+func (resp *QueryResponse) withholdShadowed() {
+	results, docs := resp.Results[:0], resp.Documents[:0]
+	for _, res := range resp.Results {
+		if res.Decision == DecisionAllowed {
+			results = append(results, res)
+			docs = append(docs, res.Document)
+		}
+	}
+	clear(resp.Results[len(results):])
+	clear(resp.Documents[len(docs):])
+	resp.Results, resp.Documents = results, docs
+}
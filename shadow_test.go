@@ -0,0 +1,87 @@
+package rag_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestShadowMode(t *testing.T) {
+	t.Parallel()
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		audit := &auditRecorder{}
+		metrics := rag.NewCollector("")
+		client, _ := newFakeClient("document:doc1#read@user:emilia")
+		pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+			rag.WithShadowMode(), rag.WithAuditor(audit), rag.WithMetrics(metrics), rag.WithFilterStrategy(strategy))
+
+		resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: "o"})
+		require.NoError(t, err, strategy)
+		stats := resp.Stats
+		requireEqualDocIDs(t, []string{"doc1", "doc2", "doc3"}, resp.Documents)
+		var decisions []rag.Decision
+		for _, res := range resp.Results {
+			decisions = append(decisions, res.Decision)
+		}
+		require.Equal(t, []rag.Decision{rag.DecisionAllowed, rag.DecisionDenied, rag.DecisionDenied}, decisions, strategy)
+		require.Equal(t, 2, stats.Denied, strategy)
+		require.Equal(t, 2, stats.Shadowed, strategy)
+
+		require.Len(t, audit.events, 2)
+		for _, e := range audit.events {
+			require.True(t, e.Shadow)
+		}
+		require.Contains(t, strings.Split(scrape(t, metrics), "\n"), "rag_shadowed_documents_total 2")
+
+		// Explain still shows what enforcement would do.
+		explanation, err := pipeline.QueryExplain(context.Background(), "emilia", "o")
+		require.NoError(t, err)
+		returned := 0
+		for _, e := range explanation.Explanations {
+			if e.Outcome == rag.OutcomeReturned {
+				returned++
+			}
+		}
+		require.Equal(t, 1, returned, strategy)
+		require.Zero(t, explanation.Stats.Shadowed, strategy)
+	}
+}
+
+func TestShadowModeNeverPromptsWithheldDocuments(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	gen := &recordingGenerator{answer: "ok"}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithShadowMode(), rag.WithGenerator(gen))
+
+	resp, err := pipeline.Answer(ctx, "emilia", "o")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, resp.Sources)
+	require.Equal(t, 2, resp.Stats.Shadowed)
+
+	stream, err := pipeline.AnswerStream(ctx, "emilia", "o")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, stream.Sources)
+	_, err = collect(t, stream.Tokens)
+	require.NoError(t, err)
+
+	require.Len(t, gen.prompts, 2)
+	for _, prompt := range gen.prompts {
+		require.Contains(t, prompt, "(doc1)")
+		require.NotContains(t, prompt, "(doc2)")
+		require.NotContains(t, prompt, "(doc3)")
+	}
+
+	_, err = pipeline.Answer(ctx, "nobody", "o")
+	require.ErrorIs(t, err, rag.ErrNoSources)
+	_, err = pipeline.AnswerStream(ctx, "nobody", "o")
+	require.ErrorIs(t, err, rag.ErrNoSources)
+	require.Len(t, gen.prompts, 2)
+}
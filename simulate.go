@@ -0,0 +1,65 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// ErrSimulationUnsupported is returned by Simulate when the pipeline's
+// PermissionChecker does not implement Simulator.
+var ErrSimulationUnsupported = errors.New("rag: permission checker cannot simulate relationships")
+
+// Simulator is implemented by PermissionCheckers that can decide as if
+// relationships existed that were never written. ragtest.MemoryChecker
+// implements it, and CachingChecker and RetryingChecker do when the
+// checker they wrap does.
+//
+// SpiceDBChecker does not: SpiceDB evaluates permissions against stored
+// relationships only. To simulate against a SpiceDB schema, load it and
+// the relevant relationships into a spicedbtest instance instead.
+type Simulator interface {
+	// Simulate returns a checker deciding as this one would if
+	// relationships had been written. Neither the checker nor the data it
+	// decides on may change.
+	Simulate(ctx context.Context, relationships []*apiv1.Relationship) (PermissionChecker, error)
+}
+
+type simulationKey struct{}
+
+// Simulate answers "what would userID see?": it runs query as Query does,
+// but decides with a checker that sees relationships as if they had been
+// written, and writes nothing. It serves access reviews, e.g. checking
+// what a share would expose before making it, and debugging schema
+// changes.
+//
+// Simulated queries bypass WithCheckCache and WithAccessSets, are not
+// audited and withhold documents under WithShadowMode. It returns
+// ErrSimulationUnsupported unless the pipeline's checker is a Simulator.
+func (r *RAGPipeline) Simulate(ctx context.Context, userID string, relationships []*apiv1.Relationship, query string, opts ...QueryOption) ([]Document, error) {
+	sim, ok := r.checker.(Simulator)
+	if !ok {
+		return nil, ErrSimulationUnsupported
+	}
+	checker, err := sim.Simulate(ctx, relationships)
+	if err != nil {
+		return nil, fmt.Errorf("rag: simulating relationships: %w", err)
+	}
+	return r.Query(context.WithValue(ctx, simulationKey{}, checker), userID, query, opts...)
+}
+
+// checkerFor returns the checker deciding the query of ctx: the simulated
+// one under Simulate, the pipeline's otherwise.
+func (r *RAGPipeline) checkerFor(ctx context.Context) PermissionChecker {
+	if c, ok := ctx.Value(simulationKey{}).(PermissionChecker); ok {
+		return c
+	}
+	return r.checker
+}
+
+// simulating reports whether ctx is a query run by Simulate.
+func simulating(ctx context.Context) bool {
+	return ctx.Value(simulationKey{}) != nil
+}
@@ -0,0 +1,61 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/ragtest"
+)
+
+// share is a relationship granting subject read on document docID.
+func share(docID, subjectType, subjectID string) *apiv1.Relationship {
+	return &apiv1.Relationship{
+		Resource: &apiv1.ObjectReference{ObjectType: "document", ObjectId: docID},
+		Relation: "read",
+		Subject:  &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: subjectType, ObjectId: subjectID}},
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		audit := &auditRecorder{}
+		pipeline, checker := ragtest.NewPipeline(t, "document", "read", scenarioDocs(), []string{"document:doc1#read@user:emilia"},
+			rag.WithFilterStrategy(strategy), rag.WithCheckCache(time.Minute, 100), rag.WithRetry(rag.RetryPolicy{}),
+			rag.WithAccessSets(rag.AccessSets{}), rag.WithAuditor(audit), rag.WithShadowMode())
+
+		// Warm the caches so a simulation answered from them would show.
+		results, err := pipeline.Query(ctx, "emilia", "o")
+		require.NoError(t, err)
+		require.Len(t, results, 3, "shadow mode withholds nothing")
+		audited := len(audit.events)
+
+		results, err = pipeline.Simulate(ctx, "emilia", []*apiv1.Relationship{share("doc3", "user", "emilia")}, "o")
+		require.NoError(t, err, strategy)
+		requireEqualDocIDs(t, []string{"doc1", "doc3"}, results)
+		require.Len(t, audit.events, audited, "simulated queries are not audited")
+
+		// Nothing was written.
+		denied, err := checker.Check(ctx, &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}},
+			&apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc3"}, "read")
+		require.NoError(t, err)
+		require.Equal(t, rag.DecisionDenied, denied)
+	}
+}
+
+func TestSimulateUnsupported(t *testing.T) {
+	t.Parallel()
+
+	client, fake := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs())
+	_, err := pipeline.Simulate(context.Background(), "emilia", []*apiv1.Relationship{share("doc2", "user", "emilia")}, "o")
+	require.ErrorIs(t, err, rag.ErrSimulationUnsupported)
+	require.Zero(t, fake.checkCount())
+}
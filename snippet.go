@@ -0,0 +1,165 @@
+package rag
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Snippet is a passage of a result's text around the query's matches,
+// for showing context without the whole document.
+type Snippet struct {
+	// Span is the passage's byte range in Document.Text. A Start above 0
+	// or an End below len(Document.Text) means text was left out there.
+	Span Span
+
+	// Text is Document.Text[Span.Start:Span.End].
+	Text string
+
+	// Highlights are the matches within the passage, as byte ranges of
+	// Text.
+	Highlights []Span
+}
+
+// Highlight returns Text with every highlight wrapped in open and close,
+// e.g. "**" and "**". Text is not escaped; see HighlightHTML.
+func (s Snippet) Highlight(open, close string) string {
+	return s.highlight(open, close, func(t string) string { return t })
+}
+
+// HighlightHTML returns Text escaped for HTML, with every highlight
+// wrapped in <mark> elements.
+func (s Snippet) HighlightHTML() string {
+	return s.highlight("<mark>", "</mark>", html.EscapeString)
+}
+
+func (s Snippet) highlight(open, close string, escape func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, h := range s.Highlights {
+		b.WriteString(escape(s.Text[last:h.Start]))
+		b.WriteString(open)
+		b.WriteString(escape(s.Text[h.Start:h.End]))
+		b.WriteString(close)
+		last = h.End
+	}
+	b.WriteString(escape(s.Text[last:]))
+	return b.String()
+}
+
+// WithSnippets makes every result carry up to max Snippets of about size
+// runes around its matches (see QueryResult.Snippets). Matches close
+// together share a snippet. Results without matches, such as semantic
+// ones, get the start of their text. Snippets end at word boundaries
+// where one is near.
+func WithSnippets(size, max int) Option {
+	return func(r *RAGPipeline) {
+		r.snippets = snippetConfig{size: size, max: max}
+	}
+}
+
+type snippetConfig struct {
+	size, max int
+}
+
+// snippets cuts the snippets of text around matches.
+func (c snippetConfig) snippets(text string, matches []Span) []Snippet {
+	if c.size <= 0 || c.max <= 0 || text == "" {
+		return nil
+	}
+	if len(matches) == 0 {
+		end := wordEnd(text, forwardRunes(text, 0, c.size))
+		return []Snippet{newSnippet(text, Span{Start: 0, End: end}, nil)}
+	}
+
+	var out []Snippet
+	for i := 0; i < len(matches) && len(out) < c.max; {
+		m := matches[i]
+		// Center the window on the match.
+		pad := max(c.size-utf8.RuneCountInString(text[m.Start:m.End]), 0) / 2
+		start := wordStart(text, backRunes(text, m.Start, pad), m.Start)
+		end := wordEnd(text, forwardRunes(text, m.End, pad))
+		end = max(end, m.End)
+
+		var highlights []Span
+		for ; i < len(matches) && matches[i].Start < end; i++ {
+			end = max(end, matches[i].End)
+			highlights = append(highlights, matches[i])
+		}
+		out = append(out, newSnippet(text, Span{Start: start, End: end}, highlights))
+	}
+	return out
+}
+
+// newSnippet returns the snippet of text in span, without surrounding
+// white space, with highlights made relative to it.
+func newSnippet(text string, span Span, highlights []Span) Snippet {
+	for span.Start < span.End {
+		r, size := utf8.DecodeRuneInString(text[span.Start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		span.Start += size
+	}
+	for span.End > span.Start {
+		r, size := utf8.DecodeLastRuneInString(text[:span.End])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		span.End -= size
+	}
+	s := Snippet{Span: span, Text: text[span.Start:span.End]}
+	for _, h := range highlights {
+		s.Highlights = append(s.Highlights, Span{Start: h.Start - span.Start, End: h.End - span.Start})
+	}
+	return s
+}
+
+// backRunes returns the offset n runes before i in text, or 0.
+func backRunes(text string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(text[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes returns the offset n runes after i in text, or len(text).
+func forwardRunes(text string, i, n int) int {
+	for ; n > 0 && i < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return i
+}
+
+// wordStart moves start forward past a partial word, as long as it stays
+// before limit.
+func wordStart(text string, start, limit int) int {
+	if start == 0 {
+		return 0
+	}
+	if r, _ := utf8.DecodeLastRuneInString(text[:start]); unicode.IsSpace(r) {
+		return start
+	}
+	if i := strings.IndexFunc(text[start:limit], unicode.IsSpace); i >= 0 {
+		return start + i
+	}
+	return start
+}
+
+// wordEnd moves end back before a partial word, unless that leaves
+// nothing.
+func wordEnd(text string, end int) int {
+	if end == len(text) {
+		return end
+	}
+	if r, _ := utf8.DecodeRuneInString(text[end:]); unicode.IsSpace(r) {
+		return end
+	}
+	if i := strings.LastIndexFunc(text[:end], unicode.IsSpace); i > 0 {
+		return i
+	}
+	return end
+}
@@ -0,0 +1,79 @@
+package rag_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func snippetsFor(t *testing.T, text, query string, opts ...rag.Option) []rag.Snippet {
+	t.Helper()
+	docs := []rag.Document{{ID: "d", Text: text, Metadata: map[string]string{rag.SpiceDBObjectKey: "document:d"}}}
+	client, _ := newFakeClient("document:d#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, opts...)
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "emilia", Query: query})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	return resp.Results[0].Snippets
+}
+
+func TestSnippetsAroundMatches(t *testing.T) {
+	t.Parallel()
+
+	text := "The quarterly roadmap covers hiring. " + strings.Repeat("Filler words go here. ", 10) + "A second ROADMAP review closes the year."
+	snippets := snippetsFor(t, text, "roadmap", rag.WithSnippets(30, 3))
+	require.Len(t, snippets, 2)
+
+	for _, s := range snippets {
+		require.Equal(t, text[s.Span.Start:s.Span.End], s.Text)
+		require.Len(t, s.Highlights, 1)
+		h := s.Highlights[0]
+		require.True(t, strings.EqualFold("roadmap", s.Text[h.Start:h.End]), s.Text)
+		require.LessOrEqual(t, len([]rune(s.Text)), 30)
+		require.NotEqual(t, ' ', s.Text[0])
+	}
+	require.Equal(t, "quarterly roadmap covers", snippets[0].Text)
+	require.Equal(t, "A second ROADMAP review", snippets[1].Text)
+	require.Equal(t, "A second **ROADMAP** review", snippets[1].Highlight("**", "**"))
+}
+
+func TestSnippetsMergeNearbyMatchesAndCap(t *testing.T) {
+	t.Parallel()
+
+	text := "spicedb and spicedb. " + strings.Repeat("x ", 50) + "spicedb " + strings.Repeat("y ", 50) + "spicedb"
+	snippets := snippetsFor(t, text, "spicedb", rag.WithSnippets(40, 2))
+	require.Len(t, snippets, 2, "capped at max")
+	require.Len(t, snippets[0].Highlights, 2, "nearby matches share a snippet")
+}
+
+func TestSnippetsUseByteOffsets(t *testing.T) {
+	t.Parallel()
+
+	text := "Ünïcode résumé: the ROADMAP for Zürich"
+	snippets := snippetsFor(t, text, "roadmap", rag.WithSnippets(12, 1))
+	require.Len(t, snippets, 1)
+	s := snippets[0]
+	require.Equal(t, text[s.Span.Start:s.Span.End], s.Text)
+	require.Equal(t, "ROADMAP", s.Text[s.Highlights[0].Start:s.Highlights[0].End])
+}
+
+func TestSnippetsWithoutMatches(t *testing.T) {
+	t.Parallel()
+
+	// The empty query matches everything but highlights nothing.
+	snippets := snippetsFor(t, "A short note about the launch plan.", "", rag.WithSnippets(15, 3))
+	require.Equal(t, []rag.Snippet{{Span: rag.Span{Start: 0, End: 12}, Text: "A short note"}}, snippets)
+
+	require.Nil(t, snippetsFor(t, "roadmap", "roadmap"), "off by default")
+}
+
+func TestSnippetHighlightHTML(t *testing.T) {
+	t.Parallel()
+
+	s := rag.Snippet{Text: "<b>roadmap</b> & more", Highlights: []rag.Span{{Start: 3, End: 10}}}
+	require.Equal(t, "&lt;b&gt;<mark>roadmap</mark>&lt;/b&gt; &amp; more", s.HighlightHTML())
+}
@@ -0,0 +1,202 @@
+package spicedbtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidRelationship is returned for a fixture relationship line that
+// cannot be parsed.
+var ErrInvalidRelationship = errors.New("spicedbtest: invalid relationship")
+
+// writeBatchSize is the number of relationships written per request, well
+// under SpiceDB's default limit of 1000 updates.
+const writeBatchSize = 500
+
+// Fixture is a schema plus seed relationships, in the format of zed's
+// validation files:
+//
+//	schema: |-
+//	  definition user {}
+//	  definition document {
+//	    relation viewer: user
+//	    permission read = viewer
+//	  }
+//	relationships: |-
+//	  document:doc1#viewer@user:emilia
+//	  document:doc2#viewer@group:eng#member[on_vpn]
+//
+// The schema may instead be referenced with schemaFile, relative to the
+// fixture file. Other keys zed understands, such as assertions and
+// validation, are accepted and ignored.
+type Fixture struct {
+	Schema        string
+	Relationships []*apiv1.Relationship
+}
+
+type fixtureFile struct {
+	Schema        string `yaml:"schema"`
+	SchemaFile    string `yaml:"schemaFile"`
+	Relationships string `yaml:"relationships"`
+}
+
+// LoadFixture parses a fixture. dir resolves a schemaFile reference; it
+// may be empty when the fixture has an inline schema.
+func LoadFixture(r io.Reader, dir string) (*Fixture, error) {
+	var raw fixtureFile
+	if err := yaml.NewDecoder(r).Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("spicedbtest: decoding fixture: %w", err)
+	}
+
+	f := &Fixture{Schema: raw.Schema}
+	if raw.SchemaFile != "" {
+		if raw.Schema != "" {
+			return nil, errors.New("spicedbtest: fixture sets both schema and schemaFile")
+		}
+		b, err := os.ReadFile(filepath.Join(dir, raw.SchemaFile))
+		if err != nil {
+			return nil, fmt.Errorf("spicedbtest: reading schema file: %w", err)
+		}
+		f.Schema = string(b)
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(raw.Relationships))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		rel, err := ParseRelationship(line)
+		if err != nil {
+			return nil, fmt.Errorf("relationships line %d: %w", n, err)
+		}
+		f.Relationships = append(f.Relationships, rel)
+	}
+	return f, nil
+}
+
+// LoadFixtureFile reads and parses the fixture at path.
+func LoadFixtureFile(path string) (*Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("spicedbtest: %w", err)
+	}
+	defer file.Close()
+	return LoadFixture(file, filepath.Dir(path))
+}
+
+// Apply writes the fixture's schema, if any, and touches its
+// relationships, so applying a fixture twice is harmless.
+func (f *Fixture) Apply(ctx context.Context, client *authzed.Client) error {
+	if f.Schema != "" {
+		if _, err := client.WriteSchema(ctx, &apiv1.WriteSchemaRequest{Schema: f.Schema}); err != nil {
+			return fmt.Errorf("spicedbtest: writing schema: %w", err)
+		}
+	}
+
+	for start := 0; start < len(f.Relationships); start += writeBatchSize {
+		batch := f.Relationships[start:min(start+writeBatchSize, len(f.Relationships))]
+		updates := make([]*apiv1.RelationshipUpdate, len(batch))
+		for i, rel := range batch {
+			updates[i] = &apiv1.RelationshipUpdate{
+				Operation:    apiv1.RelationshipUpdate_OPERATION_TOUCH,
+				Relationship: rel,
+			}
+		}
+		if _, err := client.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{Updates: updates}); err != nil {
+			return fmt.Errorf("spicedbtest: writing relationships: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithFixtureFile applies the fixture at path before Run returns. It can
+// be combined with WithSchema when the fixture only holds relationships.
+func WithFixtureFile(path string) Option {
+	return func(c *config) {
+		c.fixtures = append(c.fixtures, path)
+	}
+}
+
+// ParseRelationship parses a relationship in zed's text form:
+//
+//	resource_type:resource_id#relation@subject_type:subject_id[#subject_relation][[caveat_name[:{context}]]]
+func ParseRelationship(s string) (*apiv1.Relationship, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidRelationship, s, reason)
+	}
+
+	rest := s
+	var caveat *apiv1.ContextualizedCaveat
+	if strings.HasSuffix(rest, "]") {
+		open := strings.Index(rest, "[")
+		if open < 0 {
+			return nil, invalid("unbalanced caveat brackets")
+		}
+		name, ctxJSON, hasContext := strings.Cut(rest[open+1:len(rest)-1], ":")
+		caveat = &apiv1.ContextualizedCaveat{CaveatName: name}
+		if hasContext {
+			var values map[string]any
+			if err := json.Unmarshal([]byte(ctxJSON), &values); err != nil {
+				return nil, invalid("caveat context: " + err.Error())
+			}
+			ctx, err := structpb.NewStruct(values)
+			if err != nil {
+				return nil, invalid("caveat context: " + err.Error())
+			}
+			caveat.Context = ctx
+		}
+		if name == "" {
+			return nil, invalid("empty caveat name")
+		}
+		rest = rest[:open]
+	}
+
+	resource, subject, ok := strings.Cut(rest, "@")
+	if !ok {
+		return nil, invalid("missing @")
+	}
+	object, relation, ok := strings.Cut(resource, "#")
+	if !ok || relation == "" {
+		return nil, invalid("missing relation")
+	}
+	res, err := parseObject(object)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+	subjObject, subjRelation, _ := strings.Cut(subject, "#")
+	subj, err := parseObject(subjObject)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	return &apiv1.Relationship{
+		Resource: res,
+		Relation: relation,
+		Subject: &apiv1.SubjectReference{
+			Object:           subj,
+			OptionalRelation: subjRelation,
+		},
+		OptionalCaveat: caveat,
+	}, nil
+}
+
+func parseObject(s string) (*apiv1.ObjectReference, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || typ == "" || id == "" {
+		return nil, fmt.Errorf("object %q is not type:id", s)
+	}
+	return &apiv1.ObjectReference{ObjectType: typ, ObjectId: id}, nil
+}
@@ -0,0 +1,104 @@
+package spicedbtest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/spicedbtest"
+)
+
+func TestParseRelationship(t *testing.T) {
+	t.Parallel()
+
+	caveatCtx, err := structpb.NewStruct(map[string]any{"cidr": "10.0.0.0/8"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		in   string
+		want *apiv1.Relationship
+	}{
+		{
+			in: "document:doc1#viewer@user:emilia",
+			want: &apiv1.Relationship{
+				Resource: &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"},
+				Relation: "viewer",
+				Subject:  &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}},
+			},
+		},
+		{
+			in: "document:doc1#viewer@group:eng#member",
+			want: &apiv1.Relationship{
+				Resource: &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"},
+				Relation: "viewer",
+				Subject: &apiv1.SubjectReference{
+					Object:           &apiv1.ObjectReference{ObjectType: "group", ObjectId: "eng"},
+					OptionalRelation: "member",
+				},
+			},
+		},
+		{
+			in: `document:doc1#viewer@user:*[on_network:{"cidr":"10.0.0.0/8"}]`,
+			want: &apiv1.Relationship{
+				Resource:       &apiv1.ObjectReference{ObjectType: "document", ObjectId: "doc1"},
+				Relation:       "viewer",
+				Subject:        &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "*"}},
+				OptionalCaveat: &apiv1.ContextualizedCaveat{CaveatName: "on_network", Context: caveatCtx},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := spicedbtest.ParseRelationship(tt.in)
+		require.NoError(t, err, tt.in)
+		require.True(t, proto.Equal(tt.want, got), "%s: got %v", tt.in, got)
+	}
+
+	for _, bad := range []string{
+		"document:doc1#viewer",
+		"document:doc1@user:emilia",
+		"doc1#viewer@user:emilia",
+		"document:doc1#viewer@user",
+		"document:doc1#viewer@user:emilia[]",
+		"document:doc1#viewer@user:emilia[c:{bad json}]",
+		"document:doc1#viewer@user:emilia]",
+	} {
+		_, err := spicedbtest.ParseRelationship(bad)
+		require.ErrorIs(t, err, spicedbtest.ErrInvalidRelationship, bad)
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	t.Parallel()
+
+	f, err := spicedbtest.LoadFixtureFile("../testdata/scenario.yaml")
+	require.NoError(t, err)
+	require.Contains(t, f.Schema, "definition document")
+	require.Len(t, f.Relationships, 3)
+	require.Equal(t, "emilia", f.Relationships[0].GetSubject().GetObject().GetObjectId())
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schema.zed"), []byte("definition user {}"), 0o600))
+	f, err = spicedbtest.LoadFixture(strings.NewReader(`
+schemaFile: schema.zed
+relationships: |-
+  // comments and blank lines are skipped
+
+  document:doc1#viewer@user:emilia
+assertions:
+  assertTrue:
+    - document:doc1#view@user:emilia
+`), dir)
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}", f.Schema)
+	require.Len(t, f.Relationships, 1)
+
+	_, err = spicedbtest.LoadFixture(strings.NewReader("relationships: |-\n  document:doc1#viewer@user:emilia\n  nonsense\n"), "")
+	require.ErrorIs(t, err, spicedbtest.ErrInvalidRelationship)
+	require.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,56 @@
+package spicedbtest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// emptySchemaServer answers ReadSchema like SpiceDB without a schema.
+type emptySchemaServer struct {
+	apiv1.UnimplementedSchemaServiceServer
+}
+
+func (emptySchemaServer) ReadSchema(context.Context, *apiv1.ReadSchemaRequest) (*apiv1.ReadSchemaResponse, error) {
+	return nil, status.Error(codes.NotFound, "no schema has been defined")
+}
+
+func TestWaitReadyWaitsForHealth(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	service := apiv1.PermissionsService_ServiceDesc.ServiceName
+	hs.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	apiv1.RegisterSchemaServiceServer(srv, emptySchemaServer{})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	client, err := authzed.NewClient(lis.Addr().String(), dialOpts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	err = waitReady(context.Background(), lis.Addr().String(), dialOpts, client, 200*time.Millisecond)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "NOT_SERVING")
+
+	time.AfterFunc(100*time.Millisecond, func() {
+		hs.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	})
+	require.NoError(t, waitReady(context.Background(), lis.Addr().String(), dialOpts, client, 5*time.Second))
+}
@@ -0,0 +1,127 @@
+package spicedbtest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Harness shares one SpiceDB instance between many tests. Each test gets
+// its own Namespace: its fixture is rewritten so every definition and
+// caveat carries a prefix unique to the test ("ns1/document"), and the
+// instance's schema is the union of all namespaces' schemas. Tests thus
+// cannot see each other's relationships, yet pay for one container.
+type Harness struct {
+	inst *Instance
+
+	mu      sync.Mutex
+	schemas []string
+	next    int
+}
+
+// Namespace is one test's share of a Harness.
+type Namespace struct {
+	// Client is connected to the shared instance.
+	Client *authzed.Client
+
+	// Prefix is prepended, with a slash, to the fixture's type and caveat
+	// names.
+	Prefix string
+}
+
+// Type returns the name of one of the fixture's definitions or caveats
+// in the namespace, e.g. "ns1/document" for "document".
+func (n *Namespace) Type(name string) string {
+	return n.Prefix + "/" + name
+}
+
+// NewHarness starts the shared instance with Run. The caller owns the
+// harness and must Terminate it, typically in TestMain.
+func NewHarness(ctx context.Context, opts ...Option) (*Harness, error) {
+	inst, err := Run(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Harness{inst: inst}, nil
+}
+
+// Terminate removes the shared instance.
+func (h *Harness) Terminate(ctx context.Context) error {
+	return h.inst.Terminate(ctx)
+}
+
+// Namespace applies f under a fresh prefix and returns the namespace. It
+// is safe for concurrent use.
+func (h *Harness) Namespace(ctx context.Context, f *Fixture) (*Namespace, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.next++
+	prefix := fmt.Sprintf("ns%d", h.next)
+	nf := f.Namespaced(prefix)
+
+	if nf.Schema != "" {
+		schemas := append(h.schemas[:len(h.schemas):len(h.schemas)], nf.Schema)
+		schema := strings.Join(schemas, "\n\n")
+		if _, err := h.inst.Client.WriteSchema(ctx, &apiv1.WriteSchemaRequest{Schema: schema}); err != nil {
+			return nil, fmt.Errorf("spicedbtest: writing schema of namespace %s: %w", prefix, err)
+		}
+		h.schemas = schemas
+	}
+	if err := (&Fixture{Relationships: nf.Relationships}).Apply(ctx, h.inst.Client); err != nil {
+		return nil, err
+	}
+	return &Namespace{Client: h.inst.Client, Prefix: prefix}, nil
+}
+
+var (
+	schemaDeclaration = regexp.MustCompile(`\b(definition|caveat)(\s+)([a-z][a-z0-9_]*)\b`)
+	schemaRelation    = regexp.MustCompile(`(\brelation\s+[a-z][a-z0-9_]*\s*:)([^\n}]*)`)
+	schemaTypeRef     = regexp.MustCompile(`(^|[\s|])([a-z][a-z0-9_]*)\b`)
+)
+
+// Namespaced returns a copy of f with prefix added to every definition
+// and caveat name, in the schema and in the relationships. Type references
+// in the schema are rewritten along with the declarations; permissions
+// refer only to relations and need no change. Schemas that already use
+// prefixes are not supported.
+func (f *Fixture) Namespaced(prefix string) *Fixture {
+	names := make(map[string]bool)
+	for _, m := range schemaDeclaration.FindAllStringSubmatch(f.Schema, -1) {
+		names[m[3]] = true
+	}
+	ns := func(name string) string {
+		if names[name] {
+			return prefix + "/" + name
+		}
+		return name
+	}
+
+	schema := schemaDeclaration.ReplaceAllString(f.Schema, "${1}${2}"+prefix+"/${3}")
+	schema = schemaRelation.ReplaceAllStringFunc(schema, func(decl string) string {
+		m := schemaRelation.FindStringSubmatch(decl)
+		types := schemaTypeRef.ReplaceAllStringFunc(m[2], func(ref string) string {
+			r := schemaTypeRef.FindStringSubmatch(ref)
+			return r[1] + ns(r[2])
+		})
+		return m[1] + types
+	})
+
+	out := &Fixture{Schema: schema, Relationships: make([]*apiv1.Relationship, len(f.Relationships))}
+	for i, rel := range f.Relationships {
+		rel = proto.Clone(rel).(*apiv1.Relationship)
+		rel.Resource.ObjectType = prefix + "/" + rel.Resource.GetObjectType()
+		rel.Subject.Object.ObjectType = prefix + "/" + rel.Subject.GetObject().GetObjectType()
+		if rel.OptionalCaveat != nil {
+			rel.OptionalCaveat.CaveatName = prefix + "/" + rel.OptionalCaveat.GetCaveatName()
+		}
+		out.Relationships[i] = rel
+	}
+	return out
+}
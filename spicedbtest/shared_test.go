@@ -0,0 +1,86 @@
+package spicedbtest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/spicedbtest"
+)
+
+const namespacedFixture = `schema: |-
+  definition user {}
+  definition group {
+    relation member: user
+  }
+  definition document {
+    relation viewer: user | user:* | group#member | user with on_vpn
+    permission read = viewer
+  }
+  caveat on_vpn(on_vpn bool) {
+    on_vpn
+  }
+relationships: |-
+  document:doc1#viewer@group:eng#member
+  document:doc2#viewer@user:emilia[on_vpn]
+`
+
+func TestFixtureNamespaced(t *testing.T) {
+	t.Parallel()
+
+	f, err := spicedbtest.LoadFixture(strings.NewReader(namespacedFixture), "")
+	require.NoError(t, err)
+
+	nf := f.Namespaced("ns7")
+	require.Equal(t, `definition ns7/user {}
+definition ns7/group {
+  relation member: ns7/user
+}
+definition ns7/document {
+  relation viewer: ns7/user | ns7/user:* | ns7/group#member | ns7/user with ns7/on_vpn
+  permission read = viewer
+}
+caveat ns7/on_vpn(on_vpn bool) {
+  on_vpn
+}`, nf.Schema)
+
+	require.Len(t, nf.Relationships, 2)
+	require.Equal(t, "ns7/document", nf.Relationships[0].GetResource().GetObjectType())
+	require.Equal(t, "ns7/group", nf.Relationships[0].GetSubject().GetObject().GetObjectType())
+	require.Equal(t, "member", nf.Relationships[0].GetSubject().GetOptionalRelation())
+	require.Equal(t, "ns7/on_vpn", nf.Relationships[1].GetOptionalCaveat().GetCaveatName())
+
+	// The original is left untouched.
+	require.Equal(t, "document", f.Relationships[0].GetResource().GetObjectType())
+	require.Contains(t, f.Schema, "definition document {")
+}
+
+func TestSharedNamespace(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	f, err := spicedbtest.LoadFixtureFile("../testdata/scenario.yaml")
+	require.NoError(t, err)
+
+	a := spicedbtest.SharedNamespace(t, f)
+	b := spicedbtest.SharedNamespace(t, f)
+	require.NotEqual(t, a.Prefix, b.Prefix)
+
+	_, err = b.Client.DeleteRelationships(ctx, &apiv1.DeleteRelationshipsRequest{
+		RelationshipFilter: &apiv1.RelationshipFilter{ResourceType: b.Type("document")},
+	})
+	require.NoError(t, err)
+
+	resp, err := a.Client.CheckPermission(ctx, &apiv1.CheckPermissionRequest{
+		Consistency: &apiv1.Consistency{Requirement: &apiv1.Consistency_FullyConsistent{FullyConsistent: true}},
+		Resource:    &apiv1.ObjectReference{ObjectType: a.Type("document"), ObjectId: "doc1"},
+		Permission:  "read",
+		Subject:     &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: a.Type("user"), ObjectId: "emilia"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION, resp.GetPermissionship(),
+		"deleting in one namespace leaves the other intact")
+}
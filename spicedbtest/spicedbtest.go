@@ -0,0 +1,232 @@
+// Package spicedbtest starts throwaway SpiceDB instances in containers via
+// Testcontainers, for tests, demos and local exploration.
+package spicedbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	spicedbcontainer "github.com/Mariscal6/testcontainers-spicedb-go"
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+	"github.com/authzed/grpcutil"
+	"github.com/testcontainers/testcontainers-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultImage is the SpiceDB image started when none is configured.
+	DefaultImage = "authzed/spicedb:v1.46.2"
+
+	// DefaultPresharedKey is the gRPC preshared key the container is
+	// started with.
+	DefaultPresharedKey = "somepresharedkey"
+
+	// DefaultStartupTimeout bounds how long Run waits for SpiceDB to
+	// answer requests once the container is up.
+	DefaultStartupTimeout = 30 * time.Second
+)
+
+// Instance is a running SpiceDB container and a client connected to it.
+type Instance struct {
+	Client   *authzed.Client
+	Endpoint string
+
+	container testcontainers.Container
+	datastore *datastore
+}
+
+// ContainerID returns the ID of the underlying container.
+func (i *Instance) ContainerID() string {
+	return i.container.GetContainerID()
+}
+
+// Close closes the client but leaves the container running.
+func (i *Instance) Close() error {
+	return i.Client.Close()
+}
+
+// Terminate closes the client and removes the container, along with the
+// datastore started by WithPostgres.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return errors.Join(i.Client.Close(), i.container.Terminate(ctx), i.datastore.terminate(ctx))
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	presharedKey   string
+	schema         string
+	fixtures       []string
+	startupTimeout time.Duration
+	postgresImage  string
+}
+
+// WithImage overrides the SpiceDB image.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithPresharedKey overrides the gRPC preshared key.
+func WithPresharedKey(key string) Option {
+	return func(c *config) {
+		c.presharedKey = key
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// WithSchema writes schema to the instance before Run returns.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// Run starts a SpiceDB container backed by the in-memory datastore, or
+// by Postgres with WithPostgres, and returns a connected client. It does
+// not depend on package testing, so it can also back demos and local
+// tooling; the caller owns the instance and must Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{
+		image:          DefaultImage,
+		presharedKey:   DefaultPresharedKey,
+		startupTimeout: DefaultStartupTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	customizers := []testcontainers.ContainerCustomizer{
+		spicedbcontainer.SecretKeyCustomizer{SecretKey: cfg.presharedKey},
+	}
+	var store *datastore
+	if cfg.postgresImage != "" {
+		var err error
+		if store, err = startPostgres(ctx, cfg); err != nil {
+			return nil, err
+		}
+		customizers = append(customizers, store.customizers()...)
+	}
+
+	container, err := spicedbcontainer.Run(ctx, cfg.image, customizers...)
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		_ = store.terminate(ctx)
+		return nil, fmt.Errorf("spicedbtest: starting container: %w", err)
+	}
+
+	endpoint := container.GetEndpoint(ctx)
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpcutil.WithInsecureBearerToken(cfg.presharedKey),
+	}
+	client, err := authzed.NewClient(endpoint, dialOpts...)
+	if err != nil {
+		_ = container.Terminate(ctx)
+		_ = store.terminate(ctx)
+		return nil, fmt.Errorf("spicedbtest: connecting to %s: %w", endpoint, err)
+	}
+
+	inst := &Instance{Client: client, Endpoint: endpoint, container: container, datastore: store}
+
+	if err := waitReady(ctx, endpoint, dialOpts, client, cfg.startupTimeout); err != nil {
+		_ = inst.Terminate(ctx)
+		return nil, fmt.Errorf("spicedbtest: waiting for %s: %w", endpoint, err)
+	}
+
+	if cfg.schema != "" {
+		if _, err := client.WriteSchema(ctx, &apiv1.WriteSchemaRequest{Schema: cfg.schema}); err != nil {
+			_ = inst.Terminate(ctx)
+			return nil, fmt.Errorf("spicedbtest: writing schema: %w", err)
+		}
+	}
+
+	for _, path := range cfg.fixtures {
+		f, err := LoadFixtureFile(path)
+		if err == nil {
+			err = f.Apply(ctx, client)
+		}
+		if err != nil {
+			_ = inst.Terminate(ctx)
+			return nil, err
+		}
+	}
+
+	return inst, nil
+}
+
+// waitReady waits until SpiceDB's gRPC health service reports the
+// permissions service as serving, which it does once its datastore and
+// dispatcher are up, and then until ReadSchema answers. NotFound, returned
+// while no schema has been written, counts as an answer. Images without
+// the health service skip the first step.
+func waitReady(ctx context.Context, endpoint string, dialOpts []grpc.DialOption, client *authzed.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := grpc.NewClient(endpoint, dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	health := healthpb.NewHealthClient(conn)
+
+	err = poll(ctx, func() error {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: apiv1.PermissionsService_ServiceDesc.ServiceName})
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			return nil
+		case err != nil:
+			return err
+		case resp.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+			return fmt.Errorf("health status %s", resp.GetStatus())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+
+	return poll(ctx, func() error {
+		_, err := client.ReadSchema(ctx, &apiv1.ReadSchemaRequest{})
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// poll calls fn with growing pauses until it succeeds or ctx is done.
+func poll(ctx context.Context, fn func() error) error {
+	backoff := 50 * time.Millisecond
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Second)
+	}
+}
@@ -0,0 +1,51 @@
+package spicedbtest_test
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/spicedbtest"
+)
+
+func TestStartSpiceDB(t *testing.T) {
+	t.Parallel()
+
+	schema := "definition user {}\n\ndefinition document {\n  relation viewer: user\n  permission read = viewer\n}"
+	client, cleanup := spicedbtest.StartSpiceDB(t, spicedbtest.WithSchema(schema))
+
+	resp, err := client.ReadSchema(context.Background(), &apiv1.ReadSchemaRequest{})
+	require.NoError(t, err)
+	require.Contains(t, resp.GetSchemaText(), "definition document")
+
+	cleanup()
+	cleanup()
+}
+
+func TestStartSpiceDBWithPostgres(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	schema := "definition user {}\n\ndefinition document {\n  relation viewer: user\n  permission read = viewer\n}"
+	client, _ := spicedbtest.StartSpiceDB(t, spicedbtest.WithPostgres(), spicedbtest.WithSchema(schema))
+
+	rel, err := spicedbtest.ParseRelationship("document:doc1#viewer@user:emilia")
+	require.NoError(t, err)
+	written, err := client.WriteRelationships(ctx, &apiv1.WriteRelationshipsRequest{
+		Updates: []*apiv1.RelationshipUpdate{{Operation: apiv1.RelationshipUpdate_OPERATION_TOUCH, Relationship: rel}},
+	})
+	require.NoError(t, err)
+
+	resp, err := client.CheckPermission(ctx, &apiv1.CheckPermissionRequest{
+		Consistency: &apiv1.Consistency{
+			Requirement: &apiv1.Consistency_AtLeastAsFresh{AtLeastAsFresh: written.GetWrittenAt()},
+		},
+		Resource:   rel.GetResource(),
+		Permission: "read",
+		Subject:    rel.GetSubject(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, apiv1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION, resp.GetPermissionship())
+}
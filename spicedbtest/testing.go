@@ -0,0 +1,72 @@
+package spicedbtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	authzed "github.com/authzed/authzed-go/v1"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// Cleanup tears down an instance started by StartSpiceDB. It is safe to
+// call more than once.
+type Cleanup func()
+
+// StartSpiceDB runs a SpiceDB instance for the duration of a test and
+// returns a client connected to it, once it answers requests. The test is
+// skipped when no container runtime is available and fails if the
+// instance cannot be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the instance earlier.
+func StartSpiceDB(t *testing.T, opts ...Option) (*authzed.Client, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("spicedbtest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.Client, cleanup
+}
+
+var shared struct {
+	once    sync.Once
+	harness *Harness
+	err     error
+}
+
+// SharedNamespace applies f in a fresh namespace of a SpiceDB instance
+// shared by all tests of the package, started on first use. It is much
+// faster than StartSpiceDB for suites with many tests, which must then
+// use the namespaced type names, see Namespace.Type. The test is skipped
+// when no container runtime is available.
+//
+// The shared instance is never terminated explicitly; Testcontainers
+// removes it when the test binary exits. Use NewHarness from TestMain to
+// control its lifetime or options.
+func SharedNamespace(t *testing.T, f *Fixture) *Namespace {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	shared.once.Do(func() {
+		shared.harness, shared.err = NewHarness(context.Background())
+	})
+	if shared.err != nil {
+		t.Fatal(shared.err)
+	}
+
+	ns, err := shared.harness.Namespace(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ns
+}
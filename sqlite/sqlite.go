@@ -0,0 +1,421 @@
+// Package sqlite is a rag.DocumentStore persisted in a single SQLite file,
+// for single-binary deployments that need the corpus and its index to
+// survive restarts without running a database server. Keyword search uses
+// an FTS5 table kept in sync by triggers; embeddings, when an Embedder is
+// configured, are stored as blobs and ranked in process.
+//
+// Like pgvector, the package works on a *sql.DB and is driver-agnostic.
+// The driver must provide FTS5 and the JSON functions: modernc.org/sqlite
+// does out of the box, github.com/mattn/go-sqlite3 needs the sqlite_fts5
+// build tag.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// DefaultTable is the table documents are stored in. The full-text index
+// is the table name followed by "_fts".
+const DefaultTable = "rag_documents"
+
+// ErrInvalidTable is returned by New for a table name that is not a plain
+// SQL identifier.
+var ErrInvalidTable = errors.New("sqlite: invalid table name")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Store is a rag.DocumentStore, rag.ScoredRetriever and
+// rag.FilteringRetriever. Without an Embedder it ranks by FTS5's BM25;
+// with one, by the cosine similarity of the embeddings, and Keyword
+// returns the full-text ranking for use in a rag.HybridRetriever.
+type Store struct {
+	db       *sql.DB
+	table    string
+	embedder rag.Embedder
+	dims     int
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithTable overrides DefaultTable.
+func WithTable(name string) Option {
+	return func(s *Store) {
+		s.table = name
+	}
+}
+
+// WithEmbedder stores an embedding of dims dimensions from e with every
+// document and ranks searches by similarity to the query's embedding.
+func WithEmbedder(e rag.Embedder, dims int) Option {
+	return func(s *Store) {
+		s.embedder, s.dims = e, dims
+	}
+}
+
+// New returns a Store on db. Call Migrate once to create the tables.
+func New(db *sql.DB, opts ...Option) (*Store, error) {
+	s := &Store{db: db, table: DefaultTable}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !identifier.MatchString(s.table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTable, s.table)
+	}
+	if s.embedder != nil && s.dims <= 0 {
+		return nil, fmt.Errorf("sqlite: invalid dimensions %d", s.dims)
+	}
+	return s, nil
+}
+
+// Migrate creates the documents table, its FTS5 index and the triggers
+// keeping the index in sync if they do not exist yet.
+func (s *Store) Migrate(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+	id TEXT PRIMARY KEY,
+	text TEXT NOT NULL,
+	metadata TEXT NOT NULL DEFAULT '{}',
+	spicedb_object TEXT NOT NULL DEFAULT '',
+	embedding BLOB
+)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_object_idx ON %[1]s (spicedb_object)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS %[1]s_fts USING fts5(text, content='%[1]s', content_rowid='rowid')`,
+		`CREATE TRIGGER IF NOT EXISTS %[1]s_ai AFTER INSERT ON %[1]s BEGIN
+	INSERT INTO %[1]s_fts (rowid, text) VALUES (new.rowid, new.text);
+END`,
+		`CREATE TRIGGER IF NOT EXISTS %[1]s_ad AFTER DELETE ON %[1]s BEGIN
+	INSERT INTO %[1]s_fts (%[1]s_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+END`,
+		`CREATE TRIGGER IF NOT EXISTS %[1]s_au AFTER UPDATE OF text ON %[1]s BEGIN
+	INSERT INTO %[1]s_fts (%[1]s_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+	INSERT INTO %[1]s_fts (rowid, text) VALUES (new.rowid, new.text);
+END`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(stmt, s.table)); err != nil {
+			return fmt.Errorf("sqlite: migrating: %w", err)
+		}
+	}
+	return nil
+}
+
+// Add implements rag.DocumentStore. Documents are embedded first, if an
+// Embedder is configured, and then upserted in one transaction, so either
+// all or none are stored.
+func (s *Store) Add(ctx context.Context, docs ...rag.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var vectors [][]float32
+	if s.embedder != nil {
+		texts := make([]string, len(docs))
+		for i, d := range docs {
+			texts[i] = d.Text
+		}
+		var err error
+		if vectors, err = s.embed(ctx, texts); err != nil {
+			return fmt.Errorf("sqlite: embedding documents: %w", err)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	upsert := fmt.Sprintf(`INSERT INTO %s (id, text, metadata, spicedb_object, embedding) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET text = excluded.text, metadata = excluded.metadata,
+	spicedb_object = excluded.spicedb_object, embedding = excluded.embedding`, s.table)
+	for i, d := range docs {
+		md := d.Metadata
+		if md == nil {
+			md = map[string]string{}
+		}
+		metadata, err := json.Marshal(md)
+		if err != nil {
+			return fmt.Errorf("sqlite: encoding metadata of %q: %w", d.ID, err)
+		}
+		var embedding any // NULL without an embedder
+		if vectors != nil {
+			embedding = vectorBlob(vectors[i])
+		}
+		if _, err := tx.ExecContext(ctx, upsert, d.ID, d.Text, string(metadata), md[rag.SpiceDBObjectKey], embedding); err != nil {
+			return fmt.Errorf("sqlite: storing %q: %w", d.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	return nil
+}
+
+// Remove implements rag.DocumentStore.
+func (s *Store) Remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	list, err := json.Marshal(ids)
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id IN (SELECT value FROM json_each(?))`, s.table)
+	if _, err := s.db.ExecContext(ctx, query, string(list)); err != nil {
+		return fmt.Errorf("sqlite: removing documents: %w", err)
+	}
+	return nil
+}
+
+// Retrieve implements rag.Retriever.
+func (s *Store) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	return documents(s.RetrieveScored(ctx, query, limit))
+}
+
+// RetrieveScored implements rag.ScoredRetriever.
+func (s *Store) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	if s.embedder == nil {
+		return s.keyword(ctx, query, limit, nil)
+	}
+	return s.nearest(ctx, query, limit, nil)
+}
+
+// RetrieveAccessible implements rag.FilteringRetriever by restricting the
+// search to rows whose SpiceDB object is in objects.
+func (s *Store) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	if s.embedder == nil {
+		return s.keyword(ctx, query, limit, objects)
+	}
+	return s.nearest(ctx, query, limit, objects)
+}
+
+// Keyword returns a retriever ranking the store's documents by full-text
+// relevance, regardless of WithEmbedder.
+func (s *Store) Keyword() *KeywordRetriever {
+	return &KeywordRetriever{s: s}
+}
+
+// KeywordRetriever is a rag.ScoredRetriever and rag.FilteringRetriever
+// over a Store's FTS5 index. Scores are BM25 scores, higher is better.
+type KeywordRetriever struct {
+	s *Store
+}
+
+// Retrieve implements rag.Retriever.
+func (k *KeywordRetriever) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	return documents(k.RetrieveScored(ctx, query, limit))
+}
+
+// RetrieveScored implements rag.ScoredRetriever.
+func (k *KeywordRetriever) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	return k.s.keyword(ctx, query, limit, nil)
+}
+
+// RetrieveAccessible implements rag.FilteringRetriever.
+func (k *KeywordRetriever) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	return k.s.keyword(ctx, query, limit, objects)
+}
+
+// keyword runs an FTS5 search matching any of query's words, restricted to
+// objects unless it is nil.
+func (s *Store) keyword(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	match := matchExpression(query)
+	if match == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = -1 // no limit in SQLite
+	}
+
+	// bm25() is lower for better matches, so it is negated into a score.
+	q := fmt.Sprintf(`SELECT d.id, d.text, d.metadata, -bm25(%[1]s_fts) FROM %[1]s_fts JOIN %[1]s d ON d.rowid = %[1]s_fts.rowid
+WHERE %[1]s_fts MATCH ?`, s.table)
+	args := []any{match}
+	if objects != nil {
+		list, err := json.Marshal(objects)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: %w", err)
+		}
+		q += ` AND d.spicedb_object IN (SELECT value FROM json_each(?))`
+		args = append(args, string(list))
+	}
+	q += fmt.Sprintf(` ORDER BY bm25(%s_fts), d.id LIMIT ?`, s.table)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying: %w", err)
+	}
+	defer rows.Close()
+
+	var out []rag.ScoredDocument
+	for rows.Next() {
+		var d rag.ScoredDocument
+		var metadata string
+		if err := rows.Scan(&d.Document.ID, &d.Document.Text, &metadata, &d.Score); err != nil {
+			return nil, fmt.Errorf("sqlite: reading row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &d.Document.Metadata); err != nil {
+			return nil, fmt.Errorf("sqlite: decoding metadata of %q: %w", d.Document.ID, err)
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: reading rows: %w", err)
+	}
+	return out, nil
+}
+
+// nearest ranks the embedded documents, restricted to objects unless it is
+// nil, by cosine similarity to query. SQLite has no vector index, so every
+// candidate row is scored; this suits the corpus sizes a single file is
+// meant for.
+func (s *Store) nearest(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: embedding query: %w", err)
+	}
+	target := vectors[0]
+
+	q := fmt.Sprintf(`SELECT id, text, metadata, embedding FROM %s WHERE embedding IS NOT NULL`, s.table)
+	var args []any
+	if objects != nil {
+		list, err := json.Marshal(objects)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: %w", err)
+		}
+		q += ` AND spicedb_object IN (SELECT value FROM json_each(?))`
+		args = append(args, string(list))
+	}
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying: %w", err)
+	}
+	defer rows.Close()
+
+	var out []rag.ScoredDocument
+	for rows.Next() {
+		var d rag.ScoredDocument
+		var metadata string
+		var embedding []byte
+		if err := rows.Scan(&d.Document.ID, &d.Document.Text, &metadata, &embedding); err != nil {
+			return nil, fmt.Errorf("sqlite: reading row: %w", err)
+		}
+		v := blobVector(embedding)
+		if len(v) != len(target) {
+			return nil, fmt.Errorf("%w: stored dimension %d of %q, want %d", rag.ErrEmbeddingMismatch, len(v), d.Document.ID, len(target))
+		}
+		if err := json.Unmarshal([]byte(metadata), &d.Document.Metadata); err != nil {
+			return nil, fmt.Errorf("sqlite: decoding metadata of %q: %w", d.Document.ID, err)
+		}
+		d.Score = cosine(target, v)
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: reading rows: %w", err)
+	}
+
+	slices.SortStableFunc(out, func(a, b rag.ScoredDocument) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Document.ID, b.Document.ID)
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// embed calls the embedder and checks the vectors have the configured
+// dimensions.
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", rag.ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) != s.dims {
+			return nil, fmt.Errorf("%w: dimension %d, want %d", rag.ErrEmbeddingMismatch, len(v), s.dims)
+		}
+	}
+	return vectors, nil
+}
+
+// matchExpression turns free text into an FTS5 query matching any of its
+// words. Each word is quoted so that FTS5 operators and punctuation in
+// the input are taken literally.
+func matchExpression(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " OR ")
+}
+
+func documents(scored []rag.ScoredDocument, err error) ([]rag.Document, error) {
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]rag.Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs, nil
+}
+
+// vectorBlob encodes v as packed little-endian float32s.
+func vectorBlob(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func blobVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
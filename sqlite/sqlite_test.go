@@ -0,0 +1,234 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/sqlite"
+)
+
+var (
+	_ rag.DocumentStore      = (*sqlite.Store)(nil)
+	_ rag.FilteringRetriever = (*sqlite.Store)(nil)
+	_ rag.FilteringRetriever = (*sqlite.KeywordRetriever)(nil)
+)
+
+// fakeDB is a database/sql connector recording statements and answering
+// every query with rows.
+type fakeDB struct {
+	mu        sync.Mutex
+	stmts     []string
+	args      [][]driver.NamedValue
+	committed int
+	rows      [][]driver.Value
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stmts = append(f.stmts, query)
+	f.args = append(f.args, args)
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *fakeConn) Rollback() error                     { return nil }
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.committed++
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.record(query, args)
+	return &fakeRows{rows: c.db.rows}, nil
+}
+
+type fakeRows struct{ rows [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"id", "text", "metadata", "score"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// axisEmbedder embeds known words on their own axis.
+type axisEmbedder struct{}
+
+func (axisEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	axes := map[string][]float32{
+		"cats":   {1, 0},
+		"kitten": {0.9, 0.1},
+		"money":  {0, 1},
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = axes[text]
+	}
+	return out, nil
+}
+
+func blob(v ...float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func newStore(t *testing.T, opts ...sqlite.Option) (*sqlite.Store, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { _ = db.Close() })
+	store, err := sqlite.New(db, opts...)
+	require.NoError(t, err)
+	return store, fake
+}
+
+func TestNewRejectsInvalidTable(t *testing.T) {
+	t.Parallel()
+
+	_, err := sqlite.New(sql.OpenDB(&fakeDB{}), sqlite.WithTable("docs; DROP TABLE x"))
+	require.ErrorIs(t, err, sqlite.ErrInvalidTable)
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t, sqlite.WithTable("docs"))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.Len(t, fake.stmts, 6)
+	require.Contains(t, fake.stmts[0], "CREATE TABLE IF NOT EXISTS docs (")
+	require.Contains(t, fake.stmts[0], "embedding BLOB")
+	require.Contains(t, fake.stmts[2], "CREATE VIRTUAL TABLE IF NOT EXISTS docs_fts USING fts5(text, content='docs'")
+	require.Contains(t, fake.stmts[4], "INSERT INTO docs_fts (docs_fts, rowid, text) VALUES ('delete', old.rowid, old.text)")
+}
+
+func TestAddAndRemove(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t, sqlite.WithEmbedder(axisEmbedder{}, 2))
+	require.NoError(t, store.Add(context.Background(),
+		rag.Document{ID: "a", Text: "cats", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}},
+		rag.Document{ID: "b", Text: "money"},
+	))
+	require.Equal(t, 1, fake.committed)
+	require.Contains(t, fake.stmts[0], "ON CONFLICT (id) DO UPDATE")
+	require.Equal(t, []any{"a", "cats", `{"spicedb_object":"document:a"}`, "document:a", blob(1, 0)}, values(fake.args[0]))
+	require.Equal(t, []any{"b", "money", `{}`, "", blob(0, 1)}, values(fake.args[1]))
+
+	require.NoError(t, store.Remove(context.Background(), "a", "b"))
+	require.Equal(t, "DELETE FROM rag_documents WHERE id IN (SELECT value FROM json_each(?))", fake.stmts[2])
+	require.Equal(t, []any{`["a","b"]`}, values(fake.args[2]))
+}
+
+func TestAddWithoutEmbedder(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t)
+	require.NoError(t, store.Add(context.Background(), rag.Document{ID: "a", Text: "cats"}))
+	require.Equal(t, []any{"a", "cats", `{}`, "", nil}, values(fake.args[0]))
+}
+
+func TestKeywordSearch(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t)
+	fake.rows = [][]driver.Value{
+		{"a", "roadmap", `{"spicedb_object":"document:a"}`, 2.5},
+		{"b", "review", `{}`, 1.0},
+	}
+
+	scored, err := store.RetrieveScored(context.Background(), `roadmap "review" OR`, 0)
+	require.NoError(t, err)
+	require.Equal(t, []rag.ScoredDocument{
+		{Document: rag.Document{ID: "a", Text: "roadmap", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}}, Score: 2.5},
+		{Document: rag.Document{ID: "b", Text: "review", Metadata: map[string]string{}}, Score: 1},
+	}, scored)
+	require.Contains(t, fake.stmts[0], "WHERE rag_documents_fts MATCH ?")
+	require.Equal(t, []any{`"roadmap" OR "review" OR "OR"`, int64(-1)}, values(fake.args[0]))
+
+	_, err = store.RetrieveAccessible(context.Background(), "roadmap", 5, []string{"document:a"})
+	require.NoError(t, err)
+	require.Contains(t, fake.stmts[1], "AND d.spicedb_object IN (SELECT value FROM json_each(?))")
+	require.Equal(t, []any{`"roadmap"`, `["document:a"]`, int64(5)}, values(fake.args[1]))
+
+	// Punctuation alone matches nothing and never reaches FTS5.
+	scored, err = store.RetrieveScored(context.Background(), "?!", 0)
+	require.NoError(t, err)
+	require.Empty(t, scored)
+	require.Len(t, fake.stmts, 2)
+}
+
+func TestVectorSearch(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t, sqlite.WithEmbedder(axisEmbedder{}, 2))
+	fake.rows = [][]driver.Value{
+		{"c", "money", `{}`, blob(0, 1)},
+		{"b", "kitten", `{}`, blob(0.9, 0.1)},
+		{"a", "cats", `{}`, blob(1, 0)},
+	}
+
+	docs, err := store.Retrieve(context.Background(), "cats", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, []string{docs[0].ID, docs[1].ID})
+
+	_, err = store.RetrieveAccessible(context.Background(), "cats", 0, []string{"document:a"})
+	require.NoError(t, err)
+	require.Contains(t, fake.stmts[1], "AND spicedb_object IN (SELECT value FROM json_each(?))")
+
+	// Keyword ignores the embedder.
+	fake.rows = nil
+	_, err = store.Keyword().RetrieveScored(context.Background(), "cats", 1)
+	require.NoError(t, err)
+	require.Contains(t, fake.stmts[2], "MATCH ?")
+}
+
+func TestVectorSearchRejectsStoredMismatch(t *testing.T) {
+	t.Parallel()
+
+	store, fake := newStore(t, sqlite.WithEmbedder(axisEmbedder{}, 2))
+	fake.rows = [][]driver.Value{{"a", "cats", `{}`, blob(1, 0, 0)}}
+
+	_, err := store.Retrieve(context.Background(), "cats", 0)
+	require.ErrorIs(t, err, rag.ErrEmbeddingMismatch)
+}
+
+func values(args []driver.NamedValue) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
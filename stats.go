@@ -0,0 +1,52 @@
+package rag
+
+// Stats describes the work done by a single Query. Use WithStats to obtain it.
+type Stats struct {
+	// DocsScanned is the number of documents examined during retrieval.
+	DocsScanned int
+	// Candidates is the number of documents that matched the query.
+	Candidates int
+	// Accessible is the number of objects the user can access, when the
+	// prefilter strategy looked them up before retrieval.
+	Accessible int
+	// Unmapped is the number of candidates skipped because they had no
+	// usable SpiceDB mapping.
+	Unmapped int
+	// Checked is the number of permission checks issued.
+	Checked int
+	// Allowed, Denied and Conditional split Checked by outcome.
+	// Conditional documents depend on caveat context that was not
+	// supplied; they are not returned.
+	Allowed     int
+	Denied      int
+	Conditional int
+	// Shadowed is the number of documents counted in Denied or
+	// Conditional that were returned anyway under WithShadowMode.
+	Shadowed int
+	// Rechecked is the number of permission checks repeated with the
+	// caveat context of WithConditionalResolver. Their outcomes replace
+	// the conditional ones in Allowed, Denied and Conditional.
+	Rechecked int
+	// CheckErrors is the number of documents whose permission check
+	// failed under FailClosedDocument or FailOpen; see
+	// QueryResponse.CheckErrors.
+	CheckErrors int
+	// BudgetExceeded is set when retrieval stopped early because the scan
+	// budget (see WithScanBudget) was exhausted.
+	BudgetExceeded bool
+	// Reranked is the number of documents scored by the Reranker (see
+	// WithReranker).
+	Reranked int
+	// LargestDocumentBytes is the size of the largest document in the
+	// corpus at query time.
+	LargestDocumentBytes int
+	// Plan is how the candidates were authorized; under FilterAdaptive
+	// it is chosen per query.
+	Plan Plan
+	// ContextTokens is the number of tokens of source text Answer packed
+	// into the prompt under WithContextBudget, and Unpacked the number
+	// of authorized documents it left out, as near-duplicates or for
+	// lack of room.
+	ContextTokens int
+	Unpacked      int
+}
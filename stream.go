@@ -0,0 +1,87 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// StreamingGenerator is implemented by generators that can deliver a
+// completion incrementally. GenerateStream calls yield with each token as
+// it arrives and stops, returning yield's error, as soon as yield fails.
+type StreamingGenerator interface {
+	Generator
+	GenerateStream(ctx context.Context, prompt string, yield func(token string) error) error
+}
+
+// Token is one piece of a streamed answer. The last Token of a failed
+// stream carries the error instead of text.
+type Token struct {
+	Text string
+	Err  error
+}
+
+// StreamingAnswer is the result of AnswerStream.
+type StreamingAnswer struct {
+	// Tokens delivers the answer as it is generated and is closed when
+	// generation ends.
+	Tokens <-chan Token
+
+	// Sources are the authorized documents the prompt was built from.
+	Sources []Document
+
+	// Stats describes the retrieval and filtering work.
+	Stats Stats
+}
+
+// AnswerStream is Answer for chat UIs: retrieval and permission filtering
+// happen before it returns, and any error there is returned directly;
+// the answer then streams through Tokens. Generators that are not a
+// StreamingGenerator deliver their whole answer as a single token.
+//
+// Callers must drain Tokens or cancel ctx, which ends the stream.
+func (r *RAGPipeline) AnswerStream(ctx context.Context, userID, question string, opts ...QueryOption) (*StreamingAnswer, error) {
+	prompt, resp, err := r.prepareAnswer(ctx, userID, question, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(chan Token)
+	go func() {
+		defer close(tokens)
+
+		ctx, span := r.startGenerate(ctx, prompt, resp)
+		streamed := 0
+
+		send := func(t Token) error {
+			select {
+			case tokens <- t:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		yield := func(text string) error {
+			streamed++
+			return send(Token{Text: text})
+		}
+
+		var err error
+		if sg, ok := r.generator.(StreamingGenerator); ok {
+			err = sg.GenerateStream(ctx, prompt, yield)
+		} else {
+			var answer string
+			if answer, err = r.generator.Generate(ctx, prompt); err == nil {
+				err = yield(answer)
+			}
+		}
+		span.SetAttributes(attribute.Int("rag.tokens", streamed))
+		endSpan(span, err)
+		if err != nil && ctx.Err() == nil {
+			_ = send(Token{Err: fmt.Errorf("rag: generation: %w", err)})
+		}
+	}()
+
+	return &StreamingAnswer{Tokens: tokens, Sources: resp.Documents, Stats: resp.Stats}, nil
+}
@@ -0,0 +1,114 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// wordStreamer streams its answer word by word, then fails with err.
+type wordStreamer struct {
+	answer string
+	err    error
+}
+
+func (w *wordStreamer) Generate(context.Context, string) (string, error) {
+	return "", errors.New("unexpected non-streaming call")
+}
+
+func (w *wordStreamer) GenerateStream(_ context.Context, _ string, yield func(string) error) error {
+	for _, word := range strings.SplitAfter(w.answer, " ") {
+		if err := yield(word); err != nil {
+			return err
+		}
+	}
+	return w.err
+}
+
+func collect(t *testing.T, tokens <-chan rag.Token) ([]string, error) {
+	t.Helper()
+	var texts []string
+	var err error
+	for tok := range tokens {
+		if tok.Err != nil {
+			err = tok.Err
+			continue
+		}
+		texts = append(texts, tok.Text)
+	}
+	return texts, err
+}
+
+func TestAnswerStream(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithGenerator(&wordStreamer{answer: "it is doc1"}))
+
+	stream, err := pipeline.AnswerStream(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, stream.Sources)
+	require.Equal(t, 2, stream.Stats.Denied)
+
+	texts, err := collect(t, stream.Tokens)
+	require.NoError(t, err)
+	require.Equal(t, []string{"it ", "is ", "doc1"}, texts)
+}
+
+func TestAnswerStreamFallsBackToGenerate(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithGenerator(&recordingGenerator{answer: "whole answer"}))
+
+	stream, err := pipeline.AnswerStream(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	texts, err := collect(t, stream.Tokens)
+	require.NoError(t, err)
+	require.Equal(t, []string{"whole answer"}, texts)
+}
+
+func TestAnswerStreamErrors(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	boom := errors.New("connection reset")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithGenerator(&wordStreamer{answer: "partial", err: boom}))
+
+	// Filtering errors are returned before streaming starts.
+	_, err := pipeline.AnswerStream(context.Background(), "charlie", "synthetic")
+	require.ErrorIs(t, err, rag.ErrNoSources)
+
+	stream, err := pipeline.AnswerStream(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	texts, err := collect(t, stream.Tokens)
+	require.Equal(t, []string{"partial"}, texts)
+	require.ErrorIs(t, err, boom)
+}
+
+func TestAnswerStreamCancel(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3),
+		rag.WithGenerator(&wordStreamer{answer: strings.Repeat("word ", 100)}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := pipeline.AnswerStream(ctx, "emilia", "synthetic")
+	require.NoError(t, err)
+	<-stream.Tokens
+	cancel()
+
+	// The stream ends without an error token once ctx is cancelled.
+	texts, err := collect(t, stream.Tokens)
+	require.NoError(t, err)
+	require.Less(t, len(texts), 99)
+}
@@ -0,0 +1,113 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// DefaultSubjectType is the object type of the subject queries are
+// authorized for unless configured otherwise.
+const DefaultSubjectType = "user"
+
+// WithDefaultSubjectType sets the type, and optionally the relation, of
+// the subject queries are authorized for, e.g. ("serviceaccount", "") or
+// ("group", "member"). The default is (DefaultSubjectType, "").
+func WithDefaultSubjectType(objectType, relation string) Option {
+	return func(r *RAGPipeline) {
+		r.subjectType = objectType
+		r.subjectRelation = relation
+	}
+}
+
+// WithSubjectType overrides the subject type and relation for one query.
+// See QueryRequest.SubjectType.
+func WithSubjectType(objectType, relation string) QueryOption {
+	return func(qc *queryConfig) {
+		qc.subjectType = objectType
+		qc.subjectRelation = relation
+	}
+}
+
+// QueryAsSubject runs Query for a subject given as "type:id" or
+// "type:id#relation", e.g. "serviceaccount:indexer", instead of a user
+// ID. It serves backend jobs such as re-indexing or evaluation, which
+// act under their own identity rather than a user's; Query stays the
+// entry point for users.
+func (r *RAGPipeline) QueryAsSubject(ctx context.Context, subject, query string, opts ...QueryOption) ([]Document, error) {
+	ref, err := ParseSubjectReference(subject)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithSubjectType(ref.GetObject().GetObjectType(), ref.GetOptionalRelation()))
+	return r.Query(ctx, ref.GetObject().GetObjectId(), query, opts...)
+}
+
+type principalKey struct{}
+
+// WithSubject returns a copy of ctx carrying the calling principal s, so
+// authentication middleware can identify the caller once per request:
+// Query, Do, Answer, Suggest and the other query methods use it when
+// they are given an empty user ID. An explicit user ID always wins. An
+// empty s.Type selects the pipeline's default subject type and relation.
+// s.Tenant is the tenant of queries that name none, whatever their user.
+func WithSubject(ctx context.Context, s Subject) context.Context {
+	return context.WithValue(ctx, principalKey{}, s)
+}
+
+// SubjectFromContext returns the subject set with WithSubject.
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	s, ok := ctx.Value(principalKey{}).(Subject)
+	return s, ok
+}
+
+// withContextSubject returns req with the subject from ctx, if req names
+// no user, and its tenant, if req names none.
+func (req QueryRequest) withContextSubject(ctx context.Context) QueryRequest {
+	s, ok := SubjectFromContext(ctx)
+	if !ok {
+		return req
+	}
+	if req.Tenant == "" {
+		req.Tenant = s.Tenant
+	}
+	if req.UserID != "" {
+		return req
+	}
+	req.UserID = s.ID
+	if req.SubjectType == "" {
+		req.SubjectType, req.SubjectRelation = s.Type, s.Relation
+	}
+	return req
+}
+
+// subject returns the subject reference for id. An empty objectType
+// selects the pipeline's default type and relation.
+func (r *RAGPipeline) subject(id, objectType, relation string) *apiv1.SubjectReference {
+	if objectType == "" {
+		objectType, relation = r.subjectType, r.subjectRelation
+	}
+	return &apiv1.SubjectReference{
+		Object: &apiv1.ObjectReference{
+			ObjectType: objectType,
+			ObjectId:   id,
+		},
+		OptionalRelation: relation,
+	}
+}
+
+// ParseSubjectReference parses "type:id" or "type:id#relation" into a
+// SubjectReference, e.g. "user:emilia" or "group:eng#member".
+func ParseSubjectReference(s string) (*apiv1.SubjectReference, error) {
+	object, relation, hasRelation := strings.Cut(s, "#")
+	if hasRelation && relation == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSpiceDBObject, s)
+	}
+	obj, err := ParseObjectReference(object)
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.SubjectReference{Object: obj, OptionalRelation: relation}, nil
+}
@@ -0,0 +1,123 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestDefaultSubjectType(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient(
+		"document:doc0#read@user:ci",
+		"document:doc1#read@serviceaccount:ci",
+		"document:doc2#read@group:eng#member",
+	)
+	docs := syntheticCorpus(3)
+
+	tests := []struct {
+		name string
+		opts []rag.Option
+		id   string
+		want []string
+	}{
+		{name: "user by default", id: "ci", want: []string{"doc0"}},
+		{name: "service account", opts: []rag.Option{rag.WithDefaultSubjectType("serviceaccount", "")}, id: "ci", want: []string{"doc1"}},
+		{name: "group members", opts: []rag.Option{rag.WithDefaultSubjectType("group", "member")}, id: "eng", want: []string{"doc2"}},
+	}
+	for _, tt := range tests {
+		for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+			opts := append([]rag.Option{rag.WithFilterStrategy(strategy)}, tt.opts...)
+			pipeline := rag.NewRAGPipeline(client, "document", "read", docs, opts...)
+
+			results, err := pipeline.Query(context.Background(), tt.id, "synthetic")
+			require.NoError(t, err, tt.name)
+			requireEqualDocIDs(t, tt.want, results)
+		}
+	}
+}
+
+func TestPerQuerySubjectType(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:doc0#read@user:eng", "document:doc2#read@group:eng#member")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+
+	results, err := pipeline.Query(context.Background(), "eng", "synthetic", rag.WithSubjectType("group", "member"))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+
+	resp, err := pipeline.Do(context.Background(), rag.QueryRequest{UserID: "eng", Query: "synthetic"})
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0"}, resp.Documents)
+}
+
+func TestQueryAsSubject(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient(
+		"document:doc0#read@user:indexer",
+		"document:doc1#read@serviceaccount:indexer",
+		"document:doc2#read@group:eng#member",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+
+	results, err := pipeline.QueryAsSubject(ctx, "serviceaccount:indexer", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	results, err = pipeline.QueryAsSubject(ctx, "group:eng#member", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+
+	// The default path is unaffected.
+	results, err = pipeline.Query(ctx, "indexer", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0"}, results)
+
+	_, err = pipeline.QueryAsSubject(ctx, "indexer", "synthetic")
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+}
+
+func TestContextSubject(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient(
+		"document:doc0#read@user:emilia",
+		"document:doc1#read@serviceaccount:indexer",
+		"document:doc2#read@user:beatrice",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(3))
+
+	ctx := rag.WithSubject(context.Background(), rag.Subject{ID: "emilia"})
+	s, ok := rag.SubjectFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, "emilia", s.ID)
+
+	results, err := pipeline.Query(ctx, "", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0"}, results)
+
+	resp, err := pipeline.Do(ctx, rag.QueryRequest{Query: "synthetic"})
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc0"}, resp.Documents)
+
+	// An explicit user wins over the context.
+	results, err = pipeline.Query(ctx, "beatrice", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+
+	svc := rag.WithSubject(context.Background(), rag.Subject{Type: "serviceaccount", ID: "indexer"})
+	results, err = pipeline.Query(svc, "", "synthetic")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1"}, results)
+
+	// Without a subject anywhere the request is invalid.
+	_, err = pipeline.Query(context.Background(), "", "synthetic")
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+}
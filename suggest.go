@@ -0,0 +1,84 @@
+package rag
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const defaultSuggestLimit = 10
+
+// WithSuggestionSource makes Suggest complete the values of the given
+// metadata key (e.g. "title") instead of the terms of document text.
+func WithSuggestionSource(metadataKey string) Option {
+	return func(r *RAGPipeline) {
+		r.suggestKey = metadataKey
+	}
+}
+
+// Suggest returns up to limit completions for prefix, ranked by how often
+// they occur in the documents userID may read (ties broken
+// alphabetically). Only documents that SpiceDB definitively permits are
+// considered, so suggestions never hint at content the user cannot read;
+// if the accessible set cannot be computed, Suggest fails rather than
+// falling back to the whole corpus. Under WithTenancy only the documents
+// of the tenant of the Subject set with WithSubject are considered.
+func (r *RAGPipeline) Suggest(ctx context.Context, userID, prefix string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+	ctx = contextWithConsistency(ctx, r.consistency)
+	req := QueryRequest{UserID: userID}.withContextSubject(ctx)
+	if err := r.validateTenant(req.Tenant); err != nil {
+		return nil, err
+	}
+	docs := tenantDocs(r.snapshot(), req.Tenant)
+	resources, accessible, err := r.accessibleSet(ctx, r.querySubject(req), docs)
+	if err != nil {
+		return nil, err
+	}
+
+	freq := make(map[string]int)
+	for i, d := range docs {
+		if resources[i] == "" || !accessible[resources[i]] {
+			continue
+		}
+		if r.suggestKey != "" {
+			if v := strings.TrimSpace(d.Metadata[r.suggestKey]); v != "" && strings.HasPrefix(strings.ToLower(v), prefix) {
+				freq[v]++
+			}
+			continue
+		}
+		for _, term := range terms(d.Text) {
+			if strings.HasPrefix(term, prefix) {
+				freq[term]++
+			}
+		}
+	}
+
+	suggestions := make([]string, 0, len(freq))
+	for s := range freq {
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if freq[a] != freq[b] {
+			return freq[a] > freq[b]
+		}
+		return a < b
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// terms splits text into lowercase words of letters and digits.
+func terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
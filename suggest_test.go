@@ -0,0 +1,64 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestSuggest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	docs := append(scenarioDocs(), rag.Document{
+		ID:       "doc4",
+		Text:     "Conference schedule. Conference venue. Configuration notes.",
+		Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc4"},
+	})
+	client, _ := newFakeClient(
+		"document:doc1#read@user:emilia",
+		"document:doc3#read@user:charlie",
+		"document:doc4#read@user:charlie",
+		"document:doc4#read@user:emilia",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs)
+
+	got, err := pipeline.Suggest(ctx, "charlie", "conf", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"conference", "configuration"}, got)
+
+	got, err = pipeline.Suggest(ctx, "emilia", "CONF", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"conference", "confidential", "configuration"}, got)
+
+	got, err = pipeline.Suggest(ctx, "emilia", "conf", 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"conference"}, got)
+
+	got, err = pipeline.Suggest(rag.WithSubject(ctx, rag.Subject{ID: "charlie"}), "", "conf", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"conference", "configuration"}, got)
+
+	got, err = pipeline.Suggest(ctx, "nobody", "", 10)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestSuggestFromMetadata(t *testing.T) {
+	t.Parallel()
+
+	docs := []rag.Document{
+		{ID: "a", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a", "title": "Quarterly Roadmap"}},
+		{ID: "b", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:b", "title": "Quarterly Review"}},
+		{ID: "c", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:c", "title": "Quarterly Secrets"}},
+	}
+	client, _ := newFakeClient("document:a#read@user:emilia", "document:b#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithSuggestionSource("title"))
+
+	got, err := pipeline.Suggest(context.Background(), "emilia", "quar", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Quarterly Review", "Quarterly Roadmap"}, got)
+}
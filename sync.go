@@ -0,0 +1,266 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+const defaultSyncBatchSize = 100
+
+// SyncReport summarizes what SyncCorpus did, or would do in a dry run.
+type SyncReport struct {
+	Added     []string
+	Updated   []string
+	Removed   []string
+	Unchanged int
+
+	// Rejected lists desired documents refused at ingestion, as
+	// AddDocuments would refuse them: by the size limit, WithStrictMapping
+	// or WithTenancy. A rejected update leaves the current version in
+	// place.
+	Rejected []RejectedDocument
+
+	// PurgedObjects counts the SpiceDB objects whose relationships were
+	// deleted because their last document was removed.
+	PurgedObjects int
+	// PurgedAt is the revision of the last deletion, nil if there was
+	// none, to query at with WithAtLeastAsFresh.
+	PurgedAt *apiv1.ZedToken
+
+	DryRun bool
+}
+
+// SyncOption configures SyncCorpus.
+type SyncOption func(*syncConfig)
+
+type syncConfig struct {
+	dryRun    bool
+	batchSize int
+	purge     bool
+}
+
+// SyncDryRun computes the plan without applying it.
+func SyncDryRun() SyncOption {
+	return func(c *syncConfig) {
+		c.dryRun = true
+	}
+}
+
+// SyncBatchSize sets how many changes are applied per lock acquisition, so
+// large syncs do not stall concurrent queries. The default is 100.
+func SyncBatchSize(n int) SyncOption {
+	return func(c *syncConfig) {
+		if n > 0 {
+			c.batchSize = n
+		}
+	}
+}
+
+// SyncPurgeRelationships deletes the SpiceDB relationships of removed
+// documents' objects, unless another document still maps to the same
+// object.
+func SyncPurgeRelationships() SyncOption {
+	return func(c *syncConfig) {
+		c.purge = true
+	}
+}
+
+// SyncCorpus converges the corpus to desired: documents with new IDs are
+// added, documents whose content hash changed are updated, and documents
+// missing from desired are removed. Desired documents go through the
+// same ingestion as AddDocuments, so with a chunker they are compared,
+// added and removed as a whole, by their chunks, and IDs in the report
+// are those of the documents rather than of their chunks.
+func (r *RAGPipeline) SyncCorpus(ctx context.Context, desired []Document, opts ...SyncOption) (SyncReport, error) {
+	cfg := syncConfig{batchSize: defaultSyncBatchSize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	report := SyncReport{DryRun: cfg.dryRun}
+
+	current := make(map[string][]Document)
+	for _, d := range r.snapshot() {
+		id := r.sourceID(d)
+		current[id] = append(current[id], d)
+	}
+
+	var changes [][]Document // the ingested entries of each changed document
+	wanted := make(map[string]bool, len(desired))
+	for _, d := range desired {
+		if wanted[d.ID] {
+			return report, fmt.Errorf("rag: duplicate document ID %q in desired corpus", d.ID)
+		}
+		wanted[d.ID] = true
+
+		entries, err := r.ingest(d)
+		if err != nil {
+			report.Rejected = append(report.Rejected, RejectedDocument{ID: d.ID, Err: err})
+			continue
+		}
+		old, exists := current[d.ID]
+		if exists && entriesHash(old) == entriesHash(entries) {
+			report.Unchanged++
+			continue
+		}
+		if exists {
+			report.Updated = append(report.Updated, d.ID)
+		} else {
+			report.Added = append(report.Added, d.ID)
+		}
+		changes = append(changes, entries)
+	}
+	for id := range current {
+		if !wanted[id] {
+			report.Removed = append(report.Removed, id)
+		}
+	}
+	sort.Strings(report.Removed)
+
+	if cfg.dryRun {
+		return report, nil
+	}
+
+	for start := 0; start < len(changes); start += cfg.batchSize {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		var put []Document
+		sources := make(map[string]bool, cfg.batchSize)
+		keep := make(map[string]bool)
+		for _, entries := range changes[start:min(start+cfg.batchSize, len(changes))] {
+			for _, d := range entries {
+				sources[r.sourceID(d)] = true
+				keep[d.ID] = true
+			}
+			put = append(put, entries...)
+		}
+
+		// Drop the chunks an updated document no longer has.
+		r.mu.Lock()
+		remove := make(map[string]struct{})
+		for _, d := range r.docs {
+			if sources[r.sourceID(d)] && !keep[d.ID] {
+				remove[d.ID] = struct{}{}
+			}
+		}
+		r.applyLocked(put, remove)
+		r.mu.Unlock()
+	}
+
+	var removedDocs []Document
+	for start := 0; start < len(report.Removed); start += cfg.batchSize {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		sources := make(map[string]bool, cfg.batchSize)
+		for _, id := range report.Removed[start:min(start+cfg.batchSize, len(report.Removed))] {
+			sources[id] = true
+		}
+
+		r.mu.Lock()
+		remove := make(map[string]struct{})
+		for _, d := range r.docs {
+			if sources[r.sourceID(d)] {
+				remove[d.ID] = struct{}{}
+				removedDocs = append(removedDocs, d)
+			}
+		}
+		r.applyLocked(nil, remove)
+		r.mu.Unlock()
+	}
+
+	if cfg.purge {
+		n, token, err := r.purgeRelationships(ctx, removedDocs)
+		report.PurgedObjects, report.PurgedAt = n, token
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// purgeRelationships deletes all relationships on the objects of removed,
+// skipping objects that are still referenced by a document in the corpus.
+// It returns the number of objects purged and the revision of the last
+// deletion.
+func (r *RAGPipeline) purgeRelationships(ctx context.Context, removed []Document) (int, *apiv1.ZedToken, error) {
+	live := make(map[string]bool)
+	for _, d := range r.snapshot() {
+		if res, err := r.resourceFor(d); err == nil {
+			live[objectKey(res)] = true
+		}
+	}
+
+	purged := 0
+	var token *apiv1.ZedToken
+	done := make(map[string]bool)
+	for _, d := range removed {
+		res, err := r.resourceFor(d)
+		if err != nil {
+			continue
+		}
+		key := objectKey(res)
+		if live[key] || done[key] {
+			continue
+		}
+		done[key] = true
+
+		resp, err := r.spiceClient.DeleteRelationships(ctx, &apiv1.DeleteRelationshipsRequest{
+			RelationshipFilter: &apiv1.RelationshipFilter{
+				ResourceType:       res.GetObjectType(),
+				OptionalResourceId: res.GetObjectId(),
+			},
+		})
+		if err != nil {
+			return purged, token, fmt.Errorf("rag: purging relationships of %s: %w", key, err)
+		}
+		purged++
+		token = resp.GetDeletedAt()
+		r.access.purge()
+	}
+	return purged, token, nil
+}
+
+func objectKey(obj *apiv1.ObjectReference) string {
+	return obj.GetObjectType() + ":" + obj.GetObjectId()
+}
+
+// entriesHash identifies a version of the corpus entries of a document,
+// which are its chunks in order or the document itself.
+func entriesHash(entries []Document) string {
+	h := sha256.New()
+	for _, d := range entries {
+		fmt.Fprintf(h, "%d:%s%s", len(d.ID), d.ID, contentHash(d))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// contentHash identifies a document version by its text and metadata.
+// Every field is prefixed with its length, so no text can pass for
+// metadata or the other way round.
+func contentHash(d Document) string {
+	h := sha256.New()
+	field := func(s string) {
+		fmt.Fprintf(h, "%d:", len(s))
+		_, _ = io.WriteString(h, s)
+	}
+	field(d.Text)
+
+	keys := make([]string, 0, len(d.Metadata))
+	for k := range d.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		field(k)
+		field(d.Metadata[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
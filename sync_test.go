@@ -0,0 +1,197 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func TestSyncCorpus(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient(
+		"document:doc1#read@user:emilia",
+		"document:doc2#read@user:emilia",
+		"document:doc3#read@user:emilia",
+	)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil)
+
+	desired := scenarioDocs()
+
+	report, err := pipeline.SyncCorpus(ctx, desired)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1", "doc2", "doc3"}, report.Added)
+	require.Empty(t, report.Updated)
+	require.Empty(t, report.Removed)
+
+	// Same input again: nothing to do.
+	report, err = pipeline.SyncCorpus(ctx, desired)
+	require.NoError(t, err)
+	require.Empty(t, report.Added)
+	require.Empty(t, report.Updated)
+	require.Empty(t, report.Removed)
+	require.Equal(t, 3, report.Unchanged)
+
+	// doc2 changes, doc3 disappears.
+	changed := []rag.Document{desired[0], desired[1]}
+	changed[1].Text = "Customer success playbook, now with a public appendix."
+
+	plan, err := pipeline.SyncCorpus(ctx, changed, rag.SyncDryRun())
+	require.NoError(t, err)
+	require.True(t, plan.DryRun)
+	require.Equal(t, []string{"doc2"}, plan.Updated)
+	require.Equal(t, []string{"doc3"}, plan.Removed)
+
+	results, err := pipeline.Query(ctx, "emilia", "public")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc3"}, results)
+
+	report, err = pipeline.SyncCorpus(ctx, changed, rag.SyncBatchSize(1), rag.SyncPurgeRelationships())
+	require.NoError(t, err)
+	require.Empty(t, report.Added)
+	require.Equal(t, []string{"doc2"}, report.Updated)
+	require.Equal(t, []string{"doc3"}, report.Removed)
+	require.Equal(t, 1, report.Unchanged)
+	require.Equal(t, 1, report.PurgedObjects)
+	require.Equal(t, "fake-revision", report.PurgedAt.GetToken())
+	require.Equal(t, []string{"document:doc3"}, fake.deletedObjects())
+
+	results, err = pipeline.Query(ctx, "emilia", "public")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc2"}, results)
+}
+
+func TestSyncCorpusKeepsSharedObjects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient()
+	chunk := func(id string) rag.Document {
+		return rag.Document{ID: id, Text: id, Metadata: map[string]string{rag.SpiceDBObjectKey: "document:handbook"}}
+	}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", []rag.Document{chunk("part1"), chunk("part2")})
+
+	report, err := pipeline.SyncCorpus(ctx, []rag.Document{chunk("part1")}, rag.SyncPurgeRelationships())
+	require.NoError(t, err)
+	require.Equal(t, []string{"part2"}, report.Removed)
+	require.Zero(t, report.PurgedObjects, "part1 still maps to document:handbook")
+	require.Empty(t, fake.deletedObjects())
+}
+
+func TestSyncCorpusValidation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithMaxDocumentBytes(30))
+
+	_, err := pipeline.SyncCorpus(ctx, []rag.Document{{ID: "a"}, {ID: "a"}})
+	require.ErrorContains(t, err, `duplicate document ID "a"`)
+
+	report, err := pipeline.SyncCorpus(ctx, []rag.Document{{ID: "doc3", Text: "this text is well over thirty bytes"}})
+	require.NoError(t, err)
+	require.Len(t, report.Rejected, 1)
+	require.ErrorIs(t, report.Rejected[0].Err, rag.ErrDocumentTooLarge)
+}
+
+func TestSyncCorpusChunks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithChunker(rag.FixedSizeChunker{Size: 4}))
+	desired := []rag.Document{{ID: "doc1", Text: "abcdabcdabcd", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:doc1"}}}
+
+	report, err := pipeline.SyncCorpus(ctx, desired)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1"}, report.Added)
+
+	results, err := pipeline.Query(ctx, "emilia", "a")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1#0", "doc1#1", "doc1#2"}, results)
+
+	report, err = pipeline.SyncCorpus(ctx, desired)
+	require.NoError(t, err)
+	require.Empty(t, report.Added)
+	require.Empty(t, report.Updated)
+	require.Empty(t, report.Removed)
+	require.Equal(t, 1, report.Unchanged)
+
+	// A shorter version drops the chunks it no longer has.
+	desired[0].Text = "abcdabcd"
+	report, err = pipeline.SyncCorpus(ctx, desired)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1"}, report.Updated)
+	results, err = pipeline.Query(ctx, "emilia", "a")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"doc1#0", "doc1#1"}, results)
+
+	report, err = pipeline.SyncCorpus(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1"}, report.Removed)
+	results, err = pipeline.Query(ctx, "emilia", "a")
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestSyncCorpusStrictMapping(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient("document:ok#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithStrictMapping())
+
+	ok := rag.Document{ID: "ok", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:ok"}}
+	report, err := pipeline.SyncCorpus(ctx, []rag.Document{ok, {ID: "missing", Text: "faq"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ok"}, report.Added)
+	require.Len(t, report.Rejected, 1)
+	require.Equal(t, "missing", report.Rejected[0].ID)
+	require.ErrorIs(t, report.Rejected[0].Err, rag.ErrNoResourceMapping)
+
+	// A broken update leaves the current version in place.
+	broken := ok
+	broken.Metadata = map[string]string{rag.SpiceDBObjectKey: "document:"}
+	report, err = pipeline.SyncCorpus(ctx, []rag.Document{broken})
+	require.NoError(t, err)
+	require.Empty(t, report.Updated)
+	require.Empty(t, report.Removed)
+	require.ErrorIs(t, report.Rejected[0].Err, rag.ErrInvalidSpiceDBObject)
+
+	results, err := pipeline.Query(ctx, "emilia", "faq")
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"ok"}, results)
+}
+
+func TestSyncCorpusTenancy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithTenancy())
+
+	orphan := rag.Document{ID: "orphan", Text: "No tenant.", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:orphan"}}
+	report, err := pipeline.SyncCorpus(ctx, append(tenantDocs(), orphan))
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme-report", "acme-handbook", "globex-report"}, report.Added)
+	require.Len(t, report.Rejected, 1)
+	require.Equal(t, "orphan", report.Rejected[0].ID)
+	require.ErrorIs(t, report.Rejected[0].Err, rag.ErrNoTenant)
+}
+
+func TestSyncCorpusTellsTextFromMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", []rag.Document{{ID: "doc1", Text: "text\x00k\x00v"}})
+
+	report, err := pipeline.SyncCorpus(ctx, []rag.Document{{ID: "doc1", Text: "text", Metadata: map[string]string{"k": "v"}}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1"}, report.Updated)
+	require.Zero(t, report.Unchanged)
+}
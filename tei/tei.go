@@ -0,0 +1,163 @@
+// Package tei implements rag.CrossEncoder on top of Hugging Face Text
+// Embeddings Inference (TEI), which serves reranking models such as
+// BAAI/bge-reranker-base with ONNX or Candle backends:
+//
+//	docker run -p 8080:80 ghcr.io/huggingface/text-embeddings-inference:cpu-1.8 --model-id BAAI/bge-reranker-base
+//
+// Use it with rag.NewCrossEncoderReranker(tei.NewCrossEncoder()).
+package tei
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultBaseURL is the address the TEI container is published on in the
+// example above.
+const DefaultBaseURL = "http://localhost:8080"
+
+// DefaultBatchSize is TEI's default limit on the texts of one request
+// (--max-client-batch-size).
+const DefaultBatchSize = 32
+
+// APIError is a non-2xx response from the TEI server.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("tei: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Option configures a CrossEncoder.
+type Option func(*CrossEncoder)
+
+// WithBaseURL overrides DefaultBaseURL.
+func WithBaseURL(u string) Option {
+	return func(c *CrossEncoder) {
+		c.baseURL = strings.TrimRight(u, "/")
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *CrossEncoder) {
+		c.httpClient = hc
+	}
+}
+
+// WithAPIKey authenticates with the key the server was started with
+// (--api-key).
+func WithAPIKey(key string) Option {
+	return func(c *CrossEncoder) {
+		c.apiKey = key
+	}
+}
+
+// WithBatchSize overrides DefaultBatchSize, for servers started with a
+// different --max-client-batch-size.
+func WithBatchSize(n int) Option {
+	return func(c *CrossEncoder) {
+		c.batchSize = n
+	}
+}
+
+// CrossEncoder is a rag.CrossEncoder backed by TEI's /rerank endpoint.
+type CrossEncoder struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	batchSize  int
+}
+
+// NewCrossEncoder returns a CrossEncoder scoring with the model the TEI
+// server was started with.
+func NewCrossEncoder(opts ...Option) *CrossEncoder {
+	c := &CrossEncoder{baseURL: DefaultBaseURL, httpClient: http.DefaultClient, batchSize: DefaultBatchSize}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type rerankRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+type rerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+// Score implements rag.CrossEncoder. Texts longer than the model's
+// maximum input are truncated, and more texts than the batch size are
+// sent in several requests.
+func (c *CrossEncoder) Score(ctx context.Context, query string, texts []string) ([]float64, error) {
+	scores := make([]float64, len(texts))
+	batch := c.batchSize
+	if batch <= 0 {
+		batch = len(texts)
+	}
+	for start := 0; start < len(texts); start += batch {
+		end := min(start+batch, len(texts))
+		var results []rerankResult
+		if err := c.post(ctx, "/rerank", rerankRequest{Query: query, Texts: texts[start:end], Truncate: true}, &results); err != nil {
+			return nil, err
+		}
+		if len(results) != end-start {
+			return nil, fmt.Errorf("tei: got %d scores for %d texts", len(results), end-start)
+		}
+		for _, res := range results {
+			if res.Index < 0 || res.Index >= end-start {
+				return nil, fmt.Errorf("tei: score for text %d of %d", res.Index, end-start)
+			}
+			scores[start+res.Index] = res.Score
+		}
+	}
+	return scores, nil
+}
+
+// post sends body as JSON to path and decodes the response into out.
+func (c *CrossEncoder) post(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("tei: encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("tei: building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("tei: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(raw))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(raw, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("tei: decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package tei_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/tei"
+)
+
+var _ rag.CrossEncoder = (*tei.CrossEncoder)(nil)
+
+// fakeTEI serves /rerank, scoring each text by how often it holds the
+// query and answering most relevant first, as TEI does. It records the
+// size of every batch.
+func fakeTEI(t *testing.T, batches *[]int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rerank" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Unauthorized","error_type":"unauthorized"}`))
+			return
+		}
+		var req struct {
+			Query string   `json:"query"`
+			Texts []string `json:"texts"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*batches = append(*batches, len(req.Texts))
+
+		type result struct {
+			Index int     `json:"index"`
+			Score float64 `json:"score"`
+		}
+		results := make([]result, len(req.Texts))
+		for i, text := range req.Texts {
+			results[i] = result{Index: i, Score: float64(strings.Count(text, req.Query))}
+		}
+		slices.SortStableFunc(results, func(a, b result) int { return int(b.Score - a.Score) })
+		_ = json.NewEncoder(w).Encode(results)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCrossEncoderScore(t *testing.T) {
+	t.Parallel()
+
+	var batches []int
+	srv := fakeTEI(t, &batches)
+	ce := tei.NewCrossEncoder(tei.WithBaseURL(srv.URL+"/"), tei.WithAPIKey("secret"), tei.WithBatchSize(2))
+
+	scores, err := ce.Score(context.Background(), "x", []string{"x", "xxx", "y", "xx", "xxxx"})
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 3, 0, 2, 4}, scores)
+	require.Equal(t, []int{2, 2, 1}, batches)
+}
+
+func TestCrossEncoderAPIError(t *testing.T) {
+	t.Parallel()
+
+	var batches []int
+	srv := fakeTEI(t, &batches)
+	_, err := tei.NewCrossEncoder(tei.WithBaseURL(srv.URL)).Score(context.Background(), "x", []string{"x"})
+	var apiErr *tei.APIError
+	require.True(t, errors.As(err, &apiErr), err)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	require.Equal(t, "Unauthorized", apiErr.Message)
+}
+
+func TestCrossEncoderReranks(t *testing.T) {
+	t.Parallel()
+
+	var batches []int
+	srv := fakeTEI(t, &batches)
+	rr := rag.NewCrossEncoderReranker(tei.NewCrossEncoder(tei.WithBaseURL(srv.URL), tei.WithAPIKey("secret")))
+
+	docs := []rag.ScoredDocument{
+		{Document: rag.Document{ID: "a", Text: "spicedb"}},
+		{Document: rag.Document{ID: "b", Text: "spicedb spicedb"}},
+	}
+	reranked, err := rr.Rerank(context.Background(), "spicedb", docs)
+	require.NoError(t, err)
+	require.Equal(t, "b", reranked[0].Document.ID)
+	require.Equal(t, 2.0, reranked[0].Score)
+}
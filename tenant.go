@@ -0,0 +1,174 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// TenantKey is the metadata key holding the tenant a document belongs
+// to, e.g. "acme".
+const TenantKey = "tenant"
+
+// ErrNoTenant is returned by a pipeline with WithTenancy for a document
+// that names no tenant.
+var ErrNoTenant = errors.New("rag: document has no tenant")
+
+// tenantPrefix is SpiceDB's syntax for definition prefixes.
+var tenantPrefix = regexp.MustCompile(`^[a-z][a-z0-9_]{1,62}[a-z0-9]$`)
+
+// WithTenancy lets one pipeline serve several customers. Every document
+// must name its tenant under TenantKey, or it is rejected with
+// ErrNoTenant, and every query must name one with QueryRequest.Tenant,
+// WithTenant or the Subject set by WithSubject, or it fails validation.
+//
+// A query only ever sees the documents of its tenant: the others are
+// left out before the built-in scan, and dropped straight after
+// retrieval by a Retriever, so they are never checked, returned,
+// explained or counted in Stats. Retrievers over shared indexes should
+// still filter on TenantKey themselves so that other tenants' matches do
+// not crowd out the caller's.
+//
+// Without WithTenantPrefixes all tenants share SpiceDB's definitions, so
+// their object IDs must not collide.
+func WithTenancy() Option {
+	return func(r *RAGPipeline) {
+		r.tenancy = true
+	}
+}
+
+// WithTenantPrefixes implies WithTenancy and also isolates tenants in
+// SpiceDB, giving each its own prefixed definitions: a document of tenant
+// "acme" mapped to "document:doc1" is checked as "acme/document:doc1",
+// for the subject "acme/user:emilia", and so are its relationships
+// written. Objects may be mapped with their prefix already, which must
+// then be the document's tenant. Tenants must be valid SpiceDB prefixes
+// (lowercase letters, digits and underscores), and each tenant's schema
+// is written with its prefix, as spicedbtest.SharedNamespace does.
+//
+// Methods that address documents outside the corpus by ID, such as
+// GrantAccess, cannot know their tenant; pass them the prefixed object
+// instead.
+func WithTenantPrefixes() Option {
+	return func(r *RAGPipeline) {
+		r.tenancy = true
+		r.tenantPrefixes = true
+	}
+}
+
+// WithTenant runs the query for tenant. See QueryRequest.Tenant.
+func WithTenant(tenant string) QueryOption {
+	return func(qc *queryConfig) {
+		qc.tenant = tenant
+	}
+}
+
+// validateTenant reports a query tenant the pipeline cannot serve.
+func (r *RAGPipeline) validateTenant(tenant string) error {
+	switch {
+	case !r.tenancy:
+		return nil
+	case tenant == "":
+		return &ValidationError{Field: "Tenant", Reason: "is empty"}
+	case r.tenantPrefixes && !tenantPrefix.MatchString(tenant):
+		return &ValidationError{Field: "Tenant", Reason: fmt.Sprintf("%q is not a valid SpiceDB prefix", tenant)}
+	}
+	return nil
+}
+
+// admitTenant rejects documents without a usable tenant under
+// WithTenancy.
+func (r *RAGPipeline) admitTenant(d Document) error {
+	tenant := d.Metadata[TenantKey]
+	switch {
+	case !r.tenancy:
+		return nil
+	case tenant == "":
+		return fmt.Errorf("%w: %q", ErrNoTenant, d.ID)
+	case r.tenantPrefixes && !tenantPrefix.MatchString(tenant):
+		return fmt.Errorf("rag: document %q: tenant %q is not a valid SpiceDB prefix", d.ID, tenant)
+	}
+	return nil
+}
+
+// ofTenant reports whether d belongs to tenant. Every document does when
+// tenant is empty.
+func ofTenant(d Document, tenant string) bool {
+	return tenant == "" || d.Metadata[TenantKey] == tenant
+}
+
+// tenantDocs returns the documents of docs that belong to tenant.
+func tenantDocs(docs []Document, tenant string) []Document {
+	if tenant == "" {
+		return docs
+	}
+	out := make([]Document, 0, len(docs))
+	for _, d := range docs {
+		if ofTenant(d, tenant) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// tenantCandidates drops the candidates of other tenants, recounting
+// Stats.Candidates so it does not reveal how many there were.
+func tenantCandidates(candidates []ScoredDocument, tenant string, stats *Stats) []ScoredDocument {
+	if tenant == "" {
+		return candidates
+	}
+	candidates = slices.DeleteFunc(candidates, func(d ScoredDocument) bool { return !ofTenant(d.Document, tenant) })
+	stats.Candidates = len(candidates)
+	return candidates
+}
+
+// querySubject returns the subject req is authorized for, in its
+// tenant's definitions under WithTenantPrefixes.
+func (r *RAGPipeline) querySubject(req QueryRequest) *apiv1.SubjectReference {
+	subject := r.subject(req.UserID, req.SubjectType, req.SubjectRelation)
+	if r.tenantPrefixes {
+		subject.Object.ObjectType = req.Tenant + "/" + subject.GetObject().GetObjectType()
+	}
+	return subject
+}
+
+// tenantType returns objectType in tenant's definitions under
+// WithTenantPrefixes, and unchanged otherwise.
+func (r *RAGPipeline) tenantType(tenant, objectType string) string {
+	if !r.tenantPrefixes || tenant == "" {
+		return objectType
+	}
+	return tenant + "/" + objectType
+}
+
+// tenantOf returns the tenant whose definitions res belongs to under
+// WithTenantPrefixes, if any.
+func (r *RAGPipeline) tenantOf(res *apiv1.ObjectReference) string {
+	if !r.tenantPrefixes {
+		return ""
+	}
+	prefix, _, _ := strings.Cut(res.GetObjectType(), "/")
+	if prefix == res.GetObjectType() {
+		return ""
+	}
+	return prefix
+}
+
+// tenantObject returns res in tenant's definitions, checking that an
+// already prefixed res belongs to tenant.
+func tenantObject(res *apiv1.ObjectReference, tenant string) (*apiv1.ObjectReference, error) {
+	if tenant == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoTenant, objectKey(res))
+	}
+	if prefix, _, ok := strings.Cut(res.GetObjectType(), "/"); ok {
+		if prefix != tenant {
+			return nil, fmt.Errorf("rag: %s is outside tenant %q", objectKey(res), tenant)
+		}
+		return res, nil
+	}
+	return &apiv1.ObjectReference{ObjectType: tenant + "/" + res.GetObjectType(), ObjectId: res.GetObjectId()}, nil
+}
@@ -0,0 +1,110 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// tenantDocs returns one report per tenant, plus acme's handbook.
+func tenantDocs() []rag.Document {
+	doc := func(id, tenant, text string) rag.Document {
+		return rag.Document{ID: id, Text: text, Metadata: map[string]string{
+			rag.SpiceDBObjectKey: "document:" + id,
+			rag.TenantKey:        tenant,
+		}}
+	}
+	return []rag.Document{
+		doc("acme-report", "acme", "Quarterly report for acme."),
+		doc("acme-handbook", "acme", "Employee handbook."),
+		doc("globex-report", "globex", "Quarterly report for globex."),
+	}
+}
+
+func TestTenancyIsolatesDocuments(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// Emilia may read both reports, but a query only sees its tenant's.
+	client, _ := newFakeClient("document:acme-report#read@user:emilia", "document:globex-report#read@user:emilia")
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", tenantDocs(),
+			rag.WithTenancy(), rag.WithFilterStrategy(strategy))
+
+		var stats rag.Stats
+		results, err := pipeline.Query(ctx, "emilia", "report", rag.WithTenant("acme"), rag.WithStats(&stats))
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"acme-report"}, results)
+		require.Equal(t, 1, stats.Candidates)
+		require.LessOrEqual(t, stats.DocsScanned, 2, "globex's documents are not scanned")
+		if strategy == rag.FilterPostCheck {
+			require.Equal(t, 1, stats.Checked)
+		}
+
+		results, err = pipeline.Query(rag.WithSubject(ctx, rag.Subject{ID: "emilia", Tenant: "globex"}), "", "report")
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"globex-report"}, results)
+
+		_, err = pipeline.Query(ctx, "emilia", "report")
+		var verr *rag.ValidationError
+		require.ErrorAs(t, err, &verr)
+		require.Equal(t, "Tenant", verr.Field)
+	}
+}
+
+func TestTenancyRejectsDocumentsWithoutTenant(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	docs := append(tenantDocs(), rag.Document{ID: "orphan", Text: "No tenant.", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:orphan"}})
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithTenancy())
+
+	rejected := pipeline.Rejected()
+	require.Len(t, rejected, 1)
+	require.Equal(t, "orphan", rejected[0].ID)
+	require.ErrorIs(t, rejected[0].Err, rag.ErrNoTenant)
+
+	_, err := pipeline.AddDocument(context.Background(), rag.Document{ID: "orphan", Text: "No tenant."})
+	require.ErrorIs(t, err, rag.ErrNoTenant)
+}
+
+func TestTenantPrefixes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	client, fake := newFakeClient("acme/document:acme-report#read@acme/user:emilia", "acme/document:acme-handbook#read@acme/user:*")
+	docs := tenantDocs()
+	// A mapping into another tenant's definitions is never honoured.
+	docs[2].Metadata[rag.SpiceDBObjectKey] = "acme/document:acme-report"
+	pipeline := rag.NewRAGPipeline(client, "document", "read", docs, rag.WithTenantPrefixes())
+
+	for _, strategy := range []rag.FilterStrategy{rag.FilterPostCheck, rag.FilterPrefilter} {
+		pipeline := rag.NewRAGPipeline(client, "document", "read", docs,
+			rag.WithTenantPrefixes(), rag.WithFilterStrategy(strategy))
+		results, err := pipeline.Query(ctx, "emilia", "", rag.WithTenant("acme"))
+		require.NoError(t, err)
+		requireEqualDocIDs(t, []string{"acme-report", "acme-handbook"}, results)
+
+		var stats rag.Stats
+		results, err = pipeline.Query(ctx, "emilia", "report", rag.WithTenant("globex"), rag.WithStats(&stats))
+		require.NoError(t, err)
+		require.Empty(t, results)
+		if strategy == rag.FilterPostCheck {
+			require.Equal(t, 1, stats.Unmapped)
+		}
+	}
+
+	_, err := pipeline.Query(ctx, "emilia", "report", rag.WithTenant("Acme"))
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+
+	_, err = pipeline.GrantAccess(ctx, "acme-handbook", "owner", "acme/user:beatrice")
+	require.NoError(t, err)
+	require.Contains(t, fake.tuples(), "acme/document:acme-handbook#read@acme/user:beatrice")
+
+	subjects, err := pipeline.WhoCanRead(ctx, "acme-report")
+	require.NoError(t, err)
+	require.Equal(t, []rag.Subject{{Type: "user", ID: "emilia", Tenant: "acme"}}, subjects)
+}
@@ -0,0 +1,12 @@
+// Command legacyquery reports legacy RAGPipeline.Query call sites.
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/tools/legacyquery"
+)
+
+func main() {
+	singlechecker.Main(legacyquery.Analyzer)
+}
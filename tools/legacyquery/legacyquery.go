@@ -0,0 +1,64 @@
+// Package legacyquery provides an analyzer that flags calls to the legacy
+// RAGPipeline.Query method and suggests the equivalent Do form:
+//
+//	docs, err := p.Query(ctx, userID, q)
+//
+// becomes
+//
+//	resp, err := p.Do(ctx, rag.MigrateLegacyCall(userID, q))
+//	docs := resp.Documents
+//
+// Run it over a consumer codebase with
+//
+//	go run github.com/sohanmaheshwar/rag-spicedb-testcontainers/tools/legacyquery/cmd/legacyquery ./...
+//
+// or from a //go:generate directive.
+package legacyquery
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const legacyMethod = "(*github.com/sohanmaheshwar/rag-spicedb-testcontainers.RAGPipeline).Query"
+
+// Analyzer reports legacy RAGPipeline.Query call sites.
+var Analyzer = &analysis.Analyzer{
+	Name:     "legacyquery",
+	Doc:      "report calls to the legacy RAGPipeline.Query method and suggest RAGPipeline.Do",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	insp.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+		fn, ok := pass.TypesInfo.Uses[sel.Sel].(*types.Func)
+		if !ok || fn.FullName() != legacyMethod {
+			return
+		}
+
+		if len(call.Args) != 3 || call.Ellipsis.IsValid() {
+			pass.Reportf(call.Pos(),
+				"legacy call to RAGPipeline.Query; use RAGPipeline.Do with a rag.QueryRequest")
+			return
+		}
+
+		pass.Reportf(call.Pos(),
+			"legacy call to RAGPipeline.Query; use %s.Do(%s, rag.MigrateLegacyCall(%s, %s)) and read .Documents",
+			types.ExprString(sel.X), types.ExprString(call.Args[0]),
+			types.ExprString(call.Args[1]), types.ExprString(call.Args[2]))
+	})
+
+	return nil, nil
+}
@@ -0,0 +1,13 @@
+package legacyquery_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/tools/legacyquery"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), legacyquery.Analyzer, "consumer")
+}
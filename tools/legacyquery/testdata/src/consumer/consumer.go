@@ -0,0 +1,20 @@
+package consumer
+
+import (
+	"context"
+
+	rag "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+type searcher struct{ Query func(string) }
+
+func search(ctx context.Context, p *rag.RAGPipeline, user string) {
+	_, _ = p.Query(ctx, user, "roadmap") // want `legacy call to RAGPipeline.Query; use p.Do\(ctx, rag.MigrateLegacyCall\(user, "roadmap"\)\) and read .Documents`
+
+	_, _ = p.Query(ctx, user, "roadmap", nil) // want `legacy call to RAGPipeline.Query; use RAGPipeline.Do with a rag.QueryRequest`
+
+	_, _ = p.Do(ctx, rag.MigrateLegacyCall(user, "roadmap"))
+
+	s := searcher{Query: func(string) {}}
+	s.Query("not the pipeline")
+}
@@ -0,0 +1,26 @@
+// Package rag is a minimal stand-in for the real package.
+package rag
+
+import "context"
+
+type Document struct{ ID string }
+
+type QueryOption func()
+
+type QueryRequest struct{ UserID, Query string }
+
+type QueryResponse struct{ Documents []Document }
+
+type RAGPipeline struct{}
+
+func (r *RAGPipeline) Query(ctx context.Context, userID, query string, opts ...QueryOption) ([]Document, error) {
+	return nil, nil
+}
+
+func (r *RAGPipeline) Do(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	return nil, nil
+}
+
+func MigrateLegacyCall(userID, query string) QueryRequest {
+	return QueryRequest{UserID: userID, Query: query}
+}
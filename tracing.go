@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans recorded by the pipeline.
+const tracerName = "github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+
+// WithTracerProvider records the pipeline's OpenTelemetry spans with tp
+// instead of the global provider (see otel.SetTracerProvider).
+//
+// Every query gets a "rag.query" span with children for retrieval
+// ("rag.retrieve"), authorization ("rag.authorize", with one
+// "rag.check_bulk" per CheckBulkPermissions request) and, for Answer and
+// AnswerStream, generation ("rag.generate"). Their attributes carry the
+// counts from Stats; user IDs and query text are never recorded.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(r *RAGPipeline) {
+		r.tracerProvider = tp
+	}
+}
+
+func (r *RAGPipeline) tracer() trace.Tracer {
+	tp := r.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statsAttributes describes s as span attributes.
+func statsAttributes(s Stats) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("rag.docs_scanned", s.DocsScanned),
+		attribute.Int("rag.candidates", s.Candidates),
+		attribute.Int("rag.accessible", s.Accessible),
+		attribute.Int("rag.unmapped", s.Unmapped),
+		attribute.Int("rag.checked", s.Checked),
+		attribute.Int("rag.allowed", s.Allowed),
+		attribute.Int("rag.denied", s.Denied),
+		attribute.Int("rag.conditional", s.Conditional),
+		attribute.Int("rag.rechecked", s.Rechecked),
+		attribute.Int("rag.shadowed", s.Shadowed),
+		attribute.Int("rag.reranked", s.Reranked),
+		attribute.Bool("rag.budget_exceeded", s.BudgetExceeded),
+		attribute.String("rag.plan", s.Plan.String()),
+	}
+}
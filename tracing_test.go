@@ -0,0 +1,109 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func newRecorder() (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	rec := tracetest.NewSpanRecorder()
+	return rec, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+}
+
+// spanAttrs returns the ended spans by name with their attributes.
+func spanAttrs(rec *tracetest.SpanRecorder) map[string][]map[attribute.Key]attribute.Value {
+	out := make(map[string][]map[attribute.Key]attribute.Value)
+	for _, s := range rec.Ended() {
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, kv := range s.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		out[s.Name()] = append(out[s.Name()], attrs)
+	}
+	return out
+}
+
+func TestTracingQuery(t *testing.T) {
+	t.Parallel()
+
+	rec, tp := newRecorder()
+	client, _ := newFakeClient("document:doc1#read@user:emilia", "document:doc3#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithBulkCheckChunkSize(1), rag.WithTracerProvider(tp))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "o")
+	require.NoError(t, err)
+
+	spans := spanAttrs(rec)
+	require.Len(t, spans["rag.query"], 1)
+	query := spans["rag.query"][0]
+	require.Equal(t, int64(3), query["rag.candidates"].AsInt64())
+	require.Equal(t, int64(2), query["rag.allowed"].AsInt64())
+	require.Equal(t, int64(1), query["rag.denied"].AsInt64())
+	require.Equal(t, int64(2), query["rag.returned"].AsInt64())
+
+	require.Equal(t, int64(3), spans["rag.retrieve"][0]["rag.candidates"].AsInt64())
+	require.Equal(t, int64(3), spans["rag.authorize"][0]["rag.checked"].AsInt64())
+
+	// One span per CheckBulkPermissions request, each with its latency.
+	require.Len(t, spans["rag.check_bulk"], 3)
+	for _, batch := range spans["rag.check_bulk"] {
+		require.Equal(t, int64(1), batch["rag.batch_size"].AsInt64())
+		require.Contains(t, batch, attribute.Key("rag.spicedb.latency_ms"))
+	}
+
+	// Spans are nested under the query.
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		byName[s.Name()] = s
+	}
+	require.Equal(t, byName["rag.query"].SpanContext().SpanID(), byName["rag.authorize"].Parent().SpanID())
+	require.Equal(t, byName["rag.authorize"].SpanContext().SpanID(), byName["rag.check_bulk"].Parent().SpanID())
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	t.Parallel()
+
+	rec, tp := newRecorder()
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(), rag.WithTracerProvider(tp))
+
+	_, err := pipeline.Query(context.Background(), "", "o")
+	require.ErrorIs(t, err, rag.ErrInvalidRequest)
+
+	ended := rec.Ended()
+	require.Len(t, ended, 1)
+	require.Equal(t, codes.Error, ended[0].Status().Code)
+}
+
+func TestTracingGenerate(t *testing.T) {
+	t.Parallel()
+
+	rec, tp := newRecorder()
+	client, _ := newFakeClient("document:doc1#read@user:emilia")
+	gen := &recordingGenerator{err: errors.New("model overloaded")}
+	pipeline := rag.NewRAGPipeline(client, "document", "read", scenarioDocs(),
+		rag.WithGenerator(gen), rag.WithTracerProvider(tp))
+
+	_, err := pipeline.Answer(context.Background(), "emilia", "roadmap")
+	require.Error(t, err)
+
+	var generate sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.Name() == "rag.generate" {
+			generate = s
+		}
+	}
+	require.NotNil(t, generate)
+	require.Equal(t, codes.Error, generate.Status().Code)
+	require.Contains(t, generate.Attributes(), attribute.Int("rag.sources", 1))
+}
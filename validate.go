@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// SpiceDB's object type syntax, optionally prefixed by namespaces.
+var objectType = regexp.MustCompile(`^([a-z][a-z0-9_]{1,61}[a-z0-9]/)*[a-z][a-z0-9_]{1,62}[a-z0-9]$`)
+
+// UnmappedDocument reports a document without a valid SpiceDB object.
+// Err wraps ErrNoResourceMapping, ErrInvalidSpiceDBObject or the error of
+// a custom ResourceMapper.
+type UnmappedDocument struct {
+	ID  string
+	Err error
+}
+
+// WithStrictMapping rejects documents without a valid SpiceDB object at
+// ingestion, instead of admitting them and skipping them at query time
+// (counted in Stats.Unmapped). Rejected documents are listed by Rejected,
+// and AddDocuments and UpdateDocument fail for them.
+func WithStrictMapping() Option {
+	return func(r *RAGPipeline) {
+		r.strictMapping = true
+	}
+}
+
+// ValidateMapping reports why d has no valid SpiceDB object under the
+// pipeline's ResourceMapper, or nil if it has one. Besides the "type:id"
+// form it checks SpiceDB's syntax for object types and IDs, which
+// SpiceDB would otherwise reject at query time, failing the query.
+//
+// Applications feeding a DocumentStore can call it before Add, since the
+// pipeline never sees those documents until they are retrieved.
+func (r *RAGPipeline) ValidateMapping(d Document) error {
+	res, err := r.resourceFor(d)
+	if err != nil {
+		return err
+	}
+	if !objectType.MatchString(res.GetObjectType()) {
+		return fmt.Errorf("%w: %q: malformed object type", ErrInvalidSpiceDBObject, objectKey(res))
+	}
+	if len(res.GetObjectId()) > 1024 || !subjectID.MatchString(res.GetObjectId()) {
+		return fmt.Errorf("%w: %q: malformed object ID", ErrInvalidSpiceDBObject, objectKey(res))
+	}
+	return nil
+}
+
+// UnmappedDocuments lists the documents in the corpus that have no valid
+// SpiceDB object and so are never returned, in corpus order. Under
+// WithStrictMapping it is always empty.
+func (r *RAGPipeline) UnmappedDocuments() []UnmappedDocument {
+	var out []UnmappedDocument
+	for _, d := range r.snapshot() {
+		if err := r.ValidateMapping(d); err != nil {
+			out = append(out, UnmappedDocument{ID: d.ID, Err: err})
+		}
+	}
+	return out
+}
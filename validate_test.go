@@ -0,0 +1,82 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func mappingDocs() []rag.Document {
+	doc := func(id, object string) rag.Document {
+		d := rag.Document{ID: id, Text: "faq " + id}
+		if object != "" {
+			d.Metadata = map[string]string{rag.SpiceDBObjectKey: object}
+		}
+		return d
+	}
+	return []rag.Document{
+		doc("ok", "document:ok"),
+		doc("missing", ""),
+		doc("no-colon", "document-ok"),
+		doc("bad-type", "Document:x"),
+		doc("bad-id", "document:has space"),
+		doc("nested", "tenant1/document:x"),
+	}
+}
+
+func TestUnmappedDocumentsReport(t *testing.T) {
+	t.Parallel()
+
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", mappingDocs())
+	require.Empty(t, pipeline.Rejected())
+
+	unmapped := pipeline.UnmappedDocuments()
+	ids := make([]string, len(unmapped))
+	for i, u := range unmapped {
+		ids[i] = u.ID
+	}
+	require.Equal(t, []string{"missing", "no-colon", "bad-type", "bad-id"}, ids)
+	require.ErrorIs(t, unmapped[0].Err, rag.ErrNoResourceMapping)
+	for _, u := range unmapped[1:] {
+		require.ErrorIs(t, u.Err, rag.ErrInvalidSpiceDBObject, u.ID)
+	}
+	require.ErrorContains(t, unmapped[3].Err, "malformed object ID")
+}
+
+func TestStrictMapping(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient("document:ok#read@user:emilia", "tenant1/document:x#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", mappingDocs(), rag.WithStrictMapping())
+
+	rejected := pipeline.Rejected()
+	require.Len(t, rejected, 4)
+	require.Equal(t, "missing", rejected[0].ID)
+	require.ErrorIs(t, rejected[0].Err, rag.ErrNoResourceMapping)
+	require.Empty(t, pipeline.UnmappedDocuments())
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "faq", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"ok", "nested"}, results)
+	require.Zero(t, stats.Unmapped)
+
+	err = pipeline.AddDocuments(rag.Document{ID: "new", Text: "faq"})
+	require.ErrorIs(t, err, rag.ErrNoResourceMapping)
+	err = pipeline.UpdateDocument(rag.Document{ID: "ok", Text: "faq", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:"}})
+	require.ErrorIs(t, err, rag.ErrInvalidSpiceDBObject)
+}
+
+func TestValidateMappingUsesMapper(t *testing.T) {
+	t.Parallel()
+
+	mapper, err := rag.NewTemplateMapper("document:{{.ID}}")
+	require.NoError(t, err)
+	pipeline := rag.NewRAGPipeline(nil, "document", "read", nil, rag.WithResourceMapper(mapper))
+
+	require.NoError(t, pipeline.ValidateMapping(rag.Document{ID: "doc1"}))
+	require.ErrorIs(t, pipeline.ValidateMapping(rag.Document{ID: "doc 1"}), rag.ErrInvalidSpiceDBObject)
+}
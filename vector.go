@@ -0,0 +1,187 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// ErrEmbeddingMismatch is returned when an Embedder returns the wrong
+// number of vectors or vectors of inconsistent dimension.
+var ErrEmbeddingMismatch = errors.New("rag: embedder returned mismatched vectors")
+
+// Embedder turns texts into vectors. It is the only model dependency of
+// VectorRetriever, so any embedding API can be plugged in.
+type Embedder interface {
+	// Embed returns one vector per text, in order. All vectors must have
+	// the same dimension.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// VectorRetriever is a Retriever that ranks documents by the cosine
+// similarity of their embedding to the query's. Documents are embedded
+// once, when they are added.
+type VectorRetriever struct {
+	embedder Embedder
+
+	mu      sync.RWMutex
+	docs    []Document
+	vectors [][]float32
+	dim     int
+}
+
+// NewVectorRetriever embeds docs with embedder and returns a retriever
+// over them.
+func NewVectorRetriever(ctx context.Context, embedder Embedder, docs []Document) (*VectorRetriever, error) {
+	v := &VectorRetriever{embedder: embedder}
+	if err := v.Add(ctx, docs...); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Add embeds docs and makes them retrievable, replacing documents with
+// the same ID. Nothing is added if embedding fails.
+func (v *VectorRetriever) Add(ctx context.Context, docs ...Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Text
+	}
+	vectors, err := v.embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("rag: embedding documents: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.dim == 0 {
+		v.dim = len(vectors[0])
+	}
+	if len(vectors[0]) != v.dim {
+		return fmt.Errorf("%w: dimension %d, want %d", ErrEmbeddingMismatch, len(vectors[0]), v.dim)
+	}
+	index := make(map[string]int, len(v.docs))
+	for i, d := range v.docs {
+		index[d.ID] = i
+	}
+	for i, d := range docs {
+		if j, ok := index[d.ID]; ok {
+			v.docs[j], v.vectors[j] = d, vectors[i]
+			continue
+		}
+		index[d.ID] = len(v.docs)
+		v.docs = append(v.docs, d)
+		v.vectors = append(v.vectors, vectors[i])
+	}
+	return nil
+}
+
+// Remove implements DocumentStore.
+func (v *VectorRetriever) Remove(_ context.Context, ids ...string) error {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	docs, vectors := v.docs[:0], v.vectors[:0]
+	for i, d := range v.docs {
+		if !drop[d.ID] {
+			docs = append(docs, d)
+			vectors = append(vectors, v.vectors[i])
+		}
+	}
+	clear(v.docs[len(docs):])
+	clear(v.vectors[len(vectors):])
+	v.docs, v.vectors = docs, vectors
+	return nil
+}
+
+// Retrieve implements Retriever. It returns the limit documents most
+// similar to query, best first; documents with no positive similarity are
+// never returned.
+func (v *VectorRetriever) Retrieve(ctx context.Context, query string, limit int) ([]Document, error) {
+	scored, err := v.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return documentsOf(scored), nil
+}
+
+// RetrieveScored implements ScoredRetriever; the score is the cosine
+// similarity.
+func (v *VectorRetriever) RetrieveScored(ctx context.Context, query string, limit int) ([]ScoredDocument, error) {
+	vectors, err := v.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("rag: embedding query: %w", err)
+	}
+	q := vectors[0]
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.dim != 0 && len(q) != v.dim {
+		return nil, fmt.Errorf("%w: query dimension %d, want %d", ErrEmbeddingMismatch, len(q), v.dim)
+	}
+
+	type hit struct {
+		i     int
+		score float64
+	}
+	var hits []hit
+	for i, vec := range v.vectors {
+		if s := cosine(q, vec); s > 0 {
+			hits = append(hits, hit{i, s})
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	docs := make([]ScoredDocument, len(hits))
+	for i, h := range hits {
+		docs[i] = ScoredDocument{Document: v.docs[h.i], Score: h.score}
+	}
+	return docs, nil
+}
+
+// embed calls the embedder and checks the shape of its answer.
+func (v *VectorRetriever) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := v.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	for _, vec := range vectors {
+		if len(vec) == 0 || len(vec) != len(vectors[0]) {
+			return nil, fmt.Errorf("%w: inconsistent dimensions", ErrEmbeddingMismatch)
+		}
+	}
+	return vectors, nil
+}
+
+// cosine returns the cosine similarity of a and b, or 0 if either is the
+// zero vector.
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
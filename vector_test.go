@@ -0,0 +1,138 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// vocabEmbedder embeds text as a bag of words over a fixed vocabulary.
+type vocabEmbedder struct {
+	vocab []string
+	calls int
+	err   error
+}
+
+func (e *vocabEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, len(e.vocab))
+		for j, word := range e.vocab {
+			for _, term := range splitWords(text) {
+				if term == word {
+					vec[j]++
+				}
+			}
+		}
+		out[i] = vec
+	}
+	return out, nil
+}
+
+func splitWords(text string) []string {
+	var words []string
+	start := -1
+	for i, c := range text + " " {
+		if c >= 'a' && c <= 'z' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, text[start:i])
+			start = -1
+		}
+	}
+	return words
+}
+
+func vectorDocs() []rag.Document {
+	return []rag.Document{
+		{ID: "pets", Text: "cats and dogs", Metadata: map[string]string{"spicedb_object": "document:pets"}},
+		{ID: "cats", Text: "cats cats cats", Metadata: map[string]string{"spicedb_object": "document:cats"}},
+		{ID: "money", Text: "budget forecast", Metadata: map[string]string{"spicedb_object": "document:money"}},
+	}
+}
+
+func TestVectorRetrieverRanksBySimilarity(t *testing.T) {
+	t.Parallel()
+
+	embedder := &vocabEmbedder{vocab: []string{"cats", "dogs", "budget", "forecast"}}
+	rt, err := rag.NewVectorRetriever(context.Background(), embedder, vectorDocs())
+	require.NoError(t, err)
+	require.Equal(t, 1, embedder.calls)
+
+	docs, err := rt.Retrieve(context.Background(), "cats", 0)
+	require.NoError(t, err)
+	require.Equal(t, "cats", docs[0].ID)
+	requireEqualDocIDs(t, []string{"cats", "pets"}, docs)
+
+	docs, err = rt.Retrieve(context.Background(), "cats", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "cats", docs[0].ID)
+}
+
+func TestVectorRetrieverFiltersTopKByPermission(t *testing.T) {
+	t.Parallel()
+
+	embedder := &vocabEmbedder{vocab: []string{"cats", "dogs", "budget", "forecast"}}
+	rt, err := rag.NewVectorRetriever(context.Background(), embedder, vectorDocs())
+	require.NoError(t, err)
+
+	client, _ := newFakeClient("document:pets#read@user:emilia", "document:money#read@user:emilia")
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil, rag.WithRetriever(rt))
+
+	var stats rag.Stats
+	results, err := pipeline.Query(context.Background(), "emilia", "cats", rag.WithStats(&stats))
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"pets"}, results)
+	require.Equal(t, 2, stats.Checked)
+}
+
+func TestVectorRetrieverEmbedderErrors(t *testing.T) {
+	t.Parallel()
+
+	errModel := errors.New("model offline")
+	_, err := rag.NewVectorRetriever(context.Background(), &vocabEmbedder{err: errModel}, vectorDocs())
+	require.ErrorIs(t, err, errModel)
+
+	embedder := &vocabEmbedder{vocab: []string{"cats"}}
+	rt, err := rag.NewVectorRetriever(context.Background(), embedder, vectorDocs())
+	require.NoError(t, err)
+
+	embedder.vocab = append(embedder.vocab, "dogs")
+	err = rt.Add(context.Background(), rag.Document{ID: "x", Text: "dogs"})
+	require.ErrorIs(t, err, rag.ErrEmbeddingMismatch)
+	_, err = rt.Retrieve(context.Background(), "dogs", 0)
+	require.ErrorIs(t, err, rag.ErrEmbeddingMismatch)
+}
+
+func TestVectorRetrieverIsADocumentStore(t *testing.T) {
+	t.Parallel()
+
+	var store rag.DocumentStore
+	v, err := rag.NewVectorRetriever(context.Background(), &vocabEmbedder{vocab: []string{"cats", "dogs"}}, vectorDocs())
+	require.NoError(t, err)
+	store = v
+
+	require.NoError(t, store.Add(context.Background(), rag.Document{ID: "pets", Text: "dogs"}))
+	require.NoError(t, store.Remove(context.Background(), "missing"))
+	docs, err := store.Retrieve(context.Background(), "cats", 0)
+	require.NoError(t, err)
+	requireEqualDocIDs(t, []string{"cats"}, docs)
+
+	require.NoError(t, store.Remove(context.Background(), "pets"))
+	docs, err = store.Retrieve(context.Background(), "dogs", 0)
+	require.NoError(t, err)
+	require.Empty(t, docs)
+}
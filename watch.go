@@ -0,0 +1,128 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	authzed "github.com/authzed/authzed-go/v1"
+)
+
+// ErrNoCheckCache is returned by WatchCache when the pipeline has no
+// CachingChecker.
+var ErrNoCheckCache = errors.New("rag: pipeline has no check cache")
+
+// minWatchBackoff and maxWatchBackoff bound the delay between Watch
+// reconnection attempts.
+const (
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = 5 * time.Second
+)
+
+// InvalidateResource drops every cached decision about resource.
+func (c *CachingChecker) InvalidateResource(resource *apiv1.ObjectReference) {
+	prefix := objectKey(resource) + "#"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, dc := range c.caches() {
+		for key, el := range dc.items {
+			if strings.HasPrefix(key, prefix) {
+				dc.lru.Remove(el)
+				delete(dc.items, key)
+			}
+		}
+	}
+}
+
+// Watch follows SpiceDB's Watch stream on client and invalidates cached
+// decisions as relationships change, until ctx is done. This keeps the
+// cache safe to use with long TTLs.
+//
+// A change to a relationship on an object of one of directTypes only
+// invalidates decisions about that object. List a type there only if its
+// permissions never depend on relationships of other objects of the same
+// type; a document whose read permission follows a parent folder is fine,
+// one that follows a parent document is not. Any other change, including
+// a schema change, may affect permissions anywhere and purges the whole
+// cache.
+//
+// If the stream fails, the cache is purged, since changes may have been
+// missed, and the watch resumes from the last revision seen.
+func (c *CachingChecker) Watch(ctx context.Context, client *authzed.Client, directTypes ...string) error {
+	direct := make(map[string]bool, len(directTypes))
+	for _, t := range directTypes {
+		direct[t] = true
+	}
+
+	var cursor *apiv1.ZedToken
+	backoff := minWatchBackoff
+	for {
+		if c.follow(ctx, client, direct, &cursor) {
+			// The stream worked until it broke, so this is a new
+			// failure rather than the same one repeating.
+			backoff = minWatchBackoff
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.Purge()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxWatchBackoff)
+	}
+}
+
+// follow consumes one Watch stream until it ends, recording progress in
+// cursor. It reports whether the stream delivered any response.
+func (c *CachingChecker) follow(ctx context.Context, client *authzed.Client, direct map[string]bool, cursor **apiv1.ZedToken) bool {
+	stream, err := client.Watch(ctx, &apiv1.WatchRequest{OptionalStartCursor: *cursor})
+	if err != nil {
+		return false
+	}
+	for received := false; ; received = true {
+		resp, err := stream.Recv()
+		if err != nil {
+			return received
+		}
+		c.apply(resp, direct)
+		if token := resp.GetChangesThrough(); token != nil {
+			*cursor = token
+		}
+	}
+}
+
+// apply invalidates the decisions affected by one Watch response.
+func (c *CachingChecker) apply(resp *apiv1.WatchResponse, direct map[string]bool) {
+	if resp.GetSchemaUpdated() {
+		c.Purge()
+		return
+	}
+	for _, u := range resp.GetUpdates() {
+		res := u.GetRelationship().GetResource()
+		if !direct[res.GetObjectType()] {
+			c.Purge()
+			return
+		}
+		c.InvalidateResource(res)
+	}
+}
+
+// WatchCache runs the pipeline's check cache's Watch (see
+// CachingChecker.Watch) against the pipeline's SpiceDB client until ctx
+// is done. It returns ErrNoCheckCache unless WithCheckCache was used or
+// the configured checker is a CachingChecker.
+func (r *RAGPipeline) WatchCache(ctx context.Context, directTypes ...string) error {
+	cache, ok := r.checker.(*CachingChecker)
+	if !ok {
+		return ErrNoCheckCache
+	}
+	return cache.Watch(ctx, r.spiceClient, directTypes...)
+}
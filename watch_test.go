@@ -0,0 +1,118 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+func touch(resource string) *apiv1.RelationshipUpdate {
+	res, err := rag.ParseObjectReference(resource)
+	if err != nil {
+		panic(err)
+	}
+	return &apiv1.RelationshipUpdate{
+		Operation: apiv1.RelationshipUpdate_OPERATION_TOUCH,
+		Relationship: &apiv1.Relationship{
+			Resource: res,
+			Relation: "viewer",
+			Subject:  &apiv1.SubjectReference{Object: &apiv1.ObjectReference{ObjectType: "user", ObjectId: "emilia"}},
+		},
+	}
+}
+
+// watchedCache primes a cache with decisions about doc0..doc4 and starts
+// watching the fake's Watch stream.
+func watchedCache(t *testing.T, directTypes ...string) (*rag.CachingChecker, *fakeSpiceDB, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	client, fake := newFakeClient()
+	fake.watch = make(chan *apiv1.WatchResponse)
+	checker := rag.NewCachingChecker(rag.NewSpiceDBChecker(client), time.Hour, 100)
+	pipeline := rag.NewRAGPipeline(client, "document", "read", syntheticCorpus(5), rag.WithPermissionChecker(checker))
+
+	_, err := pipeline.Query(context.Background(), "emilia", "synthetic")
+	require.NoError(t, err)
+	require.Equal(t, 5, checker.Stats().Entries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- pipeline.WatchCache(ctx, directTypes...) }()
+	t.Cleanup(cancel)
+	return checker, fake, cancel, done
+}
+
+func requireEntries(t *testing.T, checker *rag.CachingChecker, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return checker.Stats().Entries == n }, time.Second, time.Millisecond)
+}
+
+func TestWatchInvalidatesDirectResource(t *testing.T) {
+	t.Parallel()
+
+	checker, fake, cancel, done := watchedCache(t, "document")
+
+	fake.watch <- &apiv1.WatchResponse{Updates: []*apiv1.RelationshipUpdate{touch("document:doc1")}}
+	requireEntries(t, checker, 4)
+
+	// Group membership can change any document's permissions.
+	fake.watch <- &apiv1.WatchResponse{Updates: []*apiv1.RelationshipUpdate{touch("group:eng")}}
+	requireEntries(t, checker, 0)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestWatchPurgesWithoutDirectTypes(t *testing.T) {
+	t.Parallel()
+
+	checker, fake, _, _ := watchedCache(t)
+
+	fake.watch <- &apiv1.WatchResponse{Updates: []*apiv1.RelationshipUpdate{touch("document:doc1")}}
+	requireEntries(t, checker, 0)
+}
+
+func TestWatchPurgesOnSchemaChange(t *testing.T) {
+	t.Parallel()
+
+	checker, fake, _, _ := watchedCache(t, "document")
+
+	fake.watch <- &apiv1.WatchResponse{SchemaUpdated: true}
+	requireEntries(t, checker, 0)
+}
+
+func TestWatchResumesAfterStreamEnds(t *testing.T) {
+	t.Parallel()
+
+	checker, fake, _, _ := watchedCache(t, "document")
+
+	cursor := &apiv1.ZedToken{Token: "rev-7"}
+	fake.watch <- &apiv1.WatchResponse{ChangesThrough: cursor}
+
+	fake.mu.Lock()
+	close(fake.watch)
+	fake.watch = make(chan *apiv1.WatchResponse)
+	fake.mu.Unlock()
+
+	// Changes may have been missed while disconnected.
+	requireEntries(t, checker, 0)
+	require.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		last := fake.watchCursors[len(fake.watchCursors)-1]
+		return last.GetToken() == "rev-7"
+	}, 2*time.Second, time.Millisecond)
+}
+
+func TestWatchCacheRequiresCache(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newFakeClient()
+	pipeline := rag.NewRAGPipeline(client, "document", "read", nil)
+	require.ErrorIs(t, pipeline.WatchCache(context.Background()), rag.ErrNoCheckCache)
+}
@@ -0,0 +1,418 @@
+// Package weaviate is a rag.DocumentStore backed by a Weaviate class,
+// talking to Weaviate's REST and GraphQL APIs. It bootstraps the class
+// schema, ingests documents in batches with their own embeddings, and maps
+// document metadata onto class properties. Package weaviatetest starts
+// Weaviate in a container.
+package weaviate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+)
+
+// DefaultBatchSize is the number of objects sent per batch request.
+const DefaultBatchSize = 100
+
+// MaxSearchLimit is the number of objects requested when a search has no
+// limit.
+const MaxSearchLimit = 10000
+
+// ErrInvalidClass is returned by New for a class or property name
+// Weaviate would reject.
+var ErrInvalidClass = errors.New("weaviate: invalid class or property name")
+
+var (
+	className    = regexp.MustCompile(`^[A-Z][A-Za-z0-9_]*$`)
+	propertyName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+)
+
+// Built-in properties of the class.
+const (
+	propDocID    = "docId"
+	propText     = "text"
+	propMetadata = "metadata" // the whole metadata map, as JSON
+	propObject   = "spicedbObject"
+)
+
+// APIError is a non-2xx response, or a GraphQL or batch error, from
+// Weaviate.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return "weaviate: " + e.Message
+	}
+	return fmt.Sprintf("weaviate: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Store is a rag.DocumentStore, rag.ScoredRetriever and
+// rag.FilteringRetriever over one Weaviate class, ranking by cosine
+// similarity of the vectors it supplies itself (the class uses no
+// vectorizer module).
+type Store struct {
+	baseURL    string
+	class      string
+	embedder   rag.Embedder
+	apiKey     string
+	batchSize  int
+	properties map[string]string // metadata key -> property
+	httpClient *http.Client
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithAPIKey sets the API key sent as a bearer token.
+func WithAPIKey(key string) Option {
+	return func(s *Store) {
+		s.apiKey = key
+	}
+}
+
+// WithBatchSize overrides DefaultBatchSize.
+func WithBatchSize(n int) Option {
+	return func(s *Store) {
+		s.batchSize = n
+	}
+}
+
+// WithMetadataProperty stores the metadata value under key as its own
+// text property, so it can be used in Weaviate filters and queries
+// outside the pipeline. All metadata is also kept as JSON in the
+// "metadata" property, which is what documents are read back from.
+func WithMetadataProperty(key, property string) Option {
+	return func(s *Store) {
+		s.properties[key] = property
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(s *Store) {
+		s.httpClient = hc
+	}
+}
+
+// New returns a Store on class (e.g. "Document") of the Weaviate server
+// at baseURL (e.g. "http://localhost:8080"), embedding text with
+// embedder. Call Migrate once to create the class.
+func New(baseURL, class string, embedder rag.Embedder, opts ...Option) (*Store, error) {
+	s := &Store{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		class:      class,
+		embedder:   embedder,
+		batchSize:  DefaultBatchSize,
+		properties: make(map[string]string),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !className.MatchString(class) {
+		return nil, fmt.Errorf("%w: class %q", ErrInvalidClass, class)
+	}
+	for _, p := range s.properties {
+		if !propertyName.MatchString(p) || p == propDocID || p == propText || p == propMetadata || p == propObject {
+			return nil, fmt.Errorf("%w: property %q", ErrInvalidClass, p)
+		}
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = DefaultBatchSize
+	}
+	return s, nil
+}
+
+// Migrate creates the class if it does not exist yet.
+func (s *Store) Migrate(ctx context.Context) error {
+	err := s.call(ctx, http.MethodGet, "/v1/schema/"+url.PathEscape(s.class), nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	props := []map[string]any{
+		{"name": propDocID, "dataType": []string{"text"}, "tokenization": "field"},
+		{"name": propText, "dataType": []string{"text"}},
+		{"name": propMetadata, "dataType": []string{"text"}, "indexFilterable": false, "indexSearchable": false},
+		{"name": propObject, "dataType": []string{"text"}, "tokenization": "field"},
+	}
+	for _, p := range sortedValues(s.properties) {
+		props = append(props, map[string]any{"name": p, "dataType": []string{"text"}, "tokenization": "field"})
+	}
+	class := map[string]any{
+		"class":             s.class,
+		"vectorizer":        "none",
+		"vectorIndexConfig": map[string]any{"distance": "cosine"},
+		"properties":        props,
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/schema", class, nil); err != nil {
+		return fmt.Errorf("weaviate: creating class: %w", err)
+	}
+	return nil
+}
+
+// Add implements rag.DocumentStore, sending documents in batches. A
+// failed batch is reported, but batches sent before it stay stored.
+func (s *Store) Add(ctx context.Context, docs ...rag.Document) error {
+	for start := 0; start < len(docs); start += s.batchSize {
+		if err := s.addBatch(ctx, docs[start:min(start+s.batchSize, len(docs))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) addBatch(ctx context.Context, docs []rag.Document) error {
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.Text
+	}
+	vectors, err := s.embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("weaviate: embedding documents: %w", err)
+	}
+
+	objects := make([]map[string]any, len(docs))
+	for i, d := range docs {
+		metadata, err := json.Marshal(d.Metadata)
+		if err != nil {
+			return fmt.Errorf("weaviate: encoding metadata of %q: %w", d.ID, err)
+		}
+		props := map[string]any{
+			propDocID:    d.ID,
+			propText:     d.Text,
+			propMetadata: string(metadata),
+			propObject:   d.Metadata[rag.SpiceDBObjectKey],
+		}
+		for key, p := range s.properties {
+			if v, ok := d.Metadata[key]; ok {
+				props[p] = v
+			}
+		}
+		objects[i] = map[string]any{
+			"class":      s.class,
+			"id":         objectID(d.ID),
+			"properties": props,
+			"vector":     vectors[i],
+		}
+	}
+
+	var results []struct {
+		ID     string `json:"id"`
+		Result struct {
+			Errors *struct {
+				Error []struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			} `json:"errors"`
+		} `json:"result"`
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/batch/objects", map[string]any{"objects": objects}, &results); err != nil {
+		return fmt.Errorf("weaviate: storing documents: %w", err)
+	}
+	var msgs []string
+	for _, r := range results {
+		if r.Result.Errors == nil {
+			continue
+		}
+		for _, e := range r.Result.Errors.Error {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("weaviate: storing documents: %w", &APIError{Message: strings.Join(msgs, "; ")})
+	}
+	return nil
+}
+
+// Remove implements rag.DocumentStore.
+func (s *Store) Remove(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		err := s.call(ctx, http.MethodDelete, "/v1/objects/"+url.PathEscape(s.class)+"/"+objectID(id), nil, nil)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("weaviate: removing %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Retrieve implements rag.Retriever.
+func (s *Store) Retrieve(ctx context.Context, query string, limit int) ([]rag.Document, error) {
+	scored, err := s.RetrieveScored(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]rag.Document, len(scored))
+	for i, d := range scored {
+		docs[i] = d.Document
+	}
+	return docs, nil
+}
+
+// RetrieveScored implements rag.ScoredRetriever; the score is the cosine
+// similarity, 1 minus Weaviate's cosine distance.
+func (s *Store) RetrieveScored(ctx context.Context, query string, limit int) ([]rag.ScoredDocument, error) {
+	return s.search(ctx, query, limit, nil)
+}
+
+// RetrieveAccessible implements rag.FilteringRetriever with a where
+// filter on the documents' SpiceDB object.
+func (s *Store) RetrieveAccessible(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	return s.search(ctx, query, limit, objects)
+}
+
+func (s *Store) search(ctx context.Context, query string, limit int, objects []string) ([]rag.ScoredDocument, error) {
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("weaviate: embedding query: %w", err)
+	}
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	vector, _ := json.Marshal(vectors[0])
+	args := fmt.Sprintf("nearVector: {vector: %s}, limit: %d", vector, limit)
+	if objects != nil {
+		values, _ := json.Marshal(objects)
+		args += fmt.Sprintf(", where: {path: [%q], operator: ContainsAny, valueText: %s}", propObject, values)
+	}
+	gql := fmt.Sprintf("{ Get { %s(%s) { %s %s %s _additional { distance } } } }",
+		s.class, args, propDocID, propText, propMetadata)
+
+	var resp struct {
+		Data struct {
+			Get map[string][]struct {
+				DocID      string `json:"docId"`
+				Text       string `json:"text"`
+				Metadata   string `json:"metadata"`
+				Additional struct {
+					Distance float64 `json:"distance"`
+				} `json:"_additional"`
+			} `json:"Get"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/graphql", map[string]any{"query": gql}, &resp); err != nil {
+		return nil, fmt.Errorf("weaviate: searching: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return nil, fmt.Errorf("weaviate: searching: %w", &APIError{Message: resp.Errors[0].Message})
+	}
+
+	hits := resp.Data.Get[s.class]
+	out := make([]rag.ScoredDocument, len(hits))
+	for i, hit := range hits {
+		d := rag.Document{ID: hit.DocID, Text: hit.Text}
+		if hit.Metadata != "" && hit.Metadata != "null" {
+			if err := json.Unmarshal([]byte(hit.Metadata), &d.Metadata); err != nil {
+				return nil, fmt.Errorf("weaviate: decoding metadata of %q: %w", hit.DocID, err)
+			}
+		}
+		out[i] = rag.ScoredDocument{Document: d, Score: 1 - hit.Additional.Distance}
+	}
+	return out, nil
+}
+
+// embed calls the embedder and checks it returned one vector per text.
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d vectors for %d texts", rag.ErrEmbeddingMismatch, len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// call sends body, if any, as JSON and decodes the response into out, if
+// not nil.
+func (s *Store) call(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		r = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(raw))
+		var e struct {
+			Error []struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(raw, &e) == nil && len(e.Error) > 0 {
+			msg = e.Error[0].Message
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// objectID derives a stable UUID from a document ID, since Weaviate
+// object IDs must be UUIDs.
+func objectID(docID string) string {
+	h := sha1.Sum([]byte(docID))
+	h[6] = h[6]&0x0f | 0x50 // version 5
+	h[8] = h[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+func sortedValues(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,190 @@
+package weaviate_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers"
+	"github.com/sohanmaheshwar/rag-spicedb-testcontainers/weaviate"
+)
+
+var (
+	_ rag.DocumentStore      = (*weaviate.Store)(nil)
+	_ rag.FilteringRetriever = (*weaviate.Store)(nil)
+)
+
+// fakeWeaviate records schema, batch, delete and GraphQL requests for the
+// class "Document" and answers searches with hits.
+type fakeWeaviate struct {
+	mu      sync.Mutex
+	classes []map[string]any
+	batches [][]map[string]any
+	deleted []string
+	queries []string
+	hits    []map[string]any
+	failID  string
+}
+
+func newFakeWeaviate(t *testing.T) (*fakeWeaviate, string) {
+	t.Helper()
+	f := &fakeWeaviate{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/schema/Document", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.classes) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.classes[0])
+	})
+	mux.HandleFunc("POST /v1/schema", func(w http.ResponseWriter, r *http.Request) {
+		var class map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&class)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.classes = append(f.classes, class)
+		_ = json.NewEncoder(w).Encode(class)
+	})
+	mux.HandleFunc("POST /v1/batch/objects", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Objects []map[string]any `json:"objects"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.batches = append(f.batches, req.Objects)
+		results := make([]map[string]any, len(req.Objects))
+		for i, o := range req.Objects {
+			results[i] = map[string]any{"id": o["id"], "result": map[string]any{}}
+			if props := o["properties"].(map[string]any); props["docId"] == f.failID {
+				results[i]["result"] = map[string]any{"errors": map[string]any{"error": []any{map[string]any{"message": "vector lengths don't match"}}}}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(results)
+	})
+	mux.HandleFunc("DELETE /v1/objects/Document/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.deleted = append(f.deleted, r.PathValue("id"))
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /v1/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string `json:"query"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.queries = append(f.queries, req.Query)
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"Get": map[string]any{"Document": f.hits}}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+// pairEmbedder embeds every text as {len(text), 1}.
+type pairEmbedder struct{}
+
+func (pairEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = []float32{float32(len(text)), 1}
+	}
+	return out, nil
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeWeaviate(t)
+	store, err := weaviate.New(endpoint, "Document", pairEmbedder{}, weaviate.WithMetadataProperty("tenant", "tenant"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Migrate(context.Background()))
+	require.NoError(t, store.Migrate(context.Background()))
+	require.Len(t, fake.classes, 1)
+	require.Equal(t, "none", fake.classes[0]["vectorizer"])
+
+	var names []string
+	for _, p := range fake.classes[0]["properties"].([]any) {
+		names = append(names, p.(map[string]any)["name"].(string))
+	}
+	require.Equal(t, []string{"docId", "text", "metadata", "spicedbObject", "tenant"}, names)
+}
+
+func TestAddInBatches(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeWeaviate(t)
+	store, err := weaviate.New(endpoint, "Document", pairEmbedder{},
+		weaviate.WithBatchSize(2), weaviate.WithMetadataProperty("tenant", "tenant"))
+	require.NoError(t, err)
+
+	docs := []rag.Document{
+		{ID: "a", Text: "abc", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a", "tenant": "acme"}},
+		{ID: "b", Text: "b"},
+		{ID: "c", Text: "cc"},
+	}
+	require.NoError(t, store.Add(context.Background(), docs...))
+	require.Len(t, fake.batches, 2)
+	require.Len(t, fake.batches[0], 2)
+
+	first := fake.batches[0][0]
+	require.Equal(t, "Document", first["class"])
+	require.Equal(t, []any{3.0, 1.0}, first["vector"])
+	require.Equal(t, map[string]any{
+		"docId":         "a",
+		"text":          "abc",
+		"metadata":      `{"spicedb_object":"document:a","tenant":"acme"}`,
+		"spicedbObject": "document:a",
+		"tenant":        "acme",
+	}, first["properties"])
+
+	fake.failID = "b"
+	require.ErrorContains(t, store.Add(context.Background(), docs...), "vector lengths don't match")
+
+	require.NoError(t, store.Remove(context.Background(), "a"))
+	require.Equal(t, []string{first["id"].(string)}, fake.deleted)
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	fake, endpoint := newFakeWeaviate(t)
+	store, err := weaviate.New(endpoint, "Document", pairEmbedder{})
+	require.NoError(t, err)
+	fake.hits = []map[string]any{
+		{"docId": "a", "text": "abc", "metadata": `{"spicedb_object":"document:a"}`, "_additional": map[string]any{"distance": 0.25}},
+		{"docId": "b", "text": "b", "metadata": "null", "_additional": map[string]any{"distance": 0.5}},
+	}
+
+	scored, err := store.RetrieveScored(context.Background(), "q", 2)
+	require.NoError(t, err)
+	require.Equal(t, []rag.ScoredDocument{
+		{Document: rag.Document{ID: "a", Text: "abc", Metadata: map[string]string{rag.SpiceDBObjectKey: "document:a"}}, Score: 0.75},
+		{Document: rag.Document{ID: "b", Text: "b"}, Score: 0.5},
+	}, scored)
+	require.Contains(t, fake.queries[0], "Document(nearVector: {vector: [1,1]}, limit: 2)")
+
+	_, err = store.RetrieveAccessible(context.Background(), "q", 0, []string{"document:a", "document:b"})
+	require.NoError(t, err)
+	require.Contains(t, fake.queries[1], `limit: 10000, where: {path: ["spicedbObject"], operator: ContainsAny, valueText: ["document:a","document:b"]}`)
+}
+
+func TestNewValidates(t *testing.T) {
+	t.Parallel()
+
+	_, err := weaviate.New("http://x", "document", pairEmbedder{})
+	require.ErrorIs(t, err, weaviate.ErrInvalidClass)
+
+	_, err = weaviate.New("http://x", "Document", pairEmbedder{}, weaviate.WithMetadataProperty("k", "text"))
+	require.ErrorIs(t, err, weaviate.ErrInvalidClass)
+}
@@ -0,0 +1,126 @@
+// Package weaviatetest starts throwaway Weaviate servers in containers via
+// Testcontainers.
+package weaviatetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// DefaultImage is the Weaviate image started when none is configured.
+	DefaultImage = "cr.weaviate.io/semitechnologies/weaviate:1.27.0"
+
+	// DefaultStartupTimeout bounds how long Run waits for Weaviate to be
+	// ready.
+	DefaultStartupTimeout = time.Minute
+
+	port = "8080/tcp"
+)
+
+// Instance is a running Weaviate container.
+type Instance struct {
+	// Endpoint is the base URL of the REST and GraphQL APIs, for
+	// weaviate.New.
+	Endpoint string
+
+	container testcontainers.Container
+}
+
+// Terminate removes the container.
+func (i *Instance) Terminate(ctx context.Context) error {
+	return i.container.Terminate(ctx)
+}
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	image          string
+	startupTimeout time.Duration
+}
+
+// WithImage overrides the Weaviate image.
+func WithImage(image string) Option {
+	return func(c *config) {
+		c.image = image
+	}
+}
+
+// WithStartupTimeout overrides DefaultStartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = d
+	}
+}
+
+// Run starts a Weaviate container. The caller owns the instance and must
+// Terminate it.
+func Run(ctx context.Context, opts ...Option) (*Instance, error) {
+	cfg := config{image: DefaultImage, startupTimeout: DefaultStartupTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.image,
+			ExposedPorts: []string{port},
+			Env: map[string]string{
+				"AUTHENTICATION_ANONYMOUS_ACCESS_ENABLED": "true",
+				"PERSISTENCE_DATA_PATH":                   "/var/lib/weaviate",
+				"DEFAULT_VECTORIZER_MODULE":               "none",
+				"CLUSTER_HOSTNAME":                        "node1",
+			},
+			WaitingFor: wait.ForHTTP("/v1/.well-known/ready").WithPort(port).WithStartupTimeout(cfg.startupTimeout),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if container != nil {
+			_ = container.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("weaviatetest: starting container: %w", err)
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, port, "http")
+	if err != nil {
+		_ = container.Terminate(ctx)
+		return nil, fmt.Errorf("weaviatetest: resolving endpoint: %w", err)
+	}
+	return &Instance{Endpoint: endpoint, container: container}, nil
+}
+
+// Cleanup tears down an instance started by StartWeaviate. It is safe to
+// call more than once.
+type Cleanup func()
+
+// StartWeaviate runs a Weaviate server for the duration of a test and
+// returns its endpoint. The test is skipped when no container runtime is
+// available and fails if the server cannot be started.
+//
+// Teardown is registered with t.Cleanup; call the returned Cleanup only
+// to stop the server earlier.
+func StartWeaviate(t *testing.T, opts ...Option) (string, Cleanup) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	inst, err := Run(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := Cleanup(sync.OnceFunc(func() {
+		if err := inst.Terminate(context.Background()); err != nil {
+			t.Logf("weaviatetest: terminating container: %v", err)
+		}
+	}))
+	t.Cleanup(cleanup)
+	return inst.Endpoint, cleanup
+}